@@ -8,6 +8,10 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -20,9 +24,30 @@ import (
 
 type DeploymentReconciler struct {
 	client.Client
-	Scheme        *runtime.Scheme
-	mutex         sync.RWMutex
-	cooldownCache map[string]time.Time
+	Scheme  *runtime.Scheme
+	Backoff *throttle.AdaptiveBackoff
+	// RespectPDBs defers scale-downs that would violate PodDisruptionBudgets
+	RespectPDBs bool
+	// ScaleDownUnschedulable removes replicas that stay unschedulable
+	ScaleDownUnschedulable bool
+	// SetDeletionCost marks the least utilized pods with a low pod-deletion-cost before scale-downs
+	SetDeletionCost bool
+	// LimitSurge caps scale-ups by the deployment's maxSurge and the node headroom
+	LimitSurge bool
+	// Namespaces skips objects in namespaces opted out with the ignore label
+	Namespaces *predicates.NamespaceFilter
+	// Config overrides thresholds and feature gates at runtime. Nil keeps the startup configuration.
+	Config *controllerconfig.Config
+	// QueueScalers measure the backlog of external event sources by the name
+	// deployments refer to them with in QueueScalerAnnotation
+	QueueScalers map[string]QueueScaler
+
+	mutex              sync.RWMutex
+	cooldownCache      map[string]time.Time
+	unschedulableCache map[string]bool
+	// rejectedQueueTargets holds the last rejected queue target per deployment
+	rejectedQueueTargets map[string]string
+	burstCache           map[string]burstState
 }
 
 const (
@@ -42,7 +67,7 @@ const (
 func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
-	if isSystemNamespace(req.Namespace) {
+	if r.Namespaces.Ignored(ctx, req.Namespace) {
 		return ctrl.Result{}, nil
 	}
 
@@ -53,6 +78,8 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		if errors.IsNotFound(err) {
 			// Deployment not found, probably deleted
 			log.Info("Deployment not found. Skipping reconciliation", "deployment", req.Name, "error", err)
+			forgetScalingDecision(req.Namespace, req.Name)
+			r.forgetBurst(req.Namespace, req.Name)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object
@@ -63,19 +90,38 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// Check if deployment has the auto-scaler label
 	if !hasAutoScaleLabel(deployment) {
 		log.Info("Deployment doesn't have auto-scaler label, skipping", "deployment", deployment.Name)
+		forgetScalingDecision(deployment.Namespace, deployment.Name)
+		r.forgetBurst(deployment.Namespace, deployment.Name)
 		return ctrl.Result{}, nil
 	}
 
 	// Check if deployment is ready
 	if !isDeploymentReady(deployment) {
 		log.Info("Deployment not ready yet, will retry", "deployment", deployment.Name)
-		return ctrl.Result{RequeueAfter: ScalingCooldown}, nil
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ScalingCooldown)}, nil
 	}
 
-	// Check if we are in cooldown period
-	if r.isInCooldown(deployment.Name) {
-		log.Info("In cooldown. Skipping Scaling")
-		return ctrl.Result{RequeueAfter: ScalingCooldown}, nil
+	// Scheduled scaling profiles override the replica bounds
+	bounds, err := replicaBounds(deployment, time.Now())
+	if err != nil {
+		log.Error(err, "Ignoring scaling profiles", "deployment", deployment.Name)
+	}
+
+	// Replicas the cluster can't place don't count as capacity
+	unschedulable, err := r.countUnschedulablePods(ctx, deployment)
+	if err != nil {
+		log.Error(err, "Failed to check for unschedulable pods", "deployment", deployment.Name)
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if r.markUnschedulable(deployment, unschedulable.Count > 0) {
+		message := fmt.Sprintf("%d replica(s) of %s can't be scheduled, further scale-ups are blocked", unschedulable.Count, deployment.Name)
+		log.Info("Deployment has unschedulable replicas", "deployment", deployment.Name, "unschedulable", unschedulable.Count)
+		if err := r.createWarningEvent(ctx, deployment, UnschedulableReplicasReason, message); err != nil {
+			log.Error(err, "Failed to create unschedulable replicas event", "deployment", deployment.Name)
+		}
+	}
+	if r.ScaleDownUnschedulable && unschedulable.Stuck > 0 && *deployment.Spec.Replicas > bounds.Min {
+		return r.scaleBackUnschedulable(ctx, deployment, unschedulable.Stuck, bounds)
 	}
 
 	// get fake CPU usage for the deployment
@@ -83,19 +129,163 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	log.Info("Current CPU usage", "deployment", deployment.Name, "cpu", cpuUsage)
 
 	// Check if scaling is needed
-	shouldScale, newReplicas := r.shouldScale(deployment, cpuUsage, log)
+	shouldScale, newReplicas, scaleReason := r.shouldScale(deployment, cpuUsage, bounds, log)
+
+	// Deployments consuming a queue get at least the replicas its backlog
+	// needs, like an HPA the larger recommendation wins
+	var queueDetail string
+	queuePolicy, queueEnabled, err := getQueuePolicy(deployment)
+	if err != nil {
+		log.Error(err, "Ignoring queue scaler", "deployment", deployment.Name)
+	}
+	if queueEnabled && !r.checkQueueTarget(ctx, deployment, queuePolicy) {
+		queueEnabled = false
+	}
+	if queueEnabled {
+		backlog, err := r.queueBacklog(ctx, queuePolicy)
+		if err != nil {
+			// CPU keeps scaling the deployment until the backlog can be read again
+			log.Error(err, "Failed to get queue backlog", "deployment", deployment.Name, "scaler", queuePolicy.Scaler)
+		} else {
+			recordQueueBacklog(deployment, queuePolicy, backlog)
+			currentReplicas := *deployment.Spec.Replicas
+			switch replicas := queueReplicas(backlog, queuePolicy, bounds); {
+			case replicas > newReplicas && replicas == currentReplicas:
+				log.Info("Queue backlog needs the current replicas. Skipping scale-down", "deployment", deployment.Name, "backlog", backlog)
+				shouldScale, newReplicas, scaleReason = false, currentReplicas, ""
+			case replicas > newReplicas:
+				log.Info("Scaling on queue backlog", "deployment", deployment.Name, "backlog", backlog,
+					"from", currentReplicas, "to", replicas)
+				shouldScale, newReplicas, scaleReason = true, replicas, QueueBacklogReason
+				queueDetail = fmt.Sprintf("backlog of %.0f in %s queue %s needs %d replicas at %.0f per replica",
+					backlog, queuePolicy.Scaler, queuePolicy.Target, replicas, queuePolicy.BacklogPerReplica)
+			}
+		}
+	}
+
+	// Sudden spikes over-provision by the burst factor, the extra replicas are
+	// kept until the load stabilized and then taken back by regular scale-downs
+	burstPolicy, burstEnabled, err := getBurstPolicy(deployment)
+	if err != nil {
+		log.Error(err, "Ignoring burst detection", "deployment", deployment.Name)
+	}
+	var burst BurstDecision
+	if burstEnabled {
+		burst = r.detectBurst(deployment, burstPolicy, cpuUsage, time.Now())
+		currentReplicas := *deployment.Spec.Replicas
+		switch {
+		case burst.Spike && currentReplicas < bounds.Max:
+			newReplicas = max(newReplicas, burstReplicas(currentReplicas, burstPolicy.Factor, bounds))
+			shouldScale, scaleReason = true, BurstScaleUpReason
+			log.Info("CPU usage spike, burst scaling", "deployment", deployment.Name, "rate", burst.Rate,
+				"from", currentReplicas, "to", newReplicas)
+		case burst.Holding && shouldScale && newReplicas < currentReplicas && currentReplicas <= bounds.Max:
+			log.Info("Holding burst capacity. Skipping scale-down", "deployment", deployment.Name)
+			shouldScale, newReplicas = false, currentReplicas
+		}
+	}
+	decision := ScalingDecision{
+		DesiredReplicas:  newReplicas,
+		Bounds:           bounds,
+		CPUUsage:         cpuUsage,
+		CPUThresholdLow:  r.Config.Float(SettingCPUThresholdLow, CPUThresholdLow),
+		CPUThresholdHigh: r.Config.Float(SettingCPUThresholdHigh, CPUThresholdHigh),
+	}
+	recordScalingDecision(deployment, decision)
 	if !shouldScale {
-		return ctrl.Result{RequeueAfter: ScalingCooldown}, nil
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ScalingCooldown)}, nil
+	}
+
+	// Back off scale-ups while replicas are waiting for room in the cluster
+	if newReplicas > *deployment.Spec.Replicas && unschedulable.Count > 0 {
+		log.Info("Unschedulable replicas. Skipping scale-up", "deployment", deployment.Name, "unschedulable", unschedulable.Count)
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ScalingCooldown)}, nil
+	}
+
+	// Check if we are in the cooldown period for this scaling direction, bursts can't wait
+	if remaining := r.cooldownRemaining(deployment, newReplicas > *deployment.Spec.Replicas); remaining > 0 && !burst.Spike {
+		log.Info("In cooldown. Skipping Scaling", "deployment", deployment.Name, "remaining", remaining)
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(min(remaining, ScalingCooldown))}, nil
+	}
+
+	// Never scale down below what PodDisruptionBudgets require
+	if r.respectPDBs() && newReplicas < *deployment.Spec.Replicas {
+		message, err := r.checkPDBScaleDown(ctx, deployment, newReplicas)
+		if err != nil {
+			log.Error(err, "Failed to check pod disruption budgets", "deployment", deployment.Name)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		if message != "" {
+			log.Info("Deferring scale-down because of pod disruption budget", "deployment", deployment.Name, "reason", message)
+			if err := r.createScaleDownDeferredEvent(ctx, deployment, message); err != nil {
+				log.Error(err, "Failed to create scale-down deferred event", "deployment", deployment.Name)
+			}
+			return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ScalingCooldown)}, nil
+		}
+	}
+
+	// Don't start more pods at once than the rolling update allows or the nodes can place
+	var limited string
+	if r.limitSurge() && newReplicas > *deployment.Spec.Replicas {
+		limit, err := r.limitScaleUp(ctx, deployment, newReplicas)
+		if err != nil {
+			log.Error(err, "Failed to limit scale-up", "deployment", deployment.Name)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		if limit.Replicas <= *deployment.Spec.Replicas {
+			message := fmt.Sprintf("Deferring scale-up of %s to %d replicas: %s", deployment.Name, newReplicas, limit.Message)
+			log.Info("Deferring scale-up", "deployment", deployment.Name, "limit", limit.Limit, "reason", limit.Message)
+			if err := r.createScaleUpDeferredEvent(ctx, deployment, message); err != nil {
+				log.Error(err, "Failed to create scale-up deferred event", "deployment", deployment.Name)
+			}
+			return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ScalingCooldown)}, nil
+		}
+		if limit.Limit != "" {
+			log.Info("Limiting scale-up", "deployment", deployment.Name, "limit", limit.Limit,
+				"recommended", newReplicas, "to", limit.Replicas)
+			limited = fmt.Sprintf("%d replicas were recommended but %s", newReplicas, limit.Message)
+			newReplicas = limit.Replicas
+		}
 	}
 
 	// Perform scaling
+	action := ScaleAction{
+		Reason:           scaleReason,
+		From:             *deployment.Spec.Replicas,
+		To:               newReplicas,
+		Bounds:           bounds,
+		CPUUsage:         cpuUsage,
+		CPUThresholdLow:  decision.CPUThresholdLow,
+		CPUThresholdHigh: decision.CPUThresholdHigh,
+		Limited:          limited,
+	}
+	if scaleReason == QueueBacklogReason {
+		action.Detail = queueDetail
+	}
+	if scaleReason == BurstScaleUpReason {
+		action.Detail = fmt.Sprintf("CPU usage rose by %.1f points per minute to %.1f%%, burst capacity kept for at least %s",
+			burst.Rate, cpuUsage, burstPolicy.Stabilization)
+	}
 	if err := r.scaleDeployment(ctx, deployment, newReplicas); err != nil {
 		log.Error(err, "Failed to scale deployment", "deployment", deployment.Name, "replicas", newReplicas)
-		return ctrl.Result{}, err
+		if eventErr := r.createScaleEvent(ctx, deployment, action, err); eventErr != nil {
+			log.Error(eventErr, "Failed to create failed scale event", "deployment", deployment.Name)
+		}
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	r.setCoolDown(deployment)
+
+	if err := r.createScaleEvent(ctx, deployment, action, nil); err != nil {
+		log.Error(err, "Failed to create scale event", "deployment", deployment.Name)
 	}
 
 	log.Info("Successfully scaled deployment", "deployment", deployment.Name, "replicas", newReplicas)
-	return ctrl.Result{RequeueAfter: ScalingCooldown}, nil
+	return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ScalingCooldown)}, nil
+}
+
+// respectPDBs reports whether the PDBAwareScaleDown feature is enabled
+func (r *DeploymentReconciler) respectPDBs() bool {
+	return r.Config.FeatureEnabled(PDBAwareScaleDown, r.RespectPDBs)
 }
 
 func hasAutoScaleLabel(deployment *appsv1.Deployment) bool {
@@ -113,86 +303,90 @@ func isDeploymentReady(deployment *appsv1.Deployment) bool {
 	return true
 }
 
-func isSystemNamespace(namespace string) bool {
-	systemNamespaces := []string{
-		"kube-system",
-		"kube-public",
-		"kube-node-lease",
-		"local-path-storage",
-	}
-
-	for _, sn := range systemNamespaces {
-		if namespace == sn {
-			return true
-		}
-	}
-	return false
-}
-
 func (r *DeploymentReconciler) getFakeCPUUsage() float64 {
 	return rand.Float64()*80 + 10 // CPU usafe between 10-90%
 }
 
-func (r *DeploymentReconciler) shouldScale(deployment *appsv1.Deployment, cpuUsage float64, log logr.Logger) (bool, int32) {
+// shouldScale returns whether the deployment has to scale, to how many
+// replicas and the reason code of the decision
+func (r *DeploymentReconciler) shouldScale(deployment *appsv1.Deployment, cpuUsage float64, bounds ReplicaBounds, log logr.Logger) (bool, int32, string) {
 	currentReplicas := *deployment.Spec.Replicas
 
+	// move into the bounds first, e.g. when a scaling profile became active
+	if currentReplicas < bounds.Min || currentReplicas > bounds.Max {
+		newReplicas := min(max(currentReplicas, bounds.Min), bounds.Max)
+		log.Info("Scaling into replica bounds", "deployment", deployment.Name, "from", currentReplicas, "to", newReplicas,
+			"min", bounds.Min, "max", bounds.Max, "profile", bounds.Profile)
+		return true, newReplicas, ReplicaBoundsReason
+	}
+
 	// scale up if CPU usage is high
-	if cpuUsage > CPUThresholdHigh && currentReplicas < MaxReplicas {
+	if cpuUsage > r.Config.Float(SettingCPUThresholdHigh, CPUThresholdHigh) && currentReplicas < bounds.Max {
 		newReplicas := currentReplicas + 1
 		log.Info("Scaling up", "deployment", deployment.Name, "from", currentReplicas, "to", newReplicas)
-		r.setCoolDown(deployment.Name)
-		return true, newReplicas
+		return true, newReplicas, CPUAboveThresholdReason
 	}
 
 	// scale down if CPU usage is low
-	if cpuUsage < CPUThresholdLow && currentReplicas > MinReplicas {
+	if cpuUsage < r.Config.Float(SettingCPUThresholdLow, CPUThresholdLow) && currentReplicas > bounds.Min {
 		newReplicas := currentReplicas - 1
 		log.Info("Scaling down", "deployment", deployment.Name, "from", currentReplicas, "to", newReplicas)
-		r.setCoolDown(deployment.Name)
-		return true, newReplicas
+		return true, newReplicas, CPUBelowThresholdReason
 	}
 
 	log.Info("None conditions matched")
-	return false, currentReplicas
+	return false, currentReplicas, ""
 }
 
-func (r *DeploymentReconciler) scaleDeployment(ctx context.Context, deployment *appsv1.Deployment, newReplicas int32) error {
-	deploymentCopy := deployment.DeepCopy()
-	deploymentCopy.Spec.Replicas = &newReplicas
-
-	return r.Update(ctx, deploymentCopy)
-}
-
-func (r *DeploymentReconciler) isInCooldown(deploymentName string) bool {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+// scaleBackUnschedulable removes replicas that stayed unschedulable. The
+// Deployment controller deletes unscheduled pods first when scaling down.
+func (r *DeploymentReconciler) scaleBackUnschedulable(ctx context.Context, deployment *appsv1.Deployment, stuck int32, bounds ReplicaBounds) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
 
-	if r.cooldownCache == nil {
-		return false
+	currentReplicas := *deployment.Spec.Replicas
+	newReplicas := max(currentReplicas-stuck, bounds.Min)
+	action := ScaleAction{
+		Reason: ScaledBackUnschedulableReason,
+		From:   currentReplicas,
+		To:     newReplicas,
+		Bounds: bounds,
+		Detail: fmt.Sprintf("%d replica(s) were unschedulable for more than %s", stuck, UnschedulableGracePeriod),
 	}
-
-	lastScale, exists := r.cooldownCache[deploymentName]
-	if !exists {
-		return false
+	if err := r.scaleDeployment(ctx, deployment, newReplicas); err != nil {
+		log.Error(err, "Failed to scale back unschedulable replicas", "deployment", deployment.Name, "replicas", newReplicas)
+		if eventErr := r.createScaleEvent(ctx, deployment, action, err); eventErr != nil {
+			log.Error(eventErr, "Failed to create failed scale event", "deployment", deployment.Name)
+		}
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
 	}
+	r.setCoolDown(deployment)
 
-	return time.Since(lastScale) < ScalingCooldown
+	log.Info("Scaled back unschedulable replicas", "deployment", deployment.Name, "from", currentReplicas, "to", newReplicas)
+	if err := r.createScaleEvent(ctx, deployment, action, nil); err != nil {
+		log.Error(err, "Failed to create scaled back event", "deployment", deployment.Name)
+	}
+	return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ScalingCooldown)}, nil
 }
 
-func (r *DeploymentReconciler) setCoolDown(deploymentName string) {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-
-	if r.cooldownCache == nil {
-		r.cooldownCache = make(map[string]time.Time)
+func (r *DeploymentReconciler) scaleDeployment(ctx context.Context, deployment *appsv1.Deployment, newReplicas int32) error {
+	// Steer the ReplicaSet controller to the cheapest pods. Without metrics it
+	// falls back to its default order, so failures don't block the scale-down.
+	if removed := *deployment.Spec.Replicas - newReplicas; removed > 0 && r.setDeletionCost() {
+		if err := r.markPodsForScaleDown(ctx, deployment, removed); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to set pod deletion costs", "deployment", deployment.Name)
+		}
 	}
 
-	r.cooldownCache[deploymentName] = time.Now()
+	deploymentCopy := deployment.DeepCopy()
+	deploymentCopy.Spec.Replicas = &newReplicas
+
+	return r.Update(ctx, deploymentCopy)
 }
 
 func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appsv1.Deployment{}).
+		WithEventFilter(r.Namespaces.Predicate()).
 		WithEventFilter(predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool {
 				log := log.FromContext(context.Background())
@@ -260,5 +454,5 @@ func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return true
 			},
 		}).
-		Complete(r)
+		Complete(recovery.Wrap("auto-scaler", r))
 }
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	// Annotation enabling burst detection: the CPU usage rise in percentage
+	// points per minute from which a deployment scales by the burst factor
+	BurstThresholdAnnotation = "auto-scaler/burst-threshold"
+
+	// Annotation with the factor replicas are multiplied by on a burst
+	BurstFactorAnnotation = "auto-scaler/burst-factor"
+
+	// Annotation with how long burst capacity is kept after the last spike
+	// before regular scale-downs take it back, as a Go duration
+	BurstStabilizationAnnotation = "auto-scaler/burst-stabilization"
+
+	DefaultBurstFactor        = 2.0
+	DefaultBurstStabilization = 5 * time.Minute
+
+	// Samples closer together than this are too noisy for a rate, e.g. a
+	// reconcile triggered by the scale operation itself
+	minBurstSampleInterval = 5 * time.Second
+
+	// Event reason for burst scale-ups
+	BurstScaleUpReason = "BurstScaleUp"
+)
+
+// BurstPolicy configures the temporary over-provisioning of a deployment on
+// sudden load spikes
+type BurstPolicy struct {
+	// Threshold is the CPU usage rise in percentage points per minute
+	Threshold float64
+	// Factor multiplies the current replicas on a burst
+	Factor float64
+	// Stabilization is how long scale-downs wait after the last spike
+	Stabilization time.Duration
+}
+
+// burstState is the last CPU sample and spike of a deployment
+type burstState struct {
+	cpuUsage  float64
+	sampledAt time.Time
+	lastSpike time.Time
+}
+
+// BurstDecision is the outcome of burst detection for one CPU sample
+type BurstDecision struct {
+	// Rate is the CPU usage change in percentage points per minute
+	Rate float64
+	// Spike starts a new burst, the deployment scales by the burst factor
+	Spike bool
+	// Holding keeps the burst capacity, scale-downs wait for the stabilization
+	Holding bool
+}
+
+// getBurstPolicy returns the burst policy of a deployment and whether burst
+// detection is enabled. Invalid annotations disable it and return an error.
+func getBurstPolicy(deployment *appsv1.Deployment) (BurstPolicy, bool, error) {
+	policy := BurstPolicy{Factor: DefaultBurstFactor, Stabilization: DefaultBurstStabilization}
+
+	value, exists := deployment.Annotations[BurstThresholdAnnotation]
+	if !exists {
+		return policy, false, nil
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold <= 0 {
+		return policy, false, fmt.Errorf("invalid %s annotation %q: must be a positive number", BurstThresholdAnnotation, value)
+	}
+	policy.Threshold = threshold
+
+	if value, exists := deployment.Annotations[BurstFactorAnnotation]; exists {
+		factor, err := strconv.ParseFloat(value, 64)
+		if err != nil || factor <= 1 {
+			return policy, false, fmt.Errorf("invalid %s annotation %q: must be a number above 1", BurstFactorAnnotation, value)
+		}
+		policy.Factor = factor
+	}
+
+	if value, exists := deployment.Annotations[BurstStabilizationAnnotation]; exists {
+		stabilization, err := time.ParseDuration(value)
+		if err != nil || stabilization < 0 {
+			return policy, false, fmt.Errorf("invalid %s annotation %q: must be a duration", BurstStabilizationAnnotation, value)
+		}
+		policy.Stabilization = stabilization
+	}
+	return policy, true, nil
+}
+
+// detectBurst records a CPU sample of a deployment and compares its rise since
+// the previous sample against the burst threshold. A spike only starts a new
+// burst when the deployment isn't holding burst capacity already, further
+// spikes extend the stabilization window.
+func (r *DeploymentReconciler) detectBurst(deployment *appsv1.Deployment, policy BurstPolicy, cpuUsage float64, now time.Time) BurstDecision {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.burstCache == nil {
+		r.burstCache = make(map[string]burstState)
+	}
+	key := cooldownKey(deployment)
+	state := r.burstCache[key]
+	holding := !state.lastSpike.IsZero() && now.Sub(state.lastSpike) < policy.Stabilization
+
+	var decision BurstDecision
+	elapsed := now.Sub(state.sampledAt)
+	if !state.sampledAt.IsZero() && elapsed < minBurstSampleInterval {
+		decision.Holding = holding
+		return decision
+	}
+	if !state.sampledAt.IsZero() {
+		decision.Rate = (cpuUsage - state.cpuUsage) / elapsed.Minutes()
+		if decision.Rate >= policy.Threshold {
+			decision.Spike = !holding
+			state.lastSpike = now
+			holding = policy.Stabilization > 0
+		}
+	}
+	decision.Holding = holding
+
+	state.cpuUsage, state.sampledAt = cpuUsage, now
+	r.burstCache[key] = state
+	return decision
+}
+
+// forgetBurst drops the burst state of a deployment that is deleted or no longer auto-scaled
+func (r *DeploymentReconciler) forgetBurst(namespace, name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.burstCache, namespace+"/"+name)
+}
+
+// burstReplicas returns the replicas of a burst: the current replicas times
+// the burst factor, at least one more and never above the maximum
+func burstReplicas(currentReplicas int32, factor float64, bounds ReplicaBounds) int32 {
+	replicas := int32(math.Ceil(float64(currentReplicas) * factor))
+	return min(max(replicas, currentReplicas+1), bounds.Max)
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	// Annotations overriding the cooldown after a scale operation before the next
+	// scale-up or scale-down is allowed, as Go durations (e.g. "15s", "5m")
+	ScaleUpCooldownAnnotation   = "auto-scaler/scale-up-cooldown"
+	ScaleDownCooldownAnnotation = "auto-scaler/scale-down-cooldown"
+)
+
+// getCooldowns returns the scale-up and scale-down cooldowns of a deployment.
+// Missing or invalid annotations fall back to defaultCooldown.
+func getCooldowns(deployment *appsv1.Deployment, defaultCooldown time.Duration) (time.Duration, time.Duration) {
+	return parseCooldown(deployment, ScaleUpCooldownAnnotation, defaultCooldown),
+		parseCooldown(deployment, ScaleDownCooldownAnnotation, defaultCooldown)
+}
+
+func parseCooldown(deployment *appsv1.Deployment, annotation string, defaultCooldown time.Duration) time.Duration {
+	value, exists := deployment.Annotations[annotation]
+	if !exists {
+		return defaultCooldown
+	}
+
+	cooldown, err := time.ParseDuration(value)
+	if err != nil || cooldown < 0 {
+		return defaultCooldown
+	}
+	return cooldown
+}
+
+// cooldownRemaining returns how long a deployment has to wait before it may
+// scale in the given direction. Zero means scaling is allowed.
+func (r *DeploymentReconciler) cooldownRemaining(deployment *appsv1.Deployment, scaleUp bool) time.Duration {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.cooldownCache == nil {
+		return 0
+	}
+
+	lastScale, exists := r.cooldownCache[cooldownKey(deployment)]
+	if !exists {
+		return 0
+	}
+
+	upCooldown, downCooldown := getCooldowns(deployment, r.Config.Duration(SettingScalingCooldown, ScalingCooldown))
+	cooldown := downCooldown
+	if scaleUp {
+		cooldown = upCooldown
+	}
+
+	return max(cooldown-time.Since(lastScale), 0)
+}
+
+func (r *DeploymentReconciler) setCoolDown(deployment *appsv1.Deployment) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.cooldownCache == nil {
+		r.cooldownCache = make(map[string]time.Time)
+	}
+
+	r.cooldownCache[cooldownKey(deployment)] = time.Now()
+}
+
+func cooldownKey(deployment *appsv1.Deployment) string {
+	return deployment.Namespace + "/" + deployment.Name
+}
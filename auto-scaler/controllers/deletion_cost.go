@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Annotation the ReplicaSet controller reads to pick the pods it removes on
+	// scale-down, lower costs go first
+	PodDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+	// Annotation marking deletion costs set by the auto-scaler, so they can be
+	// cleared again without touching costs set by others
+	DeletionCostSetAnnotation = "auto-scaler/deletion-cost-set"
+
+	// ScaleDownDeletionCost is set on the pods picked for removal. It is below
+	// the default cost of 0, so the ReplicaSet controller removes them first.
+	ScaleDownDeletionCost = -1000
+)
+
+// podMetricsListGVK is the metrics-server PodMetrics list. It is read as
+// unstructured, so the controller doesn't depend on the metrics client.
+var podMetricsListGVK = schema.GroupVersionKind{Group: "metrics.k8s.io", Version: "v1beta1", Kind: "PodMetricsList"}
+
+// podUsage is the CPU usage of a pod in millicores
+type podUsage struct {
+	pod      *corev1.Pod
+	milliCPU int64
+}
+
+// setDeletionCost reports whether the PodDeletionCost feature is enabled
+func (r *DeploymentReconciler) setDeletionCost() bool {
+	return r.Config.FeatureEnabled(PodDeletionCost, r.SetDeletionCost)
+}
+
+// markPodsForScaleDown sets a low pod-deletion-cost on the removed least
+// utilized running pods of a deployment, so the ReplicaSet controller removes
+// the cheapest pods instead of the newest ones. Costs set for earlier
+// scale-downs on pods that are kept are cleared. Pods with a deletion cost set
+// by someone else and pods without metrics are left alone.
+func (r *DeploymentReconciler) markPodsForScaleDown(ctx context.Context, deployment *appsv1.Deployment, removed int32) error {
+	if deployment.Spec.Selector == nil || removed <= 0 {
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid deployment selector: %w", err)
+	}
+
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	usage, err := r.getPodCPUUsage(ctx, deployment.Namespace, selector)
+	if err != nil {
+		return err
+	}
+
+	var candidates []podUsage
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		_, costSet := pod.Annotations[PodDeletionCostAnnotation]
+		if costSet && pod.Annotations[DeletionCostSetAnnotation] != "true" {
+			continue
+		}
+		milliCPU, exists := usage[pod.Name]
+		if !exists {
+			continue
+		}
+		candidates = append(candidates, podUsage{pod: pod, milliCPU: milliCPU})
+	}
+
+	// Least utilized first, ties broken by name for stable picks
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].milliCPU != candidates[j].milliCPU {
+			return candidates[i].milliCPU < candidates[j].milliCPU
+		}
+		return candidates[i].pod.Name < candidates[j].pod.Name
+	})
+
+	for i, candidate := range candidates {
+		if err := r.updateDeletionCost(ctx, candidate.pod, int32(i) < removed); err != nil {
+			return fmt.Errorf("failed to set deletion cost of pod %s: %w", candidate.pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// getPodCPUUsage returns the CPU usage in millicores of the pods matching a
+// selector, as reported by the metrics API
+func (r *DeploymentReconciler) getPodCPUUsage(ctx context.Context, namespace string, selector labels.Selector) (map[string]int64, error) {
+	podMetricsList := &unstructured.UnstructuredList{}
+	podMetricsList.SetGroupVersionKind(podMetricsListGVK)
+	if err := r.List(ctx, podMetricsList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("failed to list pod metrics: %w", err)
+	}
+
+	usage := make(map[string]int64)
+	for _, podMetrics := range podMetricsList.Items {
+		containers, _, err := unstructured.NestedSlice(podMetrics.Object, "containers")
+		if err != nil {
+			continue
+		}
+
+		var milliCPU int64
+		for _, container := range containers {
+			fields, _ := container.(map[string]interface{})
+			cpu, _, _ := unstructured.NestedString(fields, "usage", "cpu")
+			if quantity, err := resource.ParseQuantity(cpu); err == nil {
+				milliCPU += quantity.MilliValue()
+			}
+		}
+		usage[podMetrics.GetName()] = milliCPU
+	}
+	return usage, nil
+}
+
+// updateDeletionCost sets or clears the scale-down deletion cost of a pod,
+// skipping the update when it is already in that state
+func (r *DeploymentReconciler) updateDeletionCost(ctx context.Context, pod *corev1.Pod, remove bool) error {
+	marked := pod.Annotations[DeletionCostSetAnnotation] == "true"
+	if marked == remove {
+		return nil
+	}
+
+	podCopy := pod.DeepCopy()
+	if remove {
+		if podCopy.Annotations == nil {
+			podCopy.Annotations = make(map[string]string)
+		}
+		podCopy.Annotations[PodDeletionCostAnnotation] = strconv.Itoa(ScaleDownDeletionCost)
+		podCopy.Annotations[DeletionCostSetAnnotation] = "true"
+	} else {
+		delete(podCopy.Annotations, PodDeletionCostAnnotation)
+		delete(podCopy.Annotations, DeletionCostSetAnnotation)
+	}
+
+	log.FromContext(ctx).Info("Updating pod deletion cost", "pod", pod.Name, "namespace", pod.Namespace, "scale-down", remove)
+	return r.Update(ctx, podCopy)
+}
@@ -0,0 +1,19 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/featuregate"
+
+const (
+	// PDBAwareScaleDown defers scale-downs that would violate PodDisruptionBudgets
+	PDBAwareScaleDown featuregate.Feature = "PDBAwareScaleDown"
+	// PodDeletionCost removes the least utilized pods first on scale-down
+	PodDeletionCost featuregate.Feature = "PodDeletionCost"
+	// SurgeLimitedScaleUp caps scale-ups by the deployment's maxSurge and the node headroom
+	SurgeLimitedScaleUp featuregate.Feature = "SurgeLimitedScaleUp"
+)
+
+// FeatureGates lists the features of this controller that can be toggled with --feature-gates
+var FeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	PDBAwareScaleDown:   {Default: true, Stage: featuregate.Beta},
+	PodDeletionCost:     {Default: false, Stage: featuregate.Alpha},
+	SurgeLimitedScaleUp: {Default: false, Stage: featuregate.Alpha},
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Scaling decisions are exported under the names kube-state-metrics uses for
+// HorizontalPodAutoscalers, so existing HPA dashboards and alerts work against
+// this controller. The horizontalpodautoscaler label holds the Deployment name.
+var (
+	hpaLabels       = []string{"namespace", "horizontalpodautoscaler"}
+	hpaMetricLabels = []string{"namespace", "horizontalpodautoscaler", "metric_name", "metric_target_type"}
+
+	desiredReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_horizontalpodautoscaler_status_desired_replicas",
+		Help: "Desired number of replicas of the deployment as last calculated by the auto-scaler",
+	}, hpaLabels)
+
+	currentReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_horizontalpodautoscaler_status_current_replicas",
+		Help: "Current number of replicas of pods managed by the auto-scaler",
+	}, hpaLabels)
+
+	minReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_horizontalpodautoscaler_spec_min_replicas",
+		Help: "Lower limit for the number of replicas, including scheduled scaling profiles",
+	}, hpaLabels)
+
+	maxReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_horizontalpodautoscaler_spec_max_replicas",
+		Help: "Upper limit for the number of replicas, including scheduled scaling profiles",
+	}, hpaLabels)
+
+	targetUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_horizontalpodautoscaler_spec_target_metric",
+		Help: "Target CPU utilization of the auto-scaler, the middle of the scale-down and scale-up thresholds",
+	}, hpaMetricLabels)
+
+	currentUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_horizontalpodautoscaler_status_target_metric",
+		Help: "Current CPU utilization the last scaling decision was based on",
+	}, hpaMetricLabels)
+)
+
+func init() {
+	metrics.Registry.MustRegister(desiredReplicas, currentReplicas, minReplicas, maxReplicas, targetUtilization, currentUtilization)
+}
+
+// ScalingDecision holds the inputs and outcome of one scaling calculation
+type ScalingDecision struct {
+	DesiredReplicas  int32
+	Bounds           ReplicaBounds
+	CPUUsage         float64
+	CPUThresholdLow  float64
+	CPUThresholdHigh float64
+}
+
+// recordScalingDecision exports a scaling decision for a deployment. The
+// desired replicas are the calculated recommendation, even when a cooldown,
+// PDB or unschedulable replicas hold the actual scaling back.
+func recordScalingDecision(deployment *appsv1.Deployment, decision ScalingDecision) {
+	namespace, name := deployment.Namespace, deployment.Name
+	desiredReplicas.WithLabelValues(namespace, name).Set(float64(decision.DesiredReplicas))
+	currentReplicas.WithLabelValues(namespace, name).Set(float64(deployment.Status.Replicas))
+	minReplicas.WithLabelValues(namespace, name).Set(float64(decision.Bounds.Min))
+	maxReplicas.WithLabelValues(namespace, name).Set(float64(decision.Bounds.Max))
+
+	target := (decision.CPUThresholdLow + decision.CPUThresholdHigh) / 2
+	targetUtilization.WithLabelValues(namespace, name, "cpu", "utilization").Set(target)
+	currentUtilization.WithLabelValues(namespace, name, "cpu", "utilization").Set(decision.CPUUsage)
+}
+
+// recordQueueBacklog exports the backlog of a deployment's queue like an HPA
+// exports an external metric with an average value target
+func recordQueueBacklog(deployment *appsv1.Deployment, policy QueuePolicy, backlog float64) {
+	namespace, name := deployment.Namespace, deployment.Name
+	metricName := policy.Scaler + "_backlog"
+	targetUtilization.WithLabelValues(namespace, name, metricName, "average").Set(policy.BacklogPerReplica)
+	currentUtilization.WithLabelValues(namespace, name, metricName, "average").Set(backlog / float64(max(*deployment.Spec.Replicas, 1)))
+}
+
+// forgetScalingDecision removes the metrics of a deployment that is deleted or
+// no longer auto-scaled
+func forgetScalingDecision(namespace, name string) {
+	labels := map[string]string{"namespace": namespace, "horizontalpodautoscaler": name}
+	for _, gauge := range []*prometheus.GaugeVec{desiredReplicas, currentReplicas, minReplicas, maxReplicas, targetUtilization, currentUtilization} {
+		gauge.DeletePartialMatch(labels)
+	}
+}
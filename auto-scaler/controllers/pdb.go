@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Event reason for scale-downs deferred because of a PodDisruptionBudget
+const ScaleDownDeferredReason = "ScaleDownDeferred"
+
+// checkPDBScaleDown verifies that scaling a deployment down to newReplicas keeps
+// enough ready pods for every PodDisruptionBudget covering its pods. Budgets are
+// evaluated from their minAvailable or maxUnavailable spec against the live pods,
+// not from their status, which lags behind and ignores the replicas being removed. It returns
+// a non-empty message describing the violated budget when the scale-down must be deferred.
+func (r *DeploymentReconciler) checkPDBScaleDown(ctx context.Context, deployment *appsv1.Deployment, newReplicas int32) (string, error) {
+	removed := *deployment.Spec.Replicas - newReplicas
+	if removed <= 0 {
+		return "", nil
+	}
+
+	pdbList := &policyv1.PodDisruptionBudgetList{}
+	if err := r.List(ctx, pdbList, client.InNamespace(deployment.Namespace)); err != nil {
+		return "", fmt.Errorf("failed to list pod disruption budgets: %w", err)
+	}
+
+	templateLabels := labels.Set(deployment.Spec.Template.Labels)
+	for _, pdb := range pdbList.Items {
+		if pdb.Spec.Selector == nil || (pdb.Spec.MinAvailable == nil && pdb.Spec.MaxUnavailable == nil) {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() || !selector.Matches(templateLabels) {
+			continue
+		}
+
+		covered, ready, err := r.countCoveredPods(ctx, deployment.Namespace, selector)
+		if err != nil {
+			return "", err
+		}
+
+		// Assume the worst case: every removed replica is a ready pod
+		expectedAfter := covered - int(removed)
+		readyAfter := ready - int(removed)
+		desiredHealthy, field, err := pdbDesiredHealthy(&pdb, expectedAfter)
+		if err != nil {
+			return "", err
+		}
+
+		if readyAfter < desiredHealthy {
+			return fmt.Sprintf("scaling %s from %d to %d replicas would leave %d ready pods, below the %d required by %s of PodDisruptionBudget %s",
+				deployment.Name, *deployment.Spec.Replicas, newReplicas, readyAfter, desiredHealthy, field, pdb.Name), nil
+		}
+	}
+
+	return "", nil
+}
+
+// pdbDesiredHealthy returns how many ready pods a budget requires out of expected pods,
+// and which spec field the requirement comes from. A maxUnavailable budget shrinks with
+// the deployment, so removing replicas only violates it when the remaining pods already
+// exceed the unavailability it tolerates, which is exactly when this check defers.
+func pdbDesiredHealthy(pdb *policyv1.PodDisruptionBudget, expected int) (int, string, error) {
+	if pdb.Spec.MaxUnavailable != nil {
+		maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(pdb.Spec.MaxUnavailable, expected, true)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid maxUnavailable in pod disruption budget %s: %w", pdb.Name, err)
+		}
+		return expected - maxUnavailable, "maxUnavailable " + pdb.Spec.MaxUnavailable.String(), nil
+	}
+
+	minAvailable, err := intstr.GetScaledValueFromIntOrPercent(pdb.Spec.MinAvailable, expected, true)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid minAvailable in pod disruption budget %s: %w", pdb.Name, err)
+	}
+	return minAvailable, "minAvailable " + pdb.Spec.MinAvailable.String(), nil
+}
+
+// countCoveredPods returns the number of pods matching a budget selector and how many of them are ready
+func (r *DeploymentReconciler) countCoveredPods(ctx context.Context, namespace string, selector labels.Selector) (int, int, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return 0, 0, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	covered, ready := 0, 0
+	for _, pod := range podList.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		covered++
+		if isPodReady(&pod) {
+			ready++
+		}
+	}
+	return covered, ready, nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// createScaleDownDeferredEvent records a scale-down deferred by a PodDisruptionBudget
+func (r *DeploymentReconciler) createScaleDownDeferredEvent(ctx context.Context, deployment *appsv1.Deployment, message string) error {
+	// Every deferral gets its own event so repeated deferrals stay visible
+	eventName := fmt.Sprintf("%s.%x", deployment.Name, time.Now().UnixNano())
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventName,
+			Namespace: deployment.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Deployment",
+			Name:            deployment.Name,
+			Namespace:       deployment.Namespace,
+			UID:             deployment.UID,
+			APIVersion:      "apps/v1",
+			ResourceVersion: deployment.ResourceVersion,
+		},
+		Reason:         ScaleDownDeferredReason,
+		Message:        message,
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           corev1.EventTypeWarning,
+		Source: corev1.EventSource{
+			Component: "auto-scaler",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
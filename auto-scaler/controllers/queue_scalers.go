@@ -0,0 +1,387 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Annotation naming the queue scaler of a deployment: sqs, kafka,
+	// prometheus or one registered in main.go
+	QueueScalerAnnotation = "auto-scaler/queue-scaler"
+
+	// Annotation with the queue the scaler measures: an SQS queue URL, a
+	// Kafka "topic/consumer-group" or a PromQL query
+	QueueTargetAnnotation = "auto-scaler/queue-target"
+
+	// Annotation with the backlog one replica works off
+	QueueBacklogPerReplicaAnnotation = "auto-scaler/queue-backlog-per-replica"
+
+	DefaultQueueBacklogPerReplica = 100.0
+
+	// Timeout of a single backlog query
+	DefaultQueueScalerTimeout = 10 * time.Second
+
+	// Reason code of scale actions decided by the queue backlog
+	QueueBacklogReason = "QueueBacklog"
+
+	// Event reason of queue targets a scaler refuses to query
+	InvalidQueueTargetReason = "InvalidQueueTarget"
+)
+
+// SQS endpoints the controller's AWS credentials may be sent to,
+// sqs.<region>.amazonaws.com and the legacy <region>.queue.amazonaws.com
+var sqsHostPattern = regexp.MustCompile(`^(sqs\.([a-z0-9-]+)\.amazonaws\.com|([a-z0-9-]+)\.queue\.amazonaws\.com)$`)
+
+// QueueScaler measures the backlog of an external event source, e.g. the
+// messages waiting in a queue or the lag of a consumer group. Implementations
+// are registered by name in DeploymentReconciler.QueueScalers.
+type QueueScaler interface {
+	// Backlog returns the number of messages waiting in target
+	Backlog(ctx context.Context, target string) (float64, error)
+}
+
+// QueueTargetValidator is implemented by queue scalers that only accept some
+// targets. Rejected targets are never queried and are reported on the deployment.
+type QueueTargetValidator interface {
+	ValidateTarget(target string) error
+}
+
+// QueuePolicy scales a deployment on the backlog of an event source
+type QueuePolicy struct {
+	Scaler string
+	Target string
+	// BacklogPerReplica is the backlog one replica works off, the deployment
+	// gets backlog / BacklogPerReplica replicas
+	BacklogPerReplica float64
+}
+
+// getQueuePolicy returns the queue policy of a deployment and whether queue
+// scaling is enabled. Invalid annotations disable it and return an error.
+func getQueuePolicy(deployment *appsv1.Deployment) (QueuePolicy, bool, error) {
+	policy := QueuePolicy{BacklogPerReplica: DefaultQueueBacklogPerReplica}
+
+	scaler, exists := deployment.Annotations[QueueScalerAnnotation]
+	if !exists {
+		return policy, false, nil
+	}
+	policy.Scaler = strings.TrimSpace(scaler)
+	policy.Target = strings.TrimSpace(deployment.Annotations[QueueTargetAnnotation])
+	if policy.Target == "" {
+		return policy, false, fmt.Errorf("%s is set but %s is missing", QueueScalerAnnotation, QueueTargetAnnotation)
+	}
+
+	if value, exists := deployment.Annotations[QueueBacklogPerReplicaAnnotation]; exists {
+		perReplica, err := strconv.ParseFloat(value, 64)
+		if err != nil || perReplica <= 0 {
+			return policy, false, fmt.Errorf("invalid %s annotation %q: must be a positive number", QueueBacklogPerReplicaAnnotation, value)
+		}
+		policy.BacklogPerReplica = perReplica
+	}
+	return policy, true, nil
+}
+
+// queueReplicas returns the replicas a backlog needs within the bounds
+func queueReplicas(backlog float64, policy QueuePolicy, bounds ReplicaBounds) int32 {
+	replicas := math.Ceil(backlog / policy.BacklogPerReplica)
+	return int32(min(max(replicas, float64(bounds.Min)), float64(bounds.Max)))
+}
+
+// checkQueueTarget reports whether the scaler of a queue policy accepts its
+// target. Each newly rejected target is recorded as a warning on the deployment.
+func (r *DeploymentReconciler) checkQueueTarget(ctx context.Context, deployment *appsv1.Deployment, policy QueuePolicy) bool {
+	validator, ok := r.QueueScalers[policy.Scaler].(QueueTargetValidator)
+	if !ok {
+		return true
+	}
+	err := validator.ValidateTarget(policy.Target)
+
+	r.mutex.Lock()
+	key := cooldownKey(deployment)
+	reported := r.rejectedQueueTargets[key] == policy.Target
+	if err == nil {
+		delete(r.rejectedQueueTargets, key)
+	} else {
+		if r.rejectedQueueTargets == nil {
+			r.rejectedQueueTargets = make(map[string]string)
+		}
+		r.rejectedQueueTargets[key] = policy.Target
+	}
+	r.mutex.Unlock()
+	if err == nil {
+		return true
+	}
+
+	log := log.FromContext(ctx)
+	log.Error(err, "Rejected queue target", "deployment", deployment.Name, "scaler", policy.Scaler)
+	if !reported {
+		message := fmt.Sprintf("Not querying %s queue target %q: %v", policy.Scaler, policy.Target, err)
+		if err := r.createWarningEvent(ctx, deployment, InvalidQueueTargetReason, message); err != nil {
+			log.Error(err, "Failed to create event", "deployment", deployment.Name, "reason", InvalidQueueTargetReason)
+		}
+	}
+	return false
+}
+
+// queueBacklog queries the backlog of a queue policy with its scaler
+func (r *DeploymentReconciler) queueBacklog(ctx context.Context, policy QueuePolicy) (float64, error) {
+	scaler, exists := r.QueueScalers[policy.Scaler]
+	if !exists {
+		return 0, fmt.Errorf("unknown queue scaler %q", policy.Scaler)
+	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultQueueScalerTimeout)
+	defer cancel()
+	return scaler.Backlog(ctx, policy.Target)
+}
+
+// SQSScaler reads ApproximateNumberOfMessages of an SQS queue. Requests are
+// signed with the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optional
+// AWS_SESSION_TOKEN of the controller's environment, so they only go to AWS
+// SQS endpoints over https.
+type SQSScaler struct {
+	Client *http.Client
+}
+
+// ValidateTarget implements QueueTargetValidator. Anyone who can annotate a
+// deployment picks the target, other hosts would receive the credentials.
+func (s *SQSScaler) ValidateTarget(target string) error {
+	_, _, err := parseSQSQueueURL(target)
+	return err
+}
+
+// parseSQSQueueURL returns the endpoint and region of an SQS queue URL
+func parseSQSQueueURL(target string) (string, string, error) {
+	queueURL, err := url.Parse(target)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid SQS queue URL: %w", err)
+	}
+	if queueURL.Scheme != "https" {
+		return "", "", fmt.Errorf("SQS queue URL must use https, got %q", queueURL.Scheme)
+	}
+	if queueURL.User != nil || queueURL.Port() != "" {
+		return "", "", fmt.Errorf("SQS queue URL must not contain credentials or a port")
+	}
+	match := sqsHostPattern.FindStringSubmatch(queueURL.Host)
+	if match == nil {
+		return "", "", fmt.Errorf("SQS queue URL host %q is neither sqs.<region>.amazonaws.com nor <region>.queue.amazonaws.com", queueURL.Host)
+	}
+	region := match[2] + match[3]
+	return fmt.Sprintf("https://%s/", queueURL.Host), region, nil
+}
+
+// Backlog implements QueueScaler, target is the queue URL
+func (s *SQSScaler) Backlog(ctx context.Context, target string) (float64, error) {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return 0, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	endpoint, region, err := parseSQSQueueURL(target)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"QueueUrl":       target,
+		"AttributeNames": []string{"ApproximateNumberOfMessages"},
+	})
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	request.Header.Set("X-Amz-Target", "AmazonSQS.GetQueueAttributes")
+	signAWSRequest(request, body, accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"), region, "sqs", time.Now())
+
+	var result struct {
+		Attributes map[string]string `json:"Attributes"`
+	}
+	if err := doJSON(s.Client, request, &result); err != nil {
+		return 0, fmt.Errorf("failed to get attributes of SQS queue %s: %w", target, err)
+	}
+	messages, err := strconv.ParseFloat(result.Attributes["ApproximateNumberOfMessages"], 64)
+	if err != nil {
+		return 0, fmt.Errorf("SQS queue %s returned no ApproximateNumberOfMessages", target)
+	}
+	return messages, nil
+}
+
+// signAWSRequest signs a request with AWS Signature Version 4
+func signAWSRequest(request *http.Request, body []byte, accessKey, secretKey, sessionToken, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", amzDate)
+	if sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	// Every header set above and by the caller is signed
+	var names []string
+	for name := range request.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(request.Header.Get(name)))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// PrometheusScaler reads the backlog from a PromQL query, e.g. a queue depth
+// exported by a broker exporter
+type PrometheusScaler struct {
+	// URL of the Prometheus server, e.g. http://prometheus.monitoring:9090
+	URL    string
+	Client *http.Client
+}
+
+// Backlog implements QueueScaler, target is a PromQL query. The values of
+// all series the query returns are summed up.
+func (s *PrometheusScaler) Backlog(ctx context.Context, target string) (float64, error) {
+	if s.URL == "" {
+		return 0, fmt.Errorf("no Prometheus URL configured")
+	}
+	query := strings.TrimSuffix(s.URL, "/") + "/api/v1/query?" + url.Values{"query": {target}}.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, query, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := doJSON(s.Client, request, &result); err != nil {
+		return 0, fmt.Errorf("failed to query Prometheus: %w", err)
+	}
+	if result.Status != "success" {
+		return 0, fmt.Errorf("Prometheus query %q failed: %s", target, result.Error)
+	}
+
+	// Samples are [<time>, "<value>"]
+	var samples [][2]any
+	switch result.Data.ResultType {
+	case "vector":
+		var series []struct {
+			Value [2]any `json:"value"`
+		}
+		if err := json.Unmarshal(result.Data.Result, &series); err != nil {
+			return 0, err
+		}
+		for _, s := range series {
+			samples = append(samples, s.Value)
+		}
+	case "scalar":
+		var sample [2]any
+		if err := json.Unmarshal(result.Data.Result, &sample); err != nil {
+			return 0, err
+		}
+		samples = append(samples, sample)
+	default:
+		return 0, fmt.Errorf("Prometheus query %q returned a %s, not a vector or scalar", target, result.Data.ResultType)
+	}
+
+	backlog := 0.0
+	for _, sample := range samples {
+		text, _ := sample[1].(string)
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Prometheus query %q returned invalid value %q", target, text)
+		}
+		if !math.IsNaN(value) {
+			backlog += value
+		}
+	}
+	return backlog, nil
+}
+
+// KafkaLagScaler reads the lag of a consumer group from the
+// kafka_consumergroup_lag metric of kafka_exporter in Prometheus
+type KafkaLagScaler struct {
+	Prometheus *PrometheusScaler
+}
+
+// Backlog implements QueueScaler, target is "topic/consumer-group"
+func (s *KafkaLagScaler) Backlog(ctx context.Context, target string) (float64, error) {
+	topic, group, found := strings.Cut(target, "/")
+	if !found || topic == "" || group == "" {
+		return 0, fmt.Errorf("invalid Kafka target %q, must be topic/consumer-group", target)
+	}
+	query := fmt.Sprintf("sum(kafka_consumergroup_lag{topic=%q,consumergroup=%q})", topic, group)
+	return s.Prometheus.Backlog(ctx, query)
+}
+
+func doJSON(client *http.Client, request *http.Request, result any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, result)
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Reason codes of scale actions, recorded as the reason of their events next
+// to BurstScaleUpReason and ScaledBackUnschedulableReason
+const (
+	CPUAboveThresholdReason = "CPUAboveThreshold"
+	CPUBelowThresholdReason = "CPUBelowThreshold"
+	ReplicaBoundsReason     = "ReplicaBounds"
+	ScaleHintReason         = "ScaleHint"
+
+	// Event reason for scale actions that failed to update the deployment
+	FailedScaleReason = "FailedScale"
+)
+
+// ScaleAction describes one scale operation for its event
+type ScaleAction struct {
+	// Reason is the reason code of the action
+	Reason string
+	From   int32
+	To     int32
+	Bounds ReplicaBounds
+	// CPUUsage and the thresholds the decision was based on, unset for scale hints
+	CPUUsage         float64
+	CPUThresholdLow  float64
+	CPUThresholdHigh float64
+	// Detail explains actions that aren't decided by the CPU thresholds alone
+	Detail string
+	// Limited explains why a scale-up stopped short of the recommendation
+	Limited string
+}
+
+// message renders the action for kubectl describe, e.g. "Scaled from 2 to 3
+// replicas: CPU usage 72.4% above the scale-up threshold 60.0% (bounds 1-10)"
+func (a ScaleAction) message() string {
+	var why string
+	switch a.Reason {
+	case CPUAboveThresholdReason:
+		why = fmt.Sprintf("CPU usage %.1f%% above the scale-up threshold %.1f%%", a.CPUUsage, a.CPUThresholdHigh)
+	case CPUBelowThresholdReason:
+		why = fmt.Sprintf("CPU usage %.1f%% below the scale-down threshold %.1f%%", a.CPUUsage, a.CPUThresholdLow)
+	case ReplicaBoundsReason:
+		why = fmt.Sprintf("replicas outside the bounds %d-%d", a.Bounds.Min, a.Bounds.Max)
+		if a.Bounds.Profile != "" {
+			why += fmt.Sprintf(" of scaling profile %s", a.Bounds.Profile)
+		}
+	default:
+		why = a.Detail
+	}
+
+	message := fmt.Sprintf("Scaled from %d to %d replicas: %s (bounds %d-%d)", a.From, a.To, why, a.Bounds.Min, a.Bounds.Max)
+	if a.Limited != "" {
+		message += "; limited because " + a.Limited
+	}
+	return message
+}
+
+// createScaleEvent records a scale action on the deployment, as a Warning
+// FailedScale event when the update failed. Replicas removed because they
+// couldn't be scheduled are a Warning too.
+func (r *DeploymentReconciler) createScaleEvent(ctx context.Context, deployment *appsv1.Deployment, action ScaleAction, scaleErr error) error {
+	reason, eventType, message := action.Reason, corev1.EventTypeNormal, action.message()
+	if action.Reason == ScaledBackUnschedulableReason {
+		eventType = corev1.EventTypeWarning
+	}
+	if scaleErr != nil {
+		reason, eventType = FailedScaleReason, corev1.EventTypeWarning
+		message = fmt.Sprintf("Failed to scale from %d to %d replicas (%s): %v", action.From, action.To, action.Reason, scaleErr)
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", deployment.Name, now.UnixNano()),
+			Namespace: deployment.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Deployment",
+			Name:            deployment.Name,
+			Namespace:       deployment.Namespace,
+			UID:             deployment.UID,
+			APIVersion:      "apps/v1",
+			ResourceVersion: deployment.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: "auto-scaler",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
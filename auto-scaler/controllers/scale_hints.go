@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/psrvere/k8s-controllers/common/httpauth"
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ScaleHintPath is the HTTP path external systems POST scale hints to
+const ScaleHintPath = "/scale-hints"
+
+// ScaleHint is a replica recommendation sent by an external system (CI, queue monitor, ...)
+type ScaleHint struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Replicas  int32  `json:"replicas"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ScaleHintResponse is returned for every scale hint request
+type ScaleHintResponse struct {
+	Applied  bool   `json:"applied"`
+	Replicas int32  `json:"replicas,omitempty"`
+	Message  string `json:"message"`
+	// RetryAfterSeconds is set when the hint was rejected because of a cooldown
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
+}
+
+// ScaleHintServer accepts scale hints over HTTP and applies them through the
+// DeploymentReconciler, sharing its policy bounds and cooldown accounting.
+// Callers authenticate with a bearer token and need update on the
+// deployments/scale subresource of the hinted deployment.
+type ScaleHintServer struct {
+	Reconciler  *DeploymentReconciler
+	BindAddress string
+	// CertFile and KeyFile serve the endpoint over TLS
+	CertFile string
+	KeyFile  string
+	// Insecure allows serving over plain HTTP, so bearer tokens travel unencrypted
+	Insecure bool
+	// Auth reviews the caller of each hint
+	Auth *httpauth.Reviewer
+
+	// hints serialises hints, so the cooldown a hint starts is seen by the next one
+	hints sync.Mutex
+}
+
+// Start implements manager.Runnable
+func (s *ScaleHintServer) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("scale-hints")
+
+	tls := s.CertFile != "" || s.KeyFile != ""
+	if tls && (s.CertFile == "" || s.KeyFile == "") {
+		return fmt.Errorf("scale hint server needs both a TLS certificate and key")
+	}
+	// Callers authenticate with bearer tokens, which must not be sent in clear text
+	if !tls && !s.Insecure {
+		return fmt.Errorf("refusing to accept bearer tokens over plain HTTP on %s, configure a TLS certificate or allow insecure serving explicitly", s.BindAddress)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ScaleHintPath, s.handleScaleHint)
+
+	server := &http.Server{
+		Addr:              s.BindAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	var err error
+	if tls {
+		log.Info("Starting scale hint server", "address", s.BindAddress)
+		err = server.ListenAndServeTLS(s.CertFile, s.KeyFile)
+	} else {
+		log.Info("Starting scale hint server without TLS, bearer tokens are sent unencrypted", "address", s.BindAddress)
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *ScaleHintServer) handleScaleHint(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeScaleHintResponse(w, http.StatusMethodNotAllowed, ScaleHintResponse{Message: "only POST is supported"})
+		return
+	}
+
+	hint := ScaleHint{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<16)).Decode(&hint); err != nil {
+		writeScaleHintResponse(w, http.StatusBadRequest, ScaleHintResponse{Message: fmt.Sprintf("invalid scale hint: %v", err)})
+		return
+	}
+
+	status, err := s.Auth.Authorize(req.Context(), req, authorizationv1.ResourceAttributes{
+		Namespace:   hint.Namespace,
+		Verb:        "update",
+		Group:       "apps",
+		Resource:    "deployments",
+		Subresource: "scale",
+		Name:        hint.Name,
+	})
+	if err != nil {
+		log.FromContext(req.Context()).Info("Rejected scale hint", "namespace", hint.Namespace, "name", hint.Name, "reason", err.Error())
+		writeScaleHintResponse(w, status, ScaleHintResponse{Message: err.Error()})
+		return
+	}
+
+	// The cooldown is read before and started after the scale, concurrent
+	// hints for a deployment would all pass it
+	s.hints.Lock()
+	defer s.hints.Unlock()
+
+	status, response := s.Reconciler.applyScaleHint(req.Context(), hint)
+	writeScaleHintResponse(w, status, response)
+}
+
+func writeScaleHintResponse(w http.ResponseWriter, status int, response ScaleHintResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusTooManyRequests && response.RetryAfterSeconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfterSeconds))
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// applyScaleHint validates a scale hint against the scaling policy and applies it.
+// It returns the HTTP status code and response body for the caller.
+func (r *DeploymentReconciler) applyScaleHint(ctx context.Context, hint ScaleHint) (int, ScaleHintResponse) {
+	log := log.FromContext(ctx)
+
+	if hint.Namespace == "" || hint.Name == "" {
+		return http.StatusBadRequest, ScaleHintResponse{Message: "namespace and name are required"}
+	}
+
+	// Ignored namespaces are left alone, like in Reconcile
+	if r.Namespaces.Ignored(ctx, hint.Namespace) {
+		return http.StatusUnprocessableEntity, ScaleHintResponse{Message: "namespace is ignored by the auto-scaler"}
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: hint.Namespace, Name: hint.Name}, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return http.StatusNotFound, ScaleHintResponse{Message: "deployment not found"}
+		}
+		return http.StatusInternalServerError, ScaleHintResponse{Message: fmt.Sprintf("failed to get deployment: %v", err)}
+	}
+
+	if !hasAutoScaleLabel(deployment) {
+		return http.StatusUnprocessableEntity, ScaleHintResponse{Message: "deployment doesn't have auto-scaler label"}
+	}
+
+	bounds, err := replicaBounds(deployment, time.Now())
+	if err != nil {
+		log.Error(err, "Ignoring scaling profiles", "deployment", deployment.Name)
+	}
+	if hint.Replicas < bounds.Min || hint.Replicas > bounds.Max {
+		return http.StatusUnprocessableEntity, ScaleHintResponse{
+			Message: fmt.Sprintf("replicas %d outside policy bounds [%d, %d]", hint.Replicas, bounds.Min, bounds.Max),
+		}
+	}
+
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == hint.Replicas {
+		return http.StatusOK, ScaleHintResponse{Replicas: hint.Replicas, Message: "deployment already at hinted replicas"}
+	}
+
+	scaleUp := deployment.Spec.Replicas == nil || hint.Replicas > *deployment.Spec.Replicas
+	if remaining := r.cooldownRemaining(deployment, scaleUp); remaining > 0 {
+		return http.StatusTooManyRequests, ScaleHintResponse{
+			Message:           "deployment is in scaling cooldown",
+			RetryAfterSeconds: int(math.Ceil(remaining.Seconds())),
+		}
+	}
+
+	if scaleUp {
+		unschedulable, err := r.countUnschedulablePods(ctx, deployment)
+		if err != nil {
+			return http.StatusInternalServerError, ScaleHintResponse{Message: err.Error()}
+		}
+		if unschedulable.Count > 0 {
+			return http.StatusConflict, ScaleHintResponse{
+				Message: fmt.Sprintf("%d replica(s) can't be scheduled, scale-ups are blocked", unschedulable.Count),
+			}
+		}
+
+		if r.limitSurge() {
+			limit, err := r.limitScaleUp(ctx, deployment, hint.Replicas)
+			if err != nil {
+				return http.StatusInternalServerError, ScaleHintResponse{Message: err.Error()}
+			}
+			if limit.Limit != "" {
+				return http.StatusConflict, ScaleHintResponse{
+					Message: fmt.Sprintf("at most %d replicas possible: %s", limit.Replicas, limit.Message),
+				}
+			}
+		}
+	}
+
+	if r.respectPDBs() && deployment.Spec.Replicas != nil && hint.Replicas < *deployment.Spec.Replicas {
+		message, err := r.checkPDBScaleDown(ctx, deployment, hint.Replicas)
+		if err != nil {
+			return http.StatusInternalServerError, ScaleHintResponse{Message: err.Error()}
+		}
+		if message != "" {
+			if err := r.createScaleDownDeferredEvent(ctx, deployment, message); err != nil {
+				log.Error(err, "Failed to create scale-down deferred event", "deployment", deployment.Name)
+			}
+			return http.StatusConflict, ScaleHintResponse{Message: message}
+		}
+	}
+
+	action := ScaleAction{
+		Reason: ScaleHintReason,
+		From:   ptr.Deref(deployment.Spec.Replicas, 1),
+		To:     hint.Replicas,
+		Bounds: bounds,
+		Detail: "external scale hint",
+	}
+	if hint.Reason != "" {
+		action.Detail = fmt.Sprintf("external scale hint (%s)", hint.Reason)
+	}
+	if err := r.scaleDeployment(ctx, deployment, hint.Replicas); err != nil {
+		log.Error(err, "Failed to apply scale hint", "deployment", deployment.Name, "replicas", hint.Replicas)
+		if eventErr := r.createScaleEvent(ctx, deployment, action, err); eventErr != nil {
+			log.Error(eventErr, "Failed to create failed scale event", "deployment", deployment.Name)
+		}
+		return http.StatusInternalServerError, ScaleHintResponse{Message: fmt.Sprintf("failed to scale deployment: %v", err)}
+	}
+	r.setCoolDown(deployment)
+
+	if err := r.createScaleEvent(ctx, deployment, action, nil); err != nil {
+		log.Error(err, "Failed to create scale event", "deployment", deployment.Name)
+	}
+
+	log.Info("Applied scale hint",
+		"deployment", deployment.Name,
+		"namespace", deployment.Namespace,
+		"replicas", hint.Replicas,
+		"reason", hint.Reason)
+	return http.StatusOK, ScaleHintResponse{Applied: true, Replicas: hint.Replicas, Message: "scale hint applied"}
+}
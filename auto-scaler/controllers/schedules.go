@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// Annotation with the scheduled scaling profiles of a deployment as a JSON list, e.g.
+//
+//	[{"name": "business-hours", "schedule": "* 8-19 * * 1-5", "minReplicas": 5, "maxReplicas": 20},
+//	 {"name": "nights", "schedule": "* 0-5 * * *", "minReplicas": 1, "maxReplicas": 3}]
+const SchedulesAnnotation = "auto-scaler/schedules"
+
+// ScalingProfile overrides the replica bounds while its schedule is active. The
+// schedule is a standard 5 field cron expression (minute hour day-of-month
+// month day-of-week) and the profile is active during every minute it matches,
+// so "* 8-19 * * 1-5" covers weekdays from 08:00 to 19:59.
+type ScalingProfile struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// TimeZone is an IANA time zone name, defaults to UTC
+	TimeZone    string `json:"timeZone,omitempty"`
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+}
+
+// ReplicaBounds are the replica limits CPU scaling and scale hints stay within
+type ReplicaBounds struct {
+	Min int32
+	Max int32
+	// Profile is the name of the active scaling profile, empty for the defaults
+	Profile string
+}
+
+// replicaBounds returns the bounds of the first scaling profile of a deployment
+// active at now, or the controller's MinReplicas and MaxReplicas when none is.
+// Invalid profiles return the defaults and an error.
+func replicaBounds(deployment *appsv1.Deployment, now time.Time) (ReplicaBounds, error) {
+	bounds := ReplicaBounds{Min: MinReplicas, Max: MaxReplicas}
+
+	value, exists := deployment.Annotations[SchedulesAnnotation]
+	if !exists {
+		return bounds, nil
+	}
+
+	var profiles []ScalingProfile
+	if err := json.Unmarshal([]byte(value), &profiles); err != nil {
+		return bounds, fmt.Errorf("invalid %s annotation: %w", SchedulesAnnotation, err)
+	}
+
+	for _, profile := range profiles {
+		active, err := profile.activeAt(now)
+		if err != nil {
+			return bounds, fmt.Errorf("invalid scaling profile %q: %w", profile.Name, err)
+		}
+		if !active {
+			continue
+		}
+
+		if profile.MinReplicas != nil {
+			bounds.Min = *profile.MinReplicas
+		}
+		if profile.MaxReplicas != nil {
+			bounds.Max = *profile.MaxReplicas
+		}
+		if bounds.Min < 1 || bounds.Max < bounds.Min {
+			return ReplicaBounds{Min: MinReplicas, Max: MaxReplicas},
+				fmt.Errorf("invalid scaling profile %q: replicas [%d, %d]", profile.Name, bounds.Min, bounds.Max)
+		}
+		bounds.Profile = profile.Name
+		return bounds, nil
+	}
+	return bounds, nil
+}
+
+func (p ScalingProfile) activeAt(now time.Time) (bool, error) {
+	location := time.UTC
+	if p.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(p.TimeZone); err != nil {
+			return false, err
+		}
+	}
+	return cronMatches(p.Schedule, now.In(location))
+}
+
+// cronMatches reports whether t falls into a minute matched by a 5 field cron
+// expression. Fields support *, numbers, ranges (a-b), lists (a,b) and steps
+// (*/n, a-b/n). Like cron, when both day-of-month and day-of-week are
+// restricted a day matching either of them matches.
+func cronMatches(expression string, t time.Time) (bool, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return false, fmt.Errorf("schedule %q must have 5 fields", expression)
+	}
+
+	minute, err := cronFieldMatches(fields[0], t.Minute(), 0, 59)
+	if err != nil {
+		return false, err
+	}
+	hour, err := cronFieldMatches(fields[1], t.Hour(), 0, 23)
+	if err != nil {
+		return false, err
+	}
+	dayOfMonth, err := cronFieldMatches(fields[2], t.Day(), 1, 31)
+	if err != nil {
+		return false, err
+	}
+	month, err := cronFieldMatches(fields[3], int(t.Month()), 1, 12)
+	if err != nil {
+		return false, err
+	}
+	// Sunday is both 0 and 7
+	weekday := int(t.Weekday())
+	dayOfWeek, err := cronFieldMatches(fields[4], weekday, 0, 7)
+	if err != nil {
+		return false, err
+	}
+	if weekday == 0 && !dayOfWeek {
+		if dayOfWeek, err = cronFieldMatches(fields[4], 7, 0, 7); err != nil {
+			return false, err
+		}
+	}
+
+	day := dayOfMonth && dayOfWeek
+	if fields[2] != "*" && fields[4] != "*" {
+		day = dayOfMonth || dayOfWeek
+	}
+	return minute && hour && month && day, nil
+}
+
+func cronFieldMatches(field string, value, lowest, highest int) (bool, error) {
+	matches := false
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if before, after, found := strings.Cut(part, "/"); found {
+			var err error
+			if step, err = strconv.Atoi(after); err != nil || step < 1 {
+				return false, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = before
+		}
+
+		start, end := lowest, highest
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return false, fmt.Errorf("invalid value in %q", part)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return false, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if step > 1 {
+				// "a/n" runs from a to the end of the range
+				end = highest
+			}
+		}
+		if start < lowest || end > highest || start > end {
+			return false, fmt.Errorf("%q is outside [%d, %d]", part, lowest, highest)
+		}
+
+		if value >= start && value <= end && (value-start)%step == 0 {
+			matches = true
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SelfTestImage is a tiny image that starts fast and stays running
+const SelfTestImage = "registry.k8s.io/pause:3.10"
+
+// SelfTest creates a deployment at MinReplicas and waits until it is scaled
+// up. With fake CPU metrics this can take a few cooldown periods.
+func SelfTest() selftest.Test {
+	return selftest.Test{
+		Controller: "auto-scaler",
+		Reconciler: "deployment",
+		Setup: func(ctx context.Context, env *selftest.Env) error {
+			labels := map[string]string{"app": env.Name}
+			return env.Create(ctx, &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      env.Name,
+					Namespace: env.Namespace,
+					Labels:    map[string]string{AutoScaleLabel: "true"},
+				},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: ptr.To[int32](MinReplicas),
+					Selector: &metav1.LabelSelector{MatchLabels: labels},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "pause", Image: SelfTestImage}},
+						},
+					},
+				},
+			})
+		},
+		Verify: func(ctx context.Context, env *selftest.Env) error {
+			deployment := &appsv1.Deployment{}
+			if err := env.Client.Get(ctx, client.ObjectKey{Name: env.Name, Namespace: env.Namespace}, deployment); err != nil {
+				return err
+			}
+			if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas <= MinReplicas {
+				return fmt.Errorf("deployment %s has not been scaled up yet", deployment.Name)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/controllerconfig"
+
+// Settings that can be changed at runtime through the auto-scaler ControllerConfig
+const (
+	SettingCPUThresholdHigh = "cpuThresholdHigh"
+	SettingCPUThresholdLow  = "cpuThresholdLow"
+	SettingScalingCooldown  = "scalingCooldown"
+)
+
+// Settings lists the runtime settings of this controller
+var Settings = map[string]controllerconfig.Setting{
+	SettingCPUThresholdHigh: {
+		Type:        controllerconfig.Float,
+		Description: "CPU usage percentage above which deployments scale up",
+		Min:         controllerconfig.Bound(0),
+		Max:         controllerconfig.Bound(100),
+	},
+	SettingCPUThresholdLow: {
+		Type:        controllerconfig.Float,
+		Description: "CPU usage percentage below which deployments scale down",
+		Min:         controllerconfig.Bound(0),
+		Max:         controllerconfig.Bound(100),
+	},
+	SettingScalingCooldown: {
+		Type:        controllerconfig.Duration,
+		Description: "Default cooldown between scale operations, annotations still override it",
+		Min:         controllerconfig.Bound(0),
+	},
+}
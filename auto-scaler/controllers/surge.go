@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Event reason for scale-ups deferred because neither the surge budget nor
+	// the node headroom has room for another replica
+	ScaleUpDeferredReason = "ScaleUpDeferred"
+
+	// Limits a scale-up can be capped by
+	SurgeLimitMaxSurge     = "max-surge"
+	SurgeLimitNodeHeadroom = "node-headroom"
+)
+
+// Defaults of the Deployment controller for rolling updates, also used for
+// Recreate deployments, which have no surge settings
+var (
+	defaultMaxSurge       = intstr.FromString("25%")
+	defaultMaxUnavailable = intstr.FromString("25%")
+)
+
+var limitedScaleUps = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "auto_scaler_limited_scale_ups_total",
+	Help: "Scale-ups capped below the recommendation by limit: max-surge or node-headroom",
+}, []string{"limit"})
+
+func init() {
+	metrics.Registry.MustRegister(limitedScaleUps)
+}
+
+// SurgeLimit is the outcome of capping a scale-up
+type SurgeLimit struct {
+	// Replicas is the largest replica count the deployment can scale up to,
+	// the current replicas when the scale-up has to wait
+	Replicas int32
+	// Limit is the limit that capped the scale-up, empty when it wasn't capped
+	Limit string
+	// Message explains the cap for events and scale hint responses
+	Message string
+}
+
+// limitSurge reports whether the SurgeLimitedScaleUp feature is enabled
+func (r *DeploymentReconciler) limitSurge() bool {
+	return r.Config.FeatureEnabled(SurgeLimitedScaleUp, r.LimitSurge)
+}
+
+// limitScaleUp caps a scale-up of a deployment to newReplicas so it doesn't
+// start more pods at once than the deployment's rolling update allows or the
+// nodes have room for.
+//
+// The surge budget is maxSurge of the current replicas, rounded up and at
+// least one. Replicas that aren't available yet, e.g. from a previous
+// scale-up or a rollout, use up the budget as far as they exceed the
+// deployment's maxUnavailable, like they hold back a rollout. The node
+// headroom is the number of pods of the deployment's template that fit into
+// the allocatable resources the pods on schedulable nodes don't request yet.
+func (r *DeploymentReconciler) limitScaleUp(ctx context.Context, deployment *appsv1.Deployment, newReplicas int32) (SurgeLimit, error) {
+	currentReplicas := *deployment.Spec.Replicas
+	result := SurgeLimit{Replicas: newReplicas}
+	if newReplicas <= currentReplicas {
+		return result, nil
+	}
+
+	maxSurge, maxUnavailable := rollingUpdateLimits(deployment)
+	surge, err := intstr.GetScaledValueFromIntOrPercent(&maxSurge, int(currentReplicas), true)
+	if err != nil {
+		return result, fmt.Errorf("invalid maxSurge: %w", err)
+	}
+	unavailable, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, int(currentReplicas), false)
+	if err != nil {
+		return result, fmt.Errorf("invalid maxUnavailable: %w", err)
+	}
+	inFlight := max(int(deployment.Status.UnavailableReplicas)-unavailable, 0)
+	if allowed := currentReplicas + int32(max(max(surge, 1)-inFlight, 0)); allowed < result.Replicas {
+		result.Replicas, result.Limit = allowed, SurgeLimitMaxSurge
+		result.Message = fmt.Sprintf("maxSurge %s allows %d new replica(s) of %s, %d unavailable replica(s) are still starting",
+			maxSurge.String(), max(surge, 1), deployment.Name, inFlight)
+	}
+
+	headroom, err := r.nodeHeadroom(ctx, &deployment.Spec.Template)
+	if err != nil {
+		return result, err
+	}
+	if allowed := currentReplicas + headroom; allowed < result.Replicas {
+		result.Replicas, result.Limit = allowed, SurgeLimitNodeHeadroom
+		result.Message = fmt.Sprintf("the schedulable nodes have room for %d more pod(s) of %s", headroom, deployment.Name)
+	}
+
+	if result.Limit != "" {
+		limitedScaleUps.WithLabelValues(result.Limit).Inc()
+	}
+	return result, nil
+}
+
+// rollingUpdateLimits returns the maxSurge and maxUnavailable of a
+// deployment, with the Deployment controller's defaults for unset fields
+func rollingUpdateLimits(deployment *appsv1.Deployment) (intstr.IntOrString, intstr.IntOrString) {
+	maxSurge, maxUnavailable := defaultMaxSurge, defaultMaxUnavailable
+	if rollingUpdate := deployment.Spec.Strategy.RollingUpdate; rollingUpdate != nil {
+		if rollingUpdate.MaxSurge != nil {
+			maxSurge = *rollingUpdate.MaxSurge
+		}
+		if rollingUpdate.MaxUnavailable != nil {
+			maxUnavailable = *rollingUpdate.MaxUnavailable
+		}
+	}
+	return maxSurge, maxUnavailable
+}
+
+// nodeHeadroom returns how many pods of a template fit on the nodes the
+// scheduler could place them on: ready, not cordoned, matching the node
+// selector and without taints the template doesn't tolerate. Node affinity
+// and topology spread constraints aren't considered.
+func (r *DeploymentReconciler) nodeHeadroom(ctx context.Context, template *corev1.PodTemplateSpec) (int32, error) {
+	nodeList := &corev1.NodeList{}
+	if err := r.List(ctx, nodeList); err != nil {
+		return 0, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList); err != nil {
+		return 0, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	requested := make(map[string]corev1.ResourceList)
+	podsOnNode := make(map[string]int64)
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		podsOnNode[pod.Spec.NodeName]++
+		if requested[pod.Spec.NodeName] == nil {
+			requested[pod.Spec.NodeName] = corev1.ResourceList{}
+		}
+		addResources(requested[pod.Spec.NodeName], podRequests(&pod.Spec))
+	}
+
+	request := podRequests(&template.Spec)
+	nodeSelector := labels.SelectorFromSet(template.Spec.NodeSelector)
+	var headroom int64
+	for _, node := range nodeList.Items {
+		if !schedulableFor(&node, &template.Spec, nodeSelector) {
+			continue
+		}
+
+		fits := node.Status.Allocatable.Pods().Value() - podsOnNode[node.Name]
+		for name, quantity := range request {
+			if quantity.IsZero() {
+				continue
+			}
+			free := node.Status.Allocatable[name].DeepCopy()
+			free.Sub(requested[node.Name][name])
+			fits = min(fits, free.MilliValue()/quantity.MilliValue())
+		}
+		headroom += max(fits, 0)
+	}
+	return int32(min(headroom, math.MaxInt32)), nil
+}
+
+// schedulableFor reports whether the scheduler could place pods of a spec on a node
+func schedulableFor(node *corev1.Node, spec *corev1.PodSpec, nodeSelector labels.Selector) bool {
+	if node.Spec.Unschedulable || !isNodeReady(node) || !nodeSelector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for _, toleration := range spec.Tolerations {
+			if toleration.ToleratesTaint(&taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podRequests returns the resources the scheduler reserves for a pod: the
+// requests of its containers, at least those of its largest init container,
+// plus the pod overhead
+func podRequests(spec *corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		addResources(requests, container.Resources.Requests)
+	}
+	for _, container := range spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if current, exists := requests[name]; !exists || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	addResources(requests, spec.Overhead)
+	return requests
+}
+
+// addResources adds the quantities of add to list
+func addResources(list, add corev1.ResourceList) {
+	for name, quantity := range add {
+		current := list[name]
+		current.Add(quantity)
+		list[name] = current
+	}
+}
+
+// createScaleUpDeferredEvent records a scale-up that has to wait for the
+// surge budget or node headroom
+func (r *DeploymentReconciler) createScaleUpDeferredEvent(ctx context.Context, deployment *appsv1.Deployment, message string) error {
+	log := log.FromContext(ctx)
+
+	// Check if event already exists to prevent duplicates
+	eventName := fmt.Sprintf("%s-scale-up-deferred", deployment.Name)
+	existingEvent := &corev1.Event{}
+	if err := r.Get(ctx, client.ObjectKey{Name: eventName, Namespace: deployment.Namespace}, existingEvent); err == nil {
+		log.Info("Scale-up deferred event already exists, skipping creation", "deployment", deployment.Name, "eventName", eventName)
+		return nil
+	}
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventName,
+			Namespace: deployment.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Deployment",
+			Name:            deployment.Name,
+			Namespace:       deployment.Namespace,
+			UID:             deployment.UID,
+			APIVersion:      "apps/v1",
+			ResourceVersion: deployment.ResourceVersion,
+		},
+		Reason:         ScaleUpDeferredReason,
+		Message:        message,
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           corev1.EventTypeWarning,
+		Source: corev1.EventSource{
+			Component: "auto-scaler",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Pods must be unschedulable this long before replicas are scaled back
+	UnschedulableGracePeriod = 2 * time.Minute
+
+	// Event reasons for replicas the cluster can't place
+	UnschedulableReplicasReason   = "UnschedulableReplicas"
+	ScaledBackUnschedulableReason = "ScaledBackUnschedulable"
+)
+
+// UnschedulablePods counts the pods of a deployment the scheduler couldn't place
+type UnschedulablePods struct {
+	// Pending pods that failed scheduling
+	Count int32
+	// Stuck pods have been unschedulable for longer than UnschedulableGracePeriod
+	Stuck int32
+}
+
+// countUnschedulablePods returns the pending pods of a deployment whose
+// PodScheduled condition reports Unschedulable
+func (r *DeploymentReconciler) countUnschedulablePods(ctx context.Context, deployment *appsv1.Deployment) (UnschedulablePods, error) {
+	var result UnschedulablePods
+	if deployment.Spec.Selector == nil {
+		return result, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return result, fmt.Errorf("invalid deployment selector: %w", err)
+	}
+
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return result, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	for _, pod := range podList.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodPending {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type != corev1.PodScheduled || condition.Status != corev1.ConditionFalse ||
+				condition.Reason != corev1.PodReasonUnschedulable {
+				continue
+			}
+			result.Count++
+			if time.Since(condition.LastTransitionTime.Time) > UnschedulableGracePeriod {
+				result.Stuck++
+			}
+		}
+	}
+	return result, nil
+}
+
+// markUnschedulable remembers that a deployment has unschedulable replicas. It
+// returns true when the deployment wasn't marked yet, so each episode is reported once.
+func (r *DeploymentReconciler) markUnschedulable(deployment *appsv1.Deployment, unschedulable bool) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := cooldownKey(deployment)
+	if !unschedulable {
+		delete(r.unschedulableCache, key)
+		return false
+	}
+
+	if r.unschedulableCache == nil {
+		r.unschedulableCache = make(map[string]bool)
+	}
+	if r.unschedulableCache[key] {
+		return false
+	}
+	r.unschedulableCache[key] = true
+	return true
+}
+
+// createWarningEvent records a warning on a deployment, e.g. about replicas the
+// cluster can't place. Event names are unique, a deployment can run out of room many times.
+func (r *DeploymentReconciler) createWarningEvent(ctx context.Context, deployment *appsv1.Deployment, reason, message string) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", deployment.Name, now.UnixNano()),
+			Namespace: deployment.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Deployment",
+			Name:            deployment.Name,
+			Namespace:       deployment.Namespace,
+			UID:             deployment.UID,
+			APIVersion:      "apps/v1",
+			ResourceVersion: deployment.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           corev1.EventTypeWarning,
+		Source: corev1.EventSource{
+			Component: "auto-scaler",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
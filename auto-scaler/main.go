@@ -8,6 +8,16 @@ import (
 	"os"
 
 	"github.com/psrvere/k8s-controllers/auto-scaler/controllers"
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+	"github.com/psrvere/k8s-controllers/common/httpauth"
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	"github.com/psrvere/k8s-controllers/common/version"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -26,11 +36,46 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	// "<binary> selftest [flags]" verifies an installation end-to-end
+	if len(os.Args) > 1 && os.Args[1] == selftest.Command {
+		os.Exit(selftest.Main(os.Args[2:], scheme, controllers.SelfTest()))
+	}
+
+	// "<binary> manifests [flags] [-- controller flags]" prints the install manifests
+	if len(os.Args) > 1 && os.Args[1] == manifests.Command {
+		os.Exit(manifests.Main(os.Args[2:], controllers.Manifest()))
+	}
+
 	var probeAddr string
+	var scaleHintAddr string
+	var scaleHintCertFile, scaleHintKeyFile string
+	var scaleHintInsecure bool
+	var scaleDownUnschedulable bool
+	var prometheusURL string
 	flag.String("health-probe-bind-address", ":8081", "Probe endpoint binds to this address")
+	flag.StringVar(&scaleHintAddr, "scale-hint-bind-address", "",
+		"Address the scale hint endpoint binds to, e.g. :8090. Disabled when empty.")
+	flag.StringVar(&scaleHintCertFile, "scale-hint-tls-cert-file", "",
+		"TLS certificate the scale hint endpoint is served with.")
+	flag.StringVar(&scaleHintKeyFile, "scale-hint-tls-key-file", "",
+		"TLS private key the scale hint endpoint is served with.")
+	flag.BoolVar(&scaleHintInsecure, "scale-hint-insecure", false,
+		"Serve the scale hint endpoint over plain HTTP without TLS. Callers' bearer tokens are sent unencrypted.")
+	flag.BoolVar(&scaleDownUnschedulable, "scale-down-unschedulable", false,
+		"Scale deployments back down when replicas stay unschedulable for more than two minutes.")
+	flag.StringVar(&prometheusURL, "prometheus-url", "",
+		"URL of the Prometheus server the prometheus and kafka queue scalers query, e.g. http://prometheus.monitoring:9090")
+
+	// --kubeconfig, --context and impersonation for running out-of-cluster
+	var connection restconfig.Options
+	connection.AddFlags(flag.CommandLine)
+
+	features := featuregate.New("auto-scaler", controllers.FeatureGates)
+	features.AddFlag(flag.CommandLine)
 
 	opts := zap.Options{
 		Development: true,
@@ -39,8 +84,16 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	features.Report(setupLog)
+	version.Report(setupLog, features)
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig, err := connection.Load()
+	if err != nil {
+		setupLog.Error(err, "Unable to load kubeconfig")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		HealthProbeBindAddress: probeAddr,
 	})
@@ -49,14 +102,60 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.DeploymentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	// Thresholds and feature gates can be changed at runtime with a ControllerConfig
+	config := controllerconfig.New("auto-scaler", controllers.Settings, features)
+	if err := config.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ControllerConfig")
+		os.Exit(1)
+	}
+
+	// Build and effective feature gates on /version of the metrics server
+	if err := version.AddToManager(mgr, "auto-scaler", config.ActiveFeatureGates); err != nil {
+		setupLog.Error(err, "unable to serve version")
+		os.Exit(1)
+	}
+
+	// Queue scalers deployments can refer to with auto-scaler/queue-scaler.
+	// Register other event sources here.
+	prometheus := &controllers.PrometheusScaler{URL: prometheusURL}
+	queueScalers := map[string]controllers.QueueScaler{
+		"sqs":        &controllers.SQSScaler{},
+		"prometheus": prometheus,
+		"kafka":      &controllers.KafkaLagScaler{Prometheus: prometheus},
+	}
+
+	backoff := throttle.NewAdaptiveBackoff("auto-scaler")
+	reconciler := &controllers.DeploymentReconciler{
+		Client:                 throttle.WrapClient(mgr.GetClient(), backoff),
+		Scheme:                 mgr.GetScheme(),
+		Backoff:                backoff,
+		RespectPDBs:            features.Enabled(controllers.PDBAwareScaleDown),
+		ScaleDownUnschedulable: scaleDownUnschedulable,
+		SetDeletionCost:        features.Enabled(controllers.PodDeletionCost),
+		LimitSurge:             features.Enabled(controllers.SurgeLimitedScaleUp),
+		Namespaces:             predicates.NewNamespaceFilter(mgr.GetClient()),
+		Config:                 config,
+		QueueScalers:           queueScalers,
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Deployment")
 		os.Exit(1)
 	}
 
+	if scaleHintAddr != "" {
+		if err := mgr.Add(&controllers.ScaleHintServer{
+			Reconciler:  reconciler,
+			BindAddress: scaleHintAddr,
+			CertFile:    scaleHintCertFile,
+			KeyFile:     scaleHintKeyFile,
+			Insecure:    scaleHintInsecure,
+			Auth:        &httpauth.Reviewer{Client: mgr.GetClient()},
+		}); err != nil {
+			setupLog.Error(err, "unable to set up scale hint server")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to setup health check")
 		os.Exit(1)
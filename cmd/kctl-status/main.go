@@ -0,0 +1,145 @@
+// kctl-status prints what the controllers of this repository did to a
+// cluster: labelled pods, synced ConfigMaps, validated Services, scaled
+// Deployments, evicted pods, secrets due for rotation and handled Jobs. It
+// only reads the labels, annotations, events and custom resources the
+// controllers write, so it works without access to the controllers themselves.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	nbv1alpha1 "github.com/psrvere/k8s-controllers/node-balancer/api/v1alpha1"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(nbv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
+}
+
+// options are the flags shared by all status commands
+type options struct {
+	connection restconfig.Options
+	namespace  string
+	since      time.Duration
+	timeout    time.Duration
+}
+
+// statusFunc prints the status of one controller
+type statusFunc func(ctx context.Context, c client.Client, opts *options, out io.Writer) error
+
+// statusCommand is a subcommand printing the status of one controller
+type statusCommand struct {
+	name    string
+	aliases []string
+	short   string
+	run     statusFunc
+}
+
+var statusCommands = []statusCommand{
+	{name: "pod-labeller", aliases: []string{"pods"}, short: "Labelled and unlabelled pods per namespace", run: podLabellerStatus},
+	{name: "config-syncer", aliases: []string{"configmaps", "cm"}, short: "Synced source ConfigMaps and their copies", run: configSyncerStatus},
+	{name: "service-validator", aliases: []string{"services", "svc"}, short: "Validation and promotion state of Services", run: serviceValidatorStatus},
+	{name: "auto-scaler", aliases: []string{"deployments", "deploy"}, short: "Auto-scaled Deployments and their last scale action", run: autoScalerStatus},
+	{name: "node-balancer", aliases: []string{"nodes"}, short: "Balanced nodes, imbalance score and recent evictions", run: nodeBalancerStatus},
+	{name: "secret-rotator", aliases: []string{"secrets"}, short: "Secrets due for rotation", run: secretRotatorStatus},
+	{name: "job-handler", aliases: []string{"jobs"}, short: "Handled Jobs and their processing status", run: jobHandlerStatus},
+	{name: "controllerconfigs", aliases: []string{"cc"}, short: "Runtime settings and feature gates in effect", run: controllerConfigStatus},
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:          "kctl-status",
+		Short:        "Show what the controllers did to the cluster",
+		SilenceUsage: true,
+	}
+
+	// --kubeconfig, --context and impersonation, shared with the controllers
+	goFlags := flag.NewFlagSet("kctl-status", flag.ExitOnError)
+	opts.connection.AddFlags(goFlags)
+	root.PersistentFlags().AddGoFlagSet(goFlags)
+	root.PersistentFlags().StringVarP(&opts.namespace, "namespace", "n", "", "Only show objects in this namespace, all namespaces when empty")
+	root.PersistentFlags().DurationVar(&opts.since, "since", time.Hour, "How far back events, e.g. scale actions and evictions, are shown")
+	root.PersistentFlags().DurationVar(&opts.timeout, "timeout", 30*time.Second, "Timeout for all API requests of a command")
+
+	for _, command := range statusCommands {
+		run := command.run
+		root.AddCommand(&cobra.Command{
+			Use:     command.name,
+			Aliases: command.aliases,
+			Short:   command.short,
+			Args:    cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				return runStatus(cmd, opts, run)
+			},
+		})
+	}
+
+	root.AddCommand(&cobra.Command{
+		Use:   "all",
+		Short: "Status of every controller",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runStatus(cmd, opts, allStatus)
+		},
+	})
+	root.AddCommand(newMetricsCommand(opts))
+	return root
+}
+
+// runStatus connects to the cluster and runs a status function
+func runStatus(cmd *cobra.Command, opts *options, run statusFunc) error {
+	restConfig, err := opts.connection.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), opts.timeout)
+	defer cancel()
+	return run(ctx, c, opts, cmd.OutOrStdout())
+}
+
+// allStatus prints every controller's status. A controller that fails, e.g.
+// because its CRD isn't installed, doesn't hide the others.
+func allStatus(ctx context.Context, c client.Client, opts *options, out io.Writer) error {
+	var failed int
+	for i, command := range statusCommands {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "== %s ==\n", command.name)
+		if err := command.run(ctx, c, opts, out); err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d controllers failed", failed, len(statusCommands))
+	}
+	return nil
+}
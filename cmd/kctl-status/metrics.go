@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Prefixes of the metrics the controllers export. Other metrics of the
+// controller-runtime endpoint, e.g. workqueue and Go runtime metrics, are left out.
+var controllerMetricPrefixes = []string{
+	"pod_labeller_",
+	"config_syncer_",
+	"service_validator_",
+	"kube_horizontalpodautoscaler_",
+	"node_balancer_",
+	"secret_rotator_",
+	"job_handler_",
+	"controller_",
+}
+
+func newMetricsCommand(opts *options) *cobra.Command {
+	var match string
+	command := &cobra.Command{
+		Use:   "metrics URL...",
+		Short: "Controller metrics scraped from metrics endpoints",
+		Long: "Scrapes the Prometheus endpoints of controllers, e.g. http://localhost:8080/metrics " +
+			"after kubectl port-forward, and prints the metrics the controllers export.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, urls []string) error {
+			ctx, cancel := context.WithTimeout(cmd.Context(), opts.timeout)
+			defer cancel()
+
+			out := cmd.OutOrStdout()
+			t := newTable(out, "ENDPOINT", "METRIC", "VALUE")
+			for _, url := range urls {
+				samples, err := scrapeMetrics(ctx, url)
+				if err != nil {
+					return err
+				}
+				for _, sample := range samples {
+					if strings.Contains(sample.name, match) {
+						t.row(url, sample.name, sample.value)
+					}
+				}
+			}
+			return t.flush(out, "No controller metrics found")
+		},
+	}
+	command.Flags().StringVar(&match, "match", "", "Only show metrics whose name and labels contain this string")
+	return command
+}
+
+// metricSample is one line of the Prometheus text format
+type metricSample struct {
+	// name includes the labels, e.g. node_balancer_imbalance_score{pool="gpu"}
+	name  string
+	value string
+}
+
+// scrapeMetrics reads the controller metrics of a Prometheus text endpoint
+func scrapeMetrics(ctx context.Context, url string) ([]metricSample, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/plain")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape %s: %w", url, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to scrape %s: %s", url, response.Status)
+	}
+	return parseMetrics(response.Body)
+}
+
+func parseMetrics(body io.Reader) ([]metricSample, error) {
+	var samples []metricSample
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || !isControllerMetric(line) {
+			continue
+		}
+		// Label values may contain spaces, the value follows the labels and
+		// may itself be followed by a timestamp
+		nameEnd := strings.IndexByte(line, ' ')
+		if strings.Contains(line, "{") {
+			nameEnd = strings.LastIndexByte(line, '}') + 1
+		}
+		if nameEnd <= 0 {
+			continue
+		}
+		fields := strings.Fields(line[nameEnd:])
+		if len(fields) == 0 {
+			continue
+		}
+		samples = append(samples, metricSample{name: line[:nameEnd], value: fields[0]})
+	}
+	return samples, scanner.Err()
+}
+
+func isControllerMetric(line string) bool {
+	for _, prefix := range controllerMetricPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
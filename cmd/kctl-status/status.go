@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	csync "github.com/psrvere/k8s-controller/config-syncer/controllers"
+	autoscaler "github.com/psrvere/k8s-controllers/auto-scaler/controllers"
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	jobhandler "github.com/psrvere/k8s-controllers/job-handler/controllers"
+	nbv1alpha1 "github.com/psrvere/k8s-controllers/node-balancer/api/v1alpha1"
+	nodebalancer "github.com/psrvere/k8s-controllers/node-balancer/controllers"
+	podlabeller "github.com/psrvere/k8s-controllers/pod-labeller/controllers"
+	secretrotator "github.com/psrvere/k8s-controllers/secret-rotator/controllers"
+	servicevalidator "github.com/psrvere/k8s-controllers/service-validator/controllers"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podLabellerStatus counts the labelled pods per namespace
+func podLabellerStatus(ctx context.Context, c client.Client, opts *options, out io.Writer) error {
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, listOptions(opts)...); err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	type coverage struct{ total, labelled int }
+	namespaces := make(map[string]*coverage)
+	for _, pod := range pods.Items {
+		entry, exists := namespaces[pod.Namespace]
+		if !exists {
+			entry = &coverage{}
+			namespaces[pod.Namespace] = entry
+		}
+		entry.total++
+		if pod.Labels[podlabeller.ProcessedLabel] == "true" {
+			entry.labelled++
+		}
+	}
+
+	t := newTable(out, "NAMESPACE", "PODS", "LABELLED", "UNLABELLED", "COVERAGE")
+	for _, namespace := range sortedKeys(namespaces) {
+		entry := namespaces[namespace]
+		t.row(namespace, strconv.Itoa(entry.total), strconv.Itoa(entry.labelled), strconv.Itoa(entry.total-entry.labelled),
+			fmt.Sprintf("%.0f%%", float64(entry.labelled)/float64(entry.total)*100))
+	}
+	return t.flush(out, "No pods found")
+}
+
+// configSyncerStatus lists the source ConfigMaps and how many copies exist
+func configSyncerStatus(ctx context.Context, c client.Client, opts *options, out io.Writer) error {
+	sources := &corev1.ConfigMapList{}
+	if err := c.List(ctx, sources, listOptions(opts, client.HasLabels{csync.SyncLabel})...); err != nil {
+		return fmt.Errorf("failed to list source ConfigMaps: %w", err)
+	}
+	// Copies live in other namespaces than their source
+	copies := &corev1.ConfigMapList{}
+	if err := c.List(ctx, copies, client.HasLabels{csync.SyncedLabel}); err != nil {
+		return fmt.Errorf("failed to list synced ConfigMaps: %w", err)
+	}
+	synced := make(map[string]int)
+	for _, target := range copies.Items {
+		synced[target.Annotations[csync.SourceAnnotation]]++
+	}
+
+	t := newTable(out, "NAMESPACE", "NAME", "TARGETS", "STATE", "COPIES", "MISSING NAMESPACES")
+	for _, source := range sources.Items {
+		state := source.Annotations[csync.SyncStateAnnotation]
+		if state == "" {
+			state = "syncing"
+		}
+		t.row(source.Namespace, source.Name,
+			source.Annotations[csync.TargetNamespaceAnnotation],
+			state,
+			strconv.Itoa(synced[source.Namespace+"/"+source.Name]),
+			source.Annotations[csync.MissingNamespacesAnnotation])
+	}
+	return t.flush(out, "No ConfigMaps with the "+csync.SyncLabel+" label found")
+}
+
+// serviceValidatorStatus lists the validated Services
+func serviceValidatorStatus(ctx context.Context, c client.Client, opts *options, out io.Writer) error {
+	services := &corev1.ServiceList{}
+	if err := c.List(ctx, services, listOptions(opts, client.HasLabels{servicevalidator.ValidationLabel})...); err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+
+	t := newTable(out, "NAMESPACE", "NAME", "STATUS", "PROMOTED")
+	for _, service := range services.Items {
+		status := service.Annotations[servicevalidator.ValidationStatusAnnotation]
+		if status == "" {
+			status = "pending"
+		}
+		t.row(service.Namespace, service.Name, status, yesNo(service.Labels[servicevalidator.PromotedLabel] == "true"))
+	}
+	return t.flush(out, "No Services with the "+servicevalidator.ValidationLabel+" label found")
+}
+
+// autoScalerStatus lists the auto-scaled Deployments with their last scale action
+func autoScalerStatus(ctx context.Context, c client.Client, opts *options, out io.Writer) error {
+	deployments := &appsv1.DeploymentList{}
+	if err := c.List(ctx, deployments, listOptions(opts, client.HasLabels{autoscaler.AutoScaleLabel})...); err != nil {
+		return fmt.Errorf("failed to list deployments: %w", err)
+	}
+	events, err := recentEvents(ctx, c, opts, "auto-scaler", func(event *corev1.Event) bool {
+		return event.InvolvedObject.Kind == "Deployment"
+	})
+	if err != nil {
+		return err
+	}
+	// Events are sorted newest first, the first one per deployment is the last action
+	lastAction := make(map[string]corev1.Event)
+	for _, event := range events {
+		key := event.InvolvedObject.Namespace + "/" + event.InvolvedObject.Name
+		if _, exists := lastAction[key]; !exists {
+			lastAction[key] = event
+		}
+	}
+
+	t := newTable(out, "NAMESPACE", "NAME", "REPLICAS", "READY", "LAST ACTION", "AGE", "MESSAGE")
+	for _, deployment := range deployments.Items {
+		replicas := "-"
+		if deployment.Spec.Replicas != nil {
+			replicas = strconv.Itoa(int(*deployment.Spec.Replicas))
+		}
+		event, exists := lastAction[deployment.Namespace+"/"+deployment.Name]
+		if !exists {
+			t.row(deployment.Namespace, deployment.Name, replicas, strconv.Itoa(int(deployment.Status.ReadyReplicas)), "", "", "")
+			continue
+		}
+		t.row(deployment.Namespace, deployment.Name, replicas, strconv.Itoa(int(deployment.Status.ReadyReplicas)),
+			event.Reason, age(eventTime(&event)), event.Message)
+	}
+	return t.flush(out, "No Deployments with the "+autoscaler.AutoScaleLabel+" label found")
+}
+
+// nodeBalancerStatus lists the balanced nodes, the imbalance score and the
+// pods moved within the since flag
+func nodeBalancerStatus(ctx context.Context, c client.Client, opts *options, out io.Writer) error {
+	nodes := &corev1.NodeList{}
+	if err := c.List(ctx, nodes, client.HasLabels{nodebalancer.BalancerLabel}); err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	t := newTable(out, "NODE", "POOL", "CONSOLIDATING")
+	for _, node := range nodes.Items {
+		consolidating := false
+		for _, taint := range node.Spec.Taints {
+			consolidating = consolidating || taint.Key == nodebalancer.ConsolidationTaint
+		}
+		t.row(node.Name, node.Labels[nodebalancer.DefaultPoolLabel], yesNo(consolidating))
+	}
+	if err := t.flush(out, "No nodes with the "+nodebalancer.BalancerLabel+" label found"); err != nil {
+		return err
+	}
+
+	// The NodeBalancer only exists with the ImbalanceHistory gate
+	balancer := &nbv1alpha1.NodeBalancer{}
+	err := c.Get(ctx, client.ObjectKey{Name: nodebalancer.NodeBalancerName}, balancer)
+	switch {
+	case err == nil:
+		fmt.Fprintf(out, "\nImbalance score %.2f (trend %s, updated %s ago)\n",
+			balancer.Status.Score, orDash(balancer.Status.Trend), orDash(age(balancer.Status.LastUpdateTime.Time)))
+	case !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err):
+		return fmt.Errorf("failed to get NodeBalancer: %w", err)
+	}
+
+	events, err := recentEvents(ctx, c, opts, "node-balancer", func(event *corev1.Event) bool {
+		return event.Reason == nodebalancer.NodeRebalancingReason || event.Reason == nodebalancer.NodeConsolidationReason
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	evictions := newTable(out, "NAMESPACE", "OBJECT", "REASON", "AGE", "MESSAGE")
+	for _, event := range events {
+		evictions.row(event.InvolvedObject.Namespace, strings.ToLower(event.InvolvedObject.Kind)+"/"+event.InvolvedObject.Name,
+			event.Reason, age(eventTime(&event)), event.Message)
+	}
+	return evictions.flush(out, fmt.Sprintf("No evictions within %s", opts.since))
+}
+
+// secretRotatorStatus lists the secrets under rotation
+func secretRotatorStatus(ctx context.Context, c client.Client, opts *options, out io.Writer) error {
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, listOptions(opts, client.HasLabels{secretrotator.RotationLabel})...); err != nil {
+		return fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	t := newTable(out, "NAMESPACE", "NAME", "ROTATION", "ROTATED", "LAST CHECK", "UNUSED")
+	for _, secret := range secrets.Items {
+		rotation := "ok"
+		switch {
+		case secret.Annotations[secretrotator.NeedsRotationAnnotation] == "true":
+			rotation = "due"
+		case secret.Annotations[secretrotator.NeedsRotationSoonAnnotation] == "true":
+			rotation = "soon"
+		case secret.Annotations[secretrotator.ExemptUntilAnnotation] != "":
+			rotation = "exempt"
+		}
+		t.row(secret.Namespace, secret.Name, rotation,
+			ageOf(secret.Annotations[secretrotator.RotatedAtAnnotation]),
+			ageOf(secret.Annotations[secretrotator.LastRotationCheckAnnotation]),
+			yesNo(secret.Annotations[secretrotator.UnusedAnnotation] == "true"))
+	}
+	return t.flush(out, "No Secrets with the "+secretrotator.RotationLabel+" label found")
+}
+
+// jobHandlerStatus lists the handled Jobs
+func jobHandlerStatus(ctx context.Context, c client.Client, opts *options, out io.Writer) error {
+	jobs := &batchv1.JobList{}
+	if err := c.List(ctx, jobs, listOptions(opts, client.HasLabels{jobhandler.HandlerLabel})...); err != nil {
+		return fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	t := newTable(out, "NAMESPACE", "NAME", "STATUS", "PRIORITY", "AGE")
+	for _, job := range jobs.Items {
+		status := job.Annotations[jobhandler.ProcessingStatusAnnotation]
+		if status == "" {
+			status = jobhandler.StatusPending
+		}
+		t.row(job.Namespace, job.Name, status, job.Annotations[jobhandler.PriorityAnnotation], age(job.CreationTimestamp.Time))
+	}
+	return t.flush(out, "No Jobs with the "+jobhandler.HandlerLabel+" label found")
+}
+
+// controllerConfigStatus lists the ControllerConfigs and what they changed
+func controllerConfigStatus(ctx context.Context, c client.Client, _ *options, out io.Writer) error {
+	configs := &configv1alpha1.ControllerConfigList{}
+	if err := c.List(ctx, configs); err != nil {
+		if meta.IsNoMatchError(err) {
+			_, err := fmt.Fprintln(out, "The ControllerConfig CRD isn't installed")
+			return err
+		}
+		return fmt.Errorf("failed to list ControllerConfigs: %w", err)
+	}
+
+	t := newTable(out, "NAME", "SETTINGS", "ENABLED GATES", "APPLIED", "ERRORS")
+	for _, config := range configs.Items {
+		var settings, enabled []string
+		for _, name := range sortedKeys(config.Status.ActiveSettings) {
+			settings = append(settings, name+"="+config.Status.ActiveSettings[name])
+		}
+		for _, gate := range sortedKeys(config.Status.ActiveFeatureGates) {
+			if config.Status.ActiveFeatureGates[gate] {
+				enabled = append(enabled, gate)
+			}
+		}
+		applied := ""
+		if config.Status.LastAppliedTime != nil {
+			applied = age(config.Status.LastAppliedTime.Time)
+		}
+		t.row(config.Name, strings.Join(settings, ","), strings.Join(enabled, ","), applied, strings.Join(config.Status.Errors, "; "))
+	}
+	return t.flush(out, "No ControllerConfigs found")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// table prints aligned columns like kubectl get
+type table struct {
+	writer *tabwriter.Writer
+	rows   int
+}
+
+func newTable(out io.Writer, headers ...string) *table {
+	t := &table{writer: tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)}
+	fmt.Fprintln(t.writer, strings.Join(headers, "\t"))
+	return t
+}
+
+func (t *table) row(values ...string) {
+	for i, value := range values {
+		if value == "" {
+			values[i] = "-"
+		}
+	}
+	fmt.Fprintln(t.writer, strings.Join(values, "\t"))
+	t.rows++
+}
+
+// flush writes the table, or empty when it has no rows
+func (t *table) flush(out io.Writer, empty string) error {
+	if t.rows == 0 {
+		_, err := fmt.Fprintln(out, empty)
+		return err
+	}
+	return t.writer.Flush()
+}
+
+// age formats the time since t like kubectl, "" for unset times
+func age(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return duration.HumanDuration(time.Since(t))
+}
+
+// ageOf formats the time since an RFC 3339 annotation value, unparsable
+// values are shown as they are
+func ageOf(value string) string {
+	if value == "" {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return age(t)
+}
+
+// listOptions scopes a list to the namespace flag
+func listOptions(opts *options, extra ...client.ListOption) []client.ListOption {
+	if opts.namespace != "" {
+		extra = append(extra, client.InNamespace(opts.namespace))
+	}
+	return extra
+}
+
+// recentEvents returns the events a controller recorded within the since
+// flag, newest first
+func recentEvents(ctx context.Context, c client.Client, opts *options, component string, match func(*corev1.Event) bool) ([]corev1.Event, error) {
+	events := &corev1.EventList{}
+	if err := c.List(ctx, events, listOptions(opts)...); err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	cutoff := time.Now().Add(-opts.since)
+	var recent []corev1.Event
+	for _, event := range events.Items {
+		if event.Source.Component != component || eventTime(&event).Before(cutoff) {
+			continue
+		}
+		if match == nil || match(&event) {
+			recent = append(recent, event)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		return eventTime(&recent[i]).After(eventTime(&recent[j]))
+	})
+	return recent, nil
+}
+
+func eventTime(event *corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	return event.CreationTimestamp.Time
+}
@@ -0,0 +1,59 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ControllerConfigSpec overrides the settings and feature gates a controller
+// was started with
+type ControllerConfigSpec struct {
+	// Settings are controller specific values such as thresholds and
+	// intervals, e.g. {"cpuThresholdHigh": "75", "requeueInterval": "1m"}
+	Settings map[string]string `json:"settings,omitempty"`
+	// FeatureGates overrides the --feature-gates of the controller
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+}
+
+// ControllerConfigStatus reports the configuration the controller is running with
+type ControllerConfigStatus struct {
+	// ObservedGeneration is the generation of the spec the controller last processed
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ActiveSettings are the settings overrides in effect. Unset settings keep
+	// the values from the controller's flags.
+	ActiveSettings map[string]string `json:"activeSettings,omitempty"`
+	// ActiveFeatureGates are the states of all feature gates of the controller
+	ActiveFeatureGates map[string]bool `json:"activeFeatureGates,omitempty"`
+	// Errors lists why the last spec was rejected
+	Errors []string `json:"errors,omitempty"`
+	// LastAppliedTime is when a spec was last applied
+	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
+	// Conditions contains the Valid condition
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+
+// ControllerConfig reconfigures a controller at runtime. Each controller
+// watches the ControllerConfig named after it, e.g. "auto-scaler".
+type ControllerConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ControllerConfigSpec   `json:"spec,omitempty"`
+	Status ControllerConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ControllerConfigList contains a list of ControllerConfig
+type ControllerConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ControllerConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ControllerConfig{}, &ControllerConfigList{})
+}
@@ -0,0 +1,10 @@
+// Package config embeds the shared CustomResourceDefinitions, so the binaries
+// can print them with the manifests subcommand.
+package config
+
+import _ "embed"
+
+// ControllerConfigCRD is the CustomResourceDefinition of ControllerConfig
+//
+//go:embed crd/controllerconfigs.yaml
+var ControllerConfigCRD []byte
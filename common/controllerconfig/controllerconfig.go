@@ -0,0 +1,279 @@
+// Package controllerconfig reconfigures controllers at runtime from a
+// cluster-scoped ControllerConfig object named after the controller:
+//
+//	apiVersion: controller.example.com/v1alpha1
+//	kind: ControllerConfig
+//	metadata:
+//	  name: auto-scaler
+//	spec:
+//	  settings:
+//	    cpuThresholdHigh: "75"
+//	  featureGates:
+//	    PDBAwareScaleDown: false
+//
+// Every controller declares the settings it knows. Reconcilers read them
+// through Config with the value from their flags or defaults as fallback, so
+// a controller behaves as before while no ControllerConfig exists.
+package controllerconfig
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+)
+
+// Type is the type of a setting value
+type Type string
+
+const (
+	Int      Type = "int"
+	Float    Type = "float"
+	Duration Type = "duration"
+	Bool     Type = "bool"
+	String   Type = "string"
+)
+
+// Setting describes a setting a controller can be reconfigured with
+type Setting struct {
+	Type        Type
+	Description string
+	// Min and Max optionally bound Int, Float and Duration (in seconds) values
+	Min *float64
+	Max *float64
+	// Validate optionally checks String values, e.g. that they parse
+	Validate func(string) error
+}
+
+// Config holds the settings and feature gate overrides of the applied
+// ControllerConfig. A nil Config has no overrides.
+type Config struct {
+	// Controller is the name of the controller and its ControllerConfig
+	Controller string
+
+	settings map[string]Setting
+	features *featuregate.FeatureGate
+
+	mutex            sync.RWMutex
+	values           map[string]interface{}
+	rawValues        map[string]string
+	featureOverrides map[featuregate.Feature]bool
+}
+
+// New creates a Config for a controller with its known settings and feature gate
+func New(controller string, settings map[string]Setting, features *featuregate.FeatureGate) *Config {
+	return &Config{
+		Controller: controller,
+		settings:   settings,
+		features:   features,
+	}
+}
+
+// Int returns the override of an Int setting or fallback when it isn't set
+func (c *Config) Int(name string, fallback int) int {
+	if value, ok := c.value(name).(int); ok {
+		return value
+	}
+	return fallback
+}
+
+// Float returns the override of a Float setting or fallback when it isn't set
+func (c *Config) Float(name string, fallback float64) float64 {
+	if value, ok := c.value(name).(float64); ok {
+		return value
+	}
+	return fallback
+}
+
+// Duration returns the override of a Duration setting or fallback when it isn't set
+func (c *Config) Duration(name string, fallback time.Duration) time.Duration {
+	if value, ok := c.value(name).(time.Duration); ok {
+		return value
+	}
+	return fallback
+}
+
+// Bool returns the override of a Bool setting or fallback when it isn't set
+func (c *Config) Bool(name string, fallback bool) bool {
+	if value, ok := c.value(name).(bool); ok {
+		return value
+	}
+	return fallback
+}
+
+// String returns the override of a String setting or fallback when it isn't set
+func (c *Config) String(name string, fallback string) string {
+	if value, ok := c.value(name).(string); ok {
+		return value
+	}
+	return fallback
+}
+
+// FeatureEnabled returns the override of a feature gate or fallback, the
+// state the controller was started with, when it isn't overridden
+func (c *Config) FeatureEnabled(feature featuregate.Feature, fallback bool) bool {
+	if c == nil {
+		return fallback
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if enabled, exists := c.featureOverrides[feature]; exists {
+		return enabled
+	}
+	return fallback
+}
+
+func (c *Config) value(name string) interface{} {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.values[name]
+}
+
+// Apply validates a ControllerConfig spec and makes it the active
+// configuration. An invalid spec is rejected as a whole and the previous
+// configuration stays active. Returns every validation error.
+func (c *Config) Apply(spec configv1alpha1.ControllerConfigSpec) []string {
+	var errors []string
+
+	values := make(map[string]interface{}, len(spec.Settings))
+	for name, raw := range spec.Settings {
+		setting, known := c.settings[name]
+		if !known {
+			errors = append(errors, fmt.Sprintf("unknown setting %q", name))
+			continue
+		}
+		value, err := setting.parse(raw)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("setting %q: %v", name, err))
+			continue
+		}
+		values[name] = value
+	}
+
+	overrides := make(map[featuregate.Feature]bool, len(spec.FeatureGates))
+	for name, enabled := range spec.FeatureGates {
+		feature := featuregate.Feature(name)
+		var featureSpec featuregate.FeatureSpec
+		known := false
+		if c.features != nil {
+			featureSpec, known = c.features.Spec(feature)
+		}
+		switch {
+		case !known:
+			errors = append(errors, fmt.Sprintf("unknown feature gate %q", name))
+		case featureSpec.StartupOnly:
+			errors = append(errors, fmt.Sprintf("feature gate %q can only be set with --%s", name, featuregate.FlagName))
+		case featureSpec.Stage == featuregate.GA && !enabled:
+			errors = append(errors, fmt.Sprintf("feature gate %q is GA and can no longer be disabled", name))
+		default:
+			overrides[feature] = enabled
+		}
+	}
+
+	if len(errors) > 0 {
+		sort.Strings(errors)
+		return errors
+	}
+
+	rawValues := make(map[string]string, len(spec.Settings))
+	for name, raw := range spec.Settings {
+		rawValues[name] = raw
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values, c.rawValues, c.featureOverrides = values, rawValues, overrides
+	return nil
+}
+
+// ActiveSettings returns the raw values of the applied settings overrides
+func (c *Config) ActiveSettings() map[string]string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	settings := make(map[string]string, len(c.rawValues))
+	for name, value := range c.rawValues {
+		settings[name] = value
+	}
+	return settings
+}
+
+// ActiveFeatureGates returns the state of every feature gate with the
+// overrides applied
+func (c *Config) ActiveFeatureGates() map[string]bool {
+	gates := make(map[string]bool)
+	if c.features != nil {
+		for feature, enabled := range c.features.States() {
+			gates[string(feature)] = enabled
+		}
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for feature, enabled := range c.featureOverrides {
+		gates[string(feature)] = enabled
+	}
+	return gates
+}
+
+func (s Setting) parse(raw string) (interface{}, error) {
+	var value interface{}
+	var number float64
+	switch s.Type {
+	case Int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		value, number = parsed, float64(parsed)
+	case Float:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		value, number = parsed, parsed
+	case Duration:
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a duration", raw)
+		}
+		value, number = parsed, parsed.Seconds()
+	case Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a bool", raw)
+		}
+		return parsed, nil
+	case String:
+		if s.Validate != nil {
+			if err := s.Validate(raw); err != nil {
+				return nil, err
+			}
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("unsupported setting type %q", s.Type)
+	}
+
+	if s.Min != nil && number < *s.Min {
+		return nil, fmt.Errorf("%s is below the minimum %g", raw, *s.Min)
+	}
+	if s.Max != nil && number > *s.Max {
+		return nil, fmt.Errorf("%s is above the maximum %g", raw, *s.Max)
+	}
+	return value, nil
+}
+
+// Bound returns a pointer to value, for Setting.Min and Setting.Max
+func Bound(value float64) *float64 {
+	return &value
+}
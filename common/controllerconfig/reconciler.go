@@ -0,0 +1,109 @@
+package controllerconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// ValidCondition reports whether the spec of a ControllerConfig was applied
+	ValidCondition = "Valid"
+
+	// Reasons of the Valid condition
+	AppliedReason       = "Applied"
+	InvalidConfigReason = "InvalidConfig"
+)
+
+// configReconciler applies the ControllerConfig named after the controller
+type configReconciler struct {
+	client.Client
+	config *Config
+}
+
+// SetupWithManager watches the controller's ControllerConfig. Controllers run
+// without runtime configuration when the ControllerConfig CRD isn't installed.
+// The manager's scheme must include the api/v1alpha1 types.
+func (c *Config) SetupWithManager(mgr ctrl.Manager) error {
+	log := mgr.GetLogger().WithName("controllerconfig")
+
+	groupKind := configv1alpha1.GroupVersion.WithKind("ControllerConfig").GroupKind()
+	if _, err := mgr.GetRESTMapper().RESTMapping(groupKind, configv1alpha1.GroupVersion.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			log.Info("ControllerConfig CRD not installed, runtime configuration is disabled")
+			return nil
+		}
+		return fmt.Errorf("failed to look up ControllerConfig CRD: %w", err)
+	}
+
+	r := &configReconciler{Client: mgr.GetClient(), config: c}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("controllerconfig").
+		For(&configv1alpha1.ControllerConfig{}).
+		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == c.Controller
+		})).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(recovery.Wrap("controllerconfig", r))
+}
+
+func (r *configReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	controllerConfig := &configv1alpha1.ControllerConfig{}
+	if err := r.Get(ctx, req.NamespacedName, controllerConfig); err != nil {
+		if errors.IsNotFound(err) {
+			// Back to the flags and defaults the controller was started with
+			r.config.Apply(configv1alpha1.ControllerConfigSpec{})
+			log.Info("ControllerConfig deleted, using startup configuration", "controller", r.config.Controller)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	configCopy := controllerConfig.DeepCopy()
+	status := &configCopy.Status
+	status.ObservedGeneration = controllerConfig.Generation
+
+	if validationErrors := r.config.Apply(controllerConfig.Spec); len(validationErrors) > 0 {
+		log.Info("Rejected invalid ControllerConfig", "controller", r.config.Controller, "errors", validationErrors)
+		status.Errors = validationErrors
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               ValidCondition,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: controllerConfig.Generation,
+			Reason:             InvalidConfigReason,
+			Message:            "Keeping the previous configuration: " + strings.Join(validationErrors, "; "),
+		})
+	} else {
+		log.Info("Applied ControllerConfig", "controller", r.config.Controller, "settings", controllerConfig.Spec.Settings,
+			"featureGates", controllerConfig.Spec.FeatureGates)
+		now := metav1.Now()
+		status.Errors = nil
+		status.LastAppliedTime = &now
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               ValidCondition,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: controllerConfig.Generation,
+			Reason:             AppliedReason,
+			Message:            "Configuration applied",
+		})
+	}
+	status.ActiveSettings = r.config.ActiveSettings()
+	status.ActiveFeatureGates = r.config.ActiveFeatureGates()
+
+	if err := r.Status().Update(ctx, configCopy); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update ControllerConfig status: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,212 @@
+// Package featuregate provides feature gates shared by all controllers.
+//
+// Every controller declares the features it knows together with their
+// default and maturity, and binds a --feature-gates flag that accepts a
+// comma separated list of Feature=bool pairs, e.g.
+//
+//	--feature-gates=NodeAgentReports=true,CanaryPromotion=false
+//
+// Unknown features and invalid values are rejected at startup, and the
+// resulting gate states are logged and exported as metrics.
+package featuregate
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+// FlagName is the command line flag all controllers use for feature gates
+const FlagName = "feature-gates"
+
+// Feature is the name of a feature gate
+type Feature string
+
+// Stage is the maturity of a feature
+type Stage string
+
+const (
+	// Alpha features are experimental and disabled by default
+	Alpha Stage = "Alpha"
+	// Beta features are well tested and usually enabled by default
+	Beta Stage = "Beta"
+	// GA features are stable and can no longer be disabled
+	GA Stage = "GA"
+)
+
+// FeatureSpec describes a known feature
+type FeatureSpec struct {
+	Default bool
+	Stage   Stage
+	// StartupOnly features are read once when the controller starts and can't
+	// be overridden at runtime
+	StartupOnly bool
+}
+
+// FeatureGate holds the feature gate states of one controller
+type FeatureGate struct {
+	// Controller name used as metric label
+	Controller string
+
+	mutex   sync.RWMutex
+	known   map[Feature]FeatureSpec
+	enabled map[Feature]bool
+}
+
+// New creates a feature gate with the given known features set to their defaults
+func New(controller string, known map[Feature]FeatureSpec) *FeatureGate {
+	g := &FeatureGate{
+		Controller: controller,
+		known:      make(map[Feature]FeatureSpec, len(known)),
+		enabled:    make(map[Feature]bool, len(known)),
+	}
+	for feature, spec := range known {
+		g.known[feature] = spec
+		g.enabled[feature] = spec.Default
+	}
+	return g
+}
+
+// AddFlag binds the --feature-gates flag to the gate
+func (g *FeatureGate) AddFlag(fs *flag.FlagSet) {
+	usage := "A set of key=value pairs that describe feature gates for experimental features."
+	if known := g.KnownFeatures(); len(known) > 0 {
+		usage += " Options are:\n" + strings.Join(known, "\n")
+	} else {
+		usage += " This controller has no feature gates yet."
+	}
+	fs.Var(g, FlagName, usage)
+}
+
+// Set parses a comma separated list of Feature=bool pairs. It implements flag.Value.
+func (g *FeatureGate) Set(value string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	updates := make(map[Feature]bool)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, rawValue, found := strings.Cut(pair, "=")
+		if !found {
+			return fmt.Errorf("missing bool value for feature %q", key)
+		}
+
+		feature := Feature(strings.TrimSpace(key))
+		spec, known := g.known[feature]
+		if !known {
+			return fmt.Errorf("unknown feature gate %q", feature)
+		}
+
+		enabled, err := strconv.ParseBool(strings.TrimSpace(rawValue))
+		if err != nil {
+			return fmt.Errorf("invalid value %q for feature gate %q: %w", rawValue, feature, err)
+		}
+
+		if spec.Stage == GA && !enabled {
+			return fmt.Errorf("feature gate %q is GA and can no longer be disabled", feature)
+		}
+		updates[feature] = enabled
+	}
+
+	for feature, enabled := range updates {
+		g.enabled[feature] = enabled
+	}
+	return nil
+}
+
+// String returns the gate states as Feature=bool pairs. It implements flag.Value.
+func (g *FeatureGate) String() string {
+	if g == nil {
+		return ""
+	}
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	pairs := make([]string, 0, len(g.enabled))
+	for feature, enabled := range g.enabled {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", feature, enabled))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Enabled reports whether a feature is enabled. Unknown features and a nil gate report false.
+func (g *FeatureGate) Enabled(feature Feature) bool {
+	if g == nil {
+		return false
+	}
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.enabled[feature]
+}
+
+// Spec returns the spec of a known feature
+func (g *FeatureGate) Spec(feature Feature) (FeatureSpec, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	spec, known := g.known[feature]
+	return spec, known
+}
+
+// States returns the state of every known feature
+func (g *FeatureGate) States() map[Feature]bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	states := make(map[Feature]bool, len(g.enabled))
+	for feature, enabled := range g.enabled {
+		states[feature] = enabled
+	}
+	return states
+}
+
+// KnownFeatures returns a sorted description of all known features for flag usage
+func (g *FeatureGate) KnownFeatures() []string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	descriptions := make([]string, 0, len(g.known))
+	for feature, spec := range g.known {
+		descriptions = append(descriptions, fmt.Sprintf("%s=true|false (%s - default=%t)", feature, spec.Stage, spec.Default))
+	}
+	sort.Strings(descriptions)
+	return descriptions
+}
+
+// Report logs the state of every known feature and exports it as a metric
+func (g *FeatureGate) Report(log logr.Logger) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	features := make([]string, 0, len(g.known))
+	for feature := range g.known {
+		features = append(features, string(feature))
+	}
+	sort.Strings(features)
+
+	for _, name := range features {
+		feature := Feature(name)
+		spec := g.known[feature]
+		enabled := g.enabled[feature]
+
+		value := 0.0
+		if enabled {
+			value = 1
+		}
+		featureEnabled.WithLabelValues(g.Controller, name, string(spec.Stage)).Set(value)
+
+		log.Info("Feature gate", "feature", name, "stage", spec.Stage, "enabled", enabled)
+	}
+}
@@ -0,0 +1,15 @@
+package featuregate
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var featureEnabled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "controller_feature_enabled",
+	Help: "Whether a feature gate is enabled (1) or disabled (0)",
+}, []string{"controller", "feature", "stage"})
+
+func init() {
+	metrics.Registry.MustRegister(featureEnabled)
+}
@@ -0,0 +1,120 @@
+// Package httpauth authenticates and authorizes requests to the HTTP
+// endpoints controllers serve besides the manager, like scale hints or sync
+// diffs. Callers send a Kubernetes bearer token, e.g. a service account
+// token, which is checked with a TokenReview. Whether its user may make the
+// request is decided by a SubjectAccessReview, so access is granted with
+// ordinary RBAC.
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrUnauthenticated is returned for requests without a valid bearer token
+var ErrUnauthenticated = errors.New("a valid bearer token is required")
+
+// Reviewer checks callers against the API server. The controller needs
+// create on tokenreviews and subjectaccessreviews.
+type Reviewer struct {
+	Client client.Client
+}
+
+// User returns the user the bearer token of a request belongs to
+func (r *Reviewer) User(ctx context.Context, req *http.Request) (authenticationv1.UserInfo, error) {
+	token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !found || strings.TrimSpace(token) == "" {
+		return authenticationv1.UserInfo{}, ErrUnauthenticated
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: strings.TrimSpace(token)},
+	}
+	if err := r.Client.Create(ctx, review); err != nil {
+		return authenticationv1.UserInfo{}, fmt.Errorf("failed to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return authenticationv1.UserInfo{}, ErrUnauthenticated
+	}
+	return review.Status.User, nil
+}
+
+// Allowed reports whether user may act on the resource, and the reason the
+// authorizer gave when not
+func (r *Reviewer) Allowed(ctx context.Context, user authenticationv1.UserInfo, resource authorizationv1.ResourceAttributes) (bool, string, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, values := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(values)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &resource,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              extra,
+		},
+	}
+	if err := r.Client.Create(ctx, review); err != nil {
+		return false, "", fmt.Errorf("failed to review access: %w", err)
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
+
+// Authorize checks that the request comes from a user allowed to act on the
+// resource. It returns the HTTP status to answer with when not, 0 otherwise.
+func (r *Reviewer) Authorize(ctx context.Context, req *http.Request, resource authorizationv1.ResourceAttributes) (int, error) {
+	_, status, err := r.AuthorizeUser(ctx, req, resource)
+	return status, err
+}
+
+// AuthorizeUser is Authorize, returning the user as well, so endpoints can
+// review further resources of the request with Allowed
+func (r *Reviewer) AuthorizeUser(ctx context.Context, req *http.Request, resource authorizationv1.ResourceAttributes) (authenticationv1.UserInfo, int, error) {
+	user, err := r.User(ctx, req)
+	if errors.Is(err, ErrUnauthenticated) {
+		return user, http.StatusUnauthorized, err
+	}
+	if err != nil {
+		return user, http.StatusInternalServerError, err
+	}
+
+	allowed, reason, err := r.Allowed(ctx, user, resource)
+	if err != nil {
+		return user, http.StatusInternalServerError, err
+	}
+	if !allowed {
+		message := fmt.Sprintf("user %q may not %s %s", user.Username, resource.Verb, describe(resource))
+		if reason != "" {
+			message += ": " + reason
+		}
+		return user, http.StatusForbidden, errors.New(message)
+	}
+	return user, 0, nil
+}
+
+// describe names the resource of a review in error messages
+func describe(resource authorizationv1.ResourceAttributes) string {
+	name := resource.Resource
+	if resource.Subresource != "" {
+		name += "/" + resource.Subresource
+	}
+	if resource.Group != "" {
+		name += "." + resource.Group
+	}
+	if resource.Name != "" {
+		name += " " + resource.Name
+	}
+	if resource.Namespace != "" {
+		name += " in namespace " + resource.Namespace
+	}
+	return name
+}
@@ -0,0 +1,313 @@
+// Package manifests implements the `manifests` subcommand shared by the
+// controller binaries. It prints the CustomResourceDefinitions, RBAC,
+// Deployment and Service a controller needs as YAML, generated from the
+// controller's own description of its permissions and ports, so an install
+// always matches the binary it deploys.
+package manifests
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/psrvere/k8s-controllers/common/config"
+	"github.com/psrvere/k8s-controllers/common/version"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Command is the name of the subcommand
+	Command = "manifests"
+
+	// Default port of the controller-runtime metrics server, which also serves
+	// /version
+	MetricsPort = 8080
+
+	// Label selecting the pods of a controller, also used by the Services of
+	// the webhook configurations
+	nameLabel = "app"
+)
+
+// Manifest describes what one controller needs to run in a cluster
+type Manifest struct {
+	// Controller is the binary name, used for resource names and labels
+	Controller string
+
+	// Rules are the controller's RBAC rules. The rules every controller
+	// needs for its ControllerConfig are added to them.
+	Rules []rbacv1.PolicyRule
+
+	// FlagRules returns the rules only needed with some controller flags,
+	// e.g. for an optional feature, given the arguments passed to the
+	// controller. They are added to Rules.
+	FlagRules func(args []string) []rbacv1.PolicyRule
+
+	// Ports are the ports the controller serves besides metrics, e.g. its
+	// admission webhook. They are exposed on the Service.
+	Ports []corev1.ContainerPort
+
+	// HealthProbePort is the default port of /healthz and /readyz, zero when
+	// the controller doesn't serve them
+	HealthProbePort int32
+
+	// LeaderElection is set when the controller supports --leader-elect, it is
+	// enabled when more than one replica runs
+	LeaderElection bool
+
+	// Sharded is set when replicas split the work among themselves, so more
+	// than one replica can run without leader election
+	Sharded bool
+
+	// CRDs are the CustomResourceDefinition YAML documents of the controller's
+	// own APIs
+	CRDs [][]byte
+}
+
+// Options parameterize the generated manifests
+type Options struct {
+	Namespace string
+	Image     string
+	Replicas  int32
+	// CRDs includes the CustomResourceDefinitions, which are cluster-wide and
+	// often installed separately
+	CRDs bool
+	// Args are passed to the controller
+	Args []string
+}
+
+// Main prints the manifests with the subcommand arguments and returns the exit
+// code. Arguments after "--" are passed to the controller:
+//
+//	pod-labeller manifests --namespace ops -- --label-owner-templates
+func Main(args []string, manifest Manifest) int {
+	fs := flag.NewFlagSet(Command, flag.ContinueOnError)
+	opts := Options{}
+	fs.StringVar(&opts.Namespace, "namespace", "default", "Namespace to deploy the controller to.")
+	fs.StringVar(&opts.Image, "image", fmt.Sprintf("%s:%s", manifest.Controller, version.Version), "Image of the controller.")
+	replicas := fs.Int("replicas", 1, "Number of controller replicas.")
+	fs.BoolVar(&opts.CRDs, "crds", true, "Include the CustomResourceDefinitions.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	opts.Replicas = int32(*replicas)
+	opts.Args = fs.Args()
+
+	if err := Write(os.Stdout, manifest, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "manifests %s: %v\n", manifest.Controller, err)
+		return 1
+	}
+	return 0
+}
+
+// Write writes the manifests of a controller as a multi-document YAML stream
+func Write(out io.Writer, manifest Manifest, opts Options) error {
+	if opts.Replicas < 1 {
+		return fmt.Errorf("--replicas must be at least 1, got %d", opts.Replicas)
+	}
+	if opts.Replicas > 1 && !manifest.LeaderElection && !manifest.Sharded {
+		return fmt.Errorf("%s supports neither leader election nor sharding, it must run a single replica", manifest.Controller)
+	}
+
+	var documents [][]byte
+	if opts.CRDs {
+		documents = append(documents, config.ControllerConfigCRD)
+		documents = append(documents, manifest.CRDs...)
+	}
+	for _, obj := range objects(manifest, opts) {
+		document, err := marshal(obj)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, document)
+	}
+
+	for i, document := range documents {
+		if i > 0 {
+			if _, err := io.WriteString(out, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := out.Write(append(bytes.TrimSpace(document), '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlagSet reports whether the controller arguments set a flag to a value
+// other than empty or false, in any of the forms the flag package accepts:
+// -name, --name, --name=value and --name value.
+func FlagSet(args []string, name string) bool {
+	for i, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || flagName != name {
+			continue
+		}
+		if !hasValue {
+			// A boolean flag, or a value in the next argument
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				value = args[i+1]
+			} else {
+				value = "true"
+			}
+		}
+		return value != "" && value != "false"
+	}
+	return false
+}
+
+// objects returns the ServiceAccount, RBAC, Deployment and Service of a controller
+func objects(manifest Manifest, opts Options) []runtime.Object {
+	name := manifest.Controller
+	labels := map[string]string{nameLabel: name}
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: opts.Namespace, Labels: labels}
+	}
+	clusterMeta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Labels: labels}
+	}
+
+	rules := append([]rbacv1.PolicyRule{}, manifest.Rules...)
+	if manifest.FlagRules != nil {
+		rules = append(rules, manifest.FlagRules(opts.Args)...)
+	}
+	rules = append(rules,
+		rbacv1.PolicyRule{APIGroups: []string{"controller.example.com"}, Resources: []string{"controllerconfigs"}, Verbs: []string{"get", "list", "watch"}},
+		rbacv1.PolicyRule{APIGroups: []string{"controller.example.com"}, Resources: []string{"controllerconfigs/status"}, Verbs: []string{"update"}},
+	)
+	if manifest.LeaderElection {
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{"coordination.k8s.io"}, Resources: []string{"leases"}, Verbs: []string{"get", "create", "update"}})
+	}
+
+	// The metrics and health probe ports are the binaries' defaults
+	var args []string
+	if manifest.LeaderElection && opts.Replicas > 1 {
+		args = append(args, "--leader-elect")
+	}
+	args = append(args, opts.Args...)
+
+	ports := append([]corev1.ContainerPort{{Name: "metrics", ContainerPort: MetricsPort, Protocol: corev1.ProtocolTCP}}, manifest.Ports...)
+	container := corev1.Container{
+		Name:  name,
+		Image: opts.Image,
+		Args:  args,
+		Ports: ports,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{AllowPrivilegeEscalation: ptr.To(false)},
+	}
+	if manifest.HealthProbePort != 0 {
+		container.Ports = append(container.Ports, corev1.ContainerPort{Name: "health", ContainerPort: manifest.HealthProbePort, Protocol: corev1.ProtocolTCP})
+		container.LivenessProbe = httpProbe("/healthz", manifest.HealthProbePort)
+		container.ReadinessProbe = httpProbe("/readyz", manifest.HealthProbePort)
+	}
+
+	servicePorts := make([]corev1.ServicePort, 0, len(ports))
+	for _, port := range ports {
+		servicePorts = append(servicePorts, corev1.ServicePort{
+			Name:       port.Name,
+			Port:       port.ContainerPort,
+			TargetPort: intstr.FromString(port.Name),
+			Protocol:   port.Protocol,
+		})
+	}
+
+	return []runtime.Object{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: meta(name),
+		},
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			ObjectMeta: clusterMeta(name + "-role"),
+			Rules:      rules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: clusterMeta(name + "-binding"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: opts.Namespace}},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name + "-role"},
+		},
+		&appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: meta(name),
+			Spec: appsv1.DeploymentSpec{
+				Replicas: ptr.To(opts.Replicas),
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						ServiceAccountName: name,
+						Containers:         []corev1.Container{container},
+					},
+				},
+			},
+		},
+		&corev1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: meta(name),
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports:    servicePorts,
+			},
+		},
+	}
+}
+
+func httpProbe(path string, port int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{Path: path, Port: intstr.FromInt32(port)},
+		},
+	}
+}
+
+// marshal converts an object to YAML without the empty creationTimestamp and
+// status fields of objects that were never stored
+func marshal(obj runtime.Object) ([]byte, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %T: %w", obj, err)
+	}
+	prune(content)
+	return yaml.Marshal(content)
+}
+
+// prune removes nil values and empty maps, recursively
+func prune(content map[string]interface{}) {
+	for key, value := range content {
+		switch value := value.(type) {
+		case nil:
+			delete(content, key)
+		case map[string]interface{}:
+			prune(value)
+			if len(value) == 0 {
+				delete(content, key)
+			}
+		case []interface{}:
+			for _, item := range value {
+				if item, ok := item.(map[string]interface{}); ok {
+					prune(item)
+				}
+			}
+		}
+	}
+}
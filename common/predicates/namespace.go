@@ -0,0 +1,142 @@
+// Package predicates provides event filters shared by all controllers.
+//
+// Every controller skips objects in namespaces that carry the well-known
+// ignore label, so a namespace can be opted out of all controllers at once:
+//
+//	kubectl label namespace legacy-apps controller.example.com/ignore=true
+//
+// The Kubernetes system namespaces are always ignored, unless a controller
+// explicitly watches them.
+package predicates
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// IgnoreLabel opts every object in a namespace out of all controllers when set to "true"
+const IgnoreLabel = "controller.example.com/ignore"
+
+// SystemNamespaces are ignored whether or not they carry the ignore label
+var SystemNamespaces = []string{
+	"kube-system",
+	"kube-public",
+	"kube-node-lease",
+	"local-path-storage",
+}
+
+// NamespaceFilter decides whether objects in a namespace are ignored. A nil
+// NamespaceFilter only ignores the SystemNamespaces.
+type NamespaceFilter struct {
+	reader client.Reader
+
+	// Watch limits a controller to these namespaces when not empty. System
+	// namespaces listed here are watched too.
+	Watch []string
+	// Exclude are ignored in addition to the SystemNamespaces
+	Exclude []string
+	// OptInLabel, when set, ignores namespaces that aren't labelled with it set to "true"
+	OptInLabel string
+}
+
+// NewNamespaceFilter creates a NamespaceFilter that reads namespace labels
+// through reader, usually the manager's cached client
+func NewNamespaceFilter(reader client.Reader) *NamespaceFilter {
+	return &NamespaceFilter{reader: reader}
+}
+
+// Ignored reports whether objects in namespace should be skipped. Cluster
+// scoped objects (empty namespace) are never ignored.
+func (f *NamespaceFilter) Ignored(ctx context.Context, namespace string) bool {
+	if namespace == "" {
+		return false
+	}
+	if f == nil {
+		return IsSystemNamespace(namespace)
+	}
+	watched := slices.Contains(f.Watch, namespace)
+	if len(f.Watch) > 0 && !watched {
+		return true
+	}
+	if slices.Contains(f.Exclude, namespace) || (IsSystemNamespace(namespace) && !watched) {
+		return true
+	}
+	if f.reader == nil {
+		return false
+	}
+
+	ns := &corev1.Namespace{}
+	if err := f.reader.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		// Unknown namespaces aren't opted out, but haven't opted in either
+		return f.OptInLabel != ""
+	}
+	return HasIgnoreLabel(ns) || (f.OptInLabel != "" && !HasOptInLabel(ns, f.OptInLabel))
+}
+
+// Predicate filters out events for objects in ignored namespaces
+func (f *NamespaceFilter) Predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return !f.Ignored(context.Background(), obj.GetNamespace())
+	})
+}
+
+// CacheNamespaces returns the namespaces to set as the manager's
+// cache.Options.DefaultNamespaces for a watch list, so objects outside the
+// watched namespaces are neither listed, watched nor held in memory. extra
+// are namespaces the controller reads objects from besides the watched ones,
+// e.g. a configuration ConfigMap, empty ones are skipped. It returns nil,
+// caching all namespaces, when watch is empty.
+func CacheNamespaces(watch []string, extra ...string) map[string]cache.Config {
+	if len(watch) == 0 {
+		return nil
+	}
+	namespaces := make(map[string]cache.Config, len(watch)+len(extra))
+	for _, namespace := range append(slices.Clone(watch), extra...) {
+		if namespace != "" {
+			namespaces[namespace] = cache.Config{}
+		}
+	}
+	return namespaces
+}
+
+// HasIgnoreLabel reports whether a namespace is labelled with IgnoreLabel=true
+func HasIgnoreLabel(ns *corev1.Namespace) bool {
+	ignore, _ := strconv.ParseBool(ns.Labels[IgnoreLabel])
+	return ignore
+}
+
+// HasOptInLabel reports whether a namespace is labelled with label=true
+func HasOptInLabel(ns *corev1.Namespace, label string) bool {
+	enabled, _ := strconv.ParseBool(ns.Labels[label])
+	return enabled
+}
+
+// ParseNamespaces splits a comma separated list of namespaces, e.g. the value
+// of a --watch-namespaces flag
+func ParseNamespaces(raw string) []string {
+	var namespaces []string
+	for _, namespace := range strings.Split(raw, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// IsSystemNamespace reports whether namespace is one of the SystemNamespaces
+func IsSystemNamespace(namespace string) bool {
+	for _, sn := range SystemNamespaces {
+		if namespace == sn {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package recovery
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	reconcilePanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "controller_reconcile_panics_total",
+		Help: "Number of panics recovered in reconcilers",
+	}, []string{"controller"})
+
+	lastPanic = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "controller_reconcile_last_panic_timestamp_seconds",
+		Help: "Unix time of the last panic recovered in a reconciler",
+	}, []string{"controller"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcilePanics, lastPanic)
+}
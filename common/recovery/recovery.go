@@ -0,0 +1,42 @@
+// Package recovery keeps a panicking reconciler from crashing the manager.
+//
+// A panic in one reconcile, e.g. a nil map on an unexpected object, would
+// otherwise take every controller of the binary down with it. Wrapped
+// reconcilers log the panic with its stack trace, count it and requeue the
+// object, so the other objects keep being reconciled.
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DefaultPanicRequeue is the delay before an object whose reconcile panicked is
+// reconciled again. A fix deployed in the meantime picks it up, a persistent
+// panic doesn't spin.
+const DefaultPanicRequeue = 30 * time.Second
+
+// Wrap returns a reconciler that recovers panics of r. The controller name is
+// used as metric label.
+func Wrap(controller string, r reconcile.Reconciler) reconcile.Reconciler {
+	reconcilePanics.WithLabelValues(controller).Add(0)
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				reconcilePanics.WithLabelValues(controller).Inc()
+				lastPanic.WithLabelValues(controller).SetToCurrentTime()
+				log.FromContext(ctx).Error(fmt.Errorf("panic: %v", recovered), "Recovered panic in reconciler",
+					"controller", controller,
+					"request", req.NamespacedName,
+					"stacktrace", string(debug.Stack()))
+				result, err = reconcile.Result{RequeueAfter: DefaultPanicRequeue}, nil
+			}
+		}()
+		return r.Reconcile(ctx, req)
+	})
+}
@@ -0,0 +1,104 @@
+// Package restconfig provides the connection flags shared by all controllers.
+//
+// Controllers run in-cluster by default. For development and multi-cluster
+// tooling they can run out-of-cluster against any kubeconfig context, and
+// impersonate another user to check what the controller's RBAC allows:
+//
+//	./pod-labeller --kubeconfig ~/.kube/config --context staging \
+//	    --as system:serviceaccount:default:pod-labeller
+//
+// Without flags the usual lookup applies: --kubeconfig, $KUBECONFIG, the
+// in-cluster config, then ~/.kube/config.
+package restconfig
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// Flag names, matching kubectl
+const (
+	KubeconfigFlag       = "kubeconfig"
+	ContextFlag          = "context"
+	ImpersonateFlag      = "as"
+	ImpersonateGroupFlag = "as-group"
+	ImpersonateUIDFlag   = "as-uid"
+)
+
+// Options select the cluster, context and identity a controller connects with
+type Options struct {
+	// Kubeconfig is the path of a kubeconfig. Only set when the flag set
+	// doesn't have a kubeconfig flag yet, otherwise controller-runtime's
+	// flag is used.
+	Kubeconfig string
+	// Context is the kubeconfig context, empty uses the current context
+	Context string
+
+	// Impersonation of a user, its groups and UID
+	Impersonate       string
+	ImpersonateGroups []string
+	ImpersonateUID    string
+}
+
+// AddFlags binds the connection flags. controller-runtime registers
+// --kubeconfig on the default flag set, so it is only added to other flag sets.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	if fs.Lookup(KubeconfigFlag) == nil {
+		fs.StringVar(&o.Kubeconfig, KubeconfigFlag, "", "Path to a kubeconfig. Uses the in-cluster or default config when empty.")
+	}
+	fs.StringVar(&o.Context, ContextFlag, "", "The kubeconfig context to use, empty uses the current context")
+	fs.StringVar(&o.Impersonate, ImpersonateFlag, "", "Username to impersonate for all API requests")
+	fs.Var((*stringList)(&o.ImpersonateGroups), ImpersonateGroupFlag, "Group to impersonate for all API requests, can be repeated")
+	fs.StringVar(&o.ImpersonateUID, ImpersonateUIDFlag, "", "UID to impersonate for all API requests")
+}
+
+// Load returns the REST config for the selected context with the impersonation applied
+func (o *Options) Load() (*rest.Config, error) {
+	if o.Impersonate == "" && (len(o.ImpersonateGroups) > 0 || o.ImpersonateUID != "") {
+		return nil, fmt.Errorf("--%s and --%s require --%s", ImpersonateGroupFlag, ImpersonateUIDFlag, ImpersonateFlag)
+	}
+
+	var restConfig *rest.Config
+	var err error
+	if o.Kubeconfig != "" {
+		restConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: o.Kubeconfig},
+			&clientcmd.ConfigOverrides{CurrentContext: o.Context},
+		).ClientConfig()
+	} else {
+		restConfig, err = config.GetConfigWithContext(o.Context)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Impersonate != "" {
+		restConfig.Impersonate = rest.ImpersonationConfig{
+			UserName: o.Impersonate,
+			Groups:   o.ImpersonateGroups,
+			UID:      o.ImpersonateUID,
+		}
+	}
+	return restConfig, nil
+}
+
+// stringList is a flag that can be repeated, values may also be comma separated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package selftest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const reconcileTotalMetric = "controller_runtime_reconcile_total"
+
+// ReconcileCount scrapes a Prometheus text endpoint and returns the number of
+// reconciles (all results) of the named controller
+func ReconcileCount(ctx context.Context, metricsURL, controller string) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("invalid metrics url: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to scrape metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to scrape metrics: unexpected status %s", resp.Status)
+	}
+
+	controllerLabel := fmt.Sprintf("controller=%q", controller)
+	found := false
+	var total float64
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, reconcileTotalMetric+"{") || !strings.Contains(line, controllerLabel) {
+			continue
+		}
+
+		fields := strings.Fields(line[strings.LastIndex(line, "}")+1:])
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		total += value
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read metrics: %w", err)
+	}
+
+	if !found {
+		return 0, fmt.Errorf("metric %s for controller %q not found", reconcileTotalMetric, controller)
+	}
+	return total, nil
+}
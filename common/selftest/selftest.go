@@ -0,0 +1,213 @@
+// Package selftest implements the `selftest` subcommand shared by the controller
+// binaries. A self-test creates ephemeral resources the controller should act on,
+// waits until it did, reports the result and cleans up again. It is meant for
+// verifying an installation against a live cluster.
+package selftest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Command is the name of the subcommand
+	Command = "selftest"
+
+	// Label put on every resource created by a self-test
+	SelfTestLabel = "controller.example.com/selftest"
+
+	DefaultTimeout      = 3 * time.Minute
+	DefaultPollInterval = 2 * time.Second
+
+	cleanupTimeout = 30 * time.Second
+)
+
+// Test describes the self-test of one controller
+type Test struct {
+	// Controller is the binary name, used for resource names and output
+	Controller string
+
+	// Reconciler is the controller-runtime controller name, as used in the
+	// controller="..." label of controller_runtime_reconcile_total
+	Reconciler string
+
+	// Setup creates the test resources through env.Create
+	Setup func(ctx context.Context, env *Env) error
+
+	// Verify returns nil once the controller acted on the test resources. It is
+	// polled until it succeeds or the timeout expires. A nil Verify relies on
+	// the reconcile metrics alone and requires --metrics-url.
+	Verify func(ctx context.Context, env *Env) error
+}
+
+// Env is handed to a test's Setup and Verify functions
+type Env struct {
+	Client    client.Client
+	Namespace string
+	// Name is unique per run and should be used to name the test resources
+	Name string
+
+	created []client.Object
+}
+
+// Create creates an object and registers it for cleanup
+func (e *Env) Create(ctx context.Context, obj client.Object) error {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[SelfTestLabel] = "true"
+	obj.SetLabels(labels)
+
+	if err := e.Client.Create(ctx, obj); err != nil {
+		return err
+	}
+	e.Track(obj)
+	return nil
+}
+
+// Track registers an object created by the controller for cleanup. Tracking
+// the same object again is a no-op, so it is safe to call from Verify.
+func (e *Env) Track(obj client.Object) {
+	for _, tracked := range e.created {
+		if fmt.Sprintf("%T", tracked) == fmt.Sprintf("%T", obj) &&
+			tracked.GetNamespace() == obj.GetNamespace() && tracked.GetName() == obj.GetName() {
+			return
+		}
+	}
+	e.created = append(e.created, obj)
+}
+
+// Main runs the self-test with the subcommand arguments and returns the exit code
+func Main(args []string, scheme *runtime.Scheme, test Test) int {
+	fs := flag.NewFlagSet(Command, flag.ContinueOnError)
+	connection := &restconfig.Options{}
+	connection.AddFlags(fs)
+	namespace := fs.String("namespace", "default", "Namespace to create the test resources in.")
+	timeout := fs.Duration("timeout", DefaultTimeout, "How long to wait for the controller to act on the test resources.")
+	pollInterval := fs.Duration("poll-interval", DefaultPollInterval, "How often to check the test resources.")
+	metricsURL := fs.String("metrics-url", "",
+		"Metrics endpoint of the running controller, e.g. http://localhost:8080/metrics. "+
+			"When set, the controller must also report new reconciles.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	config, err := connection.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "selftest %s: unable to load kubeconfig: %v\n", test.Controller, err)
+		return 1
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "selftest %s: unable to create client: %v\n", test.Controller, err)
+		return 1
+	}
+
+	env := &Env{
+		Client:    c,
+		Namespace: *namespace,
+		Name:      fmt.Sprintf("selftest-%s-%s", test.Controller, rand.String(5)),
+	}
+	err = run(ctx, os.Stdout, env, test, *timeout, *pollInterval, *metricsURL)
+
+	// Clean up even when interrupted
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if cleanupErr := env.cleanup(cleanupCtx); cleanupErr != nil {
+		fmt.Fprintf(os.Stdout, "cleanup: FAILED: %v\n", cleanupErr)
+	} else {
+		fmt.Fprintln(os.Stdout, "cleanup: ok")
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "selftest %s: FAIL: %v\n", test.Controller, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, "selftest %s: PASS\n", test.Controller)
+	return 0
+}
+
+func run(ctx context.Context, out io.Writer, env *Env, test Test, timeout, pollInterval time.Duration, metricsURL string) error {
+	if test.Verify == nil && metricsURL == "" {
+		return fmt.Errorf("the %s self-test needs --metrics-url to observe the controller", test.Controller)
+	}
+
+	// Take the reconcile count before creating anything so the change is attributable
+	var baseline float64
+	if metricsURL != "" {
+		count, err := ReconcileCount(ctx, metricsURL, test.Reconciler)
+		if err != nil {
+			return err
+		}
+		baseline = count
+		fmt.Fprintf(out, "metrics: %s has %.0f reconciles\n", test.Reconciler, baseline)
+	}
+
+	if err := test.Setup(ctx, env); err != nil {
+		return fmt.Errorf("setup failed: %w", err)
+	}
+	fmt.Fprintf(out, "setup: created %d resource(s) in namespace %s\n", len(env.created), env.Namespace)
+
+	start := time.Now()
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		if test.Verify != nil {
+			if lastErr = test.Verify(ctx, env); lastErr != nil {
+				return false, nil
+			}
+		}
+		if metricsURL != "" {
+			count, err := ReconcileCount(ctx, metricsURL, test.Reconciler)
+			if err != nil {
+				lastErr = err
+				return false, nil
+			}
+			if count <= baseline {
+				lastErr = fmt.Errorf("no new reconciles reported by %s", test.Reconciler)
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			return fmt.Errorf("controller did not act within %s: %w", timeout, lastErr)
+		}
+		return err
+	}
+
+	fmt.Fprintf(out, "verify: ok after %s\n", time.Since(start).Round(time.Second))
+	return nil
+}
+
+// cleanup deletes the created and tracked objects, newest first
+func (e *Env) cleanup(ctx context.Context) error {
+	var failed []error
+	for i := len(e.created) - 1; i >= 0; i-- {
+		err := e.Client.Delete(ctx, e.created[i], client.PropagationPolicy("Background"))
+		if err != nil && !errors.IsNotFound(err) {
+			failed = append(failed, fmt.Errorf("%s: %w", e.created[i].GetName(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete %d resource(s): %v", len(failed), failed)
+	}
+	return nil
+}
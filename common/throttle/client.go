@@ -0,0 +1,120 @@
+package throttle
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WrapClient returns a client that reports every API error to the backoff
+func WrapClient(c client.Client, b *AdaptiveBackoff) client.Client {
+	return &observingClient{Client: c, backoff: b}
+}
+
+type observingClient struct {
+	client.Client
+	backoff *AdaptiveBackoff
+}
+
+func (c *observingClient) observe(err error) error {
+	c.backoff.Observe(err)
+	return err
+}
+
+func (c *observingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.observe(c.Client.Get(ctx, key, obj, opts...))
+}
+
+func (c *observingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.observe(c.Client.List(ctx, list, opts...))
+}
+
+func (c *observingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	return c.observe(c.Client.Create(ctx, obj, opts...))
+}
+
+func (c *observingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	return c.observe(c.Client.Delete(ctx, obj, opts...))
+}
+
+func (c *observingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.observe(c.Client.Update(ctx, obj, opts...))
+}
+
+func (c *observingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.observe(c.Client.Patch(ctx, obj, patch, opts...))
+}
+
+func (c *observingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	return c.observe(c.Client.DeleteAllOf(ctx, obj, opts...))
+}
+
+func (c *observingClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *observingClient) SubResource(subResource string) client.SubResourceClient {
+	return &observingSubResourceClient{SubResourceClient: c.Client.SubResource(subResource), backoff: c.backoff}
+}
+
+type observingSubResourceClient struct {
+	client.SubResourceClient
+	backoff *AdaptiveBackoff
+}
+
+func (c *observingSubResourceClient) observe(err error) error {
+	c.backoff.Observe(err)
+	return err
+}
+
+func (c *observingSubResourceClient) Get(ctx context.Context, obj, subResource client.Object, opts ...client.SubResourceGetOption) error {
+	return c.observe(c.SubResourceClient.Get(ctx, obj, subResource, opts...))
+}
+
+func (c *observingSubResourceClient) Create(ctx context.Context, obj, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	return c.observe(c.SubResourceClient.Create(ctx, obj, subResource, opts...))
+}
+
+func (c *observingSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	return c.observe(c.SubResourceClient.Update(ctx, obj, opts...))
+}
+
+func (c *observingSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	return c.observe(c.SubResourceClient.Patch(ctx, obj, patch, opts...))
+}
+
+// ListPages lists all objects from an uncached reader (e.g. mgr.GetAPIReader())
+// in pages whose size shrinks while the backoff is degraded. Cache-backed
+// readers don't support pagination and should use a plain List instead.
+func ListPages(ctx context.Context, reader client.Reader, list client.ObjectList, b *AdaptiveBackoff, opts ...client.ListOption) error {
+	var items []runtime.Object
+	continueToken := ""
+
+	for {
+		pageOpts := append([]client.ListOption{
+			client.Limit(b.PageSize(DefaultPageSize)),
+			client.Continue(continueToken),
+		}, opts...)
+
+		err := reader.List(ctx, list, pageOpts...)
+		b.Observe(err)
+		if err != nil {
+			return err
+		}
+
+		page, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		items = append(items, page...)
+
+		continueToken = list.GetContinue()
+		if continueToken == "" {
+			break
+		}
+	}
+
+	return meta.SetList(list, items)
+}
@@ -0,0 +1,22 @@
+package throttle
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	degradationLevel = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "controller_api_degradation_level",
+		Help: "Current API throttling degradation level (0 means not degraded)",
+	}, []string{"controller"})
+
+	throttledRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "controller_api_throttled_requests_total",
+		Help: "Number of API requests rejected with 429 Too Many Requests",
+	}, []string{"controller"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(degradationLevel, throttledRequests)
+}
@@ -0,0 +1,146 @@
+// Package throttle provides an adaptive backoff shared by all controllers.
+//
+// When the API server starts answering with 429 (Too Many Requests) the
+// backoff raises its degradation level. Every level doubles requeue intervals
+// and halves list page sizes. Levels decay one step for every RecoveryAfter
+// period without throttling, so controllers return to normal on their own.
+package throttle
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// DefaultMaxLevel caps the degradation level (requeues stretched up to 2^5 = 32x)
+	DefaultMaxLevel = 5
+
+	// DefaultRecoveryAfter is the throttle-free period after which the level drops by one
+	DefaultRecoveryAfter = time.Minute
+
+	// DefaultThrottleRequeue is the base delay for requeues after a throttling error
+	DefaultThrottleRequeue = 10 * time.Second
+
+	// DefaultPageSize is the list page size used when not degraded
+	DefaultPageSize = 500
+
+	// MinPageSize is the smallest page size the backoff shrinks to
+	MinPageSize = 10
+)
+
+// AdaptiveBackoff tracks API throttling for one controller
+type AdaptiveBackoff struct {
+	// Controller name used as metric label
+	Controller    string
+	MaxLevel      int
+	RecoveryAfter time.Duration
+
+	mutex        sync.Mutex
+	level        int
+	lastThrottle time.Time
+}
+
+// NewAdaptiveBackoff creates an adaptive backoff with default settings
+func NewAdaptiveBackoff(controller string) *AdaptiveBackoff {
+	b := &AdaptiveBackoff{
+		Controller:    controller,
+		MaxLevel:      DefaultMaxLevel,
+		RecoveryAfter: DefaultRecoveryAfter,
+	}
+	degradationLevel.WithLabelValues(controller).Set(0)
+	return b
+}
+
+// Observe inspects an API error and raises the degradation level on throttling.
+// It returns true if the error was a throttling error.
+func (b *AdaptiveBackoff) Observe(err error) bool {
+	if b == nil || !IsThrottled(err) {
+		return false
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.decay()
+	if b.level < b.MaxLevel {
+		b.level++
+	}
+	b.lastThrottle = time.Now()
+
+	throttledRequests.WithLabelValues(b.Controller).Inc()
+	degradationLevel.WithLabelValues(b.Controller).Set(float64(b.level))
+	return true
+}
+
+// Level returns the current degradation level, 0 meaning no degradation
+func (b *AdaptiveBackoff) Level() int {
+	if b == nil {
+		return 0
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.decay()
+	return b.level
+}
+
+// Degraded reports whether the controller is currently backing off
+func (b *AdaptiveBackoff) Degraded() bool {
+	return b.Level() > 0
+}
+
+// Requeue stretches a requeue interval according to the degradation level
+func (b *AdaptiveBackoff) Requeue(base time.Duration) time.Duration {
+	level := b.Level()
+	if level == 0 {
+		return base
+	}
+	return base * time.Duration(math.Pow(2, float64(level)))
+}
+
+// PageSize shrinks a list page size according to the degradation level
+func (b *AdaptiveBackoff) PageSize(base int64) int64 {
+	size := base >> b.Level()
+	if size < MinPageSize {
+		return MinPageSize
+	}
+	return size
+}
+
+// decay lowers the level for every full recovery period since the last throttle.
+// Callers must hold the mutex.
+func (b *AdaptiveBackoff) decay() {
+	if b.level == 0 || b.RecoveryAfter <= 0 {
+		return
+	}
+
+	steps := int(time.Since(b.lastThrottle) / b.RecoveryAfter)
+	if steps == 0 {
+		return
+	}
+
+	b.level -= min(steps, b.level)
+	// Restart the recovery period so the next step needs another full period
+	b.lastThrottle = b.lastThrottle.Add(time.Duration(steps) * b.RecoveryAfter)
+	degradationLevel.WithLabelValues(b.Controller).Set(float64(b.level))
+}
+
+// IsThrottled reports whether err is an API throttling error
+func IsThrottled(err error) bool {
+	return err != nil && apierrors.IsTooManyRequests(err)
+}
+
+// RequeueOnThrottle turns a throttling error into a delayed requeue, so the
+// workqueue doesn't retry immediately against an overloaded API server.
+// Other errors are returned unchanged.
+func (b *AdaptiveBackoff) RequeueOnThrottle(err error, base time.Duration) (reconcile.Result, error) {
+	if IsThrottled(err) {
+		return reconcile.Result{RequeueAfter: b.Requeue(base)}, nil
+	}
+	return reconcile.Result{}, err
+}
@@ -0,0 +1,142 @@
+// Package version reports which build of a controller is running.
+//
+// The build is stamped with ldflags:
+//
+//	go build -ldflags "-X github.com/psrvere/k8s-controllers/common/version.Version=v1.4.0 \
+//	  -X github.com/psrvere/k8s-controllers/common/version.GitCommit=$(git rev-parse HEAD) \
+//	  -X github.com/psrvere/k8s-controllers/common/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Unstamped builds fall back to the VCS information the Go toolchain embeds.
+// Every controller logs its build at startup, exports it as the
+// controller_build_info metric and serves it with its feature gates as JSON on
+// /version of the metrics server.
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Path the version is served on by the metrics server
+const Path = "/version"
+
+// Set with -ldflags "-X github.com/psrvere/k8s-controllers/common/version.Version=..."
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildDate = ""
+)
+
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "controller_build_info",
+	Help: "Always 1, labelled with the version and git commit of the running controller build",
+}, []string{"controller", "version", "git_commit", "go_version"})
+
+func init() {
+	metrics.Registry.MustRegister(buildInfo)
+}
+
+// Info describes the running build of a controller
+type Info struct {
+	Controller string `json:"controller"`
+	Version    string `json:"version"`
+	GitCommit  string `json:"gitCommit"`
+	BuildDate  string `json:"buildDate,omitempty"`
+	GoVersion  string `json:"goVersion"`
+	Platform   string `json:"platform"`
+	// FeatureGates holds the state of every feature gate, with runtime
+	// overrides applied
+	FeatureGates map[string]bool `json:"featureGates"`
+}
+
+// Get returns the build of the running binary
+func Get(controller string) Info {
+	info := Info{
+		Controller: controller,
+		Version:    Version,
+		GitCommit:  GitCommit,
+		BuildDate:  BuildDate,
+		GoVersion:  runtime.Version(),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info.GitCommit == "" {
+		info.GitCommit = vcsRevision()
+	}
+	return info
+}
+
+// vcsRevision returns the commit embedded by the Go toolchain, marked dirty
+// for builds of modified trees, or "unknown"
+func vcsRevision() string {
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// Report logs the build and the enabled feature gates, and exports the build
+// as a metric
+func Report(log logr.Logger, features *featuregate.FeatureGate) {
+	info := Get(features.Controller)
+	buildInfo.WithLabelValues(info.Controller, info.Version, info.GitCommit, info.GoVersion).Set(1)
+
+	var enabled []string
+	for feature, on := range features.States() {
+		if on {
+			enabled = append(enabled, string(feature))
+		}
+	}
+	sort.Strings(enabled)
+
+	log.Info("Build",
+		"controller", info.Controller,
+		"version", info.Version,
+		"gitCommit", info.GitCommit,
+		"buildDate", info.BuildDate,
+		"goVersion", info.GoVersion,
+		"platform", info.Platform,
+		"enabledFeatures", enabled)
+}
+
+// Handler serves the build as JSON. featureGates is called per request, so
+// gates changed at runtime are reported as they are now.
+func Handler(controller string, featureGates func() map[string]bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		info := Get(controller)
+		info.FeatureGates = featureGates()
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(info)
+	})
+}
+
+// AddToManager serves the build on Path of the manager's metrics server
+func AddToManager(mgr manager.Manager, controller string, featureGates func() map[string]bool) error {
+	return mgr.AddMetricsServerExtraHandler(Path, Handler(controller, featureGates))
+}
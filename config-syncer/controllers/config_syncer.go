@@ -3,9 +3,14 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/go-logr/logr"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -19,7 +24,28 @@ import (
 
 type ConfigMapReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme  *runtime.Scheme
+	Backoff *throttle.AdaptiveBackoff
+
+	// Limits are checked before a source is synced
+	Limits SyncLimits
+	// Namespaces skips objects in namespaces opted out with the ignore label
+	Namespaces *predicates.NamespaceFilter
+	// Config overrides the sync limits at runtime. Nil keeps the startup configuration.
+	Config *controllerconfig.Config
+	// SecretReader reads the target Secrets of projections. It should bypass the
+	// cache, which only holds source Secrets. Nil disables Secret projection.
+	SecretReader client.Reader
+	// CreateNamespaces allows sources to create their missing target namespaces
+	CreateNamespaces bool
+	// AllowedNamespaceLabels limits the label keys of created namespaces. Empty
+	// allows every key without a reserved prefix.
+	AllowedNamespaceLabels []string
+	// Sealer encrypts the keys listed in the encrypt-keys annotation of a
+	// source. Nil disables encryption, sources asking for it aren't synced.
+	Sealer *Sealer
+
+	deleted deletedTargets
 }
 
 const (
@@ -37,6 +63,20 @@ const (
 
 	// Annotation to track source ConfigMap
 	SourceAnnotation = "config-syncer/source"
+
+	// Annotation to temporarily suspend syncing of a source ConfigMap
+	PausedAnnotation = "config-syncer/paused"
+
+	// Annotation the controller uses to remember a source was paused
+	SyncStateAnnotation = "config-syncer/sync-state"
+	SyncStatePaused     = "paused"
+
+	// Event reasons
+	SyncPausedReason       = "SyncPaused"
+	SyncResumedReason      = "SyncResumed"
+	TargetCreatedReason    = "TargetCreated"
+	TargetUpdatedReason    = "TargetUpdated"
+	TargetSyncFailedReason = "TargetSyncFailed"
 )
 
 func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -48,6 +88,7 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// ConfigMap not found, probably deleted
+			r.deleted.forgetSource(req.NamespacedName)
 			log.Info("ConfigMap not found. Skipping reconciliation", "configmap", req.Name, "namespace", req.Namespace)
 			return ctrl.Result{}, nil
 		}
@@ -62,6 +103,39 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, nil
 	}
 
+	// Refuse copies that got the sync label, they would sync in a loop
+	allowed, err := r.reconcileSyncLoop(ctx, configMap, log)
+	if err != nil {
+		log.Error(err, "Failed to record sync loop state", "configmap", configMap.Name, "namespace", configMap.Namespace)
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if !allowed {
+		log.Info("ConfigMap is a synced copy, skipping", "configmap", configMap.Name, "namespace", configMap.Namespace)
+		return ctrl.Result{}, nil
+	}
+
+	// Skip syncing while the source is paused
+	paused, err := r.reconcilePauseState(ctx, configMap, log)
+	if err != nil {
+		log.Error(err, "Failed to record pause state", "configmap", configMap.Name, "namespace", configMap.Namespace)
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if paused {
+		log.Info("Sync paused for ConfigMap, skipping", "configmap", configMap.Name, "namespace", configMap.Namespace)
+		return ctrl.Result{}, nil
+	}
+
+	// Reject sources that exceed the sync limits
+	allowed, err = r.reconcileGuardrails(ctx, configMap, log)
+	if err != nil {
+		log.Error(err, "Failed to record sync limit state", "configmap", configMap.Name, "namespace", configMap.Namespace)
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if !allowed {
+		log.Info("ConfigMap exceeds sync limits, skipping", "configmap", configMap.Name, "namespace", configMap.Namespace)
+		return ctrl.Result{}, nil
+	}
+
 	// Get target namespace(s)
 	targetNamespaces := getTargetNamespaces(configMap)
 	if len(targetNamespaces) == 0 {
@@ -69,18 +143,96 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, nil
 	}
 
+	// Get the merge strategy for targets that already exist
+	strategy, err := getMergeStrategy(configMap)
+	if err != nil {
+		log.Info("Invalid merge strategy, skipping", "configmap", configMap.Name, "namespace", configMap.Namespace, "error", err.Error())
+		if err := r.createSyncEvent(ctx, configMap, InvalidMergeStrategyReason, err.Error(), corev1.EventTypeWarning); err != nil {
+			log.Error(err, "Failed to create sync event", "configmap", configMap.Name, "reason", InvalidMergeStrategyReason)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Projected sources only copy their allowed keys, into Secrets
+	targetKind, projectedKeys, err := r.getProjection(configMap)
+	if err != nil {
+		log.Info("Invalid projection, skipping", "configmap", configMap.Name, "namespace", configMap.Namespace, "error", err.Error())
+		if err := r.createSyncEvent(ctx, configMap, InvalidProjectionReason, err.Error(), corev1.EventTypeWarning); err != nil {
+			log.Error(err, "Failed to create sync event", "configmap", configMap.Name, "reason", InvalidProjectionReason)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Never write values that should be encrypted in plain text
+	if hasEncryptKeys(configMap) && r.Sealer == nil {
+		message := fmt.Sprintf("Source has %s but the controller runs without --encryption-key-namespace, not syncing", EncryptKeysAnnotation)
+		log.Info("Encryption unavailable, skipping", "configmap", configMap.Name, "namespace", configMap.Namespace)
+		if err := r.createSyncEvent(ctx, configMap, EncryptionUnavailableReason, message, corev1.EventTypeWarning); err != nil {
+			log.Error(err, "Failed to create sync event", "configmap", configMap.Name, "reason", EncryptionUnavailableReason)
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// Sync to each target namespace
-	for _, targetNamespace := range targetNamespaces {
-		if err := r.syncConfigMap(ctx, configMap, targetNamespace, log); err != nil {
-			log.Error(err, "Failed to sync ConfigMap", "configmap", configMap.Name, "target-namespace", targetNamespace)
-			return ctrl.Result{}, err
+	sync := func(targetNamespace string) (string, error) {
+		return r.syncConfigMap(ctx, configMap, targetNamespace, strategy, log)
+	}
+	if targetKind == ProjectToSecret {
+		sync = func(targetNamespace string) (string, error) {
+			return r.syncSecret(ctx, configMap, projectedKeys, targetNamespace, log)
 		}
 	}
+	missing, err := r.syncTargets(ctx, configMap, targetNamespaces, sync, log)
+	if err != nil {
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if missing {
+		log.Info("Synced ConfigMap, some target namespaces are missing", "configmap", configMap.Name, "namespace", configMap.Namespace)
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(MissingNamespaceRequeue)}, nil
+	}
 
 	log.Info("Successfully synced ConfigMap", "configmap", configMap.Name, "namespace", configMap.Namespace, "target-namespaces", targetNamespaces)
 	return ctrl.Result{}, nil
 }
 
+// syncTargets syncs a source to each target namespace with sync and records
+// the results. Missing target namespaces are skipped and reported on the
+// source, it returns whether there were any. It stops at the first failed target.
+func (r *ConfigMapReconciler) syncTargets(ctx context.Context, source client.Object, targetNamespaces []string, sync func(targetNamespace string) (string, error), log logr.Logger) (bool, error) {
+	var missing []string
+	for _, targetNamespace := range targetNamespaces {
+		if r.Namespaces.Ignored(ctx, targetNamespace) {
+			log.Info("Target namespace is ignored, skipping", "source", source.GetName(), "target-namespace", targetNamespace)
+			continue
+		}
+		exists, err := r.ensureTargetNamespace(ctx, source, targetNamespace, log)
+		if err != nil {
+			recordTargetSync(source.GetNamespace(), targetNamespace, SyncResultFailed, err)
+			log.Error(err, "Failed to get target namespace", "source", source.GetName(), "target-namespace", targetNamespace)
+			return false, err
+		}
+		if !exists {
+			recordTargetSync(source.GetNamespace(), targetNamespace, SyncResultNamespaceMissing, nil)
+			log.Info("Target namespace doesn't exist, skipping", "source", source.GetName(), "target-namespace", targetNamespace)
+			missing = append(missing, targetNamespace)
+			continue
+		}
+
+		result, err := sync(targetNamespace)
+		recordTargetSync(source.GetNamespace(), targetNamespace, result, err)
+		r.recordTargetSyncEvent(ctx, source, targetNamespace, result, err, log)
+		if result == SyncResultRejected {
+			log.Info("Target was rejected, skipping", "source", source.GetName(), "target-namespace", targetNamespace, "reason", err.Error())
+			continue
+		}
+		if err != nil {
+			log.Error(err, "Failed to sync target", "source", source.GetName(), "target-namespace", targetNamespace)
+			return false, err
+		}
+	}
+	return len(missing) > 0, r.reportMissingNamespaces(ctx, source, missing, log)
+}
+
 func shouldSyncConfigMap(configMap *corev1.ConfigMap) bool {
 	if configMap.Labels == nil {
 		return false
@@ -89,12 +241,102 @@ func shouldSyncConfigMap(configMap *corev1.ConfigMap) bool {
 	return exists
 }
 
-func getTargetNamespaces(configMap *corev1.ConfigMap) []string {
+func isSyncPaused(configMap *corev1.ConfigMap) bool {
 	if configMap.Annotations == nil {
+		return false
+	}
+	paused, _ := strconv.ParseBool(configMap.Annotations[PausedAnnotation])
+	return paused
+}
+
+// reconcilePauseState records pause/resume transitions on the source ConfigMap
+// and emits an event for each transition. It returns whether syncing is paused.
+func (r *ConfigMapReconciler) reconcilePauseState(ctx context.Context, configMap *corev1.ConfigMap, log logr.Logger) (bool, error) {
+	paused := isSyncPaused(configMap)
+	wasPaused := configMap.Annotations[SyncStateAnnotation] == SyncStatePaused
+	if paused == wasPaused {
+		return paused, nil
+	}
+
+	configMapCopy := configMap.DeepCopy()
+	if configMapCopy.Annotations == nil {
+		configMapCopy.Annotations = make(map[string]string)
+	}
+
+	reason := SyncResumedReason
+	message := "Sync to target namespaces resumed"
+	if paused {
+		configMapCopy.Annotations[SyncStateAnnotation] = SyncStatePaused
+		reason = SyncPausedReason
+		message = "Sync to target namespaces paused"
+	} else {
+		delete(configMapCopy.Annotations, SyncStateAnnotation)
+	}
+
+	if err := r.Update(ctx, configMapCopy); err != nil {
+		return paused, err
+	}
+
+	if err := r.createSyncEvent(ctx, configMap, reason, message, corev1.EventTypeNormal); err != nil {
+		// Don't fail the reconcile for event creation failure
+		log.Error(err, "Failed to create sync event", "configmap", configMap.Name, "reason", reason)
+	}
+
+	log.Info(message, "configmap", configMap.Name, "namespace", configMap.Namespace)
+	return paused, nil
+}
+
+// createSyncEvent records an event on a source ConfigMap or Secret. Event names
+// are unique so repeated transitions (pause, resume, pause, ...) each get their
+// own event.
+func (r *ConfigMapReconciler) createSyncEvent(ctx context.Context, source client.Object, reason, message, eventType string) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", source.GetName(), now.UnixNano()),
+			Namespace: source.GetNamespace(),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            sourceKind(source),
+			Name:            source.GetName(),
+			Namespace:       source.GetNamespace(),
+			UID:             source.GetUID(),
+			APIVersion:      "v1",
+			ResourceVersion: source.GetResourceVersion(),
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: "config-syncer",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
+
+// sourceKind returns the kind of a source. The kind set on the object wins,
+// the Secret view of a projection is a ConfigMap with the Secret kind.
+func sourceKind(source client.Object) string {
+	if kind := source.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+	if _, ok := source.(*corev1.Secret); ok {
+		return "Secret"
+	}
+	return "ConfigMap"
+}
+
+func getTargetNamespaces(source client.Object) []string {
+	annotations := source.GetAnnotations()
+	if annotations == nil {
 		return nil
 	}
 
-	targetNamespaceStr, exists := configMap.Annotations[TargetNamespaceAnnotation]
+	targetNamespaceStr, exists := annotations[TargetNamespaceAnnotation]
 	if !exists {
 		return nil
 	}
@@ -108,9 +350,13 @@ func getTargetNamespaces(configMap *corev1.ConfigMap) []string {
 	return namespaces
 }
 
-func (r *ConfigMapReconciler) syncConfigMap(ctx context.Context, sourceConfigMap *corev1.ConfigMap, targetNamespace string, log logr.Logger) error {
+// syncConfigMap syncs a source to one target namespace and returns the sync
+// result (created, updated, skipped or failed)
+func (r *ConfigMapReconciler) syncConfigMap(ctx context.Context, sourceConfigMap *corev1.ConfigMap, targetNamespace, strategy string, log logr.Logger) (string, error) {
 	// Determine target ConfigMap name
-	targetName := getTargetConfigMapName(sourceConfigMap)
+	targetName := getTargetName(sourceConfigMap)
+	// Targets are stamped with the plain source content, before encryption
+	stamp := newSyncStamp(sourceConfigMap, configMapValues(sourceConfigMap))
 
 	// Check if target ConfigMap already exists
 	targetConfigMap := &corev1.ConfigMap{}
@@ -118,28 +364,56 @@ func (r *ConfigMapReconciler) syncConfigMap(ctx context.Context, sourceConfigMap
 
 	if err != nil && errors.IsNotFound(err) {
 		// Create new ConfigMap
-		return r.createTargetConfigMap(ctx, sourceConfigMap, targetNamespace, targetName, log)
+		sealed, sealedKeys, err := sealSource(ctx, r.Sealer, sourceConfigMap, nil, targetNamespace)
+		if err != nil {
+			return SyncResultFailed, err
+		}
+		created, err := r.createTargetConfigMap(ctx, sealed, sealedKeys, stamp, targetNamespace, targetName, log)
+		if err != nil {
+			return SyncResultFailed, err
+		}
+		if r.deleted.take(client.ObjectKeyFromObject(created)) {
+			r.reportProtectedTargetDeleted(ctx, sourceConfigMap, created, log)
+		}
+		return SyncResultCreated, nil
 	} else if err != nil {
-		return err
+		return SyncResultFailed, err
+	}
+
+	// Never overwrite another source, or the source itself
+	if isSyncSource(targetConfigMap) {
+		return SyncResultRejected, fmt.Errorf("target is itself a sync source, refusing to create a sync loop")
 	}
 
 	// Update existing ConfigMap
-	return r.updateTargetConfigMap(ctx, sourceConfigMap, targetConfigMap, log)
+	sealed, sealedKeys, err := sealSource(ctx, r.Sealer, sourceConfigMap, targetConfigMap, targetNamespace)
+	if err != nil {
+		return SyncResultFailed, err
+	}
+	updated, err := r.updateTargetConfigMap(ctx, sealed, sealedKeys, stamp, targetConfigMap, strategy, log)
+	switch {
+	case err != nil:
+		return SyncResultFailed, err
+	case updated:
+		return SyncResultUpdated, nil
+	default:
+		return SyncResultSkipped, nil
+	}
 }
 
-func getTargetConfigMapName(sourceConfigMap *corev1.ConfigMap) string {
+func getTargetName(source client.Object) string {
 	// Check if custom target name is specified
-	if sourceConfigMap.Annotations != nil {
-		if targetName, exists := sourceConfigMap.Annotations[TargetNameAnnotation]; exists {
-			return targetName
-		}
+	if targetName, exists := source.GetAnnotations()[TargetNameAnnotation]; exists {
+		return targetName
 	}
 
 	// Use source name as default
-	return sourceConfigMap.Name
+	return source.GetName()
 }
 
-func (r *ConfigMapReconciler) createTargetConfigMap(ctx context.Context, sourceConfigMap *corev1.ConfigMap, targetNamespace, targetName string, log logr.Logger) error {
+// createTargetConfigMap creates a target from a source whose sealedKeys are
+// already encrypted, stamped with stamp, and returns it
+func (r *ConfigMapReconciler) createTargetConfigMap(ctx context.Context, sourceConfigMap *corev1.ConfigMap, sealedKeys []string, stamp syncStamp, targetNamespace, targetName string, log logr.Logger) (*corev1.ConfigMap, error) {
 	targetConfigMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      targetName,
@@ -148,36 +422,93 @@ func (r *ConfigMapReconciler) createTargetConfigMap(ctx context.Context, sourceC
 				SyncedLabel: "true",
 			},
 			Annotations: map[string]string{
-				SourceAnnotation: fmt.Sprintf("%s/%s", sourceConfigMap.Namespace, sourceConfigMap.Name),
+				SourceAnnotation:     fmt.Sprintf("%s/%s", sourceConfigMap.Namespace, sourceConfigMap.Name),
+				SyncedKeysAnnotation: strings.Join(configMapKeys(sourceConfigMap), ","),
 			},
 		},
 		Data:       sourceConfigMap.Data,
 		BinaryData: sourceConfigMap.BinaryData,
 	}
+	applyEncryptedKeys(targetConfigMap, sealedKeys)
+	applyProtection(targetConfigMap, protectsTargets(sourceConfigMap))
+	stamp.apply(targetConfigMap)
 
 	log.Info("Creating target ConfigMap", "name", targetName, "namespace", targetNamespace, "source", sourceConfigMap.Name)
-	return r.Create(ctx, targetConfigMap)
+	return targetConfigMap, r.Create(ctx, targetConfigMap)
 }
 
-func (r *ConfigMapReconciler) updateTargetConfigMap(ctx context.Context, sourceConfigMap *corev1.ConfigMap, targetConfigMap *corev1.ConfigMap, log logr.Logger) error {
+// updateTargetConfigMap merges a source whose sealedKeys are already
+// encrypted into an existing target and stamps it with stamp. It returns false
+// when the target was already up to date.
+func (r *ConfigMapReconciler) updateTargetConfigMap(ctx context.Context, sourceConfigMap *corev1.ConfigMap, sealedKeys []string, stamp syncStamp, targetConfigMap *corev1.ConfigMap, strategy string, log logr.Logger) (bool, error) {
+	previousConflicts := targetConfigMap.Annotations[ConflictingKeysAnnotation]
+	result := mergeConfigMaps(sourceConfigMap, targetConfigMap, strategy)
+
 	// Check if update is needed
-	if configMapsEqual(sourceConfigMap, targetConfigMap) {
+	source := fmt.Sprintf("%s/%s", sourceConfigMap.Namespace, sourceConfigMap.Name)
+	targetCopy := targetConfigMap.DeepCopy()
+	changed := applyMergeResult(targetCopy, result)
+	changed = applyEncryptedKeys(targetCopy, sealedKeys) || changed
+	changed = applyProtection(targetCopy, protectsTargets(sourceConfigMap)) || changed
+	changed = stamp.stale(targetCopy) || changed
+	if !changed && targetCopy.Annotations[SourceAnnotation] == source {
 		log.Info("Target ConfigMap is up to date, skipping update", "name", targetConfigMap.Name, "namespace", targetConfigMap.Namespace)
-		return nil
+		return false, nil
 	}
 
-	// Update the target ConfigMap
-	targetConfigMap.Data = sourceConfigMap.Data
-	targetConfigMap.BinaryData = sourceConfigMap.BinaryData
-
 	// Update source annotation
-	if targetConfigMap.Annotations == nil {
-		targetConfigMap.Annotations = make(map[string]string)
+	targetCopy.Annotations[SourceAnnotation] = source
+	stamp.apply(targetCopy)
+
+	log.Info("Updating target ConfigMap", "name", targetConfigMap.Name, "namespace", targetConfigMap.Namespace,
+		"source", sourceConfigMap.Name, "strategy", strategy)
+	if err := r.Update(ctx, targetCopy); err != nil {
+		return false, err
 	}
-	targetConfigMap.Annotations[SourceAnnotation] = fmt.Sprintf("%s/%s", sourceConfigMap.Namespace, sourceConfigMap.Name)
 
-	log.Info("Updating target ConfigMap", "name", targetConfigMap.Name, "namespace", targetConfigMap.Namespace, "source", sourceConfigMap.Name)
-	return r.Update(ctx, targetConfigMap)
+	// Report each new set of conflicting keys once
+	if len(result.Conflicts) > 0 && strings.Join(result.Conflicts, ",") != previousConflicts {
+		message := conflictMessage(targetConfigMap, strategy, result.Conflicts)
+		if err := r.createSyncEvent(ctx, sourceConfigMap, SyncConflictReason, message, corev1.EventTypeWarning); err != nil {
+			// Don't fail the sync for event creation failure
+			log.Error(err, "Failed to create sync event", "configmap", sourceConfigMap.Name, "reason", SyncConflictReason)
+		}
+	}
+	return true, nil
+}
+
+// recordTargetSyncEvent records target creations, updates and failures on the
+// source. Skipped targets only show up in the metrics, an event for every
+// no-op sync would drown the useful ones.
+func (r *ConfigMapReconciler) recordTargetSyncEvent(ctx context.Context, source client.Object, targetNamespace, result string, syncErr error, log logr.Logger) {
+	targetName := getTargetName(source)
+	targetKind, rejectedReason := "ConfigMap", SyncLoopRejectedReason
+	if projectsToSecret(source) {
+		targetKind, rejectedReason = "Secret", ProjectionRejectedReason
+	}
+
+	var reason, message, eventType string
+	switch result {
+	case SyncResultCreated:
+		reason, eventType = TargetCreatedReason, corev1.EventTypeNormal
+		message = fmt.Sprintf("Created target %s %s/%s", targetKind, targetNamespace, targetName)
+	case SyncResultUpdated:
+		reason, eventType = TargetUpdatedReason, corev1.EventTypeNormal
+		message = fmt.Sprintf("Updated target %s %s/%s", targetKind, targetNamespace, targetName)
+	case SyncResultFailed:
+		reason, eventType = TargetSyncFailedReason, corev1.EventTypeWarning
+		message = fmt.Sprintf("Failed to sync target %s %s/%s (%s): %v", targetKind, targetNamespace, targetName, syncErrorType(syncErr), syncErr)
+	case SyncResultRejected:
+		reason, eventType = rejectedReason, corev1.EventTypeWarning
+		message = fmt.Sprintf("Not syncing to %s %s/%s: %v", targetKind, targetNamespace, targetName, syncErr)
+	default:
+		return
+	}
+
+	if err := r.createSyncEvent(ctx, source, reason, message, eventType); err != nil {
+		// Don't fail the sync for event creation failure
+		log.Error(err, "Failed to create sync event", "source", source.GetName(), "reason", reason)
+	}
 }
 
 func configMapsEqual(source, target *corev1.ConfigMap) bool {
@@ -205,8 +536,15 @@ func configMapsEqual(source, target *corev1.ConfigMap) bool {
 }
 
 func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := r.setupSecretProjection(mgr); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.ConfigMap{}).
+		// Deleted protected targets are re-created by syncing their source
+		Watches(&corev1.ConfigMap{}, r.enqueueSourceOfDeletedTarget()).
+		WithEventFilter(r.Namespaces.Predicate()).
 		WithEventFilter(predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool {
 				log := log.FromContext(context.Background())
@@ -265,7 +603,7 @@ func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return true
 			},
 		}).
-		Complete(r)
+		Complete(recovery.Wrap("config-syncer", r))
 }
 
 func hasSyncLabelChanged(old, new *corev1.ConfigMap) bool {
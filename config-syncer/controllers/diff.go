@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/psrvere/k8s-controllers/common/httpauth"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DiffPath is the HTTP path returning the diff between a source and its targets
+const DiffPath = "/diff"
+
+// Target states reported by the diff endpoint
+const (
+	DiffInSync           = "in-sync"
+	DiffOutOfSync        = "out-of-sync"
+	DiffTargetMissing    = "target-missing"
+	DiffNamespaceMissing = "namespace-missing"
+	DiffNamespaceIgnored = "namespace-ignored"
+	DiffRejected         = "rejected"
+	DiffFailed           = "failed"
+)
+
+// SourceDiff compares a source with the current data of each of its targets.
+// Only keys are returned, values never leave the cluster.
+type SourceDiff struct {
+	Source     string `json:"source"`
+	Kind       string `json:"kind"`
+	TargetKind string `json:"targetKind,omitempty"`
+	Strategy   string `json:"strategy,omitempty"`
+	// Blocked lists why the controller doesn't sync the source right now
+	Blocked []string     `json:"blocked,omitempty"`
+	Targets []TargetDiff `json:"targets,omitempty"`
+	Message string       `json:"message,omitempty"`
+}
+
+// TargetDiff is the difference between a source and one target
+type TargetDiff struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	State     string `json:"state"`
+	Message   string `json:"message,omitempty"`
+	// SourceOnly are source keys missing in the target
+	SourceOnly []string `json:"sourceOnly,omitempty"`
+	// TargetOnly are target keys the source doesn't have, e.g. local keys
+	TargetOnly []string `json:"targetOnly,omitempty"`
+	// Changed are keys with a different value in the target
+	Changed []string `json:"changed,omitempty"`
+	// Conflicts are local target keys colliding with the source, as the merge strategy sees them
+	Conflicts []string `json:"conflicts,omitempty"`
+	// LastSynced is when a sync last wrote the target
+	LastSynced string `json:"lastSynced,omitempty"`
+}
+
+// DiffServer answers "why isn't my config syncing" over HTTP. It computes the
+// diff with the reconciler's own merge and projection rules, without writing.
+// Callers authenticate with a bearer token and need get on the source, targets
+// they may not get are left out.
+type DiffServer struct {
+	Reconciler  *ConfigMapReconciler
+	BindAddress string
+	// Auth reviews the caller of each request
+	Auth *httpauth.Reviewer
+}
+
+// Start implements manager.Runnable
+func (s *DiffServer) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("diff")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(DiffPath, s.handleDiff)
+
+	server := &http.Server{
+		Addr:              s.BindAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("Starting diff server", "address", s.BindAddress)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *DiffServer) handleDiff(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeDiffResponse(w, http.StatusMethodNotAllowed, SourceDiff{Message: "only GET is supported"})
+		return
+	}
+
+	query := req.URL.Query()
+	resource := "configmaps"
+	if strings.EqualFold(query.Get("kind"), "secret") {
+		resource = "secrets"
+	}
+	user, status, err := s.Auth.AuthorizeUser(req.Context(), req, authorizationv1.ResourceAttributes{
+		Namespace: query.Get("namespace"),
+		Verb:      "get",
+		Resource:  resource,
+		Name:      query.Get("name"),
+	})
+	if err != nil {
+		writeDiffResponse(w, status, SourceDiff{Message: err.Error()})
+		return
+	}
+
+	status, diff := s.Reconciler.diffSource(req.Context(), query.Get("kind"), query.Get("namespace"), query.Get("name"))
+	diff = s.readableTargets(req.Context(), user, diff)
+	writeDiffResponse(w, status, diff)
+}
+
+// readableTargets leaves out the targets the caller may not get, their key
+// names aren't the caller's to see even if the source is
+func (s *DiffServer) readableTargets(ctx context.Context, user authenticationv1.UserInfo, diff SourceDiff) SourceDiff {
+	targets := diff.Targets[:0]
+	omitted := 0
+	for _, target := range diff.Targets {
+		allowed, _, err := s.Auth.Allowed(ctx, user, authorizationv1.ResourceAttributes{
+			Namespace: target.Namespace,
+			Verb:      "get",
+			Resource:  strings.ToLower(target.Kind) + "s",
+			Name:      target.Name,
+		})
+		if err != nil || !allowed {
+			omitted++
+			continue
+		}
+		targets = append(targets, target)
+	}
+	diff.Targets = targets
+	if omitted > 0 {
+		note := fmt.Sprintf("%d target(s) left out, the caller may not get them", omitted)
+		if diff.Message != "" {
+			note = diff.Message + "; " + note
+		}
+		diff.Message = note
+	}
+	return diff
+}
+
+func writeDiffResponse(w http.ResponseWriter, status int, diff SourceDiff) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(diff)
+}
+
+// diffSource computes the diff of a ConfigMap or Secret source. It returns the
+// HTTP status code and response body for the caller.
+func (r *ConfigMapReconciler) diffSource(ctx context.Context, kind, namespace, name string) (int, SourceDiff) {
+	if namespace == "" || name == "" {
+		return http.StatusBadRequest, SourceDiff{Message: "namespace and name are required"}
+	}
+
+	diff := SourceDiff{Source: fmt.Sprintf("%s/%s", namespace, name)}
+	var source *corev1.ConfigMap
+	var object client.Object
+	switch strings.ToLower(kind) {
+	case "", "configmap":
+		diff.Kind = "ConfigMap"
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, configMap); err != nil {
+			return diffGetError(diff, err)
+		}
+		source, object = configMap, configMap
+	case "secret":
+		diff.Kind = "Secret"
+		if r.SecretReader == nil {
+			diff.Message = "secret projection is disabled, start the controller with --enable-secret-projection"
+			return http.StatusUnprocessableEntity, diff
+		}
+		// Only Secrets with the sync label are cached
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+			return diffGetError(diff, err)
+		}
+		object = secret
+	default:
+		diff.Message = fmt.Sprintf("unknown kind %q, must be ConfigMap or Secret", kind)
+		return http.StatusBadRequest, diff
+	}
+
+	if _, exists := object.GetLabels()[SyncLabel]; !exists {
+		diff.Blocked = append(diff.Blocked, fmt.Sprintf("the source doesn't have the %s label", SyncLabel))
+	}
+
+	targetKind, keys, err := r.getProjection(object)
+	if err != nil {
+		diff.Blocked = append(diff.Blocked, fmt.Sprintf("invalid projection: %v", err))
+		return http.StatusOK, diff
+	}
+	diff.TargetKind = "ConfigMap"
+	if targetKind == ProjectToSecret {
+		diff.TargetKind = "Secret"
+	}
+	if secret, ok := object.(*corev1.Secret); ok {
+		// Secrets are compared through the view of their projected keys
+		source = projectedConfigMap(secret, keys)
+	}
+
+	if reason := syncLoopReason(source); reason != "" {
+		diff.Blocked = append(diff.Blocked, fmt.Sprintf("sync loop: %s", reason))
+	}
+	if isSyncPaused(source) {
+		diff.Blocked = append(diff.Blocked, fmt.Sprintf("the source is paused with %s", PausedAnnotation))
+	}
+	for _, violation := range r.syncLimits().Check(source) {
+		diff.Blocked = append(diff.Blocked, fmt.Sprintf("sync limits: %s", violation))
+	}
+
+	strategy, err := getMergeStrategy(source)
+	if err != nil {
+		diff.Blocked = append(diff.Blocked, err.Error())
+		return http.StatusOK, diff
+	}
+	if targetKind != ProjectToSecret {
+		diff.Strategy = strategy
+	}
+	if hasEncryptKeys(source) && r.Sealer == nil {
+		diff.Blocked = append(diff.Blocked, fmt.Sprintf("the source has %s but encryption is disabled", EncryptKeysAnnotation))
+	}
+
+	targetNamespaces := getTargetNamespaces(object)
+	if len(targetNamespaces) == 0 {
+		diff.Blocked = append(diff.Blocked, fmt.Sprintf("no target namespaces, set %s", TargetNamespaceAnnotation))
+		return http.StatusOK, diff
+	}
+	for _, targetNamespace := range targetNamespaces {
+		diff.Targets = append(diff.Targets, r.diffTarget(ctx, source, keys, diff.TargetKind, strategy, targetNamespace))
+	}
+	return http.StatusOK, diff
+}
+
+func diffGetError(diff SourceDiff, err error) (int, SourceDiff) {
+	if apierrors.IsNotFound(err) {
+		diff.Message = fmt.Sprintf("%s not found", diff.Kind)
+		if diff.Kind == "Secret" {
+			diff.Message += fmt.Sprintf(", only Secrets with the %s label are sources", SyncLabel)
+		}
+		return http.StatusNotFound, diff
+	}
+	diff.Message = fmt.Sprintf("failed to get %s: %v", diff.Kind, err)
+	return http.StatusInternalServerError, diff
+}
+
+// diffTarget compares a source with its target in one namespace
+func (r *ConfigMapReconciler) diffTarget(ctx context.Context, source *corev1.ConfigMap, keys []string, targetKind, strategy, targetNamespace string) TargetDiff {
+	diff := TargetDiff{Namespace: targetNamespace, Name: getTargetName(source), Kind: targetKind}
+
+	if r.Namespaces.Ignored(ctx, targetNamespace) {
+		diff.State = DiffNamespaceIgnored
+		diff.Message = "the target namespace is ignored by all controllers"
+		return diff
+	}
+
+	namespace := &corev1.Namespace{}
+	err := r.Get(ctx, client.ObjectKey{Name: targetNamespace}, namespace)
+	switch {
+	case apierrors.IsNotFound(err):
+		diff.State = DiffNamespaceMissing
+		diff.Message = "the target namespace doesn't exist"
+		if r.CreateNamespaces && createNamespaceRequested(source) {
+			diff.Message += ", it is created on the next sync"
+		}
+		return diff
+	case err != nil:
+		diff.State = DiffFailed
+		diff.Message = fmt.Sprintf("failed to get target namespace: %v", err)
+		return diff
+	case namespace.DeletionTimestamp != nil:
+		diff.State = DiffNamespaceMissing
+		diff.Message = "the target namespace is terminating"
+		return diff
+	}
+
+	if targetKind == "Secret" {
+		return r.diffSecretTarget(ctx, source, keys, diff)
+	}
+	return r.diffConfigMapTarget(ctx, source, strategy, diff)
+}
+
+func (r *ConfigMapReconciler) diffConfigMapTarget(ctx context.Context, source *corev1.ConfigMap, strategy string, diff TargetDiff) TargetDiff {
+	target := &corev1.ConfigMap{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: diff.Namespace, Name: diff.Name}, target)
+	if apierrors.IsNotFound(err) {
+		target = nil
+	} else if err != nil {
+		diff.State = DiffFailed
+		diff.Message = fmt.Sprintf("failed to get target: %v", err)
+		return diff
+	}
+
+	// Encrypted keys are compared with the values a sync would write, the
+	// stamp with the plain values. The diff never creates the keypair.
+	stamp := newSyncStamp(source, configMapValues(source))
+	source, sealedKeys, err := sealSource(ctx, r.Sealer.ReadOnly(), source, target, diff.Namespace)
+	if apierrors.IsNotFound(err) {
+		diff.State = DiffOutOfSync
+		diff.Message = "the encryption keypair doesn't exist yet, it is created on the next sync"
+		return diff
+	}
+	if err != nil {
+		diff.State = DiffFailed
+		diff.Message = err.Error()
+		return diff
+	}
+	sourceValues := configMapValues(source)
+
+	if target == nil {
+		diff.State = DiffTargetMissing
+		diff.SourceOnly = slices.Sorted(maps.Keys(sourceValues))
+		return diff
+	}
+
+	diff.SourceOnly, diff.TargetOnly, diff.Changed = diffValues(sourceValues, configMapValues(target))
+	diff.LastSynced = target.Annotations[LastSyncedAnnotation]
+	if isSyncSource(target) {
+		diff.State = DiffRejected
+		diff.Message = "the target is itself a sync source, it is never overwritten"
+		return diff
+	}
+
+	result := mergeConfigMaps(source, target, strategy)
+	diff.Conflicts = result.Conflicts
+	diff.State = DiffInSync
+	targetCopy := target.DeepCopy()
+	changed := applyMergeResult(targetCopy, result)
+	changed = applyEncryptedKeys(targetCopy, sealedKeys) || changed
+	changed = applyProtection(targetCopy, protectsTargets(source)) || changed
+	if changed || stamp.stale(target) || target.Annotations[SourceAnnotation] != fmt.Sprintf("%s/%s", source.Namespace, source.Name) {
+		diff.State = DiffOutOfSync
+	}
+	return diff
+}
+
+func (r *ConfigMapReconciler) diffSecretTarget(ctx context.Context, source *corev1.ConfigMap, keys []string, diff TargetDiff) TargetDiff {
+	data := projectedSecretData(source, keys)
+
+	// Target Secrets aren't cached
+	target := &corev1.Secret{}
+	err := r.SecretReader.Get(ctx, client.ObjectKey{Namespace: diff.Namespace, Name: diff.Name}, target)
+	if apierrors.IsNotFound(err) {
+		diff.State = DiffTargetMissing
+		diff.SourceOnly = slices.Sorted(maps.Keys(data))
+		return diff
+	} else if err != nil {
+		diff.State = DiffFailed
+		diff.Message = fmt.Sprintf("failed to get target: %v", err)
+		return diff
+	}
+
+	// Encrypted keys are compared with the values a sync would write
+	sealed, sealedKeys, err := sealedSecretData(ctx, r.Sealer.ReadOnly(), source, keys, target, diff.Namespace)
+	if apierrors.IsNotFound(err) {
+		diff.State = DiffOutOfSync
+		diff.Message = "the encryption keypair doesn't exist yet, it is created on the next sync"
+		return diff
+	}
+	if err != nil {
+		diff.State = DiffFailed
+		diff.Message = err.Error()
+		return diff
+	}
+
+	diff.SourceOnly, diff.TargetOnly, diff.Changed = diffValues(sealed, target.Data)
+	diff.LastSynced = target.Annotations[LastSyncedAnnotation]
+	if target.Annotations[SourceAnnotation] != fmt.Sprintf("%s/%s", source.Namespace, source.Name) {
+		diff.State = DiffRejected
+		diff.Message = "the target Secret was not created by this projection, it is never overwritten"
+		return diff
+	}
+
+	diff.State = DiffInSync
+	if !maps.EqualFunc(target.Data, mergeSecretData(target, sealed), bytes.Equal) ||
+		applyEncryptedKeys(target.DeepCopy(), sealedKeys) ||
+		target.Annotations[SyncedKeysAnnotation] != strings.Join(slices.Sorted(maps.Keys(data)), ",") ||
+		newSyncStamp(source, data).stale(target) {
+		diff.State = DiffOutOfSync
+	}
+	return diff
+}
+
+// configMapValues returns the Data and BinaryData of a ConfigMap as one map
+func configMapValues(configMap *corev1.ConfigMap) map[string][]byte {
+	values := make(map[string][]byte, len(configMap.Data)+len(configMap.BinaryData))
+	for key, value := range configMap.Data {
+		values[key] = []byte(value)
+	}
+	maps.Copy(values, configMap.BinaryData)
+	return values
+}
+
+// diffValues returns the sorted keys only in the source, only in the target
+// and with different values
+func diffValues(source, target map[string][]byte) ([]string, []string, []string) {
+	var sourceOnly, targetOnly, changed []string
+	for key, value := range source {
+		other, exists := target[key]
+		switch {
+		case !exists:
+			sourceOnly = append(sourceOnly, key)
+		case !bytes.Equal(value, other):
+			changed = append(changed, key)
+		}
+	}
+	for key := range target {
+		if _, exists := source[key]; !exists {
+			targetOnly = append(targetOnly, key)
+		}
+	}
+	slices.Sort(sourceOnly)
+	slices.Sort(targetOnly)
+	slices.Sort(changed)
+	return sourceOnly, targetOnly, changed
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Annotation on a source with comma separated keys that are encrypted in
+	// its ConfigMap targets
+	EncryptKeysAnnotation = "config-syncer/encrypt-keys"
+
+	// Annotation on a source with comma separated target namespaces that get
+	// the plain values of encrypted keys
+	TrustedNamespacesAnnotation = "config-syncer/trusted-namespaces"
+
+	// Annotation on a target listing its encrypted keys
+	EncryptedKeysAnnotation = "config-syncer/encrypted-keys"
+
+	// Prefix of encrypted values in targets
+	SealedValuePrefix = "config-syncer:sealed:v1:"
+
+	// Name of the Secret holding the controller's keypair
+	EncryptionKeySecretName = "config-syncer-encryption-key"
+
+	// Keys of the keypair Secret
+	PrivateKeyKey = "private-key.pem"
+	PublicKeyKey  = "public-key.pem"
+
+	// Size of the generated RSA key, the same sealed-secrets uses
+	EncryptionKeyBits = 4096
+
+	// Event reason for sources with encrypted keys while encryption is disabled
+	EncryptionUnavailableReason = "EncryptionUnavailable"
+)
+
+// Sealer encrypts values of sources for their targets, sealed-secrets style.
+// Each value is encrypted with a random AES-256-GCM key, which is encrypted
+// with the cluster's RSA public key. The target namespace, name and key are
+// bound to the RSA ciphertext as the OAEP label, so a sealed value copied to
+// another ConfigMap or key can't be decrypted there. Only the holder of the
+// private key, the controller or whoever may read its Secret, can decrypt.
+type Sealer struct {
+	// Reader reads the keypair Secret. It should bypass the cache, only the
+	// one Secret is needed.
+	Reader client.Reader
+	// Writer creates the keypair Secret when it doesn't exist. Nil only reads
+	// an existing keypair.
+	Writer client.Writer
+	// Namespace of the keypair Secret
+	Namespace string
+
+	mu  sync.Mutex
+	key *rsa.PrivateKey
+}
+
+// ReadOnly returns a sealer sharing the keypair of s that never creates it,
+// for callers that must not write, like the diff endpoint. A nil sealer stays nil.
+func (s *Sealer) ReadOnly() *Sealer {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &Sealer{Reader: s.Reader, Namespace: s.Namespace, key: s.key}
+}
+
+// privateKey returns the cluster's private key, loading or generating it on
+// first use
+func (s *Sealer) privateKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	key, err := s.loadKey(ctx)
+	if errors.IsNotFound(err) && s.Writer != nil {
+		key, err = s.createKey(ctx)
+		if errors.IsAlreadyExists(err) {
+			// Another replica created it first
+			key, err = s.loadKey(ctx)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.key = key
+	return key, nil
+}
+
+func (s *Sealer) loadKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	secret := &corev1.Secret{}
+	if err := s.Reader.Get(ctx, client.ObjectKey{Name: EncryptionKeySecretName, Namespace: s.Namespace}, secret); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(secret.Data[PrivateKeyKey])
+	if block == nil {
+		return nil, fmt.Errorf("secret %s/%s has no PEM encoded %s", s.Namespace, EncryptionKeySecretName, PrivateKeyKey)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s in secret %s/%s: %w", PrivateKeyKey, s.Namespace, EncryptionKeySecretName, err)
+	}
+	return key, nil
+}
+
+func (s *Sealer) createKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, EncryptionKeyBits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      EncryptionKeySecretName,
+			Namespace: s.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			PrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+			PublicKeyKey:  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}),
+		},
+	}
+	if err := s.Writer.Create(ctx, secret); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Seal encrypts a value for one key of a target ConfigMap
+func (s *Sealer) Seal(ctx context.Context, namespace, name, key string, value []byte) (string, error) {
+	privateKey, err := s.privateKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sessionKey := make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return "", err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &privateKey.PublicKey, sessionKey, sealLabel(namespace, name, key))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt session key: %w", err)
+	}
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return "", err
+	}
+
+	// The session key is used once, a zero nonce is safe
+	sealed := binary.BigEndian.AppendUint16(nil, uint16(len(encryptedKey)))
+	sealed = append(sealed, encryptedKey...)
+	sealed = gcm.Seal(sealed, make([]byte, gcm.NonceSize()), value, nil)
+	return SealedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unseal decrypts a value sealed for one key of a target ConfigMap
+func (s *Sealer) Unseal(ctx context.Context, namespace, name, key, value string) ([]byte, error) {
+	encoded, found := strings.CutPrefix(value, SealedValuePrefix)
+	if !found {
+		return nil, fmt.Errorf("value is not sealed")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed value: %w", err)
+	}
+	if len(sealed) < 2 || len(sealed) < 2+int(binary.BigEndian.Uint16(sealed)) {
+		return nil, fmt.Errorf("invalid sealed value: too short")
+	}
+	keyLength := int(binary.BigEndian.Uint16(sealed))
+	encryptedKey, ciphertext := sealed[2:2+keyLength], sealed[2+keyLength:]
+
+	privateKey, err := s.privateKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, encryptedKey, sealLabel(namespace, name, key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session key, the value was sealed for another key or cluster: %w", err)
+	}
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, make([]byte, gcm.NonceSize()), ciphertext, nil)
+}
+
+// sealLabel binds a sealed value to the target it was written to
+func sealLabel(namespace, name, key string) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%s", namespace, name, key))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// getEncryptKeys returns the sorted keys of a source that are encrypted in targetNamespace
+func getEncryptKeys(source client.Object, targetNamespace string) []string {
+	annotations := source.GetAnnotations()
+	for _, trusted := range strings.Split(annotations[TrustedNamespacesAnnotation], ",") {
+		if strings.TrimSpace(trusted) == targetNamespace {
+			return nil
+		}
+	}
+
+	var keys []string
+	for _, key := range strings.Split(annotations[EncryptKeysAnnotation], ",") {
+		if key = strings.TrimSpace(key); key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// hasEncryptKeys reports whether a source encrypts keys in any target
+func hasEncryptKeys(source client.Object) bool {
+	return strings.TrimSpace(source.GetAnnotations()[EncryptKeysAnnotation]) != ""
+}
+
+// sealSource returns the source as it is written to one target, with its
+// encrypted keys sealed with sealer, and the sealed keys. Sealed values
+// already in the target are kept while they still decrypt to the source
+// value, sealing is randomized and would update the target on every sync
+// otherwise.
+func sealSource(ctx context.Context, sealer *Sealer, source, target *corev1.ConfigMap, targetNamespace string) (*corev1.ConfigMap, []string, error) {
+	keys := getEncryptKeys(source, targetNamespace)
+	if len(keys) == 0 {
+		return source, nil, nil
+	}
+	if sealer == nil {
+		return nil, nil, fmt.Errorf("the source has %s but encryption is disabled", EncryptKeysAnnotation)
+	}
+
+	targetName := getTargetName(source)
+	sealed := source.DeepCopy()
+	var sealedKeys []string
+	for _, key := range keys {
+		if !hasKey(source, key) {
+			continue
+		}
+		value, exists := source.Data[key]
+		plain := []byte(value)
+		if !exists {
+			plain = source.BinaryData[key]
+		}
+
+		// Sealed values are text, binary values move to Data
+		delete(sealed.BinaryData, key)
+		if sealed.Data == nil {
+			sealed.Data = make(map[string]string)
+		}
+		sealedKeys = append(sealedKeys, key)
+
+		if target != nil {
+			current := target.Data[key]
+			if unsealed, err := sealer.Unseal(ctx, targetNamespace, targetName, key, current); err == nil && string(unsealed) == string(plain) {
+				sealed.Data[key] = current
+				continue
+			}
+		}
+		sealedValue, err := sealer.Seal(ctx, targetNamespace, targetName, key, plain)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt key %s: %w", key, err)
+		}
+		sealed.Data[key] = sealedValue
+	}
+	if len(sealed.BinaryData) == 0 {
+		sealed.BinaryData = nil
+	}
+	return sealed, sealedKeys, nil
+}
+
+// applyEncryptedKeys records the sealed keys of a target. It returns false
+// when the annotation is already up to date.
+func applyEncryptedKeys(target client.Object, sealedKeys []string) bool {
+	encrypted := strings.Join(sealedKeys, ",")
+	annotations := target.GetAnnotations()
+	if annotations[EncryptedKeysAnnotation] == encrypted {
+		return false
+	}
+	if encrypted == "" {
+		delete(annotations, EncryptedKeysAnnotation)
+		target.SetAnnotations(annotations)
+		return true
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[EncryptedKeysAnnotation] = encrypted
+	target.SetAnnotations(annotations)
+	return true
+}
@@ -0,0 +1,7 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/featuregate"
+
+// FeatureGates lists the features of this controller that can be toggled with
+// --feature-gates. The config syncer has no experimental features yet.
+var FeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{}
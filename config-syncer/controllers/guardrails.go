@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Default maximum size of all keys and values of a synced ConfigMap
+	DefaultMaxSyncBytes = 512 * 1024
+
+	// Default maximum number of keys of a synced ConfigMap
+	DefaultMaxSyncKeys = 256
+
+	// Annotation on sources rejected by the guardrails, holding why
+	RejectionReasonAnnotation = "config-syncer/rejection-reason"
+
+	// Event reasons
+	SyncRejectedReason = "SyncRejected"
+	SyncAcceptedReason = "SyncAccepted"
+)
+
+// SyncLimits are guardrails checked before a source ConfigMap is synced, so a
+// single source can't blow up target namespaces or spread secrets around
+type SyncLimits struct {
+	// MaxBytes limits the total size of all keys and values. 0 disables the check.
+	MaxBytes int
+	// MaxKeys limits the number of Data and BinaryData keys. 0 disables the check.
+	MaxKeys int
+	// ForbiddenKeyPatterns rejects sources with keys matching any pattern
+	ForbiddenKeyPatterns []*regexp.Regexp
+}
+
+// ParseKeyPatterns compiles a comma separated list of regular expressions
+func ParseKeyPatterns(value string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, expr := range strings.Split(value, ",") {
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", expr, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Check returns the guardrail violations of a source ConfigMap
+func (l SyncLimits) Check(configMap *corev1.ConfigMap) []string {
+	var violations []string
+
+	keys := make([]string, 0, len(configMap.Data)+len(configMap.BinaryData))
+	size := 0
+	for k, v := range configMap.Data {
+		keys = append(keys, k)
+		size += len(k) + len(v)
+	}
+	for k, v := range configMap.BinaryData {
+		keys = append(keys, k)
+		size += len(k) + len(v)
+	}
+	sort.Strings(keys)
+
+	if l.MaxKeys > 0 && len(keys) > l.MaxKeys {
+		violations = append(violations, fmt.Sprintf("%d keys exceed the limit of %d", len(keys), l.MaxKeys))
+	}
+
+	if l.MaxBytes > 0 && size > l.MaxBytes {
+		violations = append(violations, fmt.Sprintf("%d bytes exceed the limit of %d", size, l.MaxBytes))
+	}
+
+	for _, key := range keys {
+		for _, pattern := range l.ForbiddenKeyPatterns {
+			if pattern.MatchString(key) {
+				violations = append(violations, fmt.Sprintf("key %q matches forbidden pattern %q", key, pattern.String()))
+				break
+			}
+		}
+	}
+
+	return violations
+}
+
+// syncLimits returns the sync limits with the runtime overrides applied
+func (r *ConfigMapReconciler) syncLimits() SyncLimits {
+	limits := r.Limits
+	limits.MaxBytes = r.Config.Int(SettingMaxSyncBytes, limits.MaxBytes)
+	limits.MaxKeys = r.Config.Int(SettingMaxSyncKeys, limits.MaxKeys)
+	return limits
+}
+
+// reconcileGuardrails checks a source against the sync limits and records
+// rejections on the source. Each new rejection reason and the acceptance of a
+// previously rejected source emit an event. It returns whether syncing is allowed.
+func (r *ConfigMapReconciler) reconcileGuardrails(ctx context.Context, configMap *corev1.ConfigMap, log logr.Logger) (bool, error) {
+	violations := r.syncLimits().Check(configMap)
+	reason := strings.Join(violations, "; ")
+
+	reported, wasRejected := configMap.Annotations[RejectionReasonAnnotation]
+	if len(violations) == 0 && !wasRejected {
+		return true, nil
+	}
+	if len(violations) > 0 && wasRejected && reported == reason {
+		// Already reported
+		return false, nil
+	}
+
+	configMapCopy := configMap.DeepCopy()
+	if configMapCopy.Annotations == nil {
+		configMapCopy.Annotations = make(map[string]string)
+	}
+
+	eventReason := SyncAcceptedReason
+	eventType := corev1.EventTypeNormal
+	message := "Source is within sync limits again, syncing resumed"
+	if len(violations) > 0 {
+		configMapCopy.Annotations[RejectionReasonAnnotation] = reason
+		eventReason = SyncRejectedReason
+		eventType = corev1.EventTypeWarning
+		message = fmt.Sprintf("Source rejected by sync limits: %s", reason)
+	} else {
+		delete(configMapCopy.Annotations, RejectionReasonAnnotation)
+	}
+
+	if err := r.Update(ctx, configMapCopy); err != nil {
+		return false, err
+	}
+
+	if err := r.createSyncEvent(ctx, configMap, eventReason, message, eventType); err != nil {
+		// Don't fail the reconcile for event creation failure
+		log.Error(err, "Failed to create sync event", "configmap", configMap.Name, "reason", eventReason)
+	}
+
+	log.Info(message, "configmap", configMap.Name, "namespace", configMap.Namespace)
+	return len(violations) == 0, nil
+}
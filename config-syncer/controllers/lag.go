@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Default time a target may stay behind its source before it is reported
+	DefaultMaxSyncLag = 5 * time.Minute
+
+	// Default interval between two lag checks
+	DefaultLagCheckInterval = 30 * time.Second
+
+	// Event reason on the source of a target that stayed behind it
+	TargetLaggingReason = "TargetLagging"
+)
+
+// LagDetector periodically compares the content hash stamped on each target
+// with the content of its source, and reports targets that stayed behind
+// their source for longer than the maxSyncLag setting. Lag is counted from
+// the first check that saw the mismatch, so it is reported up to one
+// interval late. It only reads, syncing is left to the ConfigMapReconciler.
+type LagDetector struct {
+	Reconciler *ConfigMapReconciler
+	// MaxLag is overridden at runtime by the maxSyncLag setting, 0 disables the checks
+	MaxLag   time.Duration
+	Interval time.Duration
+
+	behind map[lagKey]*laggingTarget
+}
+
+// lagKey identifies a target, ConfigMap and Secret targets can share a name
+type lagKey struct {
+	kind string
+	types.NamespacedName
+}
+
+type laggingTarget struct {
+	since    time.Time
+	reported bool
+}
+
+// Start implements manager.Runnable
+func (d *LagDetector) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("lag-detector")
+
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultLagCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := d.check(ctx, log); err != nil {
+			log.Error(err, "Failed to check targets for sync lag")
+		}
+	}
+}
+
+// check compares every target with its source, updates the lag metrics and
+// records an event on the source of each target that newly exceeds the lag
+func (d *LagDetector) check(ctx context.Context, log logr.Logger) error {
+	maxLag := d.Reconciler.Config.Duration(SettingMaxSyncLag, d.MaxLag)
+	if maxLag <= 0 {
+		d.behind = nil
+		laggingTargets.Reset()
+		maxTargetLag.Set(0)
+		return nil
+	}
+
+	targets, err := d.listTargets(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	behind := make(map[lagKey]*laggingTarget)
+	lagging := make(map[string]int)
+	var longest time.Duration
+	for _, target := range targets {
+		key := lagKey{kind: "ConfigMap", NamespacedName: client.ObjectKeyFromObject(target)}
+		if _, ok := target.(*corev1.Secret); ok {
+			key.kind = "Secret"
+		}
+
+		source, hash, err := d.sourceOf(ctx, target)
+		if err != nil {
+			log.Error(err, "Failed to get source of target", "kind", key.kind, "target", key.Name, "namespace", key.Namespace)
+			continue
+		}
+		if source == nil {
+			continue
+		}
+		if target.GetAnnotations()[ContentHashAnnotation] == hash {
+			if state, exists := d.behind[key]; exists && state.reported {
+				log.Info("Target caught up with its source", "kind", key.kind, "target", key.Name, "namespace", key.Namespace)
+			}
+			continue
+		}
+
+		state, exists := d.behind[key]
+		if !exists {
+			state = &laggingTarget{since: now}
+		}
+		behind[key] = state
+		lag := now.Sub(state.since)
+		longest = max(longest, lag)
+		if lag < maxLag {
+			continue
+		}
+		lagging[key.Namespace]++
+
+		if !state.reported {
+			message := fmt.Sprintf("Target %s %s/%s has been behind the source for %s: %s",
+				key.kind, key.Namespace, key.Name, lag.Round(time.Second), syncedFrom(target, source))
+			log.Info("Target is lagging behind its source", "kind", key.kind, "target", key.Name, "namespace", key.Namespace,
+				"source", source.GetName(), "source-namespace", source.GetNamespace(), "lag", lag.Round(time.Second))
+			if err := d.Reconciler.createSyncEvent(ctx, source, TargetLaggingReason, message, corev1.EventTypeWarning); err != nil {
+				log.Error(err, "Failed to create sync event", "source", source.GetName(), "reason", TargetLaggingReason)
+			} else {
+				state.reported = true
+			}
+		}
+	}
+	d.behind = behind
+
+	laggingTargets.Reset()
+	for namespace, count := range lagging {
+		laggingTargets.WithLabelValues(namespace).Set(float64(count))
+	}
+	maxTargetLag.Set(longest.Seconds())
+	return nil
+}
+
+// listTargets returns the ConfigMap targets and, with Secret projection
+// enabled, the Secret targets
+func (d *LagDetector) listTargets(ctx context.Context) ([]client.Object, error) {
+	r := d.Reconciler
+	synced := client.MatchingLabels{SyncedLabel: "true"}
+
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMaps, synced); err != nil {
+		return nil, fmt.Errorf("failed to list target ConfigMaps: %w", err)
+	}
+	var targets []client.Object
+	for i := range configMaps.Items {
+		targets = append(targets, &configMaps.Items[i])
+	}
+
+	// Target Secrets aren't cached, they are listed in pages
+	if r.SecretReader != nil {
+		secrets := &corev1.SecretList{}
+		if err := throttle.ListPages(ctx, r.SecretReader, secrets, r.Backoff, synced); err != nil {
+			return nil, fmt.Errorf("failed to list target Secrets: %w", err)
+		}
+		for i := range secrets.Items {
+			targets = append(targets, &secrets.Items[i])
+		}
+	}
+	return targets, nil
+}
+
+// sourceOf returns the source of a target, as the view the sync copies from,
+// and the content hash a sync would stamp on the target. It returns a nil
+// source for targets their source no longer syncs to: deleted, unlabelled
+// and paused sources, sources pointing elsewhere and ignored namespaces.
+func (d *LagDetector) sourceOf(ctx context.Context, target client.Object) (*corev1.ConfigMap, string, error) {
+	r := d.Reconciler
+	namespace, name, found := strings.Cut(target.GetAnnotations()[SourceAnnotation], "/")
+	if !found || r.Namespaces.Ignored(ctx, target.GetNamespace()) {
+		return nil, "", nil
+	}
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+	_, targetIsSecret := target.(*corev1.Secret)
+
+	var source *corev1.ConfigMap
+	var values map[string][]byte
+	if target.GetAnnotations()[SourceKindAnnotation] == "Secret" {
+		// Only source Secrets are cached, and only with Secret projection enabled
+		if r.SecretReader == nil {
+			return nil, "", nil
+		}
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			return nil, "", client.IgnoreNotFound(err)
+		}
+		_, keys, err := r.getProjection(secret)
+		if err != nil {
+			return nil, "", nil
+		}
+		source = projectedConfigMap(secret, keys)
+		values = configMapValues(source)
+	} else {
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, key, configMap); err != nil {
+			return nil, "", client.IgnoreNotFound(err)
+		}
+		targetKind, keys, err := r.getProjection(configMap)
+		if err != nil || (targetKind == ProjectToSecret) != targetIsSecret {
+			return nil, "", nil
+		}
+		source = configMap
+		values = configMapValues(configMap)
+		if targetKind == ProjectToSecret {
+			values = projectedSecretData(configMap, keys)
+		}
+	}
+
+	if _, exists := source.Labels[SyncLabel]; !exists || isSyncPaused(source) {
+		return nil, "", nil
+	}
+	if getTargetName(source) != target.GetName() || !slices.Contains(getTargetNamespaces(source), target.GetNamespace()) {
+		return nil, "", nil
+	}
+	return source, contentHash(values), nil
+}
+
+// syncedFrom describes the source version a target was last synced from
+func syncedFrom(target client.Object, source *corev1.ConfigMap) string {
+	annotations := target.GetAnnotations()
+	resourceVersion := annotations[SourceResourceVersionAnnotation]
+	if resourceVersion == "" {
+		return fmt.Sprintf("it was never stamped by a sync, the source is at resourceVersion %s", source.ResourceVersion)
+	}
+	return fmt.Sprintf("it was last synced from resourceVersion %s at %s, the source is at resourceVersion %s",
+		resourceVersion, annotations[LastSyncedAnnotation], source.ResourceVersion)
+}
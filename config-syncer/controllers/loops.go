@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Annotation on sources refused because syncing them would create a
+	// loop, holding why
+	SyncLoopReasonAnnotation = "config-syncer/sync-loop-reason"
+
+	// Event reason for sources and targets refused to prevent a sync loop
+	SyncLoopRejectedReason = "SyncLoopRejected"
+)
+
+// syncLoopReason returns why a ConfigMap with the sync label must not be
+// treated as a source, or an empty string when it is a real source. Copies
+// created by the controller carry the synced label and the source annotation,
+// syncing them again would fan out exponentially.
+func syncLoopReason(configMap *corev1.ConfigMap) string {
+	if _, synced := configMap.Labels[SyncedLabel]; synced {
+		return fmt.Sprintf("it has the %s label, so it is a copy synced by this controller", SyncedLabel)
+	}
+	if source, exists := configMap.Annotations[SourceAnnotation]; exists {
+		return fmt.Sprintf("it is a copy of %s", source)
+	}
+	return ""
+}
+
+// isSyncSource reports whether a ConfigMap is a source of its own. Such a
+// ConfigMap is never overwritten as a target, its own targets would become
+// copies of copies.
+func isSyncSource(configMap *corev1.ConfigMap) bool {
+	return shouldSyncConfigMap(configMap) && syncLoopReason(configMap) == ""
+}
+
+// reconcileSyncLoop refuses copies that got the sync label and records the
+// refusal on the ConfigMap. The refusal and the acceptance of a ConfigMap that
+// is no longer a copy each emit one event. It returns whether syncing is allowed.
+func (r *ConfigMapReconciler) reconcileSyncLoop(ctx context.Context, configMap *corev1.ConfigMap, log logr.Logger) (bool, error) {
+	reason := syncLoopReason(configMap)
+
+	reported, wasRefused := configMap.Annotations[SyncLoopReasonAnnotation]
+	if reason == "" && !wasRefused {
+		return true, nil
+	}
+	if reason != "" && wasRefused && reported == reason {
+		// Already reported
+		return false, nil
+	}
+
+	configMapCopy := configMap.DeepCopy()
+	if configMapCopy.Annotations == nil {
+		configMapCopy.Annotations = make(map[string]string)
+	}
+
+	eventReason := SyncAcceptedReason
+	eventType := corev1.EventTypeNormal
+	message := "ConfigMap is no longer a synced copy, syncing it as a source"
+	if reason != "" {
+		configMapCopy.Annotations[SyncLoopReasonAnnotation] = reason
+		eventReason = SyncLoopRejectedReason
+		eventType = corev1.EventTypeWarning
+		message = fmt.Sprintf("Refusing to sync ConfigMap as a source to prevent a sync loop: %s. Remove the %s label", reason, SyncLabel)
+	} else {
+		delete(configMapCopy.Annotations, SyncLoopReasonAnnotation)
+	}
+
+	if err := r.Update(ctx, configMapCopy); err != nil {
+		return false, err
+	}
+
+	if err := r.createSyncEvent(ctx, configMap, eventReason, message, eventType); err != nil {
+		// Don't fail the reconcile for event creation failure
+		log.Error(err, "Failed to create sync event", "configmap", configMap.Name, "reason", eventReason)
+	}
+
+	log.Info(message, "configmap", configMap.Name, "namespace", configMap.Namespace)
+	return reason == "", nil
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Manifest describes the permissions of the config-syncer for the manifests subcommand
+func Manifest() manifests.Manifest {
+	return manifests.Manifest{
+		Controller: "config-syncer",
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete"}},
+			{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}},
+		},
+		FlagRules: flagRules,
+	}
+}
+
+// flagRules grants Secret access, namespace creation and access reviews only
+// to installs enabling the features that need them
+func flagRules(args []string) []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	if manifests.FlagSet(args, "enable-secret-projection") {
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "watch", "create", "update"}})
+	}
+	if manifests.FlagSet(args, "encryption-key-namespace") {
+		// The keypair Secret, generated on first use
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "create"}})
+	}
+	if manifests.FlagSet(args, "allow-namespace-creation") {
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"create"}})
+	}
+	if manifests.FlagSet(args, "diff-bind-address") {
+		// Callers of the diff endpoint
+		rules = append(rules,
+			rbacv1.PolicyRule{APIGroups: []string{"authentication.k8s.io"}, Resources: []string{"tokenreviews"}, Verbs: []string{"create"}},
+			rbacv1.PolicyRule{APIGroups: []string{"authorization.k8s.io"}, Resources: []string{"subjectaccessreviews"}, Verbs: []string{"create"}},
+		)
+	}
+	return rules
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Annotation on the source choosing how synced keys are merged into a target
+	// that already exists
+	MergeStrategyAnnotation = "config-syncer/merge-strategy"
+
+	// Merge strategies
+	// MergeReplaceAll makes the target an exact copy of the source (default)
+	MergeReplaceAll = "replace-all"
+	// MergePreferringSource keeps keys added to the target locally, but source
+	// values win when a local key collides with a source key
+	MergePreferringSource = "merge-preferring-source"
+	// MergePreferringTarget keeps keys added to the target locally, and local
+	// values win when they collide with a source key
+	MergePreferringTarget = "merge-preferring-target"
+
+	// Annotation on the target listing the keys owned by the source. Keys not
+	// listed were added locally.
+	SyncedKeysAnnotation = "config-syncer/synced-keys"
+
+	// Annotation on the target listing local keys colliding with source keys
+	ConflictingKeysAnnotation = "config-syncer/conflicting-keys"
+
+	// Event reasons
+	SyncConflictReason         = "SyncConflict"
+	InvalidMergeStrategyReason = "InvalidMergeStrategy"
+)
+
+// getMergeStrategy returns the merge strategy of a source ConfigMap
+func getMergeStrategy(configMap *corev1.ConfigMap) (string, error) {
+	strategy, exists := configMap.Annotations[MergeStrategyAnnotation]
+	if !exists || strategy == "" {
+		return MergeReplaceAll, nil
+	}
+
+	switch strategy {
+	case MergeReplaceAll, MergePreferringSource, MergePreferringTarget:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown merge strategy %q, must be one of %s, %s, %s",
+			strategy, MergeReplaceAll, MergePreferringSource, MergePreferringTarget)
+	}
+}
+
+// MergeResult is the desired content of a target ConfigMap
+type MergeResult struct {
+	Data       map[string]string
+	BinaryData map[string][]byte
+	// SyncedKeys are the keys holding the source value, sorted
+	SyncedKeys []string
+	// Conflicts are local target keys that collide with source keys, sorted
+	Conflicts []string
+}
+
+// mergeConfigMaps merges the source into an existing target with the given strategy
+func mergeConfigMaps(source, target *corev1.ConfigMap, strategy string) MergeResult {
+	owned := ownedKeys(source, target)
+	result := MergeResult{
+		Data:       make(map[string]string),
+		BinaryData: make(map[string][]byte),
+	}
+
+	// Local keys survive a merge
+	if strategy != MergeReplaceAll {
+		for key, value := range target.Data {
+			if !owned[key] {
+				result.Data[key] = value
+			}
+		}
+		for key, value := range target.BinaryData {
+			if !owned[key] {
+				result.BinaryData[key] = value
+			}
+		}
+	}
+
+	for _, key := range configMapKeys(source) {
+		local := !owned[key] && hasKey(target, key)
+		if local && !sameValue(source, target, key) {
+			result.Conflicts = append(result.Conflicts, key)
+			if strategy == MergePreferringTarget {
+				continue
+			}
+		}
+
+		// The source value wins, whether the key was local or not
+		delete(result.Data, key)
+		delete(result.BinaryData, key)
+		if value, exists := source.Data[key]; exists {
+			result.Data[key] = value
+		} else {
+			result.BinaryData[key] = source.BinaryData[key]
+		}
+		result.SyncedKeys = append(result.SyncedKeys, key)
+	}
+
+	// Replacing drops local keys, which is a conflict too
+	if strategy == MergeReplaceAll {
+		for _, key := range configMapKeys(target) {
+			if !owned[key] && !hasKey(source, key) {
+				result.Conflicts = append(result.Conflicts, key)
+			}
+		}
+		slices.Sort(result.Conflicts)
+	}
+
+	if len(result.Data) == 0 {
+		result.Data = nil
+	}
+	if len(result.BinaryData) == 0 {
+		result.BinaryData = nil
+	}
+	return result
+}
+
+// ownedKeys returns the target keys written by the source. Targets synced
+// before keys were tracked own the keys they share with the source.
+func ownedKeys(source, target *corev1.ConfigMap) map[string]bool {
+	owned := make(map[string]bool)
+
+	syncedKeys, tracked := target.Annotations[SyncedKeysAnnotation]
+	if tracked {
+		for _, key := range strings.Split(syncedKeys, ",") {
+			if key != "" {
+				owned[key] = true
+			}
+		}
+		return owned
+	}
+
+	if target.Annotations[SourceAnnotation] == fmt.Sprintf("%s/%s", source.Namespace, source.Name) {
+		for _, key := range configMapKeys(source) {
+			owned[key] = hasKey(target, key)
+		}
+	}
+	return owned
+}
+
+// configMapKeys returns the sorted Data and BinaryData keys
+func configMapKeys(configMap *corev1.ConfigMap) []string {
+	keys := slices.Collect(maps.Keys(configMap.Data))
+	keys = slices.AppendSeq(keys, maps.Keys(configMap.BinaryData))
+	slices.Sort(keys)
+	return keys
+}
+
+func hasKey(configMap *corev1.ConfigMap, key string) bool {
+	_, inData := configMap.Data[key]
+	_, inBinaryData := configMap.BinaryData[key]
+	return inData || inBinaryData
+}
+
+func sameValue(a, b *corev1.ConfigMap, key string) bool {
+	if value, exists := a.Data[key]; exists {
+		other, otherExists := b.Data[key]
+		return otherExists && value == other
+	}
+	other, otherExists := b.BinaryData[key]
+	return otherExists && bytes.Equal(a.BinaryData[key], other)
+}
+
+// applyMergeResult writes a merge result to the target. It returns false when
+// the target already matches.
+func applyMergeResult(target *corev1.ConfigMap, result MergeResult) bool {
+	syncedKeys := strings.Join(result.SyncedKeys, ",")
+	conflicts := strings.Join(result.Conflicts, ",")
+
+	if maps.Equal(target.Data, result.Data) &&
+		maps.EqualFunc(target.BinaryData, result.BinaryData, bytes.Equal) &&
+		annotationEquals(target, SyncedKeysAnnotation, syncedKeys) &&
+		annotationEquals(target, ConflictingKeysAnnotation, conflicts) {
+		return false
+	}
+
+	target.Data = result.Data
+	target.BinaryData = result.BinaryData
+	if target.Annotations == nil {
+		target.Annotations = make(map[string]string)
+	}
+	target.Annotations[SyncedKeysAnnotation] = syncedKeys
+	if conflicts != "" {
+		target.Annotations[ConflictingKeysAnnotation] = conflicts
+	} else {
+		delete(target.Annotations, ConflictingKeysAnnotation)
+	}
+	return true
+}
+
+// annotationEquals treats a missing annotation like an empty one, except for
+// the synced keys whose presence marks a tracked target
+func annotationEquals(configMap *corev1.ConfigMap, annotation, value string) bool {
+	current, exists := configMap.Annotations[annotation]
+	if annotation == SyncedKeysAnnotation && !exists {
+		return false
+	}
+	return current == value
+}
+
+// conflictMessage describes how conflicting keys were resolved
+func conflictMessage(target *corev1.ConfigMap, strategy string, conflicts []string) string {
+	resolution := "overwritten by the source"
+	switch {
+	case strategy == MergePreferringTarget:
+		resolution = "kept"
+	case strategy == MergeReplaceAll:
+		resolution = "overwritten or removed"
+	}
+	return fmt.Sprintf("Locally added keys %s in target %s/%s conflict with the source and were %s (%s)",
+		strings.Join(conflicts, ", "), target.Namespace, target.Name, resolution, strategy)
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Results of syncing a source to one target namespace
+const (
+	SyncResultCreated = "created"
+	SyncResultUpdated = "updated"
+	SyncResultSkipped = "skipped"
+	SyncResultFailed  = "failed"
+	// The target is itself a sync source and was left alone
+	SyncResultRejected = "rejected"
+	// The target namespace doesn't exist and wasn't created
+	SyncResultNamespaceMissing = "namespace-missing"
+)
+
+var (
+	targetSyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "config_syncer_target_syncs_total",
+		Help: "Number of syncs of a source ConfigMap to a target namespace by result (created, updated, skipped, failed, rejected, namespace-missing)",
+	}, []string{"source_namespace", "target_namespace", "result"})
+
+	targetSyncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "config_syncer_target_sync_errors_total",
+		Help: "Number of failed syncs to a target namespace by API error type (e.g. Forbidden, Conflict, Invalid)",
+	}, []string{"target_namespace", "error_type"})
+
+	protectedTargetRecreations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "config_syncer_protected_target_recreations_total",
+		Help: "Number of protected target ConfigMaps re-created after they were deleted",
+	}, []string{"target_namespace"})
+
+	laggingTargets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "config_syncer_lagging_targets",
+		Help: "Number of targets that stayed behind their source for longer than maxSyncLag",
+	}, []string{"target_namespace"})
+
+	maxTargetLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "config_syncer_max_target_lag_seconds",
+		Help: "Longest time a target has stayed behind its source, 0 when all targets are in sync",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(targetSyncs, targetSyncErrors, protectedTargetRecreations, laggingTargets, maxTargetLag)
+}
+
+// recordTargetSync counts the result of syncing to one target namespace
+func recordTargetSync(sourceNamespace, targetNamespace, result string, err error) {
+	targetSyncs.WithLabelValues(sourceNamespace, targetNamespace, result).Inc()
+	if err != nil && result == SyncResultFailed {
+		targetSyncErrors.WithLabelValues(targetNamespace, syncErrorType(err)).Inc()
+	}
+}
+
+// syncErrorType classifies an error by its API status reason. Errors that
+// didn't come from the API server are reported as Unknown.
+func syncErrorType(err error) string {
+	if reason := errors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+		return string(reason)
+	}
+	return "Unknown"
+}
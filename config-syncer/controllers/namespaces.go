@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Annotation on a source to create missing target namespaces. Only honored
+	// when the controller runs with --allow-namespace-creation.
+	CreateNamespaceAnnotation = "config-syncer/create-namespace"
+
+	// Annotation on a source with comma separated key=value labels of the
+	// target namespaces it creates
+	NamespaceLabelsAnnotation = "config-syncer/namespace-labels"
+
+	// Annotation the controller uses to list the missing target namespaces of a source
+	MissingNamespacesAnnotation = "config-syncer/missing-namespaces"
+
+	// Sources with missing target namespaces are synced again after this
+	// interval, namespaces aren't watched
+	MissingNamespaceRequeue = 5 * time.Minute
+
+	// Event reasons
+	NamespaceCreatedReason       = "NamespaceCreated"
+	TargetNamespaceMissingReason = "TargetNamespaceMissing"
+	InvalidNamespaceLabelsReason = "InvalidNamespaceLabels"
+)
+
+// createNamespaceRequested reports whether a source asks for its missing
+// target namespaces to be created
+func createNamespaceRequested(source client.Object) bool {
+	create, _ := strconv.ParseBool(source.GetAnnotations()[CreateNamespaceAnnotation])
+	return create
+}
+
+// Label key prefixes sources may not set on the namespaces they create. They
+// belong to Kubernetes, like the Pod Security admission levels of
+// pod-security.kubernetes.io, or to the controllers of this repository.
+var reservedNamespaceLabelPrefixes = []string{"kubernetes.io", "k8s.io", "controller.example.com", "config-syncer"}
+
+// reservedNamespaceLabel reports whether a label key has a reserved prefix or
+// a subdomain of one
+func reservedNamespaceLabel(key string) bool {
+	prefix, _, found := strings.Cut(key, "/")
+	if !found {
+		return false
+	}
+	for _, reserved := range reservedNamespaceLabelPrefixes {
+		if prefix == reserved || strings.HasSuffix(prefix, "."+reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// getNamespaceLabels parses the labels of the target namespaces a source
+// creates. Keys with a reserved prefix, and with an allowlist keys not on it,
+// reject the labels.
+func getNamespaceLabels(source client.Object, allowed []string) (map[string]string, error) {
+	value := source.GetAnnotations()[NamespaceLabelsAnnotation]
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid %s annotation: %q is not a key=value pair", NamespaceLabelsAnnotation, pair)
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid %s annotation: label key %q: %s", NamespaceLabelsAnnotation, key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(val); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid %s annotation: label value %q: %s", NamespaceLabelsAnnotation, val, strings.Join(errs, "; "))
+		}
+		if reservedNamespaceLabel(key) {
+			return nil, fmt.Errorf("invalid %s annotation: label key %q has a reserved prefix", NamespaceLabelsAnnotation, key)
+		}
+		if len(allowed) > 0 && !slices.Contains(allowed, key) {
+			return nil, fmt.Errorf("invalid %s annotation: label key %q is not allowed, allowed keys are %s", NamespaceLabelsAnnotation, key, strings.Join(allowed, ", "))
+		}
+		labels[key] = val
+	}
+	return labels, nil
+}
+
+// ensureTargetNamespace checks that a target namespace exists, creating it when
+// both the source and the controller allow it. It returns false for missing and
+// terminating namespaces, which are reported on the source instead of failing
+// the sync of the other targets.
+func (r *ConfigMapReconciler) ensureTargetNamespace(ctx context.Context, source client.Object, targetNamespace string, log logr.Logger) (bool, error) {
+	namespace := &corev1.Namespace{}
+	err := r.Get(ctx, client.ObjectKey{Name: targetNamespace}, namespace)
+	if err == nil {
+		return namespace.DeletionTimestamp == nil, nil
+	}
+	if !errors.IsNotFound(err) {
+		return false, err
+	}
+	if !r.CreateNamespaces || !createNamespaceRequested(source) {
+		return false, nil
+	}
+
+	labels, err := getNamespaceLabels(source, r.AllowedNamespaceLabels)
+	if err != nil {
+		log.Info("Invalid namespace labels, not creating target namespace", "source", source.GetName(), "target-namespace", targetNamespace, "error", err.Error())
+		if err := r.createSyncEvent(ctx, source, InvalidNamespaceLabelsReason, err.Error(), corev1.EventTypeWarning); err != nil {
+			log.Error(err, "Failed to create sync event", "source", source.GetName(), "reason", InvalidNamespaceLabelsReason)
+		}
+		return false, nil
+	}
+
+	namespace = &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   targetNamespace,
+			Labels: labels,
+			Annotations: map[string]string{
+				SourceAnnotation: fmt.Sprintf("%s/%s", source.GetNamespace(), source.GetName()),
+			},
+		},
+	}
+	log.Info("Creating target namespace", "source", source.GetName(), "target-namespace", targetNamespace, "labels", labels)
+	if err := r.Create(ctx, namespace); err != nil && !errors.IsAlreadyExists(err) {
+		return false, err
+	}
+
+	message := fmt.Sprintf("Created target namespace %s", targetNamespace)
+	if err := r.createSyncEvent(ctx, source, NamespaceCreatedReason, message, corev1.EventTypeNormal); err != nil {
+		// Don't fail the sync for event creation failure
+		log.Error(err, "Failed to create sync event", "source", source.GetName(), "reason", NamespaceCreatedReason)
+	}
+	return true, nil
+}
+
+// reportMissingNamespaces records the missing target namespaces of a source.
+// ConfigMap sources list them in an annotation and get an event when a
+// namespace goes missing. The controller never writes to source Secrets, so
+// they get an event on every sync.
+func (r *ConfigMapReconciler) reportMissingNamespaces(ctx context.Context, source client.Object, missing []string, log logr.Logger) error {
+	configMap, writable := source.(*corev1.ConfigMap)
+	writable = writable && sourceKind(source) == "ConfigMap"
+
+	var reported []string
+	if writable {
+		if value := source.GetAnnotations()[MissingNamespacesAnnotation]; value != "" {
+			reported = strings.Split(value, ",")
+		}
+	}
+
+	for _, targetNamespace := range missing {
+		if slices.Contains(reported, targetNamespace) {
+			continue
+		}
+		message := fmt.Sprintf("Target namespace %s does not exist, not syncing to it. Create it, or set %s=true on the source if the controller allows namespace creation.",
+			targetNamespace, CreateNamespaceAnnotation)
+		if err := r.createSyncEvent(ctx, source, TargetNamespaceMissingReason, message, corev1.EventTypeWarning); err != nil {
+			// Don't fail the sync for event creation failure
+			log.Error(err, "Failed to create sync event", "source", source.GetName(), "reason", TargetNamespaceMissingReason)
+		}
+	}
+
+	if !writable || slices.Equal(reported, missing) {
+		return nil
+	}
+
+	// Patch, the source may already have been updated during this reconcile
+	configMapCopy := configMap.DeepCopy()
+	if configMapCopy.Annotations == nil {
+		configMapCopy.Annotations = make(map[string]string)
+	}
+	if len(missing) > 0 {
+		configMapCopy.Annotations[MissingNamespacesAnnotation] = strings.Join(missing, ",")
+	} else {
+		delete(configMapCopy.Annotations, MissingNamespacesAnnotation)
+	}
+	return r.Patch(ctx, configMapCopy, client.MergeFrom(configMap))
+}
@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-logr/logr"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Annotation on a source choosing the kind of its targets. Secrets are only
+	// synced with "configmap", ConfigMaps are projected into Secrets with "secret".
+	ProjectToAnnotation = "config-syncer/project-to"
+	ProjectToConfigMap  = "configmap"
+	ProjectToSecret     = "secret"
+
+	// Annotation on a projected source with the comma separated keys that are
+	// copied. Keys not listed never leave the source.
+	ProjectKeysAnnotation = "config-syncer/project-keys"
+
+	// Event reasons
+	InvalidProjectionReason  = "InvalidProjection"
+	ProjectionRejectedReason = "ProjectionRejected"
+)
+
+// SourceSecretSelector selects the Secrets the manager caches. Only sources
+// carry the sync label, so the Secrets of the whole cluster aren't kept in memory.
+func SourceSecretSelector() (labels.Selector, error) {
+	requirement, err := labels.NewRequirement(SyncLabel, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	return labels.NewSelector().Add(*requirement), nil
+}
+
+// projectsToSecret reports whether a source is a ConfigMap projected into Secrets
+func projectsToSecret(source client.Object) bool {
+	return sourceKind(source) == "ConfigMap" && source.GetAnnotations()[ProjectToAnnotation] == ProjectToSecret
+}
+
+// getProjection returns the target kind of a projected source and the keys it
+// may project, sorted. ConfigMaps that aren't projected return an empty kind,
+// they sync all keys into ConfigMaps.
+func (r *ConfigMapReconciler) getProjection(source client.Object) (string, []string, error) {
+	kind := sourceKind(source)
+	want := ProjectToSecret
+	if kind == "Secret" {
+		want = ProjectToConfigMap
+	}
+
+	targetKind, projected := source.GetAnnotations()[ProjectToAnnotation]
+	if !projected && kind == "ConfigMap" {
+		return "", nil, nil
+	}
+	if targetKind != want {
+		return "", nil, fmt.Errorf("%s must be %q on a %s, got %q", ProjectToAnnotation, want, kind, targetKind)
+	}
+	if r.SecretReader == nil {
+		return "", nil, fmt.Errorf("secret projection is disabled, start the controller with --enable-secret-projection")
+	}
+
+	var keys []string
+	for _, key := range strings.Split(source.GetAnnotations()[ProjectKeysAnnotation], ",") {
+		if key = strings.TrimSpace(key); key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "", nil, fmt.Errorf("%s must list the keys to project, projections need an explicit allow-list", ProjectKeysAnnotation)
+	}
+	slices.Sort(keys)
+	return targetKind, keys, nil
+}
+
+// projectedConfigMap returns the allowed keys of a Secret as a source
+// ConfigMap. Values that are valid UTF-8 go to data, others to binaryData. The
+// view keeps the Secret kind, so events about it are recorded on the Secret.
+func projectedConfigMap(secret *corev1.Secret, keys []string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: *secret.ObjectMeta.DeepCopy(),
+	}
+	for _, key := range keys {
+		value, exists := secret.Data[key]
+		if !exists {
+			continue
+		}
+		if utf8.Valid(value) {
+			if configMap.Data == nil {
+				configMap.Data = make(map[string]string)
+			}
+			configMap.Data[key] = string(value)
+		} else {
+			if configMap.BinaryData == nil {
+				configMap.BinaryData = make(map[string][]byte)
+			}
+			configMap.BinaryData[key] = value
+		}
+	}
+	return configMap
+}
+
+// projectedSecretData returns the allowed keys of a ConfigMap as Secret data
+func projectedSecretData(configMap *corev1.ConfigMap, keys []string) map[string][]byte {
+	data := make(map[string][]byte)
+	for _, key := range keys {
+		if value, exists := configMap.Data[key]; exists {
+			data[key] = []byte(value)
+		} else if value, exists := configMap.BinaryData[key]; exists {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// sealedSecretData returns the allowed keys of a ConfigMap as they are written
+// to a target Secret, with its encrypted keys sealed like in ConfigMap
+// targets, and the sealed keys. target is nil when the Secret doesn't exist yet.
+func sealedSecretData(ctx context.Context, sealer *Sealer, configMap *corev1.ConfigMap, keys []string, target *corev1.Secret, targetNamespace string) (map[string][]byte, []string, error) {
+	projected := configMap.DeepCopy()
+	projected.Data = nil
+	projected.BinaryData = projectedSecretData(configMap, keys)
+
+	var current *corev1.ConfigMap
+	if target != nil {
+		current = &corev1.ConfigMap{Data: make(map[string]string, len(target.Data))}
+		for key, value := range target.Data {
+			current.Data[key] = string(value)
+		}
+	}
+
+	sealed, sealedKeys, err := sealSource(ctx, sealer, projected, current, targetNamespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return configMapValues(sealed), sealedKeys, nil
+}
+
+// reconcileSecret projects the allowed keys of a labelled Secret into target
+// ConfigMaps. The controller never writes to source Secrets, so paused,
+// looping and rejected projections are only reported with events.
+func (r *ConfigMapReconciler) reconcileSecret(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// Only Secrets with the sync label are cached
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, req.NamespacedName, secret); err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Secret not found. Skipping reconciliation", "secret", req.Name, "namespace", req.Namespace)
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Secret", "secret", req.Name, "namespace", req.Namespace)
+		return ctrl.Result{}, err
+	}
+	if _, exists := secret.Labels[SyncLabel]; !exists {
+		return ctrl.Result{}, nil
+	}
+
+	_, keys, err := r.getProjection(secret)
+	if err != nil {
+		log.Info("Invalid projection, skipping", "secret", secret.Name, "namespace", secret.Namespace, "error", err.Error())
+		r.createProjectionEvent(ctx, secret, InvalidProjectionReason, err.Error(), log)
+		return ctrl.Result{}, nil
+	}
+	source := projectedConfigMap(secret, keys)
+
+	// Secrets projected from a ConfigMap must not be projected back
+	if reason := syncLoopReason(source); reason != "" {
+		message := fmt.Sprintf("Refusing to project Secret to prevent a sync loop: %s. Remove the %s label", reason, SyncLabel)
+		r.createProjectionEvent(ctx, secret, SyncLoopRejectedReason, message, log)
+		return ctrl.Result{}, nil
+	}
+
+	if isSyncPaused(source) {
+		log.Info("Sync paused for Secret, skipping", "secret", secret.Name, "namespace", secret.Namespace)
+		return ctrl.Result{}, nil
+	}
+
+	// The guardrails only see the projected keys
+	if violations := r.syncLimits().Check(source); len(violations) > 0 {
+		message := fmt.Sprintf("Projection rejected by sync limits: %s", strings.Join(violations, "; "))
+		r.createProjectionEvent(ctx, secret, SyncRejectedReason, message, log)
+		return ctrl.Result{}, nil
+	}
+
+	targetNamespaces := getTargetNamespaces(secret)
+	if len(targetNamespaces) == 0 {
+		log.Info("No target namespaces specified, skipping", "secret", secret.Name, "namespace", secret.Namespace)
+		return ctrl.Result{}, nil
+	}
+
+	strategy, err := getMergeStrategy(source)
+	if err != nil {
+		log.Info("Invalid merge strategy, skipping", "secret", secret.Name, "namespace", secret.Namespace, "error", err.Error())
+		r.createProjectionEvent(ctx, secret, InvalidMergeStrategyReason, err.Error(), log)
+		return ctrl.Result{}, nil
+	}
+
+	// Never write values that should be encrypted in plain text
+	if hasEncryptKeys(source) && r.Sealer == nil {
+		message := fmt.Sprintf("Source has %s but the controller runs without --encryption-key-namespace, not projecting", EncryptKeysAnnotation)
+		r.createProjectionEvent(ctx, secret, EncryptionUnavailableReason, message, log)
+		return ctrl.Result{}, nil
+	}
+
+	sync := func(targetNamespace string) (string, error) {
+		return r.syncConfigMap(ctx, source, targetNamespace, strategy, log)
+	}
+	missing, err := r.syncTargets(ctx, source, targetNamespaces, sync, log)
+	if err != nil {
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if missing {
+		log.Info("Projected Secret, some target namespaces are missing", "secret", secret.Name, "namespace", secret.Namespace)
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(MissingNamespaceRequeue)}, nil
+	}
+
+	log.Info("Successfully projected Secret", "secret", secret.Name, "namespace", secret.Namespace, "keys", keys, "target-namespaces", targetNamespaces)
+	return ctrl.Result{}, nil
+}
+
+// createProjectionEvent records a warning on a source Secret
+func (r *ConfigMapReconciler) createProjectionEvent(ctx context.Context, secret *corev1.Secret, reason, message string, log logr.Logger) {
+	if err := r.createSyncEvent(ctx, secret, reason, message, corev1.EventTypeWarning); err != nil {
+		// Don't fail the reconcile for event creation failure
+		log.Error(err, "Failed to create sync event", "secret", secret.Name, "reason", reason)
+	}
+}
+
+// syncSecret projects the allowed keys of a source ConfigMap into a target
+// Secret. Only Secrets created by the same projection are updated: the keys
+// it owns are replaced and keys added to the Secret otherwise are kept.
+func (r *ConfigMapReconciler) syncSecret(ctx context.Context, sourceConfigMap *corev1.ConfigMap, keys []string, targetNamespace string, log logr.Logger) (string, error) {
+	targetName := getTargetName(sourceConfigMap)
+	source := fmt.Sprintf("%s/%s", sourceConfigMap.Namespace, sourceConfigMap.Name)
+	// Targets are stamped with the plain projected values, before encryption
+	plain := projectedSecretData(sourceConfigMap, keys)
+	syncedKeys := strings.Join(slices.Sorted(maps.Keys(plain)), ",")
+	stamp := newSyncStamp(sourceConfigMap, plain)
+
+	// Target Secrets aren't cached
+	targetSecret := &corev1.Secret{}
+	err := r.SecretReader.Get(ctx, client.ObjectKey{Name: targetName, Namespace: targetNamespace}, targetSecret)
+	if errors.IsNotFound(err) {
+		data, sealedKeys, err := sealedSecretData(ctx, r.Sealer, sourceConfigMap, keys, nil, targetNamespace)
+		if err != nil {
+			return SyncResultFailed, err
+		}
+		targetSecret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      targetName,
+				Namespace: targetNamespace,
+				Labels: map[string]string{
+					SyncedLabel: "true",
+				},
+				Annotations: map[string]string{
+					SourceAnnotation:     source,
+					SyncedKeysAnnotation: syncedKeys,
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		}
+		applyEncryptedKeys(targetSecret, sealedKeys)
+		stamp.apply(targetSecret)
+		log.Info("Creating target Secret", "name", targetName, "namespace", targetNamespace, "source", sourceConfigMap.Name)
+		if err := r.Create(ctx, targetSecret); err != nil {
+			return SyncResultFailed, err
+		}
+		return SyncResultCreated, nil
+	} else if err != nil {
+		return SyncResultFailed, err
+	}
+
+	// Never take over a Secret the projection didn't create
+	if targetSecret.Annotations[SourceAnnotation] != source {
+		return SyncResultRejected, fmt.Errorf("target Secret was not created by this projection, refusing to overwrite it")
+	}
+
+	data, sealedKeys, err := sealedSecretData(ctx, r.Sealer, sourceConfigMap, keys, targetSecret, targetNamespace)
+	if err != nil {
+		return SyncResultFailed, err
+	}
+
+	targetCopy := targetSecret.DeepCopy()
+	targetCopy.Data = mergeSecretData(targetSecret, data)
+	encryptedChanged := applyEncryptedKeys(targetCopy, sealedKeys)
+
+	if maps.EqualFunc(targetSecret.Data, targetCopy.Data, bytes.Equal) && !encryptedChanged &&
+		targetSecret.Annotations[SyncedKeysAnnotation] == syncedKeys && !stamp.stale(targetSecret) {
+		log.Info("Target Secret is up to date, skipping update", "name", targetName, "namespace", targetNamespace)
+		return SyncResultSkipped, nil
+	}
+	targetCopy.Annotations[SyncedKeysAnnotation] = syncedKeys
+	stamp.apply(targetCopy)
+
+	log.Info("Updating target Secret", "name", targetName, "namespace", targetNamespace, "source", sourceConfigMap.Name)
+	if err := r.Update(ctx, targetCopy); err != nil {
+		return SyncResultFailed, err
+	}
+	return SyncResultUpdated, nil
+}
+
+// mergeSecretData returns the data of a target Secret with the keys owned by
+// the projection replaced by data. Keys added to the Secret otherwise are kept.
+func mergeSecretData(targetSecret *corev1.Secret, data map[string][]byte) map[string][]byte {
+	merged := maps.Clone(targetSecret.Data)
+	for _, key := range strings.Split(targetSecret.Annotations[SyncedKeysAnnotation], ",") {
+		delete(merged, key)
+	}
+	if merged == nil {
+		merged = make(map[string][]byte)
+	}
+	maps.Copy(merged, data)
+	return merged
+}
+
+// setupSecretProjection watches source Secrets when Secret projection is enabled
+func (r *ConfigMapReconciler) setupSecretProjection(mgr ctrl.Manager) error {
+	if r.SecretReader == nil {
+		return nil
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Secret{}).
+		Named("secret-projection").
+		WithEventFilter(r.Namespaces.Predicate()).
+		Complete(recovery.Wrap("secret-projection", reconcile.Func(r.reconcileSecret)))
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Annotation on a ConfigMap source whose targets are re-created as soon as
+	// they are deleted. The controller copies it onto the targets.
+	ProtectedAnnotation = "config-syncer/protected"
+
+	// Event reason on the source and the re-created target when a protected
+	// target was deleted
+	ProtectedTargetDeletedReason = "ProtectedTargetDeleted"
+)
+
+func isProtected(obj client.Object) bool {
+	protected, _ := strconv.ParseBool(obj.GetAnnotations()[ProtectedAnnotation])
+	return protected
+}
+
+// protectsTargets reports whether the ConfigMap targets of a source are
+// protected. Secret sources can't be enqueued from a deleted ConfigMap, their
+// targets are re-created on their next sync.
+func protectsTargets(source client.Object) bool {
+	return sourceKind(source) == "ConfigMap" && isProtected(source)
+}
+
+// applyProtection copies the protected annotation of a source onto a target.
+// It returns whether the target changed.
+func applyProtection(target *corev1.ConfigMap, protected bool) bool {
+	if protected == isProtected(target) {
+		return false
+	}
+	if protected {
+		if target.Annotations == nil {
+			target.Annotations = make(map[string]string)
+		}
+		target.Annotations[ProtectedAnnotation] = "true"
+	} else {
+		delete(target.Annotations, ProtectedAnnotation)
+	}
+	return true
+}
+
+// deletedTargets remembers the protected targets that were deleted, by their
+// source, until they are re-created
+type deletedTargets struct {
+	mutex   sync.Mutex
+	targets map[types.NamespacedName]types.NamespacedName
+}
+
+func (d *deletedTargets) add(target, source types.NamespacedName) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.targets == nil {
+		d.targets = make(map[types.NamespacedName]types.NamespacedName)
+	}
+	d.targets[target] = source
+}
+
+// take reports whether a target was deleted and forgets it
+func (d *deletedTargets) take(target types.NamespacedName) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, deleted := d.targets[target]
+	delete(d.targets, target)
+	return deleted
+}
+
+// forgetSource drops the deleted targets of a source that no longer exists
+func (d *deletedTargets) forgetSource(source types.NamespacedName) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	maps.DeleteFunc(d.targets, func(_, targetSource types.NamespacedName) bool {
+		return targetSource == source
+	})
+}
+
+// enqueueSourceOfDeletedTarget enqueues the source of a deleted protected
+// target, so the target is re-created right away instead of on the next
+// change of the source
+func (r *ConfigMapReconciler) enqueueSourceOfDeletedTarget() handler.EventHandler {
+	return handler.Funcs{
+		DeleteFunc: func(_ context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			if !isProtected(e.Object) {
+				return
+			}
+			if _, synced := e.Object.GetLabels()[SyncedLabel]; !synced {
+				return
+			}
+			namespace, name, found := strings.Cut(e.Object.GetAnnotations()[SourceAnnotation], "/")
+			if !found {
+				return
+			}
+			source := types.NamespacedName{Namespace: namespace, Name: name}
+			r.deleted.add(client.ObjectKeyFromObject(e.Object), source)
+			q.Add(reconcile.Request{NamespacedName: source})
+		},
+	}
+}
+
+// reportProtectedTargetDeleted records a re-created protected target with a
+// warning event on the source and on the target
+func (r *ConfigMapReconciler) reportProtectedTargetDeleted(ctx context.Context, source, target client.Object, log logr.Logger) {
+	protectedTargetRecreations.WithLabelValues(target.GetNamespace()).Inc()
+	log.Info("Re-created deleted protected target", "source", source.GetName(), "target", target.GetName(), "target-namespace", target.GetNamespace())
+
+	r.createProtectionEvent(ctx, source, fmt.Sprintf("Protected target ConfigMap %s/%s was deleted and has been re-created",
+		target.GetNamespace(), target.GetName()), log)
+	r.createProtectionEvent(ctx, target, fmt.Sprintf("Re-created after it was deleted, the ConfigMap is protected by its source %s/%s",
+		source.GetNamespace(), source.GetName()), log)
+}
+
+func (r *ConfigMapReconciler) createProtectionEvent(ctx context.Context, obj client.Object, message string, log logr.Logger) {
+	if err := r.createSyncEvent(ctx, obj, ProtectedTargetDeletedReason, message, corev1.EventTypeWarning); err != nil {
+		// Don't fail the sync for event creation failure
+		log.Error(err, "Failed to create sync event", "configmap", obj.GetName(), "reason", ProtectedTargetDeletedReason)
+	}
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SelfTest creates a source ConfigMap syncing into the same namespace under
+// another name and waits until the copy exists with the source data
+func SelfTest() selftest.Test {
+	return selftest.Test{
+		Controller: "config-syncer",
+		Reconciler: "configmap",
+		Setup: func(ctx context.Context, env *selftest.Env) error {
+			return env.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      env.Name,
+					Namespace: env.Namespace,
+					Labels:    map[string]string{SyncLabel: "true"},
+					Annotations: map[string]string{
+						TargetNamespaceAnnotation: env.Namespace,
+						TargetNameAnnotation:      env.Name + "-copy",
+					},
+				},
+				Data: map[string]string{"selftest": env.Name},
+			})
+		},
+		Verify: func(ctx context.Context, env *selftest.Env) error {
+			target := &corev1.ConfigMap{}
+			if err := env.Client.Get(ctx, client.ObjectKey{Name: env.Name + "-copy", Namespace: env.Namespace}, target); err != nil {
+				return err
+			}
+			env.Track(target)
+			if target.Data["selftest"] != env.Name {
+				return fmt.Errorf("target ConfigMap %s does not have the source data yet", target.Name)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/controllerconfig"
+
+// Settings that can be changed at runtime through the config-syncer ControllerConfig
+const (
+	SettingMaxSyncBytes = "maxSyncBytes"
+	SettingMaxSyncKeys  = "maxSyncKeys"
+	SettingMaxSyncLag   = "maxSyncLag"
+)
+
+// Settings lists the runtime settings of this controller
+var Settings = map[string]controllerconfig.Setting{
+	SettingMaxSyncBytes: {
+		Type:        controllerconfig.Int,
+		Description: "Maximum total size of a synced ConfigMap in bytes, 0 disables the check",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingMaxSyncKeys: {
+		Type:        controllerconfig.Int,
+		Description: "Maximum number of keys of a synced ConfigMap, 0 disables the check",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingMaxSyncLag: {
+		Type:        controllerconfig.Duration,
+		Description: "Time a target may stay behind its source before it is reported, 0 disables lag detection",
+		Min:         controllerconfig.Bound(0),
+	},
+}
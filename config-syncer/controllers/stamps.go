@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Annotation on a target with the kind of its source, ConfigMap or Secret
+	SourceKindAnnotation = "config-syncer/source-kind"
+
+	// Annotation on a target with the resourceVersion of the source it was
+	// last synced from
+	SourceResourceVersionAnnotation = "config-syncer/source-resource-version"
+
+	// Annotation on a target with the generation of the source it was last
+	// synced from. ConfigMaps and Secrets don't track generations, it is only
+	// set when the API server sets one.
+	SourceGenerationAnnotation = "config-syncer/source-generation"
+
+	// Annotation on a target with the hash of the source content it was last
+	// synced from: the keys and plain values the sync copies, before encryption
+	ContentHashAnnotation = "config-syncer/content-hash"
+
+	// Annotation on a target with the time it was last written by a sync, RFC 3339
+	LastSyncedAnnotation = "config-syncer/last-synced"
+)
+
+// syncStamp records which version of its source a target was synced from
+type syncStamp struct {
+	kind            string
+	resourceVersion string
+	generation      int64
+	hash            string
+}
+
+// newSyncStamp returns the stamp of a source whose synced content is values
+func newSyncStamp(source client.Object, values map[string][]byte) syncStamp {
+	return syncStamp{
+		kind:            sourceKind(source),
+		resourceVersion: source.GetResourceVersion(),
+		generation:      source.GetGeneration(),
+		hash:            contentHash(values),
+	}
+}
+
+// stale reports whether a target was synced from other source content. A
+// source change that only touches its metadata doesn't make targets stale.
+func (s syncStamp) stale(target client.Object) bool {
+	annotations := target.GetAnnotations()
+	return annotations[ContentHashAnnotation] != s.hash || annotations[SourceKindAnnotation] != s.kind
+}
+
+// apply stamps a target that is about to be written
+func (s syncStamp) apply(target client.Object) {
+	annotations := target.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[SourceKindAnnotation] = s.kind
+	annotations[SourceResourceVersionAnnotation] = s.resourceVersion
+	if s.generation != 0 {
+		annotations[SourceGenerationAnnotation] = strconv.FormatInt(s.generation, 10)
+	} else {
+		delete(annotations, SourceGenerationAnnotation)
+	}
+	annotations[ContentHashAnnotation] = s.hash
+	annotations[LastSyncedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	target.SetAnnotations(annotations)
+}
+
+// contentHash returns the SHA-256 of keys and values in key order. Lengths
+// are hashed too, so moving bytes between a key and its value changes the hash.
+func contentHash(values map[string][]byte) string {
+	hash := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(hash, "%d:%s%d:", len(key), key, len(values[key]))
+		hash.Write(values[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
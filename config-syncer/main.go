@@ -3,12 +3,27 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/psrvere/k8s-controller/config-syncer/controllers"
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+	"github.com/psrvere/k8s-controllers/common/httpauth"
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	"github.com/psrvere/k8s-controllers/common/version"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -20,11 +35,60 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	// "<binary> selftest [flags]" verifies an installation end-to-end
+	if len(os.Args) > 1 && os.Args[1] == selftest.Command {
+		os.Exit(selftest.Main(os.Args[2:], scheme, controllers.SelfTest()))
+	}
+
+	// "<binary> manifests [flags] [-- controller flags]" prints the install manifests
+	if len(os.Args) > 1 && os.Args[1] == manifests.Command {
+		os.Exit(manifests.Main(os.Args[2:], controllers.Manifest()))
+	}
+	// "<binary> unseal [flags]" decrypts an encrypted key of a target
+	if len(os.Args) > 1 && os.Args[1] == unsealCommand {
+		os.Exit(unseal(os.Args[2:]))
+	}
+
 	var probeAddr string
+	var maxSyncBytes int
+	var maxSyncKeys int
+	var forbiddenKeyPatterns string
+	var enableSecretProjection bool
+	var allowNamespaceCreation bool
+	var allowedNamespaceLabels string
+	var diffAddr string
+	var encryptionKeyNamespace string
+	var maxSyncLag time.Duration
 	flag.String("health-probe-bind-address", ":8082", "Probe endpoint binds to this address")
+	flag.IntVar(&maxSyncBytes, "max-sync-bytes", controllers.DefaultMaxSyncBytes,
+		"Maximum total size of keys and values of a synced ConfigMap. 0 disables the limit.")
+	flag.IntVar(&maxSyncKeys, "max-sync-keys", controllers.DefaultMaxSyncKeys,
+		"Maximum number of keys of a synced ConfigMap. 0 disables the limit.")
+	flag.StringVar(&forbiddenKeyPatterns, "forbidden-key-patterns", "",
+		"Comma separated regular expressions. Sources with a matching key are not synced, e.g. '(?i)password,(?i)private-key'")
+	flag.BoolVar(&enableSecretProjection, "enable-secret-projection", false,
+		"Project allow-listed keys of labelled Secrets into ConfigMaps and of ConfigMaps into Secrets. Needs access to Secrets.")
+	flag.BoolVar(&allowNamespaceCreation, "allow-namespace-creation", false,
+		"Create missing target namespaces of sources annotated with config-syncer/create-namespace=true. Needs permission to create namespaces.")
+	flag.StringVar(&allowedNamespaceLabels, "allowed-namespace-labels", "",
+		"Comma separated label keys sources may set on the namespaces they create. Empty allows every key without a reserved prefix.")
+	flag.StringVar(&diffAddr, "diff-bind-address", "",
+		"Address the source/target diff endpoint binds to, e.g. 127.0.0.1:8090. Disabled when empty.")
+	flag.StringVar(&encryptionKeyNamespace, "encryption-key-namespace", "",
+		"Namespace of the Secret with the keypair encrypting the keys in config-syncer/encrypt-keys. Generated when missing. Encryption is disabled when empty.")
+	flag.DurationVar(&maxSyncLag, "max-sync-lag", controllers.DefaultMaxSyncLag,
+		"Time a target may stay behind its source before it is reported with an event and metrics. 0 disables lag detection.")
+
+	// --kubeconfig, --context and impersonation for running out-of-cluster
+	var connection restconfig.Options
+	connection.AddFlags(flag.CommandLine)
+
+	features := featuregate.New("config-syncer", controllers.FeatureGates)
+	features.AddFlag(flag.CommandLine)
 
 	opts := zap.Options{
 		Development: true,
@@ -33,24 +97,118 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	features.Report(setupLog)
+	version.Report(setupLog, features)
+
+	forbiddenPatterns, err := controllers.ParseKeyPatterns(forbiddenKeyPatterns)
+	if err != nil {
+		setupLog.Error(err, "unable to parse forbidden key patterns")
+		os.Exit(1)
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		HealthProbeBindAddress: probeAddr,
-	})
+	}
+	if enableSecretProjection {
+		// Only source Secrets are watched
+		selector, err := controllers.SourceSecretSelector()
+		if err != nil {
+			setupLog.Error(err, "unable to create source Secret selector")
+			os.Exit(1)
+		}
+		options.Cache.ByObject = map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {Label: selector},
+		}
+	}
+
+	restConfig, err := connection.Load()
+	if err != nil {
+		setupLog.Error(err, "Unable to load kubeconfig")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, options)
 	if err != nil {
 		setupLog.Error(err, "Unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.ConfigMapReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	// Sync limits can be changed at runtime with a ControllerConfig
+	config := controllerconfig.New("config-syncer", controllers.Settings, features)
+	if err := config.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ControllerConfig")
+		os.Exit(1)
+	}
+
+	// Build and effective feature gates on /version of the metrics server
+	if err := version.AddToManager(mgr, "config-syncer", config.ActiveFeatureGates); err != nil {
+		setupLog.Error(err, "unable to serve version")
+		os.Exit(1)
+	}
+
+	// Target Secrets are read directly, the cache only holds source Secrets
+	var secretReader client.Reader
+	if enableSecretProjection {
+		secretReader = mgr.GetAPIReader()
+	}
+
+	// The keypair is read directly, no other Secrets are needed
+	var sealer *controllers.Sealer
+	if encryptionKeyNamespace != "" {
+		sealer = &controllers.Sealer{
+			Reader:    mgr.GetAPIReader(),
+			Writer:    mgr.GetClient(),
+			Namespace: encryptionKeyNamespace,
+		}
+	}
+
+	backoff := throttle.NewAdaptiveBackoff("config-syncer")
+	reconciler := &controllers.ConfigMapReconciler{
+		Client:  throttle.WrapClient(mgr.GetClient(), backoff),
+		Scheme:  mgr.GetScheme(),
+		Backoff: backoff,
+		Limits: controllers.SyncLimits{
+			MaxBytes:             maxSyncBytes,
+			MaxKeys:              maxSyncKeys,
+			ForbiddenKeyPatterns: forbiddenPatterns,
+		},
+		Namespaces:       predicates.NewNamespaceFilter(mgr.GetClient()),
+		Config:           config,
+		SecretReader:     secretReader,
+		CreateNamespaces: allowNamespaceCreation,
+		Sealer:           sealer,
+	}
+	for _, key := range strings.Split(allowedNamespaceLabels, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			reconciler.AllowedNamespaceLabels = append(reconciler.AllowedNamespaceLabels, key)
+		}
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ConfigMap")
 		os.Exit(1)
 	}
 
+	// Targets that stay behind their source are reported on the source
+	if err := mgr.Add(&controllers.LagDetector{
+		Reconciler: reconciler,
+		MaxLag:     maxSyncLag,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up lag detector")
+		os.Exit(1)
+	}
+
+	if diffAddr != "" {
+		if err := mgr.Add(&controllers.DiffServer{
+			Reconciler:  reconciler,
+			BindAddress: diffAddr,
+			Auth:        &httpauth.Reviewer{Client: mgr.GetClient()},
+		}); err != nil {
+			setupLog.Error(err, "unable to set up diff server")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to setup health check")
 		os.Exit(1)
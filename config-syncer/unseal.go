@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/psrvere/k8s-controller/config-syncer/controllers"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const unsealCommand = "unseal"
+
+// unseal prints the plain value of an encrypted key of a target ConfigMap.
+// It reads the keypair Secret with the caller's credentials, so only those
+// who may read it can decrypt.
+func unseal(args []string) int {
+	fs := flag.NewFlagSet(unsealCommand, flag.ContinueOnError)
+	connection := &restconfig.Options{}
+	connection.AddFlags(fs)
+	namespace := fs.String("namespace", "default", "Namespace of the target ConfigMap.")
+	name := fs.String("name", "", "Name of the target ConfigMap.")
+	key := fs.String("key", "", "Encrypted key of the target ConfigMap.")
+	keyNamespace := fs.String("encryption-key-namespace", "", "Namespace of the controller's keypair Secret.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || *key == "" || *keyNamespace == "" {
+		fmt.Fprintln(os.Stderr, "unseal: --name, --key and --encryption-key-namespace are required")
+		return 2
+	}
+
+	config, err := connection.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unseal: unable to load kubeconfig: %v\n", err)
+		return 1
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unseal: unable to create client: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	target := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: *namespace, Name: *name}, target); err != nil {
+		fmt.Fprintf(os.Stderr, "unseal: unable to get ConfigMap %s/%s: %v\n", *namespace, *name, err)
+		return 1
+	}
+	value, exists := target.Data[*key]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unseal: ConfigMap %s/%s has no key %s\n", *namespace, *name, *key)
+		return 1
+	}
+
+	// Without a writer the keypair is never generated
+	sealer := &controllers.Sealer{Reader: c, Namespace: *keyNamespace}
+	plain, err := sealer.Unseal(ctx, *namespace, *name, *key, value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unseal: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(plain)
+	return 0
+}
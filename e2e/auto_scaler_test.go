@@ -0,0 +1,59 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	autoscaler "github.com/psrvere/k8s-controllers/auto-scaler/controllers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TestAutoScaler checks that a labelled deployment is scaled within its
+// replica limits. The controller uses fake CPU metrics, so the direction
+// isn't asserted, only that it scales.
+func TestAutoScaler(t *testing.T) {
+	namespace := newNamespace(t, "auto-scaler")
+	startController(t, "auto-scaler", "auto-scaler")
+
+	const initialReplicas = 2
+	labels := map[string]string{"app": "web"}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: namespace,
+			Labels:    map[string]string{autoscaler.AutoScaleLabel: "true"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](initialReplicas),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "pause", Image: autoscaler.SelfTestImage}},
+				},
+			},
+		},
+	}
+	create(t, deployment)
+
+	eventually(t, "deployment scaled", func(ctx context.Context) error {
+		if err := cluster.Client.Get(ctx, client.ObjectKeyFromObject(deployment), deployment); err != nil {
+			return err
+		}
+		replicas := *deployment.Spec.Replicas
+		if replicas < autoscaler.MinReplicas || replicas > autoscaler.MaxReplicas {
+			return fmt.Errorf("deployment has %d replicas, outside %d-%d", replicas, autoscaler.MinReplicas, autoscaler.MaxReplicas)
+		}
+		if replicas == initialReplicas {
+			return fmt.Errorf("deployment has not been scaled yet")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,60 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	configsyncer "github.com/psrvere/k8s-controller/config-syncer/controllers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TestConfigSyncer checks that a labelled ConfigMap is copied to its target
+// namespace and that changes to the source follow
+func TestConfigSyncer(t *testing.T) {
+	source := newNamespace(t, "config-source")
+	target := newNamespace(t, "config-target")
+	startController(t, "config-syncer", "config-syncer")
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-config",
+			Namespace:   source,
+			Labels:      map[string]string{configsyncer.SyncLabel: "true"},
+			Annotations: map[string]string{configsyncer.TargetNamespaceAnnotation: target},
+		},
+		Data: map[string]string{"log-level": "info"},
+	}
+	create(t, configMap)
+
+	copyKey := client.ObjectKey{Name: configMap.Name, Namespace: target}
+	expectCopy := func(value string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			copy := &corev1.ConfigMap{}
+			if err := cluster.Client.Get(ctx, copyKey, copy); err != nil {
+				return err
+			}
+			if copy.Data["log-level"] != value {
+				return fmt.Errorf("copy has log-level %q, want %q", copy.Data["log-level"], value)
+			}
+			if _, synced := copy.Labels[configsyncer.SyncedLabel]; !synced {
+				return fmt.Errorf("copy has no %s label", configsyncer.SyncedLabel)
+			}
+			return nil
+		}
+	}
+	eventually(t, "ConfigMap synced", expectCopy("info"))
+
+	if err := cluster.Client.Get(context.Background(), client.ObjectKeyFromObject(configMap), configMap); err != nil {
+		t.Fatal(err)
+	}
+	configMap.Data["log-level"] = "debug"
+	if err := cluster.Client.Update(context.Background(), configMap); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "ConfigMap change synced", expectCopy("debug"))
+}
@@ -0,0 +1,334 @@
+// Package e2e runs the controllers against a kind cluster and checks that they
+// act on the resources they watch. The tests are behind the e2e build tag and
+// need docker:
+//
+//	go test -tags e2e -v -timeout 30m .
+//
+// Each controller is built from its module and started as a process that
+// impersonates its service account, so the RBAC manifests are tested as well.
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+	kindcluster "sigs.k8s.io/kind/pkg/cluster"
+)
+
+const (
+	// Name of the kind cluster created for the tests
+	DefaultClusterName = "k8s-controllers-e2e"
+
+	// Environment variable naming an existing kind cluster to run against.
+	// The cluster is created if missing and kept after the tests.
+	ClusterEnv = "E2E_KIND_CLUSTER"
+
+	// Environment variable with the kind node image, empty uses the kind default
+	NodeImageEnv = "E2E_KIND_NODE_IMAGE"
+
+	// Field manager of the applied manifests
+	fieldOwner = "e2e"
+
+	clusterReadyTimeout = 3 * time.Minute
+	crdReadyTimeout     = time.Minute
+)
+
+// Cluster is a kind cluster with one control plane and two worker nodes
+type Cluster struct {
+	Name string
+	// Kubeconfig is the path of the admin kubeconfig
+	Kubeconfig string
+	Client     client.Client
+
+	provider *kindcluster.Provider
+	// keep is set for clusters named with ClusterEnv, they outlive the tests
+	keep bool
+	dir  string
+}
+
+// StartCluster creates the kind cluster, or reuses the one named with
+// ClusterEnv, and returns a client for it
+func StartCluster(scheme *runtime.Scheme) (*Cluster, error) {
+	dir, err := os.MkdirTemp("", "k8s-controllers-e2e-")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cluster{
+		Name:     DefaultClusterName,
+		provider: kindcluster.NewProvider(),
+		dir:      dir,
+	}
+	if name := os.Getenv(ClusterEnv); name != "" {
+		c.Name, c.keep = name, true
+	}
+
+	existing, err := c.provider.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kind clusters: %w", err)
+	}
+	if !contains(existing, c.Name) {
+		config := &v1alpha4.Cluster{
+			Nodes: []v1alpha4.Node{
+				{Role: v1alpha4.ControlPlaneRole},
+				{Role: v1alpha4.WorkerRole},
+				{Role: v1alpha4.WorkerRole},
+			},
+		}
+		options := []kindcluster.CreateOption{
+			kindcluster.CreateWithV1Alpha4Config(config),
+			kindcluster.CreateWithWaitForReady(clusterReadyTimeout),
+		}
+		if image := os.Getenv(NodeImageEnv); image != "" {
+			options = append(options, kindcluster.CreateWithNodeImage(image))
+		}
+		if err := c.provider.Create(c.Name, options...); err != nil {
+			return nil, fmt.Errorf("failed to create kind cluster %s: %w", c.Name, err)
+		}
+	}
+
+	kubeconfig, err := c.provider.KubeConfig(c.Name, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubeconfig of kind cluster %s: %w", c.Name, err)
+	}
+	c.Kubeconfig = filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(c.Kubeconfig, []byte(kubeconfig), 0o600); err != nil {
+		return nil, err
+	}
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", c.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	c.Client, err = client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return c, nil
+}
+
+// Stop deletes the cluster unless it was named with ClusterEnv
+func (c *Cluster) Stop() error {
+	defer os.RemoveAll(c.dir)
+	if c.keep {
+		return nil
+	}
+	return c.provider.Delete(c.Name, "")
+}
+
+// Apply server-side applies the YAML manifests at the paths and waits until
+// applied CRDs are established
+func (c *Cluster) Apply(ctx context.Context, paths ...string) error {
+	for _, path := range paths {
+		objects, err := readManifests(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		for _, obj := range objects {
+			obj.SetManagedFields(nil)
+			if err := c.Client.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+				return fmt.Errorf("failed to apply %s %s from %s: %w", obj.GetKind(), obj.GetName(), path, err)
+			}
+			if obj.GetKind() == "CustomResourceDefinition" {
+				if err := c.waitForCRD(ctx, obj.GetName()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) waitForCRD(ctx context.Context, name string) error {
+	return Eventually(ctx, crdReadyTimeout, time.Second, func(ctx context.Context) error {
+		crd := &unstructured.Unstructured{}
+		crd.SetAPIVersion("apiextensions.k8s.io/v1")
+		crd.SetKind("CustomResourceDefinition")
+		if err := c.Client.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+			return err
+		}
+		conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+		for _, condition := range conditions {
+			fields, _ := condition.(map[string]interface{})
+			if fields["type"] == "Established" && fields["status"] == "True" {
+				return nil
+			}
+		}
+		return fmt.Errorf("CRD %s is not established", name)
+	})
+}
+
+// readManifests decodes every object of a multi-document YAML file
+func readManifests(path string) ([]*unstructured.Unstructured, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var objects []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, err
+		}
+		if len(obj.Object) > 0 {
+			objects = append(objects, obj)
+		}
+	}
+}
+
+// impersonatingKubeconfig writes a copy of the admin kubeconfig that
+// impersonates a service account in the default namespace
+func (c *Cluster) impersonatingKubeconfig(serviceAccount string) (string, error) {
+	config, err := clientcmd.LoadFromFile(c.Kubeconfig)
+	if err != nil {
+		return "", err
+	}
+	for _, authInfo := range config.AuthInfos {
+		authInfo.Impersonate = fmt.Sprintf("system:serviceaccount:default:%s", serviceAccount)
+	}
+
+	path := filepath.Join(c.dir, fmt.Sprintf("kubeconfig-%s", serviceAccount))
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// BuildController builds the binary of a controller module into the cluster's
+// temporary directory. root is the repository root.
+func (c *Cluster) BuildController(ctx context.Context, root, name string) (string, error) {
+	binary := filepath.Join(c.dir, "bin", name)
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", binary, ".")
+	cmd.Dir = filepath.Join(root, name)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to build %s: %w\n%s", name, err, output)
+	}
+	return binary, nil
+}
+
+// Controller is a controller process running against the cluster
+type Controller struct {
+	Name    string
+	cmd     *exec.Cmd
+	logs    *os.File
+	stopped chan error
+}
+
+// StartController runs a controller binary as its service account
+func (c *Cluster) StartController(binary, serviceAccount string, args ...string) (*Controller, error) {
+	kubeconfig, err := c.impersonatingKubeconfig(serviceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write kubeconfig for %s: %w", serviceAccount, err)
+	}
+
+	name := filepath.Base(binary)
+	logs, err := os.Create(filepath.Join(c.dir, name+".log"))
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(binary, args...)
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+kubeconfig)
+	cmd.Stdout, cmd.Stderr = logs, logs
+	if err := cmd.Start(); err != nil {
+		logs.Close()
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	controller := &Controller{Name: name, cmd: cmd, logs: logs, stopped: make(chan error, 1)}
+	go func() {
+		controller.stopped <- cmd.Wait()
+	}()
+	return controller, nil
+}
+
+// Running returns an error when the controller process has exited
+func (c *Controller) Running() error {
+	select {
+	case err := <-c.stopped:
+		c.stopped <- err
+		return fmt.Errorf("controller %s exited: %v", c.Name, err)
+	default:
+		return nil
+	}
+}
+
+// Stop terminates the controller and waits for it to exit
+func (c *Controller) Stop() {
+	defer c.logs.Close()
+	if c.Running() != nil {
+		return
+	}
+
+	_ = c.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-c.stopped:
+	case <-time.After(10 * time.Second):
+		_ = c.cmd.Process.Kill()
+		<-c.stopped
+	}
+}
+
+// Logs returns the last lines the controller logged
+func (c *Controller) Logs(lines int) string {
+	content, err := os.ReadFile(c.logs.Name())
+	if err != nil {
+		return fmt.Sprintf("unable to read logs: %v", err)
+	}
+
+	var all []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		all = append(all, scanner.Text())
+	}
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return strings.Join(all, "\n")
+}
+
+// Eventually polls check until it succeeds or the timeout expires and returns
+// the last error of check
+func Eventually(ctx context.Context, timeout, interval time.Duration, check func(ctx context.Context) error) error {
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		lastErr = check(ctx)
+		return lastErr == nil, nil
+	})
+	if err != nil && lastErr != nil {
+		return fmt.Errorf("not satisfied within %s: %w", timeout, lastErr)
+	}
+	return err
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	jobhandler "github.com/psrvere/k8s-controllers/job-handler/controllers"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TestJobHandler checks that the results of a finished Job are stored
+func TestJobHandler(t *testing.T) {
+	namespace := newNamespace(t, "job-handler")
+	startController(t, "job-handler", "job-handler")
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "report",
+			Namespace: namespace,
+			Labels:    map[string]string{jobhandler.HandlerLabel: "true"},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](0),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:    "report",
+						Image:   jobhandler.SelfTestImage,
+						Command: []string{"sh", "-c", "echo report done"},
+					}},
+				},
+			},
+		},
+	}
+	create(t, job)
+
+	eventually(t, "job results stored", func(ctx context.Context) error {
+		results := &corev1.ConfigMap{}
+		key := client.ObjectKey{Name: fmt.Sprintf("%s-results", job.Name), Namespace: namespace}
+		if err := cluster.Client.Get(ctx, key, results); err != nil {
+			return fmt.Errorf("results ConfigMap: %w", err)
+		}
+		if len(results.Data) == 0 {
+			return fmt.Errorf("results ConfigMap %s is empty", key.Name)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,149 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// How long a controller gets to act on a test resource
+	actTimeout   = 3 * time.Minute
+	pollInterval = 2 * time.Second
+
+	// Image for pods that only need to run
+	pauseImage = "registry.k8s.io/pause:3.10"
+)
+
+var (
+	scheme  = runtime.NewScheme()
+	cluster *Cluster
+
+	// repoRoot is the repository root, the tests run in <root>/e2e
+	repoRoot = ".."
+
+	// Manifests applied before any controller starts
+	crds = []string{
+		"common/config/crd/controllerconfigs.yaml",
+		"job-handler/config/crd/jobresults.yaml",
+		"service-validator/config/crd/nodeprobereports.yaml",
+	}
+	rbac = []string{
+		"auto-scaler/testing/rbac.yaml",
+		"config-syncer/testing/rbac.yaml",
+		"job-handler/testing/rbac.yaml",
+		"node-balancer/testing/rbac.yaml",
+		"pod-labeller/tests/manual/service_account.yaml",
+		"pod-labeller/tests/manual/role.yaml",
+		"secret-rotator/testing/rbac.yaml",
+		"service-validator/testing/rbac.yaml",
+	}
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	var err error
+	cluster, err = StartCluster(scheme)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: %v\n", err)
+		return 1
+	}
+	defer func() {
+		if err := cluster.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "e2e: failed to delete kind cluster %s: %v\n", cluster.Name, err)
+		}
+	}()
+
+	ctx := context.Background()
+	for _, manifest := range append(crds, rbac...) {
+		if err := cluster.Apply(ctx, filepath.Join(repoRoot, manifest)); err != nil {
+			fmt.Fprintf(os.Stderr, "e2e: %v\n", err)
+			return 1
+		}
+	}
+	return m.Run()
+}
+
+// startController builds and starts a controller for the duration of a test.
+// Its logs are printed when the test fails.
+func startController(t *testing.T, name, serviceAccount string, args ...string) {
+	t.Helper()
+
+	binary, err := cluster.BuildController(context.Background(), repoRoot, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller, err := cluster.StartController(binary, serviceAccount, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		controller.Stop()
+		if t.Failed() {
+			t.Logf("last logs of %s:\n%s", name, controller.Logs(100))
+		}
+	})
+}
+
+// newNamespace creates a namespace for a test and deletes it afterwards
+func newNamespace(t *testing.T, prefix string) string {
+	t.Helper()
+
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("e2e-%s-%s", prefix, rand.String(5))},
+	}
+	if err := cluster.Client.Create(context.Background(), namespace); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := client.IgnoreNotFound(cluster.Client.Delete(context.Background(), namespace)); err != nil {
+			t.Errorf("failed to delete namespace %s: %v", namespace.Name, err)
+		}
+	})
+	return namespace.Name
+}
+
+// create creates an object and fails the test on error
+func create(t *testing.T, obj client.Object) {
+	t.Helper()
+	if err := cluster.Client.Create(context.Background(), obj); err != nil {
+		t.Fatalf("failed to create %T %s: %v", obj, obj.GetName(), err)
+	}
+}
+
+// mergePatch returns a JSON merge patch, nil values remove fields
+func mergePatch(patch map[string]interface{}) client.Patch {
+	data, err := json.Marshal(patch)
+	utilruntime.Must(err)
+	return client.RawPatch(types.MergePatchType, data)
+}
+
+// eventually fails the test unless check succeeds within actTimeout
+func eventually(t *testing.T, what string, check func(ctx context.Context) error) {
+	t.Helper()
+	if err := Eventually(context.Background(), actTimeout, pollInterval, check); err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+}
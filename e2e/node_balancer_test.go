@@ -0,0 +1,118 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	nodebalancer "github.com/psrvere/k8s-controllers/node-balancer/controllers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Label kubeadm puts on control plane nodes
+const controlPlaneLabel = "node-role.kubernetes.io/control-plane"
+
+// TestNodeBalancer overloads one worker with pods pinned to it and checks
+// that a pod is evicted towards the empty worker
+func TestNodeBalancer(t *testing.T) {
+	ctx := context.Background()
+	namespace := newNamespace(t, "node-balancer")
+	workers := balanceWorkers(t, namespace)
+	overloaded := workers[0]
+
+	// Two pods of 35% each push the worker above the 60% CPU threshold, moving
+	// one of them balances both workers
+	allocatable := overloaded.Status.Allocatable[corev1.ResourceCPU]
+	request := resource.NewMilliQuantity(allocatable.MilliValue()*35/100, resource.DecimalSI)
+	var pods []*corev1.Pod
+	for i := range 2 {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("heavy-%d", i), Namespace: namespace},
+			Spec: corev1.PodSpec{
+				NodeName: overloaded.Name,
+				Containers: []corev1.Container{{
+					Name:  "pause",
+					Image: pauseImage,
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: *request},
+					},
+				}},
+			},
+		}
+		create(t, pod)
+		pods = append(pods, pod)
+	}
+
+	startController(t, "node-balancer", "node-balancer")
+
+	eventually(t, "pod evicted for rebalancing", func(ctx context.Context) error {
+		events := &corev1.EventList{}
+		if err := cluster.Client.List(ctx, events, client.InNamespace(namespace)); err != nil {
+			return err
+		}
+		for _, event := range events.Items {
+			if event.Reason == nodebalancer.NodeRebalancingReason {
+				return nil
+			}
+		}
+		return fmt.Errorf("no %s event in namespace %s", nodebalancer.NodeRebalancingReason, namespace)
+	})
+
+	remaining := 0
+	for _, pod := range pods {
+		err := cluster.Client.Get(ctx, client.ObjectKeyFromObject(pod), pod)
+		if client.IgnoreNotFound(err) != nil {
+			t.Fatal(err)
+		}
+		if err == nil && pod.DeletionTimestamp == nil {
+			remaining++
+		}
+	}
+	if remaining != 1 {
+		t.Errorf("%d of the pods on %s are left, want 1", remaining, overloaded.Name)
+	}
+}
+
+// balanceWorkers puts the worker nodes into a pool of their own for the test
+// and returns them
+func balanceWorkers(t *testing.T, pool string) []corev1.Node {
+	t.Helper()
+	ctx := context.Background()
+
+	nodes := &corev1.NodeList{}
+	if err := cluster.Client.List(ctx, nodes); err != nil {
+		t.Fatal(err)
+	}
+	var workers []corev1.Node
+	for _, node := range nodes.Items {
+		if _, controlPlane := node.Labels[controlPlaneLabel]; !controlPlane {
+			workers = append(workers, node)
+		}
+	}
+	if len(workers) < 2 {
+		t.Fatalf("the node balancer test needs 2 worker nodes, the cluster has %d", len(workers))
+	}
+	workers = workers[:2]
+
+	setLabels := func(node *corev1.Node, labels map[string]interface{}) error {
+		patch := map[string]interface{}{"metadata": map[string]interface{}{"labels": labels}}
+		return cluster.Client.Patch(ctx, node, mergePatch(patch))
+	}
+	for i := range workers {
+		node := &workers[i]
+		if err := setLabels(node, map[string]interface{}{nodebalancer.BalancerLabel: "true", nodebalancer.DefaultPoolLabel: pool}); err != nil {
+			t.Fatalf("failed to label node %s: %v", node.Name, err)
+		}
+		t.Cleanup(func() {
+			if err := setLabels(node, map[string]interface{}{nodebalancer.BalancerLabel: nil, nodebalancer.DefaultPoolLabel: nil}); err != nil {
+				t.Errorf("failed to unlabel node %s: %v", node.Name, err)
+			}
+		})
+	}
+	return workers
+}
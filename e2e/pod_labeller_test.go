@@ -0,0 +1,41 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	podlabeller "github.com/psrvere/k8s-controllers/pod-labeller/controllers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TestPodLabeller checks that a running pod gets its labels
+func TestPodLabeller(t *testing.T) {
+	namespace := newNamespace(t, "pod-labeller")
+	startController(t, "pod-labeller", "pod-labeller-controller-manager")
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "pause", Image: podlabeller.SelfTestImage}},
+		},
+	}
+	create(t, pod)
+
+	eventually(t, "pod labelled", func(ctx context.Context) error {
+		if err := cluster.Client.Get(ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
+			return err
+		}
+		if pod.Labels[podlabeller.ProcessedLabel] != "true" {
+			return fmt.Errorf("pod has no %s label (phase %s)", podlabeller.ProcessedLabel, pod.Status.Phase)
+		}
+		if pod.Labels[podlabeller.ImageLabel] == "" {
+			return fmt.Errorf("pod has no %s label", podlabeller.ImageLabel)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	secretrotator "github.com/psrvere/k8s-controllers/secret-rotator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TestSecretRotator checks that an overdue secret is flagged for rotation and
+// a fresh one isn't
+func TestSecretRotator(t *testing.T) {
+	namespace := newNamespace(t, "secret-rotator")
+	startController(t, "secret-rotator", "secret-rotator")
+
+	secret := func(name, ageDays string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{secretrotator.RotationLabel: "true"},
+				Annotations: map[string]string{
+					secretrotator.RotationThresholdAnnotation: "30",
+					secretrotator.TestAgeAnnotation:           ageDays,
+				},
+			},
+			StringData: map[string]string{"password": name},
+		}
+	}
+	overdue, fresh := secret("overdue", "45"), secret("fresh", "2")
+	create(t, overdue)
+	create(t, fresh)
+
+	eventually(t, "secrets checked", func(ctx context.Context) error {
+		for _, s := range []*corev1.Secret{overdue, fresh} {
+			if err := cluster.Client.Get(ctx, client.ObjectKeyFromObject(s), s); err != nil {
+				return err
+			}
+			if s.Annotations[secretrotator.LastRotationCheckAnnotation] == "" {
+				return fmt.Errorf("secret %s has not been checked yet", s.Name)
+			}
+		}
+		return nil
+	})
+
+	if overdue.Annotations[secretrotator.NeedsRotationAnnotation] != "true" {
+		t.Errorf("overdue secret is not flagged with %s", secretrotator.NeedsRotationAnnotation)
+	}
+	if fresh.Annotations[secretrotator.NeedsRotationAnnotation] == "true" {
+		t.Errorf("fresh secret is flagged with %s", secretrotator.NeedsRotationAnnotation)
+	}
+}
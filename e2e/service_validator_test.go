@@ -0,0 +1,44 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	servicevalidator "github.com/psrvere/k8s-controllers/service-validator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TestServiceValidator checks that a Service without backing pods is reported
+// invalid
+func TestServiceValidator(t *testing.T) {
+	namespace := newNamespace(t, "service-validator")
+	startController(t, "service-validator", "service-validator")
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "orphan",
+			Namespace: namespace,
+			Labels:    map[string]string{servicevalidator.ValidationLabel: "true"},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "missing"},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	create(t, service)
+
+	eventually(t, "service validated", func(ctx context.Context) error {
+		if err := cluster.Client.Get(ctx, client.ObjectKeyFromObject(service), service); err != nil {
+			return err
+		}
+		if status := service.Annotations[servicevalidator.ValidationStatusAnnotation]; status != servicevalidator.StatusInvalid {
+			return fmt.Errorf("service has validation status %q, want %q", status, servicevalidator.StatusInvalid)
+		}
+		return nil
+	})
+}
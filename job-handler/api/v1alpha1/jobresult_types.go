@@ -0,0 +1,39 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// JobResultSpec describes the processed Job and where its results are stored
+type JobResultSpec struct {
+	JobName        string       `json:"jobName"`
+	JobUID         types.UID    `json:"jobUID,omitempty"`
+	ConfigMapName  string       `json:"configMapName"`
+	Succeeded      bool         `json:"succeeded"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// JobResult is the logical owner of the result objects of a standalone Job.
+// Deleting it garbage collects the results ConfigMap.
+type JobResult struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec JobResultSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// JobResultList contains a list of JobResult
+type JobResultList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []JobResult `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&JobResult{}, &JobResultList{})
+}
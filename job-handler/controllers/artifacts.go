@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Annotation with the comma separated file paths to collect from the pods of a Job
+	ArtifactsAnnotation = "job-handler/artifacts"
+
+	// Annotation with the container the artifacts are copied from, defaults to
+	// DefaultArtifactsContainer
+	ArtifactsContainerAnnotation = "job-handler/artifacts-container"
+
+	// Sidecar container that shares the artifact volume and stays up until the
+	// artifacts are collected
+	DefaultArtifactsContainer = "artifacts"
+
+	// File created in the artifacts container once its artifacts are stored.
+	// The sidecar waits for it before exiting so the pod can complete.
+	ArtifactsCollectedMarker = "/tmp/job-handler-artifacts-collected"
+
+	// Artifact limits keep the artifacts ConfigMap within the 1MiB ConfigMap limit
+	MaxArtifactBytes      = 256 * 1024
+	MaxTotalArtifactBytes = 768 * 1024
+
+	// Event reason when artifacts can't be collected
+	ArtifactsFailedReason = "ArtifactsFailed"
+
+	// Interval to check again while pods wait for their artifacts to be collected
+	ArtifactsPollInterval = 10 * time.Second
+)
+
+var invalidArtifactKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+
+// ArtifactCollector copies declared files out of running Job pods with the
+// pod exec API
+type ArtifactCollector struct {
+	Client kubernetes.Interface
+	Config *rest.Config
+}
+
+// artifactPaths returns the declared artifact paths of a Job
+func artifactPaths(job *batchv1.Job) []string {
+	var paths []string
+	for _, p := range strings.Split(job.Annotations[ArtifactsAnnotation], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+func artifactsContainer(job *batchv1.Job) string {
+	if container := job.Annotations[ArtifactsContainerAnnotation]; container != "" {
+		return container
+	}
+	return DefaultArtifactsContainer
+}
+
+func artifactsConfigMapName(job *batchv1.Job) string {
+	return fmt.Sprintf("%s-artifacts", job.Name)
+}
+
+// artifactKey returns the ConfigMap key of an artifact of a pod, e.g.
+// "my-job-x7k2p.out_report.json" for /out/report.json
+func artifactKey(podName, filePath string) string {
+	name := invalidArtifactKeyChars.ReplaceAllString(strings.TrimPrefix(path.Clean(filePath), "/"), "_")
+	return podName + "." + name
+}
+
+// collectArtifacts copies the artifacts of every pod of a running Job whose
+// other containers have finished while the artifacts container still runs.
+// The artifacts are stored in the <job>-artifacts ConfigMap before the pod is
+// released through the collected marker. Returns true while pods are still
+// waiting for their artifacts to be collected.
+func (r *JobHandlerReconciler) collectArtifacts(ctx context.Context, job *batchv1.Job) (bool, error) {
+	log := log.FromContext(ctx)
+
+	paths := artifactPaths(job)
+	if r.Artifacts == nil || len(paths) == 0 {
+		return false, nil
+	}
+	container := artifactsContainer(job)
+
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.MatchingLabels{"job-name": job.Name}, client.InNamespace(job.Namespace)); err != nil {
+		return false, fmt.Errorf("failed to list job pods: %w", err)
+	}
+
+	configMap, err := r.getArtifactsConfigMap(ctx, job)
+	if err != nil {
+		return false, err
+	}
+
+	pending := false
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if !containerRunning(pod, container) {
+			continue
+		}
+		pending = true
+		if !otherContainersTerminated(pod, container) {
+			continue
+		}
+
+		if _, stored := configMap.Annotations[artifactsPodAnnotation(pod.Name)]; !stored {
+			r.copyPodArtifacts(ctx, configMap, pod, container, paths)
+			if err := r.storeArtifactsConfigMap(ctx, job, configMap); err != nil {
+				return true, fmt.Errorf("failed to store artifacts of pod %s: %w", pod.Name, err)
+			}
+			log.Info("Collected artifacts", "pod", pod.Name, "configMap", configMap.Name)
+		}
+
+		// Let the sidecar exit so the pod and the Job can complete
+		if _, err := r.Artifacts.exec(ctx, pod, container, "touch", ArtifactsCollectedMarker); err != nil {
+			return true, fmt.Errorf("failed to release pod %s: %w", pod.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// copyPodArtifacts reads every artifact of a pod into the ConfigMap. Missing or
+// oversized files are listed in the pod's artifacts annotation instead of
+// failing the collection.
+func (r *JobHandlerReconciler) copyPodArtifacts(ctx context.Context, configMap *corev1.ConfigMap, pod *corev1.Pod, container string, paths []string) {
+	// Artifacts are redacted like logs, and withheld when they can't be
+	values, err := r.podSecretValues(ctx, pod)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Withholding artifacts that can't be redacted", "pod", pod.Name)
+		status := fmt.Sprintf("artifacts withheld: %v", err)
+		r.createArtifactsEvent(ctx, configMap, pod, status)
+		configMap.Annotations[artifactsPodAnnotation(pod.Name)] = status
+		return
+	}
+
+	var problems []string
+	total := artifactsSize(configMap)
+	for _, filePath := range paths {
+		content, err := r.Artifacts.exec(ctx, pod, container, "cat", filePath)
+		if err == nil && r.Redactor != nil {
+			content = []byte(r.Redactor.redact(string(content), values))
+		}
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", filePath, err))
+			continue
+		case len(content) > MaxArtifactBytes:
+			problems = append(problems, fmt.Sprintf("%s: %d bytes exceeds the %d byte limit", filePath, len(content), MaxArtifactBytes))
+			continue
+		case total+len(content) > MaxTotalArtifactBytes:
+			problems = append(problems, fmt.Sprintf("%s: artifacts of the Job exceed %d bytes", filePath, MaxTotalArtifactBytes))
+			continue
+		}
+		total += len(content)
+
+		key := artifactKey(pod.Name, filePath)
+		if utf8.Valid(content) {
+			configMap.Data[key] = string(content)
+		} else {
+			configMap.BinaryData[key] = content
+		}
+	}
+
+	status := "collected"
+	if len(problems) > 0 {
+		status = strings.Join(problems, "; ")
+		r.createArtifactsEvent(ctx, configMap, pod, status)
+	}
+	configMap.Annotations[artifactsPodAnnotation(pod.Name)] = status
+}
+
+func artifactsPodAnnotation(podName string) string {
+	return "job-handler/artifacts." + podName
+}
+
+func artifactsSize(configMap *corev1.ConfigMap) int {
+	size := 0
+	for _, value := range configMap.Data {
+		size += len(value)
+	}
+	for _, value := range configMap.BinaryData {
+		size += len(value)
+	}
+	return size
+}
+
+// getArtifactsConfigMap returns the artifacts ConfigMap of a Job, or a new
+// unsaved one when nothing was collected yet
+func (r *JobHandlerReconciler) getArtifactsConfigMap(ctx context.Context, job *batchv1.Job) (*corev1.ConfigMap, error) {
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(ctx, client.ObjectKey{Name: artifactsConfigMapName(job), Namespace: job.Namespace}, configMap)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get artifacts configmap: %w", err)
+	}
+	if errors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      artifactsConfigMapName(job),
+				Namespace: job.Namespace,
+				Labels: map[string]string{
+					"job-name": job.Name,
+				},
+			},
+		}
+	}
+
+	configMap = configMap.DeepCopy()
+	if configMap.Annotations == nil {
+		configMap.Annotations = make(map[string]string)
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	if configMap.BinaryData == nil {
+		configMap.BinaryData = make(map[string][]byte)
+	}
+	return configMap, nil
+}
+
+// storeArtifactsConfigMap creates or updates the artifacts ConfigMap. It gets
+// the owner of the results so both are cleaned up together.
+func (r *JobHandlerReconciler) storeArtifactsConfigMap(ctx context.Context, job *batchv1.Job, configMap *corev1.ConfigMap) error {
+	if configMap.ResourceVersion != "" {
+		return r.Update(ctx, configMap)
+	}
+
+	ownerRef, err := r.resultOwnerReference(ctx, job, fmt.Sprintf("%s-results", job.Name))
+	if err != nil {
+		return fmt.Errorf("failed to determine result owner: %w", err)
+	}
+	if ownerRef != nil {
+		configMap.OwnerReferences = []metav1.OwnerReference{*ownerRef}
+	}
+	return r.Create(ctx, configMap)
+}
+
+func (r *JobHandlerReconciler) createArtifactsEvent(ctx context.Context, configMap *corev1.ConfigMap, pod *corev1.Pod, message string) {
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", pod.Name, time.Now().UnixNano()),
+			Namespace: pod.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       "Pod",
+			Name:       pod.Name,
+			Namespace:  pod.Namespace,
+			UID:        pod.UID,
+			APIVersion: "v1",
+		},
+		Reason:         ArtifactsFailedReason,
+		Message:        fmt.Sprintf("Some artifacts were not stored in ConfigMap %s: %s", configMap.Name, message),
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           corev1.EventTypeWarning,
+		Source: corev1.EventSource{
+			Component: "job-handler",
+		},
+	}
+
+	if err := r.Create(ctx, event); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create artifacts event", "pod", pod.Name)
+	}
+}
+
+// containerRunning reports whether a container is running. Native sidecars
+// (init containers with restartPolicy Always) are found as well.
+func containerRunning(pod *corev1.Pod, container string) bool {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.Name == container {
+				return status.State.Running != nil
+			}
+		}
+	}
+	return false
+}
+
+// otherContainersTerminated reports whether every regular container besides the
+// artifacts container has finished, i.e. the artifacts are complete
+func otherContainersTerminated(pod *corev1.Pod, container string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != container && status.State.Terminated == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// exec runs a command in a container and returns its stdout
+func (c *ArtifactCollector) exec(ctx context.Context, pod *corev1.Pod, container string, command ...string) ([]byte, error) {
+	request := c.Client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(c.Config, "POST", request.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
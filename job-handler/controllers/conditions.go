@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Job condition set once the handler has processed a finished Job
+	ResultsProcessedCondition batchv1.JobConditionType = "ResultsProcessed"
+
+	// Reasons of the ResultsProcessed condition
+	ResultsStoredReason    = "ResultsStored"
+	JobFailedReason        = "JobFailed"
+	ProcessingFailedReason = "ProcessingFailed"
+
+	// Default time a processed Job and its ResultsProcessed condition are kept
+	// before the Job is deleted
+	DefaultProcessedJobRetention = 10 * time.Minute
+)
+
+// resultsProcessedCondition builds the ResultsProcessed condition for a processing result
+func resultsProcessedCondition(job *batchv1.Job, result JobProcessingResult) batchv1.JobCondition {
+	now := metav1.Now()
+	condition := batchv1.JobCondition{
+		Type:               ResultsProcessedCondition,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+	}
+
+	switch {
+	case result.IsCompleted:
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = ResultsStoredReason
+		condition.Message = fmt.Sprintf("Results stored in ConfigMap %s/%s", job.Namespace, result.ConfigMapName)
+	case result.Reason == ResultJobFailed:
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = JobFailedReason
+		condition.Message = "Job did not complete successfully, no results stored"
+	default:
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = ProcessingFailedReason
+		condition.Message = result.Error()
+	}
+
+	return condition
+}
+
+// patchResultsCondition sets the ResultsProcessed condition on the Job status, so
+// automation can wait on the condition (kubectl wait --for=condition=ResultsProcessed)
+// instead of polling annotations
+func (r *JobHandlerReconciler) patchResultsCondition(ctx context.Context, job *batchv1.Job, result JobProcessingResult) error {
+	jobCopy := job.DeepCopy()
+	condition := resultsProcessedCondition(job, result)
+
+	replaced := false
+	for i, existing := range jobCopy.Status.Conditions {
+		if existing.Type != ResultsProcessedCondition {
+			continue
+		}
+		// Keep the transition time if the status didn't change
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		jobCopy.Status.Conditions[i] = condition
+		replaced = true
+	}
+	if !replaced {
+		jobCopy.Status.Conditions = append(jobCopy.Status.Conditions, condition)
+	}
+
+	// Conditions are replaced as a whole list by a merge patch, so guard against
+	// overwriting conditions the Job controller added in the meantime
+	return r.Status().Patch(ctx, jobCopy, client.MergeFromWithOptions(job, client.MergeFromWithOptimisticLock{}))
+}
+
+// retentionRemaining returns how long a successfully processed Job is kept
+// before the handler deletes it, counted from its ResultsProcessed condition.
+// It reports false for Jobs the handler doesn't delete: failed ones, and Jobs
+// with ttlSecondsAfterFinished, which the TTL controller deletes.
+func (r *JobHandlerReconciler) retentionRemaining(job *batchv1.Job) (time.Duration, bool) {
+	if getProcessingStatus(job) != StatusCompleted || job.Spec.TTLSecondsAfterFinished != nil {
+		return 0, false
+	}
+
+	processed := time.Now()
+	if job.Status.CompletionTime != nil {
+		processed = job.Status.CompletionTime.Time
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == ResultsProcessedCondition && condition.Reason == ResultsStoredReason {
+			processed = condition.LastTransitionTime.Time
+		}
+	}
+
+	retention := r.Config.Duration(SettingProcessedJobRetention, r.ProcessedJobRetention)
+	return max(time.Until(processed.Add(retention)), 0), true
+}
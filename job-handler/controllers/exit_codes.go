@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Key of the exit code matrix in the results ConfigMap
+const ExitCodesKey = "exit-codes.json"
+
+// States of a container in the exit code matrix
+const (
+	ContainerStateWaiting    = "waiting"
+	ContainerStateRunning    = "running"
+	ContainerStateTerminated = "terminated"
+	ContainerStateUnknown    = "unknown"
+)
+
+// PodExitCodes is one row of the exit code matrix: a pod of the Job and how
+// each of its containers ended
+type PodExitCodes struct {
+	Pod   string          `json:"pod"`
+	Phase corev1.PodPhase `json:"phase"`
+	// Reason is the pod's status reason, e.g. Evicted or DeadlineExceeded
+	Reason string `json:"reason,omitempty"`
+	Node   string `json:"node,omitempty"`
+	// Containers are the init containers, in order, then the regular ones
+	Containers []ContainerExitCode `json:"containers"`
+}
+
+// ContainerExitCode is the outcome of one container of a pod
+type ContainerExitCode struct {
+	Name string `json:"name"`
+	Init bool   `json:"init,omitempty"`
+	// State is waiting, running, terminated or unknown
+	State string `json:"state"`
+	// ExitCode is set once the container terminated
+	ExitCode *int32 `json:"exitCode,omitempty"`
+	Signal   int32  `json:"signal,omitempty"`
+	// Reason is the reason of the terminated or waiting state, e.g.
+	// Completed, Error, OOMKilled or ImagePullBackOff
+	Reason   string `json:"reason,omitempty"`
+	Restarts int32  `json:"restarts"`
+	// LastExitCode and LastReason are those of the previous attempt of a
+	// restarted container
+	LastExitCode *int32 `json:"lastExitCode,omitempty"`
+	LastReason   string `json:"lastReason,omitempty"`
+}
+
+// exitCodeMatrix returns the exit code matrix of a Job's pods, ordered by pod name
+func (r *JobHandlerReconciler) exitCodeMatrix(ctx context.Context, job *batchv1.Job) ([]PodExitCodes, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.MatchingLabels{"job-name": job.Name}, client.InNamespace(job.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list job pods: %w", err)
+	}
+
+	matrix := make([]PodExitCodes, 0, len(podList.Items))
+	for _, pod := range podList.Items {
+		row := PodExitCodes{
+			Pod:        pod.Name,
+			Phase:      pod.Status.Phase,
+			Reason:     pod.Status.Reason,
+			Node:       pod.Spec.NodeName,
+			Containers: make([]ContainerExitCode, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses)),
+		}
+		for _, status := range pod.Status.InitContainerStatuses {
+			row.Containers = append(row.Containers, containerExitCode(status, true))
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			row.Containers = append(row.Containers, containerExitCode(status, false))
+		}
+		matrix = append(matrix, row)
+	}
+	slices.SortFunc(matrix, func(a, b PodExitCodes) int {
+		return strings.Compare(a.Pod, b.Pod)
+	})
+	return matrix, nil
+}
+
+func containerExitCode(status corev1.ContainerStatus, init bool) ContainerExitCode {
+	exitCode := ContainerExitCode{
+		Name:     status.Name,
+		Init:     init,
+		State:    ContainerStateUnknown,
+		Restarts: status.RestartCount,
+	}
+	switch {
+	case status.State.Terminated != nil:
+		exitCode.State = ContainerStateTerminated
+		exitCode.ExitCode = &status.State.Terminated.ExitCode
+		exitCode.Signal = status.State.Terminated.Signal
+		exitCode.Reason = status.State.Terminated.Reason
+	case status.State.Running != nil:
+		exitCode.State = ContainerStateRunning
+	case status.State.Waiting != nil:
+		exitCode.State = ContainerStateWaiting
+		exitCode.Reason = status.State.Waiting.Reason
+	}
+	if last := status.LastTerminationState.Terminated; last != nil {
+		exitCode.LastExitCode = &last.ExitCode
+		exitCode.LastReason = last.Reason
+	}
+	return exitCode
+}
+
+// addExitCodes stores the exit code matrix of a Job in its results ConfigMap
+func (r *JobHandlerReconciler) addExitCodes(ctx context.Context, job *batchv1.Job, configMap *corev1.ConfigMap) error {
+	matrix, err := r.exitCodeMatrix(ctx, job)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(matrix)
+	if err != nil {
+		return err
+	}
+	configMap.Data[ExitCodesKey] = string(data)
+	return nil
+}
@@ -0,0 +1,22 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/featuregate"
+
+const (
+	// JobResults owns result ConfigMaps of standalone Jobs by a JobResult
+	JobResults featuregate.Feature = "JobResults"
+	// JobPrioritization processes finished Jobs in order of their priority annotation or priorityClass
+	JobPrioritization featuregate.Feature = "JobPrioritization"
+	// OrphanedPodCleanup deletes pods left behind by Jobs deleted with orphan propagation
+	OrphanedPodCleanup featuregate.Feature = "OrphanedPodCleanup"
+	// FollowUpJobs creates the follow-up Job declared with the on-success annotation of succeeded Jobs
+	FollowUpJobs featuregate.Feature = "FollowUpJobs"
+)
+
+// FeatureGates lists the features of this controller that can be toggled with --feature-gates
+var FeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	JobResults:         {Default: false, Stage: featuregate.Alpha},
+	JobPrioritization:  {Default: false, Stage: featuregate.Alpha, StartupOnly: true},
+	OrphanedPodCleanup: {Default: false, Stage: featuregate.Alpha, StartupOnly: true},
+	FollowUpJobs:       {Default: false, Stage: featuregate.Alpha},
+}
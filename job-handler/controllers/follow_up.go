@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Annotation on a Job naming the ConfigMap, in the Job's namespace, with the
+	// template of the Job to create once it succeeds
+	OnSuccessAnnotation = "job-handler/on-success"
+
+	// Key of the follow-up ConfigMap holding the Job manifest
+	FollowUpTemplateKey = "job.yaml"
+
+	// Annotations on follow-up Jobs and their pods with the Job that created
+	// them and its results ConfigMap
+	FollowUpOfAnnotation    = "job-handler/follow-up-of"
+	ParentResultsAnnotation = "job-handler/parent-results"
+
+	// Event reason when a follow-up Job is created
+	FollowUpCreatedReason = "FollowUpCreated"
+)
+
+// Labels the Job controller sets on the Jobs it manages. They are dropped from
+// templates exported from an existing Job.
+var jobControllerLabels = []string{"controller-uid", "job-name", batchv1.ControllerUidLabel, batchv1.JobNameLabel}
+
+// ParseFollowUpTemplate parses the Job manifest of a follow-up ConfigMap
+func ParseFollowUpTemplate(data string) (*batchv1.Job, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, fmt.Errorf("no Job template in key %s", FollowUpTemplateKey)
+	}
+	job := &batchv1.Job{}
+	if err := yaml.UnmarshalStrict([]byte(data), job); err != nil {
+		return nil, fmt.Errorf("failed to parse Job template: %w", err)
+	}
+	if job.Kind != "" && job.Kind != "Job" {
+		return nil, fmt.Errorf("template is a %s, not a Job", job.Kind)
+	}
+	if len(job.Spec.Template.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("template has no containers")
+	}
+	return job, nil
+}
+
+// followUpJobName returns the name of the follow-up Job of a Job. The name is
+// derived from the Job's UID, so a Job gets a single follow-up however often it
+// is processed, and every run of a CronJob gets its own.
+func followUpJobName(prefix string, job *batchv1.Job) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(job.UID))
+	suffix := fmt.Sprintf("-%08x", hash.Sum32())
+
+	// Job names end up in the job-name label of their pods
+	if maxPrefix := 63 - len(suffix); len(prefix) > maxPrefix {
+		prefix = prefix[:maxPrefix]
+	}
+	return strings.TrimRight(prefix, "-.") + suffix
+}
+
+// newFollowUpJob instantiates the template of a follow-up ConfigMap for a
+// succeeded Job
+func newFollowUpJob(template *batchv1.Job, configMap *corev1.ConfigMap, job *batchv1.Job, resultsConfigMap string) (*batchv1.Job, error) {
+	if template.Namespace != "" && template.Namespace != job.Namespace {
+		return nil, fmt.Errorf("template is in namespace %s, follow-up Jobs are created in the namespace of their Job", template.Namespace)
+	}
+
+	prefix := template.GenerateName
+	if prefix == "" {
+		prefix = template.Name
+	}
+	if prefix == "" {
+		prefix = configMap.Name
+	}
+
+	followUp := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        followUpJobName(prefix, job),
+			Namespace:   job.Namespace,
+			Labels:      maps.Clone(template.Labels),
+			Annotations: maps.Clone(template.Annotations),
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	for _, label := range jobControllerLabels {
+		delete(followUp.Labels, label)
+		delete(followUp.Spec.Template.Labels, label)
+	}
+	// The Job controller generates the selector unless it is managed manually
+	if followUp.Spec.ManualSelector == nil || !*followUp.Spec.ManualSelector {
+		followUp.Spec.Selector = nil
+	}
+
+	// Set on the pods too, so they can read them with the downward API
+	for _, meta := range []*metav1.ObjectMeta{&followUp.ObjectMeta, &followUp.Spec.Template.ObjectMeta} {
+		if meta.Annotations == nil {
+			meta.Annotations = make(map[string]string)
+		}
+		meta.Annotations[FollowUpOfAnnotation] = job.Name
+		meta.Annotations[ParentResultsAnnotation] = resultsConfigMap
+	}
+	return followUp, nil
+}
+
+// createFollowUpJob creates the follow-up Job declared with the on-success
+// annotation of a succeeded Job, if any
+func (r *JobHandlerReconciler) createFollowUpJob(ctx context.Context, job *batchv1.Job, resultsConfigMap string) error {
+	configMapName := job.Annotations[OnSuccessAnnotation]
+	if configMapName == "" || !r.Config.FeatureEnabled(FollowUpJobs, r.FollowUpJobs) {
+		return nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Name: configMapName, Namespace: job.Namespace}, configMap); err != nil {
+		return fmt.Errorf("failed to get follow-up ConfigMap %s: %w", configMapName, err)
+	}
+	template, err := ParseFollowUpTemplate(configMap.Data[FollowUpTemplateKey])
+	if err != nil {
+		return fmt.Errorf("invalid follow-up ConfigMap %s: %w", configMapName, err)
+	}
+	followUp, err := newFollowUpJob(template, configMap, job, resultsConfigMap)
+	if err != nil {
+		return fmt.Errorf("invalid follow-up ConfigMap %s: %w", configMapName, err)
+	}
+
+	err = r.Create(ctx, followUp)
+	if errors.IsAlreadyExists(err) {
+		// Created by an earlier attempt to process the Job
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create follow-up Job %s: %w", followUp.Name, err)
+	}
+
+	log.FromContext(ctx).Info("Created follow-up Job", "followUp", followUp.Name, "configMap", configMapName)
+	r.createFollowUpEvent(ctx, job, fmt.Sprintf("Created follow-up Job %s from ConfigMap %s", followUp.Name, configMapName))
+	return nil
+}
+
+func (r *JobHandlerReconciler) createFollowUpEvent(ctx context.Context, job *batchv1.Job, message string) {
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", job.Name, time.Now().UnixNano()),
+			Namespace: job.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       "Job",
+			Name:       job.Name,
+			Namespace:  job.Namespace,
+			UID:        job.UID,
+			APIVersion: batchv1.SchemeGroupVersion.String(),
+		},
+		Reason:         FollowUpCreatedReason,
+		Message:        message,
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           corev1.EventTypeNormal,
+		Source: corev1.EventSource{
+			Component: "job-handler",
+		},
+	}
+
+	if err := r.Create(ctx, event); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create follow-up event", "job", job.Name)
+	}
+}
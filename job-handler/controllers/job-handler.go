@@ -6,13 +6,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	jobhandlerv1alpha1 "github.com/psrvere/k8s-controllers/job-handler/api/v1alpha1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -20,7 +28,47 @@ import (
 
 type JobHandlerReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme  *runtime.Scheme
+	Backoff *throttle.AdaptiveBackoff
+
+	// EnableJobResults creates a JobResult object to own the results ConfigMap
+	// of Jobs that aren't owned by a CronJob
+	EnableJobResults bool
+
+	// LogClient fetches container logs. When nil only container states are collected.
+	LogClient kubernetes.Interface
+
+	// Artifacts copies the files declared with the artifacts annotation out of
+	// Job pods. Nil disables artifact collection.
+	Artifacts *ArtifactCollector
+
+	// Redactor removes credentials from collected logs before they are stored.
+	// Nil stores logs as they are.
+	Redactor *Redactor
+
+	// ResultQuota limits the results ConfigMaps kept per namespace, oldest
+	// results are evicted first
+	ResultQuota ResultQuota
+	// Namespaces skips objects in namespaces opted out with the ignore label
+	Namespaces *predicates.NamespaceFilter
+	// Config overrides intervals, quotas and feature gates at runtime. Nil keeps the startup configuration.
+	Config *controllerconfig.Config
+
+	// SLOWindow is the rolling window pipeline success rates are computed
+	// over, zero disables SLO tracking
+	SLOWindow time.Duration
+
+	// PrioritizeJobs processes finished Jobs in order of their priority
+	// annotation or priorityClass using a priority queue
+	PrioritizeJobs bool
+
+	// FollowUpJobs creates the Job templated in the ConfigMap named by the
+	// on-success annotation when a Job succeeds
+	FollowUpJobs bool
+
+	// ProcessedJobRetention is how long a processed Job is kept, so its
+	// ResultsProcessed condition can be waited on, before it is deleted
+	ProcessedJobRetention time.Duration
 }
 
 const (
@@ -42,11 +90,22 @@ const (
 	RequeueInterval = 5 * time.Minute
 )
 
+// ResultReason says why a JobProcessingResult has its outcome
+type ResultReason string
+
+// Reasons of a JobProcessingResult, conditions and callers branch on these
+const (
+	ResultProcessingSuccessful ResultReason = "processing successful"
+	ResultProcessingFailed     ResultReason = "processing failed"
+	ResultLogCollectionFailed  ResultReason = "log collection failed"
+	ResultJobFailed            ResultReason = "job failed"
+)
+
 // JobProcessingResult contains the result of job processing
 type JobProcessingResult struct {
 	IsCompleted   bool
 	JobName       string
-	Reason        string
+	Reason        ResultReason
 	Errors        []string
 	Logs          string
 	ConfigMapName string
@@ -65,7 +124,7 @@ func (r JobProcessingResult) Error() string {
 }
 
 // NewJobProcessingResult creates a new job processing result
-func NewJobProcessingResult(isCompleted bool, jobName, reason string, shouldDelete bool, errors ...string) JobProcessingResult {
+func NewJobProcessingResult(isCompleted bool, jobName string, reason ResultReason, shouldDelete bool, errors ...string) JobProcessingResult {
 	return JobProcessingResult{
 		IsCompleted:  isCompleted,
 		JobName:      jobName,
@@ -78,6 +137,11 @@ func NewJobProcessingResult(isCompleted bool, jobName, reason string, shouldDele
 func (r *JobHandlerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
+	// Skip namespaces opted out of all controllers
+	if r.Namespaces.Ignored(ctx, req.Namespace) {
+		return ctrl.Result{}, nil
+	}
+
 	// Fetch the Job
 	job := &batchv1.Job{}
 	err := r.Get(ctx, req.NamespacedName, job)
@@ -100,14 +164,36 @@ func (r *JobHandlerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	// Check if job is already processed
 	if isJobAlreadyProcessed(job) {
-		log.Info("Job already processed, skipping")
+		remaining, deletes := r.retentionRemaining(job)
+		if !deletes {
+			log.Info("Job already processed, skipping")
+			return ctrl.Result{}, nil
+		}
+		if remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+		if err := r.deleteJob(ctx, job); err != nil {
+			log.Error(err, "Failed to delete job after processing")
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		log.Info("Job deleted after its retention")
 		return ctrl.Result{}, nil
 	}
 
 	// Check if job is completed (either success or failure)
 	if !isJobCompleted(job) {
+		// Artifacts have to be copied while the pods are still running
+		pending, err := r.collectArtifacts(ctx, job)
+		if err != nil {
+			log.Error(err, "Failed to collect artifacts")
+		}
+		if pending {
+			log.Info("Job not completed yet, waiting for artifacts", "artifacts", artifactPaths(job))
+			return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ArtifactsPollInterval)}, nil
+		}
+
 		log.Info("Job not completed yet, requeuing")
-		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(30 * time.Second)}, nil
 	}
 
 	// Process the completed job (handles both success and failure)
@@ -117,21 +203,22 @@ func (r *JobHandlerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	updated, err := r.updateJobProcessingStatus(ctx, job, result)
 	if err != nil {
 		log.Error(err, "Failed to update job processing status")
-		return ctrl.Result{}, err
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
 	}
 
 	if updated {
+		// Count every finished Job once, before a successful one is deleted
+		r.recordJobOutcome(ctx, job)
+
 		if result.IsCompleted {
 			log.Info("Job processing completed successfully", "configMap", result.ConfigMapName)
 
-			// Delete the job after successful processing and status update
+			// The Job is deleted once its retention ends, until then its
+			// ResultsProcessed condition can be waited on
 			if result.ShouldDelete {
-				err = r.deleteJob(ctx, job)
-				if err != nil {
-					log.Error(err, "Failed to delete job after processing")
-					return ctrl.Result{}, err
-				}
-				log.Info("Job deleted after successful processing")
+				retention := r.Config.Duration(SettingProcessedJobRetention, r.ProcessedJobRetention)
+				log.Info("Keeping processed Job until its retention ends", "retention", retention)
+				return ctrl.Result{RequeueAfter: retention}, nil
 			}
 		} else {
 			log.Info("Job processing failed", "error", result.Error())
@@ -139,7 +226,7 @@ func (r *JobHandlerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// Requeue after configured interval to check for new jobs
-	return ctrl.Result{RequeueAfter: RequeueInterval}, nil
+	return ctrl.Result{RequeueAfter: r.Backoff.Requeue(r.Config.Duration(SettingRequeueInterval, RequeueInterval))}, nil
 }
 
 func shouldHandleJob(job *batchv1.Job) bool {
@@ -192,24 +279,31 @@ func (r *JobHandlerReconciler) processCompletedJob(ctx context.Context, job *bat
 		err = r.createResultsConfigMap(ctx, job, logs, configMapName)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("failed to create configmap: %v", err))
+		} else {
+			r.evictOldResults(ctx, job, configMapName)
+
+			// Chain the next Job, a Job whose follow-up can't be created is kept
+			if err := r.createFollowUpJob(ctx, job, configMapName); err != nil {
+				errors = append(errors, fmt.Sprintf("failed to create follow-up job: %v", err))
+			}
 		}
 
 		if len(errors) > 0 {
-			return NewJobProcessingResult(false, job.Name, "processing failed", false, errors...)
+			return NewJobProcessingResult(false, job.Name, ResultProcessingFailed, false, errors...)
 		}
 
 		// Don't delete job here - let the caller handle it after status update
-		result := NewJobProcessingResult(true, job.Name, "processing successful", true)
+		result := NewJobProcessingResult(true, job.Name, ResultProcessingSuccessful, true)
 		result.Logs = logs // Keep logs for debugging and future extensibility
 		result.ConfigMapName = configMapName
 		return result
 	} else {
 		// Handle failed job - just collect logs, don't delete job
 		if len(errors) > 0 {
-			return NewJobProcessingResult(false, job.Name, "log collection failed", false, errors...)
+			return NewJobProcessingResult(false, job.Name, ResultLogCollectionFailed, false, errors...)
 		}
 
-		result := NewJobProcessingResult(false, job.Name, "job failed", false, "job did not complete successfully")
+		result := NewJobProcessingResult(false, job.Name, ResultJobFailed, false, "job did not complete successfully")
 		result.Logs = logs // Keep logs for debugging and future extensibility
 		return result
 	}
@@ -231,55 +325,37 @@ func (r *JobHandlerReconciler) collectJobLogs(ctx context.Context, job *batchv1.
 		return "No pods found for job", nil
 	}
 
-	// Collect logs from each pod
+	// Collect logs from each pod until the job log limit is reached, the logs
+	// of the remaining pods aren't fetched
+	omitted := 0
 	for _, pod := range podList.Items {
+		remaining := MaxJobLogBytes - allLogs.Len()
+		if remaining <= 0 {
+			omitted++
+			continue
+		}
 		podLogs, err := r.getPodLogs(ctx, &pod)
 		if err != nil {
-			allLogs.WriteString(fmt.Sprintf("Failed to get logs for pod %s: %v\n", pod.Name, err))
+			allLogs.WriteString(truncateLogs(fmt.Sprintf("Failed to get logs for pod %s: %v\n", pod.Name, err), remaining))
 			continue
 		}
-		allLogs.WriteString(fmt.Sprintf("=== Pod: %s ===\n", pod.Name))
-		allLogs.WriteString(podLogs)
-		allLogs.WriteString("\n")
+		section := fmt.Sprintf("=== Pod: %s ===\n%s\n", pod.Name, r.redactPodLogs(ctx, &pod, podLogs))
+		allLogs.WriteString(truncateLogs(section, remaining))
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&allLogs, "=== Logs of %d more pods omitted, job log limit of %d bytes reached ===\n", omitted, MaxJobLogBytes)
 	}
 
 	return allLogs.String(), nil
 }
 
 func (r *JobHandlerReconciler) getPodLogs(ctx context.Context, pod *corev1.Pod) (string, error) {
-	// For now, we'll use a simplified approach since controller-runtime client
-	// doesn't directly support log retrieval. In a production environment,
-	// you would typically:
-	// 1. Use a separate Kubernetes client for log retrieval
-	// 2. Use a sidecar container for log collection
-	// 3. Use a logging service like Fluentd or ELK stack
-
-	// Check if pod is still running or recently terminated
-	if pod.Status.Phase == corev1.PodRunning ||
-		pod.Status.Phase == corev1.PodSucceeded ||
-		pod.Status.Phase == corev1.PodFailed {
-
-		// Get container statuses for more detailed information
-		var containerLogs []string
-		for _, container := range pod.Status.ContainerStatuses {
-			if container.Ready || container.State.Terminated != nil {
-				containerLogs = append(containerLogs,
-					fmt.Sprintf("Container: %s, State: %s",
-						container.Name,
-						getContainerState(container.State)))
-			}
-		}
-
-		if len(containerLogs) > 0 {
-			return fmt.Sprintf("Pod: %s\nPhase: %s\n%s",
-				pod.Name,
-				pod.Status.Phase,
-				strings.Join(containerLogs, "\n")), nil
-		}
-	}
-
-	return fmt.Sprintf("Pod: %s\nPhase: %s\nNote: Actual logs would be retrieved via Kubernetes API in production",
-		pod.Name, pod.Status.Phase), nil
+	// Pending pods are included, failed init containers and image pulls keep
+	// a pod pending
+	return fmt.Sprintf("Pod: %s\nPhase: %s\n%s",
+		pod.Name,
+		pod.Status.Phase,
+		r.collectContainerLogs(ctx, pod)), nil
 }
 
 func getContainerState(state corev1.ContainerState) string {
@@ -297,16 +373,22 @@ func getContainerState(state corev1.ContainerState) string {
 }
 
 func (r *JobHandlerReconciler) createResultsConfigMap(ctx context.Context, job *batchv1.Job, logs, configMapName string) error {
+	// Tie the ConfigMap to the Job's logical owner so it is garbage collected with it
+	ownerRef, err := r.resultOwnerReference(ctx, job, configMapName)
+	if err != nil {
+		return fmt.Errorf("failed to determine result owner: %w", err)
+	}
+
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      configMapName,
 			Namespace: job.Namespace,
 			Labels: map[string]string{
-				"job-handler/created": "true",
-				"job-name":            job.Name,
+				ResultsLabel: "true",
+				"job-name":   job.Name,
 			},
 			Annotations: map[string]string{
-				"job-handler/created-at": time.Now().Format(time.RFC3339),
+				ResultsCreatedAtAnnotation: time.Now().Format(time.RFC3339),
 			},
 		},
 		Data: map[string]string{
@@ -316,8 +398,22 @@ func (r *JobHandlerReconciler) createResultsConfigMap(ctx context.Context, job *
 			"status":          "completed",
 		},
 	}
+	if ownerRef != nil {
+		configMap.OwnerReferences = []metav1.OwnerReference{*ownerRef}
+	}
+
+	// Point to the collected artifacts, if any
+	artifacts := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Name: artifactsConfigMapName(job), Namespace: job.Namespace}, artifacts); err == nil {
+		configMap.Data["artifacts"] = artifacts.Name
+	}
+
+	// Pod -> container -> exit code table for triage tooling
+	if err := r.addExitCodes(ctx, job, configMap); err != nil {
+		return fmt.Errorf("failed to build exit code matrix: %w", err)
+	}
 
-	err := r.Create(ctx, configMap)
+	err = r.Create(ctx, configMap)
 	if err != nil {
 		if errors.IsAlreadyExists(err) {
 			// ConfigMap already exists, update it
@@ -327,6 +423,63 @@ func (r *JobHandlerReconciler) createResultsConfigMap(ctx context.Context, job *
 	return err
 }
 
+// resultOwnerReference returns the owner reference for a Job's result objects.
+// Jobs created by a CronJob hand their results to the CronJob, so results are
+// cleaned up when the CronJob is deleted. Standalone Jobs get a dedicated
+// JobResult object when enabled. Returns nil when the results stay unowned.
+func (r *JobHandlerReconciler) resultOwnerReference(ctx context.Context, job *batchv1.Job, configMapName string) (*metav1.OwnerReference, error) {
+	for _, owner := range job.OwnerReferences {
+		if owner.Kind == "CronJob" && owner.APIVersion == batchv1.SchemeGroupVersion.String() {
+			return &metav1.OwnerReference{
+				APIVersion: owner.APIVersion,
+				Kind:       owner.Kind,
+				Name:       owner.Name,
+				UID:        owner.UID,
+			}, nil
+		}
+	}
+
+	if !r.Config.FeatureEnabled(JobResults, r.EnableJobResults) {
+		return nil, nil
+	}
+
+	jobResult := &jobhandlerv1alpha1.JobResult{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName,
+			Namespace: job.Namespace,
+			Labels: map[string]string{
+				"job-handler/created": "true",
+				"job-name":            job.Name,
+			},
+		},
+		Spec: jobhandlerv1alpha1.JobResultSpec{
+			JobName:        job.Name,
+			JobUID:         job.UID,
+			ConfigMapName:  configMapName,
+			Succeeded:      job.Status.CompletionTime != nil,
+			CompletionTime: job.Status.CompletionTime,
+		},
+	}
+
+	err := r.Create(ctx, jobResult)
+	if err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		// JobResult exists from an earlier attempt, reuse it
+		if err := r.Get(ctx, client.ObjectKeyFromObject(jobResult), jobResult); err != nil {
+			return nil, err
+		}
+	}
+
+	return &metav1.OwnerReference{
+		APIVersion: jobhandlerv1alpha1.GroupVersion.String(),
+		Kind:       "JobResult",
+		Name:       jobResult.Name,
+		UID:        jobResult.UID,
+	}, nil
+}
+
 func (r *JobHandlerReconciler) deleteJob(ctx context.Context, job *batchv1.Job) error {
 	// Use propagation policy to ensure dependent objects are also deleted
 	propagationPolicy := metav1.DeletePropagationBackground
@@ -375,8 +528,15 @@ func (r *JobHandlerReconciler) updateJobProcessingStatus(ctx context.Context, jo
 		}
 	}
 
-	err := r.Update(ctx, jobCopy)
-	return true, err
+	if err := r.Update(ctx, jobCopy); err != nil {
+		return false, err
+	}
+
+	// Mirror the result as a status condition on the updated Job
+	if err := r.patchResultsCondition(ctx, jobCopy, result); err != nil {
+		return true, fmt.Errorf("failed to patch results condition: %w", err)
+	}
+	return true, nil
 }
 
 func getProcessingStatus(job *batchv1.Job) string {
@@ -437,8 +597,19 @@ func (r *JobHandlerReconciler) createProcessingEvent(ctx context.Context, job *b
 }
 
 func (r *JobHandlerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&batchv1.Job{}).
+	builder := ctrl.NewControllerManagedBy(mgr)
+	if r.PrioritizeJobs {
+		// Finished Jobs are processed in order of their priority annotation or priorityClass
+		builder = builder.
+			Named("job").
+			Watches(&batchv1.Job{}, r.enqueueJobByPriority()).
+			WithOptions(controller.Options{UsePriorityQueue: ptr.To(true)})
+	} else {
+		builder = builder.For(&batchv1.Job{})
+	}
+
+	return builder.
+		WithEventFilter(r.Namespaces.Predicate()).
 		WithEventFilter(predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool {
 				log := log.FromContext(context.Background())
@@ -479,7 +650,7 @@ func (r *JobHandlerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return false
 			},
 		}).
-		Complete(r)
+		Complete(recovery.Wrap("job-handler", r))
 }
 
 func hasHandlerLabelChanged(old, new *batchv1.Job) bool {
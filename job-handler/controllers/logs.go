@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// Log limits per container keep the results within the 1MiB ConfigMap limit
+	LogTailLines    = int64(100)
+	MaxLogBytes     = int64(32 * 1024)
+	initContainerID = "init"
+
+	// Limit on the logs of all pods of a Job together, leaving room in the
+	// results ConfigMap for its other keys. Jobs with many pods or restarts
+	// would exceed the ConfigMap limit with the per container limits alone.
+	MaxJobLogBytes = 768 * 1024
+)
+
+// truncateLogs cuts logs to at most limit bytes at a line boundary, so
+// multi-byte characters aren't split, and marks the cut
+func truncateLogs(logs string, limit int) string {
+	const marker = "... truncated, job log limit reached\n"
+	if len(logs) <= limit {
+		return logs
+	}
+	cut := strings.LastIndexByte(logs[:max(limit-len(marker), 0)], '\n') + 1
+	return logs[:cut] + marker
+}
+
+// collectContainerLogs describes every init and regular container of a pod. Logs
+// of the current attempt are included, plus the previous attempt of containers
+// that restarted, since image and setup failures usually surface there.
+func (r *JobHandlerReconciler) collectContainerLogs(ctx context.Context, pod *corev1.Pod) string {
+	var logs strings.Builder
+
+	statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+
+	for i, status := range statuses {
+		kind := ""
+		if i < len(pod.Status.InitContainerStatuses) {
+			kind = " (" + initContainerID + ")"
+		}
+		fmt.Fprintf(&logs, "Container: %s%s, State: %s, Restarts: %d\n",
+			status.Name, kind, getContainerState(status.State), status.RestartCount)
+
+		if r.LogClient == nil {
+			continue
+		}
+
+		// Containers that never started have no logs
+		if status.State.Waiting == nil || status.LastTerminationState.Terminated != nil {
+			r.writeContainerLogs(ctx, &logs, pod, status.Name, false)
+		}
+		if status.RestartCount > 0 && status.LastTerminationState.Terminated != nil {
+			fmt.Fprintf(&logs, "--- previous attempt: %s ---\n", getContainerState(status.LastTerminationState))
+			r.writeContainerLogs(ctx, &logs, pod, status.Name, true)
+		}
+	}
+
+	return logs.String()
+}
+
+// writeContainerLogs appends the logs of one container. Failures are written
+// inline so a single missing log doesn't fail the whole collection.
+func (r *JobHandlerReconciler) writeContainerLogs(ctx context.Context, logs *strings.Builder, pod *corev1.Pod, container string, previous bool) {
+	content, err := r.getContainerLogs(ctx, pod, container, previous)
+	if err != nil {
+		fmt.Fprintf(logs, "Failed to get logs: %v\n", err)
+		return
+	}
+	logs.WriteString(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		logs.WriteString("\n")
+	}
+}
+
+func (r *JobHandlerReconciler) getContainerLogs(ctx context.Context, pod *corev1.Pod, container string, previous bool) (string, error) {
+	stream, err := r.LogClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container:  container,
+		Previous:   previous,
+		TailLines:  ptr.To(LogTailLines),
+		LimitBytes: ptr.To(MaxLogBytes),
+	}).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Manifest describes the permissions of the job-handler for the manifests
+// subcommand. The JobResult CRD is added by main, which embeds it.
+func Manifest() manifests.Manifest {
+	return manifests.Manifest{
+		Controller: "job-handler",
+		Rules: []rbacv1.PolicyRule{
+			// Read, update and delete Jobs, create follow-up Jobs (FollowUpJobs)
+			{APIGroups: []string{"batch"}, Resources: []string{"jobs"}, Verbs: []string{"get", "list", "watch", "create", "update", "delete"}},
+			// Patch the ResultsProcessed condition
+			{APIGroups: []string{"batch"}, Resources: []string{"jobs/status"}, Verbs: []string{"patch"}},
+			// Log collection, and annotate and delete pods of deleted Jobs (OrphanedPodCleanup)
+			{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch", "patch", "delete"}},
+			{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{""}, Resources: []string{"pods/log"}, Verbs: []string{"get"}},
+			// Copy artifacts out of Job pods (--collect-artifacts)
+			{APIGroups: []string{""}, Resources: []string{"pods/exec"}, Verbs: []string{"create"}},
+			// Values referenced by Job pods, redacted from logs
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+			// Results, and evicting the oldest results over the namespace quota
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list", "watch", "create", "update", "delete"}},
+			// JobResults owning the results of standalone Jobs, deleted after --job-result-ttl or with evicted results
+			{APIGroups: []string{"jobhandler.example.com"}, Resources: []string{"jobresults"}, Verbs: []string{"get", "list", "watch", "create", "delete"}},
+			// Order finished Jobs by their pods' priority (JobPrioritization)
+			{APIGroups: []string{"scheduling.k8s.io"}, Resources: []string{"priorityclasses"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"get", "create"}},
+		},
+	}
+}
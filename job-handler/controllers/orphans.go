@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// Annotation on orphaned pods with the time they were found orphaned
+	OrphanedSinceAnnotation = "job-handler/orphaned-since"
+
+	// Default time an orphaned pod is kept before it is deleted
+	DefaultOrphanedPodGracePeriod = 10 * time.Minute
+
+	// Event reasons for orphaned pods
+	OrphanedPodDetectedReason = "OrphanedPodDetected"
+	OrphanedPodDeletedReason  = "OrphanedPodDeleted"
+)
+
+// Labels the Job controller sets on the pods of a Job. The legacy labels are
+// still set next to the batch.kubernetes.io ones.
+var (
+	jobNameLabels       = []string{batchv1.JobNameLabel, "job-name"}
+	controllerUIDLabels = []string{batchv1.ControllerUidLabel, "controller-uid"}
+)
+
+// OrphanedPodReconciler deletes pods left behind by Jobs that were deleted
+// with orphan propagation, e.g. kubectl delete job --cascade=orphan. Such pods
+// keep the job-name label but lose their owner reference, so the garbage
+// collector never deletes them. They are deleted after a grace period.
+type OrphanedPodReconciler struct {
+	client.Client
+	Backoff *throttle.AdaptiveBackoff
+
+	// Namespaces skips pods in namespaces opted out with the ignore label
+	Namespaces *predicates.NamespaceFilter
+	// Config overrides the grace period at runtime. Nil keeps the startup configuration.
+	Config *controllerconfig.Config
+
+	// GracePeriod is the time an orphaned pod is kept before it is deleted
+	GracePeriod time.Duration
+}
+
+func (r *OrphanedPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if r.Namespaces.Ignored(ctx, req.Namespace) {
+		return ctrl.Result{}, nil
+	}
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if pod.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	jobName, orphaned, err := r.orphanedFrom(ctx, pod)
+	if err != nil {
+		log.Error(err, "Failed to get job of pod", "pod", pod.Name, "job", jobName)
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if !orphaned {
+		// The pod was adopted, or a Job with its name and UID exists again
+		if _, exists := pod.Annotations[OrphanedSinceAnnotation]; exists {
+			return ctrl.Result{}, r.setOrphanedSince(ctx, pod, "")
+		}
+		return ctrl.Result{}, nil
+	}
+
+	gracePeriod := r.Config.Duration(SettingOrphanedPodGracePeriod, r.GracePeriod)
+	since, err := time.Parse(time.RFC3339, pod.Annotations[OrphanedSinceAnnotation])
+	if err != nil {
+		// First time the pod is found orphaned, or the annotation was tampered with
+		now := time.Now()
+		if err := r.setOrphanedSince(ctx, pod, now.Format(time.RFC3339)); err != nil {
+			log.Error(err, "Failed to annotate orphaned pod", "pod", pod.Name)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		log.Info("Found pod of deleted job", "pod", pod.Name, "namespace", pod.Namespace, "job", jobName, "gracePeriod", gracePeriod)
+		err := r.createOrphanEvent(ctx, pod, OrphanedPodDetectedReason, corev1.EventTypeWarning,
+			fmt.Sprintf("Job %s no longer exists, the pod is deleted after %s", jobName, gracePeriod))
+		if err != nil {
+			log.Error(err, "Failed to create orphaned pod event", "pod", pod.Name)
+		}
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(gracePeriod)}, nil
+	}
+
+	if remaining := gracePeriod - time.Since(since); remaining > 0 {
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(remaining)}, nil
+	}
+
+	// The UID precondition keeps a recreated pod with the same name alive
+	err = r.Delete(ctx, pod, client.Preconditions{UID: &pod.UID})
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to delete orphaned pod", "pod", pod.Name)
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	log.Info("Deleted pod of deleted job", "pod", pod.Name, "namespace", pod.Namespace, "job", jobName, "orphanedSince", since)
+	err = r.createOrphanEvent(ctx, pod, OrphanedPodDeletedReason, corev1.EventTypeNormal,
+		fmt.Sprintf("Deleted pod left behind by deleted Job %s, orphaned for %s", jobName, time.Since(since).Round(time.Second)))
+	if err != nil {
+		log.Error(err, "Failed to create orphaned pod event", "pod", pod.Name)
+	}
+	return ctrl.Result{}, nil
+}
+
+// orphanedFrom returns the Job a pod belonged to and whether that Job is
+// gone. A Job recreated with the same name doesn't adopt the pod, its UID
+// differs from the controller-uid label.
+func (r *OrphanedPodReconciler) orphanedFrom(ctx context.Context, pod *corev1.Pod) (string, bool, error) {
+	jobName := podLabel(pod, jobNameLabels)
+	if !isOrphanCandidate(pod) {
+		return jobName, false, nil
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Name: jobName, Namespace: pod.Namespace}, job)
+	if errors.IsNotFound(err) {
+		return jobName, true, nil
+	}
+	if err != nil {
+		return jobName, false, err
+	}
+	return jobName, podLabel(pod, controllerUIDLabels) != string(job.UID), nil
+}
+
+// isOrphanCandidate returns true for pods of a Job without a controller. Pods
+// still owned by a deleted Job are left to the garbage collector. Both the
+// job-name and the controller-uid label are required, the Job controller sets
+// them together and a bare job-name label is easily set by something else.
+func isOrphanCandidate(pod *corev1.Pod) bool {
+	return podLabel(pod, jobNameLabels) != "" && podLabel(pod, controllerUIDLabels) != "" &&
+		metav1.GetControllerOf(pod) == nil
+}
+
+func podLabel(pod *corev1.Pod, keys []string) string {
+	for _, key := range keys {
+		if value := pod.Labels[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// setOrphanedSince sets the orphaned-since annotation of a pod, an empty
+// value removes it
+func (r *OrphanedPodReconciler) setOrphanedSince(ctx context.Context, pod *corev1.Pod, value string) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	if value == "" {
+		delete(pod.Annotations, OrphanedSinceAnnotation)
+	} else {
+		if pod.Annotations == nil {
+			pod.Annotations = make(map[string]string)
+		}
+		pod.Annotations[OrphanedSinceAnnotation] = value
+	}
+	return r.Patch(ctx, pod, patch)
+}
+
+func (r *OrphanedPodReconciler) createOrphanEvent(ctx context.Context, pod *corev1.Pod, reason, eventType, message string) error {
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", pod.Name, time.Now().UnixNano()),
+			Namespace: pod.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Pod",
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			APIVersion:      "v1",
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: "job-handler",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
+
+func (r *OrphanedPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("orphaned-pod").
+		For(&corev1.Pod{}).
+		WithEventFilter(r.Namespaces.Predicate()).
+		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			// Annotated pods are watched until they are adopted or deleted
+			pod, ok := obj.(*corev1.Pod)
+			return ok && (isOrphanCandidate(pod) || pod.Annotations[OrphanedSinceAnnotation] != "")
+		})).
+		Complete(recovery.Wrap("orphaned-pod", r))
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/priorityqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Annotation on Jobs with the queue priority of their results, higher
+	// values are processed first. Without it the value of the priorityClass
+	// of the Job's pods is used.
+	PriorityAnnotation = "job-handler/priority"
+
+	// Queue priority of finished Jobs without a priority annotation or priorityClass
+	DefaultJobPriority = 0
+
+	// Queue priority of Jobs with nothing to process yet: still running,
+	// already processed or not handled at all
+	IdleJobPriority = handler.LowPriority
+)
+
+// jobPriority returns the queue priority of a Job event
+func (r *JobHandlerReconciler) jobPriority(ctx context.Context, job *batchv1.Job) int {
+	if !shouldHandleJob(job) || !isJobCompleted(job) || isJobAlreadyProcessed(job) {
+		return IdleJobPriority
+	}
+
+	if value, exists := job.Annotations[PriorityAnnotation]; exists {
+		if priority, err := strconv.Atoi(value); err == nil {
+			return priority
+		}
+	}
+
+	// The priorityClass is read from the cache, an unknown class counts as none
+	if name := job.Spec.Template.Spec.PriorityClassName; name != "" {
+		priorityClass := &schedulingv1.PriorityClass{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name}, priorityClass); err == nil {
+			return int(priorityClass.Value)
+		}
+	}
+	return DefaultJobPriority
+}
+
+// enqueueJobByPriority enqueues Jobs with the priority of their results, so
+// critical pipeline results are published before bulk batch work. Without a
+// priority queue all Jobs are enqueued alike.
+func (r *JobHandlerReconciler) enqueueJobByPriority() handler.EventHandler {
+	enqueue := func(ctx context.Context, obj client.Object, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+		priority := IdleJobPriority
+		if job, ok := obj.(*batchv1.Job); ok {
+			priority = r.jobPriority(ctx, job)
+		}
+		addWithPriority(q, obj, priority)
+	}
+
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, e.Object, q)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, e.ObjectNew, q)
+		},
+		DeleteFunc: func(_ context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			addWithPriority(q, e.Object, IdleJobPriority)
+		},
+		GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, e.Object, q)
+		},
+	}
+}
+
+func addWithPriority(q workqueue.TypedRateLimitingInterface[reconcile.Request], obj client.Object, priority int) {
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(obj)}
+
+	if priorityQueue, ok := q.(priorityqueue.PriorityQueue[reconcile.Request]); ok {
+		priorityQueue.AddWithOpts(priorityqueue.AddOpts{Priority: priority}, req)
+		return
+	}
+	q.Add(req)
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Label on every results ConfigMap created by the controller
+	ResultsLabel = "job-handler/created"
+
+	// Annotation with the creation time of a results ConfigMap
+	ResultsCreatedAtAnnotation = "job-handler/created-at"
+
+	// Namespace annotations overriding the result quota of the controller
+	MaxResultsAnnotation      = "job-handler/max-results"
+	MaxResultsBytesAnnotation = "job-handler/max-results-size"
+
+	// Event reason when results are evicted to stay within the quota
+	ResultsEvictedReason = "ResultsEvicted"
+)
+
+// ResultQuota limits the results ConfigMaps kept per namespace. A zero limit
+// is unlimited.
+type ResultQuota struct {
+	// MaxCount is the maximum number of results ConfigMaps
+	MaxCount int
+	// MaxBytes is the maximum total data size of the results ConfigMaps
+	MaxBytes int64
+}
+
+func (q ResultQuota) unlimited() bool {
+	return q.MaxCount <= 0 && q.MaxBytes <= 0
+}
+
+// namespaceResultQuota returns the controller's quota with the overrides
+// annotated on the namespace applied
+func (r *JobHandlerReconciler) namespaceResultQuota(ctx context.Context, namespace string) (ResultQuota, error) {
+	quota := ResultQuota{
+		MaxCount: r.Config.Int(SettingMaxResultsPerNamespace, r.ResultQuota.MaxCount),
+		MaxBytes: int64(r.Config.Int(SettingMaxResultsSizePerNamespace, int(r.ResultQuota.MaxBytes))),
+	}
+
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		if errors.IsNotFound(err) {
+			return quota, nil
+		}
+		return quota, err
+	}
+
+	if value, exists := ns.Annotations[MaxResultsAnnotation]; exists {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			return quota, fmt.Errorf("invalid %s annotation %q on namespace %s", MaxResultsAnnotation, value, namespace)
+		}
+		quota.MaxCount = count
+	}
+	if value, exists := ns.Annotations[MaxResultsBytesAnnotation]; exists {
+		size, err := resource.ParseQuantity(value)
+		if err != nil || size.Sign() < 0 {
+			return quota, fmt.Errorf("invalid %s annotation %q on namespace %s", MaxResultsBytesAnnotation, value, namespace)
+		}
+		quota.MaxBytes = size.Value()
+	}
+	return quota, nil
+}
+
+// enforceResultQuota deletes the oldest results ConfigMaps of the Job's
+// namespace until the namespace is within its quota. The results of the Job
+// itself are never deleted. Returns the names of the deleted ConfigMaps.
+func (r *JobHandlerReconciler) enforceResultQuota(ctx context.Context, job *batchv1.Job, configMapName string) ([]string, error) {
+	log := log.FromContext(ctx)
+
+	quota, err := r.namespaceResultQuota(ctx, job.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if quota.unlimited() {
+		return nil, nil
+	}
+
+	configMapList := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMapList, client.InNamespace(job.Namespace), client.MatchingLabels{ResultsLabel: "true"}); err != nil {
+		return nil, fmt.Errorf("failed to list results: %w", err)
+	}
+
+	results := configMapList.Items
+	sort.SliceStable(results, func(i, j int) bool {
+		return resultCreatedAt(&results[i]).Before(resultCreatedAt(&results[j]))
+	})
+
+	count := len(results)
+	var totalBytes int64
+	for i := range results {
+		totalBytes += configMapSize(&results[i])
+	}
+
+	var evicted []string
+	for i := range results {
+		if !exceedsQuota(quota, count, totalBytes) {
+			break
+		}
+		result := &results[i]
+		if result.Name == configMapName {
+			continue
+		}
+
+		if err := r.Delete(ctx, result); err != nil && !errors.IsNotFound(err) {
+			return evicted, fmt.Errorf("failed to evict results %s: %w", result.Name, err)
+		}
+		if err := r.deleteJobResultOf(ctx, result); err != nil {
+			return evicted, fmt.Errorf("failed to delete JobResult of evicted results %s: %w", result.Name, err)
+		}
+		count--
+		totalBytes -= configMapSize(result)
+		evicted = append(evicted, result.Name)
+	}
+
+	if exceedsQuota(quota, count, totalBytes) {
+		log.Info("Results of the job alone exceed the namespace quota", "configMap", configMapName, "maxBytes", quota.MaxBytes, "bytes", totalBytes)
+	}
+	if len(evicted) > 0 {
+		log.Info("Evicted oldest results to stay within the namespace quota", "namespace", job.Namespace, "evicted", evicted)
+	}
+	return evicted, nil
+}
+
+// evictOldResults enforces the result quota after a Job's results were stored.
+// Failures are logged, the Job's own results are already safe.
+func (r *JobHandlerReconciler) evictOldResults(ctx context.Context, job *batchv1.Job, configMapName string) {
+	log := log.FromContext(ctx)
+
+	evicted, err := r.enforceResultQuota(ctx, job, configMapName)
+	if err != nil {
+		log.Error(err, "Failed to enforce result quota", "namespace", job.Namespace)
+	}
+	if len(evicted) == 0 {
+		return
+	}
+	if err := r.createResultsEvictedEvent(ctx, job, evicted); err != nil {
+		log.Error(err, "Failed to create results evicted event", "job", job.Name)
+	}
+}
+
+func exceedsQuota(quota ResultQuota, count int, totalBytes int64) bool {
+	return (quota.MaxCount > 0 && count > quota.MaxCount) || (quota.MaxBytes > 0 && totalBytes > quota.MaxBytes)
+}
+
+// resultCreatedAt returns when a results ConfigMap was written, falling back to
+// the object's creation time for results without a valid annotation
+func resultCreatedAt(configMap *corev1.ConfigMap) time.Time {
+	if value, exists := configMap.Annotations[ResultsCreatedAtAnnotation]; exists {
+		if createdAt, err := time.Parse(time.RFC3339, value); err == nil {
+			return createdAt
+		}
+	}
+	return configMap.CreationTimestamp.Time
+}
+
+func configMapSize(configMap *corev1.ConfigMap) int64 {
+	var size int64
+	for key, value := range configMap.Data {
+		size += int64(len(key) + len(value))
+	}
+	for key, value := range configMap.BinaryData {
+		size += int64(len(key) + len(value))
+	}
+	return size
+}
+
+func (r *JobHandlerReconciler) createResultsEvictedEvent(ctx context.Context, job *batchv1.Job, evicted []string) error {
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", job.Name, time.Now().UnixNano()),
+			Namespace: job.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Job",
+			Name:            job.Name,
+			Namespace:       job.Namespace,
+			UID:             job.UID,
+			APIVersion:      "batch/v1",
+			ResourceVersion: job.ResourceVersion,
+		},
+		Reason:         ResultsEvictedReason,
+		Message:        fmt.Sprintf("Evicted %d oldest result ConfigMap(s) to stay within the namespace quota: %v", len(evicted), evicted),
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           corev1.EventTypeNormal,
+		Source: corev1.EventSource{
+			Component: "job-handler",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
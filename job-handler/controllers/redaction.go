@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// Secret values shorter than this are not redacted, values like "1" or "true"
+// would garble the logs without protecting anything
+const MinRedactedValueLength = 6
+
+// DefaultRedactionPatterns match common credential formats
+var DefaultRedactionPatterns = []RedactionPattern{
+	{Name: "private-key", Regex: `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+	{Name: "bearer-token", Regex: `(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`},
+	{Name: "jwt", Regex: `eyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`},
+	{Name: "aws-access-key", Regex: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "github-token", Regex: `\bgh[pousr]_[A-Za-z0-9]{36,}\b`},
+	{Name: "url-credentials", Regex: `(://[^/\s:@]+:)[^/\s@]+(@)`},
+	{Name: "key-value", Regex: `(?i)((?:password|passwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[:=]\s*["']?)[^\s"',;\[][^\s"',;]*`},
+}
+
+// RedactionPattern replaces every match of a regular expression. The first
+// capture group is kept in front of the replacement and the second after it,
+// e.g. the "password=" prefix of a key-value pair.
+type RedactionPattern struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
+
+	regex *regexp.Regexp
+}
+
+// RedactionConfig configures the redaction of collected logs. It is loaded
+// from a YAML file, typically a mounted ConfigMap.
+type RedactionConfig struct {
+	// Patterns are applied in addition to the default patterns
+	Patterns []RedactionPattern `json:"patterns,omitempty"`
+
+	// DisableDefaultPatterns only applies the configured patterns
+	DisableDefaultPatterns bool `json:"disableDefaultPatterns,omitempty"`
+
+	// DisableSecretValues stops redacting the values of Secrets referenced by
+	// the environment of the Job's containers
+	DisableSecretValues bool `json:"disableSecretValues,omitempty"`
+}
+
+// Redactor removes credentials from logs before they are stored
+type Redactor struct {
+	// SecretReader reads the Secrets referenced by pods. It should bypass the
+	// cache, so Secrets of the whole cluster aren't watched and kept in memory.
+	SecretReader client.Reader
+
+	patterns     []RedactionPattern
+	secretValues bool
+}
+
+// LoadRedactionConfig reads and validates a redaction config file
+func LoadRedactionConfig(path string) (*RedactionConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redaction config: %w", err)
+	}
+
+	config := &RedactionConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse redaction config: %w", err)
+	}
+	return config, nil
+}
+
+// NewRedactor creates a Redactor from a config. A nil config applies the
+// default patterns and redacts referenced Secret values.
+func NewRedactor(config *RedactionConfig, secretReader client.Reader) (*Redactor, error) {
+	if config == nil {
+		config = &RedactionConfig{}
+	}
+
+	var patterns []RedactionPattern
+	if !config.DisableDefaultPatterns {
+		patterns = append(patterns, DefaultRedactionPatterns...)
+	}
+	patterns = append(patterns, config.Patterns...)
+
+	for i := range patterns {
+		pattern := &patterns[i]
+		if pattern.Name == "" {
+			return nil, fmt.Errorf("redaction pattern %d has no name", i)
+		}
+		regex, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex of redaction pattern %s: %w", pattern.Name, err)
+		}
+		pattern.regex = regex
+	}
+
+	return &Redactor{
+		SecretReader: secretReader,
+		patterns:     patterns,
+		secretValues: !config.DisableSecretValues,
+	}, nil
+}
+
+// redactPodLogs removes the values of Secrets referenced by the pod and
+// pattern matches from its logs. When a referenced Secret can't be read, its
+// values can't be found, so the logs are withheld instead of stored unredacted.
+func (r *JobHandlerReconciler) redactPodLogs(ctx context.Context, pod *corev1.Pod, logs string) string {
+	if r.Redactor == nil {
+		return logs
+	}
+
+	values, err := r.podSecretValues(ctx, pod)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Withholding logs that can't be redacted", "pod", pod.Name)
+		return fmt.Sprintf("Logs withheld: %v\n", err)
+	}
+	return r.Redactor.redact(logs, values)
+}
+
+// podSecretValues returns the Secret values redacted from the logs and
+// artifacts of a pod, none when Secret values aren't redacted
+func (r *JobHandlerReconciler) podSecretValues(ctx context.Context, pod *corev1.Pod) ([]secretValue, error) {
+	if r.Redactor == nil || !r.Redactor.secretValues {
+		return nil, nil
+	}
+	return r.Redactor.referencedSecretValues(ctx, pod)
+}
+
+// secretValue is a value of a Secret and its replacement
+type secretValue struct {
+	value       string
+	replacement string
+}
+
+// referencedSecretValues returns the values of the Secret keys the
+// environment of the pod's containers refers to, longest first so values
+// containing other values are replaced as a whole
+func (r *Redactor) referencedSecretValues(ctx context.Context, pod *corev1.Pod) ([]secretValue, error) {
+	// Secret name -> referenced keys, nil for every key (envFrom)
+	references := make(map[string]map[string]bool)
+	reference := func(name, key string) {
+		keys, exists := references[name]
+		if key == "" {
+			references[name] = nil
+			return
+		}
+		if !exists {
+			keys = make(map[string]bool)
+			references[name] = keys
+		}
+		if keys != nil {
+			keys[key] = true
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				reference(env.ValueFrom.SecretKeyRef.Name, env.ValueFrom.SecretKeyRef.Key)
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				reference(envFrom.SecretRef.Name, "")
+			}
+		}
+	}
+
+	var values []secretValue
+	for name, keys := range references {
+		secret := &corev1.Secret{}
+		err := r.SecretReader.Get(ctx, client.ObjectKey{Name: name, Namespace: pod.Namespace}, secret)
+		if errors.IsNotFound(err) {
+			// Optional references to missing Secrets put nothing into the environment
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s for redaction: %w", name, err)
+		}
+
+		for key, data := range secret.Data {
+			if keys != nil && !keys[key] {
+				continue
+			}
+			replacement := fmt.Sprintf("[REDACTED:%s/%s]", name, key)
+			for _, value := range redactableValues(string(data)) {
+				values = append(values, secretValue{value: value, replacement: replacement})
+			}
+		}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return len(values[i].value) > len(values[j].value)
+	})
+	return values, nil
+}
+
+// redactableValues returns a Secret value and, for multi-line values like
+// certificates, its lines, since programs often log them line by line
+func redactableValues(value string) []string {
+	value = strings.TrimSpace(value)
+	if len(value) < MinRedactedValueLength {
+		return nil
+	}
+
+	values := []string{value}
+	if strings.Contains(value, "\n") {
+		for _, line := range strings.Split(value, "\n") {
+			if line = strings.TrimSpace(line); len(line) >= MinRedactedValueLength {
+				values = append(values, line)
+			}
+		}
+	}
+	return values
+}
+
+// redact replaces the Secret values, then the pattern matches
+func (r *Redactor) redact(logs string, values []secretValue) string {
+	for _, value := range values {
+		logs = strings.ReplaceAll(logs, value.value, value.replacement)
+	}
+
+	for _, pattern := range r.patterns {
+		replacement := fmt.Sprintf("[REDACTED:%s]", pattern.Name)
+		logs = pattern.regex.ReplaceAllStringFunc(logs, func(match string) string {
+			groups := pattern.regex.FindStringSubmatch(match)
+			if len(groups) <= 1 {
+				return replacement
+			}
+			prefix, suffix := groups[1], ""
+			if len(groups) > 2 {
+				suffix = groups[2]
+			}
+			return prefix + replacement + suffix
+		})
+	}
+	return logs
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	jobhandlerv1alpha1 "github.com/psrvere/k8s-controllers/job-handler/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Default age after which JobResults, and with them their results
+	// ConfigMaps, are deleted
+	DefaultJobResultTTL = 7 * 24 * time.Hour
+
+	// Interval between two sweeps of expired JobResults
+	JobResultSweepInterval = time.Hour
+)
+
+// JobResultSweeper periodically deletes JobResults older than their TTL. The
+// results ConfigMap they own is garbage collected with them.
+type JobResultSweeper struct {
+	Client client.Client
+	// TTL is overridden at runtime by the jobResultTTL setting, 0 keeps JobResults forever
+	TTL        time.Duration
+	Namespaces *predicates.NamespaceFilter
+	Config     *controllerconfig.Config
+}
+
+// Start implements manager.Runnable
+func (s *JobResultSweeper) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("jobresult-sweeper")
+
+	ticker := time.NewTicker(JobResultSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sweep(ctx); err != nil {
+			log.Error(err, "Failed to delete expired JobResults")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep deletes the JobResults older than the TTL
+func (s *JobResultSweeper) sweep(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("jobresult-sweeper")
+
+	ttl := s.Config.Duration(SettingJobResultTTL, s.TTL)
+	if ttl <= 0 {
+		return nil
+	}
+
+	jobResults := &jobhandlerv1alpha1.JobResultList{}
+	if err := s.Client.List(ctx, jobResults); err != nil {
+		return fmt.Errorf("failed to list JobResults: %w", err)
+	}
+
+	propagationPolicy := metav1.DeletePropagationBackground
+	for i := range jobResults.Items {
+		jobResult := &jobResults.Items[i]
+		if time.Since(jobResult.CreationTimestamp.Time) < ttl || s.Namespaces.Ignored(ctx, jobResult.Namespace) {
+			continue
+		}
+		if err := s.Client.Delete(ctx, jobResult, &client.DeleteOptions{PropagationPolicy: &propagationPolicy}); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete expired JobResult", "jobResult", jobResult.Name, "namespace", jobResult.Namespace)
+			continue
+		}
+		log.Info("Deleted expired JobResult", "jobResult", jobResult.Name, "namespace", jobResult.Namespace, "job", jobResult.Spec.JobName)
+	}
+	return nil
+}
+
+// deleteJobResultOf deletes the JobResult owning a results ConfigMap, which
+// would be left behind when the ConfigMap is evicted on its own
+func (r *JobHandlerReconciler) deleteJobResultOf(ctx context.Context, configMap *corev1.ConfigMap) error {
+	for _, owner := range configMap.OwnerReferences {
+		if owner.Kind != "JobResult" || owner.APIVersion != jobhandlerv1alpha1.GroupVersion.String() {
+			continue
+		}
+		jobResult := &jobhandlerv1alpha1.JobResult{
+			ObjectMeta: metav1.ObjectMeta{Name: owner.Name, Namespace: configMap.Namespace},
+		}
+		if err := r.Delete(ctx, jobResult, client.Preconditions{UID: &owner.UID}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SelfTestImage is a small image with a shell for the test job
+const SelfTestImage = "busybox:1.36"
+
+// SelfTest runs a short job and waits until its results ConfigMap exists
+func SelfTest() selftest.Test {
+	return selftest.Test{
+		Controller: "job-handler",
+		Reconciler: "job",
+		Setup: func(ctx context.Context, env *selftest.Env) error {
+			return env.Create(ctx, &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      env.Name,
+					Namespace: env.Namespace,
+					Labels:    map[string]string{HandlerLabel: "true"},
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: ptr.To[int32](0),
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyNever,
+							Containers: []corev1.Container{{
+								Name:    "selftest",
+								Image:   SelfTestImage,
+								Command: []string{"sh", "-c", "echo job-handler selftest"},
+							}},
+						},
+					},
+				},
+			})
+		},
+		Verify: func(ctx context.Context, env *selftest.Env) error {
+			configMapName := fmt.Sprintf("%s-results", env.Name)
+			configMap := &corev1.ConfigMap{}
+			if err := env.Client.Get(ctx, client.ObjectKey{Name: configMapName, Namespace: env.Namespace}, configMap); err != nil {
+				return fmt.Errorf("results ConfigMap %s not found: %w", configMapName, err)
+			}
+			env.Track(configMap)
+			return nil
+		},
+	}
+}
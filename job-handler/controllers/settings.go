@@ -0,0 +1,53 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/controllerconfig"
+
+// Settings that can be changed at runtime through the job-handler ControllerConfig
+const (
+	SettingRequeueInterval            = "requeueInterval"
+	SettingMaxResultsPerNamespace     = "maxResultsPerNamespace"
+	SettingMaxResultsSizePerNamespace = "maxResultsSizePerNamespace"
+	SettingSLOWindow                  = "sloWindow"
+	SettingOrphanedPodGracePeriod     = "orphanedPodGracePeriod"
+	SettingProcessedJobRetention      = "processedJobRetention"
+	SettingJobResultTTL               = "jobResultTTL"
+)
+
+// Settings lists the runtime settings of this controller
+var Settings = map[string]controllerconfig.Setting{
+	SettingRequeueInterval: {
+		Type:        controllerconfig.Duration,
+		Description: "Interval after which handled Jobs are checked again",
+		Min:         controllerconfig.Bound(1),
+	},
+	SettingMaxResultsPerNamespace: {
+		Type:        controllerconfig.Int,
+		Description: "Maximum number of results ConfigMaps per namespace, 0 is unlimited",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingMaxResultsSizePerNamespace: {
+		Type:        controllerconfig.Int,
+		Description: "Maximum total size of the results ConfigMaps per namespace in bytes, 0 is unlimited",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingSLOWindow: {
+		Type:        controllerconfig.Duration,
+		Description: "Rolling window pipeline success rates are computed over, 0 disables SLO tracking",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingOrphanedPodGracePeriod: {
+		Type:        controllerconfig.Duration,
+		Description: "Time pods of deleted Jobs are kept before they are deleted",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingProcessedJobRetention: {
+		Type:        controllerconfig.Duration,
+		Description: "Time a processed Job and its ResultsProcessed condition are kept before the Job is deleted",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingJobResultTTL: {
+		Type:        controllerconfig.Duration,
+		Description: "Age after which JobResults and their results ConfigMaps are deleted, 0 keeps them",
+		Min:         controllerconfig.Bound(0),
+	},
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Name of the ConfigMap holding the success rates of a namespace's pipelines
+	SLOConfigMapName = "job-handler-slo"
+
+	// Annotation on Jobs with the minimum success rate of their pipeline in percent
+	SLOAnnotation = "job-handler/slo"
+
+	// Default rolling window success rates are computed over
+	DefaultSLOWindow = 24 * time.Hour
+
+	// Pipelines with fewer finished Jobs in the window aren't checked against
+	// their SLO, a single failure would breach it
+	MinSLOJobs = 3
+
+	// Outcomes kept per pipeline, older ones are dropped even inside the window
+	MaxSLOOutcomes = 500
+
+	// Event reasons for SLO state changes of a pipeline
+	SLOBreachedReason  = "PipelineSLOBreached"
+	SLORecoveredReason = "PipelineSLORecovered"
+)
+
+// SLOGroupLabels are the Job labels grouping Jobs into pipelines, in order of precedence
+var SLOGroupLabels = []string{"pipeline", "app"}
+
+// JobOutcome is the result of one finished Job
+type JobOutcome struct {
+	Job       string    `json:"job"`
+	UID       types.UID `json:"uid"`
+	Time      time.Time `json:"time"`
+	Succeeded bool      `json:"succeeded"`
+}
+
+// PipelineSLO is the aggregate of one pipeline stored in the SLO ConfigMap
+type PipelineSLO struct {
+	Label       string  `json:"label"`
+	Value       string  `json:"value"`
+	Window      string  `json:"window"`
+	Succeeded   int     `json:"succeeded"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"successRate"`
+	// SLO is the last annotated SLO in percent, zero when none was annotated
+	SLO      float64 `json:"slo,omitempty"`
+	Breached bool    `json:"breached"`
+
+	Outcomes []JobOutcome `json:"outcomes"`
+}
+
+// sloGroup returns the label and value grouping a Job into a pipeline, or false
+// for Jobs without a grouping label
+func sloGroup(job *batchv1.Job) (string, string, bool) {
+	for _, label := range SLOGroupLabels {
+		if value := job.Labels[label]; value != "" {
+			return label, value, true
+		}
+	}
+	return "", "", false
+}
+
+// jobSLO returns the success rate SLO annotated on a Job, zero when unset
+func jobSLO(job *batchv1.Job) (float64, error) {
+	value, exists := job.Annotations[SLOAnnotation]
+	if !exists {
+		return 0, nil
+	}
+	slo, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || slo <= 0 || slo > 100 {
+		return 0, fmt.Errorf("invalid %s annotation %q, must be a percentage", SLOAnnotation, value)
+	}
+	return slo, nil
+}
+
+// sloWindow returns the rolling window success rates are computed over, zero disables tracking
+func (r *JobHandlerReconciler) sloWindow() time.Duration {
+	return r.Config.Duration(SettingSLOWindow, r.SLOWindow)
+}
+
+// recordJobOutcome adds a finished Job to the success rate of its pipeline and
+// reports SLO breaches and recoveries. Failures are logged, the Job itself is
+// already processed.
+func (r *JobHandlerReconciler) recordJobOutcome(ctx context.Context, job *batchv1.Job) {
+	log := log.FromContext(ctx)
+
+	window := r.sloWindow()
+	label, value, grouped := sloGroup(job)
+	if window <= 0 || !grouped {
+		return
+	}
+
+	slo, err := jobSLO(job)
+	if err != nil {
+		log.Error(err, "Ignoring SLO of job", "job", job.Name)
+	}
+
+	pipeline, changed, err := r.updatePipelineSLO(ctx, job, label, value, slo, window)
+	if err != nil {
+		log.Error(err, "Failed to record job outcome", "job", job.Name, label, value)
+		return
+	}
+	// Removing the SLO annotation isn't a recovery
+	if !changed || (!pipeline.Breached && pipeline.SLO == 0) {
+		return
+	}
+
+	reason, eventType := SLORecoveredReason, corev1.EventTypeNormal
+	message := fmt.Sprintf("Pipeline %s=%s is back at a %.1f%% success rate over the last %s, SLO is %.1f%%",
+		label, value, pipeline.SuccessRate, pipeline.Window, pipeline.SLO)
+	if pipeline.Breached {
+		reason, eventType = SLOBreachedReason, corev1.EventTypeWarning
+		message = fmt.Sprintf("Pipeline %s=%s dropped to a %.1f%% success rate over the last %s (%d of %d jobs failed), below its SLO of %.1f%%",
+			label, value, pipeline.SuccessRate, pipeline.Window, pipeline.Failed, pipeline.Succeeded+pipeline.Failed, pipeline.SLO)
+	}
+	log.Info("Pipeline SLO state changed", label, value, "breached", pipeline.Breached, "successRate", pipeline.SuccessRate)
+	if err := r.createSLOEvent(ctx, job, reason, message, eventType); err != nil {
+		log.Error(err, "Failed to create SLO event", "job", job.Name)
+	}
+}
+
+// updatePipelineSLO adds the Job's outcome to its pipeline in the namespace's
+// SLO ConfigMap and recomputes the aggregate. It returns whether the SLO was
+// newly breached or recovered. Jobs already recorded aren't counted twice.
+func (r *JobHandlerReconciler) updatePipelineSLO(ctx context.Context, job *batchv1.Job, label, value string, slo float64, window time.Duration) (PipelineSLO, bool, error) {
+	key := fmt.Sprintf("%s.%s", label, value)
+	now := time.Now()
+
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(ctx, client.ObjectKey{Name: SLOConfigMapName, Namespace: job.Namespace}, configMap)
+	create := errors.IsNotFound(err)
+	if err != nil && !create {
+		return PipelineSLO{}, false, err
+	}
+	if create {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      SLOConfigMapName,
+				Namespace: job.Namespace,
+			},
+		}
+	}
+
+	pipeline := PipelineSLO{}
+	if data, exists := configMap.Data[key]; exists {
+		if err := json.Unmarshal([]byte(data), &pipeline); err != nil {
+			// Start over instead of failing every Job of the pipeline
+			log.FromContext(ctx).Error(err, "Discarding invalid SLO aggregate", "key", key)
+			pipeline = PipelineSLO{}
+		}
+	}
+	wasBreached := pipeline.Breached
+
+	// Keep the outcomes inside the window, at most MaxSLOOutcomes
+	outcomes := []JobOutcome{}
+	for _, outcome := range pipeline.Outcomes {
+		if outcome.UID == job.UID {
+			return pipeline, false, nil
+		}
+		if now.Sub(outcome.Time) <= window {
+			outcomes = append(outcomes, outcome)
+		}
+	}
+	outcomes = append(outcomes, JobOutcome{
+		Job:       job.Name,
+		UID:       job.UID,
+		Time:      now,
+		Succeeded: job.Status.CompletionTime != nil,
+	})
+	if len(outcomes) > MaxSLOOutcomes {
+		outcomes = outcomes[len(outcomes)-MaxSLOOutcomes:]
+	}
+
+	pipeline = PipelineSLO{
+		Label:    label,
+		Value:    value,
+		Window:   window.String(),
+		SLO:      slo,
+		Outcomes: outcomes,
+	}
+	for _, outcome := range outcomes {
+		if outcome.Succeeded {
+			pipeline.Succeeded++
+		} else {
+			pipeline.Failed++
+		}
+	}
+	pipeline.SuccessRate = float64(pipeline.Succeeded) / float64(len(outcomes)) * 100
+	pipeline.Breached = slo > 0 && len(outcomes) >= MinSLOJobs && pipeline.SuccessRate < slo
+
+	data, err := json.Marshal(pipeline)
+	if err != nil {
+		return pipeline, false, err
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[key] = string(data)
+
+	if create {
+		err = r.Create(ctx, configMap)
+	} else {
+		err = r.Update(ctx, configMap)
+	}
+	if err != nil {
+		return pipeline, false, err
+	}
+	return pipeline, pipeline.Breached != wasBreached, nil
+}
+
+// createSLOEvent records an SLO state change of a pipeline on the Job that
+// caused it. Each change gets its own event.
+func (r *JobHandlerReconciler) createSLOEvent(ctx context.Context, job *batchv1.Job, reason, message, eventType string) error {
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", job.Name, time.Now().UnixNano()),
+			Namespace: job.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Job",
+			Name:            job.Name,
+			Namespace:       job.Namespace,
+			UID:             job.UID,
+			APIVersion:      "batch/v1",
+			ResourceVersion: job.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: "job-handler",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
@@ -2,16 +2,30 @@ package main
 
 import (
 	"context"
+	_ "embed"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	"github.com/psrvere/k8s-controllers/common/version"
+	jobhandlerv1alpha1 "github.com/psrvere/k8s-controllers/job-handler/api/v1alpha1"
 	"github.com/psrvere/k8s-controllers/job-handler/controllers"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -24,13 +38,67 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+// CRD of the JobResult API, printed by the manifests subcommand
+//
+//go:embed config/crd/jobresults.yaml
+var jobResultsCRD []byte
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(jobhandlerv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	// "<binary> selftest [flags]" verifies an installation end-to-end
+	if len(os.Args) > 1 && os.Args[1] == selftest.Command {
+		os.Exit(selftest.Main(os.Args[2:], scheme, controllers.SelfTest()))
+	}
+
+	// "<binary> manifests [flags] [-- controller flags]" prints the install manifests
+	if len(os.Args) > 1 && os.Args[1] == manifests.Command {
+		manifest := controllers.Manifest()
+		manifest.CRDs = [][]byte{jobResultsCRD}
+		os.Exit(manifests.Main(os.Args[2:], manifest))
+	}
+
 	var probeAddr string
+	var enableJobResults bool
+	var maxResults int
+	var maxResultsSize string
+	var collectArtifacts bool
+	var redactionConfigFile string
+	var sloWindow time.Duration
+	var orphanedPodGracePeriod time.Duration
+	var processedJobRetention time.Duration
+	var jobResultTTL time.Duration
 	flag.String("health-probe-bind-address", ":8080", "Probe endpoint binds to this address")
+	flag.BoolVar(&enableJobResults, "enable-job-results", false,
+		"Create JobResult objects that own the results of Jobs without a CronJob (requires the JobResult CRD)")
+	flag.IntVar(&maxResults, "max-results-per-namespace", 0,
+		"Maximum number of result ConfigMaps kept per namespace, oldest are evicted first. 0 means unlimited.")
+	flag.StringVar(&maxResultsSize, "max-results-size-per-namespace", "",
+		"Maximum total size of result ConfigMaps kept per namespace (e.g. 50Mi), oldest are evicted first. Empty means unlimited.")
+
+	flag.BoolVar(&collectArtifacts, "collect-artifacts", false,
+		"Copy the files listed in the job-handler/artifacts annotation out of Job pods with pod exec")
+	flag.StringVar(&redactionConfigFile, "redaction-config", "",
+		"Path to a YAML file with log redaction patterns. The default patterns and referenced Secret values are redacted when empty.")
+	flag.DurationVar(&sloWindow, "slo-window", controllers.DefaultSLOWindow,
+		"Rolling window of the per-pipeline success rates in the job-handler-slo ConfigMap. 0 disables SLO tracking.")
+	flag.DurationVar(&orphanedPodGracePeriod, "orphaned-pod-grace-period", controllers.DefaultOrphanedPodGracePeriod,
+		"Time pods of deleted Jobs are kept before they are deleted when OrphanedPodCleanup is enabled")
+	flag.DurationVar(&processedJobRetention, "processed-job-retention", controllers.DefaultProcessedJobRetention,
+		"Time a processed Job and its ResultsProcessed condition are kept before the Job is deleted")
+	flag.DurationVar(&jobResultTTL, "job-result-ttl", controllers.DefaultJobResultTTL,
+		"Age after which JobResults, and with them their results ConfigMaps, are deleted. 0 keeps them.")
+
+	// --kubeconfig, --context and impersonation for running out-of-cluster
+	var connection restconfig.Options
+	connection.AddFlags(flag.CommandLine)
+
+	features := featuregate.New("job-handler", controllers.FeatureGates)
+	features.AddFlag(flag.CommandLine)
 
 	opts := zap.Options{
 		Development: true,
@@ -39,8 +107,36 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	features.Report(setupLog)
+	version.Report(setupLog, features)
+
+	resultQuota := controllers.ResultQuota{MaxCount: maxResults}
+	if maxResultsSize != "" {
+		size, err := resource.ParseQuantity(maxResultsSize)
+		if err != nil {
+			setupLog.Error(err, "invalid --max-results-size-per-namespace", "value", maxResultsSize)
+			os.Exit(1)
+		}
+		resultQuota.MaxBytes = size.Value()
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	var redactionConfig *controllers.RedactionConfig
+	if redactionConfigFile != "" {
+		loaded, err := controllers.LoadRedactionConfig(redactionConfigFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load redaction config", "file", redactionConfigFile)
+			os.Exit(1)
+		}
+		redactionConfig = loaded
+	}
+
+	restConfig, err := connection.Load()
+	if err != nil {
+		setupLog.Error(err, "Unable to load kubeconfig")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		HealthProbeBindAddress: probeAddr,
 	})
@@ -49,14 +145,87 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The controller-runtime client can't stream pod logs
+	logClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create log client")
+		os.Exit(1)
+	}
+
+	var artifacts *controllers.ArtifactCollector
+	if collectArtifacts {
+		artifacts = &controllers.ArtifactCollector{Client: logClient, Config: mgr.GetConfig()}
+	}
+
+	// Secrets are read directly, only the few referenced by Job pods are needed
+	redactor, err := controllers.NewRedactor(redactionConfig, mgr.GetAPIReader())
+	if err != nil {
+		setupLog.Error(err, "invalid redaction config", "file", redactionConfigFile)
+		os.Exit(1)
+	}
+
+	// Intervals, quotas and feature gates can be changed at runtime with a ControllerConfig
+	config := controllerconfig.New("job-handler", controllers.Settings, features)
+	if err := config.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ControllerConfig")
+		os.Exit(1)
+	}
+
+	// Build and effective feature gates on /version of the metrics server
+	if err := version.AddToManager(mgr, "job-handler", config.ActiveFeatureGates); err != nil {
+		setupLog.Error(err, "unable to serve version")
+		os.Exit(1)
+	}
+
+	backoff := throttle.NewAdaptiveBackoff("job-handler")
 	if err = (&controllers.JobHandlerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:           throttle.WrapClient(mgr.GetClient(), backoff),
+		Scheme:           mgr.GetScheme(),
+		Backoff:          backoff,
+		EnableJobResults: enableJobResults || features.Enabled(controllers.JobResults),
+		LogClient:        logClient,
+		Artifacts:        artifacts,
+		Redactor:         redactor,
+		ResultQuota:      resultQuota,
+		Namespaces:       predicates.NewNamespaceFilter(mgr.GetClient()),
+		Config:           config,
+		SLOWindow:        sloWindow,
+		PrioritizeJobs:   features.Enabled(controllers.JobPrioritization),
+		FollowUpJobs:     features.Enabled(controllers.FollowUpJobs),
+
+		ProcessedJobRetention: processedJobRetention,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "JobHandler")
 		os.Exit(1)
 	}
 
+	// JobResults are only created, and their CRD only required, with JobResults enabled
+	if enableJobResults || features.Enabled(controllers.JobResults) {
+		if err := mgr.Add(&controllers.JobResultSweeper{
+			Client:     mgr.GetClient(),
+			TTL:        jobResultTTL,
+			Namespaces: predicates.NewNamespaceFilter(mgr.GetClient()),
+			Config:     config,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up JobResult sweeper")
+			os.Exit(1)
+		}
+	}
+
+	// Delete pods left behind by Jobs deleted with --cascade=orphan
+	if features.Enabled(controllers.OrphanedPodCleanup) {
+		if err = (&controllers.OrphanedPodReconciler{
+			Client:      throttle.WrapClient(mgr.GetClient(), backoff),
+			Backoff:     backoff,
+			Namespaces:  predicates.NewNamespaceFilter(mgr.GetClient()),
+			Config:      config,
+			GracePeriod: orphanedPodGracePeriod,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "OrphanedPod")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to setup health check")
 		os.Exit(1)
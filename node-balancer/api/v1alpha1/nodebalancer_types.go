@@ -0,0 +1,80 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Imbalance trends, comparing the latest history sample with the oldest
+const (
+	TrendImproving = "Improving"
+	TrendWorsening = "Worsening"
+	TrendStable    = "Stable"
+)
+
+// NodeBalancerSpec configures how the imbalance history is recorded
+type NodeBalancerSpec struct {
+	// HistoryLimit is the maximum number of samples kept in status.history
+	HistoryLimit int `json:"historyLimit,omitempty"`
+	// SampleInterval is the minimum time between two history samples. The
+	// current score is updated on every balancing cycle.
+	SampleInterval metav1.Duration `json:"sampleInterval,omitempty"`
+}
+
+// PoolImbalance is the imbalance of one node pool. Scores are standard
+// deviations of the requested share of allocatable resources across the
+// pool's nodes, in percentage points: 0 means all nodes are equally loaded.
+type PoolImbalance struct {
+	Pool            string  `json:"pool"`
+	Nodes           int     `json:"nodes"`
+	OverloadedNodes int     `json:"overloadedNodes"`
+	CPU             float64 `json:"cpu"`
+	Memory          float64 `json:"memory"`
+	// Score is the mean of the CPU and memory deviations
+	Score float64 `json:"score"`
+}
+
+// ImbalanceSample is the cluster imbalance at one point in time
+type ImbalanceSample struct {
+	Time  metav1.Time `json:"time"`
+	Score float64     `json:"score"`
+	// Pools holds the score of each pool
+	Pools map[string]float64 `json:"pools,omitempty"`
+}
+
+// NodeBalancerStatus holds the current imbalance and its bounded history
+type NodeBalancerStatus struct {
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+	// Score is the node weighted mean of the pool scores
+	Score float64         `json:"score"`
+	Pools []PoolImbalance `json:"pools,omitempty"`
+	// Trend compares the latest sample with the oldest one in the history
+	Trend   string            `json:"trend,omitempty"`
+	History []ImbalanceSample `json:"history,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+
+// NodeBalancer records how evenly the balanced nodes are loaded, so dashboards
+// can show whether balancing improves placement over time
+type NodeBalancer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NodeBalancerSpec   `json:"spec,omitempty"`
+	Status NodeBalancerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NodeBalancerList contains a list of NodeBalancer
+type NodeBalancerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeBalancer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeBalancer{}, &NodeBalancerList{})
+}
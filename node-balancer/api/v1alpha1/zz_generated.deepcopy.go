@@ -0,0 +1,115 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeBalancer) DeepCopyInto(out *NodeBalancer) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy creates a new NodeBalancer
+func (in *NodeBalancer) DeepCopy() *NodeBalancer {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeBalancer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NodeBalancer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeBalancerList) DeepCopyInto(out *NodeBalancerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NodeBalancer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy creates a new NodeBalancerList
+func (in *NodeBalancerList) DeepCopy() *NodeBalancerList {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeBalancerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NodeBalancerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeBalancerStatus) DeepCopyInto(out *NodeBalancerStatus) {
+	*out = *in
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+	if in.Pools != nil {
+		in, out := &in.Pools, &out.Pools
+		*out = make([]PoolImbalance, len(*in))
+		copy(*out, *in)
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]ImbalanceSample, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy creates a new NodeBalancerStatus
+func (in *NodeBalancerStatus) DeepCopy() *NodeBalancerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeBalancerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *ImbalanceSample) DeepCopyInto(out *ImbalanceSample) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Pools != nil {
+		in, out := &in.Pools, &out.Pools
+		*out = make(map[string]float64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy creates a new ImbalanceSample
+func (in *ImbalanceSample) DeepCopy() *ImbalanceSample {
+	if in == nil {
+		return nil
+	}
+	out := new(ImbalanceSample)
+	in.DeepCopyInto(out)
+	return out
+}
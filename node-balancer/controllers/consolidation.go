@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Default node label with the relative cost of a node
+	DefaultCostLabel = "node-balancer/hourly-cost"
+
+	// Taint keeping new pods off a node that is being emptied. PreferNoSchedule
+	// only steers the scheduler, pods still land on the node if nothing else fits.
+	ConsolidationTaint = "node-balancer/consolidating"
+
+	// Event reason for nodes being emptied by the consolidation mode
+	NodeConsolidationReason = "NodeConsolidation"
+
+	// Annotation kubelets set on static (mirror) pods
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+)
+
+// consolidationMove moves one pod off the node being consolidated
+type consolidationMove struct {
+	Pod        corev1.Pod
+	TargetNode string
+}
+
+// consolidatePool empties the most expensive underutilized node of a pool when
+// all of its pods fit on the other nodes, so the cluster autoscaler can remove
+// it. Only one node per pool is consolidated at a time: a node carrying the
+// consolidation taint is finished (or released) before the next one starts,
+// over several reconciles when it has more pods than the move budget.
+func (r *NodeBalancerReconciler) consolidatePool(ctx context.Context, pool string, nodes []corev1.Node, nodeUsages []NodeResourceUsage, budget *moveBudget, fit *fitChecker) error {
+	log := log.FromContext(ctx).WithValues("pool", pool)
+
+	nodesByName := make(map[string]*corev1.Node, len(nodes))
+	for i := range nodes {
+		nodesByName[nodes[i].Name] = &nodes[i]
+	}
+
+	// Finish the node that is already being consolidated
+	for _, usage := range nodeUsages {
+		node := nodesByName[usage.NodeName]
+		if !hasConsolidationTaint(node) {
+			continue
+		}
+
+		moves, err := r.planConsolidation(ctx, node, nodesByName, nodeUsages, fit)
+		if errors.Is(err, errEvictionBlackout) && usage.IsUnderutilized {
+			// A replacement pod landed on the node, it is moved once its blackout is over
+			log.Info("Waiting for the eviction blackout before consolidating further", "node", node.Name, "reason", err.Error())
+			return nil
+		}
+		if err != nil || !usage.IsUnderutilized {
+			// The node can't be emptied anymore, make it a normal node again
+			log.Info("Releasing node from consolidation", "node", node.Name, "reason", releaseReason(err, usage))
+			return r.setConsolidationTaint(ctx, node, false)
+		}
+		return r.executeConsolidation(ctx, node, moves, budget)
+	}
+
+	for _, candidate := range consolidationCandidates(nodeUsages, nodesByName, r.Policy) {
+		node := nodesByName[candidate.NodeName]
+		moves, err := r.planConsolidation(ctx, node, nodesByName, nodeUsages, fit)
+		if err != nil {
+			log.Info("Node can't be consolidated", "node", node.Name, "reason", err.Error())
+			continue
+		}
+		if len(moves) == 0 {
+			continue
+		}
+
+		cost, _ := r.Policy.NodeCost(node)
+		log.Info("Consolidating underutilized node",
+			"node", node.Name,
+			"cost", cost,
+			"cpuRequests", fmt.Sprintf("%.2f%%", candidate.CPURequests),
+			"memoryRequests", fmt.Sprintf("%.2f%%", candidate.MemoryRequests),
+			"pods", len(moves))
+		if err := r.setConsolidationTaint(ctx, node, true); err != nil {
+			return fmt.Errorf("failed to taint node %s: %w", node.Name, err)
+		}
+		if err := r.createConsolidationEvent(ctx, node, len(moves), cost); err != nil {
+			log.Error(err, "Failed to create consolidation event", "node", node.Name)
+		}
+		return r.executeConsolidation(ctx, node, moves, budget)
+	}
+
+	return nil
+}
+
+func releaseReason(err error, usage NodeResourceUsage) string {
+	if err != nil {
+		return err.Error()
+	}
+	if !usage.IsUnderutilized {
+		return "node is no longer underutilized"
+	}
+	return ""
+}
+
+// consolidationCandidates returns the underutilized nodes with a cost, the
+// most expensive first and the emptiest first among equally expensive nodes
+func consolidationCandidates(nodeUsages []NodeResourceUsage, nodesByName map[string]*corev1.Node, policy *BalancerPolicy) []NodeResourceUsage {
+	var candidates []NodeResourceUsage
+	costs := make(map[string]float64)
+	for _, usage := range nodeUsages {
+		cost, ok := policy.NodeCost(nodesByName[usage.NodeName])
+		if !ok || !usage.IsUnderutilized {
+			continue
+		}
+		costs[usage.NodeName] = cost
+		candidates = append(candidates, usage)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		costI, costJ := costs[candidates[i].NodeName], costs[candidates[j].NodeName]
+		if costI != costJ {
+			return costI > costJ
+		}
+		return candidates[i].CPURequests+candidates[i].MemoryRequests < candidates[j].CPURequests+candidates[j].MemoryRequests
+	})
+	return candidates
+}
+
+// planConsolidation assigns every pod that has to leave the node a target node
+// that stays below the pool's high thresholds, preferring cheap nodes. It
+// fails if any pod can't be moved or doesn't fit anywhere, a node is only
+// worth emptying completely. Targets have to pass the fit check too.
+func (r *NodeBalancerReconciler) planConsolidation(ctx context.Context, node *corev1.Node, nodesByName map[string]*corev1.Node, nodeUsages []NodeResourceUsage, fit *fitChecker) ([]consolidationMove, error) {
+	thresholds := r.Policy.PoolThresholds(r.Policy.NodePool(node))
+
+	pods, err := r.getPodsToDrain(ctx, node.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if !isPodEvictable(pod) || !r.Policy.IsMovable(pod) || r.Namespaces.Ignored(ctx, pod.Namespace) {
+			return nil, fmt.Errorf("pod %s/%s can't be moved", pod.Namespace, pod.Name)
+		}
+		if remaining := r.blackoutRemaining(pod, time.Now()); remaining > 0 {
+			blackoutSkipped.WithLabelValues(r.Policy.NodePool(node)).Inc()
+			return nil, fmt.Errorf("pod %s/%s can't be moved for another %s: %w", pod.Namespace, pod.Name, remaining.Round(time.Second), errEvictionBlackout)
+		}
+	}
+	sortPodsByResourceUsage(pods)
+
+	// Targets are tracked on copies so planned pods count towards their usage
+	var targets []NodeResourceUsage
+	for _, usage := range nodeUsages {
+		if usage.NodeName == node.Name || hasConsolidationTaint(nodesByName[usage.NodeName]) || usage.IsOverloaded {
+			continue
+		}
+		targets = append(targets, usage)
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		costI, _ := r.Policy.NodeCost(nodesByName[targets[i].NodeName])
+		costJ, _ := r.Policy.NodeCost(nodesByName[targets[j].NodeName])
+		return costI < costJ
+	})
+
+	// A plan that fails leaves no placements behind
+	fit = fit.clone()
+	var moves []consolidationMove
+	for _, pod := range pods {
+		placed := false
+		for i := range targets {
+			target := &targets[i]
+			targetNode := nodesByName[target.NodeName]
+			cpu := target.CPURequests + calculateCPURequests(targetNode, int64(getPodCPURequest(&pod)))
+			memory := target.MemoryRequests + calculateMemoryRequests(targetNode, int64(getPodMemoryRequest(&pod)))
+			if cpu > *thresholds.CPUHigh || memory > *thresholds.MemoryHigh {
+				continue
+			}
+			if err := fit.fits(&pod, target.NodeName); err != nil {
+				continue
+			}
+
+			fit.place(&pod, target.NodeName)
+			target.CPURequests, target.MemoryRequests = cpu, memory
+			moves = append(moves, consolidationMove{Pod: pod, TargetNode: target.NodeName})
+			placed = true
+			break
+		}
+		if !placed {
+			return nil, fmt.Errorf("pod %s/%s doesn't fit on another node", pod.Namespace, pod.Name)
+		}
+	}
+	return moves, nil
+}
+
+// getPodsToDrain returns the pods that have to leave a node for it to be
+// removed. DaemonSet, static and finished pods stay, they don't keep the
+// cluster autoscaler from removing the node.
+func (r *NodeBalancerReconciler) getPodsToDrain(ctx context.Context, nodeName string) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList); err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName != nodeName || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if _, mirror := pod.Annotations[mirrorPodAnnotation]; mirror {
+			continue
+		}
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// executeConsolidation evicts the planned pods within the move budget. Failed
+// evictions and the pods left over are moved on the next reconcile.
+func (r *NodeBalancerReconciler) executeConsolidation(ctx context.Context, node *corev1.Node, moves []consolidationMove, budget *moveBudget) error {
+	log := log.FromContext(ctx)
+
+	for _, move := range moves {
+		if !budget.Available() {
+			log.Info("Move budget used up, continuing consolidation on the next reconcile", "node", node.Name)
+			return nil
+		}
+
+		evicted, err := r.evictPod(ctx, &move.Pod, move.TargetNode)
+		if err != nil {
+			log.Error(err, "Failed to evict pod for consolidation",
+				"pod", move.Pod.Name,
+				"namespace", move.Pod.Namespace,
+				"targetNode", move.TargetNode)
+			continue
+		}
+		if !evicted {
+			continue
+		}
+		budget.Spend(MoveReasonConsolidation)
+
+		log.Info("Moved pod off consolidated node",
+			"pod", move.Pod.Name,
+			"namespace", move.Pod.Namespace,
+			"fromNode", node.Name,
+			"toNode", move.TargetNode)
+	}
+	return nil
+}
+
+func hasConsolidationTaint(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == ConsolidationTaint {
+			return true
+		}
+	}
+	return false
+}
+
+// setConsolidationTaint adds or removes the consolidation taint of a node
+func (r *NodeBalancerReconciler) setConsolidationTaint(ctx context.Context, node *corev1.Node, tainted bool) error {
+	if hasConsolidationTaint(node) == tainted {
+		return nil
+	}
+
+	nodeCopy := node.DeepCopy()
+	if tainted {
+		nodeCopy.Spec.Taints = append(nodeCopy.Spec.Taints, corev1.Taint{
+			Key:    ConsolidationTaint,
+			Value:  "true",
+			Effect: corev1.TaintEffectPreferNoSchedule,
+		})
+	} else {
+		var taints []corev1.Taint
+		for _, taint := range nodeCopy.Spec.Taints {
+			if taint.Key != ConsolidationTaint {
+				taints = append(taints, taint)
+			}
+		}
+		nodeCopy.Spec.Taints = taints
+	}
+	return r.Update(ctx, nodeCopy)
+}
+
+func (r *NodeBalancerReconciler) createConsolidationEvent(ctx context.Context, node *corev1.Node, pods int, cost float64) error {
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", node.Name, time.Now().UnixNano()),
+			Namespace: metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       "Node",
+			Name:       node.Name,
+			UID:        node.UID,
+			APIVersion: "v1",
+		},
+		Reason:         NodeConsolidationReason,
+		Message:        fmt.Sprintf("Moving %d pod(s) off underutilized node (cost %g) so it can be scaled down", pods, cost),
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           corev1.EventTypeNormal,
+		Source: corev1.EventSource{
+			Component: "node-balancer",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
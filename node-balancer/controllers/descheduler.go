@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Descheduler pod annotations. Pods with the evict annotation are evictable
+	// even when the default checks would skip them, pods with the
+	// prefer-no-eviction annotation are left alone. The evictable annotation of
+	// the balancer takes precedence over both.
+	DeschedulerEvictAnnotation            = "descheduler.alpha.kubernetes.io/evict"
+	DeschedulerPreferNoEvictionAnnotation = "descheduler.alpha.kubernetes.io/prefer-no-eviction"
+
+	// Default label of the descheduler workloads installed by its Helm chart and manifests
+	DefaultDeschedulerLabel = "app.kubernetes.io/name"
+	DefaultDeschedulerName  = "descheduler"
+
+	// Name of the descheduler plugin whose arguments decide which pods are evictable
+	DefaultEvictorPlugin = "DefaultEvictor"
+
+	// Priority from which pods are system critical, matching the scheduling API
+	SystemCriticalPriority = int32(2000000000)
+)
+
+// DeschedulerPolicy configures the cooperation with a descheduler running in
+// the same cluster, so the two don't evict against each other
+type DeschedulerPolicy struct {
+	// DeferWhenRunning stops all evictions of the balancer while a descheduler
+	// is detected in the cluster
+	DeferWhenRunning bool `json:"deferWhenRunning,omitempty"`
+
+	// Selector finds descheduler Deployments, CronJobs and Pods. Defaults to
+	// app.kubernetes.io/name=descheduler.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// PolicyFile is the path of a descheduler policy (descheduler/v1alpha2). The
+	// DefaultEvictor arguments of all its profiles restrict the pods the
+	// balancer moves, so both only evict the same pods.
+	PolicyFile string `json:"policyFile,omitempty"`
+
+	selector labels.Selector
+	evictors []DefaultEvictorArgs
+}
+
+// deschedulerPolicyFile is the part of a descheduler policy the balancer reads
+type deschedulerPolicyFile struct {
+	Profiles []struct {
+		Name         string `json:"name"`
+		PluginConfig []struct {
+			Name string             `json:"name"`
+			Args DefaultEvictorArgs `json:"args"`
+		} `json:"pluginConfig"`
+	} `json:"profiles"`
+}
+
+// DefaultEvictorArgs are the arguments of the descheduler DefaultEvictor
+// plugin the balancer honors
+type DefaultEvictorArgs struct {
+	EvictSystemCriticalPods bool                  `json:"evictSystemCriticalPods,omitempty"`
+	EvictLocalStoragePods   bool                  `json:"evictLocalStoragePods,omitempty"`
+	IgnorePvcPods           bool                  `json:"ignorePvcPods,omitempty"`
+	LabelSelector           *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	PriorityThreshold       *struct {
+		Value *int32 `json:"value,omitempty"`
+	} `json:"priorityThreshold,omitempty"`
+
+	selector labels.Selector
+}
+
+// complete validates the descheduler policy and loads the descheduler policy file
+func (d *DeschedulerPolicy) complete() error {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{DefaultDeschedulerLabel: DefaultDeschedulerName}}
+	if d.Selector != nil {
+		selector = d.Selector
+	}
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil || parsed.Empty() {
+		return fmt.Errorf("invalid descheduler selector: must be a non-empty label selector")
+	}
+	d.selector = parsed
+
+	if d.PolicyFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(d.PolicyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read descheduler policy: %w", err)
+	}
+	policy := &deschedulerPolicyFile{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return fmt.Errorf("failed to parse descheduler policy: %w", err)
+	}
+	for _, profile := range policy.Profiles {
+		for _, plugin := range profile.PluginConfig {
+			if plugin.Name != DefaultEvictorPlugin {
+				continue
+			}
+			args := plugin.Args
+			if args.LabelSelector != nil {
+				if args.selector, err = metav1.LabelSelectorAsSelector(args.LabelSelector); err != nil {
+					return fmt.Errorf("invalid labelSelector of descheduler profile %s: %w", profile.Name, err)
+				}
+			}
+			d.evictors = append(d.evictors, args)
+		}
+	}
+	return nil
+}
+
+// allows reports whether the DefaultEvictor of every descheduler profile
+// would evict the pod
+func (d *DeschedulerPolicy) allows(pod *corev1.Pod) bool {
+	for _, args := range d.evictors {
+		if !args.allows(pod) {
+			return false
+		}
+	}
+	return true
+}
+
+// allows mirrors the checks of the descheduler DefaultEvictor
+func (a *DefaultEvictorArgs) allows(pod *corev1.Pod) bool {
+	var priority int32
+	if pod.Spec.Priority != nil {
+		priority = *pod.Spec.Priority
+	}
+	if !a.EvictSystemCriticalPods {
+		if priority >= SystemCriticalPriority {
+			return false
+		}
+		if a.PriorityThreshold != nil && a.PriorityThreshold.Value != nil && priority >= *a.PriorityThreshold.Value {
+			return false
+		}
+	}
+
+	if a.selector != nil && !a.selector.Matches(labels.Set(pod.Labels)) {
+		return false
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if !a.EvictLocalStoragePods && (volume.EmptyDir != nil || volume.HostPath != nil) {
+			return false
+		}
+		if a.IgnorePvcPods && volume.PersistentVolumeClaim != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// deschedulerAnnotationEvictable returns whether the descheduler annotations
+// of a pod decide its evictability, and the decision
+func deschedulerAnnotationEvictable(pod *corev1.Pod) (bool, bool) {
+	if _, exists := pod.Annotations[DeschedulerPreferNoEvictionAnnotation]; exists {
+		return false, true
+	}
+	if _, exists := pod.Annotations[DeschedulerEvictAnnotation]; exists {
+		return true, true
+	}
+	return false, false
+}
+
+// deschedulerRunning returns the first descheduler Deployment with replicas,
+// unsuspended descheduler CronJob or running descheduler Pod, or an empty
+// string. The lookup bypasses the cache, so Deployments and CronJobs aren't watched,
+// and lists in pages that shrink while the API server throttles.
+func (r *NodeBalancerReconciler) deschedulerRunning(ctx context.Context) (string, error) {
+	selector := client.MatchingLabelsSelector{Selector: r.Policy.Descheduler.selector}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := throttle.ListPages(ctx, r.APIReader, deployments, r.Backoff, selector); err != nil {
+		return "", fmt.Errorf("failed to list descheduler deployments: %w", err)
+	}
+	for _, deployment := range deployments.Items {
+		if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas > 0 {
+			return fmt.Sprintf("Deployment %s/%s", deployment.Namespace, deployment.Name), nil
+		}
+	}
+
+	cronJobs := &batchv1.CronJobList{}
+	if err := throttle.ListPages(ctx, r.APIReader, cronJobs, r.Backoff, selector); err != nil {
+		return "", fmt.Errorf("failed to list descheduler cronjobs: %w", err)
+	}
+	for _, cronJob := range cronJobs.Items {
+		if cronJob.Spec.Suspend == nil || !*cronJob.Spec.Suspend {
+			return fmt.Sprintf("CronJob %s/%s", cronJob.Namespace, cronJob.Name), nil
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := throttle.ListPages(ctx, r.APIReader, pods, r.Backoff, selector); err != nil {
+		return "", fmt.Errorf("failed to list descheduler pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning || pod.Status.Phase == corev1.PodPending {
+			return fmt.Sprintf("Pod %s/%s", pod.Namespace, pod.Name), nil
+		}
+	}
+	return "", nil
+}
+
+// deferToDescheduler returns the descheduler workload the balancer defers to,
+// or an empty string when it may evict
+func (r *NodeBalancerReconciler) deferToDescheduler(ctx context.Context) (string, error) {
+	if r.Policy == nil || r.Policy.Descheduler == nil || !r.Policy.Descheduler.DeferWhenRunning {
+		return "", nil
+	}
+	return r.deschedulerRunning(ctx)
+}
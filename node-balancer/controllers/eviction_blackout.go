@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Default time the replacement pods of an evicted pod are left in place
+const DefaultEvictionBlackout = 10 * time.Minute
+
+// errEvictionBlackout marks plans that failed only because a pod is a recent
+// replacement, they can succeed once the blackout is over
+var errEvictionBlackout = errors.New("replacement of a recently evicted pod")
+
+var blackoutSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "node_balancer_blackout_skipped_total",
+	Help: "Number of pods not moved because they replace a pod of the same owner evicted within the eviction blackout",
+}, []string{"pool"})
+
+func init() {
+	metrics.Registry.MustRegister(blackoutSkipped)
+}
+
+// evictionBlackout returns how long replacement pods of evicted pods are left
+// in place, zero disables the blackout
+func (r *NodeBalancerReconciler) evictionBlackout() time.Duration {
+	return r.Config.Duration(SettingEvictionBlackout, r.EvictionBlackout)
+}
+
+// recordEviction remembers when a pod of a controller was evicted. Pods
+// without a controller are never replaced and aren't tracked.
+func (r *NodeBalancerReconciler) recordEviction(pod *corev1.Pod, now time.Time) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.evictedOwners == nil {
+		r.evictedOwners = make(map[types.UID]time.Time)
+	}
+	r.evictedOwners[owner.UID] = now
+
+	// Forget owners whose blackout is over, so the map doesn't grow with every
+	// workload ever moved
+	blackout := r.evictionBlackout()
+	for uid, evictedAt := range r.evictedOwners {
+		if now.Sub(evictedAt) >= blackout {
+			delete(r.evictedOwners, uid)
+		}
+	}
+}
+
+// blackoutRemaining returns how long a pod is still kept from being evicted.
+// Pods created after a pod of the same controller was evicted are its
+// replacements, moving them again within the blackout would only bounce the
+// workload between nodes. Pods that existed before the eviction, like the
+// other replicas on a node being consolidated, can still be moved.
+func (r *NodeBalancerReconciler) blackoutRemaining(pod *corev1.Pod, now time.Time) time.Duration {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return 0
+	}
+
+	r.mutex.Lock()
+	evictedAt, exists := r.evictedOwners[owner.UID]
+	r.mutex.Unlock()
+	// Creation timestamps have second precision, a pod created in the second
+	// of the eviction counts as a replacement
+	if !exists || pod.CreationTimestamp.Time.Before(evictedAt.Truncate(time.Second)) {
+		return 0
+	}
+	return max(r.evictionBlackout()-now.Sub(evictedAt), 0)
+}
@@ -0,0 +1,22 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/featuregate"
+
+const (
+	// IncrementalPodCache computes node usage from an informer-fed pod request cache instead of listing pods
+	IncrementalPodCache featuregate.Feature = "IncrementalPodCache"
+	// TargetNodePlacement gates replacement pods through a webhook and pins them to the computed target node
+	TargetNodePlacement featuregate.Feature = "TargetNodePlacement"
+	// ImbalanceHistory records the imbalance score and its history in the status of a NodeBalancer
+	ImbalanceHistory featuregate.Feature = "ImbalanceHistory"
+	// SchedulerFitCheck skips evictions of pods that no target node currently fits
+	SchedulerFitCheck featuregate.Feature = "SchedulerFitCheck"
+)
+
+// FeatureGates lists the features of this controller that can be toggled with --feature-gates
+var FeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	IncrementalPodCache: {Default: true, Stage: featuregate.Beta, StartupOnly: true},
+	TargetNodePlacement: {Default: false, Stage: featuregate.Alpha, StartupOnly: true},
+	ImbalanceHistory:    {Default: false, Stage: featuregate.Alpha},
+	SchedulerFitCheck:   {Default: true, Stage: featuregate.Beta},
+}
@@ -0,0 +1,386 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var fitCheckSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "node_balancer_fit_check_skipped_total",
+	Help: "Number of pods of a pool not evicted because no target node passed the scheduler fit check",
+}, []string{"pool"})
+
+func init() {
+	metrics.Registry.MustRegister(fitCheckSkipped)
+}
+
+func (r *NodeBalancerReconciler) fitCheckEnabled() bool {
+	return r.Config.FeatureEnabled(SchedulerFitCheck, r.FitCheck)
+}
+
+// fitChecker runs a lightweight version of the scheduler's filters: a pod
+// fits a node when the node is schedulable, the pod tolerates its taints,
+// matches its node selector and required node affinity, its requests fit the
+// allocatable resources left, its host ports are free and the required pod
+// (anti-)affinity of the pod and of the pods already there holds. Scoring,
+// preemption and volume topology aren't simulated. A nil fitChecker lets
+// every pod fit every node.
+type fitChecker struct {
+	nodes map[string]*corev1.Node
+	// pods holds the non-terminated pods per node name
+	pods map[string][]corev1.Pod
+}
+
+// newFitChecker takes a snapshot of all nodes and pods to check fits against
+func (r *NodeBalancerReconciler) newFitChecker(ctx context.Context, nodes []corev1.Node) (*fitChecker, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	checker := &fitChecker{
+		nodes: make(map[string]*corev1.Node, len(nodes)),
+		pods:  make(map[string][]corev1.Pod),
+	}
+	for i := range nodes {
+		checker.nodes[nodes[i].Name] = &nodes[i]
+	}
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		checker.pods[pod.Spec.NodeName] = append(checker.pods[pod.Spec.NodeName], pod)
+	}
+	return checker, nil
+}
+
+// clone returns a copy whose placements don't change c, for plans that may be dropped
+func (c *fitChecker) clone() *fitChecker {
+	if c == nil {
+		return nil
+	}
+	return &fitChecker{nodes: c.nodes, pods: maps.Clone(c.pods)}
+}
+
+// place records pod as moved to nodeName, so later checks count it there.
+// Pod lists are replaced rather than changed, clones share them.
+func (c *fitChecker) place(pod *corev1.Pod, nodeName string) {
+	if c == nil {
+		return
+	}
+	moved := pod.DeepCopy()
+	moved.Spec.NodeName = nodeName
+	c.pods[pod.Spec.NodeName] = slices.DeleteFunc(slices.Clone(c.pods[pod.Spec.NodeName]), func(p corev1.Pod) bool {
+		return p.UID == pod.UID
+	})
+	c.pods[nodeName] = append(slices.Clone(c.pods[nodeName]), *moved)
+}
+
+// fits returns why pod doesn't fit on nodeName, or nil if it does
+func (c *fitChecker) fits(pod *corev1.Pod, nodeName string) error {
+	if c == nil {
+		return nil
+	}
+	node, exists := c.nodes[nodeName]
+	if !exists {
+		return fmt.Errorf("node %s not found", nodeName)
+	}
+
+	if err := toleratesNode(pod, node); err != nil {
+		return err
+	}
+	if !labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return fmt.Errorf("node selector doesn't match")
+	}
+	if !matchesRequiredNodeAffinity(pod, node) {
+		return fmt.Errorf("required node affinity doesn't match")
+	}
+
+	existing := slices.DeleteFunc(slices.Clone(c.pods[nodeName]), func(p corev1.Pod) bool { return p.UID == pod.UID })
+	if err := fitsResources(pod, node, existing); err != nil {
+		return err
+	}
+	if err := hostPortsFree(pod, existing); err != nil {
+		return err
+	}
+	return c.podAffinityHolds(pod, node)
+}
+
+// toleratesNode checks that the node is schedulable and pod tolerates its
+// NoSchedule and NoExecute taints
+func toleratesNode(pod *corev1.Pod, node *corev1.Node) error {
+	taints := node.Spec.Taints
+	if node.Spec.Unschedulable {
+		taints = append(slices.Clone(taints), corev1.Taint{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule})
+	}
+	for _, taint := range taints {
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := slices.ContainsFunc(pod.Spec.Tolerations, func(toleration corev1.Toleration) bool {
+			return toleration.ToleratesTaint(&taint)
+		})
+		if !tolerated {
+			return fmt.Errorf("untolerated taint %s", taint.ToString())
+		}
+	}
+	return nil
+}
+
+// matchesRequiredNodeAffinity checks the required node affinity of pod, any
+// of its terms has to match
+func matchesRequiredNodeAffinity(pod *corev1.Pod, node *corev1.Node) bool {
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if matchesNodeSelectorTerm(term, node) {
+			return true
+		}
+	}
+	return false
+}
+
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// matchesNodeSelectorTerm checks that all expressions of a term match. Terms
+// without expressions match no node, like in the scheduler.
+func matchesNodeSelectorTerm(term corev1.NodeSelectorTerm, node *corev1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, expression := range term.MatchExpressions {
+		if !matchesNodeSelectorRequirement(expression, labels.Set(node.Labels)) {
+			return false
+		}
+	}
+	for _, field := range term.MatchFields {
+		if field.Key != metav1.ObjectNameField || !matchesNodeSelectorRequirement(field, labels.Set{field.Key: node.Name}) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesNodeSelectorRequirement(expression corev1.NodeSelectorRequirement, set labels.Set) bool {
+	operator, known := nodeSelectorOperators[expression.Operator]
+	if !known {
+		return false
+	}
+	requirement, err := labels.NewRequirement(expression.Key, operator, expression.Values)
+	if err != nil {
+		return false
+	}
+	return requirement.Matches(set)
+}
+
+// fitsResources checks that the requests of pod fit in what the existing pods
+// leave of the allocatable resources of node, including the pod count
+func fitsResources(pod *corev1.Pod, node *corev1.Node, existing []corev1.Pod) error {
+	allocatablePods := node.Status.Allocatable[corev1.ResourcePods]
+	if !allocatablePods.IsZero() && int64(len(existing))+1 > allocatablePods.Value() {
+		return fmt.Errorf("too many pods")
+	}
+
+	requested := corev1.ResourceList{}
+	for _, p := range existing {
+		addResources(requested, podRequests(&p))
+	}
+	for name, request := range podRequests(pod) {
+		if request.IsZero() {
+			continue
+		}
+		allocatable, exists := node.Status.Allocatable[name]
+		if !exists {
+			return fmt.Errorf("node has no %s", name)
+		}
+		used := requested[name]
+		used.Add(request)
+		if used.Cmp(allocatable) > 0 {
+			return fmt.Errorf("insufficient %s", name)
+		}
+	}
+	return nil
+}
+
+// podRequests returns the effective requests of a pod as the scheduler counts
+// them: the containers and sidecars, or the largest init container if more,
+// plus the pod overhead
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResources(requests, container.Resources.Requests)
+	}
+	sidecars := corev1.ResourceList{}
+	for _, container := range pod.Spec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			addResources(requests, container.Resources.Requests)
+			addResources(sidecars, container.Resources.Requests)
+			continue
+		}
+		// Init containers run one at a time next to the sidecars started before them
+		initRequests := sidecars.DeepCopy()
+		addResources(initRequests, container.Resources.Requests)
+		for name, quantity := range initRequests {
+			if current, exists := requests[name]; !exists || quantity.Cmp(current) > 0 {
+				requests[name] = quantity
+			}
+		}
+	}
+	addResources(requests, pod.Spec.Overhead)
+	return requests
+}
+
+func addResources(total, add corev1.ResourceList) {
+	for name, quantity := range add {
+		sum, exists := total[name]
+		if !exists {
+			sum = resource.Quantity{Format: quantity.Format}
+		}
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
+
+// hostPortsFree checks that no existing pod uses a host port of pod on an
+// overlapping address
+func hostPortsFree(pod *corev1.Pod, existing []corev1.Pod) error {
+	for _, port := range hostPorts(pod) {
+		for _, p := range existing {
+			for _, used := range hostPorts(&p) {
+				if port.HostPort == used.HostPort && port.Protocol == used.Protocol && hostIPsOverlap(port.HostIP, used.HostIP) {
+					return fmt.Errorf("host port %d/%s in use", port.HostPort, port.Protocol)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hostPorts(pod *corev1.Pod) []corev1.ContainerPort {
+	var ports []corev1.ContainerPort
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			for _, port := range container.Ports {
+				if port.HostPort <= 0 {
+					continue
+				}
+				if port.Protocol == "" {
+					port.Protocol = corev1.ProtocolTCP
+				}
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
+
+func hostIPsOverlap(a, b string) bool {
+	wildcard := func(ip string) bool { return ip == "" || ip == "0.0.0.0" || ip == "::" }
+	return wildcard(a) || wildcard(b) || a == b
+}
+
+// podAffinityHolds checks the required pod affinity and anti-affinity of pod
+// on node, and the required anti-affinity of the pods already running in the
+// same topology domains. Namespace selectors are treated as selecting all
+// namespaces, which can only keep a pod in place.
+func (c *fitChecker) podAffinityHolds(pod *corev1.Pod, node *corev1.Node) error {
+	if affinity := pod.Spec.Affinity; affinity != nil {
+		if affinity.PodAffinity != nil {
+			for _, term := range affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				if !c.anyPodInDomain(pod, node, term, func(p *corev1.Pod) bool { return termMatches(term, pod, p) }) {
+					return fmt.Errorf("pod affinity on %s doesn't match", term.TopologyKey)
+				}
+			}
+		}
+		if affinity.PodAntiAffinity != nil {
+			for _, term := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				if c.anyPodInDomain(pod, node, term, func(p *corev1.Pod) bool { return termMatches(term, pod, p) }) {
+					return fmt.Errorf("pod anti-affinity on %s", term.TopologyKey)
+				}
+			}
+		}
+	}
+
+	// Pods already there can repel the pod too
+	for nodeName, pods := range c.pods {
+		for i := range pods {
+			existing := &pods[i]
+			if existing.UID == pod.UID || existing.Spec.Affinity == nil || existing.Spec.Affinity.PodAntiAffinity == nil {
+				continue
+			}
+			for _, term := range existing.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				if sameTopologyDomain(c.nodes[nodeName], node, term.TopologyKey) && termMatches(term, existing, pod) {
+					return fmt.Errorf("pod anti-affinity of %s/%s", existing.Namespace, existing.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// anyPodInDomain reports whether a pod other than pod, in the topology domain
+// of node for the term, matches
+func (c *fitChecker) anyPodInDomain(pod *corev1.Pod, node *corev1.Node, term corev1.PodAffinityTerm, match func(*corev1.Pod) bool) bool {
+	for nodeName, pods := range c.pods {
+		if !sameTopologyDomain(c.nodes[nodeName], node, term.TopologyKey) {
+			continue
+		}
+		for i := range pods {
+			if pods[i].UID != pod.UID && match(&pods[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameTopologyDomain reports whether both nodes carry the topology key with
+// the same value. Nodes outside the snapshot are in no domain.
+func sameTopologyDomain(a, b *corev1.Node, topologyKey string) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	valueA, existsA := a.Labels[topologyKey]
+	valueB, existsB := b.Labels[topologyKey]
+	return existsA && existsB && valueA == valueB
+}
+
+// termMatches reports whether candidate is selected by the affinity term of owner
+func termMatches(term corev1.PodAffinityTerm, owner, candidate *corev1.Pod) bool {
+	if term.NamespaceSelector == nil {
+		namespaces := term.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{owner.Namespace}
+		}
+		if !slices.Contains(namespaces, candidate.Namespace) {
+			return false
+		}
+	}
+	if term.LabelSelector == nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(candidate.Labels))
+}
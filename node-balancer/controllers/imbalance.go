@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	nbv1alpha1 "github.com/psrvere/k8s-controllers/node-balancer/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Name of the NodeBalancer the imbalance history is recorded in. It is
+	// created when missing.
+	NodeBalancerName = "cluster"
+
+	// Defaults of the NodeBalancer spec: a day of samples, five minutes apart
+	DefaultImbalanceHistoryLimit   = 288
+	DefaultImbalanceSampleInterval = 5 * time.Minute
+
+	// Score changes between the oldest and latest sample smaller than this are
+	// a stable trend, in percentage points
+	ImbalanceTrendTolerance = 1.0
+)
+
+var imbalanceScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "node_balancer_imbalance_score",
+	Help: "Standard deviation of the requested share of allocatable CPU and memory across the nodes of a pool in percentage points, 0 when all nodes are equally loaded",
+}, []string{"pool"})
+
+func init() {
+	metrics.Registry.MustRegister(imbalanceScore)
+}
+
+// recordImbalanceHistory reports whether the ImbalanceHistory feature is enabled
+func (r *NodeBalancerReconciler) recordImbalanceHistory() bool {
+	return r.Config.FeatureEnabled(ImbalanceHistory, r.RecordImbalance)
+}
+
+// poolImbalance scores how unevenly the nodes of a pool are loaded. The score
+// only depends on the node usages, not on the thresholds.
+func poolImbalance(pool string, nodeUsages []NodeResourceUsage) nbv1alpha1.PoolImbalance {
+	cpu := make([]float64, 0, len(nodeUsages))
+	memory := make([]float64, 0, len(nodeUsages))
+	overloaded := 0
+	for _, usage := range nodeUsages {
+		cpu = append(cpu, usage.CPURequests)
+		memory = append(memory, usage.MemoryRequests)
+		if usage.IsOverloaded {
+			overloaded++
+		}
+	}
+
+	imbalance := nbv1alpha1.PoolImbalance{
+		Pool:            pool,
+		Nodes:           len(nodeUsages),
+		OverloadedNodes: overloaded,
+		CPU:             roundScore(standardDeviation(cpu)),
+		Memory:          roundScore(standardDeviation(memory)),
+	}
+	imbalance.Score = roundScore((imbalance.CPU + imbalance.Memory) / 2)
+	imbalanceScore.WithLabelValues(pool).Set(imbalance.Score)
+	return imbalance
+}
+
+// standardDeviation returns the population standard deviation of values
+func standardDeviation(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+
+	var variance float64
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+// roundScore keeps two decimals, finer changes are noise in a trend
+func roundScore(score float64) float64 {
+	return math.Round(score*100) / 100
+}
+
+// clusterImbalance returns the mean of the pool scores weighted by their nodes
+func clusterImbalance(pools []nbv1alpha1.PoolImbalance) float64 {
+	var weighted float64
+	nodes := 0
+	for _, pool := range pools {
+		weighted += pool.Score * float64(pool.Nodes)
+		nodes += pool.Nodes
+	}
+	if nodes == 0 {
+		return 0
+	}
+	return roundScore(weighted / float64(nodes))
+}
+
+// imbalanceTrend compares the latest sample of a history with the oldest one
+func imbalanceTrend(history []nbv1alpha1.ImbalanceSample) string {
+	if len(history) < 2 {
+		return ""
+	}
+	change := history[len(history)-1].Score - history[0].Score
+	switch {
+	case change <= -ImbalanceTrendTolerance:
+		return nbv1alpha1.TrendImproving
+	case change >= ImbalanceTrendTolerance:
+		return nbv1alpha1.TrendWorsening
+	default:
+		return nbv1alpha1.TrendStable
+	}
+}
+
+// recordImbalance writes the imbalance of this balancing cycle to the status of
+// the NodeBalancer. A history sample is added once per sample interval, the
+// oldest samples are dropped beyond the history limit. Cycles that neither
+// change the scores nor add a sample don't write.
+func (r *NodeBalancerReconciler) recordImbalance(ctx context.Context, pools []nbv1alpha1.PoolImbalance) error {
+	nodeBalancer := &nbv1alpha1.NodeBalancer{}
+	err := r.Get(ctx, client.ObjectKey{Name: NodeBalancerName}, nodeBalancer)
+	if errors.IsNotFound(err) {
+		nodeBalancer = &nbv1alpha1.NodeBalancer{
+			ObjectMeta: metav1.ObjectMeta{Name: NodeBalancerName},
+		}
+		err = r.Create(ctx, nodeBalancer)
+	}
+	if err != nil {
+		return err
+	}
+
+	limit := nodeBalancer.Spec.HistoryLimit
+	if limit <= 0 {
+		limit = DefaultImbalanceHistoryLimit
+	}
+	interval := nodeBalancer.Spec.SampleInterval.Duration
+	if interval <= 0 {
+		interval = DefaultImbalanceSampleInterval
+	}
+
+	now := metav1.Now()
+	status := nodeBalancer.Status.DeepCopy()
+	status.Score = clusterImbalance(pools)
+	status.Pools = pools
+
+	history := status.History
+	if len(history) == 0 || now.Sub(history[len(history)-1].Time.Time) >= interval {
+		sample := nbv1alpha1.ImbalanceSample{Time: now, Score: status.Score, Pools: make(map[string]float64, len(pools))}
+		for _, pool := range pools {
+			sample.Pools[pool.Pool] = pool.Score
+		}
+		history = append(history, sample)
+	}
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	status.History = history
+	status.Trend = imbalanceTrend(history)
+
+	if equality.Semantic.DeepEqual(status, &nodeBalancer.Status) {
+		return nil
+	}
+	status.LastUpdateTime = now
+	nodeBalancer.Status = *status
+	return r.Status().Update(ctx, nodeBalancer)
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Manifest describes the permissions and webhook port of the node-balancer for
+// the manifests subcommand. The NodeBalancer CRD is added by main, which embeds
+// it.
+func Manifest() manifests.Manifest {
+	return manifests.Manifest{
+		Controller: "node-balancer",
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"nodes", "pods", "events"}, Verbs: []string{"get", "list", "watch", "create"}},
+			{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"policy"}, Resources: []string{"poddisruptionbudgets"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"list"}},
+			{APIGroups: []string{"batch"}, Resources: []string{"cronjobs"}, Verbs: []string{"list"}},
+			{APIGroups: []string{""}, Resources: []string{"pods/eviction"}, Verbs: []string{"create"}},
+			{APIGroups: []string{""}, Resources: []string{"pods", "nodes"}, Verbs: []string{"update"}},
+			{APIGroups: []string{"nodebalancer.example.com"}, Resources: []string{"nodebalancers"}, Verbs: []string{"get", "list", "watch", "create"}},
+			{APIGroups: []string{"nodebalancer.example.com"}, Resources: []string{"nodebalancers/status"}, Verbs: []string{"update"}},
+		},
+		// Pod placement webhook of TargetNodePlacement
+		Ports: []corev1.ContainerPort{{Name: "webhook", ContainerPort: 9443, Protocol: corev1.ProtocolTCP}},
+	}
+}
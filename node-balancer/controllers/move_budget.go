@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Default number of pods moved per pool and reconcile
+	DefaultMaxMovesPerReconcile = 3
+
+	// Requeue interval while a pool still has moves left over from its budget
+	ConvergenceRequeueInterval = 10 * time.Second
+
+	// Reasons pods are moved, for the moves metric
+	MoveReasonRebalance     = "rebalance"
+	MoveReasonConsolidation = "consolidation"
+)
+
+var (
+	podMoves = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_balancer_pod_moves_total",
+		Help: "Number of pods evicted to move them to another node by pool and reason (rebalance, consolidation)",
+	}, []string{"pool", "reason"})
+
+	budgetExhausted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_balancer_move_budget_exhausted_total",
+		Help: "Number of reconciles that stopped moving pods of a pool because the move budget was used up",
+	}, []string{"pool"})
+
+	overloadedNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "node_balancer_overloaded_nodes",
+		Help: "Number of overloaded nodes of a pool at the last reconcile",
+	}, []string{"pool"})
+
+	poolConverged = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "node_balancer_pool_converged",
+		Help: "Whether the last reconcile of a pool finished all moves it wanted within the move budget (1) or left moves for later (0)",
+	}, []string{"pool"})
+
+	convergenceCycles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "node_balancer_convergence_cycles",
+		Help: "Number of consecutive reconciles a pool has used up its move budget, 0 once it converged",
+	}, []string{"pool"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(podMoves, budgetExhausted, overloadedNodes, poolConverged, convergenceCycles)
+}
+
+// moveBudget limits the pods moved in one pool per reconcile, the remaining
+// moves are made by the following reconciles. Small steps keep disruptions
+// small and let each step be observed before the next.
+type moveBudget struct {
+	pool      string
+	remaining int
+	unlimited bool
+	// exhausted is set when a move was wanted after the budget was used up
+	exhausted bool
+}
+
+// newMoveBudget returns a budget of max moves, zero or less disables the limit
+func newMoveBudget(pool string, max int) *moveBudget {
+	return &moveBudget{pool: pool, remaining: max, unlimited: max <= 0}
+}
+
+// Available reports whether another pod may be moved
+func (b *moveBudget) Available() bool {
+	if b.unlimited || b.remaining > 0 {
+		return true
+	}
+	b.exhausted = true
+	return false
+}
+
+// Spend records a pod moved for a reason
+func (b *moveBudget) Spend(reason string) {
+	b.remaining--
+	podMoves.WithLabelValues(b.pool, reason).Inc()
+}
+
+// maxMoves returns the move budget of a pool per reconcile
+func (r *NodeBalancerReconciler) maxMoves() int {
+	return r.Config.Int(SettingMaxMovesPerReconcile, r.MaxMovesPerReconcile)
+}
+
+// recordConvergence updates the convergence metrics of a pool after a reconcile
+func (r *NodeBalancerReconciler) recordConvergence(budget *moveBudget, overloaded int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.convergenceCycles == nil {
+		r.convergenceCycles = make(map[string]int)
+	}
+
+	if budget.exhausted {
+		r.convergenceCycles[budget.pool]++
+		budgetExhausted.WithLabelValues(budget.pool).Inc()
+		poolConverged.WithLabelValues(budget.pool).Set(0)
+	} else {
+		r.convergenceCycles[budget.pool] = 0
+		poolConverged.WithLabelValues(budget.pool).Set(1)
+	}
+	convergenceCycles.WithLabelValues(budget.pool).Set(float64(r.convergenceCycles[budget.pool]))
+	overloadedNodes.WithLabelValues(budget.pool).Set(float64(overloaded))
+}
@@ -6,8 +6,14 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	nbv1alpha1 "github.com/psrvere/k8s-controllers/node-balancer/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,13 +29,48 @@ import (
 
 type NodeBalancerReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme  *runtime.Scheme
+	Backoff *throttle.AdaptiveBackoff
+
+	// Policy restricts which pods may be moved. Nil allows every evictable pod.
+	Policy *BalancerPolicy
+	// UsePodCache computes node usage from an informer-fed pod request cache
+	UsePodCache bool
+
+	// Placement pins replacement pods to the computed target node. Nil leaves
+	// the target node advisory.
+	Placement *PlacementTracker
+	// Namespaces keeps pods in namespaces opted out with the ignore label in place
+	Namespaces *predicates.NamespaceFilter
+	// Config overrides the balancing interval and move budget at runtime. Nil keeps the startup configuration.
+	Config *controllerconfig.Config
+	// MaxMovesPerReconcile caps the pods moved per pool and reconcile, zero disables the cap
+	MaxMovesPerReconcile int
+	// APIReader reads objects that aren't cached, e.g. descheduler workloads
+	APIReader client.Reader
+	// RecordImbalance keeps the imbalance score and its history in the status of the cluster NodeBalancer
+	RecordImbalance bool
+	// FitCheck only evicts pods that pass a scheduler fit check on their target node
+	FitCheck bool
+	// EvictionBlackout keeps the replacement pods of evicted pods in place for
+	// this long, zero disables the blackout
+	EvictionBlackout time.Duration
+
+	podCache *PodRequestCache
+
+	mutex             sync.Mutex
+	convergenceCycles map[string]int
+	// evictedOwners holds when a pod of a controller was last evicted, by the controller's UID
+	evictedOwners map[types.UID]time.Time
 }
 
 const (
 	// Label to identify nodes that should be balanced
 	BalancerLabel = "node-balancer/enabled"
 
+	// Default node label grouping nodes into pools that are balanced separately
+	DefaultPoolLabel = "node-balancer/pool"
+
 	// Annotations
 	RebalancingStatusAnnotation = "node-balancer/status"
 	TargetNodeAnnotation        = "node-balancer/target-node"
@@ -41,7 +82,7 @@ const (
 	StatusRebalancing = "rebalancing"
 	StatusFailed      = "failed"
 
-	// Resource thresholds (percentage)
+	// Default resource thresholds (percentage), overridable per pool in the policy
 	CPUThresholdHigh    = 60.0 // Node is overloaded if CPU usage > 60%
 	CPUThresholdLow     = 40.0 // Node is underutilized if CPU usage < 40%
 	MemoryThresholdHigh = 60.0 // Node is overloaded if memory usage > 60%
@@ -60,8 +101,13 @@ const (
 // NodeResourceUsage represents the resource allocation of a node
 type NodeResourceUsage struct {
 	NodeName        string
+	Pool            string
 	CPURequests     float64 // Percentage of allocatable CPU requested
 	MemoryRequests  float64 // Percentage of allocatable memory requested
+	CPULimits       float64 // Percentage of allocatable CPU limited, above 100 when overcommitted
+	MemoryLimits    float64 // Percentage of allocatable memory limited, above 100 when overcommitted
+	CPULoad         float64 // CPU percentage compared with the thresholds, see OvercommitPolicy
+	MemoryLoad      float64 // Memory percentage compared with the thresholds
 	IsOverloaded    bool
 	IsUnderutilized bool
 	Pods            []corev1.Pod
@@ -78,9 +124,20 @@ type PodResourceRequest struct {
 func (r *NodeBalancerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
+	// Two eviction systems working against each other keep moving the same pods
+	descheduler, err := r.deferToDescheduler(ctx)
+	if err != nil {
+		log.Error(err, "Failed to detect descheduler")
+		return ctrl.Result{}, err
+	}
+	if descheduler != "" {
+		log.Info("Descheduler is running, deferring all evictions to it", "descheduler", descheduler)
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(r.Config.Duration(SettingRequeueInterval, RequeueInterval))}, nil
+	}
+
 	// Get all nodes
 	nodeList := &corev1.NodeList{}
-	err := r.List(ctx, nodeList)
+	err = r.List(ctx, nodeList)
 	if err != nil {
 		log.Error(err, "Failed to list nodes")
 		return ctrl.Result{}, err
@@ -96,37 +153,113 @@ func (r *NodeBalancerReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 	if len(targetNodes) == 0 {
 		log.Info("No nodes with balancer label found")
-		return ctrl.Result{RequeueAfter: RequeueInterval}, nil
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(r.Config.Duration(SettingRequeueInterval, RequeueInterval))}, nil
+	}
+
+	// All nodes and pods are seen by the fit check, for the topology domains
+	// of pod affinities that span pools
+	var fit *fitChecker
+	if r.fitCheckEnabled() {
+		if fit, err = r.newFitChecker(ctx, nodeList.Items); err != nil {
+			log.Error(err, "Failed to snapshot pods for the fit check")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Balance each node pool separately, pods never move across pools
+	converging := false
+	var imbalances []nbv1alpha1.PoolImbalance
+	for _, pool := range groupNodesByPool(targetNodes, r.Policy) {
+		budget := newMoveBudget(pool.Name, r.maxMoves())
+		imbalance, err := r.balancePool(ctx, pool.Name, pool.Nodes, budget, fit)
+		if err != nil {
+			log.Error(err, "Failed to balance node pool", "pool", pool.Name)
+			return ctrl.Result{}, err
+		}
+		imbalances = append(imbalances, imbalance)
+		converging = converging || budget.exhausted
+	}
+
+	// A missing history must not hold up balancing
+	if r.recordImbalanceHistory() {
+		if err := r.recordImbalance(ctx, imbalances); err != nil {
+			log.Error(err, "Failed to record imbalance history", "nodeBalancer", NodeBalancerName)
+		}
+	}
+
+	requeueAfter := r.Config.Duration(SettingRequeueInterval, RequeueInterval)
+	if converging {
+		// Make the moves left over from the budget soon, one small step at a time
+		requeueAfter = min(requeueAfter, ConvergenceRequeueInterval)
+	}
+	return ctrl.Result{RequeueAfter: r.Backoff.Requeue(requeueAfter)}, nil
+}
+
+// NodePool is a group of balanced nodes sharing the same pool label value
+type NodePool struct {
+	Name  string
+	Nodes []corev1.Node
+}
+
+// groupNodesByPool groups nodes by pool, in order of first appearance
+func groupNodesByPool(nodes []corev1.Node, policy *BalancerPolicy) []NodePool {
+	var pools []NodePool
+	index := make(map[string]int)
+	for _, node := range nodes {
+		name := policy.NodePool(&node)
+		i, exists := index[name]
+		if !exists {
+			i = len(pools)
+			index[name] = i
+			pools = append(pools, NodePool{Name: name})
+		}
+		pools[i].Nodes = append(pools[i].Nodes, node)
 	}
+	return pools
+}
+
+// balancePool moves pods from overloaded to underutilized nodes within one
+// pool, at most as many as the budget allows. It returns the imbalance of the
+// pool before the moves.
+func (r *NodeBalancerReconciler) balancePool(ctx context.Context, pool string, nodes []corev1.Node, budget *moveBudget, fit *fitChecker) (nbv1alpha1.PoolImbalance, error) {
+	log := log.FromContext(ctx).WithValues("pool", pool)
 
 	// Analyze node resource usage
-	nodeUsages, err := r.analyzeNodeResourceUsage(ctx, targetNodes)
+	nodeUsages, err := r.analyzeNodeResourceUsage(ctx, nodes, r.Policy.PoolThresholds(pool))
 	if err != nil {
-		log.Error(err, "Failed to analyze node resource usage")
-		return ctrl.Result{}, err
+		return nbv1alpha1.PoolImbalance{}, fmt.Errorf("failed to analyze node resource usage: %w", err)
+	}
+	for i := range nodeUsages {
+		nodeUsages[i].Pool = pool
 	}
+	imbalance := poolImbalance(pool, nodeUsages)
 
 	// Check if rebalancing is needed
 	overloadedNodes := getOverloadedNodes(nodeUsages)
 	underutilizedNodes := getUnderutilizedNodes(nodeUsages)
+	defer r.recordConvergence(budget, len(overloadedNodes))
 
 	if len(overloadedNodes) == 0 || len(underutilizedNodes) == 0 {
 		log.Info("No rebalancing needed - no overloaded or underutilized nodes")
-		return ctrl.Result{RequeueAfter: RequeueInterval}, nil
-	}
+	} else {
+		// Perform rebalancing
+		if err := r.performRebalancing(ctx, pool, overloadedNodes, underutilizedNodes, budget, fit); err != nil {
+			return imbalance, fmt.Errorf("failed to perform rebalancing: %w", err)
+		}
 
-	// Perform rebalancing
-	err = r.performRebalancing(ctx, overloadedNodes, underutilizedNodes)
-	if err != nil {
-		log.Error(err, "Failed to perform rebalancing")
-		return ctrl.Result{}, err
+		log.Info("Rebalancing completed",
+			"overloadedNodes", len(overloadedNodes),
+			"underutilizedNodes", len(underutilizedNodes),
+			"budgetExhausted", budget.exhausted)
 	}
 
-	log.Info("Rebalancing completed",
-		"overloadedNodes", len(overloadedNodes),
-		"underutilizedNodes", len(underutilizedNodes))
-
-	return ctrl.Result{RequeueAfter: RequeueInterval}, nil
+	// Empty expensive nodes once no node is overloaded anymore
+	if r.Policy.ConsolidationEnabled() && len(overloadedNodes) == 0 {
+		if err := r.consolidatePool(ctx, pool, nodes, nodeUsages, budget, fit); err != nil {
+			return imbalance, fmt.Errorf("failed to consolidate pool: %w", err)
+		}
+	}
+	return imbalance, nil
 }
 
 func shouldBalanceNode(node *corev1.Node) bool {
@@ -137,7 +270,7 @@ func shouldBalanceNode(node *corev1.Node) bool {
 	return exists
 }
 
-func (r *NodeBalancerReconciler) analyzeNodeResourceUsage(ctx context.Context, nodes []corev1.Node) ([]NodeResourceUsage, error) {
+func (r *NodeBalancerReconciler) analyzeNodeResourceUsage(ctx context.Context, nodes []corev1.Node, thresholds Thresholds) ([]NodeResourceUsage, error) {
 	var nodeUsages []NodeResourceUsage
 
 	for _, node := range nodes {
@@ -145,30 +278,28 @@ func (r *NodeBalancerReconciler) analyzeNodeResourceUsage(ctx context.Context, n
 			NodeName: node.Name,
 		}
 
-		// Calculate CPU requests (scheduled allocation, not actual usage)
-		cpuRequests, err := r.calculateCPURequests(&node)
+		// Get pods on this node and the sum of their requests
+		pods, cpuRequests, memoryRequests, err := r.getNodeRequests(ctx, node.Name)
 		if err != nil {
-			return nil, fmt.Errorf("failed to calculate CPU requests for node %s: %w", node.Name, err)
+			return nil, fmt.Errorf("failed to get pods for node %s: %w", node.Name, err)
 		}
-		usage.CPURequests = cpuRequests
+		usage.Pods = pods
 
-		// Calculate memory requests (scheduled allocation, not actual usage)
-		memoryRequests, err := r.calculateMemoryRequests(&node)
-		if err != nil {
-			return nil, fmt.Errorf("failed to calculate memory requests for node %s: %w", node.Name, err)
-		}
-		usage.MemoryRequests = memoryRequests
+		// Calculate CPU and memory requests (scheduled allocation, not actual usage)
+		usage.CPURequests = calculateCPURequests(&node, cpuRequests)
+		usage.MemoryRequests = calculateMemoryRequests(&node, memoryRequests)
 
-		// Determine if node is overloaded or underutilized
-		usage.IsOverloaded = usage.CPURequests > CPUThresholdHigh || usage.MemoryRequests > MemoryThresholdHigh
-		usage.IsUnderutilized = usage.CPURequests < CPUThresholdLow && usage.MemoryRequests < MemoryThresholdLow
+		// Calculate the limits the pods may burst to, which can overcommit the node
+		cpuLimits, memoryLimits := getPodLimits(pods)
+		usage.CPULimits = calculateLimitPercentage(&node, corev1.ResourceCPU, cpuLimits)
+		usage.MemoryLimits = calculateLimitPercentage(&node, corev1.ResourceMemory, memoryLimits)
+		recordOvercommit(usage)
 
-		// Get pods on this node
-		pods, err := r.getPodsOnNode(ctx, node.Name)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get pods for node %s: %w", node.Name, err)
-		}
-		usage.Pods = pods
+		// Determine if node is overloaded or underutilized
+		usage.CPULoad = r.Policy.NodeLoad(usage.CPURequests, usage.CPULimits)
+		usage.MemoryLoad = r.Policy.NodeLoad(usage.MemoryRequests, usage.MemoryLimits)
+		usage.IsOverloaded = usage.CPULoad > *thresholds.CPUHigh || usage.MemoryLoad > *thresholds.MemoryHigh
+		usage.IsUnderutilized = usage.CPULoad < *thresholds.CPULow && usage.MemoryLoad < *thresholds.MemoryLow
 
 		nodeUsages = append(nodeUsages, usage)
 	}
@@ -176,78 +307,67 @@ func (r *NodeBalancerReconciler) analyzeNodeResourceUsage(ctx context.Context, n
 	return nodeUsages, nil
 }
 
-func (r *NodeBalancerReconciler) calculateCPURequests(node *corev1.Node) (float64, error) {
+// calculateCPURequests returns the percentage of allocatable CPU requested by pods (in millicores)
+func calculateCPURequests(node *corev1.Node, totalCPURequests int64) float64 {
 	// Get node capacity (total CPU available on the node)
 	cpuCapacity := node.Status.Capacity[corev1.ResourceCPU]
 	if cpuCapacity.IsZero() {
-		return 0, nil
+		return 0
 	}
 
 	// Get node allocatable (CPU available for Pod scheduling)
 	cpuAllocatable := node.Status.Allocatable[corev1.ResourceCPU]
 	if cpuAllocatable.IsZero() {
-		return 0, nil
-	}
-
-	// Get pods on this node
-	pods, err := r.getPodsOnNode(context.Background(), node.Name)
-	if err != nil {
-		return 0, err
-	}
-
-	// Calculate total CPU requests from all containers on this node
-	// This represents the CPU that Pods have reserved, not actual usage
-	var totalCPURequests int64
-	for _, pod := range pods {
-		for _, container := range pod.Spec.Containers {
-			if container.Resources.Requests != nil {
-				cpuRequest := container.Resources.Requests[corev1.ResourceCPU]
-				totalCPURequests += cpuRequest.MilliValue()
-			}
-		}
+		return 0
 	}
 
 	// Calculate percentage of allocatable CPU that has been requested
 	// This gives us the "scheduled CPU allocation" on the node
 	usagePercentage := float64(totalCPURequests) / float64(cpuAllocatable.MilliValue()) * 100
-	return math.Min(usagePercentage, 100.0), nil
+	return math.Min(usagePercentage, 100.0)
 }
 
-func (r *NodeBalancerReconciler) calculateMemoryRequests(node *corev1.Node) (float64, error) {
+// calculateMemoryRequests returns the percentage of allocatable memory requested by pods (in bytes)
+func calculateMemoryRequests(node *corev1.Node, totalMemoryRequests int64) float64 {
 	// Get node capacity (total memory available on the node)
 	memoryCapacity := node.Status.Capacity[corev1.ResourceMemory]
 	if memoryCapacity.IsZero() {
-		return 0, nil
+		return 0
 	}
 
 	// Get node allocatable (memory available for Pod scheduling)
 	memoryAllocatable := node.Status.Allocatable[corev1.ResourceMemory]
 	if memoryAllocatable.IsZero() {
-		return 0, nil
+		return 0
+	}
+
+	// Calculate percentage of allocatable memory that has been requested
+	// This gives us the "scheduled memory allocation" on the node
+	usagePercentage := float64(totalMemoryRequests) / float64(memoryAllocatable.Value()) * 100
+	return math.Min(usagePercentage, 100.0)
+}
+
+// getNodeRequests returns the evictable pods on a node and the sum of their CPU
+// (millicores) and memory (bytes) requests. The informer-backed pod cache is used
+// once synced; before that it falls back to listing pods.
+func (r *NodeBalancerReconciler) getNodeRequests(ctx context.Context, nodeName string) ([]corev1.Pod, int64, int64, error) {
+	if r.podCache != nil && r.podCache.HasSynced() {
+		pods, cpuRequests, memoryRequests := r.podCache.NodeRequests(nodeName)
+		return pods, cpuRequests, memoryRequests, nil
 	}
 
-	// Get pods on this node
-	pods, err := r.getPodsOnNode(context.Background(), node.Name)
+	pods, err := r.getPodsOnNode(ctx, nodeName)
 	if err != nil {
-		return 0, err
+		return nil, 0, 0, err
 	}
 
-	// Calculate total memory requests from all containers on this node
-	// This represents the memory that Pods have reserved, not actual usage
-	var totalMemoryRequests int64
+	// This represents the resources that Pods have reserved, not actual usage
+	var cpuRequests, memoryRequests int64
 	for _, pod := range pods {
-		for _, container := range pod.Spec.Containers {
-			if container.Resources.Requests != nil {
-				memoryRequest := container.Resources.Requests[corev1.ResourceMemory]
-				totalMemoryRequests += memoryRequest.Value()
-			}
-		}
+		cpuRequests += int64(getPodCPURequest(&pod))
+		memoryRequests += int64(getPodMemoryRequest(&pod))
 	}
-
-	// Calculate percentage of allocatable memory that has been requested
-	// This gives us the "scheduled memory allocation" on the node
-	usagePercentage := float64(totalMemoryRequests) / float64(memoryAllocatable.Value()) * 100
-	return math.Min(usagePercentage, 100.0), nil
+	return pods, cpuRequests, memoryRequests, nil
 }
 
 func (r *NodeBalancerReconciler) getPodsOnNode(ctx context.Context, nodeName string) ([]corev1.Pod, error) {
@@ -282,6 +402,11 @@ func isPodEvictable(pod *corev1.Pod) bool {
 		}
 	}
 
+	// Honor the descheduler's annotations, so pods are treated the same by both
+	if evictable, decided := deschedulerAnnotationEvictable(pod); decided {
+		return evictable
+	}
+
 	// Don't evict system pods
 	if pod.Namespace == "kube-system" {
 		return false
@@ -318,7 +443,11 @@ func getUnderutilizedNodes(nodeUsages []NodeResourceUsage) []NodeResourceUsage {
 	return underutilized
 }
 
-func (r *NodeBalancerReconciler) performRebalancing(ctx context.Context, overloadedNodes, underutilizedNodes []NodeResourceUsage) error {
+// performRebalancing evicts pods from overloaded nodes until the target nodes
+// are no longer underutilized or the move budget is used up. Nodes that are
+// still overloaded are handled by the next reconcile. Pods that fit none of
+// the target nodes stay where they are.
+func (r *NodeBalancerReconciler) performRebalancing(ctx context.Context, pool string, overloadedNodes, underutilizedNodes []NodeResourceUsage, budget *moveBudget, fit *fitChecker) error {
 	log := log.FromContext(ctx)
 
 	// For each overloaded node, find pods to evict
@@ -326,10 +455,12 @@ func (r *NodeBalancerReconciler) performRebalancing(ctx context.Context, overloa
 		log.Info("Processing overloaded node",
 			"node", overloadedNode.NodeName,
 			"cpuRequests", fmt.Sprintf("%.2f%%", overloadedNode.CPURequests),
-			"memoryRequests", fmt.Sprintf("%.2f%%", overloadedNode.MemoryRequests))
+			"memoryRequests", fmt.Sprintf("%.2f%%", overloadedNode.MemoryRequests),
+			"cpuLimits", fmt.Sprintf("%.2f%%", overloadedNode.CPULimits),
+			"memoryLimits", fmt.Sprintf("%.2f%%", overloadedNode.MemoryLimits))
 
-		// Get evictable pods from overloaded node
-		evictablePods := getEvictablePods(overloadedNode.Pods)
+		// Get evictable pods from overloaded node that the policy allows to move
+		evictablePods := r.getMovablePods(ctx, getEvictablePods(overloadedNode.Pods))
 		if len(evictablePods) == 0 {
 			log.Info("No evictable pods found on overloaded node", "node", overloadedNode.NodeName)
 			continue
@@ -340,15 +471,39 @@ func (r *NodeBalancerReconciler) performRebalancing(ctx context.Context, overloa
 
 		// Try to evict pods to underutilized nodes
 		for _, pod := range evictablePods {
-			targetNode := r.findBestTargetNode(underutilizedNodes, &pod)
+			if !budget.Available() {
+				log.Info("Move budget used up, continuing on the next reconcile", "node", overloadedNode.NodeName)
+				return nil
+			}
+
+			// Moving a replacement again would bounce the workload between nodes
+			if remaining := r.blackoutRemaining(&pod, time.Now()); remaining > 0 {
+				blackoutSkipped.WithLabelValues(pool).Inc()
+				log.Info("Pod replaces a recently evicted pod, skipping eviction",
+					"pod", pod.Name,
+					"namespace", pod.Namespace,
+					"remaining", remaining.Round(time.Second))
+				continue
+			}
+
+			targetNode, misfits := r.findBestTargetNode(underutilizedNodes, &pod, fit)
 			if targetNode == nil {
+				if len(misfits) > 0 {
+					// Evicting would only restart the pod where it was, or leave it pending
+					fitCheckSkipped.WithLabelValues(pool).Inc()
+					log.Info("No target node fits pod, skipping eviction",
+						"pod", pod.Name,
+						"namespace", pod.Namespace,
+						"misfits", misfits)
+					continue
+				}
 				log.Info("No suitable target node found for pod",
 					"pod", pod.Name,
 					"namespace", pod.Namespace)
 				continue
 			}
 
-			err := r.evictPod(ctx, &pod, targetNode.NodeName)
+			evicted, err := r.evictPod(ctx, &pod, targetNode.NodeName)
 			if err != nil {
 				log.Error(err, "Failed to evict pod",
 					"pod", pod.Name,
@@ -356,6 +511,10 @@ func (r *NodeBalancerReconciler) performRebalancing(ctx context.Context, overloa
 					"targetNode", targetNode.NodeName)
 				continue
 			}
+			if !evicted {
+				continue
+			}
+			budget.Spend(MoveReasonRebalance)
 
 			log.Info("Successfully evicted pod",
 				"pod", pod.Name,
@@ -364,6 +523,7 @@ func (r *NodeBalancerReconciler) performRebalancing(ctx context.Context, overloa
 				"toNode", targetNode.NodeName)
 
 			// Update target node usage (simplified - in reality would recalculate)
+			fit.place(&pod, targetNode.NodeName)
 			targetNode.CPURequests += getPodCPURequest(&pod)
 			targetNode.MemoryRequests += getPodMemoryRequest(&pod)
 
@@ -387,6 +547,18 @@ func getEvictablePods(pods []corev1.Pod) []corev1.Pod {
 	return evictable
 }
 
+// getMovablePods filters out pods the balancer policy doesn't allow to move
+// and pods in ignored namespaces
+func (r *NodeBalancerReconciler) getMovablePods(ctx context.Context, pods []corev1.Pod) []corev1.Pod {
+	var movable []corev1.Pod
+	for _, pod := range pods {
+		if r.Policy.IsMovable(&pod) && !r.Namespaces.Ignored(ctx, pod.Namespace) {
+			movable = append(movable, pod)
+		}
+	}
+	return movable
+}
+
 func sortPodsByResourceUsage(pods []corev1.Pod) {
 	// Simple sorting by total resource requests
 	// In a real implementation, you might want more sophisticated sorting
@@ -435,9 +607,12 @@ func getPodMemoryRequest(pod *corev1.Pod) float64 {
 	return float64(total)
 }
 
-func (r *NodeBalancerReconciler) findBestTargetNode(underutilizedNodes []NodeResourceUsage, pod *corev1.Pod) *NodeResourceUsage {
+// findBestTargetNode returns the least loaded underutilized node the pod fits
+// on, and why it doesn't fit the others by node name
+func (r *NodeBalancerReconciler) findBestTargetNode(underutilizedNodes []NodeResourceUsage, pod *corev1.Pod, fit *fitChecker) (*NodeResourceUsage, map[string]string) {
 	var bestNode *NodeResourceUsage
 	var bestScore float64
+	misfits := make(map[string]string)
 
 	// Iterate through underutilized nodes to find the best target for this pod
 	// Note: We use a pointer to node (&underutilizedNodes[i]) so that when we update
@@ -445,6 +620,10 @@ func (r *NodeBalancerReconciler) findBestTargetNode(underutilizedNodes []NodeRes
 	// original slice for subsequent iterations. This prevents overloading the same node.
 	for i := range underutilizedNodes {
 		node := &underutilizedNodes[i]
+		if err := fit.fits(pod, node.NodeName); err != nil {
+			misfits[node.NodeName] = err.Error()
+			continue
+		}
 
 		// Calculate how much this pod would increase the node's usage
 		podCPU := getPodCPURequest(pod)
@@ -463,16 +642,18 @@ func (r *NodeBalancerReconciler) findBestTargetNode(underutilizedNodes []NodeRes
 		}
 	}
 
-	return bestNode
+	return bestNode, misfits
 }
 
-func (r *NodeBalancerReconciler) evictPod(ctx context.Context, pod *corev1.Pod, targetNodeName string) error {
+// evictPod evicts a pod to move it to the target node. It returns whether the
+// pod was evicted, pods that can't be evicted right now are skipped without an error.
+func (r *NodeBalancerReconciler) evictPod(ctx context.Context, pod *corev1.Pod, targetNodeName string) (bool, error) {
 	log := log.FromContext(ctx)
 
 	// 1. Pre-flight validation
 	if err := r.validateEviction(ctx, pod); err != nil {
 		log.Info("Eviction validation failed, skipping", "pod", pod.Name, "error", err)
-		return nil // Don't fail, just skip this pod
+		return false, nil // Don't fail, just skip this pod
 	}
 
 	// 2. Create eviction object with proper configuration
@@ -486,13 +667,22 @@ func (r *NodeBalancerReconciler) evictPod(ctx context.Context, pod *corev1.Pod,
 		},
 	}
 
-	// 3. Execute eviction via Kubernetes Eviction API
+	// 3. Expect the replacement pod before it can be created
+	expected := r.Placement != nil && r.Placement.Expect(pod, targetNodeName)
+
+	// 4. Execute eviction via Kubernetes Eviction API
 	err := r.Client.SubResource("eviction").Create(ctx, pod, eviction)
 	if err != nil {
-		return r.handleEvictionError(err, pod)
+		if expected {
+			r.Placement.Forget(pod)
+		}
+		return false, r.handleEvictionError(err, pod)
 	}
 
-	// 4. Create tracking event
+	// 5. Keep its replacement in place for the eviction blackout
+	r.recordEviction(pod, time.Now())
+
+	// 6. Create tracking event
 	err = r.createEvictionEvent(ctx, pod, targetNodeName)
 	if err != nil {
 		log.Error(err, "Failed to create eviction event")
@@ -505,7 +695,7 @@ func (r *NodeBalancerReconciler) evictPod(ctx context.Context, pod *corev1.Pod,
 		"targetNode", targetNodeName,
 		"gracePeriod", EvictionGracePeriod)
 
-	return nil
+	return true, nil
 }
 
 func (r *NodeBalancerReconciler) createEvictionEvent(ctx context.Context, pod *corev1.Pod, targetNodeName string) error {
@@ -558,6 +748,16 @@ func (r *NodeBalancerReconciler) validateEviction(ctx context.Context, pod *core
 		return fmt.Errorf("pod is already terminating")
 	}
 
+	// Check if the balancer policy allows moving this pod
+	if !r.Policy.IsMovable(pod) {
+		return fmt.Errorf("pod is excluded by balancer policy")
+	}
+
+	// Check if the pod's namespace is opted out of all controllers
+	if r.Namespaces.Ignored(ctx, pod.Namespace) {
+		return fmt.Errorf("pod namespace is ignored")
+	}
+
 	// Check Pod Disruption Budget (PDB)
 	if err := r.checkPodDisruptionBudget(ctx, pod); err != nil {
 		return fmt.Errorf("PDB check failed: %w", err)
@@ -623,6 +823,14 @@ func (r *NodeBalancerReconciler) handleEvictionError(err error, pod *corev1.Pod)
 }
 
 func (r *NodeBalancerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Keep per-node pod request sums up to date from pod events
+	if r.UsePodCache {
+		r.podCache = NewPodRequestCache()
+		if err := r.podCache.Register(context.Background(), mgr.GetCache()); err != nil {
+			return fmt.Errorf("failed to register pod request cache: %w", err)
+		}
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Node{}).
 		WithEventFilter(predicate.Funcs{
@@ -642,5 +850,5 @@ func (r *NodeBalancerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return true
 			},
 		}).
-		Complete(r)
+		Complete(recovery.Wrap("node-balancer", r))
 }
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Load bases for overload detection. Requests is what the scheduler sees,
+	// limits is what the pods may burst to.
+	LoadBasisRequests = "requests"
+	LoadBasisLimits   = "limits"
+	LoadBasisBlend    = "blend"
+
+	// Default share of the limits in a blended load
+	DefaultLimitWeight = 0.5
+)
+
+var nodeLimitOvercommit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "node_balancer_node_limit_overcommit_ratio",
+	Help: "Limits of the pods on a node divided by its allocatable resources, above 1 when the node is overcommitted",
+}, []string{"node", "resource"})
+
+func init() {
+	metrics.Registry.MustRegister(nodeLimitOvercommit)
+}
+
+// OvercommitPolicy decides which load the overload thresholds are compared
+// with. Request-only analysis misses nodes whose pods requested little but
+// may burst far beyond the allocatable resources.
+type OvercommitPolicy struct {
+	// LoadBasis is requests (default), limits or blend
+	LoadBasis string `json:"loadBasis,omitempty"`
+
+	// LimitWeight is the share of the limits in a blended load, between 0
+	// and 1. Defaults to DefaultLimitWeight.
+	LimitWeight *float64 `json:"limitWeight,omitempty"`
+}
+
+// complete validates the overcommit policy and defaults the limit weight
+func (o *OvercommitPolicy) complete() error {
+	switch o.LoadBasis {
+	case "":
+		o.LoadBasis = LoadBasisRequests
+	case LoadBasisRequests, LoadBasisLimits, LoadBasisBlend:
+	default:
+		return fmt.Errorf("invalid overcommit loadBasis %q: must be requests, limits or blend", o.LoadBasis)
+	}
+
+	if o.LimitWeight == nil {
+		weight := DefaultLimitWeight
+		o.LimitWeight = &weight
+	}
+	if *o.LimitWeight < 0 || *o.LimitWeight > 1 {
+		return fmt.Errorf("invalid overcommit limitWeight %.2f: must be between 0 and 1", *o.LimitWeight)
+	}
+	return nil
+}
+
+// NodeLoad combines the requested and limited percentage of a resource into
+// the load compared with the thresholds. A nil policy uses the requests.
+func (p *BalancerPolicy) NodeLoad(requests, limits float64) float64 {
+	if p == nil || p.Overcommit == nil {
+		return requests
+	}
+	switch p.Overcommit.LoadBasis {
+	case LoadBasisLimits:
+		return limits
+	case LoadBasisBlend:
+		weight := *p.Overcommit.LimitWeight
+		return (1-weight)*requests + weight*limits
+	default:
+		return requests
+	}
+}
+
+// getPodLimits returns the sum of the CPU (millicores) and memory (bytes)
+// limits of pods. Containers without a limit count with their request, they
+// can use more but nothing tells how much.
+func getPodLimits(pods []corev1.Pod) (int64, int64) {
+	var cpu, memory int64
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			cpuLimit := containerLimit(container, corev1.ResourceCPU)
+			memoryLimit := containerLimit(container, corev1.ResourceMemory)
+			cpu += cpuLimit.MilliValue()
+			memory += memoryLimit.Value()
+		}
+	}
+	return cpu, memory
+}
+
+// containerLimit returns the limit of a container, or its request when the
+// limit is missing or lower
+func containerLimit(container corev1.Container, name corev1.ResourceName) resource.Quantity {
+	limit := container.Resources.Limits[name]
+	request := container.Resources.Requests[name]
+	if limit.IsZero() || limit.Cmp(request) < 0 {
+		return request
+	}
+	return limit
+}
+
+// calculateLimitPercentage returns the limits as a percentage of the
+// allocatable resource. Unlike requests it isn't capped at 100%, overcommit
+// is what it shows.
+func calculateLimitPercentage(node *corev1.Node, name corev1.ResourceName, limits int64) float64 {
+	allocatable := node.Status.Allocatable[name]
+	if allocatable.IsZero() {
+		return 0
+	}
+	if name == corev1.ResourceCPU {
+		return float64(limits) / float64(allocatable.MilliValue()) * 100
+	}
+	return float64(limits) / float64(allocatable.Value()) * 100
+}
+
+// recordOvercommit exports the limit overcommit ratios of a node
+func recordOvercommit(usage NodeResourceUsage) {
+	nodeLimitOvercommit.WithLabelValues(usage.NodeName, string(corev1.ResourceCPU)).Set(usage.CPULimits / 100)
+	nodeLimitOvercommit.WithLabelValues(usage.NodeName, string(corev1.ResourceMemory)).Set(usage.MemoryLimits / 100)
+}
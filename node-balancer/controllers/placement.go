@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// PlacementSchedulingGate holds a replacement pod back from the scheduler
+	// until it has been pinned to the target node computed for the evicted pod
+	PlacementSchedulingGate = "node-balancer/placement"
+
+	// PlacementWebhookPath is the path the pod placement webhook is served on
+	PlacementWebhookPath = "/mutate-pod-placement"
+
+	// PlacementTTL is how long a replacement pod is expected after an eviction
+	PlacementTTL = 5 * time.Minute
+
+	// Event reasons
+	PodPlacedReason            = "PodPlaced"
+	PlacementFallbackReason    = "PlacementFallback"
+	hostnameLabel              = "kubernetes.io/hostname"
+	placementEventNameTemplate = "%s-placement-event"
+)
+
+type expectedPlacement struct {
+	TargetNode string
+	Expires    time.Time
+}
+
+// PlacementTracker remembers the target node of evicted pods by the UID of
+// their controller, so the replacement pod the controller creates can be
+// pinned to the same node
+type PlacementTracker struct {
+	mutex   sync.Mutex
+	pending map[types.UID][]expectedPlacement
+}
+
+// NewPlacementTracker creates an empty PlacementTracker
+func NewPlacementTracker() *PlacementTracker {
+	return &PlacementTracker{pending: make(map[types.UID][]expectedPlacement)}
+}
+
+// Expect records that the next replacement pod of the pod's controller should
+// land on targetNode. Pods without a controller are never replaced and ignored.
+func (t *PlacementTracker) Expect(pod *corev1.Pod, targetNode string) bool {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pending[owner.UID] = append(t.pending[owner.UID], expectedPlacement{
+		TargetNode: targetNode,
+		Expires:    time.Now().Add(PlacementTTL),
+	})
+	return true
+}
+
+// Claim returns the target node for a newly created pod and forgets it, so
+// every eviction places exactly one replacement
+func (t *PlacementTracker) Claim(pod *corev1.Pod) (string, bool) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	placements := t.pending[owner.UID]
+	for len(placements) > 0 && now.After(placements[0].Expires) {
+		placements = placements[1:]
+	}
+	if len(placements) == 0 {
+		delete(t.pending, owner.UID)
+		return "", false
+	}
+
+	targetNode := placements[0].TargetNode
+	if len(placements) == 1 {
+		delete(t.pending, owner.UID)
+	} else {
+		t.pending[owner.UID] = placements[1:]
+	}
+	return targetNode, true
+}
+
+// Forget drops the latest expectation recorded for a pod whose eviction didn't happen
+func (t *PlacementTracker) Forget(pod *corev1.Pod) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	placements := t.pending[owner.UID]
+	if len(placements) <= 1 {
+		delete(t.pending, owner.UID)
+		return
+	}
+	t.pending[owner.UID] = placements[:len(placements)-1]
+}
+
+// PodPlacementWebhook gates replacement pods of evicted pods at creation time
+// and records their target node. The PlacementReconciler lifts the gate.
+type PodPlacementWebhook struct {
+	Tracker *PlacementTracker
+	Decoder admission.Decoder
+}
+
+// Handle implements admission.Handler
+func (w *PodPlacementWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	if err := w.Decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	targetNode, ok := w.Tracker.Claim(pod)
+	if !ok || pod.Spec.NodeName != "" {
+		return admission.Allowed("no placement expected")
+	}
+
+	placed := pod.DeepCopy()
+	if placed.Annotations == nil {
+		placed.Annotations = make(map[string]string)
+	}
+	placed.Annotations[TargetNodeAnnotation] = targetNode
+	placed.Spec.SchedulingGates = append(placed.Spec.SchedulingGates, corev1.PodSchedulingGate{Name: PlacementSchedulingGate})
+
+	marshaled, err := json.Marshal(placed)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	log.FromContext(ctx).Info("Gating replacement pod", "namespace", req.Namespace, "owner", metav1.GetControllerOf(pod).Name, "targetNode", targetNode)
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// PlacementReconciler pins gated replacement pods to their target node and
+// removes the scheduling gate. If the target node can no longer take the pod,
+// the gate is removed without pinning and the scheduler picks a node.
+type PlacementReconciler struct {
+	client.Client
+}
+
+func (r *PlacementReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !hasPlacementGate(pod) {
+		return ctrl.Result{}, nil
+	}
+
+	targetNode := pod.Annotations[TargetNodeAnnotation]
+	hostname, reason := r.placementTarget(ctx, targetNode)
+
+	if _, exists := pod.Spec.NodeSelector[hostnameLabel]; exists && reason == "" {
+		reason = "pod already selects a node by hostname"
+	}
+
+	podCopy := pod.DeepCopy()
+	podCopy.Spec.SchedulingGates = removePlacementGate(podCopy.Spec.SchedulingGates)
+	if reason == "" {
+		// Scheduling directives of a gated pod may only be narrowed, which
+		// adding a selector to a pod without one always does
+		if podCopy.Spec.NodeSelector == nil {
+			podCopy.Spec.NodeSelector = make(map[string]string)
+		}
+		podCopy.Spec.NodeSelector[hostnameLabel] = hostname
+	}
+
+	if err := r.Update(ctx, podCopy); err != nil {
+		if errors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		log.Error(err, "Failed to release gated pod", "pod", pod.Name, "targetNode", targetNode)
+		return ctrl.Result{}, err
+	}
+
+	if reason == "" {
+		log.Info("Pinned replacement pod to target node", "pod", pod.Name, "namespace", pod.Namespace, "targetNode", targetNode)
+		err := r.createPlacementEvent(ctx, podCopy, PodPlacedReason, corev1.EventTypeNormal,
+			fmt.Sprintf("Pod pinned to rebalancing target node %s", targetNode))
+		if err != nil {
+			log.Error(err, "Failed to create placement event", "pod", pod.Name)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Released replacement pod without pinning", "pod", pod.Name, "namespace", pod.Namespace, "targetNode", targetNode, "reason", reason)
+	err := r.createPlacementEvent(ctx, podCopy, PlacementFallbackReason, corev1.EventTypeWarning,
+		fmt.Sprintf("Pod not pinned to rebalancing target node %s: %s", targetNode, reason))
+	if err != nil {
+		log.Error(err, "Failed to create placement event", "pod", pod.Name)
+	}
+	return ctrl.Result{}, nil
+}
+
+// placementTarget returns the hostname label to pin a pod to targetNode, or
+// the reason it can't be pinned
+func (r *PlacementReconciler) placementTarget(ctx context.Context, targetNode string) (string, string) {
+	if targetNode == "" {
+		return "", "no target node recorded"
+	}
+
+	node := &corev1.Node{}
+	if err := r.Get(ctx, types.NamespacedName{Name: targetNode}, node); err != nil {
+		if errors.IsNotFound(err) {
+			return "", "target node no longer exists"
+		}
+		return "", fmt.Sprintf("failed to get target node: %v", err)
+	}
+	if node.Spec.Unschedulable {
+		return "", "target node is cordoned"
+	}
+	if !shouldBalanceNode(node) {
+		return "", "target node is no longer balanced"
+	}
+
+	hostname := node.Labels[hostnameLabel]
+	if hostname == "" {
+		return "", fmt.Sprintf("target node has no %s label", hostnameLabel)
+	}
+	return hostname, ""
+}
+
+func (r *PlacementReconciler) createPlacementEvent(ctx context.Context, pod *corev1.Pod, reason, eventType, message string) error {
+	eventName := fmt.Sprintf(placementEventNameTemplate, pod.Name)
+
+	existingEvent := &corev1.Event{}
+	err := r.Get(ctx, types.NamespacedName{Name: eventName, Namespace: pod.Namespace}, existingEvent)
+	if err == nil {
+		return nil
+	}
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventName,
+			Namespace: pod.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Pod",
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			APIVersion:      "v1",
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: "node-balancer",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
+
+func hasPlacementGate(pod *corev1.Pod) bool {
+	for _, gate := range pod.Spec.SchedulingGates {
+		if gate.Name == PlacementSchedulingGate {
+			return true
+		}
+	}
+	return false
+}
+
+func removePlacementGate(gates []corev1.PodSchedulingGate) []corev1.PodSchedulingGate {
+	var remaining []corev1.PodSchedulingGate
+	for _, gate := range gates {
+		if gate.Name != PlacementSchedulingGate {
+			remaining = append(remaining, gate)
+		}
+	}
+	return remaining
+}
+
+func (r *PlacementReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pod-placement").
+		For(&corev1.Pod{}).
+		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			pod, ok := obj.(*corev1.Pod)
+			return ok && hasPlacementGate(pod)
+		})).
+		Complete(recovery.Wrap("pod-placement", r))
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// cachedPod is a pod as seen by the PodRequestCache
+type cachedPod struct {
+	ResourceVersion string
+	NodeName        string
+	CPURequest      int64 // millicores
+	MemoryRequest   int64 // bytes
+	Evictable       bool
+	Pod             *corev1.Pod
+}
+
+// nodeRequests holds the pods bound to a node and the sum of their requests
+type nodeRequests struct {
+	Pods           map[types.UID]*cachedPod
+	CPURequests    int64 // millicores
+	MemoryRequests int64 // bytes
+}
+
+// PodRequestCache keeps per-node pod request sums up to date from pod informer
+// events, so reconciles don't have to list every pod in the cluster.
+// Only evictable pods are counted, matching the balancer's request calculation.
+type PodRequestCache struct {
+	mutex  sync.RWMutex
+	nodes  map[string]*nodeRequests
+	pods   map[types.UID]*cachedPod
+	synced func() bool
+}
+
+// NewPodRequestCache creates an empty PodRequestCache
+func NewPodRequestCache() *PodRequestCache {
+	return &PodRequestCache{
+		nodes: make(map[string]*nodeRequests),
+		pods:  make(map[types.UID]*cachedPod),
+	}
+}
+
+// Register adds the cache's event handlers to the shared pod informer
+func (c *PodRequestCache) Register(ctx context.Context, informers cache.Informers) error {
+	informer, err := informers.GetInformer(ctx, &corev1.Pod{})
+	if err != nil {
+		return err
+	}
+
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				c.upsert(pod)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if pod, ok := newObj.(*corev1.Pod); ok {
+				c.upsert(pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				c.remove(pod.UID)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.synced = registration.HasSynced
+	c.mutex.Unlock()
+	return nil
+}
+
+// HasSynced reports whether the cache has seen the initial pod list
+func (c *PodRequestCache) HasSynced() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.synced != nil && c.synced()
+}
+
+// NodeRequests returns the evictable pods on a node and the sum of their CPU (millicores) and memory (bytes) requests
+func (c *PodRequestCache) NodeRequests(nodeName string) ([]corev1.Pod, int64, int64) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	node, exists := c.nodes[nodeName]
+	if !exists {
+		return nil, 0, 0
+	}
+
+	var pods []corev1.Pod
+	for _, cached := range node.Pods {
+		pods = append(pods, *cached.Pod.DeepCopy())
+	}
+	return pods, node.CPURequests, node.MemoryRequests
+}
+
+func (c *PodRequestCache) upsert(pod *corev1.Pod) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Resyncs deliver the same resourceVersion again, nothing changed
+	if existing, exists := c.pods[pod.UID]; exists && existing.ResourceVersion == pod.ResourceVersion {
+		return
+	}
+
+	c.removeLocked(pod.UID)
+
+	cached := &cachedPod{
+		ResourceVersion: pod.ResourceVersion,
+		NodeName:        pod.Spec.NodeName,
+		CPURequest:      int64(getPodCPURequest(pod)),
+		MemoryRequest:   int64(getPodMemoryRequest(pod)),
+		Evictable:       isPodEvictable(pod),
+		Pod:             pod,
+	}
+	c.pods[pod.UID] = cached
+
+	// Unscheduled and non-evictable pods are tracked but not counted
+	if cached.NodeName == "" || !cached.Evictable {
+		return
+	}
+
+	node, exists := c.nodes[cached.NodeName]
+	if !exists {
+		node = &nodeRequests{Pods: make(map[types.UID]*cachedPod)}
+		c.nodes[cached.NodeName] = node
+	}
+	node.Pods[pod.UID] = cached
+	node.CPURequests += cached.CPURequest
+	node.MemoryRequests += cached.MemoryRequest
+}
+
+func (c *PodRequestCache) remove(uid types.UID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.removeLocked(uid)
+}
+
+// removeLocked drops a pod from the cache. Callers must hold the mutex.
+func (c *PodRequestCache) removeLocked(uid types.UID) {
+	cached, exists := c.pods[uid]
+	if !exists {
+		return
+	}
+	delete(c.pods, uid)
+
+	node, exists := c.nodes[cached.NodeName]
+	if !exists {
+		return
+	}
+	if _, counted := node.Pods[uid]; !counted {
+		return
+	}
+
+	delete(node.Pods, uid)
+	node.CPURequests -= cached.CPURequest
+	node.MemoryRequests -= cached.MemoryRequest
+	if len(node.Pods) == 0 {
+		delete(c.nodes, cached.NodeName)
+	}
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// BalancerPolicy configures which workloads the balancer may move.
+// It is loaded from a YAML file, typically a mounted ConfigMap.
+type BalancerPolicy struct {
+	// MovablePodSelector restricts evictions to pods matching this label selector
+	MovablePodSelector *metav1.LabelSelector `json:"movablePodSelector,omitempty"`
+
+	// MovablePriority restricts evictions to pods whose priority lies in this range,
+	// so latency-critical (high priority) pods are never touched
+	MovablePriority *PriorityRange `json:"movablePriority,omitempty"`
+
+	// PoolLabel is the node label grouping nodes into pools. Pods are only moved
+	// between nodes of the same pool. Defaults to DefaultPoolLabel.
+	PoolLabel string `json:"poolLabel,omitempty"`
+
+	// Pools overrides the rebalancing thresholds per pool, keyed by pool label value
+	Pools map[string]Thresholds `json:"pools,omitempty"`
+
+	// Consolidation empties underutilized expensive nodes so the cluster
+	// autoscaler can remove them. Nil only balances.
+	Consolidation *ConsolidationPolicy `json:"consolidation,omitempty"`
+
+	// Descheduler configures the cooperation with a descheduler. Nil only
+	// honors the descheduler pod annotations.
+	Descheduler *DeschedulerPolicy `json:"descheduler,omitempty"`
+
+	// Overcommit decides whether overload detection looks at requests, limits
+	// or a blend of both. Nil uses the requests.
+	Overcommit *OvercommitPolicy `json:"overcommit,omitempty"`
+
+	movableSelector labels.Selector
+}
+
+// Thresholds are resource request percentages deciding whether a node is
+// overloaded or underutilized. Unset values use the controller defaults.
+type Thresholds struct {
+	CPUHigh    *float64 `json:"cpuHigh,omitempty"`
+	CPULow     *float64 `json:"cpuLow,omitempty"`
+	MemoryHigh *float64 `json:"memoryHigh,omitempty"`
+	MemoryLow  *float64 `json:"memoryLow,omitempty"`
+}
+
+// ConsolidationPolicy configures the cost-optimization mode
+type ConsolidationPolicy struct {
+	// CostLabel is the node label holding the node's relative cost, e.g. its
+	// hourly price. Defaults to DefaultCostLabel.
+	CostLabel string `json:"costLabel,omitempty"`
+}
+
+// PriorityRange is an inclusive range of pod priorities. Unset bounds are open.
+type PriorityRange struct {
+	Min *int32 `json:"min,omitempty"`
+	Max *int32 `json:"max,omitempty"`
+}
+
+// LoadPolicy reads and validates a balancer policy file
+func LoadPolicy(path string) (*BalancerPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policy := &BalancerPolicy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	if err := policy.complete(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// complete validates the policy and prepares parsed selectors
+func (p *BalancerPolicy) complete() error {
+	if p.MovablePodSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(p.MovablePodSelector)
+		if err != nil {
+			return fmt.Errorf("invalid movablePodSelector: %w", err)
+		}
+		p.movableSelector = selector
+	}
+
+	if p.MovablePriority != nil && p.MovablePriority.Min != nil && p.MovablePriority.Max != nil &&
+		*p.MovablePriority.Min > *p.MovablePriority.Max {
+		return fmt.Errorf("invalid movablePriority: min %d is greater than max %d",
+			*p.MovablePriority.Min, *p.MovablePriority.Max)
+	}
+
+	if p.Consolidation != nil && p.Consolidation.CostLabel == "" {
+		p.Consolidation.CostLabel = DefaultCostLabel
+	}
+
+	if p.Descheduler != nil {
+		if err := p.Descheduler.complete(); err != nil {
+			return err
+		}
+	}
+
+	if p.Overcommit != nil {
+		if err := p.Overcommit.complete(); err != nil {
+			return err
+		}
+	}
+
+	for pool, thresholds := range p.Pools {
+		resolved := thresholds.resolve()
+		for name, value := range map[string]float64{
+			"cpuHigh": *resolved.CPUHigh, "cpuLow": *resolved.CPULow,
+			"memoryHigh": *resolved.MemoryHigh, "memoryLow": *resolved.MemoryLow,
+		} {
+			if value < 0 || value > 100 {
+				return fmt.Errorf("invalid thresholds for pool %q: %s %.2f is not a percentage", pool, name, value)
+			}
+		}
+		if *resolved.CPULow > *resolved.CPUHigh || *resolved.MemoryLow > *resolved.MemoryHigh {
+			return fmt.Errorf("invalid thresholds for pool %q: low threshold is greater than high threshold", pool)
+		}
+	}
+
+	return nil
+}
+
+// NodePool returns the pool a node belongs to. Nodes without the pool label
+// form the default pool "".
+func (p *BalancerPolicy) NodePool(node *corev1.Node) string {
+	poolLabel := DefaultPoolLabel
+	if p != nil && p.PoolLabel != "" {
+		poolLabel = p.PoolLabel
+	}
+	return node.Labels[poolLabel]
+}
+
+// PoolThresholds returns the thresholds of a pool with unset values defaulted
+func (p *BalancerPolicy) PoolThresholds(pool string) Thresholds {
+	var thresholds Thresholds
+	if p != nil {
+		thresholds = p.Pools[pool]
+	}
+	return thresholds.resolve()
+}
+
+// ConsolidationEnabled reports whether the policy enables the consolidation mode
+func (p *BalancerPolicy) ConsolidationEnabled() bool {
+	return p != nil && p.Consolidation != nil
+}
+
+// NodeCost returns the cost of a node from its cost label. Nodes without a
+// valid cost return false.
+func (p *BalancerPolicy) NodeCost(node *corev1.Node) (float64, bool) {
+	if !p.ConsolidationEnabled() {
+		return 0, false
+	}
+	cost, err := strconv.ParseFloat(node.Labels[p.Consolidation.CostLabel], 64)
+	if err != nil || cost < 0 {
+		return 0, false
+	}
+	return cost, true
+}
+
+// resolve fills unset thresholds with the controller defaults
+func (t Thresholds) resolve() Thresholds {
+	defaultValue := func(value *float64, fallback float64) *float64 {
+		if value != nil {
+			return value
+		}
+		return &fallback
+	}
+	return Thresholds{
+		CPUHigh:    defaultValue(t.CPUHigh, CPUThresholdHigh),
+		CPULow:     defaultValue(t.CPULow, CPUThresholdLow),
+		MemoryHigh: defaultValue(t.MemoryHigh, MemoryThresholdHigh),
+		MemoryLow:  defaultValue(t.MemoryLow, MemoryThresholdLow),
+	}
+}
+
+// IsMovable reports whether the policy allows the pod to be moved.
+// A nil policy allows every pod.
+func (p *BalancerPolicy) IsMovable(pod *corev1.Pod) bool {
+	if p == nil {
+		return true
+	}
+
+	if p.movableSelector != nil && !p.movableSelector.Matches(labels.Set(pod.Labels)) {
+		return false
+	}
+
+	if p.MovablePriority != nil {
+		// Pods without a resolved priority have the default priority 0
+		var priority int32
+		if pod.Spec.Priority != nil {
+			priority = *pod.Spec.Priority
+		}
+		if p.MovablePriority.Min != nil && priority < *p.MovablePriority.Min {
+			return false
+		}
+		if p.MovablePriority.Max != nil && priority > *p.MovablePriority.Max {
+			return false
+		}
+	}
+
+	if p.Descheduler != nil && !p.Descheduler.allows(pod) {
+		return false
+	}
+
+	return true
+}
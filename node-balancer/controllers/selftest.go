@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SelfTest registers a cordoned fake node with the balancer label. The balancer
+// writes nothing back to nodes, so the result is observed through the
+// reconcile metrics only and --metrics-url is required.
+func SelfTest() selftest.Test {
+	return selftest.Test{
+		Controller: "node-balancer",
+		Reconciler: "node",
+		Setup: func(ctx context.Context, env *selftest.Env) error {
+			return env.Create(ctx, &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   env.Name,
+					Labels: map[string]string{BalancerLabel: "true", DefaultPoolLabel: env.Name},
+				},
+				Spec: corev1.NodeSpec{Unschedulable: true},
+			})
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/controllerconfig"
+
+// Settings that can be changed at runtime through the node-balancer ControllerConfig
+const (
+	SettingRequeueInterval      = "requeueInterval"
+	SettingMaxMovesPerReconcile = "maxMovesPerReconcile"
+	SettingEvictionBlackout     = "evictionBlackout"
+)
+
+// Settings lists the runtime settings of this controller. Thresholds are
+// configured per pool in the balancer policy.
+var Settings = map[string]controllerconfig.Setting{
+	SettingRequeueInterval: {
+		Type:        controllerconfig.Duration,
+		Description: "Interval between balancing runs",
+		Min:         controllerconfig.Bound(1),
+	},
+	SettingMaxMovesPerReconcile: {
+		Type:        controllerconfig.Int,
+		Description: "Pods moved per pool and reconcile, 0 disables the limit",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingEvictionBlackout: {
+		Type:        controllerconfig.Duration,
+		Description: "Time replacement pods of evicted pods are left in place, 0 disables the blackout",
+		Min:         controllerconfig.Bound(0),
+	},
+}
@@ -2,11 +2,23 @@ package main
 
 import (
 	"context"
+	_ "embed"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	"github.com/psrvere/k8s-controllers/common/version"
+	nodebalancerv1alpha1 "github.com/psrvere/k8s-controllers/node-balancer/api/v1alpha1"
 	"github.com/psrvere/k8s-controllers/node-balancer/controllers"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -16,6 +28,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 var (
@@ -23,13 +37,47 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+// CRD of the NodeBalancer API, printed by the manifests subcommand
+//
+//go:embed config/crd/nodebalancers.yaml
+var nodeBalancersCRD []byte
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(nodebalancerv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	// "<binary> selftest [flags]" verifies an installation end-to-end
+	if len(os.Args) > 1 && os.Args[1] == selftest.Command {
+		os.Exit(selftest.Main(os.Args[2:], scheme, controllers.SelfTest()))
+	}
+
+	// "<binary> manifests [flags] [-- controller flags]" prints the install manifests
+	if len(os.Args) > 1 && os.Args[1] == manifests.Command {
+		manifest := controllers.Manifest()
+		manifest.CRDs = [][]byte{nodeBalancersCRD}
+		os.Exit(manifests.Main(os.Args[2:], manifest))
+	}
+
 	var probeAddr string
+	var policyFile string
+	var webhookPort int
+	var maxMoves int
+	var evictionBlackout time.Duration
 	flag.String("health-probe-bind-address", ":8080", "Probe endpoint binds to this address")
+	flag.StringVar(&policyFile, "policy-file", "", "Path to a balancer policy YAML file. All evictable pods are movable when empty.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "Port the pod placement webhook listens on when TargetNodePlacement is enabled")
+	flag.IntVar(&maxMoves, "max-moves-per-reconcile", controllers.DefaultMaxMovesPerReconcile, "Maximum number of pods moved per node pool and reconcile, 0 disables the limit")
+	flag.DurationVar(&evictionBlackout, "eviction-blackout", controllers.DefaultEvictionBlackout, "Time the replacement pods of evicted pods are left in place, 0 disables the blackout")
+
+	// --kubeconfig, --context and impersonation for running out-of-cluster
+	var connection restconfig.Options
+	connection.AddFlags(flag.CommandLine)
+
+	features := featuregate.New("node-balancer", controllers.FeatureGates)
+	features.AddFlag(flag.CommandLine)
 
 	opts := zap.Options{
 		Development: true,
@@ -38,19 +86,81 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	features.Report(setupLog)
+	version.Report(setupLog, features)
+
+	var policy *controllers.BalancerPolicy
+	if policyFile != "" {
+		loaded, err := controllers.LoadPolicy(policyFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load balancer policy", "file", policyFile)
+			os.Exit(1)
+		}
+		policy = loaded
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig, err := connection.Load()
+	if err != nil {
+		setupLog.Error(err, "Unable to load kubeconfig")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		HealthProbeBindAddress: probeAddr,
+		WebhookServer:          webhook.NewServer(webhook.Options{Port: webhookPort}),
 	})
 	if err != nil {
 		setupLog.Error(err, "Unable to start manager")
 		os.Exit(1)
 	}
 
+	// Pin replacement pods to the target node computed for the evicted pod
+	var placement *controllers.PlacementTracker
+	if features.Enabled(controllers.TargetNodePlacement) {
+		placement = controllers.NewPlacementTracker()
+		mgr.GetWebhookServer().Register(controllers.PlacementWebhookPath, &webhook.Admission{
+			Handler: &controllers.PodPlacementWebhook{
+				Tracker: placement,
+				Decoder: admission.NewDecoder(mgr.GetScheme()),
+			},
+		})
+		if err = (&controllers.PlacementReconciler{
+			Client: mgr.GetClient(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "PodPlacement")
+			os.Exit(1)
+		}
+	}
+
+	// The balancing interval and move budget can be changed at runtime with a ControllerConfig
+	config := controllerconfig.New("node-balancer", controllers.Settings, features)
+	if err := config.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ControllerConfig")
+		os.Exit(1)
+	}
+
+	// Build and effective feature gates on /version of the metrics server
+	if err := version.AddToManager(mgr, "node-balancer", config.ActiveFeatureGates); err != nil {
+		setupLog.Error(err, "unable to serve version")
+		os.Exit(1)
+	}
+
+	backoff := throttle.NewAdaptiveBackoff("node-balancer")
 	if err = (&controllers.NodeBalancerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:               throttle.WrapClient(mgr.GetClient(), backoff),
+		Scheme:               mgr.GetScheme(),
+		Backoff:              backoff,
+		Policy:               policy,
+		UsePodCache:          features.Enabled(controllers.IncrementalPodCache),
+		Placement:            placement,
+		Namespaces:           predicates.NewNamespaceFilter(mgr.GetClient()),
+		Config:               config,
+		MaxMovesPerReconcile: maxMoves,
+		APIReader:            mgr.GetAPIReader(),
+		RecordImbalance:      features.Enabled(controllers.ImbalanceHistory),
+		FitCheck:             features.Enabled(controllers.SchedulerFitCheck),
+		EvictionBlackout:     evictionBlackout,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NodeBalancer")
 		os.Exit(1)
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// Default smoothed queue latency above which drift repair is deferred
+	DefaultBackpressureLatencyThreshold = 10 * time.Second
+
+	// Time drift repair of a pod is deferred by while the queue is backed up
+	DefaultBackpressureRequeue = time.Minute
+
+	// Weight of the latest sample in the smoothed queue latency
+	queueLatencySmoothing = 0.2
+)
+
+var (
+	queueLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pod_labeller_queue_latency_seconds",
+		Help:    "Time from a pod event to the start of its reconcile",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	})
+
+	queueLatencySmoothed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_labeller_queue_latency_smoothed_seconds",
+		Help: "Exponentially weighted moving average of the queue latency the backpressure decision is based on",
+	})
+
+	backpressureActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_labeller_backpressure_active",
+		Help: "1 while drift repair is deferred because the queue latency exceeds the threshold",
+	})
+
+	backpressureDeferred = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pod_labeller_backpressure_deferred_total",
+		Help: "Number of drift repairs deferred because of backpressure",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(queueLatency, queueLatencySmoothed, backpressureActive, backpressureDeferred)
+}
+
+// queueLatencyTracker measures how long pods wait on the queue. The time of
+// the first event of a pod is recorded when it passes the event filters, and
+// taken when the pod is reconciled. Events coalesced on the queue keep the
+// time of the first one.
+type queueLatencyTracker struct {
+	mutex    sync.Mutex
+	observed map[types.NamespacedName]time.Time
+	smoothed time.Duration
+}
+
+// predicate records the event time of pods being enqueued. It has to be the
+// last event filter, so dropped events aren't recorded.
+func (t *queueLatencyTracker) predicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { t.enqueued(e.Object); return true },
+		UpdateFunc:  func(e event.UpdateEvent) bool { t.enqueued(e.ObjectNew); return true },
+		DeleteFunc:  func(e event.DeleteEvent) bool { t.enqueued(e.Object); return true },
+		GenericFunc: func(e event.GenericEvent) bool { t.enqueued(e.Object); return true },
+	}
+}
+
+func (t *queueLatencyTracker) enqueued(obj client.Object) {
+	// Namespace events enqueue other keys than their own
+	if _, ok := obj.(*corev1.Pod); !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.observed == nil {
+		t.observed = make(map[types.NamespacedName]time.Time)
+	}
+	key := client.ObjectKeyFromObject(obj)
+	if _, exists := t.observed[key]; !exists {
+		t.observed[key] = time.Now()
+	}
+}
+
+// dequeued records the queue latency of a pod about to be reconciled.
+// Requeued pods have no event time and aren't measured.
+func (t *queueLatencyTracker) dequeued(key types.NamespacedName) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	enqueuedAt, exists := t.observed[key]
+	if !exists {
+		return
+	}
+	delete(t.observed, key)
+
+	latency := time.Since(enqueuedAt)
+	queueLatency.Observe(latency.Seconds())
+	t.smoothed = time.Duration(queueLatencySmoothing*float64(latency) + (1-queueLatencySmoothing)*float64(t.smoothed))
+	queueLatencySmoothed.Set(t.smoothed.Seconds())
+}
+
+// backedUp returns true when the smoothed queue latency exceeds threshold. A
+// threshold of 0 never reports backpressure.
+func (t *queueLatencyTracker) backedUp(threshold time.Duration) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	active := threshold > 0 && t.smoothed > threshold
+	if active {
+		backpressureActive.Set(1)
+	} else {
+		backpressureActive.Set(0)
+	}
+	return active
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Delay before a pod whose label write kept conflicting is reconciled
+	// again. It doubles with every further requeue of the pod.
+	DefaultConflictRequeue = time.Second
+
+	// Longest delay before a pod whose label write keeps conflicting is
+	// reconciled again
+	DefaultConflictMaxRequeue = time.Minute
+)
+
+var (
+	conflictRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_labeller_conflict_retries_total",
+		Help: "Pod label writes retried on a freshly read pod after a conflict, by operation",
+	}, []string{"operation"})
+
+	conflictRequeues = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pod_labeller_conflict_requeues_total",
+		Help: "Pods requeued because their label write still conflicted after all retries",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(conflictRetries, conflictRequeues)
+}
+
+// conflictBackoff counts the consecutive requeues of pods whose label writes
+// kept conflicting
+type conflictBackoff struct {
+	mutex    sync.Mutex
+	requeues map[types.NamespacedName]int
+}
+
+// next returns the delay before a pod is reconciled again and counts the requeue
+func (b *conflictBackoff) next(key types.NamespacedName) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.requeues == nil {
+		b.requeues = make(map[types.NamespacedName]int)
+	}
+	delay := DefaultConflictRequeue << min(b.requeues[key], 6)
+	b.requeues[key]++
+	return min(delay, DefaultConflictMaxRequeue)
+}
+
+// forget resets the backoff of a pod after a successful write
+func (b *conflictBackoff) forget(key types.NamespacedName) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.requeues, key)
+}
+
+// writePodOnConflict writes the labels mutate derives for a pod, and retries
+// with retry.DefaultRetry when the write conflicts with a concurrent update,
+// e.g. a kubelet patch. Each retry reads the pod again from the API server,
+// as the cache may still hold the version that conflicted, and derives the
+// labels from it again. A pod deleted in the meantime needs no labels.
+func (r *PodReconciler) writePodOnConflict(ctx context.Context, pod *corev1.Pod, operation string, mutate func(*corev1.Pod) (*corev1.Pod, error)) error {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+
+	current := pod
+	attempt := 0
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if attempt > 0 {
+			conflictRetries.WithLabelValues(operation).Inc()
+			current = &corev1.Pod{}
+			if err := reader.Get(ctx, client.ObjectKeyFromObject(pod), current); err != nil {
+				return err
+			}
+		}
+		attempt++
+
+		modified, err := mutate(current)
+		if err != nil {
+			return err
+		}
+		return r.writePod(ctx, current, modified, operation)
+	})
+	if err == nil {
+		r.conflicts.forget(client.ObjectKeyFromObject(pod))
+	}
+	return client.IgnoreNotFound(err)
+}
+
+// requeueOnConflict requeues a pod whose label write still conflicted after
+// all retries with a growing delay, instead of failing the reconcile
+func (r *PodReconciler) requeueOnConflict(ctx context.Context, key types.NamespacedName) (ctrl.Result, error) {
+	delay := r.conflicts.next(key)
+	conflictRequeues.Inc()
+	log.FromContext(ctx).Info("Pod kept changing during the label write, requeueing", "pod", key.Name, "namespace", key.Namespace, "delay", delay)
+	return ctrl.Result{RequeueAfter: delay}, nil
+}
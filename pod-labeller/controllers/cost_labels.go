@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+)
+
+// Key of the cost mapping ConfigMap holding the mapping table
+const CostMappingKey = "mapping.yaml"
+
+// CostMapping derives standardized cost allocation labels, e.g. team,
+// project and env, from the annotations and labels of a pod and its
+// top-level owner. It is read from the mapping.yaml key of a ConfigMap:
+//
+//	labels:
+//	  team:
+//	    sources:
+//	    - annotation: example.com/owner-team
+//	    - ownerLabel: team
+//	    values:
+//	      payments-eng: payments
+//	    default: unassigned
+type CostMapping struct {
+	// Labels maps the cost label keys to how their values are found
+	Labels map[string]CostLabel `json:"labels"`
+
+	keys []string
+}
+
+// CostLabel finds the value of one cost label
+type CostLabel struct {
+	// Sources are tried in order, the first one set on the pod or its owner wins
+	Sources []CostLabelSource `json:"sources"`
+	// Values renames source values, e.g. production to prod. Keys are
+	// matched case-insensitively, values without an entry are kept.
+	Values map[string]string `json:"values,omitempty"`
+	// Default is used when no source is set. Empty leaves the label out.
+	Default string `json:"default,omitempty"`
+}
+
+// CostLabelSource is one annotation or label of the pod or of its top-level
+// owner, e.g. the Deployment of its ReplicaSet. Exactly one field is set.
+type CostLabelSource struct {
+	Annotation      string `json:"annotation,omitempty"`
+	Label           string `json:"label,omitempty"`
+	OwnerAnnotation string `json:"ownerAnnotation,omitempty"`
+	OwnerLabel      string `json:"ownerLabel,omitempty"`
+}
+
+// ParseCostMapping parses and validates a mapping table
+func ParseCostMapping(data string) (*CostMapping, error) {
+	mapping := &CostMapping{}
+	if err := yaml.UnmarshalStrict([]byte(data), mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse cost mapping: %w", err)
+	}
+
+	for key, label := range mapping.Labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid cost label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if len(label.Sources) == 0 && label.Default == "" {
+			return nil, fmt.Errorf("cost label %q has no sources and no default", key)
+		}
+		for i, source := range label.Sources {
+			set := 0
+			for _, field := range []string{source.Annotation, source.Label, source.OwnerAnnotation, source.OwnerLabel} {
+				if field != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				return nil, fmt.Errorf("source %d of cost label %q must set exactly one of annotation, label, ownerAnnotation or ownerLabel", i, key)
+			}
+		}
+		if errs := validation.IsValidLabelValue(label.Default); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid default of cost label %q: %s", key, strings.Join(errs, ", "))
+		}
+
+		values := make(map[string]string, len(label.Values))
+		for from, to := range label.Values {
+			if errs := validation.IsValidLabelValue(to); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid value %q of cost label %q: %s", to, key, strings.Join(errs, ", "))
+			}
+			values[strings.ToLower(from)] = to
+		}
+		label.Values = values
+		mapping.Labels[key] = label
+		mapping.keys = append(mapping.keys, key)
+	}
+	slices.Sort(mapping.keys)
+	return mapping, nil
+}
+
+// usesOwner reports whether any source reads the owner of the pod
+func (m *CostMapping) usesOwner() bool {
+	for _, label := range m.Labels {
+		for _, source := range label.Sources {
+			if source.OwnerAnnotation != "" || source.OwnerLabel != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// labels derives the cost labels of a pod. owner is its top-level owner, nil
+// for pods without one. Values are converted to valid label values.
+func (m *CostMapping) labels(pod *corev1.Pod, owner client.Object) map[string]string {
+	labels := make(map[string]string, len(m.keys))
+	for _, key := range m.keys {
+		label := m.Labels[key]
+		value := ""
+		for _, source := range label.Sources {
+			if value = source.value(pod, owner); value != "" {
+				break
+			}
+		}
+		if mapped, exists := label.Values[strings.ToLower(value)]; exists {
+			value = mapped
+		}
+		if value = toLabelValue(value); value == "" {
+			value = label.Default
+		}
+		if value != "" {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+func (s CostLabelSource) value(pod *corev1.Pod, owner client.Object) string {
+	switch {
+	case s.Annotation != "":
+		return pod.Annotations[s.Annotation]
+	case s.Label != "":
+		return pod.Labels[s.Label]
+	case owner == nil:
+		return ""
+	case s.OwnerAnnotation != "":
+		return owner.GetAnnotations()[s.OwnerAnnotation]
+	default:
+		return owner.GetLabels()[s.OwnerLabel]
+	}
+}
+
+// costMappingCache keeps the parsed mapping of the ConfigMap version last read
+type costMappingCache struct {
+	mutex           sync.Mutex
+	uid             types.UID
+	resourceVersion string
+	parsed          *CostMapping
+}
+
+// get returns the mapping of a ConfigMap. An invalid mapping is logged once
+// per version and derives no labels until it is fixed.
+func (c *costMappingCache) get(ctx context.Context, configMap *corev1.ConfigMap) *CostMapping {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.uid == configMap.UID && c.resourceVersion == configMap.ResourceVersion {
+		return c.parsed
+	}
+
+	c.uid, c.resourceVersion = configMap.UID, configMap.ResourceVersion
+	parsed, err := ParseCostMapping(configMap.Data[CostMappingKey])
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Invalid cost mapping, labelling without cost labels",
+			"configMap", configMap.Name, "namespace", configMap.Namespace)
+		parsed = &CostMapping{}
+	}
+	c.parsed = parsed
+	return parsed
+}
+
+// costLabels derives the cost labels of a pod with the mapping of the cost
+// mapping ConfigMap. A missing ConfigMap derives none.
+func (r *PodReconciler) costLabels(ctx context.Context, pod *corev1.Pod) (map[string]string, error) {
+	if r.CostMappingConfigMap.Name == "" {
+		return nil, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, r.CostMappingConfigMap, configMap); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	mapping := r.costMappings.get(ctx, configMap)
+
+	var owner client.Object
+	if mapping.usesOwner() {
+		var err error
+		if owner, err = r.getTopLevelOwner(ctx, pod); err != nil {
+			return nil, err
+		}
+	}
+	return mapping.labels(pod, owner), nil
+}
+
+// applyCostLabels sets the cost labels of a labelled pod that are missing, or
+// that the controller set before and now derives differently. It returns
+// whether the pod changed.
+func (r *PodReconciler) applyCostLabels(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	labels, err := r.costLabels(ctx, pod)
+	if err != nil {
+		return false, err
+	}
+	applied := appliedLabelKeys(pod)
+	changed := false
+	for key, value := range labels {
+		current, exists := pod.Labels[key]
+		if exists && (current == value || !slices.Contains(applied, key)) {
+			continue
+		}
+		pod.Labels[key] = value
+		changed = true
+	}
+	return changed, nil
+}
+
+// enqueueAllPods enqueues every pod, so a changed cost mapping reaches the
+// pods labelled before
+func (r *PodReconciler) enqueueAllPods() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		podList := &corev1.PodList{}
+		if err := r.List(ctx, podList); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list Pods for the changed cost mapping")
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(podList.Items))
+		for _, pod := range podList.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pod)})
+		}
+		return requests
+	})
+}
+
+// costMappingPredicate passes events of the cost mapping ConfigMap
+func (r *PodReconciler) costMappingPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			// The initial list at startup isn't a change, the pods get their
+			// own create events
+			return r.isCostMapping(e.Object) && e.Object.GetCreationTimestamp().After(r.startedAt)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldConfigMap, okOld := e.ObjectOld.(*corev1.ConfigMap)
+			newConfigMap, okNew := e.ObjectNew.(*corev1.ConfigMap)
+			return okOld && okNew && r.isCostMapping(newConfigMap) &&
+				oldConfigMap.Data[CostMappingKey] != newConfigMap.Data[CostMappingKey]
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+}
+
+func (r *PodReconciler) isCostMapping(obj client.Object) bool {
+	return r.CostMappingConfigMap.Name != "" && client.ObjectKeyFromObject(obj) == r.CostMappingConfigMap
+}
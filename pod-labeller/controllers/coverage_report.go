@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Name of the ConfigMap holding the label coverage report
+	CoverageReportName = "pod-labeller-coverage"
+
+	// Key of the JSON report in the report ConfigMap
+	CoverageReportKey = "report.json"
+
+	// Default interval between two report refreshes
+	DefaultCoverageReportInterval = 10 * time.Minute
+)
+
+// CoverageReport summarizes how far the labelling policy has rolled out
+type CoverageReport struct {
+	GeneratedAt time.Time           `json:"generatedAt"`
+	Total       NamespaceCoverage   `json:"total"`
+	Namespaces  []NamespaceCoverage `json:"namespaces"`
+}
+
+// NamespaceCoverage counts the pods of a namespace by labelling state
+type NamespaceCoverage struct {
+	Namespace string `json:"namespace,omitempty"`
+	Pods      int    `json:"pods"`
+	// Labelled pods carry the required labels
+	Labelled int `json:"labelled"`
+	// Skipped pods are not eligible for labelling: ignored namespaces, opted-out
+	// pods, pods that aren't ready yet and skipped DaemonSet and mirror pods
+	Skipped int `json:"skipped"`
+	// Unlabelled pods are eligible but miss the required labels
+	Unlabelled int `json:"unlabelled"`
+	// CoveragePercent is the share of eligible pods that are labelled
+	CoveragePercent float64 `json:"coveragePercent"`
+}
+
+// CoverageReporter periodically writes a CoverageReport to a ConfigMap.
+// It only reads pods, labelling is left to the PodReconciler.
+type CoverageReporter struct {
+	client.Client
+	Namespace string
+	Interval  time.Duration
+	// Namespaces decides which namespaces count as skipped
+	Namespaces *predicates.NamespaceFilter
+	// SkipPod reports other pods that count as skipped, nil counts none
+	SkipPod func(pod *corev1.Pod) bool
+}
+
+// Start implements manager.Runnable
+func (r *CoverageReporter) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("coverage-report")
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultCoverageReportInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.writeReport(ctx); err != nil {
+			log.Error(err, "Failed to write label coverage report")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *CoverageReporter) buildReport(ctx context.Context) (*CoverageReport, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	namespaces := make(map[string]*NamespaceCoverage)
+	for _, pod := range podList.Items {
+		coverage, exists := namespaces[pod.Namespace]
+		if !exists {
+			coverage = &NamespaceCoverage{Namespace: pod.Namespace}
+			namespaces[pod.Namespace] = coverage
+		}
+
+		coverage.Pods++
+		optOut, _ := optedOut(ctx, r, &pod)
+		switch {
+		case r.Namespaces.Ignored(ctx, pod.Namespace) || optOut || !isPodReady(&pod) || (r.SkipPod != nil && r.SkipPod(&pod)):
+			coverage.Skipped++
+		case hasRequiredLables(&pod):
+			coverage.Labelled++
+		default:
+			coverage.Unlabelled++
+		}
+	}
+
+	report := &CoverageReport{
+		GeneratedAt: time.Now().UTC(),
+		Namespaces:  []NamespaceCoverage{},
+	}
+	for _, coverage := range namespaces {
+		coverage.CoveragePercent = coveragePercent(coverage.Labelled, coverage.Unlabelled)
+		report.Namespaces = append(report.Namespaces, *coverage)
+
+		report.Total.Pods += coverage.Pods
+		report.Total.Labelled += coverage.Labelled
+		report.Total.Skipped += coverage.Skipped
+		report.Total.Unlabelled += coverage.Unlabelled
+	}
+	report.Total.CoveragePercent = coveragePercent(report.Total.Labelled, report.Total.Unlabelled)
+
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+	return report, nil
+}
+
+// coveragePercent rounds to two decimals. Without eligible pods coverage is complete.
+func coveragePercent(labelled, unlabelled int) float64 {
+	eligible := labelled + unlabelled
+	if eligible == 0 {
+		return 100
+	}
+	return math.Round(float64(labelled)/float64(eligible)*10000) / 100
+}
+
+func (r *CoverageReporter) writeReport(ctx context.Context) error {
+	report, err := r.buildReport(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = r.Get(ctx, client.ObjectKey{Name: CoverageReportName, Namespace: r.Namespace}, configMap)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      CoverageReportName,
+				Namespace: r.Namespace,
+			},
+			Data: map[string]string{
+				CoverageReportKey: string(data),
+			},
+		}
+		return r.Create(ctx, configMap)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[CoverageReportKey] = string(data)
+	return r.Update(ctx, configMap)
+}
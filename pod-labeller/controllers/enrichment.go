@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Defaults of the enrichment lookup
+	DefaultEnrichmentTimeout  = 2 * time.Second
+	DefaultEnrichmentCacheTTL = 10 * time.Minute
+
+	// Consecutive failed lookups that open the circuit, and how long it stays
+	// open before a single lookup is let through again
+	DefaultEnrichmentFailureThreshold = 5
+	DefaultEnrichmentOpenDuration     = 30 * time.Second
+
+	// Responses larger than this are rejected
+	maxEnrichmentResponseBytes = 64 << 10
+
+	// Annotation on a pod labelled while the enrichment lookup failed. The
+	// pod isn't marked processed until a later lookup succeeds.
+	EnrichmentPendingAnnotation = "pod-labeller/enrichment-pending"
+)
+
+// ErrEnrichmentCircuitOpen is returned while lookups are short-circuited after
+// repeated failures of the enrichment service
+var ErrEnrichmentCircuitOpen = errors.New("enrichment circuit is open")
+
+var (
+	enrichmentLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_labeller_enrichment_lookups_total",
+		Help: "Enrichment lookups by result: cached, success, error or circuit-open",
+	}, []string{"result"})
+
+	enrichmentCircuitOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_labeller_enrichment_circuit_open",
+		Help: "1 while enrichment lookups are short-circuited after repeated failures",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(enrichmentLookups, enrichmentCircuitOpen)
+}
+
+// EnrichmentRequest is the pod metadata posted to the enrichment service
+type EnrichmentRequest struct {
+	Namespace      string            `json:"namespace"`
+	Name           string            `json:"name"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+	OwnerKind      string            `json:"ownerKind,omitempty"`
+	OwnerName      string            `json:"ownerName,omitempty"`
+	ServiceAccount string            `json:"serviceAccount,omitempty"`
+	Images         []string          `json:"images,omitempty"`
+}
+
+// EnrichmentResponse is what the enrichment service answers with
+type EnrichmentResponse struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// Enricher looks up additional labels for a pod in an external HTTP service,
+// e.g. a CMDB. Answers are cached per owning workload, so the replicas of a
+// Deployment cost one lookup per cache TTL. After FailureThreshold failed
+// lookups in a row the circuit opens and lookups fail right away for
+// OpenDuration, then a single lookup decides whether it closes again.
+type Enricher struct {
+	// URL the pod metadata is posted to
+	URL string
+	// Timeout of a single lookup
+	Timeout time.Duration
+	// CacheTTL is how long an answer is reused
+	CacheTTL time.Duration
+	// FailureThreshold is the number of failed lookups in a row that open the circuit
+	FailureThreshold int
+	// OpenDuration is how long the circuit stays open
+	OpenDuration time.Duration
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+
+	mutex    sync.Mutex
+	cache    map[string]cachedEnrichment
+	failures int
+	// openUntil is set while the circuit is open, probing while a half-open
+	// lookup is in flight
+	openUntil time.Time
+	probing   bool
+	pruned    time.Time
+}
+
+type cachedEnrichment struct {
+	labels  map[string]string
+	expires time.Time
+}
+
+// Labels returns the labels the enrichment service has for the pod. Invalid
+// label keys and values in the answer are dropped. A nil enricher returns no
+// labels.
+func (e *Enricher) Labels(ctx context.Context, pod *corev1.Pod) (map[string]string, error) {
+	if e == nil || e.URL == "" {
+		return nil, nil
+	}
+
+	request := enrichmentRequest(pod)
+	key := enrichmentCacheKey(request)
+	now := time.Now()
+
+	if labels, cached := e.cached(key, now); cached {
+		enrichmentLookups.WithLabelValues("cached").Inc()
+		return labels, nil
+	}
+	if !e.allow(now) {
+		enrichmentLookups.WithLabelValues("circuit-open").Inc()
+		return nil, ErrEnrichmentCircuitOpen
+	}
+
+	labels, err := e.lookup(ctx, request)
+	e.done(key, labels, err)
+	if err != nil {
+		enrichmentLookups.WithLabelValues("error").Inc()
+		return nil, err
+	}
+	enrichmentLookups.WithLabelValues("success").Inc()
+	return labels, nil
+}
+
+// markEnrichmentPending marks a pod whose enrichment lookup failed: it loses
+// the processed label so it isn't skipped, and the annotation makes the drift
+// check retry the lookup
+func markEnrichmentPending(pod *corev1.Pod) {
+	delete(pod.Labels, ProcessedLabel)
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[EnrichmentPendingAnnotation] = "true"
+}
+
+// retryEnrichment looks up the enrichment labels of a pod marked pending and
+// adds them, without replacing labels the pod has. It reports whether the pod
+// was pending.
+func (r *PodReconciler) retryEnrichment(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	if _, pending := pod.Annotations[EnrichmentPendingAnnotation]; !pending {
+		return false, nil
+	}
+	enriched, err := r.Enricher.Labels(ctx, pod)
+	if err != nil {
+		return false, err
+	}
+	for key, value := range enriched {
+		if _, exists := pod.Labels[key]; !exists {
+			pod.Labels[key] = value
+		}
+	}
+	pod.Labels[ProcessedLabel] = "true"
+	delete(pod.Annotations, EnrichmentPendingAnnotation)
+	return true, nil
+}
+
+// enrichmentRequest collects the pod metadata sent to the enrichment service
+func enrichmentRequest(pod *corev1.Pod) EnrichmentRequest {
+	request := EnrichmentRequest{
+		Namespace:      pod.Namespace,
+		Name:           pod.Name,
+		Labels:         pod.Labels,
+		Annotations:    pod.Annotations,
+		ServiceAccount: pod.Spec.ServiceAccountName,
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		request.OwnerKind = owner.Kind
+		request.OwnerName = owner.Name
+	}
+	for _, container := range pod.Spec.Containers {
+		request.Images = append(request.Images, container.Image)
+	}
+	return request
+}
+
+// enrichmentCacheKey shares answers between the pods of a workload, pods
+// without an owner are looked up on their own
+func enrichmentCacheKey(request EnrichmentRequest) string {
+	if request.OwnerName != "" {
+		return request.Namespace + "/" + request.OwnerKind + "/" + request.OwnerName
+	}
+	return request.Namespace + "/Pod/" + request.Name
+}
+
+func (e *Enricher) cached(key string, now time.Time) (map[string]string, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	entry, exists := e.cache[key]
+	if !exists || now.After(entry.expires) {
+		return nil, false
+	}
+	return entry.labels, true
+}
+
+// allow reports whether a lookup may be made. Once the open circuit cools
+// down one lookup is let through, the others keep failing until it returns.
+func (e *Enricher) allow(now time.Time) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(e.openUntil) || e.probing {
+		return false
+	}
+	e.probing = true
+	return true
+}
+
+// done records the outcome of a lookup in the cache and the circuit breaker
+func (e *Enricher) done(key string, labels map[string]string, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := time.Now()
+	e.probing = false
+	if err != nil {
+		e.failures++
+		if e.failures >= max(e.FailureThreshold, 1) {
+			e.openUntil = now.Add(e.openDuration())
+			enrichmentCircuitOpen.Set(1)
+		}
+		return
+	}
+
+	e.failures = 0
+	e.openUntil = time.Time{}
+	enrichmentCircuitOpen.Set(0)
+
+	if e.cache == nil {
+		e.cache = make(map[string]cachedEnrichment)
+	}
+	e.prune(now)
+	e.cache[key] = cachedEnrichment{labels: labels, expires: now.Add(e.cacheTTL())}
+}
+
+// prune drops expired answers once per cache TTL
+func (e *Enricher) prune(now time.Time) {
+	if now.Sub(e.pruned) < e.cacheTTL() {
+		return
+	}
+	e.pruned = now
+	for key, entry := range e.cache {
+		if now.After(entry.expires) {
+			delete(e.cache, key)
+		}
+	}
+}
+
+func (e *Enricher) lookup(ctx context.Context, request EnrichmentRequest) (map[string]string, error) {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultEnrichmentTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	httpClient := e.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	// Unknown pods aren't an error, they just get no extra labels
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrichment service returned %s", response.Status)
+	}
+
+	var answer EnrichmentResponse
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxEnrichmentResponseBytes)).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("decoding enrichment response: %w", err)
+	}
+	return validEnrichmentLabels(answer.Labels), nil
+}
+
+// validEnrichmentLabels drops labels Kubernetes would reject and the labels
+// this controller owns
+func validEnrichmentLabels(labels map[string]string) map[string]string {
+	valid := make(map[string]string, len(labels))
+	for key, value := range labels {
+		if key == ProcessedLabel || len(validation.IsQualifiedName(key)) > 0 || len(validation.IsValidLabelValue(value)) > 0 {
+			continue
+		}
+		valid[key] = value
+	}
+	return valid
+}
+
+func (e *Enricher) cacheTTL() time.Duration {
+	if e.CacheTTL <= 0 {
+		return DefaultEnrichmentCacheTTL
+	}
+	return e.CacheTTL
+}
+
+func (e *Enricher) openDuration() time.Duration {
+	if e.OpenDuration <= 0 {
+		return DefaultEnrichmentOpenDuration
+	}
+	return e.OpenDuration
+}
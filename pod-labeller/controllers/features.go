@@ -0,0 +1,36 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/featuregate"
+
+const (
+	// ImageLabelRefresh replaces stale image labels when container images change
+	ImageLabelRefresh featuregate.Feature = "ImageLabelRefresh"
+
+	// NewPodPrioritization labels new pods before relabel and drift-repair work
+	NewPodPrioritization featuregate.Feature = "NewPodPrioritization"
+
+	// TopologyAwareOrdering spreads the queue across the zones of the pods'
+	// nodes, so a churn storm in one zone doesn't hold back the others
+	TopologyAwareOrdering featuregate.Feature = "TopologyAwareOrdering"
+
+	// ProcessedPodWarmUp skips the startup reconcile of pods that were already
+	// labelled before a restart and haven't changed since
+	ProcessedPodWarmUp featuregate.Feature = "ProcessedPodWarmUp"
+
+	// AdmissionLabelling labels pods at creation with a mutating webhook
+	AdmissionLabelling featuregate.Feature = "AdmissionLabelling"
+
+	// ParsedImageLabels replaces the flattened image label with registry,
+	// repository and tag or digest labels
+	ParsedImageLabels featuregate.Feature = "ParsedImageLabels"
+)
+
+// FeatureGates lists the features of this controller that can be toggled with --feature-gates
+var FeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	ImageLabelRefresh:     {Default: true, Stage: featuregate.Beta},
+	NewPodPrioritization:  {Default: false, Stage: featuregate.Alpha, StartupOnly: true},
+	TopologyAwareOrdering: {Default: false, Stage: featuregate.Alpha, StartupOnly: true},
+	ProcessedPodWarmUp:    {Default: true, Stage: featuregate.Beta, StartupOnly: true},
+	AdmissionLabelling:    {Default: false, Stage: featuregate.Alpha, StartupOnly: true},
+	ParsedImageLabels:     {Default: false, Stage: featuregate.Alpha},
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Modes for pods of workloads managed by Argo CD or Flux
+	// GitOpsModeLabel labels them like any other pod (default)
+	GitOpsModeLabel = "label"
+	// GitOpsModeSuggest only records the labels it would add in SuggestedLabelsAnnotation
+	GitOpsModeSuggest = "suggest"
+	// GitOpsModeSkip leaves them alone
+	GitOpsModeSkip = "skip"
+
+	// Annotation holding the labels proposed for a GitOps-managed pod as a JSON object
+	SuggestedLabelsAnnotation = "pod-labeller/suggested-labels"
+
+	// GitOps tools detected on pods and their workloads
+	GitOpsManagerArgoCD = "argocd"
+	GitOpsManagerFlux   = "flux"
+)
+
+// gitOpsMarker is a label or annotation a GitOps tool sets on the objects it applies
+type gitOpsMarker struct {
+	manager    string
+	key        string
+	annotation bool
+}
+
+// gitOpsMarkers are the standard tracking labels and annotations of Argo CD
+// and Flux. app.kubernetes.io/instance is left out, Helm sets it as well.
+var gitOpsMarkers = []gitOpsMarker{
+	{manager: GitOpsManagerArgoCD, key: "argocd.argoproj.io/instance"},
+	{manager: GitOpsManagerArgoCD, key: "argocd.argoproj.io/tracking-id", annotation: true},
+	{manager: GitOpsManagerFlux, key: "kustomize.toolkit.fluxcd.io/name"},
+	{manager: GitOpsManagerFlux, key: "helm.toolkit.fluxcd.io/name"},
+}
+
+// ValidGitOpsMode reports whether mode is one of the GitOps modes
+func ValidGitOpsMode(mode string) bool {
+	switch mode {
+	case GitOpsModeLabel, GitOpsModeSuggest, GitOpsModeSkip:
+		return true
+	}
+	return false
+}
+
+// gitOpsManagerOf returns the GitOps tool that applied an object, or an empty string
+func gitOpsManagerOf(obj client.Object) string {
+	for _, marker := range gitOpsMarkers {
+		values := obj.GetLabels()
+		if marker.annotation {
+			values = obj.GetAnnotations()
+		}
+		if _, exists := values[marker.key]; exists {
+			return marker.manager
+		}
+	}
+	return ""
+}
+
+// gitOpsManager returns the GitOps tool managing a pod, either directly or
+// through its owning Deployment or StatefulSet. Tools usually don't propagate
+// their tracking labels into pod templates, so the workload is checked too.
+func (r *PodReconciler) gitOpsManager(ctx context.Context, pod *corev1.Pod) (string, error) {
+	if manager := gitOpsManagerOf(pod); manager != "" {
+		return manager, nil
+	}
+
+	workload, _, err := r.getOwningWorkload(ctx, pod)
+	if err != nil || workload == nil {
+		return "", err
+	}
+	return gitOpsManagerOf(workload), nil
+}
+
+// suggestedLabels returns the generated labels a pod doesn't carry yet as a
+// JSON object, or an empty string when there are none. The processed label is
+// left out, nothing was processed.
+func (r *PodReconciler) suggestedLabels(pod *corev1.Pod) (string, error) {
+	suggested := make(map[string]string)
+	for key, value := range r.generateLabels(pod) {
+		if key != ProcessedLabel && pod.Labels[key] != value {
+			suggested[key] = value
+		}
+	}
+	if len(suggested) == 0 {
+		return "", nil
+	}
+
+	// Map keys are marshalled sorted, so the value is stable
+	data, err := json.Marshal(suggested)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode suggested labels: %w", err)
+	}
+	return string(data), nil
+}
+
+// reconcileGitOpsPod handles a pod of a workload applied by Argo CD or Flux.
+// Its labels belong in git, where they don't fight the controller's writes.
+func (r *PodReconciler) reconcileGitOpsPod(ctx context.Context, pod *corev1.Pod, manager string) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if r.GitOpsMode == GitOpsModeSkip {
+		log.Info("Pod is managed by GitOps, skipping", "pod", pod.Name, "manager", manager)
+		return ctrl.Result{}, nil
+	}
+
+	suggestion, err := r.suggestedLabels(pod)
+	if err != nil {
+		log.Error(err, "Failed to suggest labels for Pod", "pod", pod.Name)
+		return ctrl.Result{}, nil
+	}
+	current, exists := pod.Annotations[SuggestedLabelsAnnotation]
+	if current == suggestion && exists == (suggestion != "") {
+		log.Info("Pod is managed by GitOps, suggested labels are up to date", "pod", pod.Name, "manager", manager)
+		return ctrl.Result{}, nil
+	}
+
+	if delay := r.WriteLimiter.Delay(client.ObjectKeyFromObject(pod)); delay > 0 {
+		log.Info("Namespace write rate exceeded, deferring Pod", "pod", pod.Name, "namespace", pod.Namespace, "delay", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	podCopy := pod.DeepCopy()
+	if suggestion == "" {
+		delete(podCopy.Annotations, SuggestedLabelsAnnotation)
+	} else {
+		if podCopy.Annotations == nil {
+			podCopy.Annotations = make(map[string]string)
+		}
+		podCopy.Annotations[SuggestedLabelsAnnotation] = suggestion
+	}
+	if err := r.Patch(ctx, podCopy, client.MergeFrom(pod), client.FieldOwner(FieldManager)); err != nil {
+		log.Error(err, "Failed to record suggested labels on Pod", "pod", pod.Name)
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+
+	log.Info("Recorded suggested labels on GitOps-managed Pod", "pod", pod.Name, "manager", manager, "labels", suggestion)
+	return ctrl.Result{}, nil
+}
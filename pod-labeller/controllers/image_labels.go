@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Label holding the sanitized image of the Pod's first container
+const ImageLabel = "image"
+
+// Prefix shared by all image labels besides ImageLabel
+const imageLabelPrefix = "image-"
+
+// Labels holding the parts of the first container's image reference, with
+// ParsedImageLabels instead of ImageLabel
+const (
+	ImageRegistryLabel   = "image-registry"
+	ImageRepositoryLabel = "image-repository"
+	ImageTagLabel        = "image-tag"
+	ImageDigestLabel     = "image-digest"
+)
+
+// Registry and tag of image references that don't name them, as resolved by
+// the container runtime
+const (
+	defaultImageRegistry = "docker.io"
+	defaultImageTag      = "latest"
+)
+
+// ImageReference is a container image reference split into its parts
+type ImageReference struct {
+	// Registry is the host, with port, the image is pulled from
+	Registry string
+	// Repository is the path of the image in the registry, e.g. library/nginx
+	Repository string
+	// Tag is empty for references pinned by digest only
+	Tag string
+	// Digest is the content digest, e.g. sha256:<hex>, if pinned
+	Digest string
+}
+
+// parseImageReference splits an image reference the way the container runtime
+// resolves it: the first path component is the registry when it looks like a
+// host (has a dot or port, or is localhost), otherwise the image is on Docker
+// Hub, where single component names live under library/. References without
+// tag or digest use the latest tag.
+func parseImageReference(image string) ImageReference {
+	var reference ImageReference
+	name, digest, _ := strings.Cut(image, "@")
+	reference.Digest = digest
+
+	// A colon after the last slash separates the tag, others are registry ports
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, reference.Tag = name[:i], name[i+1:]
+	}
+	if reference.Tag == "" && reference.Digest == "" {
+		reference.Tag = defaultImageTag
+	}
+
+	host, path, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		reference.Registry, reference.Repository = host, path
+	} else {
+		reference.Registry, reference.Repository = defaultImageRegistry, name
+		if !found {
+			reference.Repository = "library/" + name
+		}
+	}
+	return reference
+}
+
+// parsedImageLabels returns the sanitized registry, repository and tag or
+// digest labels of an image
+func parsedImageLabels(image string) map[string]string {
+	reference := parseImageReference(image)
+	labels := map[string]string{
+		ImageRegistryLabel:   sanitizeLabelValue(reference.Registry),
+		ImageRepositoryLabel: sanitizeLabelValue(reference.Repository),
+	}
+	if reference.Tag != "" {
+		labels[ImageTagLabel] = sanitizeLabelValue(reference.Tag)
+	}
+	if reference.Digest != "" {
+		labels[ImageDigestLabel] = sanitizeLabelValue(reference.Digest)
+	}
+	return labels
+}
+
+// generateImageLabels creates all image-derived labels of a Pod: the image of
+// the first container, or its parsed parts with ParsedImageLabels, and, for
+// multi-container pods, per-container image labels or a single combined hash
+// label
+func (r *PodReconciler) generateImageLabels(pod *corev1.Pod) map[string]string {
+	labels := make(map[string]string)
+
+	if len(pod.Spec.Containers) > 0 && r.Config.FeatureEnabled(ParsedImageLabels, r.ParseImageLabels) {
+		maps.Copy(labels, parsedImageLabels(pod.Spec.Containers[0].Image))
+	} else if len(pod.Spec.Containers) > 0 {
+		// sanitize image name
+		sanitizedImage := sanitizeLabelValue(pod.Spec.Containers[0].Image)
+		if sanitizedImage != "" {
+			labels[ImageLabel] = sanitizedImage
+		}
+	}
+
+	containers := podImageContainers(pod)
+	if len(containers) > 1 {
+		maps.Copy(labels, r.generateContainerImageLabels(containers))
+	}
+
+	return labels
+}
+
+// podImageContainers returns the name and image of all regular and ephemeral containers
+func podImageContainers(pod *corev1.Pod) []corev1.Container {
+	containers := append([]corev1.Container{}, pod.Spec.Containers...)
+	for _, ephemeral := range pod.Spec.EphemeralContainers {
+		containers = append(containers, corev1.Container{
+			Name:  ephemeral.Name,
+			Image: ephemeral.Image,
+		})
+	}
+	return containers
+}
+
+// generateContainerImageLabels creates per-container image labels, or a single combined
+// hash label when configured or when the pod has more containers than allowed
+func (r *PodReconciler) generateContainerImageLabels(containers []corev1.Container) map[string]string {
+	labels := make(map[string]string)
+
+	maxLabels := r.Config.Int(SettingMaxImageLabels, r.MaxImageLabels)
+	if maxLabels <= 0 {
+		maxLabels = DefaultMaxImageLabels
+	}
+
+	if r.ImageLabelMode == ImageLabelModeHash || len(containers) > maxLabels {
+		labels[ImageHashLabel] = imageHash(containers)
+		return labels
+	}
+
+	for _, container := range containers {
+		labels[containerImageLabelKey(container.Name)] = sanitizeLabelValue(container.Image)
+	}
+	return labels
+}
+
+// containerImageLabelKey builds a valid label key for a container image label.
+// Keys over 63 characters are cut and end in a short hash of the full key, so
+// containers whose names only differ past the cut keep distinct labels.
+func containerImageLabelKey(containerName string) string {
+	key := ContainerImageLabelPrefix + containerName
+	if len(key) > 63 {
+		sum := sha256.Sum256([]byte(key))
+		suffix := hex.EncodeToString(sum[:])[:8]
+		key = strings.TrimRight(key[:63-len(suffix)-1], "-_.") + "-" + suffix
+	}
+	// Label keys must end with an alphanumeric character
+	return strings.TrimRight(key, "-_.")
+}
+
+// imageHash returns a short stable hash of all container images of a pod
+func imageHash(containers []corev1.Container) string {
+	images := make([]string, 0, len(containers))
+	for _, container := range containers {
+		images = append(images, container.Name+"="+container.Image)
+	}
+	sort.Strings(images)
+
+	sum := sha256.Sum256([]byte(strings.Join(images, ",")))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// isImageLabelKey reports whether a label key has the shape of an image
+// label, including the image-<containername> keys of earlier versions. It
+// doesn't tell who set it, see ownedImageLabel.
+func isImageLabelKey(key string) bool {
+	return key == ImageLabel || strings.HasPrefix(key, imageLabelPrefix)
+}
+
+// ownedImageLabel reports whether a label key is an image label the
+// controller added, as recorded in the applied-labels annotation. User labels
+// that merely share the image- prefix are never touched.
+func ownedImageLabel(key string, applied []string) bool {
+	return isImageLabelKey(key) && slices.Contains(applied, key)
+}
+
+// hasStaleImageLabels reports whether the Pod's image labels no longer match its containers
+func (r *PodReconciler) hasStaleImageLabels(pod *corev1.Pod) bool {
+	// Only pods labelled by this controller carry image labels we own
+	if pod.Labels[ProcessedLabel] != "true" {
+		return false
+	}
+
+	desired := r.generateImageLabels(pod)
+	for key, value := range desired {
+		if pod.Labels[key] != value {
+			return true
+		}
+	}
+
+	// Labels of removed containers or a switched label mode are stale too
+	applied := appliedLabelKeys(pod)
+	for key := range pod.Labels {
+		if _, wanted := desired[key]; ownedImageLabel(key, applied) && !wanted {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshImageLabels replaces the image labels the controller added to a Pod
+// with ones matching its current containers
+func (r *PodReconciler) refreshImageLabels(pod *corev1.Pod) {
+	applied := appliedLabelKeys(pod)
+	maps.DeleteFunc(pod.Labels, func(key, _ string) bool {
+		return ownedImageLabel(key, applied)
+	})
+	maps.Copy(pod.Labels, r.generateImageLabels(pod))
+}
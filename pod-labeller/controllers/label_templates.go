@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// LabelTemplateData is what label templates are evaluated against
+type LabelTemplateData struct {
+	Name      string
+	Namespace string
+	// OwnerKind and OwnerName are the controller of the pod. Pods of a
+	// Deployment's ReplicaSet report the Deployment.
+	OwnerKind      string
+	OwnerName      string
+	ServiceAccount string
+	NodeName       string
+	// Image is the image of the first container
+	Image       string
+	Labels      map[string]string
+	Annotations map[string]string
+	// Pod is the whole Pod, e.g. {{ .Pod.Spec.PriorityClassName }}
+	Pod *corev1.Pod
+}
+
+// Functions available in label templates besides the text/template builtins
+var labelTemplateFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// LabelTemplates are labels whose values are Go templates, one
+// "key=template" per line, e.g. team-env={{ .Namespace }}-{{ .OwnerKind }}
+type LabelTemplates struct {
+	keys      []string
+	templates map[string]*template.Template
+}
+
+// ParseLabelTemplates parses one "key=template" per line. Empty lines are skipped.
+func ParseLabelTemplates(raw string) (*LabelTemplates, error) {
+	templates := &LabelTemplates{templates: make(map[string]*template.Template)}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, text, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("label template %q is not key=template", line)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if _, exists := templates.templates[key]; exists {
+			return nil, fmt.Errorf("duplicate label template %q", key)
+		}
+		parsed, err := template.New(key).Option("missingkey=zero").Funcs(labelTemplateFuncs).Parse(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid label template %q: %w", key, err)
+		}
+		templates.keys = append(templates.keys, key)
+		templates.templates[key] = parsed
+	}
+	slices.Sort(templates.keys)
+	return templates, nil
+}
+
+// ValidateLabelTemplates checks the labelTemplates setting
+func ValidateLabelTemplates(raw string) error {
+	_, err := ParseLabelTemplates(raw)
+	return err
+}
+
+// Labels evaluates the templates against a pod. Values are converted to
+// valid label values, labels whose value is empty or fails to evaluate are
+// left out and returned as errors.
+func (t *LabelTemplates) Labels(pod *corev1.Pod) (map[string]string, []error) {
+	if t == nil || len(t.keys) == 0 {
+		return nil, nil
+	}
+
+	data := newLabelTemplateData(pod)
+	labels := make(map[string]string, len(t.keys))
+	var errs []error
+	for _, key := range t.keys {
+		var value bytes.Buffer
+		if err := t.templates[key].Execute(&value, data); err != nil {
+			errs = append(errs, fmt.Errorf("label template %q: %w", key, err))
+			continue
+		}
+		if labelValue := toLabelValue(value.String()); labelValue != "" {
+			labels[key] = labelValue
+		}
+	}
+	return labels, errs
+}
+
+func newLabelTemplateData(pod *corev1.Pod) LabelTemplateData {
+	data := LabelTemplateData{
+		Name:           pod.Name,
+		Namespace:      pod.Namespace,
+		ServiceAccount: pod.Spec.ServiceAccountName,
+		NodeName:       pod.Spec.NodeName,
+		Labels:         pod.Labels,
+		Annotations:    pod.Annotations,
+		Pod:            pod,
+	}
+	if len(pod.Spec.Containers) > 0 {
+		data.Image = pod.Spec.Containers[0].Image
+	}
+
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		data.OwnerKind, data.OwnerName = owner.Kind, owner.Name
+		// ReplicaSets of a Deployment are named <deployment>-<pod-template-hash>
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			data.OwnerKind, data.OwnerName = "Deployment", strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	}
+	return data
+}
+
+// toLabelValue converts a template result to a valid label value: invalid
+// characters become dashes, and the value is cut to 63 characters starting
+// and ending with an alphanumeric character
+func toLabelValue(value string) string {
+	converted := []byte(strings.TrimSpace(value))
+	for i, char := range converted {
+		if !isAlphanumeric(rune(char)) && char != '-' && char != '_' && char != '.' {
+			converted[i] = '-'
+		}
+	}
+	result := string(converted)
+	if len(result) > validation.LabelValueMaxLength {
+		result = result[:validation.LabelValueMaxLength]
+	}
+	return strings.TrimFunc(result, func(r rune) bool { return !isAlphanumeric(r) })
+}
+
+// labelTemplateCache keeps the parsed templates of the active configuration
+type labelTemplateCache struct {
+	mutex  sync.Mutex
+	raw    string
+	parsed *LabelTemplates
+}
+
+// get returns the parsed templates of raw. Invalid templates never reach
+// it, the flag and the setting are validated before.
+func (c *labelTemplateCache) get(raw string) (*LabelTemplates, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.parsed != nil && c.raw == raw {
+		return c.parsed, nil
+	}
+	parsed, err := ParseLabelTemplates(raw)
+	if err != nil {
+		return nil, err
+	}
+	c.raw, c.parsed = raw, parsed
+	return parsed, nil
+}
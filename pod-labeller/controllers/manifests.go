@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Manifest describes the permissions, ports and leader election of the
+// pod-labeller for the manifests subcommand
+func Manifest() manifests.Manifest {
+	return manifests.Manifest{
+		Controller: "pod-labeller",
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch", "update", "patch"}},
+			// Namespace labels and annotations for the opt-outs, the opt-in and --propagate-namespace-labels
+			{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "list", "watch"}},
+			// Owner pod templates, owner chains and --label-workload-kinds
+			{APIGroups: []string{"apps"}, Resources: []string{"replicasets"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets"}, Verbs: []string{"get", "list", "watch", "update", "patch"}},
+			{APIGroups: []string{"apps"}, Resources: []string{"daemonsets"}, Verbs: []string{"get", "list", "watch", "patch"}},
+			{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"get", "list", "watch", "patch"}},
+			{APIGroups: []string{"batch"}, Resources: []string{"jobs", "cronjobs"}, Verbs: []string{"get", "list", "watch"}},
+			// Zones of the pods' nodes for TopologyAwareOrdering
+			{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list", "watch"}},
+			// Coverage report, cost mapping table and the configmap: patch audit sink
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list", "watch", "create", "update"}},
+		},
+		// Pod labelling webhook of AdmissionLabelling
+		Ports:           []corev1.ContainerPort{{Name: "webhook", ContainerPort: 9443, Protocol: corev1.ProtocolTCP}},
+		HealthProbePort: 8081,
+		LeaderElection:  true,
+	}
+}
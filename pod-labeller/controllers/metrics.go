@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Operations pod labels are written with
+const (
+	// Labels added to a pod that wasn't labelled yet
+	OperationLabel = "label"
+	// Drifted labels of an already labelled pod repaired
+	OperationRepair = "repair"
+	// Labels of an opted-out pod removed
+	OperationRemove = "remove"
+	// Labels added by the webhook at pod creation
+	OperationAdmission = "admission"
+)
+
+// Reasons a reconciled pod is left unchanged
+const (
+	SkipReasonIgnoredNamespace = "ignored-namespace"
+	SkipReasonNotFound         = "not-found"
+	SkipReasonOptedOut         = "opted-out"
+	SkipReasonNotReady         = "not-ready"
+	SkipReasonGitOps           = "gitops"
+	SkipReasonUpToDate         = "up-to-date"
+	SkipReasonBackpressure     = "backpressure"
+	SkipReasonRateLimited      = "rate-limited"
+	SkipReasonNodeManaged      = "node-managed"
+)
+
+var (
+	podsLabeled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_labeller_pods_labeled_total",
+		Help: "Pods whose labels were written by operation: label, repair, remove or admission",
+	}, []string{"namespace", "operation"})
+
+	labelUpdateErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_labeller_label_update_errors_total",
+		Help: "Failed pod label writes by operation (label, repair or remove) and API error type (e.g. Conflict, Forbidden)",
+	}, []string{"operation", "error_type"})
+
+	reconcileDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pod_labeller_reconcile_duration_seconds",
+		Help:    "Time a pod reconcile takes, including owner lookups, enrichment and the label write",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	podsSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_labeller_pods_skipped_total",
+		Help: "Reconciled pods left unchanged by reason: ignored-namespace, not-found, opted-out, not-ready, gitops, up-to-date, backpressure, rate-limited or node-managed",
+	}, []string{"reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(podsLabeled, labelUpdateErrors, reconcileDuration, podsSkipped)
+}
+
+// recordLabelWrite counts a pod label write of an operation, or its failure
+func recordLabelWrite(namespace, operation string, err error) {
+	if err != nil {
+		labelUpdateErrors.WithLabelValues(operation, errorType(err)).Inc()
+		return
+	}
+	podsLabeled.WithLabelValues(namespace, operation).Inc()
+}
+
+func recordSkip(reason string) {
+	podsSkipped.WithLabelValues(reason).Inc()
+}
+
+// errorType classifies an error by its API status reason. Errors that didn't
+// come from the API server are reported as Unknown.
+func errorType(err error) string {
+	if reason := errors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+		return string(reason)
+	}
+	return "Unknown"
+}
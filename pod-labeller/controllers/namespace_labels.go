@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Annotation on pods listing the label keys copied from their namespace
+const NamespaceLabelsAnnotation = "pod-labeller/namespace-labels"
+
+func (r *PodReconciler) propagatedNamespaceLabelKeys() []string {
+	// The setting was validated when it was applied
+	keys, _ := ParseLabelKeys(r.Config.String(SettingPropagateNamespaceLabels, strings.Join(r.PropagateNamespaceLabels, ",")))
+	return keys
+}
+
+// syncNamespaceLabels copies the configured labels of a namespace onto a pod
+// or workload and removes the ones it copied before that the namespace no
+// longer has. Labels the object has from elsewhere are never replaced. It
+// returns whether the object changed.
+func (r *PodReconciler) syncNamespaceLabels(ctx context.Context, namespace string, obj client.Object) (bool, error) {
+	keys := r.propagatedNamespaceLabelKeys()
+	previous := namespaceLabelKeys(obj)
+	if len(keys) == 0 && len(previous) == 0 {
+		return false, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	changed := false
+	var propagated []string
+	for _, key := range previous {
+		if _, exists := ns.Labels[key]; !exists || !slices.Contains(keys, key) {
+			delete(labels, key)
+			changed = true
+		}
+	}
+	for _, key := range keys {
+		value, exists := ns.Labels[key]
+		if !exists {
+			continue
+		}
+		current, set := labels[key]
+		if set && !slices.Contains(previous, key) {
+			// The object has the label from elsewhere
+			continue
+		}
+		propagated = append(propagated, key)
+		if set && current == value {
+			continue
+		}
+		labels[key] = value
+		changed = true
+	}
+	obj.SetLabels(labels)
+
+	slices.Sort(propagated)
+	if !slices.Equal(propagated, previous) {
+		changed = true
+	}
+	annotations := obj.GetAnnotations()
+	if len(propagated) == 0 {
+		delete(annotations, NamespaceLabelsAnnotation)
+		return changed, nil
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[NamespaceLabelsAnnotation] = strings.Join(propagated, ",")
+	obj.SetAnnotations(annotations)
+	return changed, nil
+}
+
+// namespaceLabelKeys returns the label keys a pod or workload got from its namespace, sorted
+func namespaceLabelKeys(obj client.Object) []string {
+	keys, _ := ParseLabelKeys(obj.GetAnnotations()[NamespaceLabelsAnnotation])
+	slices.Sort(keys)
+	return keys
+}
+
+// namespaceLabelsChangedPredicate passes namespaces whose propagated labels changed
+func (r *PodReconciler) namespaceLabelsChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			for _, key := range r.propagatedNamespaceLabelKeys() {
+				oldValue, oldExists := e.ObjectOld.GetLabels()[key]
+				newValue, newExists := e.ObjectNew.GetLabels()[key]
+				if oldExists != newExists || oldValue != newValue {
+					return true
+				}
+			}
+			return false
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+}
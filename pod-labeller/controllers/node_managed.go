@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SkipsNodeManaged reports whether a pod is left unlabelled because a node
+// level mechanism manages it: pods of DaemonSets with SkipDaemonSetPods and
+// mirror pods of static pods with SkipMirrorPods. Labelling them only causes
+// churn, e.g. DaemonSet template labels roll every node.
+func (r *PodReconciler) SkipsNodeManaged(pod *corev1.Pod) bool {
+	return (isMirrorPod(pod) && r.Config.Bool(SettingSkipMirrorPods, r.SkipMirrorPods)) ||
+		(isDaemonSetPod(pod) && r.Config.Bool(SettingSkipDaemonSetPods, r.SkipDaemonSetPods))
+}
+
+// isMirrorPod reports whether a pod is the API server mirror of a static pod
+// kubelet runs from its manifest directory
+func isMirrorPod(pod *corev1.Pod) bool {
+	_, mirror := pod.Annotations[corev1.MirrorPodAnnotationKey]
+	return mirror
+}
+
+// isDaemonSetPod reports whether a pod is controlled by a DaemonSet
+func isDaemonSetPod(pod *corev1.Pod) bool {
+	owner := metav1.GetControllerOf(pod)
+	return owner != nil && owner.Kind == "DaemonSet" && owner.APIVersion == "apps/v1"
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Annotation on a pod or namespace opting it out of labelling. Labels the
+	// controller added before are removed.
+	OptOutAnnotation = "pod-labeller/opt-out"
+
+	// Annotation on labelled pods listing the label keys the controller added
+	AppliedLabelsAnnotation = "pod-labeller/applied-labels"
+
+	// Label opting a namespace in when the controller runs with --namespace-opt-in
+	NamespaceOptInLabel = "pod-labeller/enabled"
+)
+
+func isOptedOut(obj client.Object) bool {
+	optOut, _ := strconv.ParseBool(obj.GetAnnotations()[OptOutAnnotation])
+	return optOut
+}
+
+// optedOut reports whether a pod or workload, or its namespace, opted out of labelling
+func optedOut(ctx context.Context, reader client.Reader, obj client.Object) (bool, error) {
+	if isOptedOut(obj) {
+		return true, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, ns); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return isOptedOut(ns), nil
+}
+
+// recordAppliedLabels adds the keys the controller set on a pod or workload,
+// compared to its labels before, to the applied-labels annotation
+func recordAppliedLabels(obj client.Object, before map[string]string) {
+	applied := appliedLabelKeys(obj)
+	for key, value := range obj.GetLabels() {
+		if previous, exists := before[key]; (!exists || previous != value) && !slices.Contains(applied, key) {
+			applied = append(applied, key)
+		}
+	}
+	slices.Sort(applied)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[AppliedLabelsAnnotation] = strings.Join(applied, ",")
+	obj.SetAnnotations(annotations)
+}
+
+func appliedLabelKeys(obj client.Object) []string {
+	var keys []string
+	for _, key := range strings.Split(obj.GetAnnotations()[AppliedLabelsAnnotation], ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// removeAppliedLabels strips the labels the controller added from an
+// opted-out pod, together with the processed marker and the applied-labels
+// annotation. Labels the pod was created with are kept.
+func (r *PodReconciler) removeAppliedLabels(ctx context.Context, pod *corev1.Pod) error {
+	if err := r.writePodOnConflict(ctx, pod, OperationRemove, r.withoutAppliedLabels); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Removed labels from opted-out Pod", "pod", pod.Name, "namespace", pod.Namespace)
+	return nil
+}
+
+// withoutAppliedLabels returns a copy of a pod without the labels and
+// annotations the controller added
+func (r *PodReconciler) withoutAppliedLabels(pod *corev1.Pod) (*corev1.Pod, error) {
+	podCopy := pod.DeepCopy()
+
+	keys := appliedLabelKeys(pod)
+	if _, tracked := pod.Annotations[AppliedLabelsAnnotation]; !tracked {
+		// Pods labelled before the annotation existed. Labels with other
+		// values came from the pod template or the user and are kept.
+		imageLabels := r.generateImageLabels(pod)
+		maps.DeleteFunc(podCopy.Labels, func(key, value string) bool {
+			generated, isImage := imageLabels[key]
+			return (key == "app" && (value == appName(pod) || value == pod.Name)) || (key == "namesapce" && value == pod.Namespace) ||
+				(isImage && value == generated)
+		})
+	}
+	maps.DeleteFunc(podCopy.Labels, func(key, _ string) bool {
+		return slices.Contains(keys, key) || key == ProcessedLabel
+	})
+	delete(podCopy.Annotations, AppliedLabelsAnnotation)
+	delete(podCopy.Annotations, NamespaceLabelsAnnotation)
+	delete(podCopy.Annotations, EnrichmentPendingAnnotation)
+	return podCopy, nil
+}
+
+// enqueueProcessedPodsOfNamespace enqueues the labelled pods of a namespace
+// that opted out, so their labels are removed
+func (r *PodReconciler) enqueueProcessedPodsOfNamespace() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		if !isOptedOut(obj) {
+			return nil
+		}
+		podList := &corev1.PodList{}
+		if err := r.List(ctx, podList, client.InNamespace(obj.GetName()), client.MatchingLabels{ProcessedLabel: "true"}); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list Pods of opted-out namespace", "namespace", obj.GetName())
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(podList.Items))
+		for _, pod := range podList.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pod)})
+		}
+		return requests
+	})
+}
+
+// optOutChangedPredicate passes namespaces whose opt-out annotation was set
+func optOutChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return isOptedOut(e.ObjectNew) && !isOptedOut(e.ObjectOld)
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+}
+
+// enqueuePodsOfNamespace enqueues every pod of a namespace, e.g. one that
+// opted in, so pods created before the label was added are labelled too
+func (r *PodReconciler) enqueuePodsOfNamespace() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		podList := &corev1.PodList{}
+		if err := r.List(ctx, podList, client.InNamespace(obj.GetName())); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list Pods of namespace", "namespace", obj.GetName())
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(podList.Items))
+		for _, pod := range podList.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pod)})
+		}
+		return requests
+	})
+}
+
+// optInChangedPredicate passes namespaces that were labelled with the opt-in label
+func optInChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return optedIn(e.ObjectNew) && !optedIn(e.ObjectOld)
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+}
+
+func optedIn(obj client.Object) bool {
+	enabled, _ := strconv.ParseBool(obj.GetLabels()[NamespaceOptInLabel])
+	return enabled
+}
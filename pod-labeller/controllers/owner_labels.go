@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Owner chains are never longer in practice, e.g. pod → Job → CronJob
+const maxOwnerDepth = 5
+
+// newOwnerObject returns an empty object of a controller kind the owner chain
+// is followed through, or nil for other kinds
+func newOwnerObject(kind string) client.Object {
+	switch kind {
+	case "ReplicaSet":
+		return &appsv1.ReplicaSet{}
+	case "Deployment":
+		return &appsv1.Deployment{}
+	case "StatefulSet":
+		return &appsv1.StatefulSet{}
+	case "DaemonSet":
+		return &appsv1.DaemonSet{}
+	case "Job":
+		return &batchv1.Job{}
+	case "CronJob":
+		return &batchv1.CronJob{}
+	}
+	return nil
+}
+
+// getTopLevelOwner follows the controller references of a pod up to the
+// workload at the top, e.g. pod → ReplicaSet → Deployment. The chain stops at
+// owners of unknown kinds or owners that no longer exist. Pods without a
+// controller return nil.
+func (r *PodReconciler) getTopLevelOwner(ctx context.Context, pod *corev1.Pod) (client.Object, error) {
+	var top client.Object
+	current := client.Object(pod)
+	for range maxOwnerDepth {
+		ref := metav1.GetControllerOf(current)
+		if ref == nil {
+			break
+		}
+		owner := newOwnerObject(ref.Kind)
+		if owner == nil {
+			break
+		}
+		err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: pod.Namespace}, owner)
+		if errors.IsNotFound(err) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s %s: %w", ref.Kind, ref.Name, err)
+		}
+		top, current = owner, owner
+	}
+	return top, nil
+}
+
+// ParseLabelKeys parses a comma separated list of label keys
+func ParseLabelKeys(raw string) ([]string, error) {
+	var keys []string
+	for _, key := range strings.Split(raw, ",") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ValidateLabelKeys checks settings holding a list of label keys
+func ValidateLabelKeys(raw string) error {
+	_, err := ParseLabelKeys(raw)
+	return err
+}
+
+// inheritedOwnerLabels returns the configured labels of the top-level owner of a pod
+func (r *PodReconciler) inheritedOwnerLabels(ctx context.Context, pod *corev1.Pod) (map[string]string, error) {
+	// The setting was validated when it was applied
+	keys, _ := ParseLabelKeys(r.Config.String(SettingInheritOwnerLabels, strings.Join(r.InheritOwnerLabels, ",")))
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	owner, err := r.getTopLevelOwner(ctx, pod)
+	if err != nil || owner == nil {
+		return nil, err
+	}
+	labels := make(map[string]string)
+	for _, key := range keys {
+		if value, exists := owner.GetLabels()[key]; exists {
+			labels[key] = value
+		}
+	}
+	return labels, nil
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Annotation on Deployments and StatefulSets to keep their pod template untouched
+const SkipTemplateLabelsAnnotation = "pod-labeller/skip-template-labels"
+
+// labelOwnerTemplate adds the workload-wide labels to the pod template of the
+// Deployment or StatefulSet owning a pod, so future pods are born labelled.
+// Changing a pod template rolls the workload, so templates that already carry
+// the labels are never updated again.
+func (r *PodReconciler) labelOwnerTemplate(ctx context.Context, pod *corev1.Pod) error {
+	log := log.FromContext(ctx)
+
+	workload, template, err := r.getOwningWorkload(ctx, pod)
+	if err != nil || workload == nil {
+		return err
+	}
+	if workload.GetAnnotations()[SkipTemplateLabelsAnnotation] == "true" {
+		return nil
+	}
+
+	labels := generateTemplateLabels(workload)
+	stale := hasStaleTemplateLabels(workload, template)
+	if hasTemplateLabels(template, labels) && !stale {
+		return nil
+	}
+
+	if template.Labels == nil {
+		template.Labels = make(map[string]string)
+	}
+	if stale {
+		delete(template.Labels, ProcessedLabel)
+		delete(template.Labels, "app")
+	}
+	for key, value := range labels {
+		// Never override labels the workload already sets itself
+		if _, exists := template.Labels[key]; !exists {
+			template.Labels[key] = value
+		}
+	}
+
+	if err := r.Update(ctx, workload); err != nil {
+		return fmt.Errorf("failed to update pod template of %s: %w", workload.GetName(), err)
+	}
+
+	log.Info("Added labels to owner pod template", "pod", pod.Name, "owner", workload.GetName(), "namespace", pod.Namespace)
+	return nil
+}
+
+// generateTemplateLabels creates the static labels that are the same for
+// every pod of a workload. The app label and ProcessedLabel are left to the
+// pod reconciler: a pod born with them counts as labelled and would never get
+// its image and namespace labels. Image labels stay on the pods so an image
+// update doesn't roll the workload a second time.
+func generateTemplateLabels(workload client.Object) map[string]string {
+	return map[string]string{
+		"namesapce": workload.GetNamespace(),
+	}
+}
+
+// hasStaleTemplateLabels reports whether a template was labelled by an
+// earlier version, which also added ProcessedLabel and the workload's name as
+// the app label. Both are removed again.
+func hasStaleTemplateLabels(workload client.Object, template *corev1.PodTemplateSpec) bool {
+	return template.Labels[ProcessedLabel] == "true" && template.Labels["app"] == workload.GetName()
+}
+
+func hasTemplateLabels(template *corev1.PodTemplateSpec, labels map[string]string) bool {
+	for key := range labels {
+		if _, exists := template.Labels[key]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// getOwningWorkload returns a copy of the Deployment (through its ReplicaSet)
+// or StatefulSet controlling a pod and a pointer to the copy's pod template.
+// Pods of other owners, or without an owner, return nil.
+func (r *PodReconciler) getOwningWorkload(ctx context.Context, pod *corev1.Pod) (client.Object, *corev1.PodTemplateSpec, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil, nil, nil
+	}
+
+	switch owner.Kind {
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, client.ObjectKey{Name: owner.Name, Namespace: pod.Namespace}, statefulSet); err != nil {
+			return nil, nil, client.IgnoreNotFound(err)
+		}
+		statefulSet = statefulSet.DeepCopy()
+		return statefulSet, &statefulSet.Spec.Template, nil
+
+	case "ReplicaSet":
+		replicaSet := &appsv1.ReplicaSet{}
+		if err := r.Get(ctx, client.ObjectKey{Name: owner.Name, Namespace: pod.Namespace}, replicaSet); err != nil {
+			return nil, nil, client.IgnoreNotFound(err)
+		}
+
+		// Standalone ReplicaSets don't replace running pods, labelling them
+		// doesn't help
+		deploymentRef := metav1.GetControllerOf(replicaSet)
+		if deploymentRef == nil || deploymentRef.Kind != "Deployment" {
+			return nil, nil, nil
+		}
+
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, client.ObjectKey{Name: deploymentRef.Name, Namespace: pod.Namespace}, deployment); err != nil {
+			return nil, nil, client.IgnoreNotFound(err)
+		}
+		deployment = deployment.DeepCopy()
+		return deployment, &deployment.Spec.Template, nil
+	}
+
+	return nil, nil, nil
+}
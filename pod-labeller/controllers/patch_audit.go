@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Key of the patch audit ConfigMap holding one JSON record per line
+	PatchAuditKey = "patches.jsonl"
+
+	// Records kept in the patch audit ConfigMap, older ones are dropped
+	DefaultPatchAuditMaxRecords = 500
+
+	// Timeout of posting a record to a patch audit webhook
+	DefaultPatchAuditTimeout = 2 * time.Second
+
+	// Records beyond this size are dropped from the ConfigMap too, it has to
+	// stay below the 1MiB object limit
+	maxPatchAuditConfigMapBytes = 768 << 10
+)
+
+var patchAuditFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pod_labeller_patch_audit_failures_total",
+	Help: "Pod label patches that couldn't be written to the patch audit sink",
+})
+
+func init() {
+	metrics.Registry.MustRegister(patchAuditFailures)
+}
+
+// PatchAuditRecord is the JSON patch of one pod or workload label write
+type PatchAuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Kind is Pod, or the workload kind of the workload labeller
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	// Pod is the name of the pod or workload
+	Pod string    `json:"pod"`
+	UID types.UID `json:"uid,omitempty"`
+	// Operation is label, repair, remove or admission
+	Operation string `json:"operation"`
+	// Patch is the RFC 6902 JSON patch from the object as read to the object as written
+	Patch []jsonpatch.Operation `json:"patch"`
+	// DryRun records are only validated by the API server, not applied
+	DryRun bool `json:"dryRun"`
+	// Applied is true once the API server accepted a write that wasn't a dry run
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PatchAuditSink stores patch audit records
+type PatchAuditSink interface {
+	Write(ctx context.Context, record PatchAuditRecord) error
+}
+
+// PatchAuditor records the JSON patch of every pod label write to a sink,
+// for change review and for debugging unexpected labels
+type PatchAuditor struct {
+	Sink PatchAuditSink
+	// DryRun records the patches without applying them. Writes are sent with
+	// dryRun=All, so admission and validation still run.
+	DryRun bool
+}
+
+// record writes the patch of a pod or workload write to the sink. A failing
+// sink is logged and never fails the write.
+func (a *PatchAuditor) record(ctx context.Context, kind, namespace, name string, uid types.UID, operation string, patch []jsonpatch.Operation, err error) {
+	record := PatchAuditRecord{
+		Timestamp: time.Now().UTC(),
+		Kind:      kind,
+		Namespace: namespace,
+		Pod:       name,
+		UID:       uid,
+		Operation: operation,
+		Patch:     patch,
+		DryRun:    a.DryRun,
+		Applied:   err == nil && !a.DryRun,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := a.Sink.Write(ctx, record); err != nil {
+		patchAuditFailures.Inc()
+		log.FromContext(ctx).Error(err, "Failed to write patch audit record", "kind", kind, "name", name, "namespace", namespace)
+	}
+}
+
+// objectPatch returns the JSON patch from one version of a pod or workload to another
+func objectPatch(original, modified client.Object) ([]jsonpatch.Operation, error) {
+	from, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+	to, err := json.Marshal(modified)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.CreatePatch(from, to)
+}
+
+// ParsePatchAuditSink parses a sink: file:<path> appends JSON lines to a
+// file, configmap:<namespace>/<name> keeps the latest records in a
+// ConfigMap and an http(s) URL receives every record as a POST.
+func ParsePatchAuditSink(spec string, c client.Client) (PatchAuditSink, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if path == "" {
+			return nil, fmt.Errorf("file sink without path")
+		}
+		return &FilePatchAuditSink{Path: path}, nil
+	case strings.HasPrefix(spec, "configmap:"):
+		namespace, name, found := strings.Cut(strings.TrimPrefix(spec, "configmap:"), "/")
+		if !found || namespace == "" || name == "" {
+			return nil, fmt.Errorf("configmap sink %q is not configmap:<namespace>/<name>", spec)
+		}
+		return &ConfigMapPatchAuditSink{Client: c, Namespace: namespace, Name: name}, nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return &WebhookPatchAuditSink{URL: spec}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q, must be file:<path>, configmap:<namespace>/<name> or an http(s) URL", spec)
+	}
+}
+
+// PatchAuditSinkNamespace returns the namespace of a configmap sink, empty
+// for other sinks
+func PatchAuditSinkNamespace(spec string) string {
+	ref, found := strings.CutPrefix(spec, "configmap:")
+	if !found {
+		return ""
+	}
+	namespace, _, _ := strings.Cut(ref, "/")
+	return namespace
+}
+
+// FilePatchAuditSink appends records to a file as JSON lines
+type FilePatchAuditSink struct {
+	Path string
+
+	mutex sync.Mutex
+}
+
+func (s *FilePatchAuditSink) Write(_ context.Context, record PatchAuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ConfigMapPatchAuditSink keeps the latest records in a ConfigMap as JSON
+// lines, at most MaxRecords and 768KiB
+type ConfigMapPatchAuditSink struct {
+	Client    client.Client
+	Namespace string
+	Name      string
+	// MaxRecords defaults to DefaultPatchAuditMaxRecords
+	MaxRecords int
+
+	// Serializes the replica's own writes, conflicts with other writers are retried
+	mutex sync.Mutex
+}
+
+func (s *ConfigMapPatchAuditSink) Write(ctx context.Context, record PatchAuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	maxRecords := s.MaxRecords
+	if maxRecords <= 0 {
+		maxRecords = DefaultPatchAuditMaxRecords
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap := &corev1.ConfigMap{}
+		err := s.Client.Get(ctx, client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, configMap)
+		if errors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: s.Namespace, Name: s.Name},
+				Data:       map[string]string{PatchAuditKey: string(line) + "\n"},
+			}
+			return s.Client.Create(ctx, configMap)
+		}
+		if err != nil {
+			return err
+		}
+
+		lines := append(strings.Split(strings.TrimSuffix(configMap.Data[PatchAuditKey], "\n"), "\n"), string(line))
+		if lines[0] == "" {
+			lines = lines[1:]
+		}
+		lines = lines[max(0, len(lines)-maxRecords):]
+		data := strings.Join(lines, "\n") + "\n"
+		for len(data) > maxPatchAuditConfigMapBytes && len(lines) > 1 {
+			lines = lines[1:]
+			data = strings.Join(lines, "\n") + "\n"
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[PatchAuditKey] = data
+		return s.Client.Update(ctx, configMap)
+	})
+}
+
+// WebhookPatchAuditSink posts every record as JSON to a URL
+type WebhookPatchAuditSink struct {
+	URL string
+	// Timeout defaults to DefaultPatchAuditTimeout
+	Timeout time.Duration
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func (s *WebhookPatchAuditSink) Write(ctx context.Context, record PatchAuditRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPatchAuditTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	httpClient := s.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("patch audit webhook failed: %w", err)
+	}
+	defer response.Body.Close()
+	// Drain the body so the connection is reused
+	_, _ = io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("patch audit webhook returned %s", response.Status)
+	}
+	return nil
+}
@@ -2,31 +2,143 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"maps"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// Image label modes for pods with more than one container
+	ImageLabelModePerContainer = "per-container"
+	ImageLabelModeHash         = "hash"
+
+	// Prefix for per-container image labels (image-container-<containername>),
+	// apart from the parsed image labels and image-hash so no container name
+	// can collide with them
+	ContainerImageLabelPrefix = "image-container-"
+
+	// Label holding the combined hash of all container images
+	ImageHashLabel = "image-hash"
+
+	// Default maximum number of per-container image labels on a single Pod
+	DefaultMaxImageLabels = 5
+
+	// Label marking Pods processed by this controller
+	ProcessedLabel = "pod-labeller/processed"
+
+	// Field manager of the controller's pod writes
+	FieldManager = "pod-labeller"
 )
 
 // PodReconciler reconciles a Pod Object
 type PodReconciler struct {
 	client.Client
-	Scheme   *runtime.Scheme
-	mutex    sync.RWMutex
-	logCache map[string]time.Time
+	Scheme  *runtime.Scheme
+	Backoff *throttle.AdaptiveBackoff
+
+	// ImageLabelMode controls how multi-container pods are labelled
+	ImageLabelMode string
+	// MaxImageLabels limits the number of per-container image labels. Pods
+	// with more containers fall back to the combined hash label.
+	MaxImageLabels int
+	// RefreshImageLabels replaces stale image labels when container images change
+	RefreshImageLabels bool
+	// ParseImageLabels labels the registry, repository and tag or digest of the
+	// first container's image instead of the flattened image
+	ParseImageLabels bool
+	// PrioritizeNewPods labels new pods before relabelling already labelled ones
+	PrioritizeNewPods bool
+	// TopologyAwareOrdering spreads the queue across zones, pods of zones with
+	// many pods waiting are queued behind those of the other zones
+	TopologyAwareOrdering bool
+	// LabelOwnerTemplates also labels the pod template of the owning
+	// Deployment or StatefulSet, so future pods are born labelled
+	LabelOwnerTemplates bool
+	// SkipDaemonSetPods leaves pods controlled by DaemonSets unlabelled
+	SkipDaemonSetPods bool
+	// SkipMirrorPods leaves the mirror pods of static pods unlabelled
+	SkipMirrorPods bool
+	// GitOpsMode decides how pods of workloads applied by Argo CD or Flux are
+	// handled: label (default), suggest or skip
+	GitOpsMode string
+	// Namespaces skips objects in namespaces opted out with the ignore label,
+	// excluded or not watched
+	Namespaces *predicates.NamespaceFilter
+	// WriteLimiter rate limits Pod label writes per namespace. Nil disables the limit.
+	WriteLimiter *NamespaceWriteLimiter
+	// Enricher adds labels looked up in an external service. Nil disables enrichment.
+	Enricher *Enricher
+	// Config overrides settings and feature gates at runtime. Nil keeps the startup configuration.
+	Config *controllerconfig.Config
+	// WarmUpProcessedPods lists the already processed pods on startup, so the
+	// startup create events of unchanged ones are skipped
+	WarmUpProcessedPods bool
+	// LabelTemplates adds labels whose values are Go templates evaluated
+	// against the Pod, one "key=template" per line. Empty adds none.
+	LabelTemplates string
+	// BackpressureLatencyThreshold defers drift repair of already labelled
+	// pods while the smoothed queue latency exceeds it. 0 never defers.
+	BackpressureLatencyThreshold time.Duration
+	// InheritOwnerLabels are label keys copied from the top-level owner of a
+	// pod, e.g. the Deployment of its ReplicaSet
+	InheritOwnerLabels []string
+	// PropagateNamespaceLabels are label keys copied from the namespace of a
+	// pod and kept in sync with it
+	PropagateNamespaceLabels []string
+	// CostMappingConfigMap holds the mapping table cost allocation labels
+	// are derived with. An empty name derives none.
+	CostMappingConfigMap types.NamespacedName
+	// MaxConcurrentReconciles is the number of pods labelled in parallel, 0
+	// keeps the single worker of controller-runtime
+	MaxConcurrentReconciles int
+	// RateLimiterBaseDelay and RateLimiterMaxDelay bound the exponential
+	// backoff of pods retried after an error. 0 keeps the defaults.
+	RateLimiterBaseDelay time.Duration
+	RateLimiterMaxDelay  time.Duration
+	// PatchAudit records the JSON patch of every pod label write. Nil
+	// disables the audit.
+	PatchAudit *PatchAuditor
+	// APIReader reads pods uncached when their label write is retried after
+	// a conflict. Nil reads them through the client.
+	APIReader client.Reader
+
+	mutex     sync.RWMutex
+	logCache  map[string]time.Time
+	processed processedPods
+	templates labelTemplateCache
+	latency   queueLatencyTracker
+	topology  topologyBacklog
+	conflicts conflictBackoff
+
+	costMappings costMappingCache
+	startedAt    time.Time
 }
 
 func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
+	r.latency.dequeued(req.NamespacedName)
+	r.topology.dequeued(req.NamespacedName)
+	defer func(start time.Time) { reconcileDuration.Observe(time.Since(start).Seconds()) }(time.Now())
 
-	// Skip system namespaces
-	if isSystemNamespace(req.Namespace) {
+	// Skip system namespaces and namespaces opted out of all controllers
+	if r.Namespaces.Ignored(ctx, req.Namespace) {
+		recordSkip(SkipReasonIgnoredNamespace)
 		return ctrl.Result{}, nil
 	}
 
@@ -37,6 +149,7 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		if errors.IsNotFound(err) {
 			// Pod not found, probably deleted
 			log.Info("Pod not found. Skipping reconciliation", "pod", req.Name, "error", err)
+			recordSkip(SkipReasonNotFound)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request
@@ -44,31 +157,190 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, nil
 	}
 
+	// DaemonSet and static pods follow their nodes, labels they already have are kept
+	if r.SkipsNodeManaged(pod) {
+		recordSkip(SkipReasonNodeManaged)
+		return ctrl.Result{}, nil
+	}
+
+	// Opted-out pods lose the labels the controller added
+	optOut, err := optedOut(ctx, r, pod)
+	if err != nil {
+		log.Error(err, "Failed to check whether Pod opted out", "pod", pod.Name)
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if optOut {
+		recordSkip(SkipReasonOptedOut)
+		if pod.Labels[ProcessedLabel] != "true" {
+			return ctrl.Result{}, nil
+		}
+		err := r.removeAppliedLabels(ctx, pod)
+		recordLabelWrite(pod.Namespace, OperationRemove, err)
+		if errors.IsConflict(err) {
+			return r.requeueOnConflict(ctx, req.NamespacedName)
+		}
+		if err != nil {
+			log.Error(err, "Failed to remove labels from opted-out Pod", "pod", pod.Name)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// Wait for Pod to be ready before adding labels
 	if !isPodReady(pod) {
 		// Only log once per 5 seconds for the same Pod
 		if r.shouldLogPodNotReady(pod.Name) {
 			log.Info("Pod not ready yet, will retry", "pod", pod.Name, "phase", pod.Status.Phase)
 		}
+		recordSkip(SkipReasonNotReady)
 		return ctrl.Result{}, nil
 	}
 
+	// Pods of workloads applied by Argo CD or Flux only get suggestions, or nothing
+	if r.GitOpsMode == GitOpsModeSuggest || r.GitOpsMode == GitOpsModeSkip {
+		manager, err := r.gitOpsManager(ctx, pod)
+		if err != nil {
+			log.Error(err, "Failed to check whether Pod is managed by GitOps", "pod", pod.Name)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		if manager != "" {
+			recordSkip(SkipReasonGitOps)
+			return r.reconcileGitOpsPod(ctx, pod, manager)
+		}
+	}
+
+	// Label the whole workload once, its future pods need no work
+	if r.Config.Bool(SettingLabelOwnerTemplates, r.LabelOwnerTemplates) {
+		if err := r.labelOwnerTemplate(ctx, pod); err != nil {
+			// The pod itself is still labelled below
+			log.Error(err, "Failed to label owner pod template", "pod", pod.Name)
+		}
+	}
+
 	// Check if pod already has our labels
 	if hasRequiredLables(pod) {
-		log.Info("Pod already has required labels", "pod", pod.Name)
+		repaired, drift, err := r.labelDrift(ctx, pod)
+		if err != nil {
+			log.Error(err, "Failed to check labels of Pod for drift", "pod", pod.Name)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		if len(drift) == 0 {
+			log.Info("Pod already has required labels", "pod", pod.Name)
+			recordSkip(SkipReasonUpToDate)
+			return ctrl.Result{}, nil
+		}
+
+		// Drift repair waits while new pods pile up on the queue
+		if r.latency.backedUp(r.Config.Duration(SettingBackpressureLatencyThreshold, r.BackpressureLatencyThreshold)) {
+			log.Info("Queue latency above threshold, deferring drift repair", "pod", pod.Name, "delay", DefaultBackpressureRequeue)
+			backpressureDeferred.Inc()
+			recordSkip(SkipReasonBackpressure)
+			return ctrl.Result{RequeueAfter: DefaultBackpressureRequeue}, nil
+		}
+
+		if delay := r.WriteLimiter.Delay(req.NamespacedName); delay > 0 {
+			log.Info("Namespace write rate exceeded, deferring Pod", "pod", pod.Name, "namespace", pod.Namespace, "delay", delay)
+			recordSkip(SkipReasonRateLimited)
+			return ctrl.Result{RequeueAfter: delay}, nil
+		}
+		err = r.writePodOnConflict(ctx, pod, OperationRepair, func(current *corev1.Pod) (*corev1.Pod, error) {
+			if current != pod {
+				// Derive the repair from the pod as it is now
+				if repaired, _, err = r.labelDrift(ctx, current); err != nil {
+					return nil, err
+				}
+			}
+			recordAppliedLabels(repaired, current.Labels)
+			return repaired, nil
+		})
+		recordLabelWrite(pod.Namespace, OperationRepair, err)
+		if errors.IsConflict(err) {
+			return r.requeueOnConflict(ctx, req.NamespacedName)
+		}
+		if err != nil {
+			log.Error(err, "Failed to repair labels on Pod", "pod", pod.Name)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+
+		log.Info("Repaired label drift on Pod", "pod", pod.Name, "drift", drift)
 		return ctrl.Result{}, nil
 	}
 
+	// Spill pods back onto the queue when their namespace writes too fast
+	if delay := r.WriteLimiter.Delay(req.NamespacedName); delay > 0 {
+		log.Info("Namespace write rate exceeded, deferring Pod", "pod", pod.Name, "namespace", pod.Namespace, "delay", delay)
+		recordSkip(SkipReasonRateLimited)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
 	// Add labels to the Pod
-	if err := r.addLabelsToPod(ctx, pod); err != nil {
+	enrichErr, err := r.addLabelsToPod(ctx, pod)
+	recordLabelWrite(pod.Namespace, OperationLabel, err)
+	if errors.IsConflict(err) {
+		return r.requeueOnConflict(ctx, req.NamespacedName)
+	}
+	if err != nil {
 		log.Error(err, "Failed to add labels to Pod", "pod", pod.Name)
-		return ctrl.Result{}, err
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if enrichErr != nil {
+		// The pod is labelled but pending, the requeue retries the lookup
+		log.Error(enrichErr, "Enrichment lookup failed, labelled Pod without it", "pod", pod.Name)
+		return r.Backoff.RequeueOnThrottle(enrichErr, throttle.DefaultThrottleRequeue)
 	}
 
 	log.Info("Successfullly added labels to Pod", "pod", pod.Name)
 	return ctrl.Result{}, nil
 }
 
+// labelDrift returns an already labelled pod with the labels that drifted
+// repaired, and which kinds of labels drifted: namespace labels follow their
+// namespace, cost labels their mapping and, with ImageLabelRefresh, image
+// labels the containers (in-place image updates, ephemeral containers). Pods
+// labelled while the enrichment lookup failed get their enrichment labels.
+func (r *PodReconciler) labelDrift(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, []string, error) {
+	repaired := pod.DeepCopy()
+
+	enriched, err := r.retryEnrichment(ctx, repaired)
+	if err != nil {
+		return nil, nil, fmt.Errorf("enrichment lookup failed: %w", err)
+	}
+	repaired, drift, err := r.cachedLabelDrift(ctx, repaired)
+	if enriched {
+		drift = append([]string{"enrichment"}, drift...)
+	}
+	return repaired, drift, err
+}
+
+// cachedLabelDrift is labelDrift without the enrichment lookup, it only reads
+// from the cache
+func (r *PodReconciler) cachedLabelDrift(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, []string, error) {
+	repaired := pod.DeepCopy()
+	var drift []string
+
+	namespaceDrift, err := r.syncNamespaceLabels(ctx, pod.Namespace, repaired)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read namespace labels: %w", err)
+	}
+	if namespaceDrift {
+		drift = append(drift, "namespace")
+	}
+
+	costDrift, err := r.applyCostLabels(ctx, repaired)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive cost labels: %w", err)
+	}
+	if costDrift {
+		drift = append(drift, "cost")
+	}
+
+	if r.Config.FeatureEnabled(ImageLabelRefresh, r.RefreshImageLabels) && r.hasStaleImageLabels(pod) {
+		r.refreshImageLabels(repaired)
+		drift = append(drift, "image")
+	}
+	return repaired, drift, nil
+}
+
 func hasRequiredLables(pod *corev1.Pod) bool {
 	// Check if Pod has app label
 	if _, exists := pod.Labels["app"]; exists {
@@ -77,65 +349,163 @@ func hasRequiredLables(pod *corev1.Pod) bool {
 	return false
 }
 
-func (r *PodReconciler) addLabelsToPod(ctx context.Context, pod *corev1.Pod) error {
-	// Create a copy of the Pod to modify
-	podCopy := pod.DeepCopy()
+// addLabelsToPod labels a pod. When the enrichment lookup fails the pod is
+// labelled without the enrichment labels and marked pending, and the lookup
+// error is returned as enrichErr.
+func (r *PodReconciler) addLabelsToPod(ctx context.Context, pod *corev1.Pod) (enrichErr, err error) {
+	err = r.writePodOnConflict(ctx, pod, OperationLabel, func(pod *corev1.Pod) (*corev1.Pod, error) {
+		// Create a copy of the Pod to modify
+		podCopy := pod.DeepCopy()
+		podCopy.Labels, enrichErr = r.desiredLabels(ctx, pod)
+		if enrichErr != nil {
+			markEnrichmentPending(podCopy)
+		}
+		if _, err := r.syncNamespaceLabels(ctx, pod.Namespace, podCopy); err != nil {
+			return nil, err
+		}
+		recordAppliedLabels(podCopy, pod.Labels)
+		return podCopy, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return enrichErr, nil
+}
+
+// writePod writes the labels and annotations of a modified pod as a JSON
+// merge patch. Only the keys that changed are sent, without a resource
+// version, so kubelet status updates and other controllers writing the pod
+// don't conflict with it. No precondition is needed: the keys sent are
+// labels and annotations the controller owns, derived from fields a status
+// write doesn't change. With a patch auditor the JSON patch of the write is
+// recorded, in dry-run mode the write is only validated.
+func (r *PodReconciler) writePod(ctx context.Context, original, modified *corev1.Pod, operation string) error {
+	return r.writeObject(ctx, "Pod", original, modified, operation)
+}
 
-	// Initialize labels map if it doesn't exist
-	if podCopy.Labels == nil {
-		podCopy.Labels = make(map[string]string)
+// writeObject writes the labels and annotations of a pod or workload like writePod
+func (r *PodReconciler) writeObject(ctx context.Context, kind string, original, modified client.Object, operation string) error {
+	opts := []client.PatchOption{client.FieldOwner(FieldManager)}
+	if r.PatchAudit == nil {
+		return r.Patch(ctx, modified, client.MergeFrom(original), opts...)
+	}
+
+	// The patch overwrites modified with the stored object
+	patch, err := objectPatch(original, modified)
+	if err != nil {
+		return fmt.Errorf("failed to compute patch of %s: %w", kind, err)
+	}
+	if r.PatchAudit.DryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+	err = r.Patch(ctx, modified, client.MergeFrom(original), opts...)
+	r.PatchAudit.record(ctx, kind, original.GetNamespace(), original.GetName(), original.GetUID(), operation, patch, err)
+	return err
+}
+
+// desiredLabels returns the labels of a Pod after labelling. It is shared by
+// the reconciler and the admission webhook. A failed enrichment lookup
+// doesn't hold back the other labels, it is returned so the caller can mark
+// the pod pending.
+func (r *PodReconciler) desiredLabels(ctx context.Context, pod *corev1.Pod) (map[string]string, error) {
+	labels := maps.Clone(pod.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+
+	// Add labels from the enrichment service. They never replace labels the
+	// pod already has.
+	enriched, enrichErr := r.Enricher.Labels(ctx, pod)
+	for key, value := range enriched {
+		if _, exists := labels[key]; !exists {
+			labels[key] = value
+		}
+	}
+
+	// Add templated labels, also without replacing labels the pod has
+	for key, value := range r.templatedLabels(ctx, pod) {
+		if _, exists := labels[key]; !exists {
+			labels[key] = value
+		}
 	}
 
 	// Add labels based on Pod metadata
-	labels := generateLabels(pod)
-	maps.Copy(podCopy.Labels, labels)
+	maps.Copy(labels, r.generateLabels(pod))
+
+	// Cost allocation labels from the mapping table, also without replacing
+	// labels the pod has
+	cost, err := r.costLabels(ctx, pod)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to derive cost labels, labelling without them", "pod", pod.Name)
+	}
+	for key, value := range cost {
+		if _, exists := labels[key]; !exists {
+			labels[key] = value
+		}
+	}
+
+	// Labels of the owning workload group the pods of all replicas, so they
+	// replace generated ones like the per-pod app label, but never labels the
+	// pod already had
+	inherited, err := r.inheritedOwnerLabels(ctx, pod)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to resolve owner of Pod, labelling without owner labels", "pod", pod.Name)
+	}
+	for key, value := range inherited {
+		if _, exists := pod.Labels[key]; !exists {
+			labels[key] = value
+		}
+	}
+	return labels, enrichErr
+}
+
+// templatedLabels evaluates the label templates of the active configuration
+// against a Pod. Failing templates are logged and left out.
+func (r *PodReconciler) templatedLabels(ctx context.Context, pod *corev1.Pod) map[string]string {
+	log := log.FromContext(ctx)
 
-	// Update the Pod
-	return r.Update(ctx, podCopy)
+	templates, err := r.templates.get(r.Config.String(SettingLabelTemplates, r.LabelTemplates))
+	if err != nil {
+		log.Error(err, "Invalid label templates, labelling without them")
+		return nil
+	}
+	labels, errs := templates.Labels(pod)
+	for _, err := range errs {
+		log.Error(err, "Failed to evaluate label template", "pod", pod.Name)
+	}
+	return labels
 }
 
 // generateLabels creates labels based on Pod Metadata
-func generateLabels(pod *corev1.Pod) map[string]string {
+func (r *PodReconciler) generateLabels(pod *corev1.Pod) map[string]string {
 	labels := make(map[string]string)
 
 	// Add app label based on Pod name or container name
-	if pod.Name != "" {
-		labels["app"] = pod.Name
+	if app := appName(pod); app != "" {
+		labels["app"] = app
 	}
 
 	// Add namespace label
 	labels["namesapce"] = pod.Namespace
 
-	// Add image label if container exist
-	if len(pod.Spec.Containers) > 0 {
-		image := pod.Spec.Containers[0].Image
-		// sanitize image name
-		sanitizedImage := sanitizeLabelValue(image)
-		if sanitizedImage != "" {
-			labels["image"] = sanitizedImage
-		}
-	}
+	// Add image labels derived from the Pod's containers
+	maps.Copy(labels, r.generateImageLabels(pod))
 
 	// Add custom label to mark this Pod as processed by this controller
-	labels["pod-labeller/processed"] = "true"
+	labels[ProcessedLabel] = "true"
 
 	return labels
 }
 
-func isSystemNamespace(namespace string) bool {
-	systemNamespaces := []string{
-		"kube-system",
-		"kube-public",
-		"kube-node-lease",
-		"local-path-storage",
+// appName returns the app label of a pod. Pods created from a generateName,
+// e.g. by a ReplicaSet, are named after it without the trailing dash, so the
+// webhook, which admits them before they have a name, and the reconciler
+// agree, and all replicas get the same app.
+func appName(pod *corev1.Pod) string {
+	if pod.GenerateName != "" {
+		return strings.TrimSuffix(pod.GenerateName, "-")
 	}
-
-	for _, sn := range systemNamespaces {
-		if namespace == sn {
-			return true
-		}
-	}
-	return false
+	return pod.Name
 }
 
 // sanitizeLabelValue converts an image name to a valid label value
@@ -158,6 +528,9 @@ func sanitizeLabelValue(value string) string {
 	if len(result) == 0 {
 		return "img"
 	}
+	if len(result) > 63 {
+		result = result[:63]
+	}
 
 	// Ensure it starts with alphanumric
 	if !isAlphanumeric(rune(result[0])) {
@@ -219,7 +592,40 @@ func (r *PodReconciler) shouldLogPodNotReady(podName string) bool {
 }
 
 func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.startedAt = time.Now()
+	if r.WarmUpProcessedPods {
+		// Without the warm-up every pod is reconciled again, nothing is lost
+		if err := r.warmUp(context.Background(), mgr.GetAPIReader()); err != nil {
+			ctrl.Log.WithName("warm-up").Error(err, "Failed to list already processed pods, reconciling all pods")
+		}
+	}
+
+	if r.PrioritizeNewPods || r.TopologyAwareOrdering {
+		// Unlabelled pods jump ahead of relabel work in the priority queue,
+		// busy zones fall behind the others
+		return ctrl.NewControllerManagedBy(mgr).
+			Named("pod").
+			Watches(&corev1.Pod{}, r.enqueuePodByPriority()).
+			Watches(&corev1.Namespace{}, r.enqueueProcessedPodsOfNamespace(), builder.WithPredicates(optOutChangedPredicate())).
+			Watches(&corev1.Namespace{}, r.enqueuePodsOfNamespace(), builder.WithPredicates(predicate.Or(optInChangedPredicate(), r.namespaceLabelsChangedPredicate()))).
+			Watches(&corev1.ConfigMap{}, r.enqueueAllPods(), builder.WithPredicates(r.costMappingPredicate())).
+			WithEventFilter(r.Namespaces.Predicate()).
+			WithEventFilter(r.skipProcessedPredicate()).
+			WithEventFilter(skipNoOpUpdatesPredicate()).
+			WithEventFilter(r.latency.predicate()).
+			WithOptions(r.controllerOptions()).
+			Complete(recovery.Wrap("pod-labeller", r))
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Pod{}).
-		Complete(r)
+		Watches(&corev1.Namespace{}, r.enqueueProcessedPodsOfNamespace(), builder.WithPredicates(optOutChangedPredicate())).
+		Watches(&corev1.Namespace{}, r.enqueuePodsOfNamespace(), builder.WithPredicates(predicate.Or(optInChangedPredicate(), r.namespaceLabelsChangedPredicate()))).
+		Watches(&corev1.ConfigMap{}, r.enqueueAllPods(), builder.WithPredicates(r.costMappingPredicate())).
+		WithEventFilter(r.Namespaces.Predicate()).
+		WithEventFilter(r.skipProcessedPredicate()).
+		WithEventFilter(skipNoOpUpdatesPredicate()).
+		WithEventFilter(r.latency.predicate()).
+		WithOptions(r.controllerOptions()).
+		Complete(recovery.Wrap("pod-labeller", r))
 }
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/priorityqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Queue priority of pods that haven't been labelled yet, so label-based
+	// routing works as soon as they are Ready
+	NewPodPriority = 10
+
+	// Queue priority of already labelled pods (image relabelling, drift repair)
+	RelabelPriority = handler.LowPriority
+)
+
+// podPriority returns the queue priority of a pod event. With
+// PrioritizeNewPods unlabelled pods go ahead of relabel work, with
+// TopologyAwareOrdering the priority drops with the pods already waiting in
+// the pod's zone.
+func (r *PodReconciler) podPriority(ctx context.Context, obj client.Object, relabel bool) int {
+	priority := 0
+	if r.PrioritizeNewPods {
+		priority = NewPodPriority
+		if relabel || obj.GetLabels()[ProcessedLabel] == "true" {
+			priority = RelabelPriority
+		}
+	}
+	if r.TopologyAwareOrdering {
+		priority -= r.topology.enqueued(client.ObjectKeyFromObject(obj), zoneOf(ctx, r.Client, obj))
+	}
+	return priority
+}
+
+// enqueuePodByPriority enqueues pods with the priority of podPriority. Without
+// a priority queue all pods are enqueued alike.
+func (r *PodReconciler) enqueuePodByPriority() handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			addWithPriority(q, e.Object, r.podPriority(ctx, e.Object, false))
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			addWithPriority(q, e.ObjectNew, r.podPriority(ctx, e.ObjectNew, false))
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			addWithPriority(q, e.Object, r.podPriority(ctx, e.Object, true))
+		},
+		GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			addWithPriority(q, e.Object, r.podPriority(ctx, e.Object, false))
+		},
+	}
+}
+
+func addWithPriority(q workqueue.TypedRateLimitingInterface[reconcile.Request], obj client.Object, priority int) {
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(obj)}
+
+	if priorityQueue, ok := q.(priorityqueue.PriorityQueue[reconcile.Request]); ok {
+		priorityQueue.AddWithOpts(priorityqueue.AddOpts{Priority: priority}, req)
+		return
+	}
+	q.Add(req)
+}
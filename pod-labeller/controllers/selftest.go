@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SelfTestImage is a tiny image that starts fast and stays running
+const SelfTestImage = "registry.k8s.io/pause:3.10"
+
+// SelfTest creates an unlabelled pod and waits until it is labelled
+func SelfTest() selftest.Test {
+	return selftest.Test{
+		Controller: "pod-labeller",
+		Reconciler: "pod",
+		Setup: func(ctx context.Context, env *selftest.Env) error {
+			return env.Create(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: env.Name, Namespace: env.Namespace},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "pause", Image: SelfTestImage}},
+				},
+			})
+		},
+		Verify: func(ctx context.Context, env *selftest.Env) error {
+			pod := &corev1.Pod{}
+			if err := env.Client.Get(ctx, client.ObjectKey{Name: env.Name, Namespace: env.Namespace}, pod); err != nil {
+				return err
+			}
+			if pod.Labels[ProcessedLabel] != "true" {
+				return fmt.Errorf("pod %s has no %s label (phase %s)", pod.Name, ProcessedLabel, pod.Status.Phase)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/controllerconfig"
+
+// Settings that can be changed at runtime through the pod-labeller ControllerConfig
+const (
+	SettingMaxImageLabels               = "maxImageLabels"
+	SettingLabelOwnerTemplates          = "labelOwnerTemplates"
+	SettingLabelTemplates               = "labelTemplates"
+	SettingBackpressureLatencyThreshold = "backpressureLatencyThreshold"
+	SettingInheritOwnerLabels           = "inheritOwnerLabels"
+	SettingPropagateNamespaceLabels     = "propagateNamespaceLabels"
+	SettingLabelWorkloadKinds           = "labelWorkloadKinds"
+	SettingSkipDaemonSetPods            = "skipDaemonSetPods"
+	SettingSkipMirrorPods               = "skipMirrorPods"
+)
+
+// Settings lists the runtime settings of this controller
+var Settings = map[string]controllerconfig.Setting{
+	SettingMaxImageLabels: {
+		Type:        controllerconfig.Int,
+		Description: "Maximum number of per-container image labels before falling back to the hash label",
+		Min:         controllerconfig.Bound(1),
+	},
+	SettingLabelOwnerTemplates: {
+		Type:        controllerconfig.Bool,
+		Description: "Also label the pod templates of owning Deployments and StatefulSets",
+	},
+	SettingLabelTemplates: {
+		Type:        controllerconfig.String,
+		Description: "Labels whose values are Go templates evaluated against the Pod, one key=template per line",
+		Validate:    ValidateLabelTemplates,
+	},
+	SettingBackpressureLatencyThreshold: {
+		Type:        controllerconfig.Duration,
+		Description: "Smoothed queue latency above which drift repair of labelled pods is deferred, 0 never defers",
+		Min:         controllerconfig.Bound(0),
+	},
+	SettingInheritOwnerLabels: {
+		Type:        controllerconfig.String,
+		Description: "Comma separated label keys copied from the top-level owner of a pod",
+		Validate:    ValidateLabelKeys,
+	},
+	SettingPropagateNamespaceLabels: {
+		Type:        controllerconfig.String,
+		Description: "Comma separated label keys copied from the namespace of a pod and kept in sync with it",
+		Validate:    ValidateLabelKeys,
+	},
+	SettingLabelWorkloadKinds: {
+		Type:        controllerconfig.String,
+		Description: "Comma separated workload kinds labelled besides pods, of those enabled with --label-workload-kinds",
+		Validate:    ValidateWorkloadKinds,
+	},
+	SettingSkipDaemonSetPods: {
+		Type:        controllerconfig.Bool,
+		Description: "Leave pods controlled by DaemonSets unlabelled",
+	},
+	SettingSkipMirrorPods: {
+		Type:        controllerconfig.Bool,
+		Description: "Leave the mirror pods of static pods unlabelled",
+	},
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Node label with the zone the topology-aware order spreads work across
+	ZoneLabel = corev1.LabelTopologyZone
+
+	// Most a pod's queue priority is lowered for the pods already waiting in
+	// its zone, below the gap between new pods and relabel work
+	maxTopologyPenalty = NewPodPriority - 1
+)
+
+var queuedPodsByZone = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "pod_labeller_queued_pods",
+	Help: "Pods waiting on the queue by zone of their node, empty for pods without a node or zone",
+}, []string{"zone"})
+
+func init() {
+	metrics.Registry.MustRegister(queuedPodsByZone)
+}
+
+// topologyBacklog counts the pods waiting on the queue per zone. A pod event
+// is queued with its priority lowered by the pods already waiting in its zone,
+// so a churn storm in one zone, e.g. a node pool being replaced, is worked off
+// interleaved with the pods of the other zones instead of ahead of them.
+type topologyBacklog struct {
+	mutex  sync.Mutex
+	queued map[types.NamespacedName]queuedPod
+	counts map[string]int
+}
+
+type queuedPod struct {
+	zone    string
+	penalty int
+}
+
+// zoneOf returns the zone of the node a pod runs on. Pods without a node, and
+// nodes without a zone label, share the empty zone. Only node metadata is
+// read, so the cache doesn't hold full nodes.
+func zoneOf(ctx context.Context, reader client.Reader, obj client.Object) string {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return ""
+	}
+	node := &metav1.PartialObjectMetadata{}
+	node.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Node"))
+	if err := reader.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, node); err != nil {
+		return ""
+	}
+	return node.Labels[ZoneLabel]
+}
+
+// enqueued records a pod being queued in zone and returns by how much its
+// priority is lowered. A pod already waiting keeps its zone and count.
+func (b *topologyBacklog) enqueued(key types.NamespacedName, zone string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.queued == nil {
+		b.queued = make(map[types.NamespacedName]queuedPod)
+		b.counts = make(map[string]int)
+	}
+	if queued, exists := b.queued[key]; exists {
+		return queued.penalty
+	}
+
+	penalty := min(b.counts[zone], maxTopologyPenalty)
+	b.queued[key] = queuedPod{zone: zone, penalty: penalty}
+	b.counts[zone]++
+	queuedPodsByZone.WithLabelValues(zone).Set(float64(b.counts[zone]))
+	return penalty
+}
+
+// dequeued records a pod about to be reconciled
+func (b *topologyBacklog) dequeued(key types.NamespacedName) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	queued, exists := b.queued[key]
+	if !exists {
+		return
+	}
+	delete(b.queued, key)
+	zone := queued.zone
+	b.counts[zone]--
+	queuedPodsByZone.WithLabelValues(zone).Set(float64(b.counts[zone]))
+	if b.counts[zone] == 0 {
+		delete(b.counts, zone)
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Reasons pod update events are dropped before they reach the workqueue
+const (
+	// Only the status of a labelled pod changed, its readiness didn't
+	DroppedUpdateStatusOnly = "status-only"
+	// Only labels and annotations the controller manages changed, e.g. by its
+	// own label write
+	DroppedUpdateManagedLabels = "managed-labels"
+)
+
+// Annotations the controller writes on pods
+var managedPodAnnotations = []string{AppliedLabelsAnnotation, NamespaceLabelsAnnotation, SuggestedLabelsAnnotation, EnrichmentPendingAnnotation}
+
+var droppedUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pod_labeller_dropped_update_events_total",
+	Help: "Pod update events dropped before reconciling by reason: status-only or managed-labels",
+}, []string{"reason"})
+
+func init() {
+	metrics.Registry.MustRegister(droppedUpdates)
+}
+
+// skipNoOpUpdatesPredicate drops update events of labelled pods that can't
+// lead to a label write: status updates, which kubelet sends many of for
+// every pod, and changes of the labels and annotations the controller manages,
+// which its own writes cause. Updates of pods that aren't labelled yet always
+// pass, they are labelled once their status turns Ready. Events of other kinds
+// than pods pass too.
+func skipNoOpUpdatesPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldPod, okOld := e.ObjectOld.(*corev1.Pod)
+			newPod, okNew := e.ObjectNew.(*corev1.Pod)
+			if !okOld || !okNew {
+				return true
+			}
+			if !hasRequiredLables(newPod) || newPod.Labels[ProcessedLabel] != "true" {
+				return true
+			}
+
+			// Drift is only repaired on ready pods, so readiness changes count
+			if isPodReady(oldPod) != isPodReady(newPod) ||
+				!equality.Semantic.DeepEqual(oldPod.Spec, newPod.Spec) ||
+				oldPod.DeletionTimestamp.IsZero() != newPod.DeletionTimestamp.IsZero() {
+				return true
+			}
+
+			labelsEqual := maps.Equal(oldPod.Labels, newPod.Labels)
+			annotationsEqual := maps.Equal(oldPod.Annotations, newPod.Annotations)
+			if labelsEqual && annotationsEqual {
+				droppedUpdates.WithLabelValues(DroppedUpdateStatusOnly).Inc()
+				return false
+			}
+			if onlyManagedChanged(oldPod, newPod) {
+				droppedUpdates.WithLabelValues(DroppedUpdateManagedLabels).Inc()
+				return false
+			}
+			return true
+		},
+	}
+}
+
+// onlyManagedChanged reports whether all labels and annotations that differ
+// between two versions of a pod are managed by the controller: the processed
+// label, the keys listed in applied-labels before or after, and
+// the controller's own annotations
+func onlyManagedChanged(oldPod, newPod *corev1.Pod) bool {
+	applied := append(appliedLabelKeys(oldPod), appliedLabelKeys(newPod)...)
+	managedLabel := func(key string) bool {
+		return key == ProcessedLabel || slices.Contains(applied, key)
+	}
+	managedAnnotation := func(key string) bool {
+		return slices.Contains(managedPodAnnotations, key)
+	}
+	return onlyKeysChanged(oldPod.Labels, newPod.Labels, managedLabel) &&
+		onlyKeysChanged(oldPod.Annotations, newPod.Annotations, managedAnnotation)
+}
+
+// onlyKeysChanged reports whether every key added, removed or changed between
+// two maps passes allowed
+func onlyKeysChanged(before, after map[string]string, allowed func(string) bool) bool {
+	for key, value := range after {
+		if previous, exists := before[key]; (!exists || previous != value) && !allowed(key) {
+			return false
+		}
+	}
+	for key := range before {
+		if _, exists := after[key]; !exists && !allowed(key) {
+			return false
+		}
+	}
+	return true
+}
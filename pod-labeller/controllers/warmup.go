@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Time the drift check of a startup create event may wait for the cache,
+// e.g. for the namespace informer to sync
+const warmUpCheckTimeout = 2 * time.Second
+
+var (
+	warmUpDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_labeller_warmup_duration_seconds",
+		Help: "Time it took to list the already processed pods on startup",
+	})
+
+	warmUpPods = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_labeller_warmup_pods",
+		Help: "Number of already processed pods found on startup",
+	})
+
+	warmUpSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pod_labeller_warmup_skipped_pods_total",
+		Help: "Number of startup create events skipped because the pod was already processed and unchanged",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(warmUpDuration, warmUpPods, warmUpSkipped)
+}
+
+// processedPods holds the resource versions of the pods that were already
+// processed when the controller started. The informer replays every pod as a
+// create event on startup, pods that haven't changed since don't need to be
+// looked at again.
+type processedPods struct {
+	mutex sync.Mutex
+	pods  map[types.UID]string
+}
+
+// warmUp lists the pods carrying the processed label. The label query goes
+// to the API server before the cache is started, so it is done by the time
+// the first create events arrive.
+func (r *PodReconciler) warmUp(ctx context.Context, reader client.Reader) error {
+	start := time.Now()
+
+	podList := &corev1.PodList{}
+	if err := throttle.ListPages(ctx, reader, podList, r.Backoff, client.MatchingLabels{ProcessedLabel: "true"}); err != nil {
+		return err
+	}
+
+	pods := make(map[types.UID]string, len(podList.Items))
+	for _, pod := range podList.Items {
+		pods[pod.UID] = pod.ResourceVersion
+	}
+	r.processed.mutex.Lock()
+	r.processed.pods = pods
+	r.processed.mutex.Unlock()
+
+	elapsed := time.Since(start)
+	warmUpDuration.Set(elapsed.Seconds())
+	warmUpPods.Set(float64(len(pods)))
+	ctrl.Log.WithName("warm-up").Info("Listed already processed pods", "pods", len(pods), "duration", elapsed)
+	return nil
+}
+
+// seenAtWarmUp reports whether a pod was already processed and is unchanged
+// since the warm-up. Each pod is only looked up once, the set drains as the
+// informer replays the pods.
+func (p *processedPods) seenAtWarmUp(pod client.Object) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	resourceVersion, exists := p.pods[pod.GetUID()]
+	if !exists {
+		return false
+	}
+	delete(p.pods, pod.GetUID())
+	return resourceVersion == pod.GetResourceVersion()
+}
+
+// skipProcessedPredicate drops startup create events of pods that were
+// processed before the restart and need no work: they carry the required
+// labels, aren't waiting for enrichment and none of their labels drifted. It
+// runs in the informer's event handler, so it never calls the enrichment
+// service and gives up on the cache after warmUpCheckTimeout.
+func (r *PodReconciler) skipProcessedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			pod, ok := e.Object.(*corev1.Pod)
+			if !ok || !r.processed.seenAtWarmUp(pod) || !hasRequiredLables(pod) {
+				return true
+			}
+			// Pending enrichment lookups are left to the reconcile
+			if _, pending := pod.Annotations[EnrichmentPendingAnnotation]; pending {
+				return true
+			}
+			// Namespace labels or the cost mapping may have changed while the
+			// controller was down. Failed checks are left to the reconcile.
+			ctx, cancel := context.WithTimeout(context.Background(), warmUpCheckTimeout)
+			defer cancel()
+			if _, drift, err := r.cachedLabelDrift(ctx, pod); err != nil || len(drift) > 0 {
+				return true
+			}
+			warmUpSkipped.Inc()
+			return false
+		},
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// LabelWebhookPath is the path the pod labelling webhook is served on
+const LabelWebhookPath = "/mutate-pod-labels"
+
+// PodLabelWebhook labels pods when they are created, so they carry their
+// labels from the start instead of after they are Running and Ready. It uses
+// the reconciler's labelling rules. Pods the webhook missed, e.g. while the
+// controller was down, are still labelled by the reconciler.
+type PodLabelWebhook struct {
+	Reconciler *PodReconciler
+	Decoder    admission.Decoder
+}
+
+// Handle implements admission.Handler
+func (w *PodLabelWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := w.Decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	r := w.Reconciler
+	if r.Namespaces.Ignored(ctx, req.Namespace) {
+		return admission.Allowed("namespace is ignored")
+	}
+	if isOptedOut(pod) {
+		return admission.Allowed("pod opted out")
+	}
+	if r.SkipsNodeManaged(pod) {
+		return admission.Allowed("pod is managed by its node")
+	}
+	if hasRequiredLables(pod) {
+		return admission.Allowed("pod already has required labels")
+	}
+
+	// Pods created from a generateName have no name yet, and the namespace
+	// may only be set on the request. They are named like their app label.
+	view := pod.DeepCopy()
+	view.Namespace = req.Namespace
+	if view.Name == "" {
+		view.Name = appName(view)
+	}
+
+	if r.GitOpsMode == GitOpsModeSuggest || r.GitOpsMode == GitOpsModeSkip {
+		manager, err := r.gitOpsManager(ctx, view)
+		if err != nil {
+			// The reconciler decides once the pod exists
+			log.Error(err, "Failed to check whether Pod is managed by GitOps", "pod", view.Name, "namespace", view.Namespace)
+			return admission.Allowed("gitops check failed")
+		}
+		if manager != "" {
+			return admission.Allowed("pod is managed by " + manager)
+		}
+	}
+
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: req.Namespace}, ns); err == nil && isOptedOut(ns) {
+		return admission.Allowed("namespace opted out")
+	}
+
+	labelled := pod.DeepCopy()
+	labels, err := r.desiredLabels(ctx, view)
+	labelled.Labels = labels
+	if err != nil {
+		// The reconciler retries the lookup once the pod exists
+		log.Error(err, "Enrichment lookup failed, labelling Pod without it", "pod", view.Name, "namespace", view.Namespace)
+		markEnrichmentPending(labelled)
+	}
+	if _, err := r.syncNamespaceLabels(ctx, req.Namespace, labelled); err != nil {
+		// The reconciler adds them once the pod exists
+		log.Error(err, "Failed to read namespace labels", "pod", view.Name, "namespace", view.Namespace)
+	}
+	recordAppliedLabels(labelled, pod.Labels)
+	marshaled, err := json.Marshal(labelled)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	response := admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+	if r.PatchAudit != nil && response.Allowed {
+		r.PatchAudit.record(ctx, "Pod", view.Namespace, view.Name, view.UID, OperationAdmission, response.Patches, nil)
+		if r.PatchAudit.DryRun {
+			return admission.Allowed("dry run, labels recorded only")
+		}
+	}
+
+	log.Info("Labelling Pod at creation", "pod", view.Name, "namespace", view.Namespace)
+	recordLabelWrite(req.Namespace, OperationAdmission, nil)
+	return response
+}
@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Kinds the workload labeller can label besides pods
+const (
+	WorkloadKindDeployment  = "Deployment"
+	WorkloadKindStatefulSet = "StatefulSet"
+	WorkloadKindDaemonSet   = "DaemonSet"
+	WorkloadKindService     = "Service"
+)
+
+// WorkloadKinds lists the kinds the workload labeller supports
+var WorkloadKinds = []string{WorkloadKindDeployment, WorkloadKindStatefulSet, WorkloadKindDaemonSet, WorkloadKindService}
+
+var (
+	workloadsLabeled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_labeller_workloads_labeled_total",
+		Help: "Workloads whose labels were written by kind and operation: label, repair or remove",
+	}, []string{"kind", "operation"})
+
+	workloadLabelErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_labeller_workload_label_errors_total",
+		Help: "Failed workload label writes by kind and API error type (e.g. Conflict, Forbidden)",
+	}, []string{"kind", "error_type"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(workloadsLabeled, workloadLabelErrors)
+}
+
+// newWorkloadObject returns an empty object of a workload kind, or nil for
+// kinds the workload labeller doesn't support
+func newWorkloadObject(kind string) client.Object {
+	switch kind {
+	case WorkloadKindDeployment:
+		return &appsv1.Deployment{}
+	case WorkloadKindStatefulSet:
+		return &appsv1.StatefulSet{}
+	case WorkloadKindDaemonSet:
+		return &appsv1.DaemonSet{}
+	case WorkloadKindService:
+		return &corev1.Service{}
+	}
+	return nil
+}
+
+// newWorkloadList returns an empty list of a workload kind
+func newWorkloadList(kind string) client.ObjectList {
+	switch kind {
+	case WorkloadKindDeployment:
+		return &appsv1.DeploymentList{}
+	case WorkloadKindStatefulSet:
+		return &appsv1.StatefulSetList{}
+	case WorkloadKindDaemonSet:
+		return &appsv1.DaemonSetList{}
+	case WorkloadKindService:
+		return &corev1.ServiceList{}
+	}
+	return nil
+}
+
+// ParseWorkloadKinds parses a comma separated list of workload kinds. Kinds
+// are matched case-insensitively and returned in their canonical spelling.
+func ParseWorkloadKinds(raw string) ([]string, error) {
+	var kinds []string
+	for _, value := range strings.Split(raw, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		index := slices.IndexFunc(WorkloadKinds, func(kind string) bool { return strings.EqualFold(kind, value) })
+		if index < 0 {
+			return nil, fmt.Errorf("unknown workload kind %q, must be one of %s", value, strings.Join(WorkloadKinds, ", "))
+		}
+		if !slices.Contains(kinds, WorkloadKinds[index]) {
+			kinds = append(kinds, WorkloadKinds[index])
+		}
+	}
+	return kinds, nil
+}
+
+// ValidateWorkloadKinds checks the labelWorkloadKinds setting
+func ValidateWorkloadKinds(raw string) error {
+	_, err := ParseWorkloadKinds(raw)
+	return err
+}
+
+// WorkloadReconciler labels the objects of one workload kind with the
+// labelling engine of the pod reconciler: app, namespace, processed, the
+// image labels of the pod template and the namespace labels, with the same
+// opt-out, applied-labels tracking, write limit and patch audit as pods.
+type WorkloadReconciler struct {
+	// Labeller is the pod reconciler whose client, configuration and rules are used
+	Labeller *PodReconciler
+	// Kind is the workload kind, one of WorkloadKinds
+	Kind string
+	// Kinds are the workload kinds labelled unless the labelWorkloadKinds
+	// setting overrides them. Only kinds with a reconciler can be labelled.
+	Kinds []string
+}
+
+func (r *WorkloadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("kind", r.Kind)
+	l := r.Labeller
+
+	if l.Namespaces.Ignored(ctx, req.Namespace) || !r.enabled() {
+		return ctrl.Result{}, nil
+	}
+
+	obj := newWorkloadObject(r.Kind)
+	if err := l.Get(ctx, req.NamespacedName, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get workload", "name", req.Name)
+		return r.requeueOnError(err)
+	}
+	if !obj.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	optOut, err := optedOut(ctx, l, obj)
+	if err != nil {
+		log.Error(err, "Failed to check whether workload opted out", "name", obj.GetName())
+		return r.requeueOnError(err)
+	}
+	if optOut {
+		if obj.GetLabels()[ProcessedLabel] != "true" {
+			return ctrl.Result{}, nil
+		}
+		return r.write(ctx, obj, r.withoutAppliedLabels(obj), OperationRemove)
+	}
+
+	// Argo CD and Flux would revert labels they don't know, or report drift
+	if manager := gitOpsManagerOf(obj); manager != "" && l.GitOpsMode != GitOpsModeLabel {
+		log.Info("Workload is managed by GitOps, skipping", "name", obj.GetName(), "manager", manager)
+		return ctrl.Result{}, nil
+	}
+
+	labelled, err := r.withLabels(ctx, obj)
+	if err != nil {
+		log.Error(err, "Failed to derive workload labels", "name", obj.GetName())
+		return r.requeueOnError(err)
+	}
+	if maps.Equal(obj.GetLabels(), labelled.GetLabels()) && maps.Equal(obj.GetAnnotations(), labelled.GetAnnotations()) {
+		return ctrl.Result{}, nil
+	}
+
+	// Workloads share the write budget of their namespace with its pods
+	key := types.NamespacedName{Namespace: req.Namespace, Name: r.Kind + "/" + req.Name}
+	if delay := l.WriteLimiter.Delay(key); delay > 0 {
+		log.Info("Namespace write rate exceeded, deferring workload", "name", obj.GetName(), "delay", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+	operation := OperationLabel
+	if obj.GetLabels()[ProcessedLabel] == "true" {
+		operation = OperationRepair
+	}
+	return r.write(ctx, obj, labelled, operation)
+}
+
+// enabled reports whether the kind is labelled in the active configuration
+func (r *WorkloadReconciler) enabled() bool {
+	// The setting was validated when it was applied
+	kinds, _ := ParseWorkloadKinds(r.Labeller.Config.String(SettingLabelWorkloadKinds, strings.Join(r.Kinds, ",")))
+	return slices.Contains(kinds, r.Kind)
+}
+
+// withLabels returns a copy of a workload with its generated labels. Labels
+// the workload has from elsewhere, e.g. an app label of its manifest, are
+// never replaced, and image labels of containers that are gone are removed.
+func (r *WorkloadReconciler) withLabels(ctx context.Context, obj client.Object) (client.Object, error) {
+	labelled := obj.DeepCopyObject().(client.Object)
+	labels := maps.Clone(obj.GetLabels())
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	applied := appliedLabelKeys(obj)
+
+	generated := r.generateLabels(obj)
+	maps.DeleteFunc(labels, func(key, _ string) bool {
+		_, wanted := generated[key]
+		return ownedImageLabel(key, applied) && !wanted
+	})
+	for key, value := range generated {
+		if _, exists := labels[key]; !exists || slices.Contains(applied, key) {
+			labels[key] = value
+		}
+	}
+	labelled.SetLabels(labels)
+
+	if _, err := r.Labeller.syncNamespaceLabels(ctx, obj.GetNamespace(), labelled); err != nil {
+		return nil, fmt.Errorf("failed to read namespace labels: %w", err)
+	}
+	recordAppliedLabels(labelled, obj.GetLabels())
+	return labelled, nil
+}
+
+// generateLabels creates the labels of a workload like generateTemplateLabels,
+// plus the image labels of its pod template
+func (r *WorkloadReconciler) generateLabels(obj client.Object) map[string]string {
+	labels := generateTemplateLabels(obj)
+	if template := podTemplateOf(obj); template != nil {
+		maps.Copy(labels, r.Labeller.generateImageLabels(&corev1.Pod{Spec: template.Spec}))
+	}
+	return labels
+}
+
+// podTemplateOf returns the pod template of a workload, nil for Services
+func podTemplateOf(obj client.Object) *corev1.PodTemplateSpec {
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		return &workload.Spec.Template
+	case *appsv1.StatefulSet:
+		return &workload.Spec.Template
+	case *appsv1.DaemonSet:
+		return &workload.Spec.Template
+	}
+	return nil
+}
+
+// withoutAppliedLabels returns a copy of an opted-out workload without the
+// labels and annotations the controller added
+func (r *WorkloadReconciler) withoutAppliedLabels(obj client.Object) client.Object {
+	stripped := obj.DeepCopyObject().(client.Object)
+	keys := appliedLabelKeys(obj)
+
+	labels := maps.Clone(obj.GetLabels())
+	maps.DeleteFunc(labels, func(key, _ string) bool {
+		return slices.Contains(keys, key) || key == ProcessedLabel
+	})
+	stripped.SetLabels(labels)
+
+	annotations := maps.Clone(obj.GetAnnotations())
+	delete(annotations, AppliedLabelsAnnotation)
+	delete(annotations, NamespaceLabelsAnnotation)
+	stripped.SetAnnotations(annotations)
+	return stripped
+}
+
+// write patches the labels of a workload and counts the write
+func (r *WorkloadReconciler) write(ctx context.Context, original, modified client.Object, operation string) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("kind", r.Kind)
+
+	if err := r.Labeller.writeObject(ctx, r.Kind, original, modified, operation); err != nil {
+		workloadLabelErrors.WithLabelValues(r.Kind, errorType(err)).Inc()
+		log.Error(err, "Failed to write workload labels", "name", original.GetName(), "operation", operation)
+		return r.requeueOnError(err)
+	}
+	workloadsLabeled.WithLabelValues(r.Kind, operation).Inc()
+	log.Info("Wrote workload labels", "name", original.GetName(), "namespace", original.GetNamespace(), "operation", operation)
+	return ctrl.Result{}, nil
+}
+
+func (r *WorkloadReconciler) requeueOnError(err error) (ctrl.Result, error) {
+	return r.Labeller.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+}
+
+// enqueueWorkloadsOfNamespace enqueues every workload of the kind in a
+// namespace whose propagated labels or opt-out changed
+func (r *WorkloadReconciler) enqueueWorkloadsOfNamespace() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		list := newWorkloadList(r.Kind)
+		if err := r.Labeller.List(ctx, list, client.InNamespace(obj.GetName())); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list workloads of namespace", "kind", r.Kind, "namespace", obj.GetName())
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, item := range workloadItems(list) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(item)})
+		}
+		return requests
+	})
+}
+
+// workloadItems returns the objects of a workload list
+func workloadItems(list client.ObjectList) []client.Object {
+	var items []client.Object
+	switch list := list.(type) {
+	case *appsv1.DeploymentList:
+		for i := range list.Items {
+			items = append(items, &list.Items[i])
+		}
+	case *appsv1.StatefulSetList:
+		for i := range list.Items {
+			items = append(items, &list.Items[i])
+		}
+	case *appsv1.DaemonSetList:
+		for i := range list.Items {
+			items = append(items, &list.Items[i])
+		}
+	case *corev1.ServiceList:
+		for i := range list.Items {
+			items = append(items, &list.Items[i])
+		}
+	}
+	return items
+}
+
+func (r *WorkloadReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	obj := newWorkloadObject(r.Kind)
+	if obj == nil {
+		return fmt.Errorf("unknown workload kind %q", r.Kind)
+	}
+
+	// Status updates of workloads never change their labels
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("workload-"+strings.ToLower(r.Kind)).
+		For(obj, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Watches(&corev1.Namespace{}, r.enqueueWorkloadsOfNamespace(), builder.WithPredicates(predicate.Or(
+			optOutChangedPredicate(), optInChangedPredicate(), r.Labeller.namespaceLabelsChangedPredicate()))).
+		WithEventFilter(r.Labeller.Namespaces.Predicate()).
+		Complete(recovery.Wrap("pod-labeller-"+strings.ToLower(r.Kind), r))
+}
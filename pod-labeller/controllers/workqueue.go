@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Default workers labelling pods in parallel
+	DefaultMaxConcurrentReconciles = 1
+
+	// Default first and longest delay of pods retried after an error, the
+	// delay doubles with every failure in between
+	DefaultRateLimiterBaseDelay = 5 * time.Millisecond
+	DefaultRateLimiterMaxDelay  = 1000 * time.Second
+
+	// Default interval the informer cache replays all pods at
+	DefaultSyncPeriod = 10 * time.Hour
+
+	// Overall rate and burst of retries across all pods, as in controller-runtime
+	retryQPS   = 10
+	retryBurst = 100
+)
+
+// controllerOptions returns the workqueue options of the pod controller. Zero
+// values keep the controller-runtime defaults.
+func (r *PodReconciler) controllerOptions() controller.Options {
+	options := controller.Options{
+		MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+	}
+	if r.PrioritizeNewPods || r.TopologyAwareOrdering {
+		options.UsePriorityQueue = ptr.To(true)
+	}
+
+	if r.RateLimiterBaseDelay > 0 || r.RateLimiterMaxDelay > 0 {
+		baseDelay, maxDelay := DefaultRateLimiterBaseDelay, DefaultRateLimiterMaxDelay
+		if r.RateLimiterBaseDelay > 0 {
+			baseDelay = r.RateLimiterBaseDelay
+		}
+		if r.RateLimiterMaxDelay > 0 {
+			maxDelay = r.RateLimiterMaxDelay
+		}
+		options.RateLimiter = workqueue.NewTypedMaxOfRateLimiter(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](baseDelay, maxDelay),
+			&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(retryQPS), retryBurst)},
+		)
+	}
+	return options
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// Default sustained rate and burst of Pod label writes per namespace
+	DefaultNamespaceWriteQPS   = 20
+	DefaultNamespaceWriteBurst = 50
+
+	// Namespaces whose bucket was refilled this long ago are forgotten
+	idleLimiterTTL = 10 * time.Minute
+)
+
+// NamespaceWriteLimiter is a token bucket per namespace for Pod label writes.
+// A job fanning out thousands of pods in one namespace drains only its own
+// bucket, pods in other namespaces are still labelled right away.
+type NamespaceWriteLimiter struct {
+	// QPS is the sustained number of writes per second per namespace
+	QPS float64
+	// Burst is the number of writes a namespace can make at once
+	Burst int
+
+	mutex    sync.Mutex
+	limiters map[string]*namespaceLimiter
+	// slots holds the time deferred pods may write at
+	slots  map[types.NamespacedName]time.Time
+	pruned time.Time
+}
+
+type namespaceLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// Delay returns zero when a pod may be written now, or how long it has to wait
+// on the queue. A deferred pod reserves the next free slot of its namespace,
+// so deferred pods come back spread out at the namespace's rate instead of all
+// at once. A nil limiter never delays.
+func (l *NamespaceWriteLimiter) Delay(pod types.NamespacedName) time.Duration {
+	if l == nil || l.QPS <= 0 {
+		return 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if l.limiters == nil {
+		l.limiters = make(map[string]*namespaceLimiter)
+		l.slots = make(map[types.NamespacedName]time.Time)
+	}
+	l.prune(now)
+
+	// The pod already holds a slot from an earlier attempt
+	if slot, reserved := l.slots[pod]; reserved {
+		if now.Before(slot) {
+			return slot.Sub(now)
+		}
+		delete(l.slots, pod)
+		return 0
+	}
+
+	entry, exists := l.limiters[pod.Namespace]
+	if !exists {
+		entry = &namespaceLimiter{limiter: rate.NewLimiter(rate.Limit(l.QPS), max(l.Burst, 1))}
+		l.limiters[pod.Namespace] = entry
+	}
+	entry.lastUsed = now
+
+	delay := entry.limiter.ReserveN(now, 1).DelayFrom(now)
+	if delay > 0 {
+		l.slots[pod] = now.Add(delay)
+	}
+	return delay
+}
+
+// prune forgets namespaces that haven't written for a while, their buckets
+// are full again anyway, and slots of pods that never came back
+func (l *NamespaceWriteLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < idleLimiterTTL {
+		return
+	}
+	l.pruned = now
+	for namespace, entry := range l.limiters {
+		if now.Sub(entry.lastUsed) > idleLimiterTTL {
+			delete(l.limiters, namespace)
+		}
+	}
+	for pod, slot := range l.slots {
+		if now.Sub(slot) > idleLimiterTTL {
+			delete(l.slots, pod)
+		}
+	}
+}
@@ -6,18 +6,34 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	"github.com/psrvere/k8s-controllers/common/version"
 	"github.com/psrvere/k8s-controllers/pod-labeller/controllers"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 var (
@@ -27,42 +43,331 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	// "<binary> selftest [flags]" verifies an installation end-to-end
+	if len(os.Args) > 1 && os.Args[1] == selftest.Command {
+		os.Exit(selftest.Main(os.Args[2:], scheme, controllers.SelfTest()))
+	}
+
+	// "<binary> manifests [flags] [-- controller flags]" prints the install manifests
+	if len(os.Args) > 1 && os.Args[1] == manifests.Command {
+		os.Exit(manifests.Main(os.Args[2:], controllers.Manifest()))
+	}
+
 	var enableLeaderElection bool
 	var probeAddr string
+	var metricsAddr string
+	var imageLabelMode string
+	var maxImageLabels int
+	var labelOwnerTemplates bool
+	var gitOpsMode string
+	var coverageReportNamespace string
+	var coverageReportInterval time.Duration
+	var namespaceWriteQPS float64
+	var namespaceWriteBurst int
+	var enrichmentURL string
+	var enrichmentTimeout time.Duration
+	var enrichmentCacheTTL time.Duration
+	var webhookPort int
+	var labelTemplates []string
+	var backpressureLatencyThreshold time.Duration
+	var inheritOwnerLabels string
+	var watchNamespaces string
+	var excludeNamespaces string
+	var namespaceOptIn bool
+	var propagateNamespaceLabels string
+	var costMappingConfigMap string
+	var maxConcurrentReconciles int
+	var rateLimiterBaseDelay time.Duration
+	var rateLimiterMaxDelay time.Duration
+	var syncPeriod time.Duration
+	var patchAuditSink string
+	var patchAuditDryRun bool
+	var labelWorkloadKinds string
+	var skipDaemonSetPods bool
+	var skipMirrorPods bool
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The addres to which probe endpoint binds to.")
+	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080",
+		"The address the Prometheus metrics endpoint binds to. Use 0 to disable it.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&imageLabelMode, "image-label-mode", controllers.ImageLabelModePerContainer,
+		"How to label images of multi-container pods: per-container or hash.")
+	flag.IntVar(&maxImageLabels, "max-image-labels", controllers.DefaultMaxImageLabels,
+		"Maximum number of per-container image labels before falling back to a hash label.")
+	flag.BoolVar(&labelOwnerTemplates, "label-owner-templates", false,
+		"Also add the workload labels to the pod template of the owning Deployment or StatefulSet. Rolls each workload once.")
+	flag.StringVar(&gitOpsMode, "gitops-mode", controllers.GitOpsModeLabel,
+		"How to handle pods of workloads applied by Argo CD or Flux: label, suggest (record proposed labels in an annotation) or skip.")
+	flag.StringVar(&coverageReportNamespace, "coverage-report-namespace", "",
+		"Namespace to write the pod-labeller-coverage ConfigMap to. Reporting is disabled when empty.")
+	flag.DurationVar(&coverageReportInterval, "coverage-report-interval", controllers.DefaultCoverageReportInterval,
+		"How often the label coverage report is refreshed.")
+
+	flag.Float64Var(&namespaceWriteQPS, "namespace-write-qps", controllers.DefaultNamespaceWriteQPS,
+		"Sustained Pod label writes per second per namespace. Pods over the limit are requeued. 0 disables the limit.")
+	flag.IntVar(&namespaceWriteBurst, "namespace-write-burst", controllers.DefaultNamespaceWriteBurst,
+		"Pod label writes a namespace can make at once before --namespace-write-qps applies.")
+
+	flag.StringVar(&enrichmentURL, "enrichment-url", "",
+		"URL of an HTTP service the pod metadata is posted to for additional labels, e.g. a CMDB. Enrichment is disabled when empty.")
+	flag.DurationVar(&enrichmentTimeout, "enrichment-timeout", controllers.DefaultEnrichmentTimeout,
+		"Timeout of a single enrichment lookup.")
+	flag.DurationVar(&enrichmentCacheTTL, "enrichment-cache-ttl", controllers.DefaultEnrichmentCacheTTL,
+		"How long enrichment answers are reused for the pods of a workload.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "Port the pod labelling webhook listens on when AdmissionLabelling is enabled")
+	flag.DurationVar(&backpressureLatencyThreshold, "backpressure-latency-threshold", controllers.DefaultBackpressureLatencyThreshold,
+		"Smoothed queue latency above which drift repair of already labelled pods is deferred. 0 never defers.")
+	flag.StringVar(&inheritOwnerLabels, "inherit-owner-labels", "",
+		"Comma separated label keys copied from the top-level owner of a pod (Deployment, StatefulSet, DaemonSet, CronJob or Job), e.g. team,app.kubernetes.io/part-of.")
+	flag.StringVar(&propagateNamespaceLabels, "propagate-namespace-labels", "",
+		"Comma separated label keys copied from the namespace of a pod and kept in sync when the namespace labels change, e.g. team,cost-center,environment.")
+	flag.StringVar(&costMappingConfigMap, "cost-mapping-configmap", "",
+		"namespace/name of a ConfigMap whose mapping.yaml derives cost allocation labels from pod and owner annotations. Disabled when empty.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", controllers.DefaultMaxConcurrentReconciles,
+		"Number of pods labelled in parallel. Raise it on large clusters where a single worker lags behind pod churn.")
+	flag.DurationVar(&rateLimiterBaseDelay, "rate-limiter-base-delay", controllers.DefaultRateLimiterBaseDelay,
+		"Delay before a pod is retried after its first error. The delay doubles with every further error.")
+	flag.DurationVar(&rateLimiterMaxDelay, "rate-limiter-max-delay", controllers.DefaultRateLimiterMaxDelay,
+		"Longest delay before a pod that keeps failing is retried.")
+	flag.DurationVar(&syncPeriod, "sync-period", controllers.DefaultSyncPeriod,
+		"Interval the informer cache replays all pods at, so missed events are caught up with.")
+	flag.StringVar(&patchAuditSink, "patch-audit-sink", "",
+		"Where the JSON patch of every pod label write is recorded: file:<path>, configmap:<namespace>/<name> or an http(s) URL. Disabled when empty.")
+	flag.BoolVar(&patchAuditDryRun, "patch-audit-dry-run", false,
+		"Only record the patches to the --patch-audit-sink, pods are not changed. Writes are sent as server-side dry runs.")
+	flag.StringVar(&labelWorkloadKinds, "label-workload-kinds", "",
+		"Comma separated workload kinds labelled like pods besides them: Deployment, StatefulSet, DaemonSet or Service. None when empty.")
+	flag.BoolVar(&skipDaemonSetPods, "skip-daemonset-pods", false,
+		"Leave pods controlled by DaemonSets unlabelled.")
+	flag.BoolVar(&skipMirrorPods, "skip-mirror-pods", false,
+		"Leave the mirror pods of static pods (kubernetes.io/config.mirror) unlabelled.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated namespaces to label pods in. All namespaces when empty. System namespaces listed here are labelled too.")
+	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "",
+		"Comma separated namespaces to skip in addition to the system namespaces.")
+	flag.BoolVar(&namespaceOptIn, "namespace-opt-in", false,
+		"Only label pods in namespaces labelled "+controllers.NamespaceOptInLabel+"=true.")
+	flag.Func("label-template",
+		"Label whose value is a Go template evaluated against the Pod, e.g. 'team-env={{ .Namespace }}-{{ .OwnerKind }}'. Can be repeated.",
+		func(value string) error {
+			labelTemplates = append(labelTemplates, value)
+			return nil
+		})
+
+	// --kubeconfig, --context and impersonation for running out-of-cluster
+	var connection restconfig.Options
+	connection.AddFlags(flag.CommandLine)
+
+	features := featuregate.New("pod-labeller", controllers.FeatureGates)
+	features.AddFlag(flag.CommandLine)
+
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	features.Report(setupLog)
+	version.Report(setupLog, features)
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), manager.Options{
+	if !controllers.ValidGitOpsMode(gitOpsMode) {
+		setupLog.Error(fmt.Errorf("unknown mode %q", gitOpsMode), "invalid --gitops-mode, must be label, suggest or skip")
+		os.Exit(1)
+	}
+
+	if err := controllers.ValidateLabelTemplates(strings.Join(labelTemplates, "\n")); err != nil {
+		setupLog.Error(err, "invalid --label-template")
+		os.Exit(1)
+	}
+
+	inheritedLabelKeys, err := controllers.ParseLabelKeys(inheritOwnerLabels)
+	if err != nil {
+		setupLog.Error(err, "invalid --inherit-owner-labels")
+		os.Exit(1)
+	}
+
+	namespaceLabelKeys, err := controllers.ParseLabelKeys(propagateNamespaceLabels)
+	if err != nil {
+		setupLog.Error(err, "invalid --propagate-namespace-labels")
+		os.Exit(1)
+	}
+
+	workloadKinds, err := controllers.ParseWorkloadKinds(labelWorkloadKinds)
+	if err != nil {
+		setupLog.Error(err, "invalid --label-workload-kinds")
+		os.Exit(1)
+	}
+
+	var costMapping types.NamespacedName
+	if costMappingConfigMap != "" {
+		namespace, name, found := strings.Cut(costMappingConfigMap, "/")
+		if !found || namespace == "" || name == "" {
+			setupLog.Error(fmt.Errorf("%q is not namespace/name", costMappingConfigMap), "invalid --cost-mapping-configmap")
+			os.Exit(1)
+		}
+		costMapping = types.NamespacedName{Namespace: namespace, Name: name}
+	}
+
+	if maxConcurrentReconciles < 1 {
+		setupLog.Error(fmt.Errorf("%d is below 1", maxConcurrentReconciles), "invalid --max-concurrent-reconciles")
+		os.Exit(1)
+	}
+	if rateLimiterBaseDelay <= 0 || rateLimiterMaxDelay < rateLimiterBaseDelay {
+		setupLog.Error(fmt.Errorf("base delay %s, max delay %s", rateLimiterBaseDelay, rateLimiterMaxDelay),
+			"invalid --rate-limiter-base-delay or --rate-limiter-max-delay, the base delay must be positive and not above the max delay")
+		os.Exit(1)
+	}
+	if syncPeriod <= 0 {
+		setupLog.Error(fmt.Errorf("%s is not positive", syncPeriod), "invalid --sync-period")
+		os.Exit(1)
+	}
+	if patchAuditDryRun && patchAuditSink == "" {
+		setupLog.Error(fmt.Errorf("no --patch-audit-sink"), "--patch-audit-dry-run needs a sink to record the patches to")
+		os.Exit(1)
+	}
+
+	restConfig, err := connection.Load()
+	if err != nil {
+		setupLog.Error(err, "Unable to load kubeconfig")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, manager.Options{
 		Scheme:                  scheme,
 		HealthProbeBindAddress:  probeAddr,
+		Metrics:                 metricsserver.Options{BindAddress: metricsAddr},
 		LeaderElection:          enableLeaderElection,
 		LeaderElectionID:        "pod-labeller.example.com",
 		LeaderElectionNamespace: "default",
+		WebhookServer:           webhook.NewServer(webhook.Options{Port: webhookPort}),
+		// Only the watched namespaces are cached, plus those of the ConfigMaps read besides pods
+		Cache: cache.Options{
+			SyncPeriod: &syncPeriod,
+			DefaultNamespaces: predicates.CacheNamespaces(predicates.ParseNamespaces(watchNamespaces),
+				costMapping.Namespace, controllers.PatchAuditSinkNamespace(patchAuditSink)),
+		},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.PodReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	// Settings and feature gates can be changed at runtime with a ControllerConfig
+	config := controllerconfig.New("pod-labeller", controllers.Settings, features)
+	if err := config.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ControllerConfig")
+		os.Exit(1)
+	}
+
+	// Build and effective feature gates on /version of the metrics server
+	if err := version.AddToManager(mgr, "pod-labeller", config.ActiveFeatureGates); err != nil {
+		setupLog.Error(err, "unable to serve version")
+		os.Exit(1)
+	}
+
+	var patchAudit *controllers.PatchAuditor
+	if patchAuditSink != "" {
+		sink, err := controllers.ParsePatchAuditSink(patchAuditSink, mgr.GetClient())
+		if err != nil {
+			setupLog.Error(err, "invalid --patch-audit-sink")
+			os.Exit(1)
+		}
+		patchAudit = &controllers.PatchAuditor{Sink: sink, DryRun: patchAuditDryRun}
+	}
+
+	var enricher *controllers.Enricher
+	if enrichmentURL != "" {
+		enricher = &controllers.Enricher{
+			URL:              enrichmentURL,
+			Timeout:          enrichmentTimeout,
+			CacheTTL:         enrichmentCacheTTL,
+			FailureThreshold: controllers.DefaultEnrichmentFailureThreshold,
+			OpenDuration:     controllers.DefaultEnrichmentOpenDuration,
+		}
+	}
+
+	namespaces := predicates.NewNamespaceFilter(mgr.GetClient())
+	namespaces.Watch = predicates.ParseNamespaces(watchNamespaces)
+	namespaces.Exclude = predicates.ParseNamespaces(excludeNamespaces)
+	if namespaceOptIn {
+		namespaces.OptInLabel = controllers.NamespaceOptInLabel
+	}
+	backoff := throttle.NewAdaptiveBackoff("pod-labeller")
+	reconciler := &controllers.PodReconciler{
+		Client:                       throttle.WrapClient(mgr.GetClient(), backoff),
+		Scheme:                       mgr.GetScheme(),
+		Backoff:                      backoff,
+		ImageLabelMode:               imageLabelMode,
+		MaxImageLabels:               maxImageLabels,
+		RefreshImageLabels:           features.Enabled(controllers.ImageLabelRefresh),
+		ParseImageLabels:             features.Enabled(controllers.ParsedImageLabels),
+		PrioritizeNewPods:            features.Enabled(controllers.NewPodPrioritization),
+		TopologyAwareOrdering:        features.Enabled(controllers.TopologyAwareOrdering),
+		LabelOwnerTemplates:          labelOwnerTemplates,
+		SkipDaemonSetPods:            skipDaemonSetPods,
+		SkipMirrorPods:               skipMirrorPods,
+		GitOpsMode:                   gitOpsMode,
+		Namespaces:                   namespaces,
+		WriteLimiter:                 &controllers.NamespaceWriteLimiter{QPS: namespaceWriteQPS, Burst: namespaceWriteBurst},
+		Enricher:                     enricher,
+		Config:                       config,
+		WarmUpProcessedPods:          features.Enabled(controllers.ProcessedPodWarmUp),
+		LabelTemplates:               strings.Join(labelTemplates, "\n"),
+		BackpressureLatencyThreshold: backpressureLatencyThreshold,
+		InheritOwnerLabels:           inheritedLabelKeys,
+		PropagateNamespaceLabels:     namespaceLabelKeys,
+		CostMappingConfigMap:         costMapping,
+		MaxConcurrentReconciles:      maxConcurrentReconciles,
+		RateLimiterBaseDelay:         rateLimiterBaseDelay,
+		RateLimiterMaxDelay:          rateLimiterMaxDelay,
+		PatchAudit:                   patchAudit,
+		APIReader:                    mgr.GetAPIReader(),
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Pod")
 		os.Exit(1)
 	}
 
+	// The labelWorkloadKinds setting can only switch between the kinds set up here
+	for _, kind := range workloadKinds {
+		if err = (&controllers.WorkloadReconciler{
+			Labeller: reconciler,
+			Kind:     kind,
+			Kinds:    workloadKinds,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", kind)
+			os.Exit(1)
+		}
+	}
+
+	// Label pods at creation, the reconciler catches the pods the webhook missed
+	if features.Enabled(controllers.AdmissionLabelling) {
+		mgr.GetWebhookServer().Register(controllers.LabelWebhookPath, &webhook.Admission{
+			Handler: &controllers.PodLabelWebhook{
+				Reconciler: reconciler,
+				Decoder:    admission.NewDecoder(mgr.GetScheme()),
+			},
+		})
+	}
+
+	if coverageReportNamespace != "" {
+		if err := mgr.Add(&controllers.CoverageReporter{
+			Client:     mgr.GetClient(),
+			Namespace:  coverageReportNamespace,
+			Interval:   coverageReportInterval,
+			Namespaces: namespaces,
+			SkipPod:    reconciler.SkipsNodeManaged,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up coverage report")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Name of the ConfigMap new audit entries are appended to. Full segments
+	// are archived to immutable "<name>-<first sequence>" ConfigMaps.
+	AuditLogName = "secret-rotator-audit"
+
+	// Key of the JSON lines audit entries in an audit ConfigMap
+	AuditLogKey = "entries.jsonl"
+
+	// Annotations on the active audit ConfigMap continuing the chain across segments
+	AuditHeadAnnotation     = "secret-rotator/audit-head"
+	AuditSequenceAnnotation = "secret-rotator/audit-sequence"
+
+	// Annotation on monitored secrets holding the hash of the audited data
+	DataHashAnnotation = "secret-rotator/data-hash"
+
+	// Prefix of data hashes, keyed with the audit key. Unkeyed hashes of
+	// earlier versions are replaced without an audit entry.
+	dataHashPrefix = "hmac-sha256:"
+
+	// Secret in the audit namespace holding the key of the data hashes,
+	// generated on first use
+	AuditKeySecretName = "secret-rotator-audit-key"
+	auditKeyKey        = "key"
+	auditKeyBytes      = 32
+
+	// Size after which the active audit segment is archived, below the 1MiB ConfigMap limit
+	MaxAuditSegmentBytes = 768 * 1024
+)
+
+// AuditEntry records one rotation of a secret. Entries form a hash chain:
+// every entry includes the hash of the entry before it, so removing or
+// editing an entry breaks the chain for all entries after it.
+type AuditEntry struct {
+	Sequence  int64     `json:"sequence"`
+	Timestamp time.Time `json:"timestamp"`
+	Namespace string    `json:"namespace"`
+	Secret    string    `json:"secret"`
+	SecretUID types.UID `json:"secretUID"`
+	// PreviousDataHash and NewDataHash are HMAC-SHA256 hashes of the secret
+	// data before and after the rotation, keyed with the audit key so readers
+	// of the audit log can't brute force low-entropy secrets offline
+	PreviousDataHash string `json:"previousDataHash"`
+	NewDataHash      string `json:"newDataHash"`
+	// Actor is the field manager that last wrote the secret data, e.g.
+	// kubectl-edit or cert-manager-certificates-issuing
+	Actor             string `json:"actor"`
+	PreviousEntryHash string `json:"previousEntryHash"`
+	Hash              string `json:"hash"`
+}
+
+// computeHash returns the hash of the entry over all fields except Hash
+func (e AuditEntry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditLog appends rotation entries to ConfigMaps in a dedicated namespace.
+// Entries are only ever appended, full segments become immutable.
+type AuditLog struct {
+	client.Client
+	// Reader reads the active segment uncached, so appends always see the latest head
+	Reader    client.Reader
+	Namespace string
+
+	mutex sync.Mutex
+	key   []byte
+}
+
+// dataKey returns the key of the data hashes, read from or generated into the
+// AuditKeySecretName Secret
+func (a *AuditLog) dataKey(ctx context.Context) ([]byte, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.key != nil {
+		return a.key, nil
+	}
+
+	secret := &corev1.Secret{}
+	err := a.Reader.Get(ctx, client.ObjectKey{Name: AuditKeySecretName, Namespace: a.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		key := make([]byte, auditKeyBytes)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: AuditKeySecretName, Namespace: a.Namespace},
+			Data:       map[string][]byte{auditKeyKey: key},
+		}
+		err = a.Create(ctx, secret)
+		if errors.IsAlreadyExists(err) {
+			// Another replica generated it first
+			err = a.Reader.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit key: %w", err)
+	}
+	if len(secret.Data[auditKeyKey]) < auditKeyBytes {
+		return nil, fmt.Errorf("audit key secret %s/%s has no %d byte %q key", a.Namespace, AuditKeySecretName, auditKeyBytes, auditKeyKey)
+	}
+	a.key = secret.Data[auditKeyKey]
+	return a.key, nil
+}
+
+// Append adds an entry to the end of the chain, filling in its sequence and
+// hashes. An entry repeating the latest rotation of the same secret in the
+// active segment, left over from an attempt whose data hash wasn't stored on
+// the secret, is not appended again.
+func (a *AuditLog) Append(ctx context.Context, entry AuditEntry) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// Concurrent writers lose with a conflict and retry on the new head
+	retriable := func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}
+	return retry.OnError(retry.DefaultRetry, retriable, func() error {
+		active := &corev1.ConfigMap{}
+		err := a.Reader.Get(ctx, client.ObjectKey{Name: AuditLogName, Namespace: a.Namespace}, active)
+		exists := err == nil
+		if errors.IsNotFound(err) {
+			active = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      AuditLogName,
+					Namespace: a.Namespace,
+				},
+			}
+		} else if err != nil {
+			return err
+		}
+
+		entries := active.Data[AuditLogKey]
+		if auditEntryExists(entries, entry) {
+			return nil
+		}
+
+		entry.Sequence = auditSequence(active) + 1
+		entry.PreviousEntryHash = active.Annotations[AuditHeadAnnotation]
+		hash, err := entry.computeHash()
+		if err != nil {
+			return err
+		}
+		entry.Hash = hash
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		// Archive the full segment before starting a new one
+		if entries != "" && len(entries)+len(line)+1 > MaxAuditSegmentBytes {
+			if err := a.archiveSegment(ctx, active); err != nil {
+				return err
+			}
+			entries = ""
+		}
+
+		activeCopy := active.DeepCopy()
+		if activeCopy.Annotations == nil {
+			activeCopy.Annotations = make(map[string]string)
+		}
+		if activeCopy.Data == nil {
+			activeCopy.Data = make(map[string]string)
+		}
+		activeCopy.Data[AuditLogKey] = entries + string(line) + "\n"
+		activeCopy.Annotations[AuditHeadAnnotation] = entry.Hash
+		activeCopy.Annotations[AuditSequenceAnnotation] = strconv.FormatInt(entry.Sequence, 10)
+		if !exists {
+			return a.Create(ctx, activeCopy)
+		}
+		return a.Update(ctx, activeCopy)
+	})
+}
+
+// archiveSegment copies the entries of the active segment to an immutable
+// ConfigMap named after the sequence of its first entry
+func (a *AuditLog) archiveSegment(ctx context.Context, active *corev1.ConfigMap) error {
+	entries := active.Data[AuditLogKey]
+	first := AuditEntry{}
+	if err := json.Unmarshal([]byte(strings.SplitN(entries, "\n", 2)[0]), &first); err != nil {
+		return fmt.Errorf("failed to parse first audit entry: %w", err)
+	}
+
+	archive := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%08d", AuditLogName, first.Sequence),
+			Namespace: a.Namespace,
+		},
+		Data:      map[string]string{AuditLogKey: entries},
+		Immutable: &[]bool{true}[0],
+	}
+	if err := a.Create(ctx, archive); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to archive audit segment: %w", err)
+	}
+	return nil
+}
+
+func auditSequence(active *corev1.ConfigMap) int64 {
+	sequence, _ := strconv.ParseInt(active.Annotations[AuditSequenceAnnotation], 10, 64)
+	return sequence
+}
+
+// auditEntryExists reports whether the latest entry of the secret records the
+// same rotation. Only the latest counts, rotating back to earlier data is a
+// new rotation.
+func auditEntryExists(entries string, entry AuditEntry) bool {
+	var latest *AuditEntry
+	for _, line := range strings.Split(entries, "\n") {
+		if line == "" {
+			continue
+		}
+		existing := AuditEntry{}
+		if err := json.Unmarshal([]byte(line), &existing); err != nil {
+			continue
+		}
+		if existing.SecretUID == entry.SecretUID {
+			latest = &existing
+		}
+	}
+	return latest != nil && latest.PreviousDataHash == entry.PreviousDataHash && latest.NewDataHash == entry.NewDataHash
+}
+
+// secretDataHMAC hashes the keys and values of a secret in a stable order,
+// keyed with the audit key
+func secretDataHMAC(secret *corev1.Secret, key []byte) string {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := hmac.New(sha256.New, key)
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write(secret.Data[key])
+		hash.Write([]byte{0})
+	}
+	return dataHashPrefix + hex.EncodeToString(hash.Sum(nil))
+}
+
+// secretDataHash hashes the keys and values of a secret in a stable order. It
+// is only stored on the secret itself, whose readers can read the data anyway.
+func secretDataHash(secret *corev1.Secret) string {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write(secret.Data[key])
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// secretDataActor returns the field manager that last wrote the secret data
+func secretDataActor(secret *corev1.Secret) string {
+	actor := "unknown"
+	var latest time.Time
+	for _, entry := range secret.ManagedFields {
+		if entry.FieldsV1 == nil || !bytes.Contains(entry.FieldsV1.Raw, []byte(`"f:data"`)) {
+			continue
+		}
+		if entry.Time != nil && entry.Time.Time.Before(latest) {
+			continue
+		}
+		if entry.Time != nil {
+			latest = entry.Time.Time
+		}
+		actor = entry.Manager
+	}
+	return actor
+}
+
+// auditRotation records a change of the secret data in the audit log and
+// remembers the new data hash on the secret. The first time a secret is seen
+// only the hash is remembered.
+func (r *SecretRotatorReconciler) auditRotation(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	log := log.FromContext(ctx)
+
+	key, err := r.Audit.dataKey(ctx)
+	if err != nil {
+		return secret, err
+	}
+	hash := secretDataHMAC(secret, key)
+	previousHash := secret.Annotations[DataHashAnnotation]
+	if hash == previousHash {
+		return secret, nil
+	}
+
+	if strings.HasPrefix(previousHash, dataHashPrefix) {
+		entry := AuditEntry{
+			Timestamp:        time.Now().UTC(),
+			Namespace:        secret.Namespace,
+			Secret:           secret.Name,
+			SecretUID:        secret.UID,
+			PreviousDataHash: previousHash,
+			NewDataHash:      hash,
+			Actor:            secretDataActor(secret),
+		}
+		if err := r.Audit.Append(ctx, entry); err != nil {
+			return secret, fmt.Errorf("failed to append audit entry: %w", err)
+		}
+		log.Info("Recorded secret rotation in audit log", "secret", secret.Name, "namespace", secret.Namespace, "actor", entry.Actor)
+	}
+
+	secretCopy := secret.DeepCopy()
+	if secretCopy.Annotations == nil {
+		secretCopy.Annotations = make(map[string]string)
+	}
+	secretCopy.Annotations[DataHashAnnotation] = hash
+	if err := r.Update(ctx, secretCopy); err != nil {
+		return secret, err
+	}
+	return secretCopy, nil
+}
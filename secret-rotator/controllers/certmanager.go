@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Annotation cert-manager sets on the secrets it manages
+	CertificateNameAnnotation = "cert-manager.io/certificate-name"
+
+	// Annotation recording when the controller last asked cert-manager for a renewal
+	RenewalRequestedAnnotation = "secret-rotator/renewal-requested-at"
+
+	// Certificate condition cert-manager uses to track (re-)issuance
+	CertificateIssuingCondition = "Issuing"
+
+	// Event reason for renewals requested from cert-manager
+	CertificateRenewalReason = "CertificateRenewalRequested"
+)
+
+// certificateGVK is the cert-manager Certificate kind. It is handled as
+// unstructured so cert-manager is not a dependency and may be absent.
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// getManagingCertificate returns the name of the cert-manager Certificate that
+// manages a TLS secret
+func getManagingCertificate(secret *corev1.Secret) (string, bool) {
+	if secret.Type != corev1.SecretTypeTLS {
+		return "", false
+	}
+	name, exists := secret.Annotations[CertificateNameAnnotation]
+	return name, exists && name != ""
+}
+
+func isCertManagerSecret(secret *corev1.Secret) bool {
+	_, managed := getManagingCertificate(secret)
+	return managed
+}
+
+// certificateAge returns how long ago the certificate in a TLS secret became
+// valid. cert-manager renews secrets in place, so the creation time of the
+// secret doesn't tell the age of the certificate.
+func certificateAge(secret *corev1.Secret) (time.Duration, bool) {
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if block == nil {
+		return 0, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return 0, false
+	}
+	return time.Since(cert.NotBefore), true
+}
+
+// requestCertificateRenewal asks cert-manager to re-issue the Certificate of a
+// secret, the same way `cmctl renew` does, instead of flagging the secret. It
+// returns false when the Certificate doesn't exist, so the secret is flagged
+// as usual.
+func (r *SecretRotatorReconciler) requestCertificateRenewal(ctx context.Context, secret *corev1.Secret, certificateName string) (bool, error) {
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	err := r.Get(ctx, client.ObjectKey{Name: certificateName, Namespace: secret.Namespace}, certificate)
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get certificate %s: %w", certificateName, err)
+	}
+
+	// A renewal is already in progress
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]any)
+		if ok && condition["type"] == CertificateIssuingCondition && condition["status"] == string(corev1.ConditionTrue) {
+			return true, nil
+		}
+	}
+
+	// Trigger re-issuance through the Issuing condition
+	now := time.Now().UTC().Format(time.RFC3339)
+	patched := certificate.DeepCopy()
+	conditions = append(withoutCondition(conditions, CertificateIssuingCondition), map[string]any{
+		"type":               CertificateIssuingCondition,
+		"status":             string(corev1.ConditionTrue),
+		"reason":             "ManuallyTriggered",
+		"message":            "Certificate re-issuance requested by secret-rotator",
+		"lastTransitionTime": now,
+	})
+	if err := unstructured.SetNestedSlice(patched.Object, conditions, "status", "conditions"); err != nil {
+		return false, err
+	}
+	if err := r.Status().Patch(ctx, patched, client.MergeFrom(certificate)); err != nil {
+		return false, fmt.Errorf("failed to trigger renewal of certificate %s: %w", certificateName, err)
+	}
+
+	// Record the request on the Certificate
+	annotated := patched.DeepCopy()
+	annotations := annotated.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[RenewalRequestedAnnotation] = now
+	annotated.SetAnnotations(annotations)
+	if err := r.Patch(ctx, annotated, client.MergeFrom(patched)); err != nil {
+		return false, fmt.Errorf("failed to annotate certificate %s: %w", certificateName, err)
+	}
+
+	message := fmt.Sprintf("Secret exceeded its rotation threshold, renewal of cert-manager Certificate %s requested", certificateName)
+	// Unique name, a certificate is renewed many times
+	eventName := fmt.Sprintf("%s.%x", secret.Name, time.Now().UnixNano())
+	if err := r.createExemptionEvent(ctx, secret, eventName, CertificateRenewalReason, message, corev1.EventTypeNormal); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func withoutCondition(conditions []any, conditionType string) []any {
+	var filtered []any
+	for _, c := range conditions {
+		if condition, ok := c.(map[string]any); ok && condition["type"] == conditionType {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Annotation suppressing rotation flags until the given RFC3339 timestamp (break-glass)
+	ExemptUntilAnnotation = "secret-rotator/exempt-until"
+
+	// Annotation naming who approved the exemption. Exemptions without approver are ignored.
+	ExemptApprovedByAnnotation = "secret-rotator/exempt-approved-by"
+
+	// Optional annotation explaining why the exemption was granted
+	ExemptReasonAnnotation = "secret-rotator/exempt-reason"
+
+	// Event reasons for the exemption lifecycle
+	ExemptionExpiredReason = "RotationExemptionExpired"
+	ExemptionInvalidReason = "RotationExemptionInvalid"
+)
+
+// RotationExemption is a time-limited, approved suppression of rotation flags
+type RotationExemption struct {
+	Until      time.Time
+	ApprovedBy string
+	Reason     string
+}
+
+// Active reports whether the exemption still applies at the given time
+func (e *RotationExemption) Active(now time.Time) bool {
+	return e != nil && now.Before(e.Until)
+}
+
+// getRotationExemption parses the exemption annotations of a secret. It returns
+// nil without error if the secret has no exemption.
+func getRotationExemption(secret *corev1.Secret) (*RotationExemption, error) {
+	untilStr, exists := secret.Annotations[ExemptUntilAnnotation]
+	if !exists {
+		return nil, nil
+	}
+
+	until, err := time.Parse(time.RFC3339, strings.TrimSpace(untilStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q, expected RFC3339: %w", ExemptUntilAnnotation, untilStr, err)
+	}
+
+	approvedBy := strings.TrimSpace(secret.Annotations[ExemptApprovedByAnnotation])
+	if approvedBy == "" {
+		return nil, fmt.Errorf("exemption until %s has no %s", untilStr, ExemptApprovedByAnnotation)
+	}
+
+	return &RotationExemption{
+		Until:      until,
+		ApprovedBy: approvedBy,
+		Reason:     secret.Annotations[ExemptReasonAnnotation],
+	}, nil
+}
+
+// removeExpiredExemption drops the exemption annotations once an exemption has
+// expired, so flagging resumes, and records who had approved it. It returns the
+// updated secret.
+func (r *SecretRotatorReconciler) removeExpiredExemption(ctx context.Context, secret *corev1.Secret, exemption *RotationExemption) (*corev1.Secret, error) {
+	secretCopy := secret.DeepCopy()
+	delete(secretCopy.Annotations, ExemptUntilAnnotation)
+	delete(secretCopy.Annotations, ExemptApprovedByAnnotation)
+	delete(secretCopy.Annotations, ExemptReasonAnnotation)
+
+	if err := r.Update(ctx, secretCopy); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Rotation exemption approved by %s expired at %s, rotation checks resumed",
+		exemption.ApprovedBy, exemption.Until.Format(time.RFC3339))
+	// Unique name, a secret can be exempted and expire many times
+	eventName := fmt.Sprintf("%s.%x", secret.Name, time.Now().UnixNano())
+	if err := r.createExemptionEvent(ctx, secretCopy, eventName, ExemptionExpiredReason, message, corev1.EventTypeNormal); err != nil {
+		return secretCopy, err
+	}
+	return secretCopy, nil
+}
+
+// createExemptionEvent records an exemption lifecycle event on a secret
+func (r *SecretRotatorReconciler) createExemptionEvent(ctx context.Context, secret *corev1.Secret, eventName, reason, message, eventType string) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventName,
+			Namespace: secret.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Secret",
+			Name:            secret.Name,
+			Namespace:       secret.Namespace,
+			UID:             secret.UID,
+			APIVersion:      "v1",
+			ResourceVersion: secret.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: "secret-rotator",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
+
+// reportInvalidExemption warns once about an exemption that can't be applied
+func (r *SecretRotatorReconciler) reportInvalidExemption(ctx context.Context, secret *corev1.Secret, cause error) error {
+	// Check if event already exists to prevent duplicates
+	eventName := fmt.Sprintf("%s-exemption-invalid", secret.Name)
+	existingEvent := &corev1.Event{}
+	if err := r.Get(ctx, client.ObjectKey{Name: eventName, Namespace: secret.Namespace}, existingEvent); err == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("Rotation exemption ignored: %v", cause)
+	return r.createExemptionEvent(ctx, secret, eventName, ExemptionInvalidReason, message, corev1.EventTypeWarning)
+}
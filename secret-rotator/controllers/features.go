@@ -0,0 +1,16 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/featuregate"
+
+const (
+	// UnusedSecretDetection marks secrets no workload references as unused and skips their rotation
+	UnusedSecretDetection featuregate.Feature = "UnusedSecretDetection"
+	// ImmutableSecretReplacement rotates immutable secrets by replacing them with a new version and rewiring their workloads
+	ImmutableSecretReplacement featuregate.Feature = "ImmutableSecretReplacement"
+)
+
+// FeatureGates lists the features of this controller that can be toggled with --feature-gates
+var FeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	UnusedSecretDetection:      {Default: false, Stage: featuregate.Alpha},
+	ImmutableSecretReplacement: {Default: false, Stage: featuregate.Alpha},
+}
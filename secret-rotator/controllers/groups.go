@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Annotation naming the rotation group of a secret. Secrets of the same
+	// namespace and group are flagged and rotated together.
+	RotationGroupAnnotation = "secret-rotator/rotation-group"
+
+	// Annotations tracking the rotation of a group on each member
+	GroupStateAnnotation    = "secret-rotator/group-state"
+	GroupFailureAnnotation  = "secret-rotator/group-failure"
+	GroupStartedAnnotation  = "secret-rotator/group-rotation-started"
+	GroupDataHashAnnotation = "secret-rotator/group-data-hash"
+
+	// Annotation with the time the secret was last rotated with its group. The
+	// age of a secret rotated in place is taken from it.
+	RotatedAtAnnotation = "secret-rotator/rotated-at"
+
+	// Group states
+	GroupStatePending = "pending"
+	GroupStateFailed  = "failed"
+
+	// Default time all members of a group have to be rotated in once the first one was
+	DefaultGroupRotationTimeout = time.Hour
+
+	// Event reasons for the group rotation lifecycle
+	GroupRotationRequiredReason = "GroupRotationRequired"
+	GroupRotatedReason          = "GroupRotated"
+	GroupRotationFailedReason   = "GroupRotationFailed"
+)
+
+// groupMember is a secret of a rotation group with its own rotation status
+type groupMember struct {
+	secret        *corev1.Secret
+	needsRotation bool
+	unused        bool
+	// blocker explains why the secret can't be rotated with its group
+	blocker string
+}
+
+func getRotationGroup(secret *corev1.Secret) string {
+	return strings.TrimSpace(secret.Annotations[RotationGroupAnnotation])
+}
+
+// reconcileRotationGroup flags and tracks the rotation of all members of a
+// group at once. When any member needs rotation every member is flagged, and
+// the group only counts as rotated once every member's data changed (or the
+// member was recreated). A group fails as a unit: while a member can't be
+// rotated no member is flagged, and if only some members were rotated within
+// the timeout the whole group has to be rotated again. It returns when to
+// check the group again.
+func (r *SecretRotatorReconciler) reconcileRotationGroup(ctx context.Context, secret *corev1.Secret, group string) (time.Duration, error) {
+	log := log.FromContext(ctx).WithValues("group", group, "namespace", secret.Namespace)
+
+	members, err := r.getGroupMembers(ctx, secret.Namespace, group)
+	if err != nil {
+		return 0, err
+	}
+
+	var blockers, due []string
+	for _, member := range members {
+		if member.blocker != "" {
+			blockers = append(blockers, fmt.Sprintf("%s %s", member.secret.Name, member.blocker))
+		}
+		if member.needsRotation {
+			due = append(due, member.secret.Name)
+		}
+	}
+
+	now := time.Now()
+	nowStr := now.Format(time.RFC3339)
+	started, inProgress := groupRotationStarted(members)
+	requeueAfter := r.Backoff.Requeue(24 * time.Hour)
+
+	switch {
+	case inProgress && allMembersRotated(members, started):
+		message := fmt.Sprintf("All %d secrets of rotation group %s were rotated", len(members), group)
+		err = r.updateGroupMembers(ctx, members, GroupRotatedReason, message, corev1.EventTypeNormal, func(annotations map[string]string) {
+			clearGroupRotation(annotations)
+			delete(annotations, NeedsRotationAnnotation)
+			annotations[RotatedAtAnnotation] = nowStr
+		})
+		log.Info("Rotation group rotated", "members", len(members))
+
+	case len(blockers) > 0 && (inProgress || len(due) > 0):
+		// Rotating only some members would leave the group inconsistent
+		reason := "group can't be rotated: " + strings.Join(blockers, ", ")
+		message := fmt.Sprintf("Rotation group %s failed: %s", group, reason)
+		err = r.updateGroupMembers(ctx, members, GroupRotationFailedReason, message, corev1.EventTypeWarning, func(annotations map[string]string) {
+			clearGroupRotation(annotations)
+			delete(annotations, NeedsRotationAnnotation)
+			annotations[GroupStateAnnotation] = GroupStateFailed
+			annotations[GroupFailureAnnotation] = reason
+		})
+		log.Info("Rotation group blocked", "blockers", blockers)
+
+	case inProgress:
+		var rotated, missing []string
+		for _, member := range members {
+			if memberRotated(member.secret, started) {
+				rotated = append(rotated, member.secret.Name)
+			} else {
+				missing = append(missing, member.secret.Name)
+			}
+		}
+
+		deadline := started.Add(r.groupRotationTimeout())
+		if len(rotated) > 0 && now.After(deadline) {
+			// Start over, the members rotated so far have to be rotated again
+			reason := fmt.Sprintf("only %d of %d secrets were rotated within %v, not rotated: %s",
+				len(rotated), len(members), r.groupRotationTimeout(), strings.Join(missing, ", "))
+			message := fmt.Sprintf("Rotation group %s failed: %s. Rotate all secrets of the group again", group, reason)
+			err = r.updateGroupMembers(ctx, members, GroupRotationFailedReason, message, corev1.EventTypeWarning, func(annotations map[string]string) {
+				annotations[NeedsRotationAnnotation] = "true"
+				annotations[GroupStateAnnotation] = GroupStateFailed
+				annotations[GroupFailureAnnotation] = reason
+				annotations[GroupStartedAnnotation] = nowStr
+				delete(annotations, GroupDataHashAnnotation)
+			})
+			log.Info("Rotation group partially rotated, starting over", "rotated", rotated, "missing", missing)
+			return min(requeueAfter, r.groupRotationTimeout()), err
+		}
+
+		// Keep every member flagged, including secrets that joined the group since
+		err = r.updateGroupMembers(ctx, members, "", "", "", func(annotations map[string]string) {
+			annotations[NeedsRotationAnnotation] = "true"
+			if annotations[GroupStateAnnotation] == "" {
+				annotations[GroupStateAnnotation] = GroupStatePending
+			}
+			annotations[GroupStartedAnnotation] = started.Format(time.RFC3339)
+		})
+		log.Info("Waiting for rotation group", "rotated", rotated, "missing", missing)
+		if len(rotated) > 0 {
+			requeueAfter = min(requeueAfter, time.Until(deadline)+time.Second)
+		}
+
+	case len(due) > 0:
+		message := fmt.Sprintf("Rotation group %s needs rotation (due: %s), rotate all of its secrets together within %v",
+			group, strings.Join(due, ", "), r.groupRotationTimeout())
+		err = r.updateGroupMembers(ctx, members, GroupRotationRequiredReason, message, corev1.EventTypeWarning, func(annotations map[string]string) {
+			annotations[NeedsRotationAnnotation] = "true"
+			annotations[GroupStateAnnotation] = GroupStatePending
+			annotations[GroupStartedAnnotation] = nowStr
+			delete(annotations, GroupFailureAnnotation)
+			delete(annotations, GroupDataHashAnnotation)
+		})
+		log.Info("Rotation group marked for rotation", "due", due, "members", len(members))
+
+	default:
+		err = r.updateGroupMembers(ctx, members, "", "", "", func(annotations map[string]string) {
+			clearGroupRotation(annotations)
+			delete(annotations, NeedsRotationAnnotation)
+		})
+	}
+
+	return requeueAfter, err
+}
+
+// getGroupMembers returns the monitored secrets of a group, sorted by name
+func (r *SecretRotatorReconciler) getGroupMembers(ctx context.Context, namespace, group string) ([]groupMember, error) {
+	secretList := &corev1.SecretList{}
+	if err := r.List(ctx, secretList, client.InNamespace(namespace), client.HasLabels{RotationLabel}); err != nil {
+		return nil, fmt.Errorf("failed to list secrets of rotation group %s: %w", group, err)
+	}
+
+	now := time.Now()
+	var members []groupMember
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		if getRotationGroup(secret) != group {
+			continue
+		}
+
+		member := groupMember{secret: secret}
+		member.needsRotation, _, _ = r.checkSecretRotation(secret)
+
+		// Invalid exemptions are reported by the secret's own reconcile
+		if exemption, _ := getRotationExemption(secret); exemption.Active(now) {
+			member.blocker = fmt.Sprintf("is exempt from rotation until %s (approved by %s)",
+				exemption.Until.Format(time.RFC3339), exemption.ApprovedBy)
+		} else if certificate, managed := getManagingCertificate(secret); managed {
+			member.blocker = fmt.Sprintf("is renewed by cert-manager Certificate %s", certificate)
+		}
+
+		if r.Config.FeatureEnabled(UnusedSecretDetection, r.DetectUnused) {
+			referenced, err := r.isSecretReferenced(ctx, secret)
+			if err != nil {
+				return nil, err
+			}
+			member.unused = !referenced
+		}
+		if member.unused {
+			member.needsRotation = false
+		}
+
+		members = append(members, member)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].secret.Name < members[j].secret.Name
+	})
+	return members, nil
+}
+
+// updateGroupMembers applies mutate to the annotations of every member and
+// updates the members that changed. Members whose group state or failure
+// changed get an event when reason is set.
+func (r *SecretRotatorReconciler) updateGroupMembers(ctx context.Context, members []groupMember, reason, message, eventType string, mutate func(map[string]string)) error {
+	for _, member := range members {
+		secretCopy := member.secret.DeepCopy()
+		if secretCopy.Annotations == nil {
+			secretCopy.Annotations = make(map[string]string)
+		}
+		mutate(secretCopy.Annotations)
+
+		// The data hash a member is compared against when checking for rotation
+		if secretCopy.Annotations[GroupStartedAnnotation] != "" && secretCopy.Annotations[GroupDataHashAnnotation] == "" {
+			secretCopy.Annotations[GroupDataHashAnnotation] = secretDataHash(secretCopy)
+		}
+		if member.unused {
+			secretCopy.Annotations[UnusedAnnotation] = "true"
+		} else {
+			delete(secretCopy.Annotations, UnusedAnnotation)
+		}
+
+		unchanged := maps.Equal(member.secret.Annotations, secretCopy.Annotations)
+		if unchanged && secretCopy.Annotations[LastRotationCheckAnnotation] != "" {
+			continue
+		}
+		secretCopy.Annotations[LastRotationCheckAnnotation] = time.Now().Format(time.RFC3339)
+		if err := r.Update(ctx, secretCopy); err != nil {
+			return fmt.Errorf("failed to update group member %s: %w", member.secret.Name, err)
+		}
+
+		stateChanged := member.secret.Annotations[GroupStateAnnotation] != secretCopy.Annotations[GroupStateAnnotation] ||
+			member.secret.Annotations[GroupFailureAnnotation] != secretCopy.Annotations[GroupFailureAnnotation] ||
+			member.secret.Annotations[RotatedAtAnnotation] != secretCopy.Annotations[RotatedAtAnnotation]
+		if reason == "" || !stateChanged {
+			continue
+		}
+		eventName := fmt.Sprintf("%s.%x", member.secret.Name, time.Now().UnixNano())
+		if err := r.createExemptionEvent(ctx, secretCopy, eventName, reason, message, eventType); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to create group rotation event", "secret", member.secret.Name, "reason", reason)
+		}
+	}
+	return nil
+}
+
+// leaveRotationGroup removes the group tracking of a secret whose rotation
+// group annotation was removed. It returns the updated secret.
+func (r *SecretRotatorReconciler) leaveRotationGroup(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	secretCopy := secret.DeepCopy()
+	clearGroupRotation(secretCopy.Annotations)
+	if err := r.Update(ctx, secretCopy); err != nil {
+		return secret, err
+	}
+	return secretCopy, nil
+}
+
+// groupRotationStarted returns when the current rotation of a group started
+func groupRotationStarted(members []groupMember) (time.Time, bool) {
+	var started time.Time
+	for _, member := range members {
+		value, err := time.Parse(time.RFC3339, member.secret.Annotations[GroupStartedAnnotation])
+		if err != nil {
+			continue
+		}
+		if started.IsZero() || value.Before(started) {
+			started = value
+		}
+	}
+	return started, !started.IsZero()
+}
+
+func allMembersRotated(members []groupMember, started time.Time) bool {
+	for _, member := range members {
+		if !memberRotated(member.secret, started) {
+			return false
+		}
+	}
+	return len(members) > 0
+}
+
+// memberRotated reports whether a secret was recreated or got new data since
+// the rotation of its group started
+func memberRotated(secret *corev1.Secret, started time.Time) bool {
+	if secret.CreationTimestamp.Time.After(started) {
+		return true
+	}
+	hash, recorded := secret.Annotations[GroupDataHashAnnotation]
+	return recorded && hash != secretDataHash(secret)
+}
+
+// rotatedAt returns when a secret was last rotated with its group, if that was
+// after it was created
+func rotatedAt(secret *corev1.Secret) (time.Time, bool) {
+	value, err := time.Parse(time.RFC3339, secret.Annotations[RotatedAtAnnotation])
+	if err != nil || value.Before(secret.CreationTimestamp.Time) {
+		return time.Time{}, false
+	}
+	return value, true
+}
+
+func clearGroupRotation(annotations map[string]string) {
+	delete(annotations, GroupStateAnnotation)
+	delete(annotations, GroupFailureAnnotation)
+	delete(annotations, GroupStartedAnnotation)
+	delete(annotations, GroupDataHashAnnotation)
+}
+
+// groupRotationTimeout returns the time a group has to be rotated in
+func (r *SecretRotatorReconciler) groupRotationTimeout() time.Duration {
+	timeout := r.GroupRotationTimeout
+	if timeout <= 0 {
+		timeout = DefaultGroupRotationTimeout
+	}
+	return r.Config.Duration(SettingGroupRotationTimeout, timeout)
+}
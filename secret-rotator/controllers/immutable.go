@@ -0,0 +1,402 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Annotation with the comma separated keys that get new random values when
+	// an immutable secret is replaced. Other keys are copied as they are.
+	GenerateKeysAnnotation = "secret-rotator/generate-keys"
+
+	// Annotation with the number of random bytes of generated values, which
+	// are stored hex encoded
+	GenerateBytesAnnotation = "secret-rotator/generate-bytes"
+
+	// Default number of random bytes of generated values
+	DefaultGenerateBytes = 32
+
+	// Annotations linking the versions of a replaced immutable secret. Versions
+	// are named <base-name>-v<version>, the original secret is version 1.
+	BaseNameAnnotation   = "secret-rotator/base-name"
+	VersionAnnotation    = "secret-rotator/version"
+	ReplacesAnnotation   = "secret-rotator/replaces"
+	ReplacedByAnnotation = "secret-rotator/replaced-by"
+
+	// Annotations on a replaced secret with the time it was replaced and the
+	// workloads that were switched to the new version
+	ReplacedAtAnnotation       = "secret-rotator/replaced-at"
+	RewiredWorkloadsAnnotation = "secret-rotator/rewired-workloads"
+
+	// Default time a replaced secret is kept for pods still using it
+	DefaultReplacedSecretGracePeriod = 24 * time.Hour
+
+	// Interval a replaced secret still in use after its grace period is checked at
+	ReplacedSecretRecheckInterval = time.Hour
+
+	// Event reasons for the replacement lifecycle
+	SecretReplacedReason        = "SecretReplaced"
+	ReplacedSecretInUseReason   = "ReplacedSecretInUse"
+	ReplacedSecretDeletedReason = "ReplacedSecretDeleted"
+	ReplacementMismatchReason   = "ReplacementMismatch"
+)
+
+// replaceImmutableSecrets reports whether the ImmutableSecretReplacement feature is enabled
+func (r *SecretRotatorReconciler) replaceImmutableSecrets() bool {
+	return r.Config.FeatureEnabled(ImmutableSecretReplacement, r.ReplaceImmutable)
+}
+
+// replacedSecretGracePeriod returns how long a replaced secret is kept
+func (r *SecretRotatorReconciler) replacedSecretGracePeriod() time.Duration {
+	gracePeriod := r.ReplacedSecretGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultReplacedSecretGracePeriod
+	}
+	return r.Config.Duration(SettingReplacedSecretGracePeriod, gracePeriod)
+}
+
+// canReplaceSecret reports whether a secret is rotated by replacing it: it is
+// immutable and lists the keys to generate
+func canReplaceSecret(secret *corev1.Secret) bool {
+	return ptr.Deref(secret.Immutable, false) && len(getGenerateKeys(secret)) > 0
+}
+
+func getGenerateKeys(secret *corev1.Secret) []string {
+	var keys []string
+	for _, key := range strings.Split(secret.Annotations[GenerateKeysAnnotation], ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// nextSecretVersion returns the base name and version of the secret replacing this one
+func nextSecretVersion(secret *corev1.Secret) (string, int) {
+	base := secret.Annotations[BaseNameAnnotation]
+	if base == "" {
+		base = secret.Name
+	}
+	version, err := strconv.Atoi(secret.Annotations[VersionAnnotation])
+	if err != nil || version < 1 {
+		version = 1
+	}
+	return base, version + 1
+}
+
+// newSecretVersion builds the replacement of an immutable secret. Generated
+// keys get new random values, the controller's state annotations and test
+// annotations aren't carried over.
+func newSecretVersion(secret *corev1.Secret) (*corev1.Secret, error) {
+	size := DefaultGenerateBytes
+	if value, exists := secret.Annotations[GenerateBytesAnnotation]; exists {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 16 {
+			return nil, fmt.Errorf("invalid %s annotation %q: must be a number of at least 16", GenerateBytesAnnotation, value)
+		}
+		size = parsed
+	}
+
+	base, version := nextSecretVersion(secret)
+	annotations := map[string]string{
+		BaseNameAnnotation: base,
+		VersionAnnotation:  strconv.Itoa(version),
+		ReplacesAnnotation: secret.Name,
+	}
+	for key, value := range secret.Annotations {
+		switch key {
+		case RotationThresholdAnnotation, WarningThresholdAnnotation, GenerateKeysAnnotation, GenerateBytesAnnotation:
+			annotations[key] = value
+		case corev1.LastAppliedConfigAnnotation:
+		default:
+			if !strings.HasPrefix(key, "secret-rotator/") {
+				annotations[key] = value
+			}
+		}
+	}
+
+	data := make(map[string][]byte, len(secret.Data))
+	for key, value := range secret.Data {
+		data[key] = value
+	}
+	for _, key := range getGenerateKeys(secret) {
+		value := make([]byte, size)
+		if _, err := rand.Read(value); err != nil {
+			return nil, fmt.Errorf("failed to generate value of key %s: %w", key, err)
+		}
+		data[key] = []byte(hex.EncodeToString(value))
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-v%d", base, version),
+			Namespace:   secret.Namespace,
+			Labels:      secret.Labels,
+			Annotations: annotations,
+		},
+		Type:      secret.Type,
+		Immutable: ptr.To(true),
+		Data:      data,
+	}, nil
+}
+
+// replaceImmutableSecret rotates an immutable secret: it creates the next
+// version, switches the pod templates of all workloads referencing the secret
+// to it and marks the secret as replaced. Every step can be retried, a
+// version created by an earlier attempt is reused.
+func (r *SecretRotatorReconciler) replaceImmutableSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, []string, error) {
+	replacement, err := newSecretVersion(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.Create(ctx, replacement); errors.IsAlreadyExists(err) {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(replacement), replacement); err != nil {
+			return nil, nil, err
+		}
+		if replacement.Annotations[ReplacesAnnotation] != secret.Name {
+			return nil, nil, fmt.Errorf("secret %s already exists and doesn't replace %s", replacement.Name, secret.Name)
+		}
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to create secret %s: %w", replacement.Name, err)
+	}
+
+	rewired, err := r.rewireWorkloads(ctx, secret.Namespace, secret.Name, replacement.Name)
+	if err != nil {
+		return replacement, nil, err
+	}
+
+	// Only metadata changes, which immutable secrets allow
+	secretCopy := secret.DeepCopy()
+	secretCopy.Annotations[ReplacedByAnnotation] = replacement.Name
+	secretCopy.Annotations[ReplacedAtAnnotation] = time.Now().Format(time.RFC3339)
+	secretCopy.Annotations[RewiredWorkloadsAnnotation] = strings.Join(rewired, ",")
+	delete(secretCopy.Annotations, NeedsRotationAnnotation)
+	delete(secretCopy.Annotations, NeedsRotationSoonAnnotation)
+	if err := r.Patch(ctx, secretCopy, client.MergeFrom(secret)); err != nil {
+		return replacement, rewired, err
+	}
+
+	workloads := "no workloads"
+	if len(rewired) > 0 {
+		workloads = strings.Join(rewired, ", ")
+	}
+	message := fmt.Sprintf("Immutable secret replaced by %s, switched %s to it. It is deleted once unused, at the earliest in %v",
+		replacement.Name, workloads, r.replacedSecretGracePeriod())
+	eventName := fmt.Sprintf("%s.%x", secret.Name, time.Now().UnixNano())
+	if err := r.createExemptionEvent(ctx, secretCopy, eventName, SecretReplacedReason, message, corev1.EventTypeNormal); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create replacement event", "secret", secret.Name)
+	}
+	return replacement, rewired, nil
+}
+
+// podTemplateWorkload is a workload whose pod template can reference secrets
+type podTemplateWorkload struct {
+	kind   string
+	object client.Object
+	spec   *corev1.PodSpec
+}
+
+// listPodTemplateWorkloads returns the Deployments, StatefulSets, DaemonSets and CronJobs of a namespace
+func (r *SecretRotatorReconciler) listPodTemplateWorkloads(ctx context.Context, namespace string) ([]podTemplateWorkload, error) {
+	inNamespace := client.InNamespace(namespace)
+	var workloads []podTemplateWorkload
+
+	deploymentList := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deploymentList, inNamespace); err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for i := range deploymentList.Items {
+		deployment := &deploymentList.Items[i]
+		workloads = append(workloads, podTemplateWorkload{"Deployment", deployment, &deployment.Spec.Template.Spec})
+	}
+
+	statefulSetList := &appsv1.StatefulSetList{}
+	if err := r.List(ctx, statefulSetList, inNamespace); err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for i := range statefulSetList.Items {
+		statefulSet := &statefulSetList.Items[i]
+		workloads = append(workloads, podTemplateWorkload{"StatefulSet", statefulSet, &statefulSet.Spec.Template.Spec})
+	}
+
+	daemonSetList := &appsv1.DaemonSetList{}
+	if err := r.List(ctx, daemonSetList, inNamespace); err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for i := range daemonSetList.Items {
+		daemonSet := &daemonSetList.Items[i]
+		workloads = append(workloads, podTemplateWorkload{"DaemonSet", daemonSet, &daemonSet.Spec.Template.Spec})
+	}
+
+	cronJobList := &batchv1.CronJobList{}
+	if err := r.List(ctx, cronJobList, inNamespace); err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs: %w", err)
+	}
+	for i := range cronJobList.Items {
+		cronJob := &cronJobList.Items[i]
+		workloads = append(workloads, podTemplateWorkload{"CronJob", cronJob, &cronJob.Spec.JobTemplate.Spec.Template.Spec})
+	}
+
+	return workloads, nil
+}
+
+// rewireWorkloads patches the pod templates referencing a secret to reference
+// its replacement instead, which rolls the workloads out. Pods aren't touched,
+// they keep the old secret until they are replaced. It returns the rewired
+// workloads as kind/name.
+func (r *SecretRotatorReconciler) rewireWorkloads(ctx context.Context, namespace, oldName, newName string) ([]string, error) {
+	workloads, err := r.listPodTemplateWorkloads(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var rewired []string
+	for _, workload := range workloads {
+		if !podSpecReferencesSecret(workload.spec, oldName) {
+			continue
+		}
+		original := workload.object.DeepCopyObject().(client.Object)
+		rewirePodSpec(workload.spec, oldName, newName)
+
+		// Fail on concurrent changes instead of overwriting them, the retry sees them
+		patch := client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})
+		if err := r.Patch(ctx, workload.object, patch); err != nil {
+			return rewired, fmt.Errorf("failed to rewire %s %s: %w", workload.kind, workload.object.GetName(), err)
+		}
+		rewired = append(rewired, fmt.Sprintf("%s/%s", workload.kind, workload.object.GetName()))
+	}
+	return rewired, nil
+}
+
+// rewirePodSpec replaces every reference to a secret in a pod spec, the same
+// places podSpecReferencesSecret looks at
+func rewirePodSpec(spec *corev1.PodSpec, oldName, newName string) {
+	for i := range spec.ImagePullSecrets {
+		if spec.ImagePullSecrets[i].Name == oldName {
+			spec.ImagePullSecrets[i].Name = newName
+		}
+	}
+
+	for i := range spec.Volumes {
+		volume := &spec.Volumes[i]
+		if volume.Secret != nil && volume.Secret.SecretName == oldName {
+			volume.Secret.SecretName = newName
+		}
+		if volume.Projected != nil {
+			for j := range volume.Projected.Sources {
+				if source := volume.Projected.Sources[j].Secret; source != nil && source.Name == oldName {
+					source.Name = newName
+				}
+			}
+		}
+	}
+
+	for i := range spec.InitContainers {
+		rewireContainer(spec.InitContainers[i].Env, spec.InitContainers[i].EnvFrom, oldName, newName)
+	}
+	for i := range spec.Containers {
+		rewireContainer(spec.Containers[i].Env, spec.Containers[i].EnvFrom, oldName, newName)
+	}
+	for i := range spec.EphemeralContainers {
+		rewireContainer(spec.EphemeralContainers[i].Env, spec.EphemeralContainers[i].EnvFrom, oldName, newName)
+	}
+}
+
+func rewireContainer(env []corev1.EnvVar, envFrom []corev1.EnvFromSource, oldName, newName string) {
+	for i := range env {
+		if ref := env[i].ValueFrom; ref != nil && ref.SecretKeyRef != nil && ref.SecretKeyRef.Name == oldName {
+			ref.SecretKeyRef.Name = newName
+		}
+	}
+	for i := range envFrom {
+		if ref := envFrom[i].SecretRef; ref != nil && ref.Name == oldName {
+			ref.Name = newName
+		}
+	}
+}
+
+// reconcileReplacedSecret garbage collects a replaced secret once its grace
+// period is over and no pod or workload uses it anymore. A secret still in use
+// is kept and reported once. The replaced-by annotation alone proves nothing,
+// anyone can set it: the named replacement must exist and replace this secret.
+func (r *SecretRotatorReconciler) reconcileReplacedSecret(ctx context.Context, secret *corev1.Secret) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	replacement := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Name: secret.Annotations[ReplacedByAnnotation], Namespace: secret.Namespace}, replacement)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if err != nil || replacement.Annotations[ReplacesAnnotation] != secret.Name {
+		log.Info("Replacement doesn't replace this secret, keeping it", "secret", secret.Name, "namespace", secret.Namespace,
+			"replacedBy", secret.Annotations[ReplacedByAnnotation])
+		eventName := fmt.Sprintf("%s-replacement-mismatch", secret.Name)
+		if err := r.Get(ctx, client.ObjectKey{Name: eventName, Namespace: secret.Namespace}, &corev1.Event{}); errors.IsNotFound(err) {
+			message := fmt.Sprintf("Secret is annotated as replaced by %s, which doesn't exist or doesn't carry %s=%s, it is never deleted",
+				secret.Annotations[ReplacedByAnnotation], ReplacesAnnotation, secret.Name)
+			if err := r.createExemptionEvent(ctx, secret, eventName, ReplacementMismatchReason, message, corev1.EventTypeWarning); err != nil {
+				log.Error(err, "Failed to create replacement event", "secret", secret.Name)
+			}
+		}
+		// A replacement just created may not be cached yet
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ReplacedSecretRecheckInterval)}, nil
+	}
+
+	replacedAt, err := time.Parse(time.RFC3339, secret.Annotations[ReplacedAtAnnotation])
+	if err != nil {
+		// Start the grace period over rather than deleting early
+		secretCopy := secret.DeepCopy()
+		secretCopy.Annotations[ReplacedAtAnnotation] = time.Now().Format(time.RFC3339)
+		return ctrl.Result{}, r.Patch(ctx, secretCopy, client.MergeFrom(secret))
+	}
+	if remaining := time.Until(replacedAt.Add(r.replacedSecretGracePeriod())); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining + time.Second}, nil
+	}
+
+	referenced, err := r.isSecretReferenced(ctx, secret)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if referenced {
+		log.Info("Replaced secret is still in use, keeping it", "secret", secret.Name, "namespace", secret.Namespace, "replacedBy", secret.Annotations[ReplacedByAnnotation])
+		eventName := fmt.Sprintf("%s-replaced-in-use", secret.Name)
+		if err := r.Get(ctx, client.ObjectKey{Name: eventName, Namespace: secret.Namespace}, &corev1.Event{}); errors.IsNotFound(err) {
+			message := fmt.Sprintf("Secret was replaced by %s but is still used by a pod or workload, it is deleted once unused",
+				secret.Annotations[ReplacedByAnnotation])
+			if err := r.createExemptionEvent(ctx, secret, eventName, ReplacedSecretInUseReason, message, corev1.EventTypeWarning); err != nil {
+				log.Error(err, "Failed to create replacement event", "secret", secret.Name)
+			}
+		}
+		return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ReplacedSecretRecheckInterval)}, nil
+	}
+
+	// Never delete a secret that was recreated under the same name meanwhile
+	if err := r.Delete(ctx, secret, client.Preconditions{UID: &secret.UID}); err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	log.Info("Deleted replaced secret", "secret", secret.Name, "namespace", secret.Namespace, "replacedBy", secret.Annotations[ReplacedByAnnotation])
+
+	// The event goes to the replacement, the deleted secret's events go with it
+	message := fmt.Sprintf("Deleted replaced secret %s, no pod or workload uses it anymore", secret.Name)
+	eventName := fmt.Sprintf("%s.%x", replacement.Name, time.Now().UnixNano())
+	if err := r.createExemptionEvent(ctx, replacement, eventName, ReplacedSecretDeletedReason, message, corev1.EventTypeNormal); err != nil {
+		log.Error(err, "Failed to create replacement event", "secret", replacement.Name)
+	}
+	return ctrl.Result{}, nil
+}
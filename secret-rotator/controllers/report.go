@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Name of the ConfigMap holding the rotation report
+	RotationReportName = "secret-rotator-report"
+
+	// Key of the JSON report in the report ConfigMap
+	RotationReportKey = "report.json"
+
+	// Default interval between two report refreshes
+	DefaultReportInterval = time.Hour
+)
+
+// RotationReport summarizes the state of all monitored secrets
+type RotationReport struct {
+	GeneratedAt       time.Time `json:"generatedAt"`
+	Monitored         int       `json:"monitored"`
+	NeedsRotation     []string  `json:"needsRotation"`
+	NeedsRotationSoon []string  `json:"needsRotationSoon"`
+	Unused            []string  `json:"unused"`
+	Exempted          []string  `json:"exempted"`
+}
+
+// RotationReporter periodically writes a RotationReport to a ConfigMap.
+// It only reads the annotations maintained by the SecretRotatorReconciler.
+type RotationReporter struct {
+	client.Client
+	Namespace string
+	Interval  time.Duration
+	// Shards makes the leader of shard 0 the only replica writing the report. Nil always writes it.
+	Shards *ShardSet
+}
+
+// Start implements manager.Runnable
+func (r *RotationReporter) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("rotation-report")
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultReportInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if r.Shards.Leads(0) {
+			if err := r.writeReport(ctx); err != nil {
+				log.Error(err, "Failed to write rotation report")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *RotationReporter) buildReport(ctx context.Context) (*RotationReport, error) {
+	secretList := &corev1.SecretList{}
+	if err := r.List(ctx, secretList, client.HasLabels{RotationLabel}); err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	report := &RotationReport{
+		GeneratedAt:       time.Now().UTC(),
+		Monitored:         len(secretList.Items),
+		NeedsRotation:     []string{},
+		NeedsRotationSoon: []string{},
+		Unused:            []string{},
+		Exempted:          []string{},
+	}
+	now := time.Now()
+
+	for _, secret := range secretList.Items {
+		key := fmt.Sprintf("%s/%s", secret.Namespace, secret.Name)
+		if secret.Annotations[NeedsRotationAnnotation] == "true" {
+			report.NeedsRotation = append(report.NeedsRotation, key)
+		}
+		if secret.Annotations[NeedsRotationSoonAnnotation] == "true" {
+			report.NeedsRotationSoon = append(report.NeedsRotationSoon, key)
+		}
+		if secret.Annotations[UnusedAnnotation] == "true" {
+			report.Unused = append(report.Unused, key)
+		}
+		if exemption, err := getRotationExemption(&secret); err == nil && exemption.Active(now) {
+			report.Exempted = append(report.Exempted, key)
+		}
+	}
+
+	sort.Strings(report.NeedsRotation)
+	sort.Strings(report.NeedsRotationSoon)
+	sort.Strings(report.Unused)
+	sort.Strings(report.Exempted)
+	return report, nil
+}
+
+func (r *RotationReporter) writeReport(ctx context.Context) error {
+	report, err := r.buildReport(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = r.Get(ctx, client.ObjectKey{Name: RotationReportName, Namespace: r.Namespace}, configMap)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      RotationReportName,
+				Namespace: r.Namespace,
+			},
+			Data: map[string]string{
+				RotationReportKey: string(data),
+			},
+		}
+		return r.Create(ctx, configMap)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[RotationReportKey] = string(data)
+	return r.Update(ctx, configMap)
+}
@@ -7,6 +7,10 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,13 +18,45 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 type SecretRotatorReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme  *runtime.Scheme
+	Backoff *throttle.AdaptiveBackoff
+
+	// DetectUnused marks secrets no workload references as rotation-irrelevant
+	DetectUnused bool
+	// Audit records every change of a monitored secret's data. Nil disables the audit trail.
+	Audit *AuditLog
+	// Namespaces skips objects in namespaces opted out with the ignore label
+	Namespaces *predicates.NamespaceFilter
+	// GroupRotationTimeout is the time all members of a rotation group have to
+	// be rotated in once the first one was. Defaults to DefaultGroupRotationTimeout.
+	GroupRotationTimeout time.Duration
+	// WarningThresholdPercent flags secrets as needing rotation soon once they
+	// reach this percentage of their rotation threshold. 0 disables the warning.
+	WarningThresholdPercent int
+	// Config overrides the default threshold and feature gates at runtime. Nil keeps the startup configuration.
+	Config *controllerconfig.Config
+	// ReplaceImmutable rotates immutable secrets listing generated keys by
+	// replacing them with a new version and rewiring their workloads
+	ReplaceImmutable bool
+	// ReplacedSecretGracePeriod is the time a replaced secret is kept for pods
+	// still using it. Defaults to DefaultReplacedSecretGracePeriod.
+	ReplacedSecretGracePeriod time.Duration
+	// Shards limits the replica to the namespaces of the shards it leads. Nil handles all namespaces.
+	Shards *ShardSet
+	// WorkloadAPI fetches the X509-SVIDs of secrets annotated with a SPIFFE ID
+	// from the SPIRE agent. Nil leaves those secrets to the usual flagging.
+	WorkloadAPI *WorkloadAPIClient
+	// AllowedSPIFFEIDs may be held by secrets of any namespace. Other SPIFFE
+	// IDs are only accepted in the namespace of their /ns/<namespace> path.
+	AllowedSPIFFEIDs []string
 }
 
 const (
@@ -36,6 +72,9 @@ const (
 	// Annotation to mark secrets that need rotation
 	NeedsRotationAnnotation = "secret-rotator/needs-rotation"
 
+	// Annotation to mark secrets not referenced by any workload (rotation-irrelevant)
+	UnusedAnnotation = "secret-rotator/unused"
+
 	// Annotation to specify test age in days (test mode only)
 	TestAgeAnnotation = "secret-rotator/test-age-days"
 
@@ -49,6 +88,16 @@ const (
 func (r *SecretRotatorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
+	// Skip namespaces opted out of all controllers
+	if r.Namespaces.Ignored(ctx, req.Namespace) {
+		return ctrl.Result{}, nil
+	}
+
+	// Another replica handles namespaces of shards this one doesn't lead
+	if !r.Shards.Owns(req.Namespace) {
+		return ctrl.Result{}, nil
+	}
+
 	// Fetch the Secret
 	secret := &corev1.Secret{}
 	err := r.Get(ctx, req.NamespacedName, secret)
@@ -63,29 +112,157 @@ func (r *SecretRotatorReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	// Replaced immutable secrets are only kept until their pods are gone. Only
+	// monitored secrets are garbage collected, and only with the feature on.
+	if _, replaced := secret.Annotations[ReplacedByAnnotation]; replaced && shouldMonitorSecret(secret) && r.replaceImmutableSecrets() {
+		result, err := r.reconcileReplacedSecret(ctx, secret)
+		if err != nil {
+			log.Error(err, "Failed to clean up replaced secret", "secret", secret.Name, "namespace", secret.Namespace)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		return result, nil
+	}
+
 	// Check if this Secret should be monitored for rotation
 	if !shouldMonitorSecret(secret) {
 		log.Info("Secret doesn't have rotation label, skipping", "secret", secret.Name, "namespace", secret.Namespace)
 		return ctrl.Result{}, nil
 	}
 
-	// Check if secret needs rotation
+	// Record rotations in the audit trail before anything else looks at the secret
+	if r.Audit != nil {
+		secret, err = r.auditRotation(ctx, secret)
+		if err != nil {
+			log.Error(err, "Failed to audit secret rotation", "secret", secret.Name, "namespace", secret.Namespace)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+	}
+
+	// SVID secrets are rotated by the controller itself, with SVIDs from the SPIRE agent
+	if spiffeID, managed := getSPIFFEID(secret); managed && r.WorkloadAPI != nil {
+		requeueAfter, err := r.reconcileSVIDSecret(ctx, secret, spiffeID)
+		if err != nil {
+			log.Error(err, "Failed to rotate X509-SVID", "secret", secret.Name, "namespace", secret.Namespace, "spiffeID", spiffeID)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// Apply break-glass exemptions. Expired exemptions are removed so flagging resumes.
+	exemption, err := getRotationExemption(secret)
+	if err != nil {
+		log.Info("Ignoring invalid rotation exemption", "secret", secret.Name, "namespace", secret.Namespace, "error", err.Error())
+		if err := r.reportInvalidExemption(ctx, secret, err); err != nil {
+			log.Error(err, "Failed to create exemption event", "secret", secret.Name)
+		}
+		exemption = nil
+	}
+	now := time.Now()
+	if exemption != nil && !exemption.Active(now) {
+		secret, err = r.removeExpiredExemption(ctx, secret, exemption)
+		if err != nil {
+			log.Error(err, "Failed to remove expired rotation exemption", "secret", req.Name, "namespace", req.Namespace)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		log.Info("Rotation exemption expired", "secret", secret.Name, "namespace", secret.Namespace, "approvedBy", exemption.ApprovedBy)
+		exemption = nil
+	}
+
+	// Members of a rotation group are flagged and tracked together
+	if group := getRotationGroup(secret); group != "" {
+		requeueAfter, err := r.reconcileRotationGroup(ctx, secret, group)
+		if err != nil {
+			log.Error(err, "Failed to reconcile rotation group", "secret", secret.Name, "namespace", secret.Namespace, "group", group)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		if exemption.Active(now) {
+			requeueAfter = min(requeueAfter, exemption.Until.Sub(now)+time.Second)
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if _, tracked := secret.Annotations[GroupStateAnnotation]; tracked {
+		secret, err = r.leaveRotationGroup(ctx, secret)
+		if err != nil {
+			log.Error(err, "Failed to remove rotation group state", "secret", secret.Name, "namespace", secret.Namespace)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+	}
+
+	// Check if any workload still uses the secret
+	unused := false
+	if r.Config.FeatureEnabled(UnusedSecretDetection, r.DetectUnused) {
+		referenced, err := r.isSecretReferenced(ctx, secret)
+		if err != nil {
+			log.Error(err, "Failed to check secret references", "secret", secret.Name, "namespace", secret.Namespace)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		unused = !referenced
+	}
+
+	// Check if secret needs rotation. Unused secrets are rotation-irrelevant.
 	needsRotation, age, threshold := r.checkSecretRotation(secret)
+	dueSoon := !needsRotation && r.isRotationDueSoon(secret, age, threshold)
+	if unused {
+		needsRotation, dueSoon = false, false
+	}
+	if exemption.Active(now) {
+		needsRotation, dueSoon = false, false
+	}
+
+	// cert-manager renews its own certificates, ask it instead of flagging the secret
+	if certificateName, managed := getManagingCertificate(secret); managed && needsRotation {
+		requested, err := r.requestCertificateRenewal(ctx, secret, certificateName)
+		if err != nil {
+			log.Error(err, "Failed to request certificate renewal", "secret", secret.Name, "namespace", secret.Namespace, "certificate", certificateName)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		if requested {
+			log.Info("Requested cert-manager renewal", "secret", secret.Name, "namespace", secret.Namespace, "certificate", certificateName, "age", age)
+			needsRotation = false
+		}
+	}
+
+	// Immutable secrets can't be rotated in place, they are replaced by a new version
+	if needsRotation && canReplaceSecret(secret) && r.replaceImmutableSecrets() {
+		replacement, rewired, err := r.replaceImmutableSecret(ctx, secret)
+		if err != nil {
+			log.Error(err, "Failed to replace immutable secret", "secret", secret.Name, "namespace", secret.Namespace)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+		log.Info("Replaced immutable secret", "secret", secret.Name, "namespace", secret.Namespace, "replacement", replacement.Name, "rewired", rewired, "age", age)
+		return ctrl.Result{RequeueAfter: r.replacedSecretGracePeriod()}, nil
+	}
 
 	// Batch update secret with all changes in one operation
-	updated, err := r.batchUpdateSecret(ctx, secret, needsRotation, age, threshold)
+	updated, err := r.batchUpdateSecret(ctx, secret, needsRotation, dueSoon, unused, age, threshold)
 	if err != nil {
 		log.Error(err, "Failed to batch update secret", "secret", secret.Name, "namespace", secret.Namespace)
-		return ctrl.Result{}, err
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
 	}
 
 	if updated {
-		if needsRotation {
+		if exemption.Active(now) {
+			log.Info("Secret is exempt from rotation",
+				"secret", secret.Name,
+				"namespace", secret.Namespace,
+				"until", exemption.Until,
+				"approvedBy", exemption.ApprovedBy)
+		} else if unused {
+			log.Info("Secret is not referenced by any workload",
+				"secret", secret.Name,
+				"namespace", secret.Namespace)
+		} else if needsRotation {
 			log.Info("Secret marked for rotation",
 				"secret", secret.Name,
 				"namespace", secret.Namespace,
 				"age", age,
 				"threshold", threshold)
+		} else if dueSoon {
+			log.Info("Secret will need rotation soon",
+				"secret", secret.Name,
+				"namespace", secret.Namespace,
+				"age", age,
+				"threshold", threshold)
 		} else {
 			log.Info("Secret is within rotation threshold",
 				"secret", secret.Name,
@@ -101,8 +278,13 @@ func (r *SecretRotatorReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			"threshold", threshold)
 	}
 
-	// Requeue after 24 hours to check again, with backoff to prevent conflicts
-	return ctrl.Result{RequeueAfter: 24 * time.Hour}, nil
+	// Requeue after 24 hours to check again, with backoff to prevent conflicts.
+	// Exemptions are re-checked right when they expire.
+	requeueAfter := r.Backoff.Requeue(24 * time.Hour)
+	if exemption.Active(now) {
+		requeueAfter = min(requeueAfter, exemption.Until.Sub(now)+time.Second)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
 func shouldMonitorSecret(secret *corev1.Secret) bool {
@@ -115,7 +297,7 @@ func shouldMonitorSecret(secret *corev1.Secret) bool {
 
 func (r *SecretRotatorReconciler) checkSecretRotation(secret *corev1.Secret) (bool, time.Duration, time.Duration) {
 	// Get rotation threshold
-	thresholdDays := getRotationThreshold(secret)
+	thresholdDays := getRotationThreshold(secret, r.Config.Int(SettingRotationThresholdDays, DefaultRotationThreshold))
 	threshold := time.Duration(thresholdDays) * 24 * time.Hour
 
 	// Calculate secret age
@@ -123,6 +305,12 @@ func (r *SecretRotatorReconciler) checkSecretRotation(secret *corev1.Secret) (bo
 	if os.Getenv("TEST_MODE") == "true" {
 		// Test mode: Use simulated time from annotation
 		age = r.calculateTestAge(secret)
+	} else if certAge, ok := certificateAge(secret); ok && isCertManagerSecret(secret) {
+		// cert-manager renews in place: use the age of the current certificate
+		age = certAge
+	} else if rotatedAt, ok := rotatedAt(secret); ok {
+		// Rotated in place with its rotation group
+		age = time.Since(rotatedAt)
 	} else {
 		// Production mode: Use real time since creation
 		age = time.Since(secret.CreationTimestamp.Time)
@@ -131,12 +319,14 @@ func (r *SecretRotatorReconciler) checkSecretRotation(secret *corev1.Secret) (bo
 	return age > threshold, age, threshold
 }
 
-func (r *SecretRotatorReconciler) batchUpdateSecret(ctx context.Context, secret *corev1.Secret, needsRotation bool, age, threshold time.Duration) (bool, error) {
+func (r *SecretRotatorReconciler) batchUpdateSecret(ctx context.Context, secret *corev1.Secret, needsRotation, dueSoon, unused bool, age, threshold time.Duration) (bool, error) {
 	// Check if secret is already in desired state (idempotency)
 	currentNeedsRotation := secret.Annotations != nil && secret.Annotations[NeedsRotationAnnotation] == "true"
+	currentDueSoon := secret.Annotations != nil && secret.Annotations[NeedsRotationSoonAnnotation] == "true"
+	currentUnused := secret.Annotations != nil && secret.Annotations[UnusedAnnotation] == "true"
 
 	// If state is already correct, skip update
-	if currentNeedsRotation == needsRotation {
+	if currentNeedsRotation == needsRotation && currentDueSoon == dueSoon && currentUnused == unused {
 		// Only update last check annotation if needed
 		if secret.Annotations == nil || secret.Annotations[LastRotationCheckAnnotation] == "" {
 			secretCopy := secret.DeepCopy()
@@ -161,6 +351,19 @@ func (r *SecretRotatorReconciler) batchUpdateSecret(ctx context.Context, secret
 	// Always update last check annotation
 	secretCopy.Annotations[LastRotationCheckAnnotation] = time.Now().Format(time.RFC3339)
 
+	if unused {
+		secretCopy.Annotations[UnusedAnnotation] = "true"
+	} else {
+		delete(secretCopy.Annotations, UnusedAnnotation)
+	}
+
+	// The warning tier is replaced by the needs-rotation flag once the threshold is exceeded
+	if dueSoon {
+		secretCopy.Annotations[NeedsRotationSoonAnnotation] = "true"
+	} else {
+		delete(secretCopy.Annotations, NeedsRotationSoonAnnotation)
+	}
+
 	if needsRotation {
 		// Mark secret as needing rotation
 		secretCopy.Annotations[NeedsRotationAnnotation] = "true"
@@ -170,6 +373,11 @@ func (r *SecretRotatorReconciler) batchUpdateSecret(ctx context.Context, secret
 			return false, err
 		}
 
+		// Only alert when the secret newly needs rotation
+		if currentNeedsRotation {
+			return true, nil
+		}
+
 		// Create event to alert about rotation
 		err := r.createRotationEvent(ctx, secret, age, threshold)
 		return true, err
@@ -177,7 +385,15 @@ func (r *SecretRotatorReconciler) batchUpdateSecret(ctx context.Context, secret
 		// Remove rotation annotation
 		delete(secretCopy.Annotations, NeedsRotationAnnotation)
 
-		err := r.Update(ctx, secretCopy)
+		if err := r.Update(ctx, secretCopy); err != nil {
+			return false, err
+		}
+
+		// Only notify when the secret newly reaches the warning threshold
+		if !dueSoon || currentDueSoon {
+			return true, nil
+		}
+		err := r.createRotationDueSoonEvent(ctx, secret, age, threshold)
 		return true, err
 	}
 }
@@ -196,20 +412,20 @@ func (r *SecretRotatorReconciler) calculateTestAge(secret *corev1.Secret) time.D
 	return 24 * time.Hour
 }
 
-func getRotationThreshold(secret *corev1.Secret) int {
+func getRotationThreshold(secret *corev1.Secret, defaultThreshold int) int {
 	if secret.Annotations == nil {
-		return DefaultRotationThreshold
+		return defaultThreshold
 	}
 
 	thresholdStr, exists := secret.Annotations[RotationThresholdAnnotation]
 	if !exists {
-		return DefaultRotationThreshold
+		return defaultThreshold
 	}
 
 	// Parse threshold (for simplicity, we'll use default if parsing fails)
 	threshold, err := strconv.Atoi(thresholdStr)
 	if err != nil {
-		return DefaultRotationThreshold
+		return defaultThreshold
 	}
 
 	return threshold
@@ -253,8 +469,17 @@ func (r *SecretRotatorReconciler) createRotationEvent(ctx context.Context, secre
 }
 
 func (r *SecretRotatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Secret{}).
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Secret{})
+	if r.Shards != nil {
+		// Secrets of shards this replica starts leading
+		builder = builder.WatchesRawSource(source.Channel(r.Shards.Events(), &handler.EnqueueRequestForObject{}))
+	}
+	return builder.
+		WithEventFilter(r.Namespaces.Predicate()).
+		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return r.Shards.Owns(obj.GetNamespace())
+		})).
 		WithEventFilter(predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool {
 				log := log.FromContext(context.Background())
@@ -308,7 +533,7 @@ func (r *SecretRotatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return true
 			},
 		}).
-		Complete(r)
+		Complete(recovery.Wrap("secret-rotator", r))
 }
 
 func hasRotationLabelChanged(old, new *corev1.Secret) bool {
@@ -326,7 +551,7 @@ func hasRotationLabel(secret *corev1.Secret) bool {
 }
 
 func hasRotationThresholdChanged(old, new *corev1.Secret) bool {
-	oldThreshold := getRotationThreshold(old)
-	newThreshold := getRotationThreshold(new)
+	oldThreshold := getRotationThreshold(old, DefaultRotationThreshold)
+	newThreshold := getRotationThreshold(new, DefaultRotationThreshold)
 	return oldThreshold != newThreshold
 }
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SelfTest creates a secret that looks overdue for rotation and waits until
+// the controller has checked it
+func SelfTest() selftest.Test {
+	return selftest.Test{
+		Controller: "secret-rotator",
+		Reconciler: "secret",
+		Setup: func(ctx context.Context, env *selftest.Env) error {
+			return env.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      env.Name,
+					Namespace: env.Namespace,
+					Labels:    map[string]string{RotationLabel: "true"},
+					Annotations: map[string]string{
+						RotationThresholdAnnotation: "1",
+						TestAgeAnnotation:           "2",
+					},
+				},
+				StringData: map[string]string{"selftest": env.Name},
+			})
+		},
+		Verify: func(ctx context.Context, env *selftest.Env) error {
+			secret := &corev1.Secret{}
+			if err := env.Client.Get(ctx, client.ObjectKey{Name: env.Name, Namespace: env.Namespace}, secret); err != nil {
+				return err
+			}
+			if secret.Annotations[LastRotationCheckAnnotation] == "" {
+				return fmt.Errorf("secret %s has not been checked yet", secret.Name)
+			}
+			return nil
+		},
+	}
+}
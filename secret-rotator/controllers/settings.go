@@ -0,0 +1,36 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/controllerconfig"
+
+// Settings that can be changed at runtime through the secret-rotator ControllerConfig
+const (
+	SettingRotationThresholdDays     = "rotationThresholdDays"
+	SettingGroupRotationTimeout      = "groupRotationTimeout"
+	SettingWarningThresholdPercent   = "warningThresholdPercent"
+	SettingReplacedSecretGracePeriod = "replacedSecretGracePeriod"
+)
+
+// Settings lists the runtime settings of this controller
+var Settings = map[string]controllerconfig.Setting{
+	SettingRotationThresholdDays: {
+		Type:        controllerconfig.Int,
+		Description: "Rotation threshold in days for secrets without the rotation-threshold-days annotation",
+		Min:         controllerconfig.Bound(1),
+	},
+	SettingGroupRotationTimeout: {
+		Type:        controllerconfig.Duration,
+		Description: "Time all members of a rotation group have to be rotated in once the first one was",
+		Min:         controllerconfig.Bound(60),
+	},
+	SettingWarningThresholdPercent: {
+		Type:        controllerconfig.Int,
+		Description: "Percentage of the rotation threshold from which secrets are flagged as needing rotation soon, 0 disables the warning",
+		Min:         controllerconfig.Bound(0),
+		Max:         controllerconfig.Bound(99),
+	},
+	SettingReplacedSecretGracePeriod: {
+		Type:        controllerconfig.Duration,
+		Description: "Time a replaced immutable secret is kept for pods still using it before it is deleted",
+		Min:         controllerconfig.Bound(0),
+	},
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Prefix of the Leases electing the leader of each shard, followed by the shard number
+	ShardLeasePrefix = "secret-rotator-shard-"
+
+	// Leader election timing of the shard Leases, the controller-runtime defaults
+	ShardLeaseDuration = 15 * time.Second
+	ShardRenewDeadline = 10 * time.Second
+	ShardRetryPeriod   = 2 * time.Second
+)
+
+var shardLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "secret_rotator_shard_leader",
+	Help: "1 for shards this replica leads, 0 otherwise",
+}, []string{"shard"})
+
+func init() {
+	metrics.Registry.MustRegister(shardLeader)
+}
+
+// ShardSet splits the namespaces of the cluster into shards by consistent
+// hashing and elects a leader for each shard with a Lease, so several
+// replicas rotate secrets in parallel and every namespace is handled by
+// exactly one of them. A replica that loses a shard stops reconciling its
+// namespaces, in-flight updates are still guarded by resource versions.
+type ShardSet struct {
+	// Shards is the number of shards. Changing it moves about 1/Shards of the
+	// namespaces to another shard.
+	Shards int
+	// MaxShards caps the shards one replica leads, so the first replica to
+	// start doesn't take all of them. 0 means no limit.
+	MaxShards int
+	// Identity of this replica in the shard Leases, unique per replica
+	Identity string
+	// LeaseNamespace holds the shard Leases
+	LeaseNamespace string
+	// Leases creates and renews the shard Leases
+	Leases coordinationv1client.LeasesGetter
+	// Reader lists the secrets of a shard when this replica starts leading it
+	Reader client.Reader
+
+	mu     sync.RWMutex
+	held   map[int]bool
+	events chan event.GenericEvent
+}
+
+// Shard returns the shard of a namespace
+func (s *ShardSet) Shard(namespace string) int {
+	h := fnv.New64a()
+	h.Write([]byte(namespace))
+	return jumpHash(h.Sum64(), s.Shards)
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Leads returns true when this replica leads a shard. A nil ShardSet leads every shard.
+func (s *ShardSet) Leads(shard int) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.held[shard]
+}
+
+// Owns returns true when this replica handles a namespace
+func (s *ShardSet) Owns(namespace string) bool {
+	if s == nil {
+		return true
+	}
+	return s.Leads(s.Shard(namespace))
+}
+
+// Events returns the channel the secrets of newly led shards are sent to,
+// so the reconciler catches up on them
+func (s *ShardSet) Events() <-chan event.GenericEvent {
+	return s.eventChannel()
+}
+
+func (s *ShardSet) eventChannel() chan event.GenericEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.events == nil {
+		s.events = make(chan event.GenericEvent, 1024)
+	}
+	return s.events
+}
+
+// Start implements manager.Runnable. It runs the leader election of every shard until ctx is done.
+func (s *ShardSet) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("sharding")
+	log.Info("Starting shard leader election", "shards", s.Shards, "maxShards", s.MaxShards, "identity", s.Identity)
+
+	var slots chan struct{}
+	if s.MaxShards > 0 {
+		slots = make(chan struct{}, s.MaxShards)
+	}
+
+	var wg sync.WaitGroup
+	for shard := range s.Shards {
+		shardLeader.WithLabelValues(strconv.Itoa(shard)).Set(0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runShard(ctx, shard, slots)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica takes part
+func (s *ShardSet) NeedLeaderElection() bool {
+	return false
+}
+
+// runShard contends for the Lease of one shard until ctx is done. With a
+// limit on the shards per replica an attempt takes a slot, and gives it up
+// when the Lease wasn't acquired in time, so slots aren't blocked by shards
+// other replicas lead.
+func (s *ShardSet) runShard(ctx context.Context, shard int, slots chan struct{}) {
+	log := log.FromContext(ctx).WithName("sharding").WithValues("shard", shard)
+
+	for ctx.Err() == nil {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		attemptCtx, cancel := context.WithCancel(ctx)
+		if slots != nil {
+			// Long enough to take over the Lease of a replica that went away
+			timer := time.AfterFunc(2*ShardLeaseDuration, func() {
+				if !s.Leads(shard) {
+					cancel()
+				}
+			})
+			context.AfterFunc(attemptCtx, func() { timer.Stop() })
+		}
+
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s%d", ShardLeasePrefix, shard),
+					Namespace: s.LeaseNamespace,
+				},
+				Client:     s.Leases,
+				LockConfig: resourcelock.ResourceLockConfig{Identity: s.Identity},
+			},
+			LeaseDuration:   ShardLeaseDuration,
+			RenewDeadline:   ShardRenewDeadline,
+			RetryPeriod:     ShardRetryPeriod,
+			ReleaseOnCancel: true,
+			Name:            fmt.Sprintf("%s%d", ShardLeasePrefix, shard),
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					log.Info("Started leading shard")
+					s.setHeld(shard, true)
+					s.resync(ctx, shard)
+				},
+				OnStoppedLeading: func() {
+					log.Info("Stopped leading shard")
+					s.setHeld(shard, false)
+				},
+			},
+		})
+		if err != nil {
+			// Only returned for an invalid configuration
+			log.Error(err, "Failed to create shard leader election")
+			cancel()
+			return
+		}
+		elector.Run(attemptCtx)
+		cancel()
+
+		if slots != nil {
+			<-slots
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(ShardRetryPeriod):
+		}
+	}
+}
+
+func (s *ShardSet) setHeld(shard int, held bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held == nil {
+		s.held = make(map[int]bool)
+	}
+	s.held[shard] = held
+
+	value := 0.0
+	if held {
+		value = 1
+	}
+	shardLeader.WithLabelValues(strconv.Itoa(shard)).Set(value)
+}
+
+// resync enqueues the monitored secrets of a shard, events for them were
+// dropped while another replica led it
+func (s *ShardSet) resync(ctx context.Context, shard int) {
+	log := log.FromContext(ctx).WithName("sharding").WithValues("shard", shard)
+
+	secretList := &corev1.SecretList{}
+	if err := s.Reader.List(ctx, secretList, client.HasLabels{RotationLabel}); err != nil {
+		log.Error(err, "Failed to list secrets of shard")
+		return
+	}
+
+	events := s.eventChannel()
+	count := 0
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		if s.Shard(secret.Namespace) != shard {
+			continue
+		}
+		select {
+		case events <- event.GenericEvent{Object: secret}:
+			count++
+		case <-ctx.Done():
+			return
+		}
+	}
+	log.Info("Enqueued secrets of shard", "secrets", count)
+}
@@ -0,0 +1,404 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Annotation with the SPIFFE ID whose X509-SVID the controller keeps in the
+	// secret, e.g. spiffe://example.org/ns/prod/sa/payments
+	SPIFFEIDAnnotation = "secret-rotator/spiffe-id"
+
+	// Annotation recording when the SVID in the secret expires
+	SVIDExpiresAtAnnotation = "secret-rotator/svid-expires-at"
+
+	// Keys of SVID secrets that aren't of type kubernetes.io/tls, the file
+	// names spiffe-helper writes
+	SVIDCertKey   = "svid.pem"
+	SVIDKeyKey    = "svid_key.pem"
+	SVIDBundleKey = "svid_bundle.pem"
+
+	// Key of the trust bundle in SVID secrets of type kubernetes.io/tls
+	TLSBundleKey = "ca.crt"
+
+	// Event reasons of SVID secrets
+	SVIDRotatedReason     = "SVIDRotated"
+	SVIDUnavailableReason = "SVIDUnavailable"
+	SVIDRejectedReason    = "SVIDRejected"
+
+	// Default timeout of a single Workload API call
+	DefaultWorkloadAPITimeout = 10 * time.Second
+
+	// Retry interval when the agent has no SVID for a SPIFFE ID, or hasn't
+	// renewed the one in the secret yet
+	svidRetryInterval = time.Minute
+
+	// The Workload API rejects calls without this header, see the SPIFFE
+	// Workload Endpoint specification
+	workloadAPIHeader   = "workload.spiffe.io"
+	fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+)
+
+var svidRotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "secret_rotator_svid_rotations_total",
+	Help: "X509-SVID rotations of secrets by result: rotated, unavailable, rejected or failed",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(svidRotations)
+}
+
+// X509SVID is an X509-SVID returned by the Workload API
+type X509SVID struct {
+	SPIFFEID string
+	// Certificates is the chain, leaf first
+	Certificates []*x509.Certificate
+	// PrivateKey is the PKCS#8 DER key of the leaf
+	PrivateKey []byte
+	// Bundle holds the CA certificates of the trust domain
+	Bundle []*x509.Certificate
+}
+
+// WorkloadAPIClient fetches X509-SVIDs from the Workload API of a SPIRE
+// agent. The agent attests the controller itself, so it returns the SVIDs of
+// the registration entries matching the controller's pod.
+type WorkloadAPIClient struct {
+	// SocketPath is the Unix socket of the agent, e.g. /run/spire/sockets/agent.sock
+	SocketPath string
+	// Timeout of a single call. Defaults to DefaultWorkloadAPITimeout.
+	Timeout time.Duration
+}
+
+// FetchX509SVIDs returns the X509-SVIDs the agent currently issues to the
+// controller. The Workload API streams updates, only the first response is read.
+func (c *WorkloadAPIClient) FetchX509SVIDs(ctx context.Context) ([]X509SVID, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWorkloadAPITimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := grpc.NewClient("unix://"+c.SocketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Workload API client: %w", err)
+	}
+	defer conn.Close()
+
+	ctx = metadata.AppendToOutgoingContext(ctx, workloadAPIHeader, "true")
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fetchX509SVIDMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Workload API: %w", err)
+	}
+	// X509SVIDRequest has no fields
+	if err := stream.SendMsg([]byte{}); err != nil {
+		return nil, fmt.Errorf("failed to call Workload API: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("failed to call Workload API: %w", err)
+	}
+	var response []byte
+	if err := stream.RecvMsg(&response); err != nil {
+		return nil, fmt.Errorf("failed to fetch X509-SVIDs: %w", err)
+	}
+	return parseX509SVIDResponse(response)
+}
+
+// rawCodec passes messages through as bytes. The few Workload API fields the
+// controller needs are decoded with protowire, so it doesn't depend on the
+// generated SPIFFE code.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	message, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return message, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	message, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*message = bytes.Clone(data)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// parseX509SVIDResponse decodes an X509SVIDResponse. Only its svids (field 1)
+// are read, CRLs and federated bundles are skipped.
+func parseX509SVIDResponse(data []byte) ([]X509SVID, error) {
+	var svids []X509SVID
+	err := rangeBytesFields(data, func(number protowire.Number, value []byte) error {
+		if number != 1 {
+			return nil
+		}
+		svid, err := parseX509SVID(value)
+		if err != nil {
+			return err
+		}
+		svids = append(svids, svid)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid X509SVIDResponse: %w", err)
+	}
+	return svids, nil
+}
+
+// parseX509SVID decodes an X509SVID message: spiffe_id (1), the DER chain
+// x509_svid (2), the PKCS#8 key x509_svid_key (3) and the DER bundle (4)
+func parseX509SVID(data []byte) (X509SVID, error) {
+	var svid X509SVID
+	err := rangeBytesFields(data, func(number protowire.Number, value []byte) error {
+		var err error
+		switch number {
+		case 1:
+			svid.SPIFFEID = string(value)
+		case 2:
+			svid.Certificates, err = x509.ParseCertificates(value)
+		case 3:
+			svid.PrivateKey = bytes.Clone(value)
+		case 4:
+			svid.Bundle, err = x509.ParseCertificates(value)
+		}
+		return err
+	})
+	if err != nil {
+		return X509SVID{}, err
+	}
+	if len(svid.Certificates) == 0 || len(svid.PrivateKey) == 0 {
+		return X509SVID{}, fmt.Errorf("X509-SVID of %q without certificate or key", svid.SPIFFEID)
+	}
+	return svid, nil
+}
+
+// rangeBytesFields calls f with the length-delimited fields of a protobuf
+// message and skips all others
+func rangeBytesFields(data []byte, f func(protowire.Number, []byte) error) error {
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if wireType != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(number, wireType, data); n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := f(number, value); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// getSPIFFEID returns the SPIFFE ID whose X509-SVID a secret holds
+func getSPIFFEID(secret *corev1.Secret) (string, bool) {
+	id := secret.Annotations[SPIFFEIDAnnotation]
+	return id, id != ""
+}
+
+// spiffeIDAllowed reports whether a secret may hold the SVID of a SPIFFE ID.
+// Anyone able to create a labelled secret could otherwise obtain the private
+// key of any identity the agent issues to the controller. Only IDs in the
+// secret's namespace, spiffe://<trust domain>/ns/<namespace>/..., and IDs
+// the operator allowed explicitly are accepted.
+func (r *SecretRotatorReconciler) spiffeIDAllowed(secret *corev1.Secret, spiffeID string) bool {
+	if slices.Contains(r.AllowedSPIFFEIDs, spiffeID) {
+		return true
+	}
+	id, err := url.Parse(spiffeID)
+	if err != nil || id.Scheme != "spiffe" || id.Host == "" || id.RawQuery != "" || id.Fragment != "" {
+		return false
+	}
+	segments := strings.Split(strings.TrimPrefix(id.Path, "/"), "/")
+	if slices.ContainsFunc(segments, func(segment string) bool {
+		return segment == "" || segment == "." || segment == ".."
+	}) {
+		return false
+	}
+	return len(segments) >= 2 && segments[0] == "ns" && segments[1] == secret.Namespace
+}
+
+// svidKeys returns the keys of the certificate chain, the private key and the
+// trust bundle of an SVID secret
+func svidKeys(secret *corev1.Secret) (string, string, string) {
+	if secret.Type == corev1.SecretTypeTLS {
+		return corev1.TLSCertKey, corev1.TLSPrivateKeyKey, TLSBundleKey
+	}
+	return SVIDCertKey, SVIDKeyKey, SVIDBundleKey
+}
+
+// storedSVID returns the leaf certificate of the SVID of a SPIFFE ID in a
+// secret
+func storedSVID(secret *corev1.Secret, spiffeID string) (*x509.Certificate, bool) {
+	certKey, _, _ := svidKeys(secret)
+	block, _ := pem.Decode(secret.Data[certKey])
+	if block == nil {
+		return nil, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, false
+	}
+	matches := slices.ContainsFunc(cert.URIs, func(uri *url.URL) bool {
+		return uri.String() == spiffeID
+	})
+	return cert, matches
+}
+
+// svidRenewalTime returns when an SVID is renewed: halfway through its
+// lifetime, the same as SPIRE renews SVIDs
+func svidRenewalTime(cert *x509.Certificate) time.Time {
+	return cert.NotBefore.Add(cert.NotAfter.Sub(cert.NotBefore) / 2)
+}
+
+// reconcileSVIDSecret keeps the X509-SVID of a SPIFFE ID in a secret, fetched
+// from the SPIRE agent. It returns when to check the secret again.
+func (r *SecretRotatorReconciler) reconcileSVIDSecret(ctx context.Context, secret *corev1.Secret, spiffeID string) (time.Duration, error) {
+	if !r.spiffeIDAllowed(secret, spiffeID) {
+		svidRotations.WithLabelValues("rejected").Inc()
+		if err := r.reportSVIDRejected(ctx, secret, spiffeID); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to create SVID event", "secret", secret.Name)
+		}
+		// Checked again when the annotation changes
+		return 0, nil
+	}
+
+	now := time.Now()
+	stored, matches := storedSVID(secret, spiffeID)
+	if matches && now.Before(svidRenewalTime(stored)) {
+		return svidRenewalTime(stored).Sub(now), nil
+	}
+
+	svids, err := r.WorkloadAPI.FetchX509SVIDs(ctx)
+	if err != nil {
+		svidRotations.WithLabelValues("failed").Inc()
+		return 0, err
+	}
+	index := slices.IndexFunc(svids, func(svid X509SVID) bool {
+		return svid.SPIFFEID == spiffeID
+	})
+	if index < 0 {
+		svidRotations.WithLabelValues("unavailable").Inc()
+		if err := r.reportSVIDUnavailable(ctx, secret, spiffeID); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to create SVID event", "secret", secret.Name)
+		}
+		return svidRetryInterval, nil
+	}
+	svid := svids[index]
+	leaf := svid.Certificates[0]
+	if matches && bytes.Equal(leaf.Raw, stored.Raw) {
+		// The agent hasn't renewed the SVID yet
+		return svidRetryInterval, nil
+	}
+
+	certKey, keyKey, bundleKey := svidKeys(secret)
+	secretCopy := secret.DeepCopy()
+	if secretCopy.Data == nil {
+		secretCopy.Data = make(map[string][]byte)
+	}
+	secretCopy.Data[certKey] = encodeCertificates(svid.Certificates)
+	secretCopy.Data[keyKey] = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: svid.PrivateKey})
+	secretCopy.Data[bundleKey] = encodeCertificates(svid.Bundle)
+
+	// The controller rotates the secret itself, it is never flagged
+	nowStr := now.UTC().Format(time.RFC3339)
+	if secretCopy.Annotations == nil {
+		secretCopy.Annotations = make(map[string]string)
+	}
+	secretCopy.Annotations[SVIDExpiresAtAnnotation] = leaf.NotAfter.UTC().Format(time.RFC3339)
+	secretCopy.Annotations[RotatedAtAnnotation] = nowStr
+	secretCopy.Annotations[LastRotationCheckAnnotation] = nowStr
+	delete(secretCopy.Annotations, NeedsRotationAnnotation)
+	delete(secretCopy.Annotations, NeedsRotationSoonAnnotation)
+
+	if err := r.Update(ctx, secretCopy); err != nil {
+		svidRotations.WithLabelValues("failed").Inc()
+		return 0, fmt.Errorf("failed to update SVID secret: %w", err)
+	}
+	svidRotations.WithLabelValues("rotated").Inc()
+	log.FromContext(ctx).Info("Rotated X509-SVID", "secret", secret.Name, "namespace", secret.Namespace,
+		"spiffeID", spiffeID, "expiresAt", leaf.NotAfter)
+
+	message := fmt.Sprintf("Rotated X509-SVID of %s, valid until %s", spiffeID, leaf.NotAfter.UTC().Format(time.RFC3339))
+	// Unique name, an SVID is rotated many times
+	eventName := fmt.Sprintf("%s.%x", secret.Name, time.Now().UnixNano())
+	if err := r.createExemptionEvent(ctx, secretCopy, eventName, SVIDRotatedReason, message, corev1.EventTypeNormal); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create SVID event", "secret", secret.Name)
+	}
+
+	if renewAt := svidRenewalTime(leaf); renewAt.After(now) {
+		return renewAt.Sub(now), nil
+	}
+	return svidRetryInterval, nil
+}
+
+func encodeCertificates(certs []*x509.Certificate) []byte {
+	var encoded []byte
+	for _, cert := range certs {
+		encoded = append(encoded, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return encoded
+}
+
+// reportSVIDUnavailable warns once that the agent issues no SVID for the
+// SPIFFE ID of a secret, usually because no registration entry matches the
+// controller
+func (r *SecretRotatorReconciler) reportSVIDUnavailable(ctx context.Context, secret *corev1.Secret, spiffeID string) error {
+	// Check if event already exists to prevent duplicates
+	eventName := fmt.Sprintf("%s-svid-unavailable", secret.Name)
+	existingEvent := &corev1.Event{}
+	if err := r.Get(ctx, client.ObjectKey{Name: eventName, Namespace: secret.Namespace}, existingEvent); err == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("The SPIRE agent issues no X509-SVID for %s to secret-rotator, register an entry for it with the selectors of the controller", spiffeID)
+	return r.createExemptionEvent(ctx, secret, eventName, SVIDUnavailableReason, message, corev1.EventTypeWarning)
+}
+
+// reportSVIDRejected warns once that a secret asks for the SVID of a SPIFFE ID
+// it may not hold
+func (r *SecretRotatorReconciler) reportSVIDRejected(ctx context.Context, secret *corev1.Secret, spiffeID string) error {
+	eventName := fmt.Sprintf("%s-svid-rejected", secret.Name)
+	existingEvent := &corev1.Event{}
+	if err := r.Get(ctx, client.ObjectKey{Name: eventName, Namespace: secret.Namespace}, existingEvent); err == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("SPIFFE ID %s is not in namespace %s (/ns/%s/...) and not allowed with --allowed-spiffe-ids, the SVID is not written to the secret",
+		spiffeID, secret.Namespace, secret.Namespace)
+	return r.createExemptionEvent(ctx, secret, eventName, SVIDRejectedReason, message, corev1.EventTypeWarning)
+}
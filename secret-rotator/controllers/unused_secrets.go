@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// isSecretReferenced checks whether any pod or workload pod template in the
+// secret's namespace references the secret through volumes, env or image pull secrets.
+// Workload templates are included so scaled-to-zero Deployments and CronJobs
+// between runs don't make their secrets look unused.
+func (r *SecretRotatorReconciler) isSecretReferenced(ctx context.Context, secret *corev1.Secret) (bool, error) {
+	inNamespace := client.InNamespace(secret.Namespace)
+
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, inNamespace); err != nil {
+		return false, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for _, pod := range podList.Items {
+		if podSpecReferencesSecret(&pod.Spec, secret.Name) {
+			return true, nil
+		}
+	}
+
+	deploymentList := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deploymentList, inNamespace); err != nil {
+		return false, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, deployment := range deploymentList.Items {
+		if podSpecReferencesSecret(&deployment.Spec.Template.Spec, secret.Name) {
+			return true, nil
+		}
+	}
+
+	statefulSetList := &appsv1.StatefulSetList{}
+	if err := r.List(ctx, statefulSetList, inNamespace); err != nil {
+		return false, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, statefulSet := range statefulSetList.Items {
+		if podSpecReferencesSecret(&statefulSet.Spec.Template.Spec, secret.Name) {
+			return true, nil
+		}
+	}
+
+	daemonSetList := &appsv1.DaemonSetList{}
+	if err := r.List(ctx, daemonSetList, inNamespace); err != nil {
+		return false, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for _, daemonSet := range daemonSetList.Items {
+		if podSpecReferencesSecret(&daemonSet.Spec.Template.Spec, secret.Name) {
+			return true, nil
+		}
+	}
+
+	cronJobList := &batchv1.CronJobList{}
+	if err := r.List(ctx, cronJobList, inNamespace); err != nil {
+		return false, fmt.Errorf("failed to list cronjobs: %w", err)
+	}
+	for _, cronJob := range cronJobList.Items {
+		if podSpecReferencesSecret(&cronJob.Spec.JobTemplate.Spec.Template.Spec, secret.Name) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// podSpecReferencesSecret checks all places a pod spec can reference a secret
+func podSpecReferencesSecret(spec *corev1.PodSpec, secretName string) bool {
+	for _, pullSecret := range spec.ImagePullSecrets {
+		if pullSecret.Name == secretName {
+			return true
+		}
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil && volume.Secret.SecretName == secretName {
+			return true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil && source.Secret.Name == secretName {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, container := range spec.InitContainers {
+		if containerReferencesSecret(container.Env, container.EnvFrom, secretName) {
+			return true
+		}
+	}
+	for _, container := range spec.Containers {
+		if containerReferencesSecret(container.Env, container.EnvFrom, secretName) {
+			return true
+		}
+	}
+	for _, container := range spec.EphemeralContainers {
+		if containerReferencesSecret(container.Env, container.EnvFrom, secretName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containerReferencesSecret(env []corev1.EnvVar, envFrom []corev1.EnvFromSource, secretName string) bool {
+	for _, envVar := range env {
+		if envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef != nil &&
+			envVar.ValueFrom.SecretKeyRef.Name == secretName {
+			return true
+		}
+	}
+	for _, source := range envFrom {
+		if source.SecretRef != nil && source.SecretRef.Name == secretName {
+			return true
+		}
+	}
+	return false
+}
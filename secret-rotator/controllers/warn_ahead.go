@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Annotation to mark secrets that reached the warning threshold and will
+	// need rotation soon
+	NeedsRotationSoonAnnotation = "secret-rotator/needs-rotation-soon"
+
+	// Annotation to override the warning threshold of a secret, in percent of
+	// its rotation threshold
+	WarningThresholdAnnotation = "secret-rotator/warning-threshold-percent"
+
+	// Default warning threshold in percent of the rotation threshold
+	DefaultWarningThresholdPercent = 75
+
+	// Event reason for secrets that will need rotation soon
+	RotationDueSoonReason = "SecretRotationDueSoon"
+)
+
+// warningThreshold returns the age from which a secret is flagged as needing
+// rotation soon. Zero disables the warning.
+func (r *SecretRotatorReconciler) warningThreshold(secret *corev1.Secret, threshold time.Duration) time.Duration {
+	percent := r.Config.Int(SettingWarningThresholdPercent, r.WarningThresholdPercent)
+	if value, exists := secret.Annotations[WarningThresholdAnnotation]; exists {
+		// Invalid values fall back to the controller's threshold
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 && parsed < 100 {
+			percent = parsed
+		}
+	}
+	if percent <= 0 || percent >= 100 {
+		return 0
+	}
+	return threshold * time.Duration(percent) / 100
+}
+
+// isRotationDueSoon reports whether a secret that doesn't need rotation yet
+// reached its warning threshold
+func (r *SecretRotatorReconciler) isRotationDueSoon(secret *corev1.Secret, age, threshold time.Duration) bool {
+	warningThreshold := r.warningThreshold(secret, threshold)
+	return warningThreshold > 0 && age > warningThreshold && age <= threshold
+}
+
+// createRotationDueSoonEvent gives teams lead time before the secret is
+// flagged. It is only called when the secret newly reaches the warning
+// threshold, so each warning gets its own event.
+func (r *SecretRotatorReconciler) createRotationDueSoonEvent(ctx context.Context, secret *corev1.Secret, age, threshold time.Duration) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", secret.Name, now.UnixNano()),
+			Namespace: secret.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Secret",
+			Name:            secret.Name,
+			Namespace:       secret.Namespace,
+			UID:             secret.UID,
+			APIVersion:      "v1",
+			ResourceVersion: secret.ResourceVersion,
+		},
+		Reason: RotationDueSoonReason,
+		Message: fmt.Sprintf("Secret %s is %v old and reaches its rotation threshold of %v in %v",
+			secret.Name, age.Round(time.Hour), threshold, (threshold - age).Round(time.Hour)),
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           corev1.EventTypeNormal,
+		Source: corev1.EventSource{
+			Component: "secret-rotator",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
@@ -3,10 +3,23 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	"github.com/psrvere/k8s-controllers/common/version"
 	"github.com/psrvere/k8s-controllers/secret-rotator/controllers"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -20,11 +33,63 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	// "<binary> selftest [flags]" verifies an installation end-to-end
+	if len(os.Args) > 1 && os.Args[1] == selftest.Command {
+		os.Exit(selftest.Main(os.Args[2:], scheme, controllers.SelfTest()))
+	}
+
+	// "<binary> manifests [flags] [-- controller flags]" prints the install manifests
+	if len(os.Args) > 1 && os.Args[1] == manifests.Command {
+		os.Exit(manifests.Main(os.Args[2:], controllers.Manifest()))
+	}
+
 	var probeAddr string
+	var detectUnused bool
+	var reportNamespace string
+	var auditNamespace string
+	var groupRotationTimeout time.Duration
+	var warningThresholdPercent int
+	var replacedSecretGracePeriod time.Duration
+	var shards int
+	var maxShardsPerReplica int
+	var shardLeaseNamespace string
+	var spireAgentSocket string
+	var allowedSPIFFEIDs string
 	flag.String("health-probe-bind-address", ":8080", "Probe endpoint binds to this address")
+	flag.BoolVar(&detectUnused, "detect-unused-secrets", false,
+		"Mark labelled secrets that no pod or workload references as rotation-irrelevant")
+	flag.StringVar(&reportNamespace, "report-namespace", "",
+		"Namespace to write the secret-rotator-report ConfigMap to. Reporting is disabled when empty.")
+	flag.StringVar(&auditNamespace, "audit-namespace", "",
+		"Namespace to write the secret-rotator-audit hash chain of rotations to. The audit trail is disabled when empty.")
+
+	flag.DurationVar(&groupRotationTimeout, "group-rotation-timeout", controllers.DefaultGroupRotationTimeout,
+		"Time all secrets of a rotation group have to be rotated in once the first one was, before the group fails")
+	flag.IntVar(&warningThresholdPercent, "warning-threshold-percent", controllers.DefaultWarningThresholdPercent,
+		"Percentage of the rotation threshold from which secrets are annotated with needs-rotation-soon. 0 disables the warning.")
+	flag.DurationVar(&replacedSecretGracePeriod, "replaced-secret-grace-period", controllers.DefaultReplacedSecretGracePeriod,
+		"Time a replaced immutable secret is kept for pods still using it, it is deleted once unused afterwards")
+	flag.IntVar(&shards, "shards", 1,
+		"Number of shards the namespaces are split into, each led by one replica. 1 disables sharding.")
+	flag.IntVar(&maxShardsPerReplica, "max-shards-per-replica", 0,
+		"Maximum number of shards one replica leads, e.g. shards/replicas rounded up. 0 means no limit.")
+	flag.StringVar(&shardLeaseNamespace, "shard-lease-namespace", "default",
+		"Namespace of the secret-rotator-shard-<n> Leases")
+	flag.StringVar(&spireAgentSocket, "spire-agent-socket", "",
+		"Unix socket of the SPIRE agent Workload API, e.g. /run/spire/sockets/agent.sock. Secrets annotated with secret-rotator/spiffe-id are rotated with SVIDs from the agent. Disabled when empty.")
+	flag.StringVar(&allowedSPIFFEIDs, "allowed-spiffe-ids", "",
+		"Comma separated SPIFFE IDs secrets of any namespace may hold. Other IDs must be in the secret's namespace, spiffe://<trust domain>/ns/<namespace>/...")
+
+	// --kubeconfig, --context and impersonation for running out-of-cluster
+	var connection restconfig.Options
+	connection.AddFlags(flag.CommandLine)
+
+	features := featuregate.New("secret-rotator", controllers.FeatureGates)
+	features.AddFlag(flag.CommandLine)
 
 	opts := zap.Options{
 		Development: true,
@@ -33,8 +98,16 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	features.Report(setupLog)
+	version.Report(setupLog, features)
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig, err := connection.Load()
+	if err != nil {
+		setupLog.Error(err, "Unable to load kubeconfig")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		HealthProbeBindAddress: probeAddr,
 	})
@@ -43,14 +116,91 @@ func main() {
 		os.Exit(1)
 	}
 
+	var audit *controllers.AuditLog
+	if auditNamespace != "" {
+		audit = &controllers.AuditLog{
+			Client:    mgr.GetClient(),
+			Reader:    mgr.GetAPIReader(),
+			Namespace: auditNamespace,
+		}
+	}
+
+	// The default threshold and feature gates can be changed at runtime with a ControllerConfig
+	config := controllerconfig.New("secret-rotator", controllers.Settings, features)
+	if err := config.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ControllerConfig")
+		os.Exit(1)
+	}
+
+	// Build and effective feature gates on /version of the metrics server
+	if err := version.AddToManager(mgr, "secret-rotator", config.ActiveFeatureGates); err != nil {
+		setupLog.Error(err, "unable to serve version")
+		os.Exit(1)
+	}
+
+	var shardSet *controllers.ShardSet
+	if shards > 1 {
+		clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			setupLog.Error(err, "Unable to create client for shard leases")
+			os.Exit(1)
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			setupLog.Error(err, "Unable to get hostname for shard leases")
+			os.Exit(1)
+		}
+		shardSet = &controllers.ShardSet{
+			Shards:         shards,
+			MaxShards:      maxShardsPerReplica,
+			Identity:       hostname + "_" + string(uuid.NewUUID()),
+			LeaseNamespace: shardLeaseNamespace,
+			Leases:         clientset.CoordinationV1(),
+			Reader:         mgr.GetClient(),
+		}
+		if err := mgr.Add(shardSet); err != nil {
+			setupLog.Error(err, "unable to set up sharding")
+			os.Exit(1)
+		}
+	}
+
+	var workloadAPI *controllers.WorkloadAPIClient
+	if spireAgentSocket != "" {
+		workloadAPI = &controllers.WorkloadAPIClient{SocketPath: spireAgentSocket}
+	}
+
+	backoff := throttle.NewAdaptiveBackoff("secret-rotator")
 	if err = (&controllers.SecretRotatorReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                    throttle.WrapClient(mgr.GetClient(), backoff),
+		Scheme:                    mgr.GetScheme(),
+		Backoff:                   backoff,
+		DetectUnused:              detectUnused || features.Enabled(controllers.UnusedSecretDetection),
+		Namespaces:                predicates.NewNamespaceFilter(mgr.GetClient()),
+		Config:                    config,
+		GroupRotationTimeout:      groupRotationTimeout,
+		WarningThresholdPercent:   warningThresholdPercent,
+		Audit:                     audit,
+		ReplaceImmutable:          features.Enabled(controllers.ImmutableSecretReplacement),
+		ReplacedSecretGracePeriod: replacedSecretGracePeriod,
+		Shards:                    shardSet,
+		WorkloadAPI:               workloadAPI,
+		AllowedSPIFFEIDs:          splitList(allowedSPIFFEIDs),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SecretRotator")
 		os.Exit(1)
 	}
 
+	if reportNamespace != "" {
+		if err := mgr.Add(&controllers.RotationReporter{
+			Client:    mgr.GetClient(),
+			Namespace: reportNamespace,
+			Shards:    shardSet,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up rotation report")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to setup health check")
 		os.Exit(1)
@@ -67,3 +217,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma separated flag value and drops empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
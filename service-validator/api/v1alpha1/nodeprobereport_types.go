@@ -0,0 +1,53 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeProbeReportSpec identifies the node that produced the report
+type NodeProbeReportSpec struct {
+	NodeName string `json:"nodeName"`
+}
+
+// ServiceProbeResult is the result of probing a single Service port from a node
+type ServiceProbeResult struct {
+	Namespace     string `json:"namespace"`
+	Name          string `json:"name"`
+	Port          int32  `json:"port"`
+	Reachable     bool   `json:"reachable"`
+	Error         string `json:"error,omitempty"`
+	LatencyMillis int64  `json:"latencyMillis,omitempty"`
+}
+
+// NodeProbeReportStatus contains the latest probe results of a node agent
+type NodeProbeReportStatus struct {
+	LastProbeTime metav1.Time          `json:"lastProbeTime,omitempty"`
+	Services      []ServiceProbeResult `json:"services,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+
+// NodeProbeReport is written by the node agent running on each node and
+// records whether labelled Services are reachable through that node's dataplane
+type NodeProbeReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NodeProbeReportSpec   `json:"spec,omitempty"`
+	Status NodeProbeReportStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NodeProbeReportList contains a list of NodeProbeReport
+type NodeProbeReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeProbeReport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeProbeReport{}, &NodeProbeReportList{})
+}
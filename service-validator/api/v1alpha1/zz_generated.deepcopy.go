@@ -0,0 +1,85 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeProbeReport) DeepCopyInto(out *NodeProbeReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy creates a new NodeProbeReport
+func (in *NodeProbeReport) DeepCopy() *NodeProbeReport {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeProbeReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NodeProbeReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeProbeReportList) DeepCopyInto(out *NodeProbeReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NodeProbeReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy creates a new NodeProbeReportList
+func (in *NodeProbeReportList) DeepCopy() *NodeProbeReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeProbeReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *NodeProbeReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *NodeProbeReportStatus) DeepCopyInto(out *NodeProbeReportStatus) {
+	*out = *in
+	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = make([]ServiceProbeResult, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy creates a new NodeProbeReportStatus
+func (in *NodeProbeReportStatus) DeepCopy() *NodeProbeReportStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeProbeReportStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"fmt"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// isEndpointReady reports whether an endpoint receives new traffic. Terminating
+// endpoints are never ready. An unset condition counts as ready.
+func isEndpointReady(endpoint discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
+
+// isEndpointServing reports whether an endpoint answers requests, even while
+// it is terminating. Clusters that don't set serving only report ready.
+func isEndpointServing(endpoint discoveryv1.Endpoint) bool {
+	if endpoint.Conditions.Serving != nil {
+		return *endpoint.Conditions.Serving
+	}
+	return isEndpointReady(endpoint)
+}
+
+// isEndpointTerminating reports whether an endpoint is being drained, e.g. the
+// old pods of a rollout
+func isEndpointTerminating(endpoint discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating
+}
+
+// endpointName identifies an endpoint in validation details by its target or address
+func endpointName(endpoint discoveryv1.Endpoint) string {
+	if endpoint.TargetRef != nil {
+		return endpoint.TargetRef.Name
+	}
+	if len(endpoint.Addresses) > 0 {
+		return endpoint.Addresses[0]
+	}
+	return "unknown"
+}
+
+// validateEndpointConditions checks that a Service has ready endpoints. While
+// the only serving endpoints are terminating, traffic is still answered by the
+// draining pods but nothing replaces them.
+func validateEndpointConditions(endpointSlices []discoveryv1.EndpointSlice) []string {
+	total, ready, terminatingServing := 0, 0, 0
+	for _, endpointSlice := range endpointSlices {
+		for _, endpoint := range endpointSlice.Endpoints {
+			total++
+			switch {
+			case isEndpointTerminating(endpoint):
+				if isEndpointServing(endpoint) {
+					terminatingServing++
+				}
+			case isEndpointReady(endpoint):
+				ready++
+			}
+		}
+	}
+
+	// Slices without endpoints are reported by the slice checks
+	if total == 0 || ready > 0 {
+		return nil
+	}
+	if terminatingServing > 0 {
+		return []string{fmt.Sprintf("no ready endpoints, only %d terminating endpoint(s) still serving", terminatingServing)}
+	}
+	return []string{"no ready endpoints"}
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/featuregate"
+
+const (
+	// NodeAgentReports includes NodeProbeReports written by node agents in validation
+	NodeAgentReports featuregate.Feature = "NodeAgentReports"
+	// CanaryPromotion labels Services that passed enough validation cycles in
+	// a row and removes the label after repeated failures
+	CanaryPromotion featuregate.Feature = "CanaryPromotion"
+	// ServiceAccountValidation flags Services whose backing pods run with the
+	// default, an unexpected or a missing ServiceAccount
+	ServiceAccountValidation featuregate.Feature = "ServiceAccountValidation"
+)
+
+// FeatureGates lists the features of this controller that can be toggled with --feature-gates
+var FeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	NodeAgentReports:         {Default: false, Stage: featuregate.Alpha},
+	CanaryPromotion:          {Default: false, Stage: featuregate.Alpha},
+	ServiceAccountValidation: {Default: false, Stage: featuregate.Alpha},
+}
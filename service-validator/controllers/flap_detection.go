@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// Window in which validation state transitions are counted
+	FlapWindow = time.Hour
+
+	// Default number of transitions per window above which a Service is flapping
+	DefaultFlapThreshold = 4
+
+	// Maximum number of transitions remembered per Service
+	MaxFlapHistory = 64
+
+	// Event reason for flapping Services
+	ServiceFlappingReason = "ServiceFlapping"
+)
+
+var (
+	validationTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_validator_state_transitions_total",
+		Help: "Number of valid/invalid validation state transitions per Service",
+	}, []string{"namespace", "service"})
+
+	serviceFlapping = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "service_validator_service_flapping",
+		Help: "Whether a Service is currently flapping between valid and invalid (1) or not (0)",
+	}, []string{"namespace", "service"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(validationTransitions, serviceFlapping)
+}
+
+// FlapDetector keeps a bounded in-memory history of validation state
+// transitions per Service. A Service flapping between valid and invalid
+// usually points at a readiness probe that is too aggressive.
+type FlapDetector struct {
+	// Threshold is the number of transitions within FlapWindow above which a Service is flapping
+	Threshold int
+
+	mutex    sync.Mutex
+	history  map[types.NamespacedName][]time.Time
+	flapping map[types.NamespacedName]bool
+}
+
+// RecordTransition records a state transition and returns the number of
+// transitions within the window and whether the Service started flapping
+func (d *FlapDetector) RecordTransition(key types.NamespacedName, now time.Time) (int, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.history == nil {
+		d.history = make(map[types.NamespacedName][]time.Time)
+		d.flapping = make(map[types.NamespacedName]bool)
+	}
+
+	transitions := append(d.recentTransitions(key, now), now)
+	if len(transitions) > MaxFlapHistory {
+		transitions = transitions[len(transitions)-MaxFlapHistory:]
+	}
+	d.history[key] = transitions
+
+	validationTransitions.WithLabelValues(key.Namespace, key.Name).Inc()
+
+	wasFlapping := d.flapping[key]
+	isFlapping := len(transitions) > d.threshold()
+	d.setFlapping(key, isFlapping)
+
+	return len(transitions), isFlapping && !wasFlapping
+}
+
+// Refresh expires old transitions and reports whether the Service is still flapping
+func (d *FlapDetector) Refresh(key types.NamespacedName, now time.Time) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.history == nil {
+		return false
+	}
+
+	transitions := d.recentTransitions(key, now)
+	if len(transitions) == 0 {
+		delete(d.history, key)
+	} else {
+		d.history[key] = transitions
+	}
+
+	isFlapping := len(transitions) > d.threshold()
+	d.setFlapping(key, isFlapping)
+	return isFlapping
+}
+
+// recentTransitions returns the transitions of a Service within the window. Callers must hold the mutex.
+func (d *FlapDetector) recentTransitions(key types.NamespacedName, now time.Time) []time.Time {
+	cutoff := now.Add(-FlapWindow)
+	var recent []time.Time
+	for _, t := range d.history[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// setFlapping updates the flapping state and metric of a Service. Callers must hold the mutex.
+func (d *FlapDetector) setFlapping(key types.NamespacedName, isFlapping bool) {
+	if isFlapping {
+		d.flapping[key] = true
+		serviceFlapping.WithLabelValues(key.Namespace, key.Name).Set(1)
+		return
+	}
+
+	if d.flapping[key] {
+		delete(d.flapping, key)
+		serviceFlapping.DeleteLabelValues(key.Namespace, key.Name)
+	}
+}
+
+func (d *FlapDetector) threshold() int {
+	if d.Threshold <= 0 {
+		return DefaultFlapThreshold
+	}
+	return d.Threshold
+}
+
+// trackValidationTransition records a valid/invalid transition of a Service and
+// creates a flapping event when the Service starts flapping
+func (r *ServiceValidatorReconciler) trackValidationTransition(ctx context.Context, service *corev1.Service, previousStatus string, result ValidationResult) error {
+	if r.FlapDetector == nil {
+		return nil
+	}
+
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	now := time.Now()
+
+	// The first validation of a Service is not a transition
+	if previousStatus == "" {
+		r.FlapDetector.Refresh(key, now)
+		return nil
+	}
+
+	count, startedFlapping := r.FlapDetector.RecordTransition(key, now)
+	if !startedFlapping {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Service is flapping between valid and invalid",
+		"service", service.Name,
+		"namespace", service.Namespace,
+		"transitions", count,
+		"window", FlapWindow)
+
+	return r.createFlappingEvent(ctx, service, count, result)
+}
+
+func (r *ServiceValidatorReconciler) createFlappingEvent(ctx context.Context, service *corev1.Service, count int, result ValidationResult) error {
+	log := log.FromContext(ctx)
+
+	// Check if event already exists to prevent duplicates
+	eventName := fmt.Sprintf("%s-flapping", service.Name)
+	existingEvent := &corev1.Event{}
+	if err := r.Get(ctx, client.ObjectKey{Name: eventName, Namespace: service.Namespace}, existingEvent); err == nil {
+		log.Info("Flapping event already exists, skipping creation",
+			"service", service.Name,
+			"namespace", service.Namespace,
+			"eventName", eventName)
+		return nil
+	}
+
+	message := fmt.Sprintf("Service %s changed between valid and invalid %d times within %s; check the readiness probes of its Pods",
+		service.Name, count, FlapWindow)
+	if !result.IsValid {
+		message = fmt.Sprintf("%s (last failure: %s)", message, result.Error())
+	}
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventName,
+			Namespace: service.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Service",
+			Name:            service.Name,
+			Namespace:       service.Namespace,
+			UID:             service.UID,
+			APIVersion:      service.APIVersion,
+			ResourceVersion: service.ResourceVersion,
+		},
+		Reason:         ServiceFlappingReason,
+		Message:        message,
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Count:          1,
+		Type:           "Warning",
+		Source: corev1.EventSource{
+			Component: "service-validator",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+const (
+	// Annotation selecting the probe protocol of a Service ("tcp" or "grpc")
+	ProbeProtocolAnnotation = "service-validator/protocol"
+
+	// Annotation with the service name sent in grpc.health.v1.Health/Check.
+	// Empty checks the overall health of the server.
+	GRPCServiceNameAnnotation = "service-validator/grpc-service-name"
+
+	// Probe protocols
+	ProbeProtocolTCP  = "tcp"
+	ProbeProtocolGRPC = "grpc"
+
+	// Default timeout for a single gRPC health check
+	DefaultGRPCProbeTimeout = 2 * time.Second
+)
+
+// isGRPCService reports whether a Service port should be probed with the gRPC health protocol
+func isGRPCService(service *corev1.Service, port *corev1.ServicePort) bool {
+	if strings.EqualFold(service.Annotations[ProbeProtocolAnnotation], ProbeProtocolGRPC) {
+		return true
+	}
+	return port != nil && port.AppProtocol != nil && strings.EqualFold(*port.AppProtocol, ProbeProtocolGRPC)
+}
+
+// grpcServiceName returns the health service name configured for a Service
+func grpcServiceName(service *corev1.Service) string {
+	return strings.TrimSpace(service.Annotations[GRPCServiceNameAnnotation])
+}
+
+// probeGRPCHealth calls grpc.health.v1.Health/Check on address and returns an
+// error unless the backend reports SERVING. A TCP connect alone is misleading
+// for gRPC backends that accept connections but aren't serving yet.
+func probeGRPCHealth(ctx context.Context, address, serviceName string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultGRPCProbeTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	defer conn.Close()
+
+	response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: serviceName})
+	if err != nil {
+		return fmt.Errorf("gRPC health check failed: %w", err)
+	}
+
+	if response.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("gRPC health status %s", response.GetStatus())
+	}
+	return nil
+}
+
+// validateGRPCEndpoints runs gRPC health checks against every ready endpoint of
+// a gRPC Service and returns details for every endpoint that isn't serving
+func (r *ServiceValidatorReconciler) validateGRPCEndpoints(ctx context.Context, service *corev1.Service, endpointSlices []discoveryv1.EndpointSlice) []string {
+	var details []string
+
+	serviceName := grpcServiceName(service)
+	for _, endpointSlice := range endpointSlices {
+		for _, slicePort := range endpointSlice.Ports {
+			if slicePort.Port == nil || !isGRPCSlicePort(service, &slicePort) {
+				continue
+			}
+
+			for _, endpoint := range endpointSlice.Endpoints {
+				// Not ready endpoints are already reported by the pod checks
+				if len(endpoint.Addresses) == 0 || !isEndpointReady(endpoint) {
+					continue
+				}
+
+				address := net.JoinHostPort(endpoint.Addresses[0], strconv.Itoa(int(*slicePort.Port)))
+				if err := probeGRPCHealth(ctx, address, serviceName, DefaultGRPCProbeTimeout); err != nil {
+					details = append(details, fmt.Sprintf("endpoint %s: %v", address, err))
+				}
+			}
+		}
+	}
+
+	return details
+}
+
+// isGRPCSlicePort reports whether an EndpointSlice port of a Service should be probed with gRPC
+func isGRPCSlicePort(service *corev1.Service, port *discoveryv1.EndpointPort) bool {
+	if strings.EqualFold(service.Annotations[ProbeProtocolAnnotation], ProbeProtocolGRPC) {
+		return true
+	}
+	return port.AppProtocol != nil && strings.EqualFold(*port.AppProtocol, ProbeProtocolGRPC)
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Manifest describes the permissions and webhook port of the service-validator
+// for the manifests subcommand. The NodeProbeReport CRD is added by main, which
+// embeds it.
+func Manifest() manifests.Manifest {
+	return manifests.Manifest{
+		Controller: "service-validator",
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"services", "pods", "events"}, Verbs: []string{"get", "list", "watch", "update", "patch", "create"}},
+			{APIGroups: []string{""}, Resources: []string{"namespaces", "configmaps", "serviceaccounts"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets", "daemonsets"}, Verbs: []string{"get", "list"}},
+			{APIGroups: []string{"discovery.k8s.io"}, Resources: []string{"endpointslices"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"networking.k8s.io"}, Resources: []string{"ingresses"}, Verbs: []string{"get", "list", "watch", "update"}},
+			{APIGroups: []string{"gateway.networking.k8s.io"}, Resources: []string{"httproutes"}, Verbs: []string{"get", "list", "watch", "update"}},
+			{APIGroups: []string{"servicevalidator.example.com"}, Resources: []string{"nodeprobereports"}, Verbs: []string{"get", "list", "watch", "create"}},
+			{APIGroups: []string{"servicevalidator.example.com"}, Resources: []string{"nodeprobereports/status"}, Verbs: []string{"update"}},
+		},
+		// Admission webhook of --enable-webhook
+		Ports: []corev1.ContainerPort{{Name: "webhook", ContainerPort: 9443, Protocol: corev1.ProtocolTCP}},
+	}
+}
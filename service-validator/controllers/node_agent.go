@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	validatorv1alpha1 "github.com/psrvere/k8s-controllers/service-validator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Default interval between two node agent probe rounds
+	DefaultAgentProbeInterval = 30 * time.Second
+
+	// Default timeout for a single TCP probe from a node agent
+	DefaultAgentProbeTimeout = 2 * time.Second
+
+	// Reports older than this are ignored by the validator
+	DefaultAgentReportMaxAge = 2 * time.Minute
+)
+
+// NodeAgent runs on every node (as a DaemonSet with hostNetwork) and probes
+// labelled Services through the node's own dataplane (kube-proxy/iptables).
+// Results are written to a NodeProbeReport named after the node.
+type NodeAgent struct {
+	client.Client
+	NodeName      string
+	ProbeInterval time.Duration
+	ProbeTimeout  time.Duration
+}
+
+// Start implements manager.Runnable
+func (a *NodeAgent) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("node-agent").WithValues("node", a.NodeName)
+
+	interval := a.ProbeInterval
+	if interval <= 0 {
+		interval = DefaultAgentProbeInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.probeAndReport(ctx); err != nil {
+			log.Error(err, "Failed to report probe results")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every node
+// agent must probe, so agents never wait for leadership.
+func (a *NodeAgent) NeedLeaderElection() bool {
+	return false
+}
+
+func (a *NodeAgent) probeAndReport(ctx context.Context) error {
+	log := log.FromContext(ctx)
+
+	serviceList := &corev1.ServiceList{}
+	if err := a.List(ctx, serviceList, client.HasLabels{ValidationLabel}); err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+
+	var results []validatorv1alpha1.ServiceProbeResult
+	for _, service := range serviceList.Items {
+		results = append(results, a.probeService(ctx, &service)...)
+	}
+
+	if err := a.writeReport(ctx, results); err != nil {
+		return err
+	}
+
+	log.Info("Reported node probe results", "node", a.NodeName, "services", len(serviceList.Items), "probes", len(results))
+	return nil
+}
+
+func (a *NodeAgent) probeService(ctx context.Context, service *corev1.Service) []validatorv1alpha1.ServiceProbeResult {
+	var results []validatorv1alpha1.ServiceProbeResult
+
+	// Headless services are not programmed by kube-proxy
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == corev1.ClusterIPNone {
+		return nil
+	}
+
+	timeout := a.ProbeTimeout
+	if timeout <= 0 {
+		timeout = DefaultAgentProbeTimeout
+	}
+
+	for _, port := range service.Spec.Ports {
+		// Only TCP can be probed with a plain connect
+		if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+
+		result := validatorv1alpha1.ServiceProbeResult{
+			Namespace: service.Namespace,
+			Name:      service.Name,
+			Port:      port.Port,
+		}
+
+		address := net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(port.Port)))
+		start := time.Now()
+		if isGRPCService(service, &port) {
+			// gRPC backends can accept connections without serving
+			err := probeGRPCHealth(ctx, address, grpcServiceName(service), timeout)
+			result.LatencyMillis = time.Since(start).Milliseconds()
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Reachable = true
+			}
+		} else {
+			conn, err := net.DialTimeout("tcp", address, timeout)
+			result.LatencyMillis = time.Since(start).Milliseconds()
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Reachable = true
+				conn.Close()
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (a *NodeAgent) writeReport(ctx context.Context, results []validatorv1alpha1.ServiceProbeResult) error {
+	report := &validatorv1alpha1.NodeProbeReport{}
+	err := a.Get(ctx, client.ObjectKey{Name: a.NodeName}, report)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get node probe report: %w", err)
+		}
+
+		report = &validatorv1alpha1.NodeProbeReport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: a.NodeName,
+			},
+			Spec: validatorv1alpha1.NodeProbeReportSpec{
+				NodeName: a.NodeName,
+			},
+		}
+		if err := a.Create(ctx, report); err != nil {
+			return fmt.Errorf("failed to create node probe report: %w", err)
+		}
+	}
+
+	report.Status.LastProbeTime = metav1.Now()
+	report.Status.Services = results
+	if err := a.Status().Update(ctx, report); err != nil {
+		return fmt.Errorf("failed to update node probe report status: %w", err)
+	}
+	return nil
+}
+
+// validateAgentReports checks the latest node agent reports for this service
+// and returns details for every node that could not reach it
+func (r *ServiceValidatorReconciler) validateAgentReports(ctx context.Context, service *corev1.Service) []string {
+	var details []string
+
+	reportList := &validatorv1alpha1.NodeProbeReportList{}
+	if err := r.List(ctx, reportList); err != nil {
+		return []string{fmt.Sprintf("failed to list node probe reports: %v", err)}
+	}
+
+	maxAge := r.AgentReportMaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultAgentReportMaxAge
+	}
+	maxAge = r.Config.Duration(SettingAgentReportMaxAge, maxAge)
+
+	for _, report := range reportList.Items {
+		// Ignore stale reports from agents that stopped reporting
+		if time.Since(report.Status.LastProbeTime.Time) > maxAge {
+			continue
+		}
+
+		for _, result := range report.Status.Services {
+			if result.Namespace != service.Namespace || result.Name != service.Name || result.Reachable {
+				continue
+			}
+			details = append(details, fmt.Sprintf("node %s cannot reach service port %d: %s",
+				report.Spec.NodeName, result.Port, result.Error))
+		}
+	}
+
+	return details
+}
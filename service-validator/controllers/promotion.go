@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Label set on Services that passed enough validation cycles in a row.
+	// External routers and DNS controllers select on it.
+	PromotedLabel = "service-validator/validated"
+
+	// Default number of consecutive passed cycles before a Service is
+	// promoted, and of consecutive failed cycles before it is demoted
+	DefaultPromotionThreshold = 3
+	DefaultDemotionThreshold  = 2
+
+	// Interval between two validation cycles of a Service
+	ValidationInterval = 30 * time.Second
+
+	// Event reasons for promotions and demotions
+	ServicePromotedReason = "ServicePromoted"
+	ServiceDemotedReason  = "ServiceDemoted"
+)
+
+// PromotionTracker counts the consecutive passed and failed validation cycles
+// per Service in memory. Only the periodic validation counts as a cycle,
+// reconciles triggered by Service updates in between don't, so a burst of
+// updates can't promote a Service early. The streaks start over after a
+// restart, promoted Services keep their label.
+type PromotionTracker struct {
+	// PromotionThreshold is the number of passed cycles in a row before a Service is promoted
+	PromotionThreshold int
+	// DemotionThreshold is the number of failed cycles in a row before a Service is demoted
+	DemotionThreshold int
+
+	mutex   sync.Mutex
+	streaks map[types.NamespacedName]*promotionStreak
+}
+
+type promotionStreak struct {
+	passed    int
+	failed    int
+	lastCycle time.Time
+}
+
+// Record counts a validation result and returns the length of the current
+// streak of passes or failures, and false when the result came too soon
+// after the previous cycle to count
+func (t *PromotionTracker) Record(key types.NamespacedName, valid bool, now time.Time) (int, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.streaks == nil {
+		t.streaks = make(map[types.NamespacedName]*promotionStreak)
+	}
+	streak, exists := t.streaks[key]
+	if !exists {
+		streak = &promotionStreak{}
+		t.streaks[key] = streak
+	}
+	if !streak.lastCycle.IsZero() && now.Sub(streak.lastCycle) < ValidationInterval {
+		if valid {
+			return streak.passed, false
+		}
+		return streak.failed, false
+	}
+	streak.lastCycle = now
+
+	if valid {
+		streak.passed++
+		streak.failed = 0
+		return streak.passed, true
+	}
+	streak.failed++
+	streak.passed = 0
+	return streak.failed, true
+}
+
+// Forget drops the streaks of a Service that is no longer validated
+func (t *PromotionTracker) Forget(key types.NamespacedName) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.streaks, key)
+}
+
+// promoteServices reports whether the CanaryPromotion feature is enabled
+func (r *ServiceValidatorReconciler) promoteServices() bool {
+	return r.Promotion != nil && r.Config.FeatureEnabled(CanaryPromotion, r.PromoteServices)
+}
+
+// updatePromotion promotes a Service after enough passed validation cycles in
+// a row and demotes it after enough failed ones
+func (r *ServiceValidatorReconciler) updatePromotion(ctx context.Context, service *corev1.Service, result ValidationResult) error {
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	streak, counted := r.Promotion.Record(key, result.IsValid, time.Now())
+	if !counted {
+		return nil
+	}
+
+	promoted := isPromoted(service)
+	switch {
+	case result.IsValid && !promoted:
+		threshold := r.Config.Int(SettingPromotionThreshold, r.Promotion.promotionThreshold())
+		if streak < threshold {
+			return nil
+		}
+		message := fmt.Sprintf("Service %s passed %d validation cycles in a row and is labelled %s=true", service.Name, streak, PromotedLabel)
+		return r.setPromoted(ctx, service, true, ServicePromotedReason, message, "Normal")
+	case !result.IsValid && promoted:
+		threshold := r.Config.Int(SettingDemotionThreshold, r.Promotion.demotionThreshold())
+		if streak < threshold {
+			return nil
+		}
+		message := fmt.Sprintf("Service %s failed %d validation cycles in a row and lost the %s label: %s", service.Name, streak, PromotedLabel, result.Error())
+		return r.setPromoted(ctx, service, false, ServiceDemotedReason, message, "Warning")
+	}
+	return nil
+}
+
+// demoteUnvalidatedService removes the promotion label from a Service whose
+// validation label was removed, routers must not keep trusting it
+func (r *ServiceValidatorReconciler) demoteUnvalidatedService(ctx context.Context, service *corev1.Service) error {
+	r.Promotion.Forget(types.NamespacedName{Namespace: service.Namespace, Name: service.Name})
+	if !isPromoted(service) {
+		return nil
+	}
+	message := fmt.Sprintf("Service %s is no longer validated and lost the %s label", service.Name, PromotedLabel)
+	return r.setPromoted(ctx, service, false, ServiceDemotedReason, message, "Warning")
+}
+
+func (r *ServiceValidatorReconciler) setPromoted(ctx context.Context, service *corev1.Service, promoted bool, reason, message, eventType string) error {
+	// The status update earlier in this reconcile already changed the
+	// Service, a merge patch only touches the promotion label
+	patch := client.MergeFrom(service)
+	serviceCopy := service.DeepCopy()
+	if promoted {
+		if serviceCopy.Labels == nil {
+			serviceCopy.Labels = make(map[string]string)
+		}
+		serviceCopy.Labels[PromotedLabel] = "true"
+	} else {
+		delete(serviceCopy.Labels, PromotedLabel)
+	}
+	if err := r.Patch(ctx, serviceCopy, patch); err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Info("Changed Service promotion",
+		"service", service.Name,
+		"namespace", service.Namespace,
+		"promoted", promoted)
+	return r.createPromotionEvent(ctx, service, reason, message, eventType)
+}
+
+func (r *ServiceValidatorReconciler) createPromotionEvent(ctx context.Context, service *corev1.Service, reason, message, eventType string) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", service.Name, now.UnixNano()),
+			Namespace: service.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Service",
+			Name:            service.Name,
+			Namespace:       service.Namespace,
+			UID:             service.UID,
+			APIVersion:      service.APIVersion,
+			ResourceVersion: service.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: "service-validator",
+		},
+	}
+	return r.Create(ctx, event)
+}
+
+func isPromoted(service *corev1.Service) bool {
+	return service.Labels[PromotedLabel] == "true"
+}
+
+func (t *PromotionTracker) promotionThreshold() int {
+	if t.PromotionThreshold <= 0 {
+		return DefaultPromotionThreshold
+	}
+	return t.PromotionThreshold
+}
+
+func (t *PromotionTracker) demotionThreshold() int {
+	if t.DemotionThreshold <= 0 {
+		return DefaultDemotionThreshold
+	}
+	return t.DemotionThreshold
+}
@@ -0,0 +1,460 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Route kinds whose backends can be validated
+	RouteKindIngress   = "Ingress"
+	RouteKindHTTPRoute = "HTTPRoute"
+
+	// Annotations with the result of validating the backends of a route
+	RoutingStatusAnnotation = "service-validator/routing-status"
+	RoutingIssuesAnnotation = "service-validator/routing-issues"
+
+	// Event reasons for routing state changes
+	RoutingValidReason   = "RoutingValid"
+	RoutingInvalidReason = "RoutingInvalid"
+
+	// Interval routes are validated at without Service or EndpointSlice changes
+	RouteValidationInterval = 5 * time.Minute
+)
+
+// HTTPRouteGVK is the Gateway API HTTPRoute. It is read as unstructured, so the
+// controller doesn't depend on the Gateway API module.
+var HTTPRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: RouteKindHTTPRoute}
+
+// RouteValidatorReconciler validates the wiring of Ingresses or Gateway API
+// HTTPRoutes with the validation label to their backend Services: the Service
+// exists, exposes the referenced port and has ready endpoints for it. The
+// result is annotated on the route.
+type RouteValidatorReconciler struct {
+	client.Client
+	Backoff *throttle.AdaptiveBackoff
+
+	// Kind is the route kind, RouteKindIngress or RouteKindHTTPRoute
+	Kind string
+	// Namespaces skips objects in namespaces opted out with the ignore label
+	Namespaces *predicates.NamespaceFilter
+}
+
+// routeBackend is a Service port a route sends traffic to
+type routeBackend struct {
+	// Source describes where the route references the backend
+	Source    string
+	Namespace string
+	Service   string
+	// Port is a port number or name of the Service
+	Port intstr.IntOrString
+}
+
+func (b routeBackend) key() string {
+	return fmt.Sprintf("%s/%s:%s", b.Namespace, b.Service, b.Port.String())
+}
+
+func (r *RouteValidatorReconciler) newRoute() client.Object {
+	if r.Kind == RouteKindHTTPRoute {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(HTTPRouteGVK)
+		return route
+	}
+	return &networkingv1.Ingress{}
+}
+
+func (r *RouteValidatorReconciler) newRouteList() client.ObjectList {
+	if r.Kind == RouteKindHTTPRoute {
+		routes := &unstructured.UnstructuredList{}
+		routes.SetGroupVersionKind(HTTPRouteGVK.GroupVersion().WithKind(RouteKindHTTPRoute + "List"))
+		return routes
+	}
+	return &networkingv1.IngressList{}
+}
+
+func (r *RouteValidatorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// Skip namespaces opted out of all controllers
+	if r.Namespaces.Ignored(ctx, req.Namespace) {
+		return ctrl.Result{}, nil
+	}
+
+	route := r.newRoute()
+	if err := r.Get(ctx, req.NamespacedName, route); err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Route not found. Skipping reconciliation", "kind", r.Kind, "route", req.Name, "namespace", req.Namespace)
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get route", "kind", r.Kind, "route", req.Name, "namespace", req.Namespace)
+		return ctrl.Result{}, err
+	}
+
+	if _, exists := route.GetLabels()[ValidationLabel]; !exists {
+		return ctrl.Result{}, nil
+	}
+
+	issues, err := r.validateRoute(ctx, route)
+	if err != nil {
+		log.Error(err, "Failed to validate route backends", "kind", r.Kind, "route", route.GetName(), "namespace", route.GetNamespace())
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+
+	updated, err := r.updateRoutingStatus(ctx, route, issues)
+	if err != nil {
+		log.Error(err, "Failed to update routing status", "kind", r.Kind, "route", route.GetName(), "namespace", route.GetNamespace())
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+	}
+	if updated {
+		log.Info("Routing status changed", "kind", r.Kind, "route", route.GetName(), "namespace", route.GetNamespace(), "issues", issues)
+	}
+
+	return ctrl.Result{RequeueAfter: r.Backoff.Requeue(RouteValidationInterval)}, nil
+}
+
+// validateRoute checks every distinct backend of a route and returns the issues
+func (r *RouteValidatorReconciler) validateRoute(ctx context.Context, route client.Object) ([]string, error) {
+	backends, err := r.routeBackends(route)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+
+	var issues []string
+	checked := make(map[string]bool)
+	for _, backend := range backends {
+		if checked[backend.key()] {
+			continue
+		}
+		checked[backend.key()] = true
+
+		issue, err := r.checkBackend(ctx, backend)
+		if err != nil {
+			return nil, err
+		}
+		if issue != "" {
+			issues = append(issues, fmt.Sprintf("%s: %s", backend.Source, issue))
+		}
+	}
+	return issues, nil
+}
+
+// checkBackend returns why traffic to a backend can't be served, or an empty string
+func (r *RouteValidatorReconciler) checkBackend(ctx context.Context, backend routeBackend) (string, error) {
+	service := &corev1.Service{}
+	if err := r.Get(ctx, client.ObjectKey{Name: backend.Service, Namespace: backend.Namespace}, service); err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("Service %s/%s not found", backend.Namespace, backend.Service), nil
+		}
+		return "", err
+	}
+
+	servicePort := findServicePort(service, backend.Port)
+	if servicePort == nil {
+		return fmt.Sprintf("Service %s/%s has no port %s", backend.Namespace, backend.Service, backend.Port.String()), nil
+	}
+
+	// ExternalName Services have no endpoints
+	if service.Spec.Type == corev1.ServiceTypeExternalName {
+		return "", nil
+	}
+
+	endpointSlices := &discoveryv1.EndpointSliceList{}
+	if err := r.List(ctx, endpointSlices, client.MatchingLabels{
+		discoveryv1.LabelServiceName: service.Name,
+	}, client.InNamespace(service.Namespace)); err != nil {
+		return "", err
+	}
+	if countReadyEndpoints(endpointSlices.Items, servicePort.Name) == 0 {
+		return fmt.Sprintf("Service %s/%s has no ready endpoints for port %s", backend.Namespace, backend.Service, backend.Port.String()), nil
+	}
+	return "", nil
+}
+
+// findServicePort returns the Service port with the given number or name
+func findServicePort(service *corev1.Service, port intstr.IntOrString) *corev1.ServicePort {
+	for i := range service.Spec.Ports {
+		servicePort := &service.Spec.Ports[i]
+		if port.Type == intstr.String && servicePort.Name == port.StrVal {
+			return servicePort
+		}
+		if port.Type == intstr.Int && servicePort.Port == port.IntVal {
+			return servicePort
+		}
+	}
+	return nil
+}
+
+// countReadyEndpoints counts the ready endpoints of slices serving a Service
+// port, EndpointSlice ports are named after the Service port
+func countReadyEndpoints(endpointSlices []discoveryv1.EndpointSlice, portName string) int {
+	ready := 0
+	for _, endpointSlice := range endpointSlices {
+		servesPort := false
+		for _, port := range endpointSlice.Ports {
+			if port.Name != nil && *port.Name == portName {
+				servesPort = true
+				break
+			}
+		}
+		if !servesPort {
+			continue
+		}
+		for _, endpoint := range endpointSlice.Endpoints {
+			if isEndpointReady(endpoint) {
+				ready++
+			}
+		}
+	}
+	return ready
+}
+
+// routeBackends returns the Service backends of a route
+func (r *RouteValidatorReconciler) routeBackends(route client.Object) ([]routeBackend, error) {
+	switch route := route.(type) {
+	case *networkingv1.Ingress:
+		return ingressBackends(route), nil
+	case *unstructured.Unstructured:
+		return httpRouteBackends(route)
+	}
+	return nil, fmt.Errorf("unsupported route type %T", route)
+}
+
+// ingressBackends returns the Service backends of the default backend and
+// every rule path. Resource backends are skipped.
+func ingressBackends(ingress *networkingv1.Ingress) []routeBackend {
+	var backends []routeBackend
+	add := func(source string, backend networkingv1.IngressBackend) {
+		if backend.Service == nil {
+			return
+		}
+		port := intstr.FromInt32(backend.Service.Port.Number)
+		if backend.Service.Port.Name != "" {
+			port = intstr.FromString(backend.Service.Port.Name)
+		}
+		backends = append(backends, routeBackend{
+			Source:    source,
+			Namespace: ingress.Namespace,
+			Service:   backend.Service.Name,
+			Port:      port,
+		})
+	}
+
+	if ingress.Spec.DefaultBackend != nil {
+		add("default backend", *ingress.Spec.DefaultBackend)
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		for _, path := range rule.HTTP.Paths {
+			add(fmt.Sprintf("rule %s%s", host, path.Path), path.Backend)
+		}
+	}
+	return backends
+}
+
+// httpRouteBackends returns the Service backendRefs of every rule. Refs to
+// other kinds are skipped, a missing namespace is the route's namespace.
+func httpRouteBackends(route *unstructured.Unstructured) ([]routeBackend, error) {
+	rules, _, err := unstructured.NestedSlice(route.Object, "spec", "rules")
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTPRoute rules: %w", err)
+	}
+
+	var backends []routeBackend
+	for i, rule := range rules {
+		ruleFields, _ := rule.(map[string]interface{})
+		refs, _, err := unstructured.NestedSlice(ruleFields, "backendRefs")
+		if err != nil {
+			return nil, fmt.Errorf("invalid backendRefs of HTTPRoute rule %d: %w", i, err)
+		}
+		for j, ref := range refs {
+			refFields, _ := ref.(map[string]interface{})
+			group, _, _ := unstructured.NestedString(refFields, "group")
+			kind, _, _ := unstructured.NestedString(refFields, "kind")
+			if group != "" || (kind != "" && kind != "Service") {
+				continue
+			}
+
+			name, _, _ := unstructured.NestedString(refFields, "name")
+			namespace, _, _ := unstructured.NestedString(refFields, "namespace")
+			if namespace == "" {
+				namespace = route.GetNamespace()
+			}
+			port, found, _ := unstructured.NestedInt64(refFields, "port")
+			source := fmt.Sprintf("rule %d backendRef %d", i, j)
+			if !found {
+				return nil, fmt.Errorf("%s: port is required for Service backends", source)
+			}
+			backends = append(backends, routeBackend{
+				Source:    source,
+				Namespace: namespace,
+				Service:   name,
+				Port:      intstr.FromInt32(int32(port)),
+			})
+		}
+	}
+	return backends, nil
+}
+
+// updateRoutingStatus annotates the route with the validation result and
+// records an event when the status or the issues change. It returns false
+// when the annotations were already up to date.
+func (r *RouteValidatorReconciler) updateRoutingStatus(ctx context.Context, route client.Object, issues []string) (bool, error) {
+	status := StatusValid
+	if len(issues) > 0 {
+		status = StatusInvalid
+	}
+	message := strings.Join(issues, "; ")
+
+	annotations := route.GetAnnotations()
+	if annotations[RoutingStatusAnnotation] == status && annotations[RoutingIssuesAnnotation] == message {
+		return false, nil
+	}
+
+	routeCopy := route.DeepCopyObject().(client.Object)
+	annotations = routeCopy.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[RoutingStatusAnnotation] = status
+	if message != "" {
+		annotations[RoutingIssuesAnnotation] = message
+	} else {
+		delete(annotations, RoutingIssuesAnnotation)
+	}
+	routeCopy.SetAnnotations(annotations)
+
+	if err := r.Update(ctx, routeCopy); err != nil {
+		return false, err
+	}
+
+	reason, eventType := RoutingInvalidReason, corev1.EventTypeWarning
+	eventMessage := fmt.Sprintf("%s %s has broken backends: %s", r.Kind, route.GetName(), message)
+	if status == StatusValid {
+		reason, eventType = RoutingValidReason, corev1.EventTypeNormal
+		eventMessage = fmt.Sprintf("All backends of %s %s are wired and have ready endpoints", r.Kind, route.GetName())
+	}
+	if err := r.createRouteEvent(ctx, route, reason, eventMessage, eventType); err != nil {
+		// Don't fail the reconcile for event creation failure
+		log.FromContext(ctx).Error(err, "Failed to create routing event", "kind", r.Kind, "route", route.GetName())
+	}
+	return true, nil
+}
+
+// createRouteEvent records an event on a route. It is only called on changes,
+// so each one gets its own event.
+func (r *RouteValidatorReconciler) createRouteEvent(ctx context.Context, route client.Object, reason, message, eventType string) error {
+	apiVersion := networkingv1.SchemeGroupVersion.String()
+	if r.Kind == RouteKindHTTPRoute {
+		apiVersion = HTTPRouteGVK.GroupVersion().String()
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", route.GetName(), now.UnixNano()),
+			Namespace: route.GetNamespace(),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            r.Kind,
+			Name:            route.GetName(),
+			Namespace:       route.GetNamespace(),
+			UID:             route.GetUID(),
+			APIVersion:      apiVersion,
+			ResourceVersion: route.GetResourceVersion(),
+		},
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: "service-validator",
+		},
+	}
+
+	return r.Create(ctx, event)
+}
+
+// routesForBackend maps a Service or EndpointSlice to the labelled routes
+// using the Service as a backend, so broken wiring is noticed right away
+func (r *RouteValidatorReconciler) routesForBackend(ctx context.Context, obj client.Object) []reconcile.Request {
+	serviceName := obj.GetName()
+	if _, ok := obj.(*discoveryv1.EndpointSlice); ok {
+		serviceName = obj.GetLabels()[discoveryv1.LabelServiceName]
+	}
+	if serviceName == "" {
+		return nil
+	}
+
+	// HTTPRoutes can reference Services in other namespaces
+	routes := r.newRouteList()
+	options := []client.ListOption{client.HasLabels{ValidationLabel}}
+	if r.Kind == RouteKindIngress {
+		options = append(options, client.InNamespace(obj.GetNamespace()))
+	}
+	if err := r.List(ctx, routes, options...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list routes", "kind", r.Kind)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	addRequest := func(route client.Object) {
+		backends, err := r.routeBackends(route)
+		if err != nil {
+			return
+		}
+		for _, backend := range backends {
+			if backend.Namespace == obj.GetNamespace() && backend.Service == serviceName {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(route)})
+				return
+			}
+		}
+	}
+	switch routes := routes.(type) {
+	case *networkingv1.IngressList:
+		for i := range routes.Items {
+			addRequest(&routes.Items[i])
+		}
+	case *unstructured.UnstructuredList:
+		for i := range routes.Items {
+			addRequest(&routes.Items[i])
+		}
+	}
+	return requests
+}
+
+func (r *RouteValidatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(strings.ToLower(r.Kind)).
+		For(r.newRoute()).
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.routesForBackend)).
+		Watches(&discoveryv1.EndpointSlice{}, handler.EnqueueRequestsFromMapFunc(r.routesForBackend)).
+		WithEventFilter(r.Namespaces.Predicate()).
+		Complete(recovery.Wrap(strings.ToLower(r.Kind), r))
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Key of the rule set in the rules ConfigMap
+	RulesKey = "rules.yaml"
+
+	// Maximum CEL cost of a single rule evaluation, guards against rules
+	// that iterate over large lists in nested loops
+	MaxRuleCost = 1000000
+)
+
+// ValidationRule is a custom check written as a CEL expression. The expression
+// must evaluate to true for a valid Service and can use the variables
+// service, endpointSlices and pods (the pods targeted by the endpoints).
+type ValidationRule struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	// Message is reported when the rule fails, defaults to the expression
+	Message string `json:"message,omitempty"`
+	// ServiceSelector limits the rule to Services with matching labels
+	ServiceSelector *metav1.LabelSelector `json:"serviceSelector,omitempty"`
+}
+
+// RuleSet is the content of the rules ConfigMap
+type RuleSet struct {
+	Rules []ValidationRule `json:"rules"`
+}
+
+type compiledRule struct {
+	ValidationRule
+	selector labels.Selector
+	program  cel.Program
+}
+
+// RuleEngine evaluates the ValidationRules of a ConfigMap against Services.
+// The rules are compiled again whenever the ConfigMap changes, so checks can
+// be added without restarting the controller.
+type RuleEngine struct {
+	Client    client.Reader
+	ConfigMap types.NamespacedName
+
+	mutex           sync.Mutex
+	env             *cel.Env
+	resourceVersion string
+	rules           []compiledRule
+}
+
+// rulesEnv declares the variables available to rule expressions
+func rulesEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("service", cel.DynType),
+		cel.Variable("endpointSlices", cel.ListType(cel.DynType)),
+		cel.Variable("pods", cel.ListType(cel.DynType)),
+		ext.Strings(),
+	)
+}
+
+// loadRules returns the compiled rules of the current ConfigMap version.
+// Rules that don't compile are logged and skipped.
+func (e *RuleEngine) loadRules(ctx context.Context) ([]compiledRule, error) {
+	log := log.FromContext(ctx)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	configMap := &corev1.ConfigMap{}
+	if err := e.Client.Get(ctx, e.ConfigMap, configMap); err != nil {
+		if errors.IsNotFound(err) {
+			e.resourceVersion, e.rules = "", nil
+			return nil, nil
+		}
+		return nil, err
+	}
+	if configMap.ResourceVersion == e.resourceVersion {
+		return e.rules, nil
+	}
+
+	if e.env == nil {
+		env, err := rulesEnv()
+		if err != nil {
+			return nil, err
+		}
+		e.env = env
+	}
+
+	ruleSet := RuleSet{}
+	if err := yaml.UnmarshalStrict([]byte(configMap.Data[RulesKey]), &ruleSet); err != nil {
+		return nil, fmt.Errorf("invalid rules in ConfigMap %s: %w", e.ConfigMap, err)
+	}
+
+	var rules []compiledRule
+	for _, rule := range ruleSet.Rules {
+		compiled, err := e.compile(rule)
+		if err != nil {
+			log.Error(err, "Skipping invalid validation rule", "rule", rule.Name, "configMap", e.ConfigMap)
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+
+	log.Info("Loaded validation rules", "configMap", e.ConfigMap, "rules", len(rules))
+	e.resourceVersion, e.rules = configMap.ResourceVersion, rules
+	return rules, nil
+}
+
+func (e *RuleEngine) compile(rule ValidationRule) (compiledRule, error) {
+	compiled := compiledRule{ValidationRule: rule, selector: labels.Everything()}
+	if rule.Name == "" {
+		return compiled, fmt.Errorf("rule has no name")
+	}
+
+	if rule.ServiceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(rule.ServiceSelector)
+		if err != nil {
+			return compiled, fmt.Errorf("invalid serviceSelector: %w", err)
+		}
+		compiled.selector = selector
+	}
+
+	ast, issues := e.env.Compile(rule.Expression)
+	if issues != nil && issues.Err() != nil {
+		return compiled, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return compiled, fmt.Errorf("expression must evaluate to a bool, not %s", ast.OutputType())
+	}
+
+	program, err := e.env.Program(ast, cel.CostLimit(MaxRuleCost))
+	if err != nil {
+		return compiled, err
+	}
+	compiled.program = program
+	return compiled, nil
+}
+
+// Evaluate runs every rule that selects the Service and returns a detail for
+// each failed rule
+func (e *RuleEngine) Evaluate(ctx context.Context, service *corev1.Service, slices []discoveryv1.EndpointSlice, pods []corev1.Pod) []string {
+	rules, err := e.loadRules(ctx)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to load validation rules: %v", err)}
+	}
+
+	var selected []compiledRule
+	for _, rule := range rules {
+		if rule.selector.Matches(labels.Set(service.Labels)) {
+			selected = append(selected, rule)
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	activation, err := ruleActivation(service, slices, pods)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to prepare validation rules: %v", err)}
+	}
+
+	var details []string
+	for _, rule := range selected {
+		out, _, err := rule.program.Eval(activation)
+		if err != nil {
+			details = append(details, fmt.Sprintf("rule %s could not be evaluated: %v", rule.Name, err))
+			continue
+		}
+		if passed, ok := out.Value().(bool); !ok {
+			details = append(details, fmt.Sprintf("rule %s evaluated to %v, not a bool", rule.Name, out.Value()))
+		} else if !passed {
+			message := rule.Message
+			if message == "" {
+				message = rule.Expression
+			}
+			details = append(details, fmt.Sprintf("rule %s failed: %s", rule.Name, message))
+		}
+	}
+	return details
+}
+
+// ruleActivation converts the objects to the plain maps rule expressions see,
+// with the same field names as in their YAML
+func ruleActivation(service *corev1.Service, slices []discoveryv1.EndpointSlice, pods []corev1.Pod) (map[string]interface{}, error) {
+	serviceMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
+	if err != nil {
+		return nil, err
+	}
+
+	sliceMaps := make([]interface{}, 0, len(slices))
+	for i := range slices {
+		sliceMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&slices[i])
+		if err != nil {
+			return nil, err
+		}
+		sliceMaps = append(sliceMaps, sliceMap)
+	}
+
+	podMaps := make([]interface{}, 0, len(pods))
+	for i := range pods {
+		podMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pods[i])
+		if err != nil {
+			return nil, err
+		}
+		podMaps = append(podMaps, podMap)
+	}
+
+	return map[string]interface{}{
+		"service":        serviceMap,
+		"endpointSlices": sliceMaps,
+		"pods":           podMaps,
+	}, nil
+}
+
+// getEndpointPods returns the pods targeted by the endpoints of the slices.
+// Pods that no longer exist are left out.
+func (r *ServiceValidatorReconciler) getEndpointPods(ctx context.Context, slices []discoveryv1.EndpointSlice) []corev1.Pod {
+	var pods []corev1.Pod
+	seen := make(map[types.NamespacedName]bool)
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" {
+				continue
+			}
+			key := types.NamespacedName{Name: endpoint.TargetRef.Name, Namespace: endpoint.TargetRef.Namespace}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			pod := &corev1.Pod{}
+			if err := r.Get(ctx, key, pod); err != nil {
+				continue
+			}
+			pods = append(pods, *pod)
+		}
+	}
+	return pods
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SelfTest creates a service without backing pods and waits until it has been
+// validated. The service is expected to be reported invalid.
+func SelfTest() selftest.Test {
+	return selftest.Test{
+		Controller: "service-validator",
+		Reconciler: "service",
+		Setup: func(ctx context.Context, env *selftest.Env) error {
+			return env.Create(ctx, &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      env.Name,
+					Namespace: env.Namespace,
+					Labels:    map[string]string{ValidationLabel: "true"},
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": env.Name},
+					Ports:    []corev1.ServicePort{{Name: "http", Port: 80}},
+				},
+			})
+		},
+		Verify: func(ctx context.Context, env *selftest.Env) error {
+			service := &corev1.Service{}
+			if err := env.Client.Get(ctx, client.ObjectKey{Name: env.Name, Namespace: env.Namespace}, service); err != nil {
+				return err
+			}
+			if status := service.Annotations[ValidationStatusAnnotation]; status != StatusInvalid {
+				return fmt.Errorf("service %s has validation status %q, want %q", service.Name, status, StatusInvalid)
+			}
+			return nil
+		},
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/recovery"
+	"github.com/psrvere/k8s-controllers/common/throttle"
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -21,7 +25,27 @@ import (
 
 type ServiceValidatorReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme  *runtime.Scheme
+	Backoff *throttle.AdaptiveBackoff
+
+	// EnableAgentReports includes NodeProbeReports from node agents in validation
+	EnableAgentReports bool
+	// AgentReportMaxAge is the age after which a node agent report is ignored
+	AgentReportMaxAge time.Duration
+	// FlapDetector tracks validation state transitions to detect flapping Services
+	FlapDetector *FlapDetector
+	// Namespaces skips objects in namespaces opted out with the ignore label
+	Namespaces *predicates.NamespaceFilter
+	// Rules evaluates user-defined CEL validation rules, nil disables them
+	Rules *RuleEngine
+	// Config overrides the report max age and feature gates at runtime. Nil keeps the startup configuration.
+	Config *controllerconfig.Config
+	// Promotion counts consecutive validation cycles for the promotion label
+	Promotion *PromotionTracker
+	// PromoteServices labels Services that passed enough validation cycles in a row
+	PromoteServices bool
+	// ValidateServiceAccounts checks the ServiceAccounts of the backing pods
+	ValidateServiceAccounts bool
 }
 
 const (
@@ -71,6 +95,11 @@ func NewValidationResult(isValid bool, serviceName, reason string, details ...st
 func (r *ServiceValidatorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
+	// Skip namespaces opted out of all controllers
+	if r.Namespaces.Ignored(ctx, req.Namespace) {
+		return ctrl.Result{}, nil
+	}
+
 	// Fetch the Service
 	service := &corev1.Service{}
 	err := r.Get(ctx, req.NamespacedName, service)
@@ -78,6 +107,9 @@ func (r *ServiceValidatorReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		if errors.IsNotFound(err) {
 			// Service not found, probably deleted
 			log.Info("Service not found. Skipping reconciliation", "service", req.Name, "namespace", req.Namespace)
+			if r.Promotion != nil {
+				r.Promotion.Forget(req.NamespacedName)
+			}
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object
@@ -87,6 +119,12 @@ func (r *ServiceValidatorReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 	// Check if this Service should be validated
 	if !shouldValidateService(service) {
+		if r.promoteServices() {
+			if err := r.demoteUnvalidatedService(ctx, service); err != nil {
+				log.Error(err, "Failed to demote Service", "service", service.Name, "namespace", service.Namespace)
+				return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+			}
+		}
 		log.Info("Service doesn't have validation label, skipping", "service", service.Name, "namespace", service.Namespace)
 		return ctrl.Result{}, nil
 	}
@@ -95,13 +133,18 @@ func (r *ServiceValidatorReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	result := r.validateServiceEndpoints(ctx, service)
 
 	// Update service with validation results
+	previousStatus := getValidationStatus(service)
 	updated, err := r.updateServiceValidationStatus(ctx, service, result)
 	if err != nil {
 		log.Error(err, "Failed to update service validation status", "service", service.Name, "namespace", service.Namespace)
-		return ctrl.Result{}, err
+		return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
 	}
 
 	if updated {
+		if err := r.trackValidationTransition(ctx, service, previousStatus, result); err != nil {
+			log.Error(err, "Failed to record validation state transition", "service", service.Name, "namespace", service.Namespace)
+		}
+
 		if result.IsValid {
 			log.Info("Service validation passed",
 				"service", service.Name,
@@ -113,14 +156,26 @@ func (r *ServiceValidatorReconciler) Reconcile(ctx context.Context, req ctrl.Req
 				"error", result.Error())
 		}
 	} else {
+		if r.FlapDetector != nil {
+			r.FlapDetector.Refresh(types.NamespacedName{Namespace: service.Namespace, Name: service.Name}, time.Now())
+		}
+
 		log.Info("Service validation status already correct, no changes needed",
 			"service", service.Name,
 			"namespace", service.Namespace,
 			"isValid", result.IsValid)
 	}
 
+	// Promote or demote the Service for external routers
+	if r.promoteServices() {
+		if err := r.updatePromotion(ctx, service, result); err != nil {
+			log.Error(err, "Failed to update Service promotion", "service", service.Name, "namespace", service.Namespace)
+			return r.Backoff.RequeueOnThrottle(err, throttle.DefaultThrottleRequeue)
+		}
+	}
+
 	// Requeue after 5 minutes to check again
-	return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	return ctrl.Result{RequeueAfter: r.Backoff.Requeue(ValidationInterval)}, nil
 }
 
 func shouldValidateService(service *corev1.Service) bool {
@@ -156,6 +211,36 @@ func (r *ServiceValidatorReconciler) validateServiceEndpoints(ctx context.Contex
 		}
 	}
 
+	// Check that traffic isn't only served by terminating endpoints
+	details = append(details, validateEndpointConditions(endpointSliceList.Items)...)
+
+	// Check that ready endpoints don't all share a single node or zone
+	details = append(details, validateTopologySpread(service, endpointSliceList.Items)...)
+
+	// Check that gRPC backends actually serve, not just accept connections
+	details = append(details, r.validateGRPCEndpoints(ctx, service, endpointSliceList.Items)...)
+
+	// Check node-local dataplane programming reported by node agents
+	if r.Config.FeatureEnabled(NodeAgentReports, r.EnableAgentReports) {
+		details = append(details, r.validateAgentReports(ctx, service)...)
+	}
+
+	validateAccounts := r.Config.FeatureEnabled(ServiceAccountValidation, r.ValidateServiceAccounts)
+	var pods []corev1.Pod
+	if r.Rules != nil || validateAccounts {
+		pods = r.getEndpointPods(ctx, endpointSliceList.Items)
+	}
+
+	// Check that the backing pods don't run with default or missing ServiceAccounts
+	if validateAccounts {
+		details = append(details, r.validateServiceAccounts(ctx, service, pods)...)
+	}
+
+	// Check the custom rules configured by users
+	if r.Rules != nil {
+		details = append(details, r.Rules.Evaluate(ctx, service, endpointSliceList.Items, pods)...)
+	}
+
 	if len(details) > 0 {
 		return NewValidationResult(false, service.Name, "endpoint validation failed", details...)
 	}
@@ -173,6 +258,16 @@ func (r *ServiceValidatorReconciler) validateEndpointSlice(ctx context.Context,
 
 	// Validate each endpoint in the slice
 	for j, endpoint := range endpointSlice.Endpoints {
+		// Terminating endpoints are drained during rollouts and scale-downs,
+		// whether they still serve or not
+		if isEndpointTerminating(endpoint) {
+			continue
+		}
+		if !isEndpointServing(endpoint) {
+			details = append(details, fmt.Sprintf("slice %d endpoint %d (%s) is not serving", sliceIndex, j, endpointName(endpoint)))
+			continue
+		}
+
 		if endpoint.TargetRef == nil {
 			details = append(details, fmt.Sprintf("slice %d endpoint %d has no target reference", sliceIndex, j))
 			continue
@@ -211,6 +306,12 @@ func (r *ServiceValidatorReconciler) validateTargetPod(ctx context.Context, targ
 		}
 	}
 
+	// Pods being deleted are drained, clusters that don't report terminating
+	// endpoints still list them
+	if pod.DeletionTimestamp != nil {
+		return NewValidationResult(true, "", "pod is terminating")
+	}
+
 	// Check if pod is running
 	if pod.Status.Phase != corev1.PodRunning {
 		details = append(details, fmt.Sprintf("pod %s is not running (phase: %s)", targetRef.Name, pod.Status.Phase))
@@ -340,6 +441,7 @@ func (r *ServiceValidatorReconciler) createValidationEvent(ctx context.Context,
 func (r *ServiceValidatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Service{}).
+		WithEventFilter(r.Namespaces.Predicate()).
 		WithEventFilter(predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool {
 				log := log.FromContext(context.Background())
@@ -385,7 +487,7 @@ func (r *ServiceValidatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return false
 			},
 		}).
-		Complete(r)
+		Complete(recovery.Wrap("service-validator", r))
 }
 
 func hasValidationLabelChanged(old, new *corev1.Service) bool {
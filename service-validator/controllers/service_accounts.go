@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// Annotation with the ServiceAccount the backing pods of a Service must run
+	// with
+	ExpectedServiceAccountAnnotation = "service-validator/expected-service-account"
+
+	// ServiceAccount pods without serviceAccountName run with
+	defaultServiceAccount = "default"
+)
+
+// validateServiceAccounts checks that the backing pods of a Service run with
+// the ServiceAccount annotated on it, or with any but the default one when
+// none is annotated, and that their ServiceAccounts exist. Pods of the same
+// account are reported together.
+func (r *ServiceValidatorReconciler) validateServiceAccounts(ctx context.Context, service *corev1.Service, pods []corev1.Pod) []string {
+	var details []string
+	expected := strings.TrimSpace(service.Annotations[ExpectedServiceAccountAnnotation])
+
+	podsByAccount := make(map[types.NamespacedName][]string)
+	for _, pod := range pods {
+		// Pods being deleted are drained
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		account := pod.Spec.ServiceAccountName
+		if account == "" {
+			account = defaultServiceAccount
+		}
+		key := types.NamespacedName{Namespace: pod.Namespace, Name: account}
+		podsByAccount[key] = append(podsByAccount[key], pod.Name)
+	}
+
+	accounts := make([]types.NamespacedName, 0, len(podsByAccount))
+	for account := range podsByAccount {
+		accounts = append(accounts, account)
+	}
+	slices.SortFunc(accounts, func(a, b types.NamespacedName) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	for _, account := range accounts {
+		podNames := podsByAccount[account]
+		slices.Sort(podNames)
+		pods := strings.Join(podNames, ", ")
+
+		switch {
+		case expected != "" && account.Name != expected:
+			details = append(details, fmt.Sprintf("pod(s) %s run as ServiceAccount %s, expected %s", pods, account.Name, expected))
+		case expected == "" && account.Name == defaultServiceAccount:
+			details = append(details, fmt.Sprintf("pod(s) %s run with the default ServiceAccount", pods))
+		}
+
+		serviceAccount := &corev1.ServiceAccount{}
+		if err := r.Get(ctx, account, serviceAccount); errors.IsNotFound(err) {
+			details = append(details, fmt.Sprintf("ServiceAccount %s of pod(s) %s doesn't exist", account.Name, pods))
+		} else if err != nil {
+			details = append(details, fmt.Sprintf("failed to get ServiceAccount %s: %v", account.Name, err))
+		}
+	}
+	return details
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import "github.com/psrvere/k8s-controllers/common/controllerconfig"
+
+// Settings that can be changed at runtime through the service-validator ControllerConfig
+const (
+	SettingAgentReportMaxAge  = "agentReportMaxAge"
+	SettingPromotionThreshold = "promotionThreshold"
+	SettingDemotionThreshold  = "demotionThreshold"
+)
+
+// Settings lists the runtime settings of this controller
+var Settings = map[string]controllerconfig.Setting{
+	SettingAgentReportMaxAge: {
+		Type:        controllerconfig.Duration,
+		Description: "Age after which a node agent report is ignored",
+		Min:         controllerconfig.Bound(1),
+	},
+	SettingPromotionThreshold: {
+		Type:        controllerconfig.Int,
+		Description: "Consecutive passed validation cycles before a Service is promoted",
+		Min:         controllerconfig.Bound(1),
+	},
+	SettingDemotionThreshold: {
+		Type:        controllerconfig.Int,
+		Description: "Consecutive failed validation cycles before a promoted Service is demoted",
+		Min:         controllerconfig.Bound(1),
+	},
+}
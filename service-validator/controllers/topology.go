@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+const (
+	// Annotations setting the minimum number of distinct nodes and zones the
+	// ready endpoints of a Service must be spread across
+	MinNodeSpreadAnnotation = "service-validator/min-node-spread"
+	MinZoneSpreadAnnotation = "service-validator/min-zone-spread"
+)
+
+// validateTopologySpread checks that the ready endpoints of a Service don't all
+// reside on too few nodes or zones, where a single node or zone outage would
+// take the Service down. The check only runs when a minimum spread is annotated.
+func validateTopologySpread(service *corev1.Service, endpointSlices []discoveryv1.EndpointSlice) []string {
+	var details []string
+
+	minNodes, err := getMinSpread(service, MinNodeSpreadAnnotation)
+	if err != nil {
+		details = append(details, err.Error())
+	}
+	minZones, err := getMinSpread(service, MinZoneSpreadAnnotation)
+	if err != nil {
+		details = append(details, err.Error())
+	}
+	if minNodes <= 1 && minZones <= 1 {
+		return details
+	}
+
+	nodes := make(map[string]bool)
+	zones := make(map[string]bool)
+	unknownZone := false
+	for _, endpointSlice := range endpointSlices {
+		for _, endpoint := range endpointSlice.Endpoints {
+			// Not ready endpoints don't get new traffic
+			if !isEndpointReady(endpoint) {
+				continue
+			}
+			if endpoint.NodeName != nil {
+				nodes[*endpoint.NodeName] = true
+			}
+			if endpoint.Zone != nil {
+				zones[*endpoint.Zone] = true
+			} else {
+				unknownZone = true
+			}
+		}
+	}
+
+	if minNodes > 1 && len(nodes) < minNodes {
+		details = append(details, fmt.Sprintf("ready endpoints span %d node(s) %s, want at least %d",
+			len(nodes), setString(nodes), minNodes))
+	}
+	if minZones > 1 && len(zones) < minZones {
+		detail := fmt.Sprintf("ready endpoints span %d zone(s) %s, want at least %d", len(zones), setString(zones), minZones)
+		if unknownZone {
+			detail += " (some endpoints have no zone, are nodes labelled with topology.kubernetes.io/zone?)"
+		}
+		details = append(details, detail)
+	}
+
+	return details
+}
+
+// getMinSpread parses a minimum spread annotation. Missing annotations return 1,
+// which disables the check.
+func getMinSpread(service *corev1.Service, annotation string) (int, error) {
+	value, exists := service.Annotations[annotation]
+	if !exists {
+		return 1, nil
+	}
+
+	minSpread, err := strconv.Atoi(value)
+	if err != nil || minSpread < 1 {
+		return 1, fmt.Errorf("invalid %s annotation %q: must be a positive integer", annotation, value)
+	}
+	return minSpread, nil
+}
+
+func setString(set map[string]bool) string {
+	values := make([]string, 0, len(set))
+	for value := range set {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return "[" + strings.Join(values, ", ") + "]"
+}
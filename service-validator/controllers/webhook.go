@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Path the Service validating webhook is served on
+const ServiceWebhookPath = "/validate-v1-service"
+
+// ServiceWebhook checks Services with the validation label for obvious
+// mistakes at admission, before runtime validation even starts: a selector
+// that matches no pod or workload, and target ports the selected pods don't
+// expose.
+type ServiceWebhook struct {
+	// Client reads uncached, lists are paged with Backoff
+	Client  client.Reader
+	Backoff *throttle.AdaptiveBackoff
+	// Deny rejects Services with issues. Without it they are admitted and the
+	// issues are returned as warnings, as a Service is often applied before
+	// its workload.
+	Deny bool
+}
+
+// SetupWebhookWithManager registers the webhook on the manager's webhook server
+func (w *ServiceWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&corev1.Service{}).
+		WithValidator(w).
+		WithValidatorCustomPath(ServiceWebhookPath).
+		Complete()
+}
+
+func (w *ServiceWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return w.validate(ctx, obj)
+}
+
+func (w *ServiceWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return w.validate(ctx, newObj)
+}
+
+func (w *ServiceWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (w *ServiceWebhook) validate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	log := log.FromContext(ctx)
+
+	service, ok := obj.(*corev1.Service)
+	if !ok {
+		return nil, fmt.Errorf("expected a Service, got %T", obj)
+	}
+	if !shouldValidateService(service) {
+		return nil, nil
+	}
+
+	issues, err := w.checkService(ctx, service)
+	if err != nil {
+		// Don't block deployments because the webhook can't look at the cluster
+		log.Error(err, "Failed to check Service at admission", "service", service.Name, "namespace", service.Namespace)
+		return admission.Warnings{fmt.Sprintf("service-validator could not check the Service: %v", err)}, nil
+	}
+	if len(issues) == 0 {
+		return nil, nil
+	}
+
+	log.Info("Service has issues at admission", "service", service.Name, "namespace", service.Namespace, "issues", issues, "deny", w.Deny)
+	if w.Deny {
+		return nil, fmt.Errorf("service %s/%s is invalid: %s", service.Namespace, service.Name, strings.Join(issues, "; "))
+	}
+	return admission.Warnings(issues), nil
+}
+
+// checkService returns the issues of a Service. Services without a selector
+// (manually managed endpoints, ExternalName) have nothing to check.
+func (w *ServiceWebhook) checkService(ctx context.Context, service *corev1.Service) ([]string, error) {
+	if len(service.Spec.Selector) == 0 || service.Spec.Type == corev1.ServiceTypeExternalName {
+		return nil, nil
+	}
+
+	podSpecs, err := w.selectedPodSpecs(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	if len(podSpecs) == 0 {
+		return []string{fmt.Sprintf("selector %s matches no pods or workload pod templates in namespace %s",
+			labels.SelectorFromSet(service.Spec.Selector), service.Namespace)}, nil
+	}
+
+	var issues []string
+	for _, port := range service.Spec.Ports {
+		if issue := checkTargetPort(port, podSpecs); issue != "" {
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+// selectedPodSpecs returns the specs of the pods and of the Deployment,
+// StatefulSet and DaemonSet pod templates the Service selects. Templates count
+// so a Service can be created before its workload has running pods.
+func (w *ServiceWebhook) selectedPodSpecs(ctx context.Context, service *corev1.Service) ([]corev1.PodSpec, error) {
+	selector := labels.SelectorFromSet(service.Spec.Selector)
+	inNamespace := client.InNamespace(service.Namespace)
+
+	var specs []corev1.PodSpec
+	podList := &corev1.PodList{}
+	if err := throttle.ListPages(ctx, w.Client, podList, w.Backoff, inNamespace, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for _, pod := range podList.Items {
+		specs = append(specs, pod.Spec)
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := throttle.ListPages(ctx, w.Client, deployments, w.Backoff, inNamespace); err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, deployment := range deployments.Items {
+		if selector.Matches(labels.Set(deployment.Spec.Template.Labels)) {
+			specs = append(specs, deployment.Spec.Template.Spec)
+		}
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := throttle.ListPages(ctx, w.Client, statefulSets, w.Backoff, inNamespace); err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, statefulSet := range statefulSets.Items {
+		if selector.Matches(labels.Set(statefulSet.Spec.Template.Labels)) {
+			specs = append(specs, statefulSet.Spec.Template.Spec)
+		}
+	}
+
+	daemonSets := &appsv1.DaemonSetList{}
+	if err := throttle.ListPages(ctx, w.Client, daemonSets, w.Backoff, inNamespace); err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for _, daemonSet := range daemonSets.Items {
+		if selector.Matches(labels.Set(daemonSet.Spec.Template.Labels)) {
+			specs = append(specs, daemonSet.Spec.Template.Spec)
+		}
+	}
+
+	return specs, nil
+}
+
+// checkTargetPort returns an issue when none of the selected pods exposes the
+// target port of a Service port. A named target port must be declared by a
+// container. Numeric target ports are only checked against pods that declare
+// container ports at all, declaring ports is optional.
+func checkTargetPort(port corev1.ServicePort, podSpecs []corev1.PodSpec) string {
+	targetPort := port.TargetPort
+	if targetPort.Type == intstr.Int && targetPort.IntVal == 0 {
+		// The target port defaults to the port
+		targetPort = intstr.FromInt32(port.Port)
+	}
+	protocol := port.Protocol
+	if protocol == "" {
+		protocol = corev1.ProtocolTCP
+	}
+
+	declaresPorts := false
+	for _, spec := range podSpecs {
+		for _, container := range spec.Containers {
+			for _, containerPort := range container.Ports {
+				declaresPorts = true
+				containerProtocol := containerPort.Protocol
+				if containerProtocol == "" {
+					containerProtocol = corev1.ProtocolTCP
+				}
+				if containerProtocol != protocol {
+					continue
+				}
+				if targetPort.Type == intstr.String && containerPort.Name == targetPort.StrVal {
+					return ""
+				}
+				if targetPort.Type == intstr.Int && containerPort.ContainerPort == targetPort.IntVal {
+					return ""
+				}
+			}
+		}
+	}
+
+	name := port.Name
+	if name == "" {
+		name = fmt.Sprint(port.Port)
+	}
+	if targetPort.Type == intstr.String {
+		return fmt.Sprintf("port %s: target port %q is not a named %s container port of the selected pods", name, targetPort.StrVal, protocol)
+	}
+	if declaresPorts {
+		return fmt.Sprintf("port %s: target port %d/%s is not a container port of the selected pods", name, targetPort.IntVal, protocol)
+	}
+	return ""
+}
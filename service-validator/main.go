@@ -2,21 +2,37 @@ package main
 
 import (
 	"context"
+	_ "embed"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
+	configv1alpha1 "github.com/psrvere/k8s-controllers/common/api/v1alpha1"
+	"github.com/psrvere/k8s-controllers/common/controllerconfig"
+	"github.com/psrvere/k8s-controllers/common/featuregate"
+	"github.com/psrvere/k8s-controllers/common/manifests"
+	"github.com/psrvere/k8s-controllers/common/predicates"
+	"github.com/psrvere/k8s-controllers/common/restconfig"
+	"github.com/psrvere/k8s-controllers/common/selftest"
+	"github.com/psrvere/k8s-controllers/common/throttle"
+	"github.com/psrvere/k8s-controllers/common/version"
+	validatorv1alpha1 "github.com/psrvere/k8s-controllers/service-validator/api/v1alpha1"
 	"github.com/psrvere/k8s-controllers/service-validator/controllers"
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 var (
@@ -24,13 +40,66 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+// CRD of the NodeProbeReport API, printed by the manifests subcommand
+//
+//go:embed config/crd/nodeprobereports.yaml
+var nodeProbeReportsCRD []byte
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(validatorv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	// "<binary> selftest [flags]" verifies an installation end-to-end
+	if len(os.Args) > 1 && os.Args[1] == selftest.Command {
+		os.Exit(selftest.Main(os.Args[2:], scheme, controllers.SelfTest()))
+	}
+
+	// "<binary> manifests [flags] [-- controller flags]" prints the install manifests
+	if len(os.Args) > 1 && os.Args[1] == manifests.Command {
+		manifest := controllers.Manifest()
+		manifest.CRDs = [][]byte{nodeProbeReportsCRD}
+		os.Exit(manifests.Main(os.Args[2:], manifest))
+	}
+
 	var probeAddr string
+	var mode string
+	var nodeName string
+	var enableAgentReports bool
+	var flapThreshold int
+	var promotionThreshold int
+	var demotionThreshold int
+	var rulesConfigMap string
+	var enableWebhook bool
+	var webhookDeny bool
+	var webhookPort int
+	var webhookCertDir string
+	var validateIngresses bool
+	var validateHTTPRoutes bool
 	flag.String("health-probe-bind-address", ":8080", "Probe endpoint binds to this address")
+	flag.StringVar(&mode, "mode", "controller", "Run as the central validator (controller) or as a node agent (agent)")
+	flag.StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"), "Name of the node the agent runs on (agent mode only)")
+	flag.BoolVar(&enableAgentReports, "enable-agent-reports", false, "Include node agent probe reports in service validation")
+	flag.StringVar(&rulesConfigMap, "rules-configmap", "", "ConfigMap (namespace/name) with custom CEL validation rules, empty disables them")
+	flag.IntVar(&flapThreshold, "flap-threshold", controllers.DefaultFlapThreshold, "Number of valid/invalid transitions per hour above which a Service is reported as flapping")
+	flag.IntVar(&promotionThreshold, "promotion-threshold", controllers.DefaultPromotionThreshold, "Consecutive passed validation cycles before a Service gets the service-validator/validated label (CanaryPromotion gate)")
+	flag.IntVar(&demotionThreshold, "demotion-threshold", controllers.DefaultDemotionThreshold, "Consecutive failed validation cycles before a Service loses the service-validator/validated label (CanaryPromotion gate)")
+	flag.BoolVar(&enableWebhook, "enable-webhook", false, "Serve the validating admission webhook for Services with the validation label")
+	flag.BoolVar(&webhookDeny, "webhook-deny", false, "Deny Services with issues instead of admitting them with the issues as warnings")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "Port the admission webhook server listens on")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "", "Directory with the webhook serving certificate (tls.crt, tls.key), empty uses the controller-runtime default")
+
+	flag.BoolVar(&validateIngresses, "validate-ingresses", false, "Validate the backend Services of Ingresses with the validation label")
+	flag.BoolVar(&validateHTTPRoutes, "validate-httproutes", false, "Validate the backend Services of Gateway API HTTPRoutes with the validation label (requires the Gateway API CRDs)")
+
+	// --kubeconfig, --context and impersonation for running out-of-cluster
+	var connection restconfig.Options
+	connection.AddFlags(flag.CommandLine)
+
+	features := featuregate.New("service-validator", controllers.FeatureGates)
+	features.AddFlag(flag.CommandLine)
 
 	opts := zap.Options{
 		Development: true,
@@ -39,24 +108,112 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	features.Report(setupLog)
+	version.Report(setupLog, features)
+
+	restConfig, err := connection.Load()
+	if err != nil {
+		setupLog.Error(err, "Unable to load kubeconfig")
+		os.Exit(1)
+	}
+
+	if mode == "agent" {
+		runNodeAgent(restConfig, nodeName)
+		return
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		HealthProbeBindAddress: probeAddr,
-	})
+	}
+	if enableWebhook {
+		options.WebhookServer = webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		})
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, options)
 	if err != nil {
 		setupLog.Error(err, "Unable to start manager")
 		os.Exit(1)
 	}
 
+	var rules *controllers.RuleEngine
+	if rulesConfigMap != "" {
+		namespace, name, found := strings.Cut(rulesConfigMap, "/")
+		if !found || namespace == "" || name == "" {
+			setupLog.Error(fmt.Errorf("invalid --rules-configmap %q", rulesConfigMap), "expected namespace/name")
+			os.Exit(1)
+		}
+		rules = &controllers.RuleEngine{
+			Client:    mgr.GetClient(),
+			ConfigMap: types.NamespacedName{Namespace: namespace, Name: name},
+		}
+	}
+
+	// The report max age and feature gates can be changed at runtime with a ControllerConfig
+	config := controllerconfig.New("service-validator", controllers.Settings, features)
+	if err := config.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ControllerConfig")
+		os.Exit(1)
+	}
+
+	// Build and effective feature gates on /version of the metrics server
+	if err := version.AddToManager(mgr, "service-validator", config.ActiveFeatureGates); err != nil {
+		setupLog.Error(err, "unable to serve version")
+		os.Exit(1)
+	}
+
+	backoff := throttle.NewAdaptiveBackoff("service-validator")
 	if err = (&controllers.ServiceValidatorReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  throttle.WrapClient(mgr.GetClient(), backoff),
+		Scheme:                  mgr.GetScheme(),
+		Backoff:                 backoff,
+		EnableAgentReports:      enableAgentReports || features.Enabled(controllers.NodeAgentReports),
+		FlapDetector:            &controllers.FlapDetector{Threshold: flapThreshold},
+		Namespaces:              predicates.NewNamespaceFilter(mgr.GetClient()),
+		Rules:                   rules,
+		Config:                  config,
+		Promotion:               &controllers.PromotionTracker{PromotionThreshold: promotionThreshold, DemotionThreshold: demotionThreshold},
+		PromoteServices:         features.Enabled(controllers.CanaryPromotion),
+		ValidateServiceAccounts: features.Enabled(controllers.ServiceAccountValidation),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ServiceValidator")
 		os.Exit(1)
 	}
 
+	// Each route kind runs its own controller
+	var routeKinds []string
+	if validateIngresses {
+		routeKinds = append(routeKinds, controllers.RouteKindIngress)
+	}
+	if validateHTTPRoutes {
+		routeKinds = append(routeKinds, controllers.RouteKindHTTPRoute)
+	}
+	for _, kind := range routeKinds {
+		if err = (&controllers.RouteValidatorReconciler{
+			Client:     throttle.WrapClient(mgr.GetClient(), backoff),
+			Backoff:    backoff,
+			Kind:       kind,
+			Namespaces: predicates.NewNamespaceFilter(mgr.GetClient()),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", kind)
+			os.Exit(1)
+		}
+	}
+
+	if enableWebhook {
+		if err := (&controllers.ServiceWebhook{
+			Client:  mgr.GetAPIReader(),
+			Backoff: backoff,
+			Deny:    webhookDeny,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Service")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to setup health check")
 		os.Exit(1)
@@ -94,3 +251,35 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runNodeAgent starts a manager that only runs the node agent. Agents run with
+// hostNetwork, so the metrics server is disabled to avoid host port clashes.
+func runNodeAgent(restConfig *rest.Config, nodeName string) {
+	if nodeName == "" {
+		setupLog.Error(fmt.Errorf("node name is empty"), "agent mode requires --node-name or NODE_NAME")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme:  scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		setupLog.Error(err, "Unable to start manager")
+		os.Exit(1)
+	}
+
+	if err := mgr.Add(&controllers.NodeAgent{
+		Client:   mgr.GetClient(),
+		NodeName: nodeName,
+	}); err != nil {
+		setupLog.Error(err, "unable to create node agent")
+		os.Exit(1)
+	}
+
+	setupLog.Info("starting node agent", "node", nodeName)
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		setupLog.Error(err, "problem running node agent")
+		os.Exit(1)
+	}
+}